@@ -0,0 +1,191 @@
+package clamav
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/port"
+)
+
+// hookName identifies the scanner in logs and task errors
+const hookName = "clamav"
+
+// streamChunkSize is the size of the chunks a copy is sent to clamd in
+const streamChunkSize = 64 * 1024
+
+// Scanner is a pre-serve hook that scans cached copies with clamd over its
+// INSTREAM command, so clamd does not need access to the cache directory.
+// It implements port.PreServeHook.
+type Scanner struct {
+	network string
+	address string
+	timeout time.Duration
+	maxSize int64
+}
+
+// New creates a Scanner for the clamd listening on address, either
+// unix:///path/to/clamd.sock, tcp://host:port or host:port. Each scan is
+// limited to timeout. Copies larger than maxSize bytes are not scanned
+// (0 = scan all); it should match clamd's StreamMaxLength, beyond which clamd
+// refuses the stream.
+func New(address string, timeout time.Duration, maxSize int64) (*Scanner, error) {
+	network, addr, err := parseAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	return &Scanner{
+		network: network,
+		address: addr,
+		timeout: timeout,
+		maxSize: maxSize,
+	}, nil
+}
+
+// parseAddress splits a clamd address into a network and an address for net.Dial
+func parseAddress(address string) (string, string, error) {
+	switch {
+	case strings.HasPrefix(address, "unix://"):
+		path := strings.TrimPrefix(address, "unix://")
+		if path == "" {
+			return "", "", fmt.Errorf("invalid clamd address %q: missing socket path", address)
+		}
+		return "unix", path, nil
+	case strings.HasPrefix(address, "tcp://"):
+		address = strings.TrimPrefix(address, "tcp://")
+	case strings.Contains(address, "://"):
+		return "", "", fmt.Errorf("invalid clamd address %q: scheme must be unix or tcp", address)
+	}
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return "", "", fmt.Errorf("invalid clamd address %q: %w", address, err)
+	}
+	return "tcp", address, nil
+}
+
+// Name returns the name of the hook
+func (s *Scanner) Name() string {
+	return hookName
+}
+
+// Ping checks that clamd is reachable
+func (s *Scanner) Ping(ctx context.Context) error {
+	reply, err := s.command(ctx, func(w io.Writer) error {
+		_, err := io.WriteString(w, "zPING\x00")
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if reply != "PONG" {
+		return fmt.Errorf("clamd: unexpected reply to PING: %q", reply)
+	}
+	return nil
+}
+
+// Inspect streams the copy read from body to clamd. An infected copy is
+// reported as a *domain.RejectedError naming the signature found.
+func (s *Scanner) Inspect(ctx context.Context, file *domain.File, body port.CachedFile) error {
+	if s.maxSize > 0 && body.Size() > s.maxSize {
+		return nil
+	}
+
+	reply, err := s.command(ctx, func(w io.Writer) error {
+		return writeStream(w, body)
+	})
+	if err != nil {
+		return err
+	}
+	return parseScanReply(reply)
+}
+
+// command sends a request written by send to clamd and returns its reply
+func (s *Scanner) command(ctx context.Context, send func(w io.Writer) error) (string, error) {
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, s.network, s.address)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to clamd: %w", err)
+	}
+	defer conn.Close()
+
+	// Unblock reads and writes when the context ends
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	if err := send(conn); err != nil {
+		return "", fmt.Errorf("failed to send to clamd: %w", contextError(ctx, err))
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && !(errors.Is(err, io.EOF) && reply != "") {
+		return "", fmt.Errorf("failed to read clamd reply: %w", contextError(ctx, err))
+	}
+	return strings.TrimSpace(strings.TrimSuffix(reply, "\x00")), nil
+}
+
+// writeStream sends r with the INSTREAM command: chunks prefixed with their
+// length as a 4 byte big-endian integer, ended by a zero length chunk
+func writeStream(w io.Writer, r io.Reader) error {
+	if _, err := io.WriteString(w, "zINSTREAM\x00"); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 4+streamChunkSize)
+	for {
+		n, err := r.Read(buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf[:4], uint32(n))
+			if _, err := w.Write(buf[:4+n]); err != nil {
+				return err
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := w.Write([]byte{0, 0, 0, 0})
+	return err
+}
+
+// parseScanReply turns the reply to INSTREAM into the result of a scan:
+// "stream: OK", "stream: <signature> FOUND" or "<message> ERROR"
+func parseScanReply(reply string) error {
+	result := strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case result == "OK":
+		return nil
+	case strings.HasSuffix(result, " FOUND"):
+		return &domain.RejectedError{
+			Hook:   hookName,
+			Reason: strings.TrimSuffix(result, " FOUND"),
+		}
+	default:
+		return fmt.Errorf("clamd: %s", strings.TrimSuffix(result, " ERROR"))
+	}
+}
+
+// contextError prefers the context's error over the deadline error it caused
+func contextError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
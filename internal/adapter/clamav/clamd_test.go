@@ -0,0 +1,169 @@
+package clamav
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/util/cryptfile"
+)
+
+// fakeClamd answers INSTREAM with FOUND for streams containing "EICAR" and
+// OK otherwise, and PING with PONG
+func fakeClamd(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveClamd(conn)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func serveClamd(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	cmd, err := r.ReadString(0)
+	if err != nil {
+		return
+	}
+	switch cmd {
+	case "zPING\x00":
+		io.WriteString(conn, "PONG\x00")
+	case "zINSTREAM\x00":
+		var data bytes.Buffer
+		for {
+			var size uint32
+			if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+				return
+			}
+			if size == 0 {
+				break
+			}
+			if _, err := io.CopyN(&data, r, int64(size)); err != nil {
+				return
+			}
+		}
+		if bytes.Contains(data.Bytes(), []byte("EICAR")) {
+			io.WriteString(conn, "stream: Eicar-Signature FOUND\x00")
+		} else {
+			io.WriteString(conn, "stream: OK\x00")
+		}
+	default:
+		io.WriteString(conn, "UNKNOWN COMMAND\x00")
+	}
+}
+
+// openTestFile writes content to a file and opens it as a cached copy
+func openTestFile(t *testing.T, content []byte) *cryptfile.File {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	f, err := cryptfile.Open(path, nil)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+func TestScanner_Inspect(t *testing.T) {
+	s, err := New(fakeClamd(t), 5*time.Second, 0)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	ctx := context.Background()
+
+	if err := s.Ping(ctx); err != nil {
+		t.Fatalf("Ping() error = %v", err)
+	}
+
+	// Larger than a chunk, so the stream is split
+	clean := openTestFile(t, bytes.Repeat([]byte("a"), 3*streamChunkSize/2))
+	if err := s.Inspect(ctx, &domain.File{}, clean); err != nil {
+		t.Errorf("Inspect(clean) error = %v", err)
+	}
+
+	infected := openTestFile(t, []byte("X5O!P%@AP EICAR test file"))
+	err = s.Inspect(ctx, &domain.File{}, infected)
+	var re *domain.RejectedError
+	if !errors.As(err, &re) {
+		t.Fatalf("Inspect(infected) error = %v, want RejectedError", err)
+	}
+	if re.Hook != "clamav" || re.Reason != "Eicar-Signature" {
+		t.Errorf("RejectedError = %+v, want clamav/Eicar-Signature", re)
+	}
+}
+
+func TestScanner_InspectSkipsLargeFiles(t *testing.T) {
+	s, err := New(fakeClamd(t), 5*time.Second, 8)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	infected := openTestFile(t, []byte("X5O!P%@AP EICAR test file"))
+	if err := s.Inspect(context.Background(), &domain.File{}, infected); err != nil {
+		t.Errorf("Inspect() error = %v, want nil for a file over the limit", err)
+	}
+}
+
+func TestParseScanReply(t *testing.T) {
+	if err := parseScanReply("stream: OK"); err != nil {
+		t.Errorf("OK error = %v", err)
+	}
+	if err := parseScanReply("stream: Win.Test.EICAR_HDB-1 FOUND"); !errors.Is(err, domain.ErrFileRejected) {
+		t.Errorf("FOUND error = %v, want ErrFileRejected", err)
+	}
+	err := parseScanReply("INSTREAM size limit exceeded. ERROR")
+	if err == nil || errors.Is(err, domain.ErrFileRejected) {
+		t.Errorf("ERROR error = %v, want a non-rejection error", err)
+	}
+}
+
+func TestParseAddress(t *testing.T) {
+	tests := []struct {
+		address     string
+		wantNetwork string
+		wantAddr    string
+		wantErr     bool
+	}{
+		{"unix:///run/clamav/clamd.ctl", "unix", "/run/clamav/clamd.ctl", false},
+		{"tcp://clamd:3310", "tcp", "clamd:3310", false},
+		{"localhost:3310", "tcp", "localhost:3310", false},
+		{"unix://", "", "", true},
+		{"http://clamd:3310", "", "", true},
+		{"clamd", "", "", true},
+	}
+	for _, tt := range tests {
+		network, addr, err := parseAddress(tt.address)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseAddress(%q) error = %v, wantErr %v", tt.address, err, tt.wantErr)
+			continue
+		}
+		if network != tt.wantNetwork || addr != tt.wantAddr {
+			t.Errorf("parseAddress(%q) = %s %s, want %s %s", tt.address, network, addr, tt.wantNetwork, tt.wantAddr)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package filesystem
+
+import "github.com/vertextoedge/synology-file-cache/internal/port"
+
+// newDiskUsage builds a DiskUsage from the volume size and the bytes still
+// available to this process. Space reserved for the superuser or outside the
+// caller's quota counts as used, so the cache never plans on it.
+func newDiskUsage(total, free uint64) *port.DiskUsage {
+	if free > total {
+		free = total
+	}
+	used := total - free
+
+	usage := &port.DiskUsage{
+		Total: total,
+		Used:  used,
+		Free:  free,
+	}
+	if total > 0 {
+		usage.UsedPct = float64(used) / float64(total) * 100
+	}
+	return usage
+}
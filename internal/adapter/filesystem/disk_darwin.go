@@ -0,0 +1,23 @@
+//go:build darwin
+// +build darwin
+
+package filesystem
+
+import (
+	"fmt"
+	"syscall"
+
+	"github.com/vertextoedge/synology-file-cache/internal/port"
+)
+
+// GetDiskUsage returns disk usage for the cache directory.
+// APFS volumes share their container's free space, so f_bavail (what this
+// volume can still allocate) is used rather than f_bfree.
+func (m *Manager) GetDiskUsage() (*port.DiskUsage, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(m.rootDir, &stat); err != nil {
+		return nil, fmt.Errorf("failed to get disk stats: %w", err)
+	}
+
+	return newDiskUsage(stat.Blocks*uint64(stat.Bsize), stat.Bavail*uint64(stat.Bsize)), nil
+}
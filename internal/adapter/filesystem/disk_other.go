@@ -0,0 +1,17 @@
+//go:build !linux && !freebsd && !darwin && !windows
+// +build !linux,!freebsd,!darwin,!windows
+
+package filesystem
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/vertextoedge/synology-file-cache/internal/port"
+)
+
+// GetDiskUsage is not implemented on this platform; the disk usage limit
+// cannot be enforced and space checks report an error instead.
+func (m *Manager) GetDiskUsage() (*port.DiskUsage, error) {
+	return nil, fmt.Errorf("disk usage is not supported on %s", runtime.GOOS)
+}
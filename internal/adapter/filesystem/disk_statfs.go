@@ -1,5 +1,5 @@
-//go:build !windows
-// +build !windows
+//go:build linux || freebsd
+// +build linux freebsd
 
 package filesystem
 
@@ -17,14 +17,5 @@ func (m *Manager) GetDiskUsage() (*port.DiskUsage, error) {
 		return nil, fmt.Errorf("failed to get disk stats: %w", err)
 	}
 
-	total := stat.Blocks * uint64(stat.Bsize)
-	free := stat.Bavail * uint64(stat.Bsize)
-	used := total - free
-
-	return &port.DiskUsage{
-		Total:   total,
-		Used:    used,
-		Free:    free,
-		UsedPct: float64(used) / float64(total) * 100,
-	}, nil
+	return newDiskUsage(uint64(stat.Blocks)*uint64(stat.Bsize), uint64(stat.Bavail)*uint64(stat.Bsize)), nil
 }
@@ -16,7 +16,7 @@ var (
 	getDiskFreeSpace = kernel32.NewProc("GetDiskFreeSpaceExW")
 )
 
-// GetDiskUsage returns disk usage for the cache directory
+// GetDiskUsage returns disk usage for the volume holding the cache directory
 func (m *Manager) GetDiskUsage() (*port.DiskUsage, error) {
 	var freeBytesAvailable, totalNumberOfBytes, totalNumberOfFreeBytes uint64
 
@@ -38,12 +38,6 @@ func (m *Manager) GetDiskUsage() (*port.DiskUsage, error) {
 		return nil, fmt.Errorf("failed to get disk stats: %w", err)
 	}
 
-	used := totalNumberOfBytes - totalNumberOfFreeBytes
-
-	return &port.DiskUsage{
-		Total:   totalNumberOfBytes,
-		Used:    used,
-		Free:    totalNumberOfFreeBytes,
-		UsedPct: float64(used) / float64(totalNumberOfBytes) * 100,
-	}, nil
+	// freeBytesAvailable honours per-user quotas, matching f_bavail on Unix
+	return newDiskUsage(totalNumberOfBytes, freeBytesAvailable), nil
 }
@@ -0,0 +1,138 @@
+package filesystem
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"github.com/vertextoedge/synology-file-cache/internal/util/cryptfile"
+)
+
+// reencryptMinAge keeps the re-encryption from racing writers of copies that
+// were just moved into the cache
+const reencryptMinAge = time.Minute
+
+// EnableEncryption encrypts copies with the current key of keys as they are
+// moved into the cache, and decrypts copies encrypted with any key of keys
+// when they are read. Copies stored in plain before encryption was enabled
+// stay readable; ReencryptFile encrypts them.
+func (m *Manager) EnableEncryption(keys *cryptfile.Keyring) {
+	m.keys = keys
+}
+
+// open opens a cached copy for reading its plain content
+func (m *Manager) open(cachePath string) (*cryptfile.File, error) {
+	return cryptfile.Open(cachePath, m.keys)
+}
+
+// OpenCached opens a cached copy for reading
+func (m *Manager) OpenCached(cachePath string) (port.CachedFile, error) {
+	f, err := m.open(cachePath)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// plainSize returns the plain size of a cached copy
+func (m *Manager) plainSize(cachePath string) (int64, error) {
+	f, err := m.open(cachePath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return f.Size(), nil
+}
+
+// encryptFile writes src encrypted with the current key to a new file dst
+// and flushes it to disk
+func (m *Manager) encryptFile(src *cryptfile.File, dst string) error {
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	w, err := cryptfile.NewWriter(out, m.keys.Current())
+	if err == nil {
+		_, err = m.buffers.Copy(w, src)
+	}
+	if err == nil {
+		err = w.Close()
+	}
+	if err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// encryptIntoCache encrypts a completed download next to cachePath and
+// renames it into place, removing tempPath
+func (m *Manager) encryptIntoCache(tempPath, cachePath string) error {
+	// Downloads are written in plain
+	in, err := cryptfile.Open(tempPath, nil)
+	if err != nil {
+		return err
+	}
+
+	encryptingPath := cachePath + ".encrypting"
+	err = m.encryptFile(in, encryptingPath)
+	in.Close()
+	if err != nil {
+		os.Remove(encryptingPath)
+		return err
+	}
+	if err := replaceFile(encryptingPath, cachePath); err != nil {
+		os.Remove(encryptingPath)
+		return err
+	}
+	return os.Remove(tempPath)
+}
+
+// ReencryptFile rewrites a cached copy or blob stored in plain or encrypted
+// with an old key with the current key, keeping its modification time so
+// ETags and derived files stay valid. Copies modified within the last minute
+// or while being rewritten are left alone. Returns whether the copy was
+// rewritten.
+func (m *Manager) ReencryptFile(path string) (bool, error) {
+	if m.keys == nil {
+		return false, nil
+	}
+
+	src, err := m.open(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer src.Close()
+
+	if src.KeyID() == m.keys.Current().ID() || time.Since(src.ModTime()) < reencryptMinAge {
+		return false, nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+
+	encryptingPath := path + ".encrypting"
+	if err := m.encryptFile(src, encryptingPath); err != nil {
+		os.Remove(encryptingPath)
+		return false, fmt.Errorf("failed to encrypt file: %w", err)
+	}
+	if err := os.Chtimes(encryptingPath, info.ModTime(), info.ModTime()); err != nil {
+		os.Remove(encryptingPath)
+		return false, err
+	}
+
+	// Don't clobber a copy replaced while it was encrypted
+	if now, err := os.Stat(path); err != nil || now.Size() != info.Size() || !now.ModTime().Equal(info.ModTime()) {
+		os.Remove(encryptingPath)
+		return false, nil
+	}
+	if err := replaceFile(encryptingPath, path); err != nil {
+		os.Remove(encryptingPath)
+		return false, fmt.Errorf("failed to replace file: %w", err)
+	}
+	return true, nil
+}
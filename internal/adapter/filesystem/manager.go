@@ -1,24 +1,65 @@
 package filesystem
 
 import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
 	"path/filepath"
 	"time"
 
 	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"github.com/vertextoedge/synology-file-cache/internal/util/bufpool"
+	"github.com/vertextoedge/synology-file-cache/internal/util/cryptfile"
 )
 
+// compressMinSavingPct is the smallest size reduction worth storing a file compressed
+const compressMinSavingPct = 10
+
+// blobDirName is the directory under the root holding deduplicated copies
+const blobDirName = ".blobs"
+
 // Manager handles local filesystem operations
 type Manager struct {
-	rootDir    string
-	bufferSize int
+	rootDir     string
+	tempDir     string // In-progress downloads ("" = next to the cached file)
+	crossDevice bool   // tempDir is on another filesystem than rootDir
+	trash       *trash // nil = removed copies are deleted right away
+	buffers     *bufpool.Pool
+	keys        *cryptfile.Keyring // nil = copies are stored in plain
 }
 
 // Ensure Manager implements port.FileSystem
 var _ port.FileSystem = (*Manager)(nil)
 
+// writerOnly hides the ReadFrom of *os.File, which copies readers other than
+// files and sockets through a 32KB buffer instead of the configured one
+type writerOnly struct {
+	io.Writer
+}
+
+// nopWriteCloser adds a no-op Close to a writer
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// countWriter counts the bytes written through it
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
 // NewManager creates a new filesystem manager
 func NewManager(rootDir string) (*Manager, error) {
 	return NewManagerWithBufferSize(rootDir, 8*1024*1024) // 8MB default
@@ -36,8 +77,8 @@ func NewManagerWithBufferSize(rootDir string, bufferSize int) (*Manager, error)
 	}
 
 	return &Manager{
-		rootDir:    rootDir,
-		bufferSize: bufferSize,
+		rootDir: rootDir,
+		buffers: bufpool.New(bufferSize),
 	}, nil
 }
 
@@ -46,9 +87,11 @@ func (m *Manager) RootDir() string {
 	return m.rootDir
 }
 
-// CachePath returns the local cache path for a Synology file path
+// CachePath returns the local cache path for a Synology file path.
+// Drive paths always use forward slashes; they are converted to the host's
+// separator so the result is a native path on Windows as well.
 func (m *Manager) CachePath(synoPath string) string {
-	return filepath.Join(m.rootDir, synoPath)
+	return filepath.Join(m.rootDir, filepath.FromSlash(synoPath))
 }
 
 // EnsureDir ensures the directory for a file path exists
@@ -73,7 +116,7 @@ func (m *Manager) WriteFileWithResume(synoPath string, reader io.Reader, resume
 
 	// If tempPath is not provided, generate a default one
 	if tempPath == "" {
-		tempPath = cachePath + ".downloading"
+		tempPath = m.TempPath(synoPath)
 	}
 
 	var f *os.File
@@ -104,29 +147,61 @@ func (m *Manager) WriteFileWithResume(synoPath string, reader io.Reader, resume
 		}
 	}
 
-	// Use configurable buffer for better performance on high-speed networks
-	buf := make([]byte, m.bufferSize)
-	written, err := io.CopyBuffer(f, reader, buf)
+	// Use configurable buffer for better performance on high-speed networks,
+	// pooled so concurrent downloads don't each allocate one
+	written, err := m.buffers.Copy(writerOnly{f}, reader)
 	if err != nil {
 		f.Close()
+		m.wipeTempFile(tempPath)
 		return "", 0, fmt.Errorf("failed to write file: %w", err)
 	}
 
 	if err := f.Close(); err != nil {
+		m.wipeTempFile(tempPath)
 		return "", 0, fmt.Errorf("failed to close file: %w", err)
 	}
 
 	// Calculate total written
 	totalWritten := existingSize + written
 
-	// Rename to final path
-	if err := os.Rename(tempPath, cachePath); err != nil {
-		return "", 0, fmt.Errorf("failed to rename temp file: %w", err)
+	// Move to final path
+	if err := m.moveIntoCache(tempPath, cachePath); err != nil {
+		return "", 0, fmt.Errorf("failed to move temp file into cache: %w", err)
 	}
 
 	return cachePath, totalWritten, nil
 }
 
+// CreateSegmentFile creates tempPath as a sparse file of size bytes. Blocks
+// are allocated as segments are written, so no space is used up front.
+func (m *Manager) CreateSegmentFile(tempPath string, size int64) (port.SegmentFile, error) {
+	if err := m.EnsureDir(tempPath); err != nil {
+		return nil, fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	f, err := os.Create(tempPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	if err := f.Truncate(size); err != nil {
+		f.Close()
+		os.Remove(tempPath)
+		return nil, fmt.Errorf("failed to size temp file: %w", err)
+	}
+	return f, nil
+}
+
+// CommitTempFile moves a completed temp file to the cache path of synoPath
+func (m *Manager) CommitTempFile(synoPath, tempPath string) (string, error) {
+	cachePath := m.CachePath(synoPath)
+	if err := m.EnsureDir(cachePath); err != nil {
+		return "", fmt.Errorf("failed to create parent dir: %w", err)
+	}
+	if err := m.moveIntoCache(tempPath, cachePath); err != nil {
+		return "", fmt.Errorf("failed to move temp file into cache: %w", err)
+	}
+	return cachePath, nil
+}
+
 // DeleteFile removes a cached file
 func (m *Manager) DeleteFile(cachePath string) error {
 	if err := os.Remove(cachePath); err != nil && !os.IsNotExist(err) {
@@ -135,19 +210,172 @@ func (m *Manager) DeleteFile(cachePath string) error {
 	return nil
 }
 
+// CompressFile gzips a cached file in place. The compressed copy is kept only
+// if it saves at least compressMinSavingPct of the original size. Encrypted
+// copies are compressed before they are encrypted again.
+func (m *Manager) CompressFile(cachePath string) (bool, error) {
+	src, err := m.open(cachePath)
+	if err != nil {
+		return false, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer src.Close()
+
+	tempPath := cachePath + ".compressing"
+	dst, err := os.Create(tempPath)
+	if err != nil {
+		return false, fmt.Errorf("failed to create temp file: %w", err)
+	}
+
+	var out io.WriteCloser = nopWriteCloser{dst}
+	if m.keys != nil {
+		out, err = cryptfile.NewWriter(dst, m.keys.Current())
+	}
+	counted := &countWriter{w: out}
+	if err == nil {
+		zw := gzip.NewWriter(counted)
+		_, err = m.buffers.Copy(zw, src)
+		if err == nil {
+			err = zw.Close()
+		}
+	}
+	if err == nil {
+		err = out.Close()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tempPath)
+		return false, fmt.Errorf("failed to compress file: %w", err)
+	}
+
+	if counted.n > src.Size()*(100-compressMinSavingPct)/100 {
+		os.Remove(tempPath)
+		return false, nil
+	}
+
+	if err := replaceFile(tempPath, cachePath); err != nil {
+		os.Remove(tempPath)
+		return false, fmt.Errorf("failed to replace file: %w", err)
+	}
+	return true, nil
+}
+
+// HashFile returns the hex SHA-256 of the plain content of a cached file
+func (m *Manager) HashFile(cachePath string) (string, error) {
+	f, err := m.open(cachePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := m.buffers.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// BlobPath returns the path of the deduplicated copy with a content hash.
+// Blobs are spread over subdirectories named after the first two hex digits.
+func (m *Manager) BlobPath(hash string) string {
+	prefix := hash
+	if len(prefix) > 2 {
+		prefix = prefix[:2]
+	}
+	return filepath.Join(m.rootDir, blobDirName, prefix, hash)
+}
+
+// StoreBlob moves a cached file to the blob for hash. If that blob already
+// exists the file is deleted instead and true is returned.
+func (m *Manager) StoreBlob(cachePath, hash string) (bool, error) {
+	blobPath := m.BlobPath(hash)
+
+	if _, err := os.Stat(blobPath); err == nil {
+		if err := os.Remove(cachePath); err != nil && !os.IsNotExist(err) {
+			return true, fmt.Errorf("failed to delete duplicate: %w", err)
+		}
+		return true, nil
+	}
+
+	if err := m.EnsureDir(blobPath); err != nil {
+		return false, fmt.Errorf("failed to create blob dir: %w", err)
+	}
+	if err := replaceFile(cachePath, blobPath); err != nil {
+		return false, fmt.Errorf("failed to move file to blob: %w", err)
+	}
+	return false, nil
+}
+
+// LinkBlob hard-links a cached file to the blob for hash, or copies it on
+// filesystems without hard links. An existing blob is left as it is.
+func (m *Manager) LinkBlob(cachePath, hash string) (bool, error) {
+	blobPath := m.BlobPath(hash)
+	if _, err := os.Stat(blobPath); err == nil {
+		return true, nil
+	}
+
+	if err := m.EnsureDir(blobPath); err != nil {
+		return false, fmt.Errorf("failed to create blob dir: %w", err)
+	}
+	if err := os.Link(cachePath, blobPath); err == nil {
+		return false, nil
+	}
+	linkingPath := blobPath + ".linking"
+	if err := m.copyFile(cachePath, linkingPath); err != nil {
+		os.Remove(linkingPath)
+		return false, fmt.Errorf("failed to copy file to blob: %w", err)
+	}
+	if err := replaceFile(linkingPath, blobPath); err != nil {
+		os.Remove(linkingPath)
+		return false, fmt.Errorf("failed to copy file to blob: %w", err)
+	}
+	return false, nil
+}
+
+// ListBlobs returns the paths of all stored blobs
+func (m *Manager) ListBlobs() ([]string, error) {
+	var blobs []string
+	err := filepath.WalkDir(filepath.Join(m.rootDir, blobDirName), func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !d.IsDir() {
+			blobs = append(blobs, path)
+		}
+		return nil
+	})
+	return blobs, err
+}
+
+// SniffContentType detects the MIME type of a cached file from its first 512 bytes
+func (m *Manager) SniffContentType(cachePath string) (string, error) {
+	f, err := m.open(cachePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+	return http.DetectContentType(head[:n]), nil
+}
+
 // FileExists checks if a cached file exists
 func (m *Manager) FileExists(cachePath string) bool {
 	_, err := os.Stat(cachePath)
 	return err == nil
 }
 
-// GetFileSize returns the size of a cached file
+// GetFileSize returns the plain size of a cached file
 func (m *Manager) GetFileSize(cachePath string) (int64, error) {
-	info, err := os.Stat(cachePath)
-	if err != nil {
-		return 0, err
-	}
-	return info.Size(), nil
+	return m.plainSize(cachePath)
 }
 
 // GetTempFileInfo returns size and modification time of a temp file
@@ -160,6 +388,15 @@ func (m *Manager) GetTempFileInfo(tempPath string) (int64, time.Time, error) {
 	return info.Size(), info.ModTime(), nil
 }
 
+// wipeTempFile deletes the temp file of a failed download when copies are
+// encrypted, so no plain partial copy stays on disk; the download starts over
+// instead of resuming. Without encryption the file is kept for the resume.
+func (m *Manager) wipeTempFile(tempPath string) {
+	if m.keys != nil {
+		os.Remove(tempPath)
+	}
+}
+
 // DeleteTempFile removes a temporary file
 func (m *Manager) DeleteTempFile(tempPath string) error {
 	if err := os.Remove(tempPath); err != nil && !os.IsNotExist(err) {
@@ -168,13 +405,18 @@ func (m *Manager) DeleteTempFile(tempPath string) error {
 	return nil
 }
 
-// GetCacheSize returns total size of cached files
+// GetCacheSize returns total size of cached files. The trash has a budget of
+// its own and is not counted.
 func (m *Manager) GetCacheSize() (int64, error) {
+	trashDir := filepath.Join(m.rootDir, trashDirName)
 	var size int64
 	err := filepath.Walk(m.rootDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
+		if info.IsDir() && path == trashDir {
+			return filepath.SkipDir
+		}
 		if !info.IsDir() {
 			size += info.Size()
 		}
@@ -183,18 +425,29 @@ func (m *Manager) GetCacheSize() (int64, error) {
 	return size, err
 }
 
-// CleanOldTempFiles removes temp files older than the specified duration
+// CleanOldTempFiles removes temp files older than the specified duration,
+// under the root and in the temp dir
 func (m *Manager) CleanOldTempFiles(olderThan time.Duration) (int, error) {
-	count := 0
 	threshold := time.Now().Add(-olderThan)
 
-	err := filepath.Walk(m.rootDir, func(path string, info os.FileInfo, err error) error {
+	count, err := cleanTempFilesIn(m.rootDir, threshold)
+	if err != nil || m.tempDir == "" {
+		return count, err
+	}
+	n, err := cleanTempFilesIn(m.tempDir, threshold)
+	return count + n, err
+}
+
+// cleanTempFilesIn removes temp files under dir last modified before threshold
+func cleanTempFilesIn(dir string, threshold time.Time) (int, error) {
+	count := 0
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 		if !info.IsDir() {
 			ext := filepath.Ext(path)
-			if ext == ".downloading" {
+			if ext == ".downloading" || ext == ".compressing" || ext == ".moving" || ext == ".encrypting" {
 				if info.ModTime().Before(threshold) {
 					if removeErr := os.Remove(path); removeErr == nil {
 						count++
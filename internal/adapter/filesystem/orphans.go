@@ -0,0 +1,116 @@
+package filesystem
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// quarantineDirName is the directory under the root holding orphaned copies
+const quarantineDirName = ".orphans"
+
+// WalkCacheFiles calls fn for every file under the root that may be a cached
+// copy. Hidden directories directly under the root (blobs, previews, streams,
+// chunks, backups, quarantine), files directly in the root such as the
+// database, and temp files are skipped.
+func (m *Manager) WalkCacheFiles(fn func(cachePath string, size int64, modTime time.Time) error) error {
+	root := filepath.Clean(m.rootDir)
+	tempDir := ""
+	if m.tempDir != "" {
+		tempDir = filepath.Clean(m.tempDir)
+	}
+
+	return filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil // Removed while walking
+			}
+			return err
+		}
+		if path == root {
+			return nil
+		}
+
+		topLevel := filepath.Dir(path) == root
+		if d.IsDir() {
+			if topLevel && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			if path == tempDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if topLevel || !d.Type().IsRegular() {
+			return nil
+		}
+		switch filepath.Ext(path) {
+		case ".downloading", ".compressing", ".moving", ".encrypting":
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		return fn(path, info.Size(), info.ModTime())
+	})
+}
+
+// QuarantineFile moves a cached copy below the quarantine directory, keeping
+// its path relative to the root. Its modification time is reset so
+// CleanOldQuarantine counts its age from the move.
+func (m *Manager) QuarantineFile(cachePath string) error {
+	rel, err := filepath.Rel(m.rootDir, cachePath)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return fmt.Errorf("%s is not under the cache root", cachePath)
+	}
+
+	target := filepath.Join(m.rootDir, quarantineDirName, rel)
+	if err := m.EnsureDir(target); err != nil {
+		return fmt.Errorf("failed to create quarantine dir: %w", err)
+	}
+	if err := replaceFile(cachePath, target); err != nil {
+		return fmt.Errorf("failed to quarantine file: %w", err)
+	}
+
+	now := time.Now()
+	os.Chtimes(target, now, now)
+	return nil
+}
+
+// CleanOldQuarantine deletes quarantined files moved there longer than
+// olderThan ago. Returns the number of files deleted.
+func (m *Manager) CleanOldQuarantine(olderThan time.Duration) (int, error) {
+	dir := filepath.Join(m.rootDir, quarantineDirName)
+	threshold := time.Now().Add(-olderThan)
+
+	count := 0
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if info.ModTime().Before(threshold) {
+			if os.Remove(path) == nil {
+				count++
+			}
+		}
+		return nil
+	})
+	return count, err
+}
@@ -0,0 +1,21 @@
+//go:build !windows
+// +build !windows
+
+package filesystem
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// replaceFile atomically moves src over dst
+func replaceFile(src, dst string) error {
+	return os.Rename(src, dst)
+}
+
+// isCrossDevice reports whether a rename failed because src and dst are on
+// different filesystems
+func isCrossDevice(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
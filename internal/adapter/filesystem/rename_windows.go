@@ -0,0 +1,55 @@
+//go:build windows
+// +build windows
+
+package filesystem
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"time"
+)
+
+// Windows error codes returned while another handle still has the file open
+const (
+	errorAccessDenied     syscall.Errno = 5
+	errorSharingViolation syscall.Errno = 32
+	errorLockViolation    syscall.Errno = 33
+	errorNotSameDevice    syscall.Errno = 17
+)
+
+// replaceRetries and replaceRetryDelay bound how long replaceFile waits for
+// readers of dst (file handler, previews, antivirus scanners) to close it
+const (
+	replaceRetries    = 10
+	replaceRetryDelay = 100 * time.Millisecond
+)
+
+// replaceFile moves src over dst. os.Rename uses MoveFileEx with
+// MOVEFILE_REPLACE_EXISTING, which fails on NTFS while any handle to dst is
+// open without FILE_SHARE_DELETE, so sharing violations are retried briefly.
+func replaceFile(src, dst string) error {
+	var err error
+	for attempt := 0; attempt < replaceRetries; attempt++ {
+		if err = os.Rename(src, dst); err == nil || !isSharingViolation(err) {
+			return err
+		}
+		time.Sleep(replaceRetryDelay * time.Duration(attempt+1))
+	}
+	return err
+}
+
+// isSharingViolation reports whether err means the file is in use
+func isSharingViolation(err error) bool {
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return false
+	}
+	return errno == errorAccessDenied || errno == errorSharingViolation || errno == errorLockViolation
+}
+
+// isCrossDevice reports whether a rename failed because src and dst are on
+// different volumes
+func isCrossDevice(err error) bool {
+	return errors.Is(err, errorNotSameDevice)
+}
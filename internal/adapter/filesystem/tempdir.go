@@ -0,0 +1,99 @@
+package filesystem
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// SetTempDir writes in-progress downloads to dir instead of next to the cached
+// file, e.g. on a scratch disk. A probe file is renamed into the root to check
+// that both are on the same filesystem; if not, completed downloads are copied
+// next to the cached file and renamed from there, so the final step stays
+// atomic at the cost of one extra write. Returns whether renames are atomic.
+func (m *Manager) SetTempDir(dir string) (bool, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return false, fmt.Errorf("failed to create temp dir: %w", err)
+	}
+
+	probe, err := os.CreateTemp(dir, ".probe-*")
+	if err != nil {
+		return false, fmt.Errorf("temp dir is not writable: %w", err)
+	}
+	probe.Close()
+	defer os.Remove(probe.Name())
+
+	target := filepath.Join(m.rootDir, filepath.Base(probe.Name()))
+	sameFS := true
+	if err := os.Rename(probe.Name(), target); err != nil {
+		if !isCrossDevice(err) {
+			return false, fmt.Errorf("failed to rename from temp dir into cache root: %w", err)
+		}
+		sameFS = false
+	}
+	os.Remove(target)
+
+	m.tempDir = dir
+	m.crossDevice = !sameFS
+	return sameFS, nil
+}
+
+// TempPath returns where an in-progress download of a Synology file is written
+func (m *Manager) TempPath(synoPath string) string {
+	if m.tempDir == "" {
+		return m.CachePath(synoPath) + ".downloading"
+	}
+	sum := sha256.Sum256([]byte(synoPath))
+	return filepath.Join(m.tempDir, hex.EncodeToString(sum[:16])+".downloading")
+}
+
+// moveIntoCache moves a completed download to its cache path. A rename across
+// filesystems falls back to copying next to cachePath and renaming from there.
+// With encryption enabled the download is encrypted next to cachePath instead.
+func (m *Manager) moveIntoCache(tempPath, cachePath string) error {
+	if m.keys != nil {
+		return m.encryptIntoCache(tempPath, cachePath)
+	}
+	if !m.crossDevice {
+		err := replaceFile(tempPath, cachePath)
+		if err == nil || !isCrossDevice(err) {
+			return err
+		}
+	}
+
+	movingPath := cachePath + ".moving"
+	if err := m.copyFile(tempPath, movingPath); err != nil {
+		os.Remove(movingPath)
+		return err
+	}
+	if err := replaceFile(movingPath, cachePath); err != nil {
+		os.Remove(movingPath)
+		return err
+	}
+	return os.Remove(tempPath)
+}
+
+// copyFile copies src to a new file dst and flushes it to disk
+func (m *Manager) copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := m.buffers.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
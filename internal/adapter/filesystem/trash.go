@@ -0,0 +1,286 @@
+package filesystem
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// trashDirName is the directory under the root holding trashed copies
+const trashDirName = ".trash"
+
+// trashBucket is the span of time whose trashed copies share a directory
+const trashBucket = time.Minute
+
+// trash keeps removed copies for a while so they can be restored instead of
+// downloaded again. Copies are moved to .trash/<unix time>/<path relative to
+// the root>, keeping their modification time; the directory name records when
+// they were trashed.
+type trash struct {
+	dir      string
+	maxBytes int64
+	maxAge   time.Duration
+
+	// mu guards size and serialises moving copies in and out
+	mu   sync.Mutex
+	size int64
+}
+
+// EnableTrash moves copies passed to TrashFile to the trash directory instead
+// of deleting them. The trash is kept within maxBytes by purging the oldest
+// copies first, and CleanTrash deletes copies older than maxAge.
+func (m *Manager) EnableTrash(maxBytes int64, maxAge time.Duration) error {
+	dir := filepath.Join(m.rootDir, trashDirName)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create trash dir: %w", err)
+	}
+
+	_, size, err := dirUsage(dir)
+	if err != nil {
+		return fmt.Errorf("failed to measure trash: %w", err)
+	}
+
+	m.trash = &trash{
+		dir:      dir,
+		maxBytes: maxBytes,
+		maxAge:   maxAge,
+		size:     size,
+	}
+	return nil
+}
+
+// TrashFile moves a cached copy to the trash, purging older copies to stay
+// within the size budget. The copy is deleted instead if the trash is
+// disabled or the copy alone exceeds the budget.
+func (m *Manager) TrashFile(cachePath string) error {
+	t := m.trash
+	if t == nil {
+		return m.DeleteFile(cachePath)
+	}
+
+	rel, err := filepath.Rel(m.rootDir, cachePath)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return fmt.Errorf("%s is not under the cache root", cachePath)
+	}
+
+	info, err := os.Stat(cachePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to stat file: %w", err)
+	}
+	if info.Size() > t.maxBytes {
+		return m.DeleteFile(cachePath)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.purge(t.maxBytes - info.Size()); err != nil {
+		return err
+	}
+
+	bucket := strconv.FormatInt(time.Now().Truncate(trashBucket).Unix(), 10)
+	target := filepath.Join(t.dir, bucket, rel)
+	if err := m.EnsureDir(target); err != nil {
+		return fmt.Errorf("failed to create trash dir: %w", err)
+	}
+	if err := replaceFile(cachePath, target); err != nil {
+		return fmt.Errorf("failed to trash file: %w", err)
+	}
+	t.size += info.Size()
+	return nil
+}
+
+// RestoreTrashed moves the most recently trashed copy of a Synology file back
+// to its cache path. The copy is only restored if it has the given size and
+// was written no earlier than modifiedAt, i.e. the file has not changed on
+// the NAS since. Returns the cache path and whether a copy was restored.
+func (m *Manager) RestoreTrashed(synoPath string, size int64, modifiedAt time.Time) (string, bool, error) {
+	t := m.trash
+	if t == nil {
+		return "", false, nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	buckets, err := t.buckets()
+	if err != nil {
+		return "", false, err
+	}
+
+	for i := len(buckets) - 1; i >= 0; i-- {
+		trashed := filepath.Join(buckets[i].path, filepath.FromSlash(synoPath))
+		info, err := os.Stat(trashed)
+		if err != nil {
+			continue
+		}
+		if !info.Mode().IsRegular() || info.ModTime().Before(modifiedAt) {
+			// Older copies are stale too
+			return "", false, nil
+		}
+		if plainSize, err := m.plainSize(trashed); err != nil || plainSize != size {
+			return "", false, nil
+		}
+
+		cachePath := m.CachePath(synoPath)
+		if err := m.EnsureDir(cachePath); err != nil {
+			return "", false, fmt.Errorf("failed to create cache dir: %w", err)
+		}
+		if err := replaceFile(trashed, cachePath); err != nil {
+			return "", false, fmt.Errorf("failed to restore trashed file: %w", err)
+		}
+		t.size -= info.Size()
+		return cachePath, true, nil
+	}
+	return "", false, nil
+}
+
+// CleanTrash deletes trashed copies older than the maximum age and the oldest
+// copies beyond the size budget. Returns the number of files deleted.
+func (m *Manager) CleanTrash() (int, error) {
+	t := m.trash
+	if t == nil {
+		return 0, nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	buckets, err := t.buckets()
+	if err != nil {
+		return 0, err
+	}
+
+	threshold := time.Now().Add(-t.maxAge)
+	count := 0
+	for _, b := range buckets {
+		if t.size <= t.maxBytes && !b.trashedAt.Before(threshold) {
+			break
+		}
+		n, err := t.remove(b)
+		count += n
+		if err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+// EmptyTrash deletes all trashed copies. Returns the number of bytes freed.
+func (m *Manager) EmptyTrash() (int64, error) {
+	t := m.trash
+	if t == nil {
+		return 0, nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	before := t.size
+	if err := t.purge(0); err != nil {
+		return before - t.size, err
+	}
+	return before - t.size, nil
+}
+
+// trashBucketDir is a directory of copies trashed within the same minute
+type trashBucketDir struct {
+	path      string
+	trashedAt time.Time
+}
+
+// buckets returns the bucket directories of the trash, oldest first
+func (t *trash) buckets() ([]trashBucketDir, error) {
+	entries, err := os.ReadDir(t.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	buckets := make([]trashBucketDir, 0, len(entries))
+	for _, entry := range entries {
+		unix, err := strconv.ParseInt(entry.Name(), 10, 64)
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+		buckets = append(buckets, trashBucketDir{
+			path:      filepath.Join(t.dir, entry.Name()),
+			trashedAt: time.Unix(unix, 0),
+		})
+	}
+	sort.Slice(buckets, func(i, j int) bool {
+		return buckets[i].trashedAt.Before(buckets[j].trashedAt)
+	})
+	return buckets, nil
+}
+
+// purge removes the oldest buckets until the trash holds at most keepBytes.
+// The caller holds mu.
+func (t *trash) purge(keepBytes int64) error {
+	if t.size <= keepBytes {
+		return nil
+	}
+
+	buckets, err := t.buckets()
+	if err != nil {
+		return err
+	}
+	for _, b := range buckets {
+		if t.size <= keepBytes {
+			break
+		}
+		if _, err := t.remove(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// remove deletes a bucket and returns the number of files it held.
+// The caller holds mu.
+func (t *trash) remove(b trashBucketDir) (int, error) {
+	files, size, err := dirUsage(b.path)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.RemoveAll(b.path); err != nil {
+		return 0, fmt.Errorf("failed to purge trash: %w", err)
+	}
+	t.size = max(t.size-size, 0)
+	return files, nil
+}
+
+// dirUsage returns the number and total size of the files under dir
+func dirUsage(dir string) (int, int64, error) {
+	var files int
+	var size int64
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		files++
+		size += info.Size()
+		return nil
+	})
+	return files, size, err
+}
@@ -0,0 +1,105 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+)
+
+// RecordAuditEvent appends an event to the audit log
+func (s *Store) RecordAuditEvent(event *domain.AuditEvent) error {
+	var details sql.NullString
+	if len(event.Details) > 0 {
+		encoded, err := json.Marshal(event.Details)
+		if err != nil {
+			return err
+		}
+		details = sql.NullString{String: string(encoded), Valid: true}
+	}
+
+	return s.db.QueryRow(`
+		INSERT INTO audit_events (actor, action, target, remote_addr, details)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
+	`, event.Actor, event.Action, event.Target, event.RemoteAddr, details).Scan(&event.ID)
+}
+
+// ListAuditEvents returns events matching the filter, newest first
+func (s *Store) ListAuditEvents(filter domain.AuditFilter, limit, offset int) ([]*domain.AuditEvent, error) {
+	query := `
+		SELECT id, created_at, actor, action, target, remote_addr, details
+		FROM audit_events
+		WHERE 1=1
+	`
+	var args []interface{}
+
+	// arg appends a query argument and returns its placeholder
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if filter.Actor != "" {
+		query += " AND actor = " + arg(filter.Actor)
+	}
+	if filter.Action != "" {
+		if strings.HasSuffix(filter.Action, ".") {
+			query += " AND left(action, " + arg(len(filter.Action)) + ") = " + arg(filter.Action)
+		} else {
+			query += " AND action = " + arg(filter.Action)
+		}
+	}
+	if filter.Target != "" {
+		query += " AND target = " + arg(filter.Target)
+	}
+	if filter.Since != nil {
+		query += " AND created_at >= " + arg(*filter.Since)
+	}
+	if filter.Until != nil {
+		query += " AND created_at < " + arg(*filter.Until)
+	}
+
+	query += " ORDER BY id DESC LIMIT " + arg(limit) + " OFFSET " + arg(offset)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*domain.AuditEvent
+	for rows.Next() {
+		event := &domain.AuditEvent{}
+		var target, remoteAddr, details sql.NullString
+
+		if err := rows.Scan(
+			&event.ID, &event.CreatedAt, &event.Actor, &event.Action,
+			&target, &remoteAddr, &details,
+		); err != nil {
+			return nil, err
+		}
+
+		event.Target = target.String
+		event.RemoteAddr = remoteAddr.String
+		if details.Valid && details.String != "" {
+			if err := json.Unmarshal([]byte(details.String), &event.Details); err != nil {
+				return nil, err
+			}
+		}
+
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+// DeleteAuditEventsBefore removes events older than the given age
+func (s *Store) DeleteAuditEventsBefore(maxAge time.Duration) (int, error) {
+	return s.execCount(
+		"DELETE FROM audit_events WHERE created_at < $1",
+		time.Now().Add(-maxAge))
+}
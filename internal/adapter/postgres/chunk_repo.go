@@ -0,0 +1,89 @@
+package postgres
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+)
+
+const chunkColumns = `file_id, chunk_index, size, version, accessed_at, created_at`
+
+// GetChunks returns the cached chunks of a file ordered by index
+func (s *Store) GetChunks(fileID int64) ([]*domain.FileChunk, error) {
+	rows, err := s.db.Query(`SELECT `+chunkColumns+` FROM file_chunks WHERE file_id = $1 ORDER BY chunk_index`, fileID)
+	if err != nil {
+		return nil, err
+	}
+	return scanChunks(rows)
+}
+
+// AddChunk records a cached chunk, replacing an existing record of the same index
+func (s *Store) AddChunk(chunk *domain.FileChunk) error {
+	now := time.Now()
+	_, err := s.db.Exec(`
+		INSERT INTO file_chunks (`+chunkColumns+`) VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (file_id, chunk_index) DO UPDATE SET
+			size = excluded.size,
+			version = excluded.version,
+			accessed_at = excluded.accessed_at,
+			created_at = excluded.created_at
+	`, chunk.FileID, chunk.Index, chunk.Size, chunk.Version, now, now)
+	if err != nil {
+		return err
+	}
+
+	chunk.AccessedAt = now
+	chunk.CreatedAt = now
+	return nil
+}
+
+// TouchChunk records that a chunk was just read
+func (s *Store) TouchChunk(fileID, index int64) error {
+	_, err := s.db.Exec(`UPDATE file_chunks SET accessed_at = $1 WHERE file_id = $2 AND chunk_index = $3`,
+		time.Now(), fileID, index)
+	return err
+}
+
+// DeleteChunk removes the record of a single chunk
+func (s *Store) DeleteChunk(fileID, index int64) error {
+	_, err := s.db.Exec(`DELETE FROM file_chunks WHERE file_id = $1 AND chunk_index = $2`, fileID, index)
+	return err
+}
+
+// DeleteChunks removes the records of all chunks of a file
+func (s *Store) DeleteChunks(fileID int64) error {
+	_, err := s.db.Exec(`DELETE FROM file_chunks WHERE file_id = $1`, fileID)
+	return err
+}
+
+// GetChunkUsage returns the total size of all cached chunks
+func (s *Store) GetChunkUsage() (int64, error) {
+	var total int64
+	err := s.db.QueryRow(`SELECT COALESCE(SUM(size), 0) FROM file_chunks`).Scan(&total)
+	return total, err
+}
+
+// GetLeastRecentChunks returns up to limit chunks, least recently read first
+func (s *Store) GetLeastRecentChunks(limit int) ([]*domain.FileChunk, error) {
+	rows, err := s.db.Query(`SELECT `+chunkColumns+` FROM file_chunks ORDER BY accessed_at LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanChunks(rows)
+}
+
+// scanChunks reads all rows of a chunk query and closes them
+func scanChunks(rows *sql.Rows) ([]*domain.FileChunk, error) {
+	defer rows.Close()
+
+	var chunks []*domain.FileChunk
+	for rows.Next() {
+		c := &domain.FileChunk{}
+		if err := rows.Scan(&c.FileID, &c.Index, &c.Size, &c.Version, &c.AccessedAt, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, c)
+	}
+	return chunks, rows.Err()
+}
@@ -0,0 +1,483 @@
+package postgres
+
+import (
+	"cmp"
+	"database/sql"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+)
+
+const taskColumns = `id, file_id, syno_path, priority, size, status, worker_id,
+	temp_file_path, bytes_downloaded, retry_count, max_retries,
+	next_retry_at, last_error, created_at, claimed_at, updated_at`
+
+// scanTask scans a download_tasks row selected with taskColumns
+func scanTask(row interface{ Scan(...interface{}) error }) (*domain.DownloadTask, error) {
+	task := &domain.DownloadTask{}
+	var workerID, tempPath, lastError sql.NullString
+	var nextRetryAt, claimedAt sql.NullTime
+
+	err := row.Scan(
+		&task.ID, &task.FileID, &task.SynoPath, &task.Priority, &task.Size,
+		&task.Status, &workerID, &tempPath, &task.BytesDownloaded,
+		&task.RetryCount, &task.MaxRetries, &nextRetryAt, &lastError,
+		&task.CreatedAt, &claimedAt, &task.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	task.WorkerID = workerID.String
+	task.TempFilePath = tempPath.String
+	task.LastError = lastError.String
+	if nextRetryAt.Valid {
+		task.NextRetryAt = &nextRetryAt.Time
+	}
+	if claimedAt.Valid {
+		task.ClaimedAt = &claimedAt.Time
+	}
+
+	return task, nil
+}
+
+// queryTasks runs a query selecting taskColumns and scans all rows
+func (s *Store) queryTasks(query string, args ...interface{}) ([]*domain.DownloadTask, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tasks []*domain.DownloadTask
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, rows.Err()
+}
+
+// CreateTask creates a new download task
+func (s *Store) CreateTask(task *domain.DownloadTask) error {
+	err := s.db.QueryRow(`
+		INSERT INTO download_tasks (
+			file_id, syno_path, priority, size, status, max_retries
+		) VALUES ($1, $2, $3, $4, 'pending', $5)
+		RETURNING id
+	`, task.FileID, task.SynoPath, task.Priority, task.Size, task.MaxRetries).Scan(&task.ID)
+	if err != nil {
+		if isUniqueConstraintError(err) {
+			return domain.ErrAlreadyExists
+		}
+		return err
+	}
+
+	task.Status = domain.TaskStatusPending
+	s.queued.Notify()
+	return nil
+}
+
+// TasksQueued returns a channel closed when tasks may have become claimable
+func (s *Store) TasksQueued() <-chan struct{} {
+	return s.queued.C()
+}
+
+// ClaimNextTask atomically claims the next pending task for a worker.
+// SKIP LOCKED lets workers of several instances claim concurrently without
+// blocking on, or double-claiming, the same row.
+func (s *Store) ClaimNextTask(workerID string) (*domain.DownloadTask, error) {
+	return s.ClaimNextTaskUpTo(workerID, math.MaxInt32)
+}
+
+// ClaimNextTaskUpTo claims the next pending task with priority <= maxPriority
+func (s *Store) ClaimNextTaskUpTo(workerID string, maxPriority int) (*domain.DownloadTask, error) {
+	task, err := scanTask(s.db.QueryRow(`
+		UPDATE download_tasks
+		SET status = 'in_progress',
+			worker_id = $1,
+			claimed_at = NOW(),
+			updated_at = NOW()
+		WHERE id = (
+			SELECT id FROM download_tasks
+			WHERE status = 'pending'
+			  AND priority <= $2
+			  AND (next_retry_at IS NULL OR next_retry_at <= NOW())
+			ORDER BY priority ASC, size ASC
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+taskColumns, workerID, maxPriority))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return task, err
+}
+
+// ClaimNextTasks claims up to n pending tasks in queue order in one statement
+func (s *Store) ClaimNextTasks(workerID string, n int, maxTotalBytes int64) ([]*domain.DownloadTask, error) {
+	return s.ClaimNextTasksUpTo(workerID, n, maxTotalBytes, math.MaxInt32)
+}
+
+// ClaimNextTasksUpTo claims up to n pending tasks with priority <= maxPriority,
+// stopping before the task that would bring their total size over maxTotalBytes
+func (s *Store) ClaimNextTasksUpTo(workerID string, n int, maxTotalBytes int64, maxPriority int) ([]*domain.DownloadTask, error) {
+	if n < 1 {
+		n = 1
+	}
+	if maxTotalBytes <= 0 {
+		maxTotalBytes = math.MaxInt64
+	}
+	tasks, err := s.queryTasks(`
+		WITH candidates AS (
+			SELECT id,
+				ROW_NUMBER() OVER w AS position,
+				SUM(size) OVER w AS total
+			FROM (
+				SELECT id, priority, size FROM download_tasks
+				WHERE status = 'pending'
+				  AND priority <= $2
+				  AND (next_retry_at IS NULL OR next_retry_at <= NOW())
+				ORDER BY priority ASC, size ASC
+				LIMIT $3
+				FOR UPDATE SKIP LOCKED
+			) locked
+			WINDOW w AS (ORDER BY priority ASC, size ASC, id ASC ROWS UNBOUNDED PRECEDING)
+		)
+		UPDATE download_tasks
+		SET status = 'in_progress',
+			worker_id = $1,
+			claimed_at = NOW(),
+			updated_at = NOW()
+		WHERE id IN (SELECT id FROM candidates WHERE position = 1 OR total <= $4)
+		RETURNING `+taskColumns, workerID, maxPriority, n, maxTotalBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	// RETURNING does not keep the queue order
+	slices.SortFunc(tasks, func(a, b *domain.DownloadTask) int {
+		return cmp.Or(cmp.Compare(a.Priority, b.Priority), cmp.Compare(a.Size, b.Size), cmp.Compare(a.ID, b.ID))
+	})
+	return tasks, nil
+}
+
+// GetTask retrieves a task by ID
+func (s *Store) GetTask(id int64) (*domain.DownloadTask, error) {
+	task, err := scanTask(s.db.QueryRow(`SELECT `+taskColumns+` FROM download_tasks WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return task, err
+}
+
+// GetTaskByFileID retrieves an active task for a file
+func (s *Store) GetTaskByFileID(fileID int64) (*domain.DownloadTask, error) {
+	task, err := scanTask(s.db.QueryRow(`
+		SELECT `+taskColumns+` FROM download_tasks
+		WHERE file_id = $1 AND status IN ('pending', 'in_progress')
+	`, fileID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return task, err
+}
+
+// HasActiveTask checks if a file has an active task
+func (s *Store) HasActiveTask(fileID int64) (bool, error) {
+	var exists bool
+	err := s.db.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM download_tasks
+			WHERE file_id = $1 AND status IN ('pending', 'in_progress')
+		)
+	`, fileID).Scan(&exists)
+	return exists, err
+}
+
+// UpdateTask updates a task's state
+func (s *Store) UpdateTask(task *domain.DownloadTask) error {
+	var nextRetryAt, claimedAt sql.NullTime
+	if task.NextRetryAt != nil {
+		nextRetryAt = sql.NullTime{Time: *task.NextRetryAt, Valid: true}
+	}
+	if task.ClaimedAt != nil {
+		claimedAt = sql.NullTime{Time: *task.ClaimedAt, Valid: true}
+	}
+
+	_, err := s.db.Exec(`
+		UPDATE download_tasks
+		SET status = $1, worker_id = $2, temp_file_path = $3, bytes_downloaded = $4,
+			retry_count = $5, next_retry_at = $6, last_error = $7,
+			claimed_at = $8, updated_at = NOW()
+		WHERE id = $9
+	`,
+		task.Status, nullString(task.WorkerID), nullString(task.TempFilePath), task.BytesDownloaded,
+		task.RetryCount, nextRetryAt, nullString(task.LastError), claimedAt, task.ID)
+	return err
+}
+
+// UpdateProgress updates download progress
+func (s *Store) UpdateProgress(taskID int64, bytesDownloaded int64, tempPath string) error {
+	_, err := s.db.Exec(`
+		UPDATE download_tasks
+		SET bytes_downloaded = $1, temp_file_path = $2, updated_at = NOW()
+		WHERE id = $3
+	`, bytesDownloaded, tempPath, taskID)
+	return err
+}
+
+// CompleteTask removes a completed task
+func (s *Store) CompleteTask(taskID int64) error {
+	_, err := s.db.Exec("DELETE FROM download_tasks WHERE id = $1", taskID)
+	return err
+}
+
+// FailTask marks a task as failed and schedules retry if possible
+func (s *Store) FailTask(taskID int64, errMsg string, canRetry bool) error {
+	if canRetry {
+		// Exponential backoff by retry count: 1m, 5m, then 30m
+		_, err := s.db.Exec(`
+			UPDATE download_tasks
+			SET status = 'pending', worker_id = NULL, claimed_at = NULL,
+				next_retry_at = NOW() + CASE
+					WHEN retry_count = 0 THEN INTERVAL '1 minute'
+					WHEN retry_count = 1 THEN INTERVAL '5 minutes'
+					ELSE INTERVAL '30 minutes'
+				END,
+				retry_count = retry_count + 1, last_error = $1,
+				updated_at = NOW()
+			WHERE id = $2
+		`, errMsg, taskID)
+		return err
+	}
+
+	// Max retries exceeded, mark as failed
+	_, err := s.db.Exec(`
+		UPDATE download_tasks
+		SET status = 'failed', worker_id = NULL, claimed_at = NULL,
+			retry_count = retry_count + 1, last_error = $1,
+			updated_at = NOW()
+		WHERE id = $2
+	`, errMsg, taskID)
+	return err
+}
+
+// ReleaseTask returns an in-progress task to pending without counting a retry
+func (s *Store) ReleaseTask(taskID int64) error {
+	_, err := s.db.Exec(`
+		UPDATE download_tasks
+		SET status = 'pending', worker_id = NULL, claimed_at = NULL,
+			updated_at = NOW()
+		WHERE id = $1 AND status = 'in_progress'
+	`, taskID)
+	if err != nil {
+		return err
+	}
+	s.queued.Notify()
+	return nil
+}
+
+// ReleaseStaleInProgressTasks resets tasks stuck in in_progress state
+func (s *Store) ReleaseStaleInProgressTasks(staleDuration time.Duration) (int, error) {
+	count, err := s.execCount(`
+		UPDATE download_tasks
+		SET status = 'pending', worker_id = NULL, claimed_at = NULL,
+			updated_at = NOW()
+		WHERE status = 'in_progress' AND claimed_at < $1
+	`, time.Now().Add(-staleDuration))
+	if count > 0 {
+		s.queued.Notify()
+	}
+	return count, err
+}
+
+// RenewTaskLease refreshes claimed_at of an in-progress task held by workerID
+func (s *Store) RenewTaskLease(taskID int64, workerID string) (bool, error) {
+	count, err := s.execCount(`
+		UPDATE download_tasks
+		SET claimed_at = NOW()
+		WHERE id = $1 AND worker_id = $2 AND status = 'in_progress'
+	`, taskID, workerID)
+	return count > 0, err
+}
+
+// ReleaseWorkerTasks resets in_progress tasks whose worker_id starts with prefix
+func (s *Store) ReleaseWorkerTasks(workerPrefix string) (int, error) {
+	return s.execCount(`
+		UPDATE download_tasks
+		SET status = 'pending', worker_id = NULL, claimed_at = NULL,
+			updated_at = NOW()
+		WHERE status = 'in_progress' AND left(worker_id, length($1::text)) = $1
+	`, workerPrefix)
+}
+
+// BoostAgedTasks raises the priority of pending tasks waiting longer than age.
+// Aging stops at the starred level so waiting never puts a task ahead of shared files.
+func (s *Store) BoostAgedTasks(age time.Duration) (int, error) {
+	return s.execCount(`
+		UPDATE download_tasks
+		SET priority = priority - 1, aged_at = NOW(),
+			updated_at = NOW()
+		WHERE status = 'pending' AND priority > 2
+		  AND COALESCE(aged_at, created_at) <= NOW() - $1::float8 * INTERVAL '1 second'
+	`, age.Seconds())
+}
+
+// BoostTaskPriority raises the priority of a file's pending task if it is less urgent
+func (s *Store) BoostTaskPriority(fileID int64, priority int) (bool, error) {
+	count, err := s.execCount(`
+		UPDATE download_tasks
+		SET priority = $1, updated_at = NOW()
+		WHERE file_id = $2 AND status = 'pending' AND priority > $1
+	`, priority, fileID)
+	// Outside download windows a boosted task may be claimable now
+	if count > 0 {
+		s.queued.Notify()
+	}
+	return count > 0, err
+}
+
+// GetQueueStats returns queue statistics
+func (s *Store) GetQueueStats() (*domain.QueueStats, error) {
+	stats := &domain.QueueStats{}
+
+	rows, err := s.db.Query(`
+		SELECT status, COUNT(*), COALESCE(SUM(size), 0)
+		FROM download_tasks
+		GROUP BY status
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var status string
+		var count int
+		var totalSize int64
+
+		if err := rows.Scan(&status, &count, &totalSize); err != nil {
+			return nil, err
+		}
+
+		switch status {
+		case domain.TaskStatusPending:
+			stats.PendingCount = count
+			stats.TotalBytesQueued += totalSize
+		case domain.TaskStatusInProgress:
+			stats.InProgressCount = count
+			stats.TotalBytesQueued += totalSize
+		case domain.TaskStatusFailed:
+			stats.FailedCount = count
+		}
+	}
+
+	return stats, rows.Err()
+}
+
+// CleanupOldFailedTasks removes failed tasks older than the specified duration
+func (s *Store) CleanupOldFailedTasks(olderThan time.Duration) (int, error) {
+	return s.execCount(
+		"DELETE FROM download_tasks WHERE status = 'failed' AND updated_at < $1",
+		time.Now().Add(-olderThan))
+}
+
+// GetOversizedTasks returns tasks whose file size exceeds maxSize
+func (s *Store) GetOversizedTasks(maxSize int64) ([]*domain.DownloadTask, error) {
+	return s.queryTasks(`
+		SELECT `+taskColumns+` FROM download_tasks
+		WHERE size > $1 AND status IN ('pending', 'in_progress')
+	`, maxSize)
+}
+
+// ListTasksByStatus returns tasks with the given status, most recently updated first
+func (s *Store) ListTasksByStatus(status string, limit, offset int) ([]*domain.DownloadTask, error) {
+	return s.queryTasks(`
+		SELECT `+taskColumns+` FROM download_tasks
+		WHERE status = $1
+		ORDER BY updated_at DESC, id DESC
+		LIMIT $2 OFFSET $3
+	`, status, limit, offset)
+}
+
+// RetryFailedTask resets a failed task to pending with a fresh retry budget
+func (s *Store) RetryFailedTask(taskID int64) error {
+	count, err := s.execCount(`
+		UPDATE download_tasks
+		SET status = 'pending', retry_count = 0, next_retry_at = NULL,
+			worker_id = NULL, claimed_at = NULL, updated_at = NOW()
+		WHERE id = $1 AND status = 'failed'
+		  AND NOT EXISTS (
+			SELECT 1 FROM download_tasks a
+			WHERE a.file_id = download_tasks.file_id
+			  AND a.status IN ('pending', 'in_progress')
+		  )
+	`, taskID)
+	if err != nil {
+		if isUniqueConstraintError(err) {
+			return domain.ErrAlreadyExists
+		}
+		return err
+	}
+	if count > 0 {
+		s.queued.Notify()
+		return nil
+	}
+
+	// Distinguish a missing task from one blocked by an active task
+	task, err := s.GetTask(taskID)
+	if err != nil {
+		return err
+	}
+	if task == nil || task.Status != domain.TaskStatusFailed {
+		return domain.ErrNotFound
+	}
+	return domain.ErrAlreadyExists
+}
+
+// RetryFailedTasks resets all failed tasks matching the filter to pending
+func (s *Store) RetryFailedTasks(filter domain.FailedTaskFilter) (int, error) {
+	count, err := s.execCount(`
+		UPDATE download_tasks
+		SET status = 'pending', retry_count = 0, next_retry_at = NULL,
+			worker_id = NULL, claimed_at = NULL, updated_at = NOW()
+		WHERE status = 'failed'
+		  AND ($1::text = '' OR strpos(COALESCE(last_error, ''), $1) > 0)
+		  AND ($2::text = '' OR left(syno_path, length($2)) = $2)
+		  AND id = (
+			SELECT MAX(f.id) FROM download_tasks f
+			WHERE f.file_id = download_tasks.file_id AND f.status = 'failed'
+		  )
+		  AND NOT EXISTS (
+			SELECT 1 FROM download_tasks a
+			WHERE a.file_id = download_tasks.file_id
+			  AND a.status IN ('pending', 'in_progress')
+		  )
+	`, filter.ErrorContains, filter.PathPrefix)
+	if count > 0 {
+		s.queued.Notify()
+	}
+	return count, err
+}
+
+// DeleteTask removes a task by ID
+func (s *Store) DeleteTask(taskID int64) error {
+	_, err := s.db.Exec("DELETE FROM download_tasks WHERE id = $1", taskID)
+	return err
+}
+
+// execCount runs a statement and returns the number of affected rows
+func (s *Store) execCount(query string, args ...interface{}) (int, error) {
+	result, err := s.db.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := result.RowsAffected()
+	return int(count), err
+}
@@ -0,0 +1,7 @@
+//go:build postgres
+
+package postgres
+
+// The pgx driver is only linked into builds tagged "postgres" so the default
+// binary keeps a single, SQLite-only dependency set.
+import _ "github.com/jackc/pgx/v5/stdlib"
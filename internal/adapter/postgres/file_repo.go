@@ -0,0 +1,501 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+)
+
+const fileColumns = `id, syno_file_id, path, size, modified_at, accessed_at,
+	starred, shared, last_sync_at, cached, cache_path, cache_encoding,
+	priority, owner, labels, content_type, export_format, cache_state, content_hash, last_access_in_cache_at, access_count, bytes_served, miss_count, missing_upstream_at, rejected_reason, stale, created_at, updated_at`
+
+// scanFile scans a files row selected with fileColumns
+func scanFile(row interface{ Scan(...interface{}) error }) (*domain.File, error) {
+	file := &domain.File{}
+	var cachePath sql.NullString
+	var labels string
+
+	err := row.Scan(
+		&file.ID, &file.SynoFileID, &file.Path, &file.Size, &file.ModifiedAt, &file.AccessedAt,
+		&file.Starred, &file.Shared, &file.LastSyncAt, &file.Cached, &cachePath, &file.CacheEncoding,
+		&file.Priority, &file.Owner, &labels, &file.ContentType, &file.ExportFormat, &file.CacheState, &file.ContentHash, &file.LastAccessInCacheAt, &file.AccessCount, &file.BytesServed, &file.MissCount, &file.MissingUpstreamAt, &file.RejectedReason, &file.Stale, &file.CreatedAt, &file.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	file.CachePath = cachePath.String
+	file.Labels = domain.DecodeLabels(labels)
+	return file, nil
+}
+
+// getFile returns the single file matching a WHERE clause, or nil
+func (s *Store) getFile(where string, arg interface{}) (*domain.File, error) {
+	file, err := scanFile(s.db.QueryRow(`SELECT `+fileColumns+` FROM files WHERE `+where, arg))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return file, err
+}
+
+// GetByID retrieves a file by its internal ID
+func (s *Store) GetByID(id int64) (*domain.File, error) {
+	return s.getFile("id = $1", id)
+}
+
+// GetBySynoID retrieves a file by its Synology file ID
+func (s *Store) GetBySynoID(synoID string) (*domain.File, error) {
+	return s.getFile("syno_file_id = $1", synoID)
+}
+
+// GetByPath retrieves a file by its path
+func (s *Store) GetByPath(path string) (*domain.File, error) {
+	return s.getFile("path = $1", path)
+}
+
+// nullString maps an empty string to NULL
+func nullString(v string) sql.NullString {
+	return sql.NullString{String: v, Valid: v != ""}
+}
+
+// Create creates a new file record
+func (s *Store) Create(file *domain.File) error {
+	query := `
+		INSERT INTO files (
+			syno_file_id, path, size, modified_at, accessed_at,
+			starred, shared, last_sync_at, cached, cache_path, cache_encoding,
+			priority, owner, labels, content_type, export_format, cache_state, content_hash, last_access_in_cache_at, missing_upstream_at, rejected_reason, stale
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22)
+		RETURNING id
+	`
+
+	return s.db.QueryRow(
+		query,
+		file.SynoFileID, file.Path, file.Size, file.ModifiedAt, file.AccessedAt,
+		file.Starred, file.Shared, file.LastSyncAt, file.Cached, nullString(file.CachePath), file.CacheEncoding,
+		file.Priority, file.Owner, domain.EncodeLabels(file.Labels), file.ContentType, file.ExportFormat, file.CacheState, file.ContentHash, file.LastAccessInCacheAt, file.MissingUpstreamAt, file.RejectedReason, file.Stale,
+	).Scan(&file.ID)
+}
+
+// Update updates an existing file record (including cache status)
+// Use UpdateMetadata for syncer to avoid overwriting cache status
+func (s *Store) Update(file *domain.File) error {
+	query := `
+		UPDATE files SET
+			path = $1, size = $2, modified_at = $3, accessed_at = $4,
+			starred = $5, shared = $6, last_sync_at = $7, cached = $8,
+			cache_path = $9, cache_encoding = $10, priority = $11, last_access_in_cache_at = $12,
+			content_type = $13, export_format = $14, cache_state = $15, content_hash = $16, missing_upstream_at = $17, rejected_reason = $18, stale = $19, updated_at = NOW()
+		WHERE id = $20
+	`
+
+	_, err := s.db.Exec(
+		query,
+		file.Path, file.Size, file.ModifiedAt, file.AccessedAt,
+		file.Starred, file.Shared, file.LastSyncAt, file.Cached,
+		nullString(file.CachePath), file.CacheEncoding, file.Priority, file.LastAccessInCacheAt,
+		file.ContentType, file.ExportFormat, file.CacheState, file.ContentHash, file.MissingUpstreamAt, file.RejectedReason, file.Stale, file.ID,
+	)
+	return err
+}
+
+// UpdateMetadata updates file metadata without touching cache status fields
+// This prevents race condition between syncer and cacher
+func (s *Store) UpdateMetadata(file *domain.File) error {
+	query := `
+		UPDATE files SET
+			path = $1, size = $2, modified_at = $3, accessed_at = $4,
+			starred = $5, shared = $6, last_sync_at = $7, priority = $8,
+			updated_at = NOW()
+		WHERE id = $9
+	`
+
+	_, err := s.db.Exec(
+		query,
+		file.Path, file.Size, file.ModifiedAt, file.AccessedAt,
+		file.Starred, file.Shared, file.LastSyncAt, file.Priority,
+		file.ID,
+	)
+	return err
+}
+
+// UpsertBySynoID atomically creates or updates a file keyed by syno_file_id.
+// cached/cache_path are preserved unless the upstream mtime moved forward;
+// then they are cleared, or kept and marked stale with stale-while-revalidate.
+func (s *Store) UpsertBySynoID(file *domain.File) (*domain.UpsertResult, error) {
+	result := &domain.UpsertResult{}
+
+	err := s.withTx(func(ctx context.Context, tx *sql.Tx) error {
+		// Lock the previous row to decide on invalidation
+		var prevModifiedAt *time.Time
+		var prevCached bool
+		var prevLabels string
+		var modified bool // A new version was uploaded, so a missing file may be back
+		err := tx.QueryRowContext(ctx,
+			"SELECT modified_at, cached, labels FROM files WHERE syno_file_id = $1 FOR UPDATE",
+			file.SynoFileID,
+		).Scan(&prevModifiedAt, &prevCached, &prevLabels)
+		switch {
+		case err == sql.ErrNoRows:
+			result.Created = true
+		case err != nil:
+			return err
+		default:
+			result.PreviousModifiedAt = prevModifiedAt
+			modified = prevModifiedAt != nil && file.ModifiedAt != nil && file.ModifiedAt.After(*prevModifiedAt)
+			result.Invalidated = prevCached && modified
+			result.Stale = result.Invalidated && s.staleWhileRevalidate
+		}
+
+		query := `
+			INSERT INTO files (
+				syno_file_id, path, size, modified_at, accessed_at,
+				starred, shared, last_sync_at, priority, owner, labels, content_type
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+			ON CONFLICT (syno_file_id) DO UPDATE SET
+				path = excluded.path,
+				size = excluded.size,
+				modified_at = COALESCE(excluded.modified_at, files.modified_at),
+				accessed_at = COALESCE(excluded.accessed_at, files.accessed_at),
+				starred = excluded.starred,
+				shared = excluded.shared,
+				last_sync_at = excluded.last_sync_at,
+				priority = LEAST(files.priority, excluded.priority),
+				owner = CASE WHEN excluded.owner <> '' THEN excluded.owner ELSE files.owner END,
+				labels = excluded.labels,
+				content_type = CASE WHEN $13 OR excluded.content_type <> '' THEN excluded.content_type ELSE files.content_type END,
+				cached = CASE WHEN $15 THEN FALSE ELSE files.cached END,
+				stale = CASE WHEN $16 THEN TRUE WHEN $15 THEN FALSE ELSE files.stale END,
+				cache_path = CASE WHEN $15 THEN NULL ELSE files.cache_path END,
+				cache_encoding = CASE WHEN $15 THEN '' ELSE files.cache_encoding END,
+				export_format = CASE WHEN $15 THEN '' ELSE files.export_format END,
+				content_hash = CASE WHEN $15 THEN '' ELSE files.content_hash END,
+				missing_upstream_at = CASE WHEN $14 THEN NULL ELSE files.missing_upstream_at END,
+				rejected_reason = CASE WHEN $14 THEN '' ELSE files.rejected_reason END,
+				updated_at = NOW()
+			RETURNING ` + fileColumns
+
+		stored, err := scanFile(tx.QueryRowContext(ctx, query,
+			file.SynoFileID, file.Path, file.Size, file.ModifiedAt, file.AccessedAt,
+			file.Starred, file.Shared, file.LastSyncAt, file.Priority,
+			file.Owner, domain.EncodeLabels(file.Labels), file.ContentType,
+			result.Invalidated, modified, result.Invalidated && !result.Stale, result.Stale,
+		))
+		if err != nil {
+			return err
+		}
+
+		if labels := domain.EncodeLabels(stored.Labels); result.Created || labels != prevLabels {
+			if err := updateFileLabels(ctx, tx, stored.ID, labels); err != nil {
+				return err
+			}
+		}
+
+		result.File = stored
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// InvalidateCache sets cached=false for a file (used when source file is modified)
+func (s *Store) InvalidateCache(fileID int64) error {
+	_, err := s.db.Exec(`
+		UPDATE files SET
+			cached = FALSE, cache_path = NULL, cache_encoding = '', export_format = '', content_hash = '', stale = FALSE,
+			updated_at = NOW()
+		WHERE id = $1
+	`, fileID)
+	return err
+}
+
+// MarkMissingUpstream records that a download found the file deleted on the NAS
+func (s *Store) MarkMissingUpstream(fileID int64) error {
+	_, err := s.db.Exec(`
+		UPDATE files SET missing_upstream_at = NOW(), updated_at = NOW()
+		WHERE id = $1
+	`, fileID)
+	return err
+}
+
+// RecordHit counts a share request served from the cache with the bytes sent
+// and updates the last access time
+func (s *Store) RecordHit(fileID, bytesServed int64) error {
+	_, err := s.db.Exec(`
+		UPDATE files SET
+			access_count = access_count + 1,
+			bytes_served = bytes_served + $1,
+			last_access_in_cache_at = NOW()
+		WHERE id = $2
+	`, bytesServed, fileID)
+	return err
+}
+
+// RecordMiss counts a share request made while the file was not cached
+func (s *Store) RecordMiss(fileID int64) error {
+	_, err := s.db.Exec("UPDATE files SET miss_count = miss_count + 1 WHERE id = $1", fileID)
+	return err
+}
+
+// BoostFilePriority raises the priority of a file to priority if it is less urgent
+func (s *Store) BoostFilePriority(fileID int64, priority int) (bool, error) {
+	count, err := s.execCount(`
+		UPDATE files SET priority = $1, updated_at = NOW()
+		WHERE id = $2 AND priority > $1
+	`, priority, fileID)
+	return count > 0, err
+}
+
+// ListMissingUpstream returns a page of files marked missing upstream and their total number
+func (s *Store) ListMissingUpstream(limit, offset int) ([]*domain.File, int, error) {
+	var total int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM files WHERE missing_upstream_at IS NOT NULL`).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.db.Query(`
+		SELECT `+fileColumns+`
+		FROM files
+		WHERE missing_upstream_at IS NOT NULL
+		ORDER BY missing_upstream_at DESC, id DESC
+		LIMIT $1 OFFSET $2
+	`, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var files []*domain.File
+	for rows.Next() {
+		file, err := scanFile(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		files = append(files, file)
+	}
+	return files, total, rows.Err()
+}
+
+// Delete deletes a file record by ID; shares and tasks are removed by cascade
+func (s *Store) Delete(id int64) error {
+	_, err := s.db.Exec("DELETE FROM files WHERE id = $1", id)
+	return err
+}
+
+// evictionOrder returns the ORDER BY terms of eviction candidates under a policy
+func evictionOrder(policy domain.EvictionPolicy) string {
+	if policy == domain.EvictionLFU {
+		return "priority DESC, access_count ASC, last_access_in_cache_at ASC NULLS FIRST"
+	}
+	return "priority DESC, last_access_in_cache_at ASC NULLS FIRST"
+}
+
+// evictable excludes files whose download is in progress, such as stale
+// copies still served while their new version is downloaded
+const evictable = `NOT EXISTS (
+			SELECT 1 FROM download_tasks t
+			WHERE t.file_id = files.id AND t.status = '` + domain.TaskStatusInProgress + `')`
+
+// GetEvictionCandidates returns cached files that can be evicted
+func (s *Store) GetEvictionCandidates(policy domain.EvictionPolicy, limit int) ([]*domain.File, error) {
+	return s.getEvictionCandidatesWhere(policy, "TRUE", nil, limit)
+}
+
+// GetEvictionCandidatesByOwner returns evictable cached files of one owner
+func (s *Store) GetEvictionCandidatesByOwner(policy domain.EvictionPolicy, owner string, limit int) ([]*domain.File, error) {
+	return s.getEvictionCandidatesWhere(policy, "owner = $3", owner, limit)
+}
+
+// GetEvictionCandidatesByLabel returns evictable cached files with a label
+func (s *Store) GetEvictionCandidatesByLabel(policy domain.EvictionPolicy, label string, limit int) ([]*domain.File, error) {
+	return s.getEvictionCandidatesWhere(policy, "strpos(',' || labels || ',', $3) > 0", ","+label+",", limit)
+}
+
+// ForEachEvictionCandidate streams evictable cached files in eviction order
+func (s *Store) ForEachEvictionCandidate(policy domain.EvictionPolicy, fn func(*domain.File) bool) error {
+	return s.forEachFile(`
+		SELECT `+fileColumns+`
+		FROM files
+		WHERE cached = TRUE AND priority <> $1 AND `+evictable+`
+		ORDER BY `+evictionOrder(policy)+`
+	`, []interface{}{domain.PriorityPinned}, fn)
+}
+
+// GetFilesByCacheState returns files left in an intermediate cache state
+func (s *Store) GetFilesByCacheState(state string) ([]*domain.File, error) {
+	rows, err := s.db.Query(`SELECT `+fileColumns+` FROM files WHERE cache_state = $1`, state)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []*domain.File
+	for rows.Next() {
+		file, err := scanFile(rows)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, rows.Err()
+}
+
+// CountCacheReferences returns the number of files using the copy at cachePath
+func (s *Store) CountCacheReferences(cachePath string) (int, error) {
+	var count int
+	err := s.db.QueryRow(`
+		SELECT COUNT(*) FROM files
+		WHERE cache_path = $1 AND (cached = TRUE OR cache_state = $2)
+	`, cachePath, domain.CacheStateCaching).Scan(&count)
+	return count, err
+}
+
+// ForEachFileToCache streams uncached files without a download task
+func (s *Store) ForEachFileToCache(fn func(*domain.File) bool) error {
+	return s.forEachFile(`
+		SELECT `+fileColumns+`
+		FROM files
+		WHERE cached = FALSE
+		  AND NOT EXISTS (SELECT 1 FROM download_tasks WHERE download_tasks.file_id = files.id)
+		ORDER BY priority ASC, size ASC
+	`, nil, fn)
+}
+
+// forEachFile runs a files query and calls fn for each row until fn returns false.
+// Rows are scanned one at a time, so only the current file is held in memory.
+func (s *Store) forEachFile(query string, args []interface{}, fn func(*domain.File) bool) error {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		file, err := scanFile(rows)
+		if err != nil {
+			return err
+		}
+		if !fn(file) {
+			return nil
+		}
+	}
+	return rows.Err()
+}
+
+// GetQuotaUsage sums the size of cached, non-pinned files per owner and label.
+// With includeQueued files with an active download task are counted too.
+func (s *Store) GetQuotaUsage(includeQueued bool) (*domain.QuotaUsage, error) {
+	rows, err := s.db.Query(`
+		SELECT owner, labels, COALESCE(SUM(size), 0)
+		FROM files
+		WHERE priority <> $1 AND (owner <> '' OR labels <> '')
+		  AND (cached = TRUE OR ($2 AND id IN (
+			SELECT file_id FROM download_tasks WHERE status IN ('pending', 'in_progress')
+		  )))
+		GROUP BY owner, labels
+	`, domain.PriorityPinned, includeQueued)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usage := domain.NewQuotaUsage()
+	for rows.Next() {
+		var owner, labels string
+		var size int64
+		if err := rows.Scan(&owner, &labels, &size); err != nil {
+			return nil, err
+		}
+		usage.Add(owner, domain.DecodeLabels(labels), size)
+	}
+	return usage, rows.Err()
+}
+
+// getEvictionCandidatesWhere returns eviction candidates matching an extra
+// condition, which refers to arg as $3 (arg is not passed when nil)
+func (s *Store) getEvictionCandidatesWhere(policy domain.EvictionPolicy, cond string, arg interface{}, limit int) ([]*domain.File, error) {
+	args := []interface{}{domain.PriorityPinned, limit}
+	if arg != nil {
+		args = append(args, arg)
+	}
+
+	rows, err := s.db.Query(`
+		SELECT `+fileColumns+`
+		FROM files
+		WHERE cached = TRUE AND priority <> $1 AND `+evictable+` AND `+cond+`
+		ORDER BY `+evictionOrder(policy)+`
+		LIMIT $2
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []*domain.File
+	for rows.Next() {
+		file, err := scanFile(rows)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, rows.Err()
+}
+
+// UnpinFiles resets pinned files outside keepPrefixes to the default priority
+func (s *Store) UnpinFiles(keepPrefixes []string) (int, error) {
+	unpinned := 0
+
+	err := s.withTx(func(ctx context.Context, tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx,
+			"SELECT id, path FROM files WHERE priority = $1 FOR UPDATE", domain.PriorityPinned)
+		if err != nil {
+			return err
+		}
+
+		var ids []int64
+		for rows.Next() {
+			var id int64
+			var path string
+			if err := rows.Scan(&id, &path); err != nil {
+				rows.Close()
+				return err
+			}
+			if !isUnderAny(path, keepPrefixes) {
+				ids = append(ids, id)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			if _, err := tx.ExecContext(ctx,
+				"UPDATE files SET priority = $1, updated_at = NOW() WHERE id = $2",
+				domain.PriorityDefault, id); err != nil {
+				return err
+			}
+		}
+		unpinned = len(ids)
+		return nil
+	})
+
+	return unpinned, err
+}
+
+// isUnderAny reports whether path lies below one of dirs
+func isUnderAny(path string, dirs []string) bool {
+	for _, dir := range dirs {
+		if domain.IsUnderPath(path, dir) {
+			return true
+		}
+	}
+	return false
+}
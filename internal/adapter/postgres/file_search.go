@@ -0,0 +1,139 @@
+package postgres
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+)
+
+// fileSortColumns maps search sort keys to files columns
+var fileSortColumns = map[string]string{
+	domain.FileSortPath:       "path",
+	domain.FileSortSize:       "size",
+	domain.FileSortModified:   "modified_at",
+	domain.FileSortPriority:   "priority",
+	domain.FileSortLastAccess: "last_access_in_cache_at",
+	domain.FileSortAccesses:   "access_count",
+	domain.FileSortServed:     "bytes_served",
+	domain.FileSortMisses:     "miss_count",
+}
+
+// SearchFiles returns a page of files matching the search and the total number of matches
+func (s *Store) SearchFiles(search domain.FileSearch, limit, offset int) ([]*domain.File, int, error) {
+	where, args := fileSearchWhere(search)
+
+	var total int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM files WHERE `+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	order, ok := fileSortColumns[search.Sort]
+	if !ok {
+		order = "path"
+	}
+	direction := "ASC NULLS FIRST"
+	if search.Desc {
+		direction = "DESC NULLS LAST"
+	}
+
+	rows, err := s.db.Query(fmt.Sprintf(`
+		SELECT `+fileColumns+`
+		FROM files
+		WHERE %s
+		ORDER BY %s %s, id
+		LIMIT $%d OFFSET $%d
+	`, where, order, direction, len(args)+1, len(args)+2), append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var files []*domain.File
+	for rows.Next() {
+		file, err := scanFile(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		files = append(files, file)
+	}
+	return files, total, rows.Err()
+}
+
+// fileSearchWhere builds the WHERE clause of a file search
+func fileSearchWhere(search domain.FileSearch) (string, []interface{}) {
+	conds := []string{"TRUE"}
+	var args []interface{}
+	add := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+
+	switch {
+	case search.Path == "":
+	case search.IsGlob():
+		add("path ~ $%d", globToRegexp(search.Path))
+	default:
+		add("strpos(lower(path), lower($%d)) > 0", search.Path)
+	}
+
+	if search.Cached != nil {
+		add("cached = $%d", *search.Cached)
+	}
+	if search.Priority != nil {
+		add("priority = $%d", *search.Priority)
+	}
+	if search.MinSize > 0 {
+		add("size >= $%d", search.MinSize)
+	}
+	if search.MaxSize > 0 {
+		add("size <= $%d", search.MaxSize)
+	}
+	if search.Owner != "" {
+		add("owner = $%d", search.Owner)
+	}
+	if search.Label != "" {
+		add("strpos(',' || labels || ',', $%d) > 0", ","+search.Label+",")
+	}
+
+	return strings.Join(conds, " AND "), args
+}
+
+// globToRegexp translates a glob with SQLite GLOB semantics (*, ?, [...], [^...])
+// into an anchored POSIX regular expression
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if end == 0 {
+				// "[]...]" starts the class with a literal ']'
+				next := strings.IndexByte(glob[i+2:], ']')
+				if next < 0 {
+					b.WriteString(`\[`)
+					continue
+				}
+				class = glob[i+1 : i+2+next]
+				end = next + 1
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
@@ -0,0 +1,163 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+)
+
+// labelUsageQuery selects labels with the counts of their files
+const labelUsageQuery = `
+	SELECT l.id, l.syno_label_id, l.name, l.sync_excluded, l.last_sync_at,
+		COUNT(f.id), COALESCE(SUM(f.size), 0),
+		COUNT(f.id) FILTER (WHERE f.cached),
+		COALESCE(SUM(f.size) FILTER (WHERE f.cached), 0)
+	FROM labels l
+	LEFT JOIN file_labels fl ON fl.label_id = l.id
+	LEFT JOIN files f ON f.id = fl.file_id
+`
+
+// SyncLabels replaces the stored labels and rebuilds the file mappings
+func (s *Store) SyncLabels(labels []*domain.Label) error {
+	now := time.Now()
+
+	return s.withTx(func(ctx context.Context, tx *sql.Tx) error {
+		keep := make([]interface{}, 0, len(labels))
+		placeholders := make([]string, 0, len(labels))
+		for _, label := range labels {
+			err := tx.QueryRowContext(ctx, `
+				INSERT INTO labels (syno_label_id, name, sync_excluded, last_sync_at)
+				VALUES ($1, $2, $3, $4)
+				ON CONFLICT (syno_label_id) DO UPDATE SET
+					name = excluded.name,
+					sync_excluded = excluded.sync_excluded,
+					last_sync_at = excluded.last_sync_at
+				RETURNING id
+			`, label.SynoLabelID, label.Name, label.Excluded, now).Scan(&label.ID)
+			if err != nil {
+				return err
+			}
+			label.LastSyncAt = now
+			keep = append(keep, label.SynoLabelID)
+			placeholders = append(placeholders, fmt.Sprintf("$%d", len(keep)))
+		}
+
+		// Labels deleted on the NAS, their mappings are removed by cascade
+		remove := "DELETE FROM labels"
+		if len(keep) > 0 {
+			remove += " WHERE syno_label_id NOT IN (" + strings.Join(placeholders, ", ") + ")"
+		}
+		if _, err := tx.ExecContext(ctx, remove, keep...); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, "DELETE FROM file_labels"); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO file_labels (file_id, label_id)
+			SELECT f.id, l.id
+			FROM files f
+			JOIN labels l ON strpos(',' || f.labels || ',', ',' || l.name || ',') > 0
+			WHERE f.labels <> ''
+		`)
+		return err
+	})
+}
+
+// ListLabels returns all labels with their file counts, ordered by name
+func (s *Store) ListLabels() ([]*domain.LabelUsage, error) {
+	rows, err := s.db.Query(labelUsageQuery + ` GROUP BY l.id ORDER BY l.name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var labels []*domain.LabelUsage
+	for rows.Next() {
+		label, err := scanLabelUsage(rows)
+		if err != nil {
+			return nil, err
+		}
+		labels = append(labels, label)
+	}
+	return labels, rows.Err()
+}
+
+// GetLabel returns a label with its file counts, or nil if it does not exist
+func (s *Store) GetLabel(id int64) (*domain.LabelUsage, error) {
+	label, err := scanLabelUsage(s.db.QueryRow(labelUsageQuery+` WHERE l.id = $1 GROUP BY l.id`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return label, err
+}
+
+// ListLabelFiles returns a page of the files carrying a label and their total number
+func (s *Store) ListLabelFiles(labelID int64, cached *bool, limit, offset int) ([]*domain.File, int, error) {
+	where := "id IN (SELECT file_id FROM file_labels WHERE label_id = $1)"
+	args := []interface{}{labelID}
+	if cached != nil {
+		where += " AND cached = $2"
+		args = append(args, *cached)
+	}
+
+	var total int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM files WHERE `+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.db.Query(fmt.Sprintf(`
+		SELECT `+fileColumns+`
+		FROM files
+		WHERE %s
+		ORDER BY path
+		LIMIT $%d OFFSET $%d
+	`, where, len(args)+1, len(args)+2), append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var files []*domain.File
+	for rows.Next() {
+		file, err := scanFile(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		files = append(files, file)
+	}
+	return files, total, rows.Err()
+}
+
+// updateFileLabels maps a file to the stored labels named in its comma-joined labels
+func updateFileLabels(ctx context.Context, tx *sql.Tx, fileID int64, labels string) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM file_labels WHERE file_id = $1", fileID); err != nil {
+		return err
+	}
+	if labels == "" {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO file_labels (file_id, label_id)
+		SELECT $1, id FROM labels WHERE strpos(',' || $2 || ',', ',' || name || ',') > 0
+	`, fileID, labels)
+	return err
+}
+
+// scanLabelUsage scans a row selected with labelUsageQuery
+func scanLabelUsage(row interface{ Scan(...interface{}) error }) (*domain.LabelUsage, error) {
+	label := &domain.LabelUsage{}
+	err := row.Scan(
+		&label.ID, &label.SynoLabelID, &label.Name, &label.Excluded, &label.LastSyncAt,
+		&label.Files, &label.TotalBytes, &label.CachedFiles, &label.CachedBytes,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return label, nil
+}
@@ -0,0 +1,25 @@
+package postgres
+
+import (
+	"time"
+)
+
+// AcquireLease takes or renews the named lease for holder until ttl from now.
+// Expiry is computed with the database clock, so instance clock skew does not matter.
+func (s *Store) AcquireLease(name, holder string, ttl time.Duration) (bool, error) {
+	count, err := s.execCount(`
+		INSERT INTO leases (name, holder, expires_at)
+		VALUES ($1, $2, NOW() + $3::float8 * INTERVAL '1 second')
+		ON CONFLICT (name) DO UPDATE SET
+			holder = excluded.holder,
+			expires_at = excluded.expires_at
+		WHERE leases.holder = excluded.holder OR leases.expires_at < NOW()
+	`, name, holder, ttl.Seconds())
+	return count > 0, err
+}
+
+// ReleaseLease gives up the named lease if it is held by holder
+func (s *Store) ReleaseLease(name, holder string) error {
+	_, err := s.db.Exec(`DELETE FROM leases WHERE name = $1 AND holder = $2`, name, holder)
+	return err
+}
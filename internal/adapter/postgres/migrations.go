@@ -0,0 +1,427 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+)
+
+// migrationLockID serialises schema migrations of instances sharing a database
+const migrationLockID = 7_400_113
+
+// migration is a versioned schema change. Migrations are applied in
+// ascending version order, each in its own transaction, and recorded in
+// schema_migrations. New schema changes are appended with the next version;
+// released migrations must never be edited.
+type migration struct {
+	version int
+	name    string
+	up      func(ctx context.Context, tx *sql.Tx) error
+	down    func(ctx context.Context, tx *sql.Tx) error // nil when the change cannot be reverted
+}
+
+// migrations is the ordered schema history
+var migrations = []migration{
+	{version: 1, name: "baseline", up: execStatements(baselineSchema...)},
+	{
+		version: 2,
+		name:    "file_access_counters",
+		up: execStatements(
+			`ALTER TABLE files ADD COLUMN access_count BIGINT NOT NULL DEFAULT 0`,
+			`ALTER TABLE files ADD COLUMN bytes_served BIGINT NOT NULL DEFAULT 0`,
+			`ALTER TABLE files ADD COLUMN miss_count BIGINT NOT NULL DEFAULT 0`,
+		),
+		down: execStatements(
+			`ALTER TABLE files DROP COLUMN miss_count`,
+			`ALTER TABLE files DROP COLUMN bytes_served`,
+			`ALTER TABLE files DROP COLUMN access_count`,
+		),
+	},
+	{
+		version: 3,
+		name:    "file_rejected_reason",
+		up: execStatements(
+			`ALTER TABLE files ADD COLUMN rejected_reason TEXT NOT NULL DEFAULT ''`,
+		),
+		down: execStatements(
+			`ALTER TABLE files DROP COLUMN rejected_reason`,
+		),
+	},
+	{
+		version: 4,
+		name:    "replicated_files",
+		up: execStatements(
+			`CREATE TABLE replicated_files (
+				syno_file_id TEXT PRIMARY KEY,
+				size BIGINT NOT NULL,
+				modified_at TIMESTAMPTZ,
+				cache_path TEXT NOT NULL,
+				cache_encoding TEXT NOT NULL DEFAULT '',
+				replicated_at TIMESTAMPTZ NOT NULL
+			)`,
+		),
+		down: execStatements(
+			`DROP TABLE replicated_files`,
+		),
+	},
+	{
+		version: 5,
+		name:    "file_stale",
+		up: execStatements(
+			`ALTER TABLE files ADD COLUMN stale BOOLEAN NOT NULL DEFAULT FALSE`,
+		),
+		down: execStatements(
+			`ALTER TABLE files DROP COLUMN stale`,
+		),
+	},
+	{
+		version: 6,
+		name:    "share_cache_control",
+		up: execStatements(
+			`ALTER TABLE shares ADD COLUMN cache_control TEXT NOT NULL DEFAULT ''`,
+		),
+		down: execStatements(
+			`ALTER TABLE shares DROP COLUMN cache_control`,
+		),
+	},
+}
+
+// execStatements returns a migration step running statements in order
+func execStatements(statements ...string) func(ctx context.Context, tx *sql.Tx) error {
+	return func(ctx context.Context, tx *sql.Tx) error {
+		for _, stmt := range statements {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return fmt.Errorf("%w\nSQL: %s", err, stmt)
+			}
+		}
+		return nil
+	}
+}
+
+// withMigrationLock runs fn on a connection holding the migration lock, so
+// instances starting together do not race on DDL
+func (s *Store) withMigrationLock(fn func(ctx context.Context, conn *sql.Conn) error) error {
+	ctx := context.Background()
+
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	defer conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", migrationLockID)
+
+	return fn(ctx, conn)
+}
+
+// runInTx runs fn in a transaction on conn, committing if it returns nil
+func runInTx(ctx context.Context, conn *sql.Conn, fn func(ctx context.Context, tx *sql.Tx) error) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(ctx, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// schemaVersion returns the latest applied migration version, 0 for an empty database
+func schemaVersion(ctx context.Context, conn *sql.Conn) (int, error) {
+	var version int
+	if err := conn.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return version, nil
+}
+
+// migrate applies the migrations newer than the recorded schema version.
+// It refuses to touch a schema written by a newer build.
+func (s *Store) migrate() error {
+	return s.withMigrationLock(func(ctx context.Context, conn *sql.Conn) error {
+		if _, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL
+		)`); err != nil {
+			return fmt.Errorf("failed to create schema_migrations: %w", err)
+		}
+
+		current, err := schemaVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+		latest := migrations[len(migrations)-1].version
+		if current > latest {
+			return fmt.Errorf("%w: database is at version %d, this build supports up to %d",
+				domain.ErrSchemaTooNew, current, latest)
+		}
+
+		for _, m := range migrations {
+			if m.version <= current {
+				continue
+			}
+			err := runInTx(ctx, conn, func(ctx context.Context, tx *sql.Tx) error {
+				if err := m.up(ctx, tx); err != nil {
+					return err
+				}
+				_, err := tx.ExecContext(ctx,
+					"INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)",
+					m.version, m.name, time.Now())
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d (%s) failed: %w", m.version, m.name, err)
+			}
+		}
+		return nil
+	})
+}
+
+// SchemaVersion returns the latest applied migration version
+func (s *Store) SchemaVersion() (int, error) {
+	var version int
+	if err := s.db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return version, nil
+}
+
+// MigrateDown reverts the applied migrations newer than version, newest first.
+// Run it with the build that applied them before downgrading.
+func (s *Store) MigrateDown(version int) error {
+	return s.withMigrationLock(func(ctx context.Context, conn *sql.Conn) error {
+		current, err := schemaVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(migrations) - 1; i >= 0; i-- {
+			m := migrations[i]
+			if m.version <= version || m.version > current {
+				continue
+			}
+			if m.down == nil {
+				return fmt.Errorf("migration %d (%s) cannot be reverted", m.version, m.name)
+			}
+			err := runInTx(ctx, conn, func(ctx context.Context, tx *sql.Tx) error {
+				if err := m.down(ctx, tx); err != nil {
+					return err
+				}
+				_, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = $1", m.version)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("reverting migration %d (%s) failed: %w", m.version, m.name, err)
+			}
+		}
+		return nil
+	})
+}
+
+// baselineSchema is the schema before versioned migrations. Every statement
+// is idempotent, since databases created by older builds are at an unknown
+// point of it.
+var baselineSchema = []string{
+	// Create files table
+	`CREATE TABLE IF NOT EXISTS files (
+		id BIGSERIAL PRIMARY KEY,
+		syno_file_id TEXT UNIQUE NOT NULL,
+		path TEXT NOT NULL,
+		size BIGINT NOT NULL DEFAULT 0,
+		modified_at TIMESTAMPTZ,
+		accessed_at TIMESTAMPTZ,
+		starred BOOLEAN DEFAULT FALSE,
+		shared BOOLEAN DEFAULT FALSE,
+		last_sync_at TIMESTAMPTZ,
+		cached BOOLEAN DEFAULT FALSE,
+		cache_path TEXT,
+		cache_encoding TEXT NOT NULL DEFAULT '',
+		priority INTEGER DEFAULT 5,
+		last_access_in_cache_at TIMESTAMPTZ,
+		created_at TIMESTAMPTZ DEFAULT NOW(),
+		updated_at TIMESTAMPTZ DEFAULT NOW()
+	)`,
+	`ALTER TABLE files ADD COLUMN IF NOT EXISTS cache_encoding TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE files ADD COLUMN IF NOT EXISTS owner TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE files ADD COLUMN IF NOT EXISTS labels TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE files ADD COLUMN IF NOT EXISTS content_type TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE files ADD COLUMN IF NOT EXISTS export_format TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE files ADD COLUMN IF NOT EXISTS cache_state TEXT NOT NULL DEFAULT ''`,
+	`CREATE INDEX IF NOT EXISTS idx_files_cache_state ON files(cache_state) WHERE cache_state <> ''`,
+	`ALTER TABLE files ADD COLUMN IF NOT EXISTS content_hash TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE files ADD COLUMN IF NOT EXISTS missing_upstream_at TIMESTAMPTZ`,
+	`CREATE INDEX IF NOT EXISTS idx_files_cache_path ON files(cache_path)`,
+
+	// Create shares table
+	`CREATE TABLE IF NOT EXISTS shares (
+		id BIGSERIAL PRIMARY KEY,
+		syno_share_id TEXT UNIQUE NOT NULL,
+		token TEXT UNIQUE NOT NULL,
+		sharing_link TEXT DEFAULT '',
+		url TEXT DEFAULT '',
+		file_id BIGINT NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+		password TEXT,
+		expires_at TIMESTAMPTZ,
+		created_at TIMESTAMPTZ DEFAULT NOW(),
+		revoked BOOLEAN DEFAULT FALSE
+	)`,
+	`ALTER TABLE shares ADD COLUMN IF NOT EXISTS max_downloads INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE shares ADD COLUMN IF NOT EXISTS nas_max_downloads INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE shares ADD COLUMN IF NOT EXISTS download_count BIGINT NOT NULL DEFAULT 0`,
+	`ALTER TABLE shares ADD COLUMN IF NOT EXISTS allowed_ips TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE shares ADD COLUMN IF NOT EXISTS denied_ips TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE shares ADD COLUMN IF NOT EXISTS require_signature BOOLEAN NOT NULL DEFAULT FALSE`,
+
+	// Create meta table for storing sync state
+	`CREATE TABLE IF NOT EXISTS meta (
+		key TEXT PRIMARY KEY,
+		value TEXT,
+		updated_at TIMESTAMPTZ DEFAULT NOW()
+	)`,
+
+	// Create download_tasks table for task queue based downloads
+	`CREATE TABLE IF NOT EXISTS download_tasks (
+		id BIGSERIAL PRIMARY KEY,
+		file_id BIGINT NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+		syno_path TEXT NOT NULL,
+		priority INTEGER NOT NULL DEFAULT 5,
+		size BIGINT NOT NULL DEFAULT 0,
+		status TEXT NOT NULL DEFAULT 'pending',
+		worker_id TEXT,
+		temp_file_path TEXT,
+		bytes_downloaded BIGINT NOT NULL DEFAULT 0,
+		retry_count INTEGER NOT NULL DEFAULT 0,
+		max_retries INTEGER NOT NULL DEFAULT 3,
+		next_retry_at TIMESTAMPTZ,
+		last_error TEXT,
+		created_at TIMESTAMPTZ DEFAULT NOW(),
+		claimed_at TIMESTAMPTZ,
+		updated_at TIMESTAMPTZ DEFAULT NOW(),
+		aged_at TIMESTAMPTZ
+	)`,
+
+	// Create admin_users table for multi-user admin auth
+	`CREATE TABLE IF NOT EXISTS admin_users (
+		id BIGSERIAL PRIMARY KEY,
+		username TEXT UNIQUE NOT NULL,
+		password_hash TEXT NOT NULL,
+		role TEXT NOT NULL DEFAULT 'viewer',
+		disabled BOOLEAN DEFAULT FALSE,
+		created_at TIMESTAMPTZ DEFAULT NOW(),
+		updated_at TIMESTAMPTZ DEFAULT NOW()
+	)`,
+
+	// Create api_tokens table for admin API automation
+	`CREATE TABLE IF NOT EXISTS api_tokens (
+		id BIGSERIAL PRIMARY KEY,
+		user_id BIGINT NOT NULL REFERENCES admin_users(id) ON DELETE CASCADE,
+		name TEXT NOT NULL DEFAULT '',
+		token_hash TEXT UNIQUE NOT NULL,
+		prefix TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMPTZ DEFAULT NOW(),
+		last_used_at TIMESTAMPTZ,
+		expires_at TIMESTAMPTZ,
+		revoked BOOLEAN DEFAULT FALSE
+	)`,
+
+	// Create audit_events table for admin and share action history
+	`CREATE TABLE IF NOT EXISTS audit_events (
+		id BIGSERIAL PRIMARY KEY,
+		created_at TIMESTAMPTZ DEFAULT NOW(),
+		actor TEXT NOT NULL,
+		action TEXT NOT NULL,
+		target TEXT,
+		remote_addr TEXT,
+		details TEXT
+	)`,
+
+	// Create leases table for electing a single active instance
+	`CREATE TABLE IF NOT EXISTS leases (
+		name TEXT PRIMARY KEY,
+		holder TEXT NOT NULL,
+		expires_at TIMESTAMPTZ NOT NULL
+	)`,
+
+	// Create preseed_paths table for folders that are always cached
+	`CREATE TABLE IF NOT EXISTS preseed_paths (
+		id BIGSERIAL PRIMARY KEY,
+		path TEXT UNIQUE NOT NULL,
+		created_by TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMPTZ DEFAULT NOW()
+	)`,
+
+	// Create file_chunks table for chunks of partially cached large files
+	`CREATE TABLE IF NOT EXISTS file_chunks (
+		file_id BIGINT NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+		chunk_index BIGINT NOT NULL,
+		size BIGINT NOT NULL,
+		version BIGINT NOT NULL DEFAULT 0,
+		accessed_at TIMESTAMPTZ,
+		created_at TIMESTAMPTZ DEFAULT NOW(),
+		PRIMARY KEY (file_id, chunk_index)
+	)`,
+
+	// Create labels and file_labels tables for label browsing
+	`CREATE TABLE IF NOT EXISTS labels (
+		id BIGSERIAL PRIMARY KEY,
+		syno_label_id TEXT UNIQUE NOT NULL,
+		name TEXT NOT NULL,
+		sync_excluded BOOLEAN NOT NULL DEFAULT FALSE,
+		last_sync_at TIMESTAMPTZ NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS file_labels (
+		file_id BIGINT NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+		label_id BIGINT NOT NULL REFERENCES labels(id) ON DELETE CASCADE,
+		PRIMARY KEY (file_id, label_id)
+	)`,
+
+	// Create stat_snapshots table for the admin dashboard charts
+	`CREATE TABLE IF NOT EXISTS stat_snapshots (
+		id BIGSERIAL PRIMARY KEY,
+		instance TEXT NOT NULL DEFAULT '',
+		taken_at TIMESTAMPTZ NOT NULL,
+		total_files BIGINT NOT NULL DEFAULT 0,
+		cached_files BIGINT NOT NULL DEFAULT 0,
+		cached_bytes BIGINT NOT NULL DEFAULT 0,
+		cache_hits BIGINT NOT NULL DEFAULT 0,
+		cache_misses BIGINT NOT NULL DEFAULT 0,
+		downloaded_bytes BIGINT NOT NULL DEFAULT 0,
+		pending_tasks INTEGER NOT NULL DEFAULT 0,
+		in_progress_tasks INTEGER NOT NULL DEFAULT 0,
+		failed_tasks INTEGER NOT NULL DEFAULT 0,
+		queued_bytes BIGINT NOT NULL DEFAULT 0
+	)`,
+	`ALTER TABLE stat_snapshots ADD COLUMN IF NOT EXISTS served_bytes BIGINT NOT NULL DEFAULT 0`,
+
+	// Create indexes for better query performance
+	`CREATE INDEX IF NOT EXISTS idx_files_path ON files(path)`,
+	`CREATE INDEX IF NOT EXISTS idx_files_priority ON files(priority)`,
+	`CREATE INDEX IF NOT EXISTS idx_files_cached ON files(cached)`,
+	`CREATE INDEX IF NOT EXISTS idx_files_last_access ON files(last_access_in_cache_at)`,
+	`CREATE INDEX IF NOT EXISTS idx_files_size ON files(size)`,
+	`CREATE INDEX IF NOT EXISTS idx_files_modified_at ON files(modified_at)`,
+	`CREATE INDEX IF NOT EXISTS idx_files_owner ON files(owner)`,
+	`CREATE INDEX IF NOT EXISTS idx_shares_file_id ON shares(file_id)`,
+	`CREATE INDEX IF NOT EXISTS idx_download_tasks_status ON download_tasks(status)`,
+	`CREATE INDEX IF NOT EXISTS idx_download_tasks_priority ON download_tasks(priority, size)`,
+	`CREATE INDEX IF NOT EXISTS idx_download_tasks_file_id ON download_tasks(file_id)`,
+	`CREATE INDEX IF NOT EXISTS idx_api_tokens_user_id ON api_tokens(user_id)`,
+	`CREATE INDEX IF NOT EXISTS idx_audit_events_created_at ON audit_events(created_at)`,
+	`CREATE INDEX IF NOT EXISTS idx_audit_events_actor ON audit_events(actor)`,
+	`CREATE INDEX IF NOT EXISTS idx_file_chunks_accessed_at ON file_chunks(accessed_at)`,
+	`CREATE INDEX IF NOT EXISTS idx_stat_snapshots_instance_taken_at ON stat_snapshots(instance, taken_at)`,
+	`CREATE INDEX IF NOT EXISTS idx_file_labels_label_id ON file_labels(label_id)`,
+	`CREATE INDEX IF NOT EXISTS idx_files_missing_upstream_at ON files(missing_upstream_at) WHERE missing_upstream_at IS NOT NULL`,
+
+	// At most one active task per file, even with several instances enqueueing
+	`CREATE UNIQUE INDEX IF NOT EXISTS idx_download_tasks_active_file
+		ON download_tasks(file_id) WHERE status IN ('pending', 'in_progress')`,
+}
@@ -0,0 +1,48 @@
+package postgres
+
+import (
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+)
+
+// ListPreseedPaths returns all pre-seeded paths ordered by path
+func (s *Store) ListPreseedPaths() ([]*domain.PreseedPath, error) {
+	rows, err := s.db.Query(`SELECT id, path, created_by, created_at FROM preseed_paths ORDER BY path`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var paths []*domain.PreseedPath
+	for rows.Next() {
+		p := &domain.PreseedPath{}
+		if err := rows.Scan(&p.ID, &p.Path, &p.CreatedBy, &p.CreatedAt); err != nil {
+			return nil, err
+		}
+		paths = append(paths, p)
+	}
+	return paths, rows.Err()
+}
+
+// AddPreseedPath stores a new pre-seeded path
+func (s *Store) AddPreseedPath(p *domain.PreseedPath) error {
+	err := s.db.QueryRow(`
+		INSERT INTO preseed_paths (path, created_by) VALUES ($1, $2)
+		RETURNING id, created_at
+	`, p.Path, p.CreatedBy).Scan(&p.ID, &p.CreatedAt)
+	if err != nil && isUniqueConstraintError(err) {
+		return domain.ErrAlreadyExists
+	}
+	return err
+}
+
+// DeletePreseedPath removes a pre-seeded path by ID
+func (s *Store) DeletePreseedPath(id int64) error {
+	count, err := s.execCount(`DELETE FROM preseed_paths WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package postgres
+
+import (
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+)
+
+// ListReplicationPending returns up to limit cached files that have no
+// replica yet or whose copy changed since it was replicated
+func (s *Store) ListReplicationPending(limit int) ([]*domain.File, error) {
+	rows, err := s.db.Query(`
+		SELECT `+fileColumns+`
+		FROM files
+		WHERE cached = TRUE AND cache_state = ''
+		  AND NOT EXISTS (
+			SELECT 1 FROM replicated_files r
+			WHERE r.syno_file_id = files.syno_file_id
+			  AND r.size = files.size
+			  AND r.modified_at IS NOT DISTINCT FROM files.modified_at
+			  AND r.cache_path = files.cache_path
+			  AND r.cache_encoding = files.cache_encoding
+		  )
+		ORDER BY priority, id
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []*domain.File
+	for rows.Next() {
+		file, err := scanFile(rows)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, rows.Err()
+}
+
+// ListReplicationStale returns up to limit Synology file IDs that were
+// replicated but are no longer cached
+func (s *Store) ListReplicationStale(limit int) ([]string, error) {
+	rows, err := s.db.Query(`
+		SELECT r.syno_file_id
+		FROM replicated_files r
+		LEFT JOIN files f ON f.syno_file_id = r.syno_file_id
+		WHERE f.id IS NULL OR (f.cached = FALSE AND f.cache_state <> $1)
+		ORDER BY r.replicated_at
+		LIMIT $2
+	`, domain.CacheStateCaching, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// MarkReplicated records that the current copy of file was replicated
+func (s *Store) MarkReplicated(file *domain.File) error {
+	_, err := s.db.Exec(`
+		INSERT INTO replicated_files (syno_file_id, size, modified_at, cache_path, cache_encoding, replicated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (syno_file_id) DO UPDATE SET
+			size = excluded.size,
+			modified_at = excluded.modified_at,
+			cache_path = excluded.cache_path,
+			cache_encoding = excluded.cache_encoding,
+			replicated_at = excluded.replicated_at
+	`, file.SynoFileID, file.Size, file.ModifiedAt, file.CachePath, file.CacheEncoding, time.Now())
+	return err
+}
+
+// DeleteReplicated forgets the replica of a Synology file
+func (s *Store) DeleteReplicated(synoFileID string) error {
+	_, err := s.db.Exec(`DELETE FROM replicated_files WHERE syno_file_id = $1`, synoFileID)
+	return err
+}
@@ -0,0 +1,249 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/util/passhash"
+)
+
+// GetShareByToken retrieves a share by its token
+func (s *Store) GetShareByToken(token string) (*domain.Share, error) {
+	query := `
+		SELECT id, syno_share_id, token, sharing_link, url, file_id, password, expires_at, created_at, revoked,
+			max_downloads, nas_max_downloads, download_count, allowed_ips, denied_ips, require_signature, cache_control
+		FROM shares
+		WHERE token = $1
+	`
+
+	share := &domain.Share{}
+	var password, sharingLink, url sql.NullString
+	var allowedIPs, deniedIPs string
+
+	err := s.db.QueryRow(query, token).Scan(
+		&share.ID, &share.SynoShareID, &share.Token, &sharingLink, &url,
+		&share.FileID, &password, &share.ExpiresAt, &share.CreatedAt, &share.Revoked,
+		&share.MaxDownloads, &share.NASMaxDownloads, &share.DownloadCount, &allowedIPs, &deniedIPs, &share.RequireSignature, &share.CacheControl,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	share.Password = password.String
+	share.SharingLink = sharingLink.String
+	share.URL = url.String
+	share.AllowedIPs = domain.DecodeLabels(allowedIPs)
+	share.DeniedIPs = domain.DecodeLabels(deniedIPs)
+	return share, nil
+}
+
+// GetFileByShareToken retrieves both the file and share by share token.
+// There is no in-process cache: with several instances sharing the database
+// a cached entry could outlive a revocation made elsewhere.
+func (s *Store) GetFileByShareToken(token string) (*domain.File, *domain.Share, error) {
+	query := `
+		SELECT
+			f.id, f.syno_file_id, f.path, f.size, f.modified_at, f.accessed_at,
+			f.starred, f.shared, f.last_sync_at, f.cached, f.cache_path, f.cache_encoding,
+			f.priority, f.content_type, f.export_format, f.cache_state, f.content_hash, f.last_access_in_cache_at, f.created_at, f.updated_at,
+			s.id, s.syno_share_id, s.token, s.sharing_link, s.url, s.file_id, s.password, s.expires_at, s.created_at, s.revoked,
+			s.max_downloads, s.nas_max_downloads, s.download_count, s.allowed_ips, s.denied_ips, s.require_signature, s.cache_control
+		FROM shares s
+		JOIN files f ON s.file_id = f.id
+		WHERE s.token = $1
+	`
+
+	file := &domain.File{}
+	share := &domain.Share{}
+	var cachePath, password, sharingLink, url sql.NullString
+	var allowedIPs, deniedIPs string
+
+	err := s.db.QueryRow(query, token).Scan(
+		&file.ID, &file.SynoFileID, &file.Path, &file.Size, &file.ModifiedAt, &file.AccessedAt,
+		&file.Starred, &file.Shared, &file.LastSyncAt, &file.Cached, &cachePath, &file.CacheEncoding,
+		&file.Priority, &file.ContentType, &file.ExportFormat, &file.CacheState, &file.ContentHash, &file.LastAccessInCacheAt, &file.CreatedAt, &file.UpdatedAt,
+		&share.ID, &share.SynoShareID, &share.Token, &sharingLink, &url, &share.FileID,
+		&password, &share.ExpiresAt, &share.CreatedAt, &share.Revoked,
+		&share.MaxDownloads, &share.NASMaxDownloads, &share.DownloadCount, &allowedIPs, &deniedIPs, &share.RequireSignature, &share.CacheControl,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	file.CachePath = cachePath.String
+	share.Password = password.String
+	share.SharingLink = sharingLink.String
+	share.URL = url.String
+	share.AllowedIPs = domain.DecodeLabels(allowedIPs)
+	share.DeniedIPs = domain.DecodeLabels(deniedIPs)
+	return file, share, nil
+}
+
+// CreateShare creates a new share record
+func (s *Store) CreateShare(share *domain.Share) error {
+	password, err := hashSharePassword(share)
+	if err != nil {
+		return err
+	}
+
+	return s.db.QueryRow(`
+		INSERT INTO shares (syno_share_id, token, sharing_link, url, file_id, password, expires_at, revoked, max_downloads, nas_max_downloads,
+			allowed_ips, denied_ips, require_signature, cache_control)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+		RETURNING id
+	`,
+		share.SynoShareID, share.Token, share.SharingLink, share.URL,
+		share.FileID, password, share.ExpiresAt, share.Revoked, share.MaxDownloads, share.NASMaxDownloads,
+		domain.EncodeLabels(share.AllowedIPs), domain.EncodeLabels(share.DeniedIPs), share.RequireSignature, share.CacheControl,
+	).Scan(&share.ID)
+}
+
+// UpdateShare updates an existing share record. The download count and the
+// local access settings are changed only by ClaimShareDownload,
+// SetShareMaxDownloads, SetShareIPRules, SetShareRequireSignature and
+// SetShareCacheControl.
+func (s *Store) UpdateShare(share *domain.Share) error {
+	password, err := hashSharePassword(share)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`
+		UPDATE shares SET
+			sharing_link = $1, url = $2, password = $3, expires_at = $4, revoked = $5, nas_max_downloads = $6
+		WHERE id = $7
+	`, share.SharingLink, share.URL, password, share.ExpiresAt, share.Revoked, share.NASMaxDownloads, share.ID)
+	return err
+}
+
+// ListActiveShares returns all shares that are not revoked
+func (s *Store) ListActiveShares() ([]*domain.Share, error) {
+	rows, err := s.db.Query(`
+		SELECT id, syno_share_id, token, sharing_link, url, file_id, password, expires_at, created_at, revoked,
+			max_downloads, nas_max_downloads, download_count, allowed_ips, denied_ips, require_signature, cache_control
+		FROM shares
+		WHERE revoked = FALSE
+		ORDER BY id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var shares []*domain.Share
+	for rows.Next() {
+		share := &domain.Share{}
+		var password, sharingLink, url sql.NullString
+		var allowedIPs, deniedIPs string
+		if err := rows.Scan(
+			&share.ID, &share.SynoShareID, &share.Token, &sharingLink, &url,
+			&share.FileID, &password, &share.ExpiresAt, &share.CreatedAt, &share.Revoked,
+			&share.MaxDownloads, &share.NASMaxDownloads, &share.DownloadCount, &allowedIPs, &deniedIPs, &share.RequireSignature, &share.CacheControl,
+		); err != nil {
+			return nil, err
+		}
+		share.Password = password.String
+		share.SharingLink = sharingLink.String
+		share.URL = url.String
+		share.AllowedIPs = domain.DecodeLabels(allowedIPs)
+		share.DeniedIPs = domain.DecodeLabels(deniedIPs)
+		shares = append(shares, share)
+	}
+	return shares, rows.Err()
+}
+
+// shareDownloadLimit is the SQL form of Share.DownloadLimit
+const shareDownloadLimit = `CASE
+	WHEN max_downloads > 0 THEN max_downloads
+	WHEN max_downloads < 0 THEN 0
+	ELSE nas_max_downloads
+END`
+
+// ClaimShareDownload counts a download of share unless its limit is reached.
+// The check and the increment are a single statement, so concurrent
+// downloads cannot exceed the limit.
+func (s *Store) ClaimShareDownload(share *domain.Share) (bool, error) {
+	err := s.db.QueryRow(`
+		UPDATE shares SET download_count = download_count + 1
+		WHERE id = $1 AND (`+shareDownloadLimit+` = 0 OR download_count < `+shareDownloadLimit+`)
+		RETURNING download_count
+	`, share.ID).Scan(&share.DownloadCount)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// SetShareMaxDownloads sets the local download limit override of a share
+func (s *Store) SetShareMaxDownloads(token string, maxDownloads int) error {
+	count, err := s.execCount(`UPDATE shares SET max_downloads = $1 WHERE token = $2`, maxDownloads, token)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+// SetShareIPRules sets the client networks allowed and denied for a share
+func (s *Store) SetShareIPRules(token string, allowed, denied []string) error {
+	count, err := s.execCount(`UPDATE shares SET allowed_ips = $1, denied_ips = $2 WHERE token = $3`,
+		domain.EncodeLabels(allowed), domain.EncodeLabels(denied), token)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+// SetShareRequireSignature sets whether a share is served only through signed links
+func (s *Store) SetShareRequireSignature(token string, required bool) error {
+	count, err := s.execCount(`UPDATE shares SET require_signature = $1 WHERE token = $2`, required, token)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+// SetShareCacheControl sets the Cache-Control of a share ("" = the global policy)
+func (s *Store) SetShareCacheControl(token, cacheControl string) error {
+	count, err := s.execCount(`UPDATE shares SET cache_control = $1 WHERE token = $2`, cacheControl, token)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+// hashSharePassword hashes a plaintext share password for storage.
+// share.Password is replaced with the stored hash so callers see the persisted value.
+func hashSharePassword(share *domain.Share) (sql.NullString, error) {
+	if share.Password == "" {
+		return sql.NullString{}, nil
+	}
+
+	if !passhash.IsHashed(share.Password) {
+		hashed, err := passhash.Hash(share.Password)
+		if err != nil {
+			return sql.NullString{}, fmt.Errorf("failed to hash share password: %w", err)
+		}
+		share.Password = hashed
+	}
+
+	return sql.NullString{String: share.Password, Valid: true}, nil
+}
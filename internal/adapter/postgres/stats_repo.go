@@ -0,0 +1,64 @@
+package postgres
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+)
+
+const statSnapshotColumns = `instance, taken_at, total_files, cached_files, cached_bytes,
+	cache_hits, cache_misses, downloaded_bytes, served_bytes,
+	pending_tasks, in_progress_tasks, failed_tasks, queued_bytes`
+
+// AddStatSnapshot records a periodic statistics sample
+func (s *Store) AddStatSnapshot(snapshot *domain.StatSnapshot) error {
+	return s.db.QueryRow(`
+		INSERT INTO stat_snapshots (`+statSnapshotColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		RETURNING id
+	`, snapshot.Instance, snapshot.TakenAt, snapshot.TotalFiles, snapshot.CachedFiles, snapshot.CachedBytes,
+		snapshot.CacheHits, snapshot.CacheMisses, snapshot.DownloadedBytes, snapshot.ServedBytes,
+		snapshot.PendingTasks, snapshot.InProgressTasks, snapshot.FailedTasks, snapshot.QueuedBytes,
+	).Scan(&snapshot.ID)
+}
+
+// ListStatSnapshots returns the samples taken in [since, until), oldest first.
+// An empty instance returns the samples of all instances.
+func (s *Store) ListStatSnapshots(instance string, since, until time.Time) ([]*domain.StatSnapshot, error) {
+	rows, err := s.db.Query(`
+		SELECT id, `+statSnapshotColumns+`
+		FROM stat_snapshots
+		WHERE ($1 = '' OR instance = $1) AND taken_at >= $2 AND taken_at < $3
+		ORDER BY taken_at, instance
+	`, instance, since, until)
+	if err != nil {
+		return nil, err
+	}
+	return scanStatSnapshots(rows)
+}
+
+// DeleteStatSnapshotsBefore removes samples older than the given age
+func (s *Store) DeleteStatSnapshotsBefore(maxAge time.Duration) (int, error) {
+	return s.execCount(`DELETE FROM stat_snapshots WHERE taken_at < $1`, time.Now().Add(-maxAge))
+}
+
+// scanStatSnapshots reads snapshot rows selected with the id and statSnapshotColumns
+func scanStatSnapshots(rows *sql.Rows) ([]*domain.StatSnapshot, error) {
+	defer rows.Close()
+
+	var snapshots []*domain.StatSnapshot
+	for rows.Next() {
+		snapshot := &domain.StatSnapshot{}
+		if err := rows.Scan(
+			&snapshot.ID, &snapshot.Instance, &snapshot.TakenAt,
+			&snapshot.TotalFiles, &snapshot.CachedFiles, &snapshot.CachedBytes,
+			&snapshot.CacheHits, &snapshot.CacheMisses, &snapshot.DownloadedBytes, &snapshot.ServedBytes,
+			&snapshot.PendingTasks, &snapshot.InProgressTasks, &snapshot.FailedTasks, &snapshot.QueuedBytes,
+		); err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, rows.Err()
+}
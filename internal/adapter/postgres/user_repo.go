@@ -0,0 +1,209 @@
+package postgres
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+)
+
+const adminUserColumns = `id, username, password_hash, role, disabled, created_at, updated_at`
+
+// scanAdminUser scans an admin_users row
+func scanAdminUser(row interface{ Scan(...interface{}) error }) (*domain.AdminUser, error) {
+	user := &domain.AdminUser{}
+	err := row.Scan(
+		&user.ID, &user.Username, &user.PasswordHash, &user.Role,
+		&user.Disabled, &user.CreatedAt, &user.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// GetUserByID retrieves an admin user by ID
+func (s *Store) GetUserByID(id int64) (*domain.AdminUser, error) {
+	user, err := scanAdminUser(s.db.QueryRow(
+		`SELECT `+adminUserColumns+` FROM admin_users WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return user, err
+}
+
+// GetUserByUsername retrieves an admin user by username
+func (s *Store) GetUserByUsername(username string) (*domain.AdminUser, error) {
+	user, err := scanAdminUser(s.db.QueryRow(
+		`SELECT `+adminUserColumns+` FROM admin_users WHERE username = $1`, username))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return user, err
+}
+
+// ListUsers returns all admin users ordered by username
+func (s *Store) ListUsers() ([]*domain.AdminUser, error) {
+	rows, err := s.db.Query(`SELECT ` + adminUserColumns + ` FROM admin_users ORDER BY username`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*domain.AdminUser
+	for rows.Next() {
+		user, err := scanAdminUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// CreateUser creates a new admin user
+func (s *Store) CreateUser(user *domain.AdminUser) error {
+	now := time.Now()
+	err := s.db.QueryRow(`
+		INSERT INTO admin_users (username, password_hash, role, disabled, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`, user.Username, user.PasswordHash, user.Role, user.Disabled, now, now).Scan(&user.ID)
+	if err != nil {
+		if isUniqueConstraintError(err) {
+			return domain.ErrAlreadyExists
+		}
+		return err
+	}
+
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	return nil
+}
+
+// UpdateUser updates password hash, role and disabled flag of an admin user
+func (s *Store) UpdateUser(user *domain.AdminUser) error {
+	now := time.Now()
+	result, err := s.db.Exec(`
+		UPDATE admin_users SET password_hash = $1, role = $2, disabled = $3, updated_at = $4
+		WHERE id = $5
+	`, user.PasswordHash, user.Role, user.Disabled, now, user.ID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrNotFound
+	}
+
+	user.UpdatedAt = now
+	return nil
+}
+
+// DeleteUser deletes an admin user; their API tokens are removed by cascade
+func (s *Store) DeleteUser(id int64) error {
+	result, err := s.db.Exec(`DELETE FROM admin_users WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+const apiTokenColumns = `id, user_id, name, token_hash, prefix, created_at, last_used_at, expires_at, revoked`
+
+// scanAPIToken scans an api_tokens row
+func scanAPIToken(row interface{ Scan(...interface{}) error }) (*domain.APIToken, error) {
+	token := &domain.APIToken{}
+	err := row.Scan(
+		&token.ID, &token.UserID, &token.Name, &token.TokenHash, &token.Prefix,
+		&token.CreatedAt, &token.LastUsedAt, &token.ExpiresAt, &token.Revoked,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// CreateAPIToken stores a new API token
+func (s *Store) CreateAPIToken(token *domain.APIToken) error {
+	now := time.Now()
+	err := s.db.QueryRow(`
+		INSERT INTO api_tokens (user_id, name, token_hash, prefix, created_at, expires_at, revoked)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id
+	`, token.UserID, token.Name, token.TokenHash, token.Prefix, now, token.ExpiresAt, token.Revoked).Scan(&token.ID)
+	if err != nil {
+		if isUniqueConstraintError(err) {
+			return domain.ErrAlreadyExists
+		}
+		return err
+	}
+
+	token.CreatedAt = now
+	return nil
+}
+
+// GetAPITokenByHash retrieves an API token by the hash of its value
+func (s *Store) GetAPITokenByHash(tokenHash string) (*domain.APIToken, error) {
+	token, err := scanAPIToken(s.db.QueryRow(
+		`SELECT `+apiTokenColumns+` FROM api_tokens WHERE token_hash = $1`, tokenHash))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return token, err
+}
+
+// ListAPITokens returns the API tokens of a user, newest first
+func (s *Store) ListAPITokens(userID int64) ([]*domain.APIToken, error) {
+	rows, err := s.db.Query(
+		`SELECT `+apiTokenColumns+` FROM api_tokens WHERE user_id = $1 ORDER BY created_at DESC, id DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []*domain.APIToken
+	for rows.Next() {
+		token, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+// RevokeAPIToken marks an API token as revoked
+func (s *Store) RevokeAPIToken(id int64) error {
+	result, err := s.db.Exec(`UPDATE api_tokens SET revoked = TRUE WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+// TouchAPIToken records that an API token was just used
+func (s *Store) TouchAPIToken(id int64) error {
+	_, err := s.db.Exec(`UPDATE api_tokens SET last_used_at = $1 WHERE id = $2`, time.Now(), id)
+	return err
+}
@@ -0,0 +1,155 @@
+package replica
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+)
+
+// objectsPath is where a standby instance serves the objects it receives
+const objectsPath = "/api/v1/replica/objects"
+
+// HTTP is a replica kept by another synology-file-cache instance, which
+// stores the objects it receives under /api/v1/replica/objects. Requests
+// carry an API token of an admin on that instance. It implements
+// port.ReplicaStore.
+type HTTP struct {
+	baseURL string
+	token   string
+	client  *http.Client
+}
+
+// NewHTTP creates an HTTP replica for the instance at baseURL
+// (e.g. https://standby.example.com:8080). A nil client uses http.DefaultClient.
+func NewHTTP(baseURL, token string, client *http.Client) (*HTTP, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid replica URL %q", baseURL)
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &HTTP{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		token:   token,
+		client:  client,
+	}, nil
+}
+
+// objectURL returns the URL of an object
+func (h *HTTP) objectURL(key string) (string, error) {
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+	segments := strings.Split(key, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return h.baseURL + objectsPath + "/" + strings.Join(segments, "/"), nil
+}
+
+// do sends a request with the API token
+func (h *HTTP) do(ctx context.Context, method, target string, body io.Reader, size int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+	if h.token != "" {
+		req.Header.Set("Authorization", "Bearer "+h.token)
+	}
+	return h.client.Do(req)
+}
+
+// statusError describes an unexpected response
+func statusError(method string, resp *http.Response) error {
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("replica %s: HTTP %d: %s", method, resp.StatusCode, strings.TrimSpace(string(msg)))
+}
+
+// Put stores size bytes read from body under key
+func (h *HTTP) Put(ctx context.Context, key string, body io.Reader, size int64) error {
+	target, err := h.objectURL(key)
+	if err != nil {
+		return err
+	}
+	if size == 0 {
+		body = http.NoBody
+	}
+	resp, err := h.do(ctx, http.MethodPut, target, body, size)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return statusError("PUT", resp)
+	}
+	return nil
+}
+
+// Get opens the object stored under key
+func (h *HTTP) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	target, err := h.objectURL(key)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := h.do(ctx, http.MethodGet, target, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		resp.Body.Close()
+		return nil, domain.ErrNotFound
+	case resp.StatusCode != http.StatusOK:
+		defer resp.Body.Close()
+		return nil, statusError("GET", resp)
+	}
+	return resp.Body, nil
+}
+
+// Delete removes the object stored under key
+func (h *HTTP) Delete(ctx context.Context, key string) error {
+	target, err := h.objectURL(key)
+	if err != nil {
+		return err
+	}
+	resp, err := h.do(ctx, http.MethodDelete, target, nil, 0)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 && resp.StatusCode != http.StatusNotFound {
+		return statusError("DELETE", resp)
+	}
+	return nil
+}
+
+// List returns the keys of all objects starting with prefix
+func (h *HTTP) List(ctx context.Context, prefix string) ([]string, error) {
+	resp, err := h.do(ctx, http.MethodGet, h.baseURL+objectsPath+"?prefix="+url.QueryEscape(prefix), nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError("list", resp)
+	}
+
+	var list struct {
+		Keys []string `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("failed to decode replica list: %w", err)
+	}
+	return list.Keys, nil
+}
@@ -0,0 +1,32 @@
+package replica
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+)
+
+// ValidKey reports whether key is a relative slash-separated object key
+// without empty, "." or ".." segments or segments starting with a dot,
+// so it can be mapped onto a directory safely
+func ValidKey(key string) bool {
+	if key == "" || strings.ContainsAny(key, "\\\x00") {
+		return false
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || strings.HasPrefix(segment, ".") {
+			return false
+		}
+	}
+	return true
+}
+
+// checkKey returns an error wrapping domain.ErrInvalidInput for keys
+// ValidKey rejects
+func checkKey(key string) error {
+	if !ValidKey(key) {
+		return fmt.Errorf("%w: replica key %q", domain.ErrInvalidInput, key)
+	}
+	return nil
+}
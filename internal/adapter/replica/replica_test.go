@@ -0,0 +1,239 @@
+package replica
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/port"
+)
+
+// testStoreRoundTrip exercises all operations of a store
+func testStoreRoundTrip(t *testing.T, store port.ReplicaStore) {
+	t.Helper()
+	ctx := context.Background()
+
+	objects := map[string]string{
+		"files/1":           "first",
+		"files/2":           "",
+		"meta/files/1.json": `{"id":1}`,
+	}
+	for key, content := range objects {
+		if err := store.Put(ctx, key, strings.NewReader(content), int64(len(content))); err != nil {
+			t.Fatalf("Put(%s) error = %v", key, err)
+		}
+	}
+
+	rc, err := store.Get(ctx, "files/1")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	got, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(got) != "first" {
+		t.Errorf("Get() = %q, want first", got)
+	}
+	if _, err := store.Get(ctx, "files/3"); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("Get(missing) error = %v, want ErrNotFound", err)
+	}
+
+	keys, err := store.List(ctx, "files/")
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	sort.Strings(keys)
+	if strings.Join(keys, ",") != "files/1,files/2" {
+		t.Errorf("List(files/) = %v", keys)
+	}
+
+	if err := store.Delete(ctx, "files/1"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if err := store.Delete(ctx, "files/1"); err != nil {
+		t.Errorf("Delete(missing) error = %v", err)
+	}
+	if keys, _ := store.List(ctx, ""); len(keys) != 2 {
+		t.Errorf("List() after Delete = %v, want 2 keys", keys)
+	}
+
+	if err := store.Put(ctx, "../escape", strings.NewReader("x"), 1); err == nil {
+		t.Error("Put(../escape) error = nil")
+	}
+}
+
+func TestDir(t *testing.T) {
+	store, err := NewDir(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDir() error = %v", err)
+	}
+	testStoreRoundTrip(t, store)
+
+	// Short bodies are not stored
+	if err := store.Put(context.Background(), "files/short", strings.NewReader("abc"), 10); err == nil {
+		t.Error("Put(short body) error = nil")
+	}
+	if keys, _ := store.List(context.Background(), "files/short"); len(keys) != 0 {
+		t.Errorf("List() after failed Put = %v", keys)
+	}
+}
+
+func TestHTTP(t *testing.T) {
+	dir, err := NewDir(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDir() error = %v", err)
+	}
+	// A minimal receiving instance
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		key := strings.TrimPrefix(r.URL.Path, objectsPath+"/")
+		switch {
+		case r.URL.Path == objectsPath:
+			keys, _ := dir.List(r.Context(), r.URL.Query().Get("prefix"))
+			json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+		case r.Method == http.MethodPut:
+			if err := dir.Put(r.Context(), key, r.Body, r.ContentLength); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			}
+		case r.Method == http.MethodGet:
+			rc, err := dir.Get(r.Context(), key)
+			if err != nil {
+				http.Error(w, "not found", http.StatusNotFound)
+				return
+			}
+			defer rc.Close()
+			io.Copy(w, rc)
+		case r.Method == http.MethodDelete:
+			dir.Delete(r.Context(), key)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer srv.Close()
+
+	store, err := NewHTTP(srv.URL+"/", "secret", srv.Client())
+	if err != nil {
+		t.Fatalf("NewHTTP() error = %v", err)
+	}
+	testStoreRoundTrip(t, store)
+
+	bad, _ := NewHTTP(srv.URL, "wrong", srv.Client())
+	if err := bad.Put(context.Background(), "files/x", strings.NewReader("x"), 1); err == nil {
+		t.Error("Put() with a wrong token error = nil")
+	}
+}
+
+// fakeS3 is an in-memory S3 bucket served path-style, listing one key per page
+type fakeS3 struct {
+	mu      sync.Mutex
+	bucket  string
+	objects map[string][]byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AK/") ||
+		r.Header.Get("X-Amz-Date") == "" || r.Header.Get("X-Amz-Content-Sha256") == "" {
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, "<Error><Code>AccessDenied</Code><Message>unsigned</Message></Error>")
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/"+f.bucket)
+	key := strings.TrimPrefix(path, "/")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case path == "/" && r.URL.Query().Get("list-type") == "2":
+		var keys []string
+		for k := range f.objects {
+			if strings.HasPrefix(k, r.URL.Query().Get("prefix")) && k > r.URL.Query().Get("continuation-token") {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		var result struct {
+			XMLName  xml.Name `xml:"ListBucketResult"`
+			Contents []struct {
+				Key string `xml:"Key"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken,omitempty"`
+		}
+		if len(keys) > 0 {
+			result.Contents = append(result.Contents, struct {
+				Key string `xml:"Key"`
+			}{keys[0]})
+			result.IsTruncated = len(keys) > 1
+			if result.IsTruncated {
+				result.NextContinuationToken = keys[0]
+			}
+		}
+		xml.NewEncoder(w).Encode(result)
+	case r.Method == http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		f.objects[key] = body
+	case r.Method == http.MethodGet:
+		body, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(body)
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestS3(t *testing.T) {
+	fake := &fakeS3{bucket: "cache", objects: map[string][]byte{}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	store, err := NewS3(S3Config{
+		Endpoint:  srv.URL,
+		Bucket:    "cache",
+		Prefix:    "site-a/",
+		AccessKey: "AK",
+		SecretKey: "SK",
+		PathStyle: true,
+	}, srv.Client())
+	if err != nil {
+		t.Fatalf("NewS3() error = %v", err)
+	}
+	testStoreRoundTrip(t, store)
+
+	if !bytes.Equal(fake.objects["site-a/meta/files/1.json"], []byte(`{"id":1}`)) {
+		t.Errorf("objects = %v, want keys under the prefix", fake.objects)
+	}
+
+	unsigned, _ := NewS3(S3Config{Endpoint: srv.URL, Bucket: "cache", AccessKey: "other", SecretKey: "SK", PathStyle: true}, srv.Client())
+	if err := unsigned.Put(context.Background(), "files/x", strings.NewReader("x"), 1); err == nil || !strings.Contains(err.Error(), "AccessDenied") {
+		t.Errorf("Put() with other credentials error = %v, want AccessDenied", err)
+	}
+}
+
+func TestNewS3_VirtualHosted(t *testing.T) {
+	store, err := NewS3(S3Config{Endpoint: "https://s3.eu-central-1.amazonaws.com", Region: "eu-central-1", Bucket: "cache", AccessKey: "AK", SecretKey: "SK"}, nil)
+	if err != nil {
+		t.Fatalf("NewS3() error = %v", err)
+	}
+	u, err := store.objectURL("files/a b")
+	if err != nil {
+		t.Fatalf("objectURL() error = %v", err)
+	}
+	if got := u.String(); got != "https://cache.s3.eu-central-1.amazonaws.com/files/a%20b" {
+		t.Errorf("objectURL() = %s", got)
+	}
+}
@@ -0,0 +1,221 @@
+package replica
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+)
+
+// S3Config contains the settings of an S3-compatible bucket
+type S3Config struct {
+	Endpoint  string // e.g. https://s3.eu-central-1.amazonaws.com or https://minio.example.com:9000
+	Region    string // Signing region; "us-east-1" for most S3-compatible stores
+	Bucket    string
+	Prefix    string // Prepended to all object keys, e.g. "cache/"
+	AccessKey string
+	SecretKey string
+
+	// PathStyle addresses the bucket in the path (endpoint/bucket/key) instead
+	// of the host name (bucket.endpoint/key); MinIO and most S3-compatible
+	// stores need it
+	PathStyle bool
+}
+
+// S3 is a replica stored in an S3-compatible bucket. Requests are signed
+// with AWS Signature Version 4; uploads are streamed unsigned, so use an
+// HTTPS endpoint. It implements port.ReplicaStore.
+type S3 struct {
+	base   *url.URL // Bucket URL
+	prefix string
+	signer *signer
+	client *http.Client
+	now    func() time.Time
+}
+
+// NewS3 creates an S3 replica for the bucket in cfg. A nil client uses
+// http.DefaultClient.
+func NewS3(cfg S3Config, client *http.Client) (*S3, error) {
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", cfg.Endpoint)
+	}
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("S3 bucket is required")
+	}
+	if cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return nil, fmt.Errorf("S3 access key and secret key are required")
+	}
+	region := cfg.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	base := &url.URL{Scheme: endpoint.Scheme, Host: endpoint.Host, Path: strings.TrimRight(endpoint.Path, "/")}
+	if cfg.PathStyle {
+		base.Path += "/" + cfg.Bucket
+	} else {
+		base.Host = cfg.Bucket + "." + endpoint.Host
+	}
+
+	return &S3{
+		base:   base,
+		prefix: cfg.Prefix,
+		signer: &signer{accessKey: cfg.AccessKey, secretKey: cfg.SecretKey, region: region},
+		client: client,
+		now:    time.Now,
+	}, nil
+}
+
+// objectURL returns the URL of an object
+func (s *S3) objectURL(key string) (*url.URL, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	return url.Parse(s.base.String() + "/" + uriEncode(s.prefix+key, false))
+}
+
+// do signs and sends a request
+func (s *S3) do(ctx context.Context, method string, u *url.URL, body io.Reader, size int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	payloadHash := emptyPayload
+	if body != nil && body != http.NoBody {
+		req.ContentLength = size
+		payloadHash = unsignedPayload
+	}
+	s.signer.sign(req, payloadHash, s.now())
+	return s.client.Do(req)
+}
+
+// s3Error describes an error response
+func s3Error(op string, resp *http.Response) error {
+	var body struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if xml.Unmarshal(data, &body) == nil && body.Code != "" {
+		return fmt.Errorf("S3 %s: HTTP %d: %s: %s", op, resp.StatusCode, body.Code, body.Message)
+	}
+	return fmt.Errorf("S3 %s: HTTP %d", op, resp.StatusCode)
+}
+
+// Put stores size bytes read from body under key
+func (s *S3) Put(ctx context.Context, key string, body io.Reader, size int64) error {
+	u, err := s.objectURL(key)
+	if err != nil {
+		return err
+	}
+	if size == 0 {
+		body = http.NoBody
+	}
+	resp, err := s.do(ctx, http.MethodPut, u, body, size)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return s3Error("PUT", resp)
+	}
+	return nil
+}
+
+// Get opens the object stored under key
+func (s *S3) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	u, err := s.objectURL(key)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(ctx, http.MethodGet, u, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		resp.Body.Close()
+		return nil, domain.ErrNotFound
+	case resp.StatusCode != http.StatusOK:
+		defer resp.Body.Close()
+		return nil, s3Error("GET", resp)
+	}
+	return resp.Body, nil
+}
+
+// Delete removes the object stored under key
+func (s *S3) Delete(ctx context.Context, key string) error {
+	u, err := s.objectURL(key)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(ctx, http.MethodDelete, u, nil, 0)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 && resp.StatusCode != http.StatusNotFound {
+		return s3Error("DELETE", resp)
+	}
+	return nil
+}
+
+// listResult is the part of a ListObjectsV2 response that is used
+type listResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// List returns the keys of all objects starting with prefix, following
+// ListObjectsV2 pagination
+func (s *S3) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	token := ""
+	for {
+		query := "list-type=2&prefix=" + uriEncode(s.prefix+prefix, true)
+		if token != "" {
+			query += "&continuation-token=" + uriEncode(token, true)
+		}
+		u := *s.base
+		u.Path += "/"
+		u.RawPath = ""
+		u.RawQuery = query
+
+		resp, err := s.do(ctx, http.MethodGet, &u, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			err := s3Error("list", resp)
+			resp.Body.Close()
+			return nil, err
+		}
+		var result listResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode S3 list: %w", err)
+		}
+
+		for _, c := range result.Contents {
+			keys = append(keys, strings.TrimPrefix(c.Key, s.prefix))
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return keys, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
@@ -0,0 +1,124 @@
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+)
+
+// auditTimeFormat matches CURRENT_TIMESTAMP so julianday() can compare filter bounds
+const auditTimeFormat = "2006-01-02 15:04:05"
+
+// RecordAuditEvent appends an event to the audit log
+func (s *Store) RecordAuditEvent(event *domain.AuditEvent) error {
+	var details sql.NullString
+	if len(event.Details) > 0 {
+		encoded, err := json.Marshal(event.Details)
+		if err != nil {
+			return err
+		}
+		details = sql.NullString{String: string(encoded), Valid: true}
+	}
+
+	result, err := s.exec(`
+		INSERT INTO audit_events (actor, action, target, remote_addr, details)
+		VALUES (?, ?, ?, ?, ?)
+	`, event.Actor, event.Action, event.Target, event.RemoteAddr, details)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	event.ID = id
+	return nil
+}
+
+// ListAuditEvents returns events matching the filter, newest first
+func (s *Store) ListAuditEvents(filter domain.AuditFilter, limit, offset int) ([]*domain.AuditEvent, error) {
+	query := `
+		SELECT id, created_at, actor, action, target, remote_addr, details
+		FROM audit_events
+		WHERE 1=1
+	`
+	var args []interface{}
+
+	if filter.Actor != "" {
+		query += " AND actor = ?"
+		args = append(args, filter.Actor)
+	}
+	if filter.Action != "" {
+		if strings.HasSuffix(filter.Action, ".") {
+			query += " AND substr(action, 1, ?) = ?"
+			args = append(args, len(filter.Action), filter.Action)
+		} else {
+			query += " AND action = ?"
+			args = append(args, filter.Action)
+		}
+	}
+	if filter.Target != "" {
+		query += " AND target = ?"
+		args = append(args, filter.Target)
+	}
+	if filter.Since != nil {
+		query += " AND julianday(created_at) >= julianday(?)"
+		args = append(args, filter.Since.UTC().Format(auditTimeFormat))
+	}
+	if filter.Until != nil {
+		query += " AND julianday(created_at) < julianday(?)"
+		args = append(args, filter.Until.UTC().Format(auditTimeFormat))
+	}
+
+	query += " ORDER BY id DESC LIMIT ? OFFSET ?"
+	args = append(args, limit, offset)
+
+	rows, err := s.rdb.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*domain.AuditEvent
+	for rows.Next() {
+		event := &domain.AuditEvent{}
+		var target, remoteAddr, details sql.NullString
+
+		if err := rows.Scan(
+			&event.ID, &event.CreatedAt, &event.Actor, &event.Action,
+			&target, &remoteAddr, &details,
+		); err != nil {
+			return nil, err
+		}
+
+		event.Target = target.String
+		event.RemoteAddr = remoteAddr.String
+		if details.Valid && details.String != "" {
+			if err := json.Unmarshal([]byte(details.String), &event.Details); err != nil {
+				return nil, err
+			}
+		}
+
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+// DeleteAuditEventsBefore removes events older than the given age
+func (s *Store) DeleteAuditEventsBefore(maxAge time.Duration) (int, error) {
+	result, err := s.exec(
+		"DELETE FROM audit_events WHERE julianday(created_at) < julianday('now') - ? / 86400.0",
+		maxAge.Seconds())
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := result.RowsAffected()
+	return int(count), err
+}
@@ -0,0 +1,91 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Backup writes a consistent copy of the database to destPath using VACUUM INTO.
+// It runs as a read transaction, so the service keeps working during the backup.
+// destPath must not exist.
+func (s *Store) Backup(destPath string) error {
+	if _, err := s.db.Exec("VACUUM INTO ?", destPath); err != nil {
+		return fmt.Errorf("failed to back up database: %w", err)
+	}
+	return nil
+}
+
+// Restore replaces the database at dbPath with a backup.
+// The backup is integrity checked first. The service must not be running,
+// since open connections would keep using the old database and WAL.
+func Restore(backupPath, dbPath string) error {
+	if err := checkIntegrity(backupPath); err != nil {
+		return err
+	}
+
+	src, err := os.Open(backupPath)
+	if err != nil {
+		return fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer src.Close()
+
+	tmpPath := dbPath + ".restoring"
+	dst, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to create restore file: %w", err)
+	}
+
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to copy backup: %w", err)
+	}
+	if err := dst.Sync(); err != nil {
+		dst.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to sync restore file: %w", err)
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to close restore file: %w", err)
+	}
+
+	// A leftover WAL would be replayed on top of the restored database
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Remove(dbPath + suffix); err != nil && !os.IsNotExist(err) {
+			os.Remove(tmpPath)
+			return fmt.Errorf("failed to remove %s: %w", dbPath+suffix, err)
+		}
+	}
+
+	if err := os.Rename(tmpPath, dbPath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to replace database: %w", err)
+	}
+
+	return nil
+}
+
+// checkIntegrity verifies that path is an intact SQLite database
+func checkIntegrity(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("backup not found: %w", err)
+	}
+
+	db, err := sql.Open("sqlite", "file:"+path+"?mode=ro")
+	if err != nil {
+		return fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer db.Close()
+
+	var result string
+	if err := db.QueryRow("PRAGMA integrity_check").Scan(&result); err != nil {
+		return fmt.Errorf("backup is not a valid database: %w", err)
+	}
+	if result != "ok" {
+		return fmt.Errorf("backup failed integrity check: %s", result)
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+package sqlite
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/vertextoedge/synology-file-cache/internal/testutil/storetest"
+)
+
+func TestStoreContract(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) (storetest.Store, func() storetest.Store) {
+		path := filepath.Join(t.TempDir(), "cache.db")
+		open := func() storetest.Store { return openTestStore(t, path) }
+		return open(), open
+	})
+}
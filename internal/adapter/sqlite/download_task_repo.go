@@ -1,7 +1,9 @@
 package sqlite
 
 import (
+	"context"
 	"database/sql"
+	"math"
 	"strings"
 	"time"
 
@@ -16,7 +18,7 @@ func (s *Store) CreateTask(task *domain.DownloadTask) error {
 		) VALUES (?, ?, ?, ?, 'pending', ?)
 	`
 
-	result, err := s.db.Exec(query,
+	result, err := s.exec(query,
 		task.FileID, task.SynoPath, task.Priority, task.Size, task.MaxRetries)
 	if err != nil {
 		if isUniqueConstraintError(err) {
@@ -32,78 +34,129 @@ func (s *Store) CreateTask(task *domain.DownloadTask) error {
 
 	task.ID = id
 	task.Status = domain.TaskStatusPending
+	s.queued.Notify()
 	return nil
 }
 
-// ClaimNextTask atomically claims the next pending task for a worker
+// TasksQueued returns a channel closed when tasks may have become claimable
+func (s *Store) TasksQueued() <-chan struct{} {
+	return s.queued.C()
+}
+
+// ClaimNextTask atomically claims the next pending task for a worker.
+// BEGIN IMMEDIATE serialises claims of all processes sharing the database file,
+// so two instances never claim the same task.
 func (s *Store) ClaimNextTask(workerID string) (*domain.DownloadTask, error) {
-	tx, err := s.db.Begin()
-	if err != nil {
+	return s.ClaimNextTaskUpTo(workerID, math.MaxInt32)
+}
+
+// ClaimNextTaskUpTo claims the next pending task with priority <= maxPriority
+func (s *Store) ClaimNextTaskUpTo(workerID string, maxPriority int) (*domain.DownloadTask, error) {
+	tasks, err := s.ClaimNextTasksUpTo(workerID, 1, 0, maxPriority)
+	if err != nil || len(tasks) == 0 {
 		return nil, err
 	}
-	defer tx.Rollback()
+	return tasks[0], nil
+}
 
-	// Select next task to claim
-	selectQuery := `
-		SELECT id, file_id, syno_path, priority, size, status,
-			   temp_file_path, bytes_downloaded, retry_count, max_retries,
-			   last_error, created_at, updated_at
-		FROM download_tasks
-		WHERE status = 'pending'
-		  AND (next_retry_at IS NULL OR next_retry_at <= datetime('now'))
-		ORDER BY priority ASC, size ASC
-		LIMIT 1
-	`
+// ClaimNextTasks claims up to n pending tasks in queue order in one transaction
+func (s *Store) ClaimNextTasks(workerID string, n int, maxTotalBytes int64) ([]*domain.DownloadTask, error) {
+	return s.ClaimNextTasksUpTo(workerID, n, maxTotalBytes, math.MaxInt32)
+}
 
-	task := &domain.DownloadTask{}
-	var tempPath, lastError sql.NullString
+// ClaimNextTasksUpTo claims up to n pending tasks with priority <= maxPriority,
+// stopping before the task that would bring their total size over maxTotalBytes
+func (s *Store) ClaimNextTasksUpTo(workerID string, n int, maxTotalBytes int64, maxPriority int) ([]*domain.DownloadTask, error) {
+	if n < 1 {
+		n = 1
+	}
+	var tasks []*domain.DownloadTask
 
-	err = tx.QueryRow(selectQuery).Scan(
-		&task.ID, &task.FileID, &task.SynoPath, &task.Priority, &task.Size,
-		&task.Status, &tempPath, &task.BytesDownloaded,
-		&task.RetryCount, &task.MaxRetries, &lastError,
-		&task.CreatedAt, &task.UpdatedAt,
-	)
+	err := s.withImmediateTx(func(ctx context.Context, conn *sql.Conn) error {
+		// Select next tasks to claim
+		selectQuery := `
+			SELECT id, file_id, syno_path, priority, size, status,
+				   temp_file_path, bytes_downloaded, retry_count, max_retries,
+				   last_error, created_at, updated_at
+			FROM download_tasks
+			WHERE status = 'pending'
+			  AND priority <= ?
+			  AND (next_retry_at IS NULL OR next_retry_at <= datetime('now'))
+			ORDER BY priority ASC, size ASC
+			LIMIT ?
+		`
 
-	if err == sql.ErrNoRows {
-		return nil, nil
-	}
-	if err != nil {
-		return nil, err
-	}
+		rows, err := conn.QueryContext(ctx, selectQuery, maxPriority, n)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		var total int64
+		for rows.Next() {
+			candidate := &domain.DownloadTask{}
+			var tempPath, lastError sql.NullString
+
+			if err := rows.Scan(
+				&candidate.ID, &candidate.FileID, &candidate.SynoPath, &candidate.Priority, &candidate.Size,
+				&candidate.Status, &tempPath, &candidate.BytesDownloaded,
+				&candidate.RetryCount, &candidate.MaxRetries, &lastError,
+				&candidate.CreatedAt, &candidate.UpdatedAt,
+			); err != nil {
+				return err
+			}
 
-	if tempPath.Valid {
-		task.TempFilePath = tempPath.String
-	}
-	if lastError.Valid {
-		task.LastError = lastError.String
-	}
+			// The first task is claimed whatever its size
+			if len(tasks) > 0 && maxTotalBytes > 0 && total+candidate.Size > maxTotalBytes {
+				break
+			}
+			total += candidate.Size
 
-	// Claim the task
-	updateQuery := `
-		UPDATE download_tasks
-		SET status = 'in_progress',
-			worker_id = ?,
-			claimed_at = datetime('now'),
-			updated_at = datetime('now')
-		WHERE id = ?
-	`
+			if tempPath.Valid {
+				candidate.TempFilePath = tempPath.String
+			}
+			if lastError.Valid {
+				candidate.LastError = lastError.String
+			}
+			tasks = append(tasks, candidate)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		rows.Close()
+		if len(tasks) == 0 {
+			return nil
+		}
 
-	_, err = tx.Exec(updateQuery, workerID, task.ID)
-	if err != nil {
-		return nil, err
-	}
+		// Claim the tasks
+		ids := make([]any, 0, len(tasks)+1)
+		ids = append(ids, workerID)
+		for _, task := range tasks {
+			ids = append(ids, task.ID)
+		}
+		updateQuery := `
+			UPDATE download_tasks
+			SET status = 'in_progress',
+				worker_id = ?,
+				claimed_at = datetime('now'),
+				updated_at = datetime('now')
+			WHERE id IN (` + strings.Repeat("?, ", len(tasks)-1) + `?) AND status = 'pending'
+		`
 
-	if err := tx.Commit(); err != nil {
+		_, err = conn.ExecContext(ctx, updateQuery, ids...)
+		return err
+	})
+	if err != nil {
 		return nil, err
 	}
 
-	task.Status = domain.TaskStatusInProgress
-	task.WorkerID = workerID
 	now := time.Now()
-	task.ClaimedAt = &now
-
-	return task, nil
+	for _, task := range tasks {
+		task.Status = domain.TaskStatusInProgress
+		task.WorkerID = workerID
+		task.ClaimedAt = &now
+	}
+	return tasks, nil
 }
 
 // GetTask retrieves a task by ID
@@ -177,7 +230,7 @@ func (s *Store) UpdateTask(task *domain.DownloadTask) error {
 		claimedAt = sql.NullTime{Time: *task.ClaimedAt, Valid: true}
 	}
 
-	_, err := s.db.Exec(query,
+	_, err := s.exec(query,
 		task.Status, workerID, tempPath, task.BytesDownloaded,
 		task.RetryCount, nextRetryAt, lastError, claimedAt, task.ID)
 
@@ -192,13 +245,13 @@ func (s *Store) UpdateProgress(taskID int64, bytesDownloaded int64, tempPath str
 		WHERE id = ?
 	`
 
-	_, err := s.db.Exec(query, bytesDownloaded, tempPath, taskID)
+	_, err := s.exec(query, bytesDownloaded, tempPath, taskID)
 	return err
 }
 
 // CompleteTask removes a completed task
 func (s *Store) CompleteTask(taskID int64) error {
-	_, err := s.db.Exec("DELETE FROM download_tasks WHERE id = ?", taskID)
+	_, err := s.exec("DELETE FROM download_tasks WHERE id = ?", taskID)
 	return err
 }
 
@@ -231,7 +284,7 @@ func (s *Store) FailTask(taskID int64, errMsg string, canRetry bool) error {
 				updated_at = datetime('now')
 			WHERE id = ?
 		`
-		_, err = s.db.Exec(query, nextRetry, errMsg, taskID)
+		_, err = s.exec(query, nextRetry, errMsg, taskID)
 		return err
 	}
 
@@ -243,10 +296,26 @@ func (s *Store) FailTask(taskID int64, errMsg string, canRetry bool) error {
 			updated_at = datetime('now')
 		WHERE id = ?
 	`
-	_, err := s.db.Exec(query, errMsg, taskID)
+	_, err := s.exec(query, errMsg, taskID)
 	return err
 }
 
+// ReleaseTask returns an in-progress task to pending without counting a retry
+func (s *Store) ReleaseTask(taskID int64) error {
+	query := `
+		UPDATE download_tasks
+		SET status = 'pending', worker_id = NULL, claimed_at = NULL,
+			updated_at = datetime('now')
+		WHERE id = ? AND status = 'in_progress'
+	`
+
+	if _, err := s.exec(query, taskID); err != nil {
+		return err
+	}
+	s.queued.Notify()
+	return nil
+}
+
 // ReleaseStaleInProgressTasks resets tasks stuck in in_progress state
 func (s *Store) ReleaseStaleInProgressTasks(staleDuration time.Duration) (int, error) {
 	cutoff := time.Now().Add(-staleDuration)
@@ -258,7 +327,45 @@ func (s *Store) ReleaseStaleInProgressTasks(staleDuration time.Duration) (int, e
 		WHERE status = 'in_progress' AND claimed_at < ?
 	`
 
-	result, err := s.db.Exec(query, cutoff)
+	result, err := s.exec(query, cutoff)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := result.RowsAffected()
+	if count > 0 {
+		s.queued.Notify()
+	}
+	return int(count), err
+}
+
+// RenewTaskLease refreshes claimed_at of an in-progress task held by workerID
+func (s *Store) RenewTaskLease(taskID int64, workerID string) (bool, error) {
+	query := `
+		UPDATE download_tasks
+		SET claimed_at = datetime('now')
+		WHERE id = ? AND worker_id = ? AND status = 'in_progress'
+	`
+
+	result, err := s.exec(query, taskID, workerID)
+	if err != nil {
+		return false, err
+	}
+
+	count, err := result.RowsAffected()
+	return count > 0, err
+}
+
+// ReleaseWorkerTasks resets in_progress tasks whose worker_id starts with prefix
+func (s *Store) ReleaseWorkerTasks(workerPrefix string) (int, error) {
+	query := `
+		UPDATE download_tasks
+		SET status = 'pending', worker_id = NULL, claimed_at = NULL,
+			updated_at = datetime('now')
+		WHERE status = 'in_progress' AND substr(worker_id, 1, length(?)) = ?
+	`
+
+	result, err := s.exec(query, workerPrefix, workerPrefix)
 	if err != nil {
 		return 0, err
 	}
@@ -267,6 +374,46 @@ func (s *Store) ReleaseStaleInProgressTasks(staleDuration time.Duration) (int, e
 	return int(count), err
 }
 
+// BoostAgedTasks raises the priority of pending tasks waiting longer than age.
+// Aging stops at the starred level so waiting never puts a task ahead of shared files.
+func (s *Store) BoostAgedTasks(age time.Duration) (int, error) {
+	// julianday() keeps the comparison independent of the Go time format
+	query := `
+		UPDATE download_tasks
+		SET priority = priority - 1, aged_at = datetime('now'),
+			updated_at = datetime('now')
+		WHERE status = 'pending' AND priority > 2
+		  AND julianday(COALESCE(aged_at, created_at)) <= julianday('now') - ? / 86400.0
+	`
+
+	result, err := s.exec(query, age.Seconds())
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := result.RowsAffected()
+	return int(count), err
+}
+
+// BoostTaskPriority raises the priority of a file's pending task if it is less urgent
+func (s *Store) BoostTaskPriority(fileID int64, priority int) (bool, error) {
+	result, err := s.exec(`
+		UPDATE download_tasks
+		SET priority = ?, updated_at = datetime('now')
+		WHERE file_id = ? AND status = 'pending' AND priority > ?
+	`, priority, fileID, priority)
+	if err != nil {
+		return false, err
+	}
+
+	// Outside download windows a boosted task may be claimable now
+	count, err := result.RowsAffected()
+	if count > 0 {
+		s.queued.Notify()
+	}
+	return count > 0, err
+}
+
 // GetQueueStats returns queue statistics
 func (s *Store) GetQueueStats() (*domain.QueueStats, error) {
 	stats := &domain.QueueStats{}
@@ -312,7 +459,7 @@ func (s *Store) GetQueueStats() (*domain.QueueStats, error) {
 func (s *Store) CleanupOldFailedTasks(olderThan time.Duration) (int, error) {
 	cutoff := time.Now().Add(-olderThan)
 
-	result, err := s.db.Exec(
+	result, err := s.exec(
 		"DELETE FROM download_tasks WHERE status = 'failed' AND updated_at < ?",
 		cutoff)
 	if err != nil {
@@ -342,9 +489,103 @@ func (s *Store) GetOversizedTasks(maxSize int64) ([]*domain.DownloadTask, error)
 	return s.scanTasks(rows)
 }
 
+// ListTasksByStatus returns tasks with the given status, most recently updated first
+func (s *Store) ListTasksByStatus(status string, limit, offset int) ([]*domain.DownloadTask, error) {
+	query := `
+		SELECT id, file_id, syno_path, priority, size, status, worker_id,
+			   temp_file_path, bytes_downloaded, retry_count, max_retries,
+			   next_retry_at, last_error, created_at, claimed_at, updated_at
+		FROM download_tasks
+		WHERE status = ?
+		ORDER BY updated_at DESC, id DESC
+		LIMIT ? OFFSET ?
+	`
+
+	rows, err := s.db.Query(query, status, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return s.scanTasks(rows)
+}
+
+// RetryFailedTask resets a failed task to pending with a fresh retry budget
+func (s *Store) RetryFailedTask(taskID int64) error {
+	query := `
+		UPDATE download_tasks
+		SET status = 'pending', retry_count = 0, next_retry_at = NULL,
+			worker_id = NULL, claimed_at = NULL, updated_at = datetime('now')
+		WHERE id = ? AND status = 'failed'
+		  AND NOT EXISTS (
+			SELECT 1 FROM download_tasks a
+			WHERE a.file_id = download_tasks.file_id
+			  AND a.status IN ('pending', 'in_progress')
+		  )
+	`
+
+	result, err := s.exec(query, taskID)
+	if err != nil {
+		return err
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		s.queued.Notify()
+		return nil
+	}
+
+	// Distinguish a missing task from one blocked by an active task
+	task, err := s.GetTask(taskID)
+	if err != nil {
+		return err
+	}
+	if task == nil || task.Status != domain.TaskStatusFailed {
+		return domain.ErrNotFound
+	}
+	return domain.ErrAlreadyExists
+}
+
+// RetryFailedTasks resets all failed tasks matching the filter to pending
+func (s *Store) RetryFailedTasks(filter domain.FailedTaskFilter) (int, error) {
+	query := `
+		UPDATE download_tasks
+		SET status = 'pending', retry_count = 0, next_retry_at = NULL,
+			worker_id = NULL, claimed_at = NULL, updated_at = datetime('now')
+		WHERE status = 'failed'
+		  AND (? = '' OR instr(COALESCE(last_error, ''), ?) > 0)
+		  AND (? = '' OR substr(syno_path, 1, length(?)) = ?)
+		  AND id = (
+			SELECT MAX(f.id) FROM download_tasks f
+			WHERE f.file_id = download_tasks.file_id AND f.status = 'failed'
+		  )
+		  AND NOT EXISTS (
+			SELECT 1 FROM download_tasks a
+			WHERE a.file_id = download_tasks.file_id
+			  AND a.status IN ('pending', 'in_progress')
+		  )
+	`
+
+	result, err := s.exec(query,
+		filter.ErrorContains, filter.ErrorContains,
+		filter.PathPrefix, filter.PathPrefix, filter.PathPrefix)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := result.RowsAffected()
+	if count > 0 {
+		s.queued.Notify()
+	}
+	return int(count), err
+}
+
 // DeleteTask removes a task by ID
 func (s *Store) DeleteTask(taskID int64) error {
-	_, err := s.db.Exec("DELETE FROM download_tasks WHERE id = ?", taskID)
+	_, err := s.exec("DELETE FROM download_tasks WHERE id = ?", taskID)
 	return err
 }
 
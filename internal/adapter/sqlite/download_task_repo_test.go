@@ -0,0 +1,121 @@
+package sqlite
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+)
+
+// closed reports whether a TasksQueued channel has fired
+func closed(c <-chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestStore_TasksQueued(t *testing.T) {
+	s := openTestStore(t, filepath.Join(t.TempDir(), "cache.db"))
+	file := cacheTestFile(t, s, "a")
+
+	queued := s.TasksQueued()
+	if closed(queued) {
+		t.Fatal("TasksQueued fired before any task was queued")
+	}
+	if err := s.CreateTask(&domain.DownloadTask{FileID: file.ID, SynoPath: file.Path, Priority: domain.PriorityDefault, Size: file.Size, MaxRetries: 3}); err != nil {
+		t.Fatalf("CreateTask() error = %v", err)
+	}
+	if !closed(queued) {
+		t.Error("CreateTask did not wake waiting workers")
+	}
+
+	// A task released by an interrupted worker is claimable again
+	task, err := s.ClaimNextTask("w1")
+	if err != nil || task == nil {
+		t.Fatalf("ClaimNextTask() = %+v, %v", task, err)
+	}
+	queued = s.TasksQueued()
+	if err := s.ReleaseTask(task.ID); err != nil {
+		t.Fatalf("ReleaseTask() error = %v", err)
+	}
+	if !closed(queued) {
+		t.Error("ReleaseTask did not wake waiting workers")
+	}
+}
+
+func TestStore_ClaimNextTasks(t *testing.T) {
+	s := openTestStore(t, filepath.Join(t.TempDir(), "cache.db"))
+	for name, size := range map[string]int64{"a": 100, "b": 200, "c": 300, "big": 10000} {
+		file := cacheTestFile(t, s, name)
+		task := &domain.DownloadTask{FileID: file.ID, SynoPath: file.Path, Priority: domain.PriorityDefault, Size: size, MaxRetries: 3}
+		if err := s.CreateTask(task); err != nil {
+			t.Fatalf("CreateTask() error = %v", err)
+		}
+	}
+
+	// The batch stops before the task that would exceed the byte limit
+	tasks, err := s.ClaimNextTasks("w1", 10, 350)
+	if err != nil {
+		t.Fatalf("ClaimNextTasks() error = %v", err)
+	}
+	if len(tasks) != 2 || tasks[0].SynoPath != "/a" || tasks[1].SynoPath != "/b" {
+		t.Fatalf("first batch = %v, want /a and /b", tasks)
+	}
+	for _, task := range tasks {
+		if task.Status != domain.TaskStatusInProgress || task.WorkerID != "w1" {
+			t.Errorf("task %s = %s by %q, want in progress by w1", task.SynoPath, task.Status, task.WorkerID)
+		}
+	}
+
+	// The first task is claimed even when it alone exceeds the limit
+	tasks, err = s.ClaimNextTasks("w2", 10, 100)
+	if err != nil || len(tasks) != 1 || tasks[0].SynoPath != "/c" {
+		t.Fatalf("second batch = %v, %v, want /c alone", tasks, err)
+	}
+	tasks, err = s.ClaimNextTasks("w2", 10, 100)
+	if err != nil || len(tasks) != 1 || tasks[0].SynoPath != "/big" {
+		t.Fatalf("third batch = %v, %v, want /big alone", tasks, err)
+	}
+
+	if tasks, err := s.ClaimNextTasks("w3", 10, 0); err != nil || len(tasks) != 0 {
+		t.Errorf("ClaimNextTasks() on an empty queue = %v, %v", tasks, err)
+	}
+	stats, err := s.GetQueueStats()
+	if err != nil {
+		t.Fatalf("GetQueueStats() error = %v", err)
+	}
+	if stats.InProgressCount != 4 {
+		t.Errorf("in progress = %d, want 4", stats.InProgressCount)
+	}
+}
+
+func TestStore_BoostAgedTasks(t *testing.T) {
+	s := openTestStore(t, filepath.Join(t.TempDir(), "cache.db"))
+	file := cacheTestFile(t, s, "a")
+	task := &domain.DownloadTask{FileID: file.ID, SynoPath: file.Path, Priority: domain.PriorityDefault, Size: file.Size, MaxRetries: 3}
+	if err := s.CreateTask(task); err != nil {
+		t.Fatalf("CreateTask() error = %v", err)
+	}
+
+	// Each pass boosts the task one level until it reaches the starred level
+	for _, want := range []int{4, 3, 2, 2, 2} {
+		if _, err := s.BoostAgedTasks(0); err != nil {
+			t.Fatalf("BoostAgedTasks() error = %v", err)
+		}
+		got, err := s.GetTask(task.ID)
+		if err != nil {
+			t.Fatalf("GetTask() error = %v", err)
+		}
+		if got.Priority != want {
+			t.Fatalf("priority = %d, want %d", got.Priority, want)
+		}
+	}
+
+	count, err := s.BoostAgedTasks(0)
+	if err != nil || count != 0 {
+		t.Errorf("BoostAgedTasks() at the floor = %d, %v, want 0", count, err)
+	}
+}
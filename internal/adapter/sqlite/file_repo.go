@@ -1,7 +1,9 @@
 package sqlite
 
 import (
+	"context"
 	"database/sql"
+	"time"
 
 	"github.com/vertextoedge/synology-file-cache/internal/domain"
 )
@@ -10,19 +12,20 @@ import (
 func (s *Store) GetByID(id int64) (*domain.File, error) {
 	query := `
 		SELECT id, syno_file_id, path, size, modified_at, accessed_at,
-			   starred, shared, last_sync_at, cached, cache_path,
-			   priority, last_access_in_cache_at, created_at, updated_at
+			   starred, shared, last_sync_at, cached, cache_path, cache_encoding,
+			   priority, owner, labels, content_type, export_format, cache_state, content_hash, last_access_in_cache_at, access_count, bytes_served, miss_count, missing_upstream_at, rejected_reason, stale, created_at, updated_at
 		FROM files
 		WHERE id = ?
 	`
 
 	file := &domain.File{}
 	var cachePath sql.NullString
+	var labels string
 
 	err := s.db.QueryRow(query, id).Scan(
 		&file.ID, &file.SynoFileID, &file.Path, &file.Size, &file.ModifiedAt, &file.AccessedAt,
-		&file.Starred, &file.Shared, &file.LastSyncAt, &file.Cached, &cachePath,
-		&file.Priority, &file.LastAccessInCacheAt, &file.CreatedAt, &file.UpdatedAt,
+		&file.Starred, &file.Shared, &file.LastSyncAt, &file.Cached, &cachePath, &file.CacheEncoding,
+		&file.Priority, &file.Owner, &labels, &file.ContentType, &file.ExportFormat, &file.CacheState, &file.ContentHash, &file.LastAccessInCacheAt, &file.AccessCount, &file.BytesServed, &file.MissCount, &file.MissingUpstreamAt, &file.RejectedReason, &file.Stale, &file.CreatedAt, &file.UpdatedAt,
 	)
 
 	if err == sql.ErrNoRows {
@@ -35,6 +38,7 @@ func (s *Store) GetByID(id int64) (*domain.File, error) {
 	if cachePath.Valid {
 		file.CachePath = cachePath.String
 	}
+	file.Labels = domain.DecodeLabels(labels)
 
 	return file, nil
 }
@@ -43,19 +47,20 @@ func (s *Store) GetByID(id int64) (*domain.File, error) {
 func (s *Store) GetBySynoID(synoID string) (*domain.File, error) {
 	query := `
 		SELECT id, syno_file_id, path, size, modified_at, accessed_at,
-			   starred, shared, last_sync_at, cached, cache_path,
-			   priority, last_access_in_cache_at, created_at, updated_at
+			   starred, shared, last_sync_at, cached, cache_path, cache_encoding,
+			   priority, owner, labels, content_type, export_format, cache_state, content_hash, last_access_in_cache_at, access_count, bytes_served, miss_count, missing_upstream_at, rejected_reason, stale, created_at, updated_at
 		FROM files
 		WHERE syno_file_id = ?
 	`
 
 	file := &domain.File{}
 	var cachePath sql.NullString
+	var labels string
 
 	err := s.db.QueryRow(query, synoID).Scan(
 		&file.ID, &file.SynoFileID, &file.Path, &file.Size, &file.ModifiedAt, &file.AccessedAt,
-		&file.Starred, &file.Shared, &file.LastSyncAt, &file.Cached, &cachePath,
-		&file.Priority, &file.LastAccessInCacheAt, &file.CreatedAt, &file.UpdatedAt,
+		&file.Starred, &file.Shared, &file.LastSyncAt, &file.Cached, &cachePath, &file.CacheEncoding,
+		&file.Priority, &file.Owner, &labels, &file.ContentType, &file.ExportFormat, &file.CacheState, &file.ContentHash, &file.LastAccessInCacheAt, &file.AccessCount, &file.BytesServed, &file.MissCount, &file.MissingUpstreamAt, &file.RejectedReason, &file.Stale, &file.CreatedAt, &file.UpdatedAt,
 	)
 
 	if err == sql.ErrNoRows {
@@ -68,6 +73,7 @@ func (s *Store) GetBySynoID(synoID string) (*domain.File, error) {
 	if cachePath.Valid {
 		file.CachePath = cachePath.String
 	}
+	file.Labels = domain.DecodeLabels(labels)
 
 	return file, nil
 }
@@ -76,19 +82,20 @@ func (s *Store) GetBySynoID(synoID string) (*domain.File, error) {
 func (s *Store) GetByPath(path string) (*domain.File, error) {
 	query := `
 		SELECT id, syno_file_id, path, size, modified_at, accessed_at,
-			   starred, shared, last_sync_at, cached, cache_path,
-			   priority, last_access_in_cache_at, created_at, updated_at
+			   starred, shared, last_sync_at, cached, cache_path, cache_encoding,
+			   priority, owner, labels, content_type, export_format, cache_state, content_hash, last_access_in_cache_at, access_count, bytes_served, miss_count, missing_upstream_at, rejected_reason, stale, created_at, updated_at
 		FROM files
 		WHERE path = ?
 	`
 
 	file := &domain.File{}
 	var cachePath sql.NullString
+	var labels string
 
 	err := s.db.QueryRow(query, path).Scan(
 		&file.ID, &file.SynoFileID, &file.Path, &file.Size, &file.ModifiedAt, &file.AccessedAt,
-		&file.Starred, &file.Shared, &file.LastSyncAt, &file.Cached, &cachePath,
-		&file.Priority, &file.LastAccessInCacheAt, &file.CreatedAt, &file.UpdatedAt,
+		&file.Starred, &file.Shared, &file.LastSyncAt, &file.Cached, &cachePath, &file.CacheEncoding,
+		&file.Priority, &file.Owner, &labels, &file.ContentType, &file.ExportFormat, &file.CacheState, &file.ContentHash, &file.LastAccessInCacheAt, &file.AccessCount, &file.BytesServed, &file.MissCount, &file.MissingUpstreamAt, &file.RejectedReason, &file.Stale, &file.CreatedAt, &file.UpdatedAt,
 	)
 
 	if err == sql.ErrNoRows {
@@ -101,6 +108,7 @@ func (s *Store) GetByPath(path string) (*domain.File, error) {
 	if cachePath.Valid {
 		file.CachePath = cachePath.String
 	}
+	file.Labels = domain.DecodeLabels(labels)
 
 	return file, nil
 }
@@ -110,9 +118,9 @@ func (s *Store) Create(file *domain.File) error {
 	query := `
 		INSERT INTO files (
 			syno_file_id, path, size, modified_at, accessed_at,
-			starred, shared, last_sync_at, cached, cache_path,
-			priority, last_access_in_cache_at
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			starred, shared, last_sync_at, cached, cache_path, cache_encoding,
+			priority, owner, labels, content_type, export_format, cache_state, content_hash, last_access_in_cache_at, missing_upstream_at, rejected_reason, stale
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	var cachePath sql.NullString
@@ -120,11 +128,11 @@ func (s *Store) Create(file *domain.File) error {
 		cachePath = sql.NullString{String: file.CachePath, Valid: true}
 	}
 
-	result, err := s.db.Exec(
+	result, err := s.exec(
 		query,
 		file.SynoFileID, file.Path, file.Size, file.ModifiedAt, file.AccessedAt,
-		file.Starred, file.Shared, file.LastSyncAt, file.Cached, cachePath,
-		file.Priority, file.LastAccessInCacheAt,
+		file.Starred, file.Shared, file.LastSyncAt, file.Cached, cachePath, file.CacheEncoding,
+		file.Priority, file.Owner, domain.EncodeLabels(file.Labels), file.ContentType, file.ExportFormat, file.CacheState, file.ContentHash, file.LastAccessInCacheAt, file.MissingUpstreamAt, file.RejectedReason, file.Stale,
 	)
 	if err != nil {
 		return err
@@ -146,8 +154,8 @@ func (s *Store) Update(file *domain.File) error {
 		UPDATE files SET
 			path = ?, size = ?, modified_at = ?, accessed_at = ?,
 			starred = ?, shared = ?, last_sync_at = ?, cached = ?,
-			cache_path = ?, priority = ?, last_access_in_cache_at = ?,
-			updated_at = CURRENT_TIMESTAMP
+			cache_path = ?, cache_encoding = ?, priority = ?, last_access_in_cache_at = ?,
+			content_type = ?, export_format = ?, cache_state = ?, content_hash = ?, missing_upstream_at = ?, rejected_reason = ?, stale = ?, updated_at = CURRENT_TIMESTAMP
 		WHERE id = ?
 	`
 
@@ -156,15 +164,19 @@ func (s *Store) Update(file *domain.File) error {
 		cachePath = sql.NullString{String: file.CachePath, Valid: true}
 	}
 
-	_, err := s.db.Exec(
+	_, err := s.exec(
 		query,
 		file.Path, file.Size, file.ModifiedAt, file.AccessedAt,
 		file.Starred, file.Shared, file.LastSyncAt, file.Cached,
-		cachePath, file.Priority, file.LastAccessInCacheAt,
-		file.ID,
+		cachePath, file.CacheEncoding, file.Priority, file.LastAccessInCacheAt,
+		file.ContentType, file.ExportFormat, file.CacheState, file.ContentHash, file.MissingUpstreamAt, file.RejectedReason, file.Stale, file.ID,
 	)
+	if err != nil {
+		return err
+	}
 
-	return err
+	s.invalidateShareCacheFile(file.ID)
+	return nil
 }
 
 // UpdateMetadata updates file metadata without touching cache status fields
@@ -178,48 +190,258 @@ func (s *Store) UpdateMetadata(file *domain.File) error {
 		WHERE id = ?
 	`
 
-	_, err := s.db.Exec(
+	_, err := s.exec(
 		query,
 		file.Path, file.Size, file.ModifiedAt, file.AccessedAt,
 		file.Starred, file.Shared, file.LastSyncAt, file.Priority,
 		file.ID,
 	)
+	if err != nil {
+		return err
+	}
 
-	return err
+	s.invalidateShareCacheFile(file.ID)
+	return nil
+}
+
+// UpsertBySynoID atomically creates or updates a file keyed by syno_file_id.
+// cached/cache_path are preserved unless the upstream mtime moved forward;
+// then they are cleared, or kept and marked stale with stale-while-revalidate.
+func (s *Store) UpsertBySynoID(file *domain.File) (*domain.UpsertResult, error) {
+	result := &domain.UpsertResult{}
+
+	err := s.withImmediateTx(func(ctx context.Context, conn *sql.Conn) error {
+		// Read previous state under the write lock to decide on invalidation
+		var prevModifiedAt *time.Time
+		var prevCached bool
+		var prevLabels string
+		var modified bool // A new version was uploaded, so a missing file may be back
+		err := conn.QueryRowContext(ctx,
+			"SELECT modified_at, cached, labels FROM files WHERE syno_file_id = ?",
+			file.SynoFileID,
+		).Scan(&prevModifiedAt, &prevCached, &prevLabels)
+		switch {
+		case err == sql.ErrNoRows:
+			result.Created = true
+		case err != nil:
+			return err
+		default:
+			result.PreviousModifiedAt = prevModifiedAt
+			modified = prevModifiedAt != nil && file.ModifiedAt != nil && file.ModifiedAt.After(*prevModifiedAt)
+			result.Invalidated = prevCached && modified
+			result.Stale = result.Invalidated && s.staleWhileRevalidate
+		}
+		drop := result.Invalidated && !result.Stale
+
+		query := `
+			INSERT INTO files (
+				syno_file_id, path, size, modified_at, accessed_at,
+				starred, shared, last_sync_at, priority, owner, labels, content_type
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(syno_file_id) DO UPDATE SET
+				path = excluded.path,
+				size = excluded.size,
+				modified_at = COALESCE(excluded.modified_at, files.modified_at),
+				accessed_at = COALESCE(excluded.accessed_at, files.accessed_at),
+				starred = excluded.starred,
+				shared = excluded.shared,
+				last_sync_at = excluded.last_sync_at,
+				priority = MIN(files.priority, excluded.priority),
+				owner = CASE WHEN excluded.owner <> '' THEN excluded.owner ELSE files.owner END,
+				labels = excluded.labels,
+				content_type = CASE WHEN ? OR excluded.content_type <> '' THEN excluded.content_type ELSE files.content_type END,
+				cached = CASE WHEN ? THEN FALSE ELSE files.cached END,
+				stale = CASE WHEN ? THEN TRUE WHEN ? THEN FALSE ELSE files.stale END,
+				cache_path = CASE WHEN ? THEN NULL ELSE files.cache_path END,
+				cache_encoding = CASE WHEN ? THEN '' ELSE files.cache_encoding END,
+				export_format = CASE WHEN ? THEN '' ELSE files.export_format END,
+				content_hash = CASE WHEN ? THEN '' ELSE files.content_hash END,
+				missing_upstream_at = CASE WHEN ? THEN NULL ELSE files.missing_upstream_at END,
+				rejected_reason = CASE WHEN ? THEN '' ELSE files.rejected_reason END,
+				updated_at = CURRENT_TIMESTAMP
+			RETURNING id, syno_file_id, path, size, modified_at, accessed_at,
+				starred, shared, last_sync_at, cached, cache_path, cache_encoding,
+				priority, owner, labels, content_type, export_format, cache_state, content_hash, last_access_in_cache_at, access_count, bytes_served, miss_count, missing_upstream_at, rejected_reason, stale, created_at, updated_at
+		`
+
+		stored := &domain.File{}
+		var cachePath sql.NullString
+		var labels string
+
+		err = conn.QueryRowContext(ctx, query,
+			file.SynoFileID, file.Path, file.Size, file.ModifiedAt, file.AccessedAt,
+			file.Starred, file.Shared, file.LastSyncAt, file.Priority,
+			file.Owner, domain.EncodeLabels(file.Labels), file.ContentType,
+			result.Invalidated, drop, result.Stale, drop, drop, drop, drop, drop,
+			modified, modified,
+		).Scan(
+			&stored.ID, &stored.SynoFileID, &stored.Path, &stored.Size, &stored.ModifiedAt, &stored.AccessedAt,
+			&stored.Starred, &stored.Shared, &stored.LastSyncAt, &stored.Cached, &cachePath, &stored.CacheEncoding,
+			&stored.Priority, &stored.Owner, &labels, &stored.ContentType, &stored.ExportFormat, &stored.CacheState, &stored.ContentHash, &stored.LastAccessInCacheAt, &stored.AccessCount, &stored.BytesServed, &stored.MissCount, &stored.MissingUpstreamAt, &stored.RejectedReason, &stored.Stale, &stored.CreatedAt, &stored.UpdatedAt,
+		)
+		if err != nil {
+			return err
+		}
+
+		if cachePath.Valid {
+			stored.CachePath = cachePath.String
+		}
+		stored.Labels = domain.DecodeLabels(labels)
+
+		if result.Created || labels != prevLabels {
+			if err := updateFileLabels(ctx, conn, stored.ID, labels); err != nil {
+				return err
+			}
+		}
+
+		result.File = stored
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.invalidateShareCacheFile(result.File.ID)
+	return result, nil
 }
 
 // InvalidateCache sets cached=false for a file (used when source file is modified)
 func (s *Store) InvalidateCache(fileID int64) error {
 	query := `
 		UPDATE files SET
-			cached = FALSE, cache_path = NULL,
+			cached = FALSE, cache_path = NULL, cache_encoding = '', export_format = '', content_hash = '', stale = FALSE,
 			updated_at = CURRENT_TIMESTAMP
 		WHERE id = ?
 	`
 
-	_, err := s.db.Exec(query, fileID)
+	_, err := s.exec(query, fileID)
+	if err != nil {
+		return err
+	}
+
+	s.invalidateShareCacheFile(fileID)
+	return nil
+}
+
+// MarkMissingUpstream records that a download found the file deleted on the NAS
+func (s *Store) MarkMissingUpstream(fileID int64) error {
+	_, err := s.exec(`
+		UPDATE files SET missing_upstream_at = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, time.Now().UTC(), fileID)
+	if err != nil {
+		return err
+	}
+
+	s.invalidateShareCacheFile(fileID)
+	return nil
+}
+
+// RecordHit counts a share request served from the cache with the bytes sent
+// and updates the last access time. The share cache is not invalidated, so
+// the counters of files looked up by share token may lag behind.
+func (s *Store) RecordHit(fileID, bytesServed int64) error {
+	_, err := s.exec(`
+		UPDATE files SET
+			access_count = access_count + 1,
+			bytes_served = bytes_served + ?,
+			last_access_in_cache_at = ?
+		WHERE id = ?
+	`, bytesServed, time.Now().UTC(), fileID)
+	return err
+}
+
+// RecordMiss counts a share request made while the file was not cached
+func (s *Store) RecordMiss(fileID int64) error {
+	_, err := s.exec("UPDATE files SET miss_count = miss_count + 1 WHERE id = ?", fileID)
 	return err
 }
 
+// BoostFilePriority raises the priority of a file to priority if it is less urgent
+func (s *Store) BoostFilePriority(fileID int64, priority int) (bool, error) {
+	result, err := s.exec(`
+		UPDATE files SET priority = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND priority > ?
+	`, priority, fileID, priority)
+	if err != nil {
+		return false, err
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if count > 0 {
+		s.invalidateShareCacheFile(fileID)
+	}
+	return count > 0, nil
+}
+
+// ListMissingUpstream returns a page of files marked missing upstream and their total number
+func (s *Store) ListMissingUpstream(limit, offset int) ([]*domain.File, int, error) {
+	var total int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM files WHERE missing_upstream_at IS NOT NULL`).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := `
+		SELECT id, syno_file_id, path, size, modified_at, accessed_at,
+			   starred, shared, last_sync_at, cached, cache_path, cache_encoding,
+			   priority, owner, labels, content_type, export_format, cache_state, content_hash, last_access_in_cache_at, access_count, bytes_served, miss_count, missing_upstream_at, rejected_reason, stale, created_at, updated_at
+		FROM files
+		WHERE missing_upstream_at IS NOT NULL
+		ORDER BY missing_upstream_at DESC, id DESC
+		LIMIT ? OFFSET ?
+	`
+
+	rows, err := s.db.Query(query, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	files, err := s.scanFiles(rows)
+	return files, total, err
+}
+
 // Delete deletes a file record by ID
 func (s *Store) Delete(id int64) error {
-	_, err := s.db.Exec("DELETE FROM files WHERE id = ?", id)
-	return err
+	_, err := s.exec("DELETE FROM files WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	s.invalidateShareCacheFile(id)
+	return nil
+}
+
+// evictionOrder returns the ORDER BY terms of eviction candidates under a policy
+func evictionOrder(policy domain.EvictionPolicy) string {
+	if policy == domain.EvictionLFU {
+		return "priority DESC, access_count ASC, last_access_in_cache_at ASC"
+	}
+	return "priority DESC, last_access_in_cache_at ASC"
 }
 
+// evictable excludes files whose download is in progress, such as stale
+// copies still served while their new version is downloaded
+const evictable = `NOT EXISTS (
+			SELECT 1 FROM download_tasks t
+			WHERE t.file_id = files.id AND t.status = '` + domain.TaskStatusInProgress + `')`
+
 // GetEvictionCandidates returns cached files that can be evicted
-func (s *Store) GetEvictionCandidates(limit int) ([]*domain.File, error) {
+func (s *Store) GetEvictionCandidates(policy domain.EvictionPolicy, limit int) ([]*domain.File, error) {
 	query := `
 		SELECT id, syno_file_id, path, size, modified_at, accessed_at,
-			   starred, shared, last_sync_at, cached, cache_path,
-			   priority, last_access_in_cache_at, created_at, updated_at
+			   starred, shared, last_sync_at, cached, cache_path, cache_encoding,
+			   priority, owner, labels, content_type, export_format, cache_state, content_hash, last_access_in_cache_at, access_count, bytes_served, miss_count, missing_upstream_at, rejected_reason, stale, created_at, updated_at
 		FROM files
-		WHERE cached = TRUE
-		ORDER BY priority DESC, last_access_in_cache_at ASC
+		WHERE cached = TRUE AND priority <> ? AND ` + evictable + `
+		ORDER BY ` + evictionOrder(policy) + `
 		LIMIT ?
 	`
 
-	rows, err := s.db.Query(query, limit)
+	rows, err := s.db.Query(query, domain.PriorityPinned, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -228,29 +450,236 @@ func (s *Store) GetEvictionCandidates(limit int) ([]*domain.File, error) {
 	return s.scanFiles(rows)
 }
 
-// scanFiles is a helper to scan multiple file rows
-func (s *Store) scanFiles(rows *sql.Rows) ([]*domain.File, error) {
-	var files []*domain.File
+// GetEvictionCandidatesByOwner returns evictable cached files of one owner
+func (s *Store) GetEvictionCandidatesByOwner(policy domain.EvictionPolicy, owner string, limit int) ([]*domain.File, error) {
+	return s.getEvictionCandidatesWhere(policy, "owner = ?", owner, limit)
+}
+
+// GetEvictionCandidatesByLabel returns evictable cached files with a label
+func (s *Store) GetEvictionCandidatesByLabel(policy domain.EvictionPolicy, label string, limit int) ([]*domain.File, error) {
+	return s.getEvictionCandidatesWhere(policy, "instr(',' || labels || ',', ?) > 0", ","+label+",", limit)
+}
 
+// getEvictionCandidatesWhere returns eviction candidates matching an extra condition
+func (s *Store) getEvictionCandidatesWhere(policy domain.EvictionPolicy, cond string, arg interface{}, limit int) ([]*domain.File, error) {
+	query := `
+		SELECT id, syno_file_id, path, size, modified_at, accessed_at,
+			   starred, shared, last_sync_at, cached, cache_path, cache_encoding,
+			   priority, owner, labels, content_type, export_format, cache_state, content_hash, last_access_in_cache_at, access_count, bytes_served, miss_count, missing_upstream_at, rejected_reason, stale, created_at, updated_at
+		FROM files
+		WHERE cached = TRUE AND priority <> ? AND ` + evictable + ` AND ` + cond + `
+		ORDER BY ` + evictionOrder(policy) + `
+		LIMIT ?
+	`
+
+	rows, err := s.db.Query(query, domain.PriorityPinned, arg, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return s.scanFiles(rows)
+}
+
+// ForEachEvictionCandidate streams evictable cached files in eviction order
+func (s *Store) ForEachEvictionCandidate(policy domain.EvictionPolicy, fn func(*domain.File) bool) error {
+	query := `
+		SELECT id, syno_file_id, path, size, modified_at, accessed_at,
+			   starred, shared, last_sync_at, cached, cache_path, cache_encoding,
+			   priority, owner, labels, content_type, export_format, cache_state, content_hash, last_access_in_cache_at, access_count, bytes_served, miss_count, missing_upstream_at, rejected_reason, stale, created_at, updated_at
+		FROM files
+		WHERE cached = TRUE AND priority <> ? AND ` + evictable + `
+		ORDER BY ` + evictionOrder(policy) + `
+	`
+	return s.forEachFile(query, []interface{}{domain.PriorityPinned}, fn)
+}
+
+// GetFilesByCacheState returns files left in an intermediate cache state
+func (s *Store) GetFilesByCacheState(state string) ([]*domain.File, error) {
+	query := `
+		SELECT id, syno_file_id, path, size, modified_at, accessed_at,
+			   starred, shared, last_sync_at, cached, cache_path, cache_encoding,
+			   priority, owner, labels, content_type, export_format, cache_state, content_hash, last_access_in_cache_at, access_count, bytes_served, miss_count, missing_upstream_at, rejected_reason, stale, created_at, updated_at
+		FROM files
+		WHERE cache_state = ?
+	`
+
+	rows, err := s.db.Query(query, state)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return s.scanFiles(rows)
+}
+
+// CountCacheReferences returns the number of files using the copy at cachePath
+func (s *Store) CountCacheReferences(cachePath string) (int, error) {
+	query := `
+		SELECT COUNT(*) FROM files
+		WHERE cache_path = ? AND (cached = TRUE OR cache_state = ?)
+	`
+
+	var count int
+	err := s.db.QueryRow(query, cachePath, domain.CacheStateCaching).Scan(&count)
+	return count, err
+}
+
+// ForEachFileToCache streams uncached files without a download task
+func (s *Store) ForEachFileToCache(fn func(*domain.File) bool) error {
+	query := `
+		SELECT id, syno_file_id, path, size, modified_at, accessed_at,
+			   starred, shared, last_sync_at, cached, cache_path, cache_encoding,
+			   priority, owner, labels, content_type, export_format, cache_state, content_hash, last_access_in_cache_at, access_count, bytes_served, miss_count, missing_upstream_at, rejected_reason, stale, created_at, updated_at
+		FROM files
+		WHERE cached = FALSE
+		  AND NOT EXISTS (SELECT 1 FROM download_tasks WHERE download_tasks.file_id = files.id)
+		ORDER BY priority ASC, size ASC
+	`
+	return s.forEachFile(query, nil, fn)
+}
+
+// GetQuotaUsage sums the size of cached, non-pinned files per owner and label.
+// With includeQueued files with an active download task are counted too.
+func (s *Store) GetQuotaUsage(includeQueued bool) (*domain.QuotaUsage, error) {
+	query := `
+		SELECT owner, labels, COALESCE(SUM(size), 0)
+		FROM files
+		WHERE priority <> ? AND (owner <> '' OR labels <> '')
+		  AND (cached = TRUE OR (? AND id IN (
+			SELECT file_id FROM download_tasks WHERE status IN ('pending', 'in_progress')
+		  )))
+		GROUP BY owner, labels
+	`
+
+	rows, err := s.db.Query(query, domain.PriorityPinned, includeQueued)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usage := domain.NewQuotaUsage()
 	for rows.Next() {
-		file := &domain.File{}
-		var cachePath sql.NullString
+		var owner, labels string
+		var size int64
+		if err := rows.Scan(&owner, &labels, &size); err != nil {
+			return nil, err
+		}
+		usage.Add(owner, domain.DecodeLabels(labels), size)
+	}
+	return usage, rows.Err()
+}
 
-		err := rows.Scan(
-			&file.ID, &file.SynoFileID, &file.Path, &file.Size, &file.ModifiedAt, &file.AccessedAt,
-			&file.Starred, &file.Shared, &file.LastSyncAt, &file.Cached, &cachePath,
-			&file.Priority, &file.LastAccessInCacheAt, &file.CreatedAt, &file.UpdatedAt,
-		)
+// UnpinFiles resets pinned files outside keepPrefixes to the default priority
+func (s *Store) UnpinFiles(keepPrefixes []string) (int, error) {
+	var ids []int64
+
+	err := s.withImmediateTx(func(ctx context.Context, conn *sql.Conn) error {
+		ids = nil
+		rows, err := conn.QueryContext(ctx, "SELECT id, path FROM files WHERE priority = ?", domain.PriorityPinned)
 		if err != nil {
-			return nil, err
+			return err
 		}
 
-		if cachePath.Valid {
-			file.CachePath = cachePath.String
+		for rows.Next() {
+			var id int64
+			var path string
+			if err := rows.Scan(&id, &path); err != nil {
+				rows.Close()
+				return err
+			}
+			if !isUnderAny(path, keepPrefixes) {
+				ids = append(ids, id)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			if _, err := conn.ExecContext(ctx,
+				"UPDATE files SET priority = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+				domain.PriorityDefault, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, id := range ids {
+		s.invalidateShareCacheFile(id)
+	}
+	return len(ids), nil
+}
+
+// isUnderAny reports whether path lies below one of dirs
+func isUnderAny(path string, dirs []string) bool {
+	for _, dir := range dirs {
+		if domain.IsUnderPath(path, dir) {
+			return true
 		}
+	}
+	return false
+}
+
+// scanFiles is a helper to scan multiple file rows
+func (s *Store) scanFiles(rows *sql.Rows) ([]*domain.File, error) {
+	var files []*domain.File
 
+	for rows.Next() {
+		file, err := scanFileRow(rows)
+		if err != nil {
+			return nil, err
+		}
 		files = append(files, file)
 	}
 
 	return files, rows.Err()
 }
+
+// scanFileRow scans the current row of a files query
+func scanFileRow(rows *sql.Rows) (*domain.File, error) {
+	file := &domain.File{}
+	var cachePath sql.NullString
+	var labels string
+
+	err := rows.Scan(
+		&file.ID, &file.SynoFileID, &file.Path, &file.Size, &file.ModifiedAt, &file.AccessedAt,
+		&file.Starred, &file.Shared, &file.LastSyncAt, &file.Cached, &cachePath, &file.CacheEncoding,
+		&file.Priority, &file.Owner, &labels, &file.ContentType, &file.ExportFormat, &file.CacheState, &file.ContentHash, &file.LastAccessInCacheAt, &file.AccessCount, &file.BytesServed, &file.MissCount, &file.MissingUpstreamAt, &file.RejectedReason, &file.Stale, &file.CreatedAt, &file.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if cachePath.Valid {
+		file.CachePath = cachePath.String
+	}
+	file.Labels = domain.DecodeLabels(labels)
+	return file, nil
+}
+
+// forEachFile runs a files query and calls fn for each row until fn returns false.
+// Rows are scanned one at a time, so only the current file is held in memory.
+func (s *Store) forEachFile(query string, args []interface{}, fn func(*domain.File) bool) error {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		file, err := scanFileRow(rows)
+		if err != nil {
+			return err
+		}
+		if !fn(file) {
+			return nil
+		}
+	}
+	return rows.Err()
+}
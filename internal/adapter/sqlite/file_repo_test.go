@@ -0,0 +1,279 @@
+package sqlite
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+)
+
+// cacheTestFile stores a cached file with the default priority
+func cacheTestFile(t *testing.T, s *Store, name string) *domain.File {
+	t.Helper()
+	result, err := s.UpsertBySynoID(&domain.File{SynoFileID: name, Path: "/" + name, Size: 10, Priority: domain.PriorityDefault})
+	if err != nil {
+		t.Fatalf("UpsertBySynoID() error = %v", err)
+	}
+	file := result.File
+	file.MarkCached("/cache/" + name)
+	if err := s.Update(file); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	return file
+}
+
+func TestStore_RecordHitAndMiss(t *testing.T) {
+	s := openTestStore(t, filepath.Join(t.TempDir(), "cache.db"))
+	file := cacheTestFile(t, s, "a")
+	cacheTestFile(t, s, "unserved")
+
+	for i := 0; i < 3; i++ {
+		if err := s.RecordHit(file.ID, 100); err != nil {
+			t.Fatalf("RecordHit() error = %v", err)
+		}
+	}
+	if err := s.RecordMiss(file.ID); err != nil {
+		t.Fatalf("RecordMiss() error = %v", err)
+	}
+
+	// Update must not overwrite the counters with a stale copy
+	if err := s.Update(file); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	got, err := s.GetByID(file.ID)
+	if err != nil {
+		t.Fatalf("GetByID() error = %v", err)
+	}
+	if got.AccessCount != 3 || got.BytesServed != 300 || got.MissCount != 1 {
+		t.Errorf("counters = %d/%d/%d, want 3/300/1", got.AccessCount, got.BytesServed, got.MissCount)
+	}
+
+	stats, err := s.GetCacheStats()
+	if err != nil {
+		t.Fatalf("GetCacheStats() error = %v", err)
+	}
+	if stats.AccessCount != 3 || stats.BytesServed != 300 || stats.MissCount != 1 {
+		t.Errorf("totals = %d/%d/%d, want 3/300/1", stats.AccessCount, stats.BytesServed, stats.MissCount)
+	}
+	if stats.UnservedCachedBytes != 10 {
+		t.Errorf("UnservedCachedBytes = %d, want the 10 bytes of the file never served", stats.UnservedCachedBytes)
+	}
+}
+
+func TestStore_EvictionPolicy(t *testing.T) {
+	s := openTestStore(t, filepath.Join(t.TempDir(), "cache.db"))
+	popular := cacheTestFile(t, s, "popular")
+	recent := cacheTestFile(t, s, "recent")
+
+	// popular was served often but longest ago
+	for i := 0; i < 5; i++ {
+		s.RecordHit(popular.ID, 10)
+	}
+	s.RecordHit(recent.ID, 10)
+
+	tests := []struct {
+		policy domain.EvictionPolicy
+		want   string
+	}{
+		{domain.EvictionLRU, "/popular"},
+		{domain.EvictionLFU, "/recent"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.policy), func(t *testing.T) {
+			files, err := s.GetEvictionCandidates(tt.policy, 1)
+			if err != nil {
+				t.Fatalf("GetEvictionCandidates() error = %v", err)
+			}
+			if len(files) != 1 || files[0].Path != tt.want {
+				t.Errorf("first candidate = %v, want %s", files, tt.want)
+			}
+		})
+	}
+}
+
+func TestStore_EvictionSkipsDownloadInProgress(t *testing.T) {
+	s := openTestStore(t, filepath.Join(t.TempDir(), "cache.db"))
+	downloading := cacheTestFile(t, s, "downloading")
+	idle := cacheTestFile(t, s, "idle")
+
+	// A stale copy whose replacement is being downloaded stays in the cache
+	task := &domain.DownloadTask{FileID: downloading.ID, SynoPath: downloading.Path, Priority: domain.PriorityDefault, Size: downloading.Size, MaxRetries: 3}
+	if err := s.CreateTask(task); err != nil {
+		t.Fatalf("CreateTask() error = %v", err)
+	}
+	if claimed, err := s.ClaimNextTask("w1"); err != nil || claimed == nil {
+		t.Fatalf("ClaimNextTask() = %+v, %v", claimed, err)
+	}
+
+	files, err := s.GetEvictionCandidates(domain.EvictionLRU, 10)
+	if err != nil {
+		t.Fatalf("GetEvictionCandidates() error = %v", err)
+	}
+	if len(files) != 1 || files[0].ID != idle.ID {
+		t.Errorf("candidates = %v, want only /idle", files)
+	}
+	var walked []string
+	if err := s.ForEachEvictionCandidate(domain.EvictionLRU, func(f *domain.File) bool {
+		walked = append(walked, f.Path)
+		return true
+	}); err != nil {
+		t.Fatalf("ForEachEvictionCandidate() error = %v", err)
+	}
+	if len(walked) != 1 || walked[0] != "/idle" {
+		t.Errorf("walked candidates = %v, want [/idle]", walked)
+	}
+}
+
+func TestStore_UpsertBySynoID(t *testing.T) {
+	s := openTestStore(t, filepath.Join(t.TempDir(), "cache.db"))
+	v1 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	synced := func(size int64, mtime time.Time, starred, shared bool) *domain.UpsertResult {
+		t.Helper()
+		result, err := s.UpsertBySynoID(&domain.File{
+			SynoFileID: "a", Path: "/mydrive/a.txt", Size: size, ModifiedAt: &mtime,
+			Starred: starred, Shared: shared, Priority: domain.PriorityDefault,
+		})
+		if err != nil {
+			t.Fatalf("UpsertBySynoID() error = %v", err)
+		}
+		return result
+	}
+
+	result := synced(10, v1, true, true)
+	if !result.Created {
+		t.Error("first upsert did not create the file")
+	}
+	file := result.File
+	file.MarkCached("/cache/a")
+	file.ContentHash = "abc"
+	if err := s.Update(file); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	t.Run("one row per syno ID", func(t *testing.T) {
+		result := synced(10, v1, true, true)
+		if result.Created || result.File.ID != file.ID {
+			t.Errorf("re-sync created %v with ID %d, want the existing row %d", result.Created, result.File.ID, file.ID)
+		}
+		stats, err := s.GetCacheStats()
+		if err != nil {
+			t.Fatalf("GetCacheStats() error = %v", err)
+		}
+		if stats.TotalFiles != 1 {
+			t.Errorf("total files = %d, want 1", stats.TotalFiles)
+		}
+	})
+
+	t.Run("cache fields kept on re-sync", func(t *testing.T) {
+		result := synced(10, v1, true, true)
+		got := result.File
+		if result.Invalidated || !got.Cached || got.CachePath != "/cache/a" || got.ContentHash != "abc" {
+			t.Errorf("file = invalidated %v, cached %v, path %q, hash %q; want the cached copy kept",
+				result.Invalidated, got.Cached, got.CachePath, got.ContentHash)
+		}
+	})
+
+	t.Run("un-starring and un-sharing", func(t *testing.T) {
+		got := synced(10, v1, false, false).File
+		if got.Starred || got.Shared {
+			t.Errorf("starred %v, shared %v after the NAS cleared both, want false", got.Starred, got.Shared)
+		}
+		got = synced(10, v1, true, false).File
+		if !got.Starred || got.Shared {
+			t.Errorf("starred %v, shared %v, want starred only", got.Starred, got.Shared)
+		}
+	})
+
+	t.Run("older mtime keeps the copy", func(t *testing.T) {
+		result := synced(10, v1.Add(-time.Hour), true, false)
+		if result.Invalidated || !result.File.Cached {
+			t.Errorf("older mtime invalidated %v, cached %v; want the copy kept", result.Invalidated, result.File.Cached)
+		}
+	})
+
+	t.Run("newer mtime invalidates", func(t *testing.T) {
+		result := synced(20, v1.Add(time.Hour), true, false)
+		got := result.File
+		if !result.Invalidated || result.Stale || got.Cached || got.CachePath != "" || got.ContentHash != "" {
+			t.Errorf("file = invalidated %v, stale %v, cached %v, path %q, hash %q; want the copy dropped",
+				result.Invalidated, result.Stale, got.Cached, got.CachePath, got.ContentHash)
+		}
+		if got.Size != 20 {
+			t.Errorf("size = %d, want 20", got.Size)
+		}
+	})
+}
+
+func TestStore_UpsertStaleWhileRevalidate(t *testing.T) {
+	s := openTestStore(t, filepath.Join(t.TempDir(), "cache.db"))
+	s.EnableStaleWhileRevalidate()
+
+	v1 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	result, err := s.UpsertBySynoID(&domain.File{SynoFileID: "a", Path: "/a", Size: 10, ModifiedAt: &v1})
+	if err != nil {
+		t.Fatalf("UpsertBySynoID() error = %v", err)
+	}
+	file := result.File
+	file.MarkCached("/cache/a")
+	if err := s.Update(file); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	// A newer version keeps the copy, marked stale
+	v2 := v1.Add(time.Hour)
+	result, err = s.UpsertBySynoID(&domain.File{SynoFileID: "a", Path: "/a", Size: 20, ModifiedAt: &v2})
+	if err != nil {
+		t.Fatalf("UpsertBySynoID() error = %v", err)
+	}
+	if !result.Invalidated || !result.Stale {
+		t.Errorf("result = %+v, want invalidated and stale", result)
+	}
+	if got := result.File; !got.Cached || !got.Stale || got.CachePath != "/cache/a" {
+		t.Errorf("file = cached %v, stale %v, path %q; want the stale copy", got.Cached, got.Stale, got.CachePath)
+	}
+
+	// Caching the new version clears the mark
+	file = result.File
+	file.MarkCached("/cache/a")
+	if err := s.Update(file); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if got, _ := s.GetByID(file.ID); got.Stale {
+		t.Error("file still stale after caching the new version")
+	}
+}
+
+func TestStore_BoostPriority(t *testing.T) {
+	s := openTestStore(t, filepath.Join(t.TempDir(), "cache.db"))
+	file := cacheTestFile(t, s, "a")
+
+	if boosted, err := s.BoostFilePriority(file.ID, domain.PriorityRecentAccessed); err != nil || !boosted {
+		t.Fatalf("BoostFilePriority() = %v, %v, want true", boosted, err)
+	}
+	// A more urgent priority is never lowered
+	if boosted, err := s.BoostFilePriority(file.ID, domain.PriorityDefault); err != nil || boosted {
+		t.Errorf("BoostFilePriority(default) = %v, %v, want false", boosted, err)
+	}
+	got, _ := s.GetByID(file.ID)
+	if got.Priority != domain.PriorityRecentAccessed {
+		t.Errorf("priority = %d, want %d", got.Priority, domain.PriorityRecentAccessed)
+	}
+
+	if boosted, err := s.BoostTaskPriority(file.ID, domain.PriorityPinned); err != nil || boosted {
+		t.Errorf("BoostTaskPriority() without a task = %v, %v", boosted, err)
+	}
+	task := &domain.DownloadTask{FileID: file.ID, SynoPath: file.Path, Priority: domain.PriorityDefault, Size: file.Size, MaxRetries: 3}
+	if err := s.CreateTask(task); err != nil {
+		t.Fatalf("CreateTask() error = %v", err)
+	}
+	if boosted, err := s.BoostTaskPriority(file.ID, domain.PriorityPinned); err != nil || !boosted {
+		t.Fatalf("BoostTaskPriority() = %v, %v, want true", boosted, err)
+	}
+	claimed, err := s.ClaimNextTaskUpTo("w1", domain.PriorityPinned)
+	if err != nil || claimed == nil || claimed.ID != task.ID {
+		t.Errorf("ClaimNextTaskUpTo(pinned) = %+v, %v, want the boosted task", claimed, err)
+	}
+}
@@ -0,0 +1,106 @@
+package sqlite
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+)
+
+// fileSortColumns maps search sort keys to files columns
+var fileSortColumns = map[string]string{
+	domain.FileSortPath:       "path",
+	domain.FileSortSize:       "size",
+	domain.FileSortModified:   "modified_at",
+	domain.FileSortPriority:   "priority",
+	domain.FileSortLastAccess: "last_access_in_cache_at",
+	domain.FileSortAccesses:   "access_count",
+	domain.FileSortServed:     "bytes_served",
+	domain.FileSortMisses:     "miss_count",
+}
+
+// SearchFiles returns a page of files matching the search and the total number of matches
+func (s *Store) SearchFiles(search domain.FileSearch, limit, offset int) ([]*domain.File, int, error) {
+	where, args := fileSearchWhere(search)
+
+	var total int
+	if err := s.rdb.QueryRow(`SELECT COUNT(*) FROM files WHERE `+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	order, ok := fileSortColumns[search.Sort]
+	if !ok {
+		order = "path"
+	}
+	direction := "ASC"
+	if search.Desc {
+		direction = "DESC"
+	}
+
+	query := `
+		SELECT id, syno_file_id, path, size, modified_at, accessed_at,
+			   starred, shared, last_sync_at, cached, cache_path, cache_encoding,
+			   priority, owner, labels, content_type, export_format, cache_state, content_hash, last_access_in_cache_at, access_count, bytes_served, miss_count, missing_upstream_at, rejected_reason, stale, created_at, updated_at
+		FROM files
+		WHERE ` + where + `
+		ORDER BY ` + order + ` ` + direction + `, id ` + direction + `
+		LIMIT ? OFFSET ?
+	`
+
+	rows, err := s.rdb.Query(query, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	files, err := s.scanFiles(rows)
+	return files, total, err
+}
+
+// fileSearchWhere builds the WHERE clause of a file search.
+// Substrings of at least three characters are looked up in the trigram
+// index files_path_fts; shorter ones and globs scan the files table.
+func fileSearchWhere(search domain.FileSearch) (string, []interface{}) {
+	conds := []string{"1=1"}
+	var args []interface{}
+
+	switch {
+	case search.Path == "":
+	case search.IsGlob():
+		conds = append(conds, "path GLOB ?")
+		args = append(args, search.Path)
+	case utf8.RuneCountInString(search.Path) >= 3:
+		conds = append(conds, "id IN (SELECT rowid FROM files_path_fts WHERE files_path_fts MATCH ?)")
+		args = append(args, `"`+strings.ReplaceAll(search.Path, `"`, `""`)+`"`)
+	default:
+		conds = append(conds, "instr(lower(path), lower(?)) > 0")
+		args = append(args, search.Path)
+	}
+
+	if search.Cached != nil {
+		conds = append(conds, "cached = ?")
+		args = append(args, *search.Cached)
+	}
+	if search.Priority != nil {
+		conds = append(conds, "priority = ?")
+		args = append(args, *search.Priority)
+	}
+	if search.MinSize > 0 {
+		conds = append(conds, "size >= ?")
+		args = append(args, search.MinSize)
+	}
+	if search.MaxSize > 0 {
+		conds = append(conds, "size <= ?")
+		args = append(args, search.MaxSize)
+	}
+	if search.Owner != "" {
+		conds = append(conds, "owner = ?")
+		args = append(args, search.Owner)
+	}
+	if search.Label != "" {
+		conds = append(conds, "instr(',' || labels || ',', ?) > 0")
+		args = append(args, ","+search.Label+",")
+	}
+
+	return strings.Join(conds, " AND "), args
+}
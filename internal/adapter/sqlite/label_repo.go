@@ -0,0 +1,158 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+)
+
+// labelUsageQuery selects labels with the counts of their files. SQLite does
+// not enforce the foreign keys, so mappings of deleted files are skipped by the join.
+const labelUsageQuery = `
+	SELECT l.id, l.syno_label_id, l.name, l.sync_excluded, l.last_sync_at,
+		COUNT(f.id), COALESCE(SUM(f.size), 0),
+		COALESCE(SUM(CASE WHEN f.cached THEN 1 ELSE 0 END), 0),
+		COALESCE(SUM(CASE WHEN f.cached THEN f.size ELSE 0 END), 0)
+	FROM labels l
+	LEFT JOIN file_labels fl ON fl.label_id = l.id
+	LEFT JOIN files f ON f.id = fl.file_id
+`
+
+// SyncLabels replaces the stored labels and rebuilds the file mappings
+func (s *Store) SyncLabels(labels []*domain.Label) error {
+	now := time.Now().UTC()
+
+	return s.withImmediateTx(func(ctx context.Context, conn *sql.Conn) error {
+		keep := make([]interface{}, 0, len(labels))
+		for _, label := range labels {
+			err := conn.QueryRowContext(ctx, `
+				INSERT INTO labels (syno_label_id, name, sync_excluded, last_sync_at)
+				VALUES (?, ?, ?, ?)
+				ON CONFLICT(syno_label_id) DO UPDATE SET
+					name = excluded.name,
+					sync_excluded = excluded.sync_excluded,
+					last_sync_at = excluded.last_sync_at
+				RETURNING id
+			`, label.SynoLabelID, label.Name, label.Excluded, now).Scan(&label.ID)
+			if err != nil {
+				return err
+			}
+			label.LastSyncAt = now
+			keep = append(keep, label.SynoLabelID)
+		}
+
+		// Labels deleted on the NAS
+		remove := "DELETE FROM labels"
+		if len(keep) > 0 {
+			remove += " WHERE syno_label_id NOT IN (?" + strings.Repeat(", ?", len(keep)-1) + ")"
+		}
+		if _, err := conn.ExecContext(ctx, remove, keep...); err != nil {
+			return err
+		}
+
+		if _, err := conn.ExecContext(ctx, "DELETE FROM file_labels"); err != nil {
+			return err
+		}
+		_, err := conn.ExecContext(ctx, `
+			INSERT INTO file_labels (file_id, label_id)
+			SELECT f.id, l.id
+			FROM files f
+			JOIN labels l ON instr(',' || f.labels || ',', ',' || l.name || ',') > 0
+			WHERE f.labels <> ''
+		`)
+		return err
+	})
+}
+
+// ListLabels returns all labels with their file counts, ordered by name
+func (s *Store) ListLabels() ([]*domain.LabelUsage, error) {
+	rows, err := s.rdb.Query(labelUsageQuery + ` GROUP BY l.id ORDER BY l.name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var labels []*domain.LabelUsage
+	for rows.Next() {
+		label, err := scanLabelUsage(rows)
+		if err != nil {
+			return nil, err
+		}
+		labels = append(labels, label)
+	}
+	return labels, rows.Err()
+}
+
+// GetLabel returns a label with its file counts, or nil if it does not exist
+func (s *Store) GetLabel(id int64) (*domain.LabelUsage, error) {
+	label, err := scanLabelUsage(s.rdb.QueryRow(labelUsageQuery+` WHERE l.id = ? GROUP BY l.id`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return label, err
+}
+
+// ListLabelFiles returns a page of the files carrying a label and their total number
+func (s *Store) ListLabelFiles(labelID int64, cached *bool, limit, offset int) ([]*domain.File, int, error) {
+	where := "id IN (SELECT file_id FROM file_labels WHERE label_id = ?)"
+	args := []interface{}{labelID}
+	if cached != nil {
+		where += " AND cached = ?"
+		args = append(args, *cached)
+	}
+
+	var total int
+	if err := s.rdb.QueryRow(`SELECT COUNT(*) FROM files WHERE `+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := `
+		SELECT id, syno_file_id, path, size, modified_at, accessed_at,
+			   starred, shared, last_sync_at, cached, cache_path, cache_encoding,
+			   priority, owner, labels, content_type, export_format, cache_state, content_hash, last_access_in_cache_at, access_count, bytes_served, miss_count, missing_upstream_at, rejected_reason, stale, created_at, updated_at
+		FROM files
+		WHERE ` + where + `
+		ORDER BY path
+		LIMIT ? OFFSET ?
+	`
+
+	rows, err := s.rdb.Query(query, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	files, err := s.scanFiles(rows)
+	return files, total, err
+}
+
+// updateFileLabels maps a file to the stored labels named in its comma-joined labels
+func updateFileLabels(ctx context.Context, conn *sql.Conn, fileID int64, labels string) error {
+	if _, err := conn.ExecContext(ctx, "DELETE FROM file_labels WHERE file_id = ?", fileID); err != nil {
+		return err
+	}
+	if labels == "" {
+		return nil
+	}
+	_, err := conn.ExecContext(ctx, `
+		INSERT INTO file_labels (file_id, label_id)
+		SELECT ?, id FROM labels WHERE instr(',' || ? || ',', ',' || name || ',') > 0
+	`, fileID, labels)
+	return err
+}
+
+// scanLabelUsage scans a row selected with labelUsageQuery
+func scanLabelUsage(row interface{ Scan(...interface{}) error }) (*domain.LabelUsage, error) {
+	label := &domain.LabelUsage{}
+	err := row.Scan(
+		&label.ID, &label.SynoLabelID, &label.Name, &label.Excluded, &label.LastSyncAt,
+		&label.Files, &label.TotalBytes, &label.CachedFiles, &label.CachedBytes,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return label, nil
+}
@@ -0,0 +1,32 @@
+package sqlite
+
+import (
+	"time"
+)
+
+// AcquireLease takes or renews the named lease for holder until ttl from now.
+// expires_at is stored as Unix milliseconds, so instances sharing the
+// database must have reasonably synchronised clocks.
+func (s *Store) AcquireLease(name, holder string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+
+	result, err := s.exec(`
+		INSERT INTO leases (name, holder, expires_at) VALUES (?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET
+			holder = excluded.holder,
+			expires_at = excluded.expires_at
+		WHERE leases.holder = excluded.holder OR leases.expires_at < ?
+	`, name, holder, now.Add(ttl).UnixMilli(), now.UnixMilli())
+	if err != nil {
+		return false, err
+	}
+
+	count, err := result.RowsAffected()
+	return count > 0, err
+}
+
+// ReleaseLease gives up the named lease if it is held by holder
+func (s *Store) ReleaseLease(name, holder string) error {
+	_, err := s.exec(`DELETE FROM leases WHERE name = ? AND holder = ?`, name, holder)
+	return err
+}
@@ -0,0 +1,543 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/util/passhash"
+)
+
+// migration is a versioned schema change. Migrations are applied in
+// ascending version order, each in its own transaction, and recorded in
+// schema_migrations. New schema changes are appended with the next version;
+// released migrations must never be edited.
+type migration struct {
+	version int
+	name    string
+	up      func(ctx context.Context, conn *sql.Conn) error
+	down    func(ctx context.Context, conn *sql.Conn) error // nil when the change cannot be reverted
+}
+
+// migrations is the ordered schema history
+var migrations = []migration{
+	{version: 1, name: "baseline", up: migrateBaseline},
+	{
+		version: 2,
+		name:    "file_access_counters",
+		up: execStatements(
+			`ALTER TABLE files ADD COLUMN access_count INTEGER NOT NULL DEFAULT 0`,
+			`ALTER TABLE files ADD COLUMN bytes_served INTEGER NOT NULL DEFAULT 0`,
+			`ALTER TABLE files ADD COLUMN miss_count INTEGER NOT NULL DEFAULT 0`,
+		),
+		down: execStatements(
+			`ALTER TABLE files DROP COLUMN miss_count`,
+			`ALTER TABLE files DROP COLUMN bytes_served`,
+			`ALTER TABLE files DROP COLUMN access_count`,
+		),
+	},
+	{
+		version: 3,
+		name:    "file_rejected_reason",
+		up: execStatements(
+			`ALTER TABLE files ADD COLUMN rejected_reason TEXT NOT NULL DEFAULT ''`,
+		),
+		down: execStatements(
+			`ALTER TABLE files DROP COLUMN rejected_reason`,
+		),
+	},
+	{
+		version: 4,
+		name:    "replicated_files",
+		up: execStatements(
+			`CREATE TABLE replicated_files (
+				syno_file_id TEXT PRIMARY KEY,
+				size INTEGER NOT NULL,
+				modified_at TIMESTAMP,
+				cache_path TEXT NOT NULL,
+				cache_encoding TEXT NOT NULL DEFAULT '',
+				replicated_at TIMESTAMP NOT NULL
+			)`,
+		),
+		down: execStatements(
+			`DROP TABLE replicated_files`,
+		),
+	},
+	{
+		version: 5,
+		name:    "file_stale",
+		up: execStatements(
+			`ALTER TABLE files ADD COLUMN stale BOOLEAN NOT NULL DEFAULT FALSE`,
+		),
+		down: execStatements(
+			`ALTER TABLE files DROP COLUMN stale`,
+		),
+	},
+	{
+		version: 6,
+		name:    "share_cache_control",
+		up: execStatements(
+			`ALTER TABLE shares ADD COLUMN cache_control TEXT NOT NULL DEFAULT ''`,
+		),
+		down: execStatements(
+			`ALTER TABLE shares DROP COLUMN cache_control`,
+		),
+	},
+}
+
+// execStatements returns a migration step running statements in order
+func execStatements(statements ...string) func(ctx context.Context, conn *sql.Conn) error {
+	return func(ctx context.Context, conn *sql.Conn) error {
+		for _, stmt := range statements {
+			if _, err := conn.ExecContext(ctx, stmt); err != nil {
+				return fmt.Errorf("%w\nSQL: %s", err, stmt)
+			}
+		}
+		return nil
+	}
+}
+
+// migrate brings the schema up to the latest version
+func (s *Store) migrate() error {
+	return s.applyMigrations(migrations)
+}
+
+// applyMigrations applies the migrations newer than the recorded schema
+// version. It refuses to touch a schema written by a newer build.
+func (s *Store) applyMigrations(list []migration) error {
+	if _, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	current, err := s.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	latest := list[len(list)-1].version
+	if current > latest {
+		return fmt.Errorf("%w: database is at version %d, this build supports up to %d",
+			domain.ErrSchemaTooNew, current, latest)
+	}
+
+	for _, m := range list {
+		if m.version <= current {
+			continue
+		}
+		err := s.withImmediateTx(func(ctx context.Context, conn *sql.Conn) error {
+			if err := m.up(ctx, conn); err != nil {
+				return err
+			}
+			_, err := conn.ExecContext(ctx,
+				"INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+				m.version, m.name, time.Now().UTC())
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", m.version, m.name, err)
+		}
+	}
+
+	return nil
+}
+
+// SchemaVersion returns the latest applied migration version, 0 for an empty database
+func (s *Store) SchemaVersion() (int, error) {
+	var version int
+	if err := s.db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return version, nil
+}
+
+// MigrateDown reverts the applied migrations newer than version, newest first.
+// Run it with the build that applied them before downgrading.
+func (s *Store) MigrateDown(version int) error {
+	return s.revertMigrations(migrations, version)
+}
+
+// revertMigrations reverts the migrations in list newer than version
+func (s *Store) revertMigrations(list []migration, version int) error {
+	current, err := s.SchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	for i := len(list) - 1; i >= 0; i-- {
+		m := list[i]
+		if m.version <= version || m.version > current {
+			continue
+		}
+		if m.down == nil {
+			return fmt.Errorf("migration %d (%s) cannot be reverted", m.version, m.name)
+		}
+		err := s.withImmediateTx(func(ctx context.Context, conn *sql.Conn) error {
+			if err := m.down(ctx, conn); err != nil {
+				return err
+			}
+			_, err := conn.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = ?", m.version)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("reverting migration %d (%s) failed: %w", m.version, m.name, err)
+		}
+	}
+
+	return nil
+}
+
+// baselineTables are the tables of the schema before versioned migrations
+var baselineTables = []string{
+	// Create files table
+	`CREATE TABLE IF NOT EXISTS files (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		syno_file_id TEXT UNIQUE NOT NULL,
+		path TEXT NOT NULL,
+		size INTEGER NOT NULL DEFAULT 0,
+		modified_at TIMESTAMP,
+		accessed_at TIMESTAMP,
+		starred BOOLEAN DEFAULT FALSE,
+		shared BOOLEAN DEFAULT FALSE,
+		last_sync_at TIMESTAMP,
+		cached BOOLEAN DEFAULT FALSE,
+		cache_path TEXT,
+		priority INTEGER DEFAULT 5,
+		last_access_in_cache_at TIMESTAMP,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`,
+
+	// Create shares table
+	`CREATE TABLE IF NOT EXISTS shares (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		syno_share_id TEXT UNIQUE NOT NULL,
+		token TEXT UNIQUE NOT NULL,
+		file_id INTEGER NOT NULL,
+		password TEXT,
+		expires_at TIMESTAMP,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		revoked BOOLEAN DEFAULT FALSE,
+		FOREIGN KEY (file_id) REFERENCES files(id) ON DELETE CASCADE
+	)`,
+
+	// Create meta table for storing sync state
+	`CREATE TABLE IF NOT EXISTS meta (
+		key TEXT PRIMARY KEY,
+		value TEXT,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`,
+
+	// Create download_tasks table for task queue based downloads
+	`CREATE TABLE IF NOT EXISTS download_tasks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		file_id INTEGER NOT NULL,
+		syno_path TEXT NOT NULL,
+		priority INTEGER NOT NULL DEFAULT 5,
+		size INTEGER NOT NULL DEFAULT 0,
+		status TEXT NOT NULL DEFAULT 'pending',
+		worker_id TEXT,
+		temp_file_path TEXT,
+		bytes_downloaded INTEGER NOT NULL DEFAULT 0,
+		retry_count INTEGER NOT NULL DEFAULT 0,
+		max_retries INTEGER NOT NULL DEFAULT 3,
+		next_retry_at TIMESTAMP,
+		last_error TEXT,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		claimed_at TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (file_id) REFERENCES files(id) ON DELETE CASCADE
+	)`,
+
+	// Create admin_users table for multi-user admin auth
+	`CREATE TABLE IF NOT EXISTS admin_users (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		username TEXT UNIQUE NOT NULL,
+		password_hash TEXT NOT NULL,
+		role TEXT NOT NULL DEFAULT 'viewer',
+		disabled BOOLEAN DEFAULT FALSE,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`,
+
+	// Create api_tokens table for admin API automation
+	`CREATE TABLE IF NOT EXISTS api_tokens (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		name TEXT NOT NULL DEFAULT '',
+		token_hash TEXT UNIQUE NOT NULL,
+		prefix TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		last_used_at TIMESTAMP,
+		expires_at TIMESTAMP,
+		revoked BOOLEAN DEFAULT FALSE,
+		FOREIGN KEY (user_id) REFERENCES admin_users(id) ON DELETE CASCADE
+	)`,
+
+	// Create audit_events table for admin and share action history
+	`CREATE TABLE IF NOT EXISTS audit_events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		actor TEXT NOT NULL,
+		action TEXT NOT NULL,
+		target TEXT,
+		remote_addr TEXT,
+		details TEXT
+	)`,
+
+	// Create leases table for electing a single active instance
+	`CREATE TABLE IF NOT EXISTS leases (
+		name TEXT PRIMARY KEY,
+		holder TEXT NOT NULL,
+		expires_at INTEGER NOT NULL
+	)`,
+
+	// Create preseed_paths table for folders that are always cached
+	`CREATE TABLE IF NOT EXISTS preseed_paths (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		path TEXT UNIQUE NOT NULL,
+		created_by TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`,
+
+	// Create file_chunks table for chunks of partially cached large files
+	`CREATE TABLE IF NOT EXISTS file_chunks (
+		file_id INTEGER NOT NULL,
+		chunk_index INTEGER NOT NULL,
+		size INTEGER NOT NULL,
+		version INTEGER NOT NULL DEFAULT 0,
+		accessed_at TIMESTAMP,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (file_id, chunk_index),
+		FOREIGN KEY (file_id) REFERENCES files(id) ON DELETE CASCADE
+	)`,
+
+	// Create labels and file_labels tables for label browsing
+	`CREATE TABLE IF NOT EXISTS labels (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		syno_label_id TEXT UNIQUE NOT NULL,
+		name TEXT NOT NULL,
+		sync_excluded BOOLEAN NOT NULL DEFAULT FALSE,
+		last_sync_at TIMESTAMP NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS file_labels (
+		file_id INTEGER NOT NULL,
+		label_id INTEGER NOT NULL,
+		PRIMARY KEY (file_id, label_id),
+		FOREIGN KEY (file_id) REFERENCES files(id) ON DELETE CASCADE,
+		FOREIGN KEY (label_id) REFERENCES labels(id) ON DELETE CASCADE
+	)`,
+
+	// Create stat_snapshots table for the admin dashboard charts
+	`CREATE TABLE IF NOT EXISTS stat_snapshots (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		instance TEXT NOT NULL DEFAULT '',
+		taken_at TIMESTAMP NOT NULL,
+		total_files INTEGER NOT NULL DEFAULT 0,
+		cached_files INTEGER NOT NULL DEFAULT 0,
+		cached_bytes INTEGER NOT NULL DEFAULT 0,
+		cache_hits INTEGER NOT NULL DEFAULT 0,
+		cache_misses INTEGER NOT NULL DEFAULT 0,
+		downloaded_bytes INTEGER NOT NULL DEFAULT 0,
+		pending_tasks INTEGER NOT NULL DEFAULT 0,
+		in_progress_tasks INTEGER NOT NULL DEFAULT 0,
+		failed_tasks INTEGER NOT NULL DEFAULT 0,
+		queued_bytes INTEGER NOT NULL DEFAULT 0
+	)`,
+}
+
+// baselineColumns are the columns added to baselineTables before versioned
+// migrations. Databases created by older builds may lack any of them.
+var baselineColumns = []struct {
+	table, name, definition string
+}{
+	{"shares", "sharing_link", "TEXT DEFAULT ''"},
+	{"shares", "url", "TEXT DEFAULT ''"},
+	{"download_tasks", "aged_at", "TIMESTAMP"},
+	{"files", "cache_encoding", "TEXT NOT NULL DEFAULT ''"},
+	{"files", "owner", "TEXT NOT NULL DEFAULT ''"},
+	{"files", "labels", "TEXT NOT NULL DEFAULT ''"},
+	{"files", "content_type", "TEXT NOT NULL DEFAULT ''"},
+	{"files", "export_format", "TEXT NOT NULL DEFAULT ''"},
+	{"files", "cache_state", "TEXT NOT NULL DEFAULT ''"},
+	{"files", "content_hash", "TEXT NOT NULL DEFAULT ''"},
+	{"shares", "max_downloads", "INTEGER NOT NULL DEFAULT 0"},
+	{"shares", "nas_max_downloads", "INTEGER NOT NULL DEFAULT 0"},
+	{"shares", "download_count", "INTEGER NOT NULL DEFAULT 0"},
+	{"shares", "allowed_ips", "TEXT NOT NULL DEFAULT ''"},
+	{"shares", "denied_ips", "TEXT NOT NULL DEFAULT ''"},
+	{"shares", "require_signature", "BOOLEAN NOT NULL DEFAULT FALSE"},
+	{"stat_snapshots", "served_bytes", "INTEGER NOT NULL DEFAULT 0"},
+	{"files", "missing_upstream_at", "TIMESTAMP"},
+}
+
+// baselineIndexes are the indexes of the schema before versioned migrations
+var baselineIndexes = []string{
+	`CREATE INDEX IF NOT EXISTS idx_files_syno_file_id ON files(syno_file_id)`,
+	`CREATE INDEX IF NOT EXISTS idx_files_path ON files(path)`,
+	`CREATE INDEX IF NOT EXISTS idx_files_priority ON files(priority)`,
+	`CREATE INDEX IF NOT EXISTS idx_files_cached ON files(cached)`,
+	`CREATE INDEX IF NOT EXISTS idx_files_last_access ON files(last_access_in_cache_at)`,
+	`CREATE INDEX IF NOT EXISTS idx_files_size ON files(size)`,
+	`CREATE INDEX IF NOT EXISTS idx_files_modified_at ON files(modified_at)`,
+	`CREATE INDEX IF NOT EXISTS idx_shares_token ON shares(token)`,
+	`CREATE INDEX IF NOT EXISTS idx_shares_file_id ON shares(file_id)`,
+	`CREATE INDEX IF NOT EXISTS idx_download_tasks_status ON download_tasks(status)`,
+	`CREATE INDEX IF NOT EXISTS idx_download_tasks_priority ON download_tasks(priority, size)`,
+	`CREATE INDEX IF NOT EXISTS idx_download_tasks_file_id ON download_tasks(file_id)`,
+	`CREATE INDEX IF NOT EXISTS idx_api_tokens_user_id ON api_tokens(user_id)`,
+	`CREATE INDEX IF NOT EXISTS idx_audit_events_created_at ON audit_events(created_at)`,
+	`CREATE INDEX IF NOT EXISTS idx_audit_events_actor ON audit_events(actor)`,
+	`CREATE INDEX IF NOT EXISTS idx_file_chunks_accessed_at ON file_chunks(accessed_at)`,
+	`CREATE INDEX IF NOT EXISTS idx_stat_snapshots_instance_taken_at ON stat_snapshots(instance, taken_at)`,
+	`CREATE INDEX IF NOT EXISTS idx_file_labels_label_id ON file_labels(label_id)`,
+	`CREATE INDEX IF NOT EXISTS idx_files_owner ON files(owner)`,
+	`CREATE INDEX IF NOT EXISTS idx_files_cache_state ON files(cache_state) WHERE cache_state <> ''`,
+	`CREATE INDEX IF NOT EXISTS idx_files_cache_path ON files(cache_path)`,
+	`CREATE INDEX IF NOT EXISTS idx_files_missing_upstream_at ON files(missing_upstream_at) WHERE missing_upstream_at IS NOT NULL`,
+}
+
+// migrateBaseline creates the schema as it was before versioned migrations.
+// Databases created by older builds are at an unknown point of it, so every
+// step checks what already exists.
+func migrateBaseline(ctx context.Context, conn *sql.Conn) error {
+	if err := execStatements(baselineTables...)(ctx, conn); err != nil {
+		return err
+	}
+	for _, c := range baselineColumns {
+		if err := addColumn(ctx, conn, c.table, c.name, c.definition); err != nil {
+			return err
+		}
+	}
+	if err := execStatements(baselineIndexes...)(ctx, conn); err != nil {
+		return err
+	}
+
+	if err := migrateDownloadTempFiles(ctx, conn); err != nil {
+		return fmt.Errorf("failed to migrate download_temp_files: %w", err)
+	}
+	if err := migratePathIndex(ctx, conn); err != nil {
+		return fmt.Errorf("failed to create path search index: %w", err)
+	}
+	if err := migrateSharePasswords(ctx, conn); err != nil {
+		return fmt.Errorf("failed to hash share passwords: %w", err)
+	}
+	return nil
+}
+
+// addColumn adds a column to table unless it already exists
+func addColumn(ctx context.Context, conn *sql.Conn, table, column, definition string) error {
+	var exists int
+	if err := conn.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", table, column,
+	).Scan(&exists); err != nil {
+		return err
+	}
+	if exists > 0 {
+		return nil
+	}
+	return execStatements(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))(ctx, conn)
+}
+
+// migratePathIndex creates the trigram index used by path searches. It is
+// filled from the files table once and kept current by triggers.
+func migratePathIndex(ctx context.Context, conn *sql.Conn) error {
+	var exists int
+	if err := conn.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'files_path_fts'",
+	).Scan(&exists); err != nil {
+		return err
+	}
+
+	statements := []string{
+		`CREATE VIRTUAL TABLE IF NOT EXISTS files_path_fts
+			USING fts5(path, content='files', content_rowid='id', tokenize='trigram')`,
+		`CREATE TRIGGER IF NOT EXISTS files_path_fts_insert AFTER INSERT ON files BEGIN
+			INSERT INTO files_path_fts(rowid, path) VALUES (new.id, new.path);
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS files_path_fts_delete AFTER DELETE ON files BEGIN
+			INSERT INTO files_path_fts(files_path_fts, rowid, path) VALUES ('delete', old.id, old.path);
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS files_path_fts_update AFTER UPDATE OF path ON files
+		WHEN old.path <> new.path BEGIN
+			INSERT INTO files_path_fts(files_path_fts, rowid, path) VALUES ('delete', old.id, old.path);
+			INSERT INTO files_path_fts(rowid, path) VALUES (new.id, new.path);
+		END`,
+	}
+	if exists == 0 {
+		statements = append(statements, `INSERT INTO files_path_fts(files_path_fts) VALUES ('rebuild')`)
+	}
+
+	return execStatements(statements...)(ctx, conn)
+}
+
+// migrateSharePasswords replaces plaintext share passwords with salted hashes
+func migrateSharePasswords(ctx context.Context, conn *sql.Conn) error {
+	rows, err := conn.QueryContext(ctx,
+		"SELECT id, password FROM shares WHERE password IS NOT NULL AND password != ''")
+	if err != nil {
+		return err
+	}
+
+	type plainPassword struct {
+		id       int64
+		password string
+	}
+	var pending []plainPassword
+	for rows.Next() {
+		var p plainPassword
+		if err := rows.Scan(&p.id, &p.password); err != nil {
+			rows.Close()
+			return err
+		}
+		if !passhash.IsHashed(p.password) {
+			pending = append(pending, p)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, p := range pending {
+		hashed, err := passhash.Hash(p.password)
+		if err != nil {
+			return err
+		}
+		if _, err := conn.ExecContext(ctx, "UPDATE shares SET password = ? WHERE id = ?", hashed, p.id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrateDownloadTempFiles moves resumable downloads from the old
+// download_temp_files table to download_tasks and drops the old table
+func migrateDownloadTempFiles(ctx context.Context, conn *sql.Conn) error {
+	var exists int
+	if err := conn.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'download_temp_files'",
+	).Scan(&exists); err != nil {
+		return err
+	}
+	if exists == 0 {
+		return nil
+	}
+
+	return execStatements(
+		`INSERT OR IGNORE INTO download_tasks (file_id, syno_path, temp_file_path, bytes_downloaded, status, priority, size)
+		SELECT f.id, dtf.syno_path, dtf.temp_file_path, dtf.size_downloaded, 'pending', f.priority, f.size
+		FROM download_temp_files dtf
+		INNER JOIN files f ON dtf.syno_path = f.path
+		WHERE NOT EXISTS (
+			SELECT 1 FROM download_tasks dt
+			WHERE dt.file_id = f.id AND dt.status IN ('pending', 'in_progress')
+		)`,
+		"DROP TABLE download_temp_files",
+	)(ctx, conn)
+}
@@ -0,0 +1,126 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+)
+
+func openTestStore(t *testing.T, dbPath string) *Store {
+	t.Helper()
+	s, err := Open(dbPath, Options{})
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestMigrate_RecordsLatestVersion(t *testing.T) {
+	s := openTestStore(t, filepath.Join(t.TempDir(), "cache.db"))
+
+	version, err := s.SchemaVersion()
+	if err != nil {
+		t.Fatalf("SchemaVersion() error = %v", err)
+	}
+	if want := migrations[len(migrations)-1].version; version != want {
+		t.Errorf("SchemaVersion() = %d, want %d", version, want)
+	}
+}
+
+func TestMigrate_UpgradesUnversionedDatabase(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "cache.db")
+
+	// A database written before versioned migrations, lacking later columns
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`CREATE TABLE files (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		syno_file_id TEXT UNIQUE NOT NULL,
+		path TEXT NOT NULL,
+		size INTEGER NOT NULL DEFAULT 0,
+		modified_at TIMESTAMP,
+		accessed_at TIMESTAMP,
+		starred BOOLEAN DEFAULT FALSE,
+		shared BOOLEAN DEFAULT FALSE,
+		last_sync_at TIMESTAMP,
+		cached BOOLEAN DEFAULT FALSE,
+		cache_path TEXT,
+		priority INTEGER DEFAULT 5,
+		last_access_in_cache_at TIMESTAMP,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		owner TEXT NOT NULL DEFAULT ''
+	)`)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := openTestStore(t, dbPath)
+
+	result, err := s.UpsertBySynoID(&domain.File{SynoFileID: "1", Path: "/a.txt", Owner: "alice"})
+	if err != nil {
+		t.Fatalf("UpsertBySynoID() error = %v", err)
+	}
+	if result.File.Owner != "alice" {
+		t.Errorf("Owner = %q, want alice", result.File.Owner)
+	}
+}
+
+func TestMigrate_RefusesNewerSchema(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "cache.db")
+
+	s, err := Open(dbPath, Options{})
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if _, err := s.db.Exec(
+		"INSERT INTO schema_migrations (version, name, applied_at) VALUES (9999, 'future', CURRENT_TIMESTAMP)",
+	); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	if _, err := Open(dbPath, Options{}); !errors.Is(err, domain.ErrSchemaTooNew) {
+		t.Errorf("Open() error = %v, want ErrSchemaTooNew", err)
+	}
+}
+
+func TestMigrate_Down(t *testing.T) {
+	s := openTestStore(t, filepath.Join(t.TempDir(), "cache.db"))
+
+	list := append(migrations[:len(migrations):len(migrations)], migration{
+		version: migrations[len(migrations)-1].version + 1,
+		name:    "add_notes",
+		up:      execStatements(`CREATE TABLE notes (id INTEGER PRIMARY KEY)`),
+		down:    execStatements(`DROP TABLE notes`),
+	})
+	if err := s.applyMigrations(list); err != nil {
+		t.Fatalf("applyMigrations() error = %v", err)
+	}
+	if version, _ := s.SchemaVersion(); version != list[len(list)-1].version {
+		t.Fatalf("SchemaVersion() = %d, want %d", version, list[len(list)-1].version)
+	}
+
+	base := migrations[len(migrations)-1].version
+	if err := s.revertMigrations(list, base); err != nil {
+		t.Fatalf("revertMigrations() error = %v", err)
+	}
+	if version, _ := s.SchemaVersion(); version != base {
+		t.Errorf("SchemaVersion() = %d, want %d", version, base)
+	}
+	if _, err := s.db.Exec("SELECT 1 FROM notes"); err == nil {
+		t.Error("notes table still exists after reverting")
+	}
+
+	// The baseline cannot be reverted
+	if err := s.revertMigrations(list, 0); err == nil {
+		t.Error("revertMigrations(0) succeeded, want error for the baseline")
+	}
+}
@@ -0,0 +1,66 @@
+package sqlite
+
+import (
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+)
+
+// ListPreseedPaths returns all pre-seeded paths ordered by path
+func (s *Store) ListPreseedPaths() ([]*domain.PreseedPath, error) {
+	rows, err := s.db.Query(`SELECT id, path, created_by, created_at FROM preseed_paths ORDER BY path`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var paths []*domain.PreseedPath
+	for rows.Next() {
+		p := &domain.PreseedPath{}
+		if err := rows.Scan(&p.ID, &p.Path, &p.CreatedBy, &p.CreatedAt); err != nil {
+			return nil, err
+		}
+		paths = append(paths, p)
+	}
+	return paths, rows.Err()
+}
+
+// AddPreseedPath stores a new pre-seeded path
+func (s *Store) AddPreseedPath(p *domain.PreseedPath) error {
+	now := time.Now()
+	result, err := s.exec(`
+		INSERT INTO preseed_paths (path, created_by, created_at) VALUES (?, ?, ?)
+	`, p.Path, p.CreatedBy, now)
+	if err != nil {
+		if isUniqueConstraintError(err) {
+			return domain.ErrAlreadyExists
+		}
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	p.ID = id
+	p.CreatedAt = now
+	return nil
+}
+
+// DeletePreseedPath removes a pre-seeded path by ID
+func (s *Store) DeletePreseedPath(id int64) error {
+	result, err := s.exec(`DELETE FROM preseed_paths WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
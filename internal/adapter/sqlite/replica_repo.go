@@ -0,0 +1,91 @@
+package sqlite
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+)
+
+// ListReplicationPending returns up to limit cached files that have no
+// replica yet or whose copy changed since it was replicated
+func (s *Store) ListReplicationPending(limit int) ([]*domain.File, error) {
+	query := `
+		SELECT id, syno_file_id, path, size, modified_at, accessed_at,
+			   starred, shared, last_sync_at, cached, cache_path, cache_encoding,
+			   priority, owner, labels, content_type, export_format, cache_state, content_hash, last_access_in_cache_at, access_count, bytes_served, miss_count, missing_upstream_at, rejected_reason, stale, created_at, updated_at
+		FROM files
+		WHERE cached = TRUE AND cache_state = ''
+		  AND NOT EXISTS (
+			SELECT 1 FROM replicated_files r
+			WHERE r.syno_file_id = files.syno_file_id
+			  AND r.size = files.size
+			  AND r.modified_at IS files.modified_at
+			  AND r.cache_path = files.cache_path
+			  AND r.cache_encoding = files.cache_encoding
+		  )
+		ORDER BY priority, id
+		LIMIT ?
+	`
+
+	rows, err := s.db.Query(query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return s.scanFiles(rows)
+}
+
+// ListReplicationStale returns up to limit Synology file IDs that were
+// replicated but are no longer cached
+func (s *Store) ListReplicationStale(limit int) ([]string, error) {
+	rows, err := s.db.Query(`
+		SELECT r.syno_file_id
+		FROM replicated_files r
+		LEFT JOIN files f ON f.syno_file_id = r.syno_file_id
+		WHERE f.id IS NULL OR (f.cached = FALSE AND f.cache_state <> ?)
+		ORDER BY r.replicated_at
+		LIMIT ?
+	`, domain.CacheStateCaching, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanStrings(rows)
+}
+
+// MarkReplicated records that the current copy of file was replicated
+func (s *Store) MarkReplicated(file *domain.File) error {
+	_, err := s.exec(`
+		INSERT INTO replicated_files (syno_file_id, size, modified_at, cache_path, cache_encoding, replicated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (syno_file_id) DO UPDATE SET
+			size = excluded.size,
+			modified_at = excluded.modified_at,
+			cache_path = excluded.cache_path,
+			cache_encoding = excluded.cache_encoding,
+			replicated_at = excluded.replicated_at
+	`, file.SynoFileID, file.Size, file.ModifiedAt, file.CachePath, file.CacheEncoding, time.Now())
+	return err
+}
+
+// DeleteReplicated forgets the replica of a Synology file
+func (s *Store) DeleteReplicated(synoFileID string) error {
+	_, err := s.exec(`DELETE FROM replicated_files WHERE syno_file_id = ?`, synoFileID)
+	return err
+}
+
+// scanStrings reads a single text column of all rows and closes them
+func scanStrings(rows *sql.Rows) ([]string, error) {
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
@@ -0,0 +1,78 @@
+package sqlite
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+)
+
+func TestStore_Replication(t *testing.T) {
+	s := openTestStore(t, filepath.Join(t.TempDir(), "cache.db"))
+
+	modifiedAt := time.Now().Add(-time.Hour)
+	result, err := s.UpsertBySynoID(&domain.File{SynoFileID: "a", Path: "/a", Size: 10, ModifiedAt: &modifiedAt, Priority: domain.PriorityDefault})
+	if err != nil {
+		t.Fatalf("UpsertBySynoID() error = %v", err)
+	}
+	file := result.File
+	file.MarkCached("/cache/a")
+	if err := s.Update(file); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	cacheTestFile(t, s, "b")
+
+	pending, err := s.ListReplicationPending(10)
+	if err != nil {
+		t.Fatalf("ListReplicationPending() error = %v", err)
+	}
+	if len(pending) != 2 {
+		t.Fatalf("ListReplicationPending() = %d files, want 2", len(pending))
+	}
+	for _, f := range pending {
+		if err := s.MarkReplicated(f); err != nil {
+			t.Fatalf("MarkReplicated() error = %v", err)
+		}
+	}
+	if pending, _ := s.ListReplicationPending(10); len(pending) != 0 {
+		t.Errorf("ListReplicationPending() after MarkReplicated = %d files, want 0", len(pending))
+	}
+
+	// A newer version cached at the same path is replicated again
+	newer := modifiedAt.Add(time.Minute)
+	if _, err := s.UpsertBySynoID(&domain.File{SynoFileID: "a", Path: "/a", Size: 10, ModifiedAt: &newer, Priority: domain.PriorityDefault}); err != nil {
+		t.Fatalf("UpsertBySynoID() error = %v", err)
+	}
+	stale, err := s.ListReplicationStale(10)
+	if err != nil {
+		t.Fatalf("ListReplicationStale() error = %v", err)
+	}
+	if len(stale) != 1 || stale[0] != "a" {
+		t.Errorf("ListReplicationStale() = %v, want [a]", stale)
+	}
+	file, _ = s.GetBySynoID("a")
+	file.MarkCached("/cache/a")
+	if err := s.Update(file); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	pending, _ = s.ListReplicationPending(10)
+	if len(pending) != 1 || pending[0].SynoFileID != "a" {
+		t.Errorf("ListReplicationPending() after new version = %v, want [a]", pending)
+	}
+
+	// Deleted files are stale until their replica is forgotten
+	b, _ := s.GetBySynoID("b")
+	if err := s.Delete(b.ID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if stale, _ := s.ListReplicationStale(10); len(stale) != 1 || stale[0] != "b" {
+		t.Errorf("ListReplicationStale() after delete = %v, want [b]", stale)
+	}
+	if err := s.DeleteReplicated("b"); err != nil {
+		t.Fatalf("DeleteReplicated() error = %v", err)
+	}
+	if stale, _ := s.ListReplicationStale(10); len(stale) != 0 {
+		t.Errorf("ListReplicationStale() after DeleteReplicated = %v, want none", stale)
+	}
+}
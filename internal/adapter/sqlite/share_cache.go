@@ -0,0 +1,152 @@
+package sqlite
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+)
+
+// shareCacheEntry holds a cached token lookup result
+type shareCacheEntry struct {
+	token     string
+	file      domain.File
+	share     domain.Share
+	expiresAt time.Time
+}
+
+// shareCache is an LRU cache of share token -> (file, share) lookups with TTL.
+// Entries are indexed by file ID so file and share writes can invalidate them.
+type shareCache struct {
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	order    *list.List // front = most recently used
+	byToken  map[string]*list.Element
+	byFileID map[int64]map[string]struct{}
+
+	// generation is bumped on every invalidation so a lookup that raced
+	// with a write does not store a stale result
+	generation uint64
+}
+
+// newShareCache creates a share lookup cache
+func newShareCache(capacity int, ttl time.Duration) *shareCache {
+	return &shareCache{
+		capacity: capacity,
+		ttl:      ttl,
+		order:    list.New(),
+		byToken:  make(map[string]*list.Element),
+		byFileID: make(map[int64]map[string]struct{}),
+	}
+}
+
+// get returns copies of the cached file and share for a token
+func (c *shareCache) get(token string) (*domain.File, *domain.Share, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.byToken[token]
+	if !ok {
+		return nil, nil, false
+	}
+
+	entry := elem.Value.(*shareCacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.removeElement(elem)
+		return nil, nil, false
+	}
+
+	c.order.MoveToFront(elem)
+
+	// Return copies so callers cannot mutate cached state
+	file := entry.file
+	share := entry.share
+	return &file, &share, true
+}
+
+// snapshot returns the current generation, to be passed to set after a DB lookup
+func (c *shareCache) snapshot() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation
+}
+
+// set stores a lookup result, evicting the least recently used entry if full.
+// The result is dropped if an invalidation happened since snapshot.
+func (c *shareCache) set(generation uint64, token string, file *domain.File, share *domain.Share) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	if elem, ok := c.byToken[token]; ok {
+		c.removeElement(elem)
+	}
+
+	entry := &shareCacheEntry{
+		token:     token,
+		file:      *file,
+		share:     *share,
+		expiresAt: time.Now().Add(c.ttl),
+	}
+	c.byToken[token] = c.order.PushFront(entry)
+
+	tokens, ok := c.byFileID[file.ID]
+	if !ok {
+		tokens = make(map[string]struct{})
+		c.byFileID[file.ID] = tokens
+	}
+	tokens[token] = struct{}{}
+
+	for c.order.Len() > c.capacity {
+		c.removeElement(c.order.Back())
+	}
+}
+
+// invalidateToken drops the cached lookup for a token
+func (c *shareCache) invalidateToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	if elem, ok := c.byToken[token]; ok {
+		c.removeElement(elem)
+	}
+}
+
+// invalidateFile drops all cached lookups that reference a file
+func (c *shareCache) invalidateFile(fileID int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	for token := range c.byFileID[fileID] {
+		if elem, ok := c.byToken[token]; ok {
+			c.removeElement(elem)
+		}
+	}
+}
+
+// len returns the number of cached entries
+func (c *shareCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// removeElement removes an entry from the list and indexes. Caller holds mu.
+func (c *shareCache) removeElement(elem *list.Element) {
+	entry := c.order.Remove(elem).(*shareCacheEntry)
+	delete(c.byToken, entry.token)
+
+	if tokens, ok := c.byFileID[entry.file.ID]; ok {
+		delete(tokens, entry.token)
+		if len(tokens) == 0 {
+			delete(c.byFileID, entry.file.ID)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package sqlite
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+)
+
+func TestShareCache_GetSet(t *testing.T) {
+	c := newShareCache(10, time.Minute)
+
+	if _, _, ok := c.get("abc"); ok {
+		t.Fatal("expected miss on empty cache")
+	}
+
+	c.set(c.snapshot(), "abc", &domain.File{ID: 1, Path: "/a"}, &domain.Share{ID: 7, Token: "abc"})
+
+	file, share, ok := c.get("abc")
+	if !ok {
+		t.Fatal("expected hit")
+	}
+	if file.ID != 1 || share.ID != 7 {
+		t.Errorf("got file %d share %d, want 1 and 7", file.ID, share.ID)
+	}
+
+	// Mutating the returned copy must not affect the cache
+	file.Path = "/mutated"
+	file, _, _ = c.get("abc")
+	if file.Path != "/a" {
+		t.Errorf("cached file was mutated: %q", file.Path)
+	}
+}
+
+func TestShareCache_Expiry(t *testing.T) {
+	c := newShareCache(10, 10*time.Millisecond)
+	c.set(c.snapshot(), "abc", &domain.File{ID: 1}, &domain.Share{Token: "abc"})
+
+	time.Sleep(20 * time.Millisecond)
+
+	if _, _, ok := c.get("abc"); ok {
+		t.Error("expected expired entry to miss")
+	}
+	if c.len() != 0 {
+		t.Errorf("len = %d, want 0", c.len())
+	}
+}
+
+func TestShareCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	c := newShareCache(2, time.Minute)
+	c.set(c.snapshot(), "a", &domain.File{ID: 1}, &domain.Share{Token: "a"})
+	c.set(c.snapshot(), "b", &domain.File{ID: 2}, &domain.Share{Token: "b"})
+
+	// Touch "a" so "b" becomes the eviction candidate
+	c.get("a")
+	c.set(c.snapshot(), "c", &domain.File{ID: 3}, &domain.Share{Token: "c"})
+
+	if _, _, ok := c.get("b"); ok {
+		t.Error("expected b to be evicted")
+	}
+	if _, _, ok := c.get("a"); !ok {
+		t.Error("expected a to remain")
+	}
+	if _, _, ok := c.get("c"); !ok {
+		t.Error("expected c to remain")
+	}
+}
+
+func TestShareCache_Invalidate(t *testing.T) {
+	c := newShareCache(10, time.Minute)
+	c.set(c.snapshot(), "a", &domain.File{ID: 1}, &domain.Share{Token: "a"})
+	c.set(c.snapshot(), "b", &domain.File{ID: 1}, &domain.Share{Token: "b"})
+	c.set(c.snapshot(), "c", &domain.File{ID: 2}, &domain.Share{Token: "c"})
+
+	c.invalidateFile(1)
+	if c.len() != 1 {
+		t.Errorf("len after invalidateFile = %d, want 1", c.len())
+	}
+
+	c.invalidateToken("c")
+	if c.len() != 0 {
+		t.Errorf("len after invalidateToken = %d, want 0", c.len())
+	}
+}
+
+func TestShareCache_StaleSetDropped(t *testing.T) {
+	c := newShareCache(10, time.Minute)
+
+	// A lookup started before a concurrent write must not be stored
+	generation := c.snapshot()
+	c.invalidateFile(1)
+	c.set(generation, "a", &domain.File{ID: 1}, &domain.Share{Token: "a"})
+
+	if _, _, ok := c.get("a"); ok {
+		t.Error("expected stale result to be dropped")
+	}
+}
+
+func TestStore_UnpinFilesInvalidatesShareCache(t *testing.T) {
+	s := openTestStore(t, filepath.Join(t.TempDir(), "cache.db"))
+	s.EnableShareCache(10, time.Minute)
+	file := cacheTestFile(t, s, "pinned")
+	if _, err := s.BoostFilePriority(file.ID, domain.PriorityPinned); err != nil {
+		t.Fatalf("BoostFilePriority() error = %v", err)
+	}
+	if err := s.CreateShare(&domain.Share{SynoShareID: "tok", Token: "tok", FileID: file.ID}); err != nil {
+		t.Fatalf("CreateShare() error = %v", err)
+	}
+
+	// Cache the lookup while the file is pinned
+	if cached, _, err := s.GetFileByShareToken("tok"); err != nil || cached.Priority != domain.PriorityPinned {
+		t.Fatalf("GetFileByShareToken() = %+v, %v, want a pinned file", cached, err)
+	}
+
+	if n, err := s.UnpinFiles(nil); err != nil || n != 1 {
+		t.Fatalf("UnpinFiles() = %d, %v, want 1", n, err)
+	}
+	cached, _, err := s.GetFileByShareToken("tok")
+	if err != nil {
+		t.Fatalf("GetFileByShareToken() error = %v", err)
+	}
+	if cached.Priority != domain.PriorityDefault {
+		t.Errorf("priority after unpinning = %d, want %d", cached.Priority, domain.PriorityDefault)
+	}
+}
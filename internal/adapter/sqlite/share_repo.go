@@ -2,14 +2,17 @@ package sqlite
 
 import (
 	"database/sql"
+	"fmt"
 
 	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/util/passhash"
 )
 
 // GetShareByToken retrieves a share by its token
 func (s *Store) GetShareByToken(token string) (*domain.Share, error) {
 	query := `
-		SELECT id, syno_share_id, token, sharing_link, url, file_id, password, expires_at, created_at, revoked
+		SELECT id, syno_share_id, token, sharing_link, url, file_id, password, expires_at, created_at, revoked,
+			max_downloads, nas_max_downloads, download_count, allowed_ips, denied_ips, require_signature, cache_control
 		FROM shares
 		WHERE token = ?
 	`
@@ -17,10 +20,12 @@ func (s *Store) GetShareByToken(token string) (*domain.Share, error) {
 	share := &domain.Share{}
 	var password sql.NullString
 	var sharingLink, url sql.NullString
+	var allowedIPs, deniedIPs string
 
-	err := s.db.QueryRow(query, token).Scan(
+	err := s.rdb.QueryRow(query, token).Scan(
 		&share.ID, &share.SynoShareID, &share.Token, &sharingLink, &url,
 		&share.FileID, &password, &share.ExpiresAt, &share.CreatedAt, &share.Revoked,
+		&share.MaxDownloads, &share.NASMaxDownloads, &share.DownloadCount, &allowedIPs, &deniedIPs, &share.RequireSignature, &share.CacheControl,
 	)
 
 	if err == sql.ErrNoRows {
@@ -39,18 +44,42 @@ func (s *Store) GetShareByToken(token string) (*domain.Share, error) {
 	if url.Valid {
 		share.URL = url.String
 	}
+	share.AllowedIPs = domain.DecodeLabels(allowedIPs)
+	share.DeniedIPs = domain.DecodeLabels(deniedIPs)
 
 	return share, nil
 }
 
-// GetFileByShareToken retrieves both the file and share by share token
+// GetFileByShareToken retrieves both the file and share by share token.
+// Lookups are served from the share cache when it is enabled.
 func (s *Store) GetFileByShareToken(token string) (*domain.File, *domain.Share, error) {
+	if s.shareCache == nil {
+		return s.getFileByShareToken(token)
+	}
+
+	if file, share, ok := s.shareCache.get(token); ok {
+		return file, share, nil
+	}
+
+	generation := s.shareCache.snapshot()
+	file, share, err := s.getFileByShareToken(token)
+	if err != nil || file == nil || share == nil {
+		return file, share, err
+	}
+
+	s.shareCache.set(generation, token, file, share)
+	return file, share, nil
+}
+
+// getFileByShareToken queries the file and share by share token
+func (s *Store) getFileByShareToken(token string) (*domain.File, *domain.Share, error) {
 	query := `
 		SELECT
 			f.id, f.syno_file_id, f.path, f.size, f.modified_at, f.accessed_at,
-			f.starred, f.shared, f.last_sync_at, f.cached, f.cache_path,
-			f.priority, f.last_access_in_cache_at, f.created_at, f.updated_at,
-			s.id, s.syno_share_id, s.token, s.sharing_link, s.url, s.file_id, s.password, s.expires_at, s.created_at, s.revoked
+			f.starred, f.shared, f.last_sync_at, f.cached, f.cache_path, f.cache_encoding,
+			f.priority, f.content_type, f.export_format, f.cache_state, f.content_hash, f.last_access_in_cache_at, f.created_at, f.updated_at,
+			s.id, s.syno_share_id, s.token, s.sharing_link, s.url, s.file_id, s.password, s.expires_at, s.created_at, s.revoked,
+			s.max_downloads, s.nas_max_downloads, s.download_count, s.allowed_ips, s.denied_ips, s.require_signature, s.cache_control
 		FROM shares s
 		JOIN files f ON s.file_id = f.id
 		WHERE s.token = ?
@@ -61,13 +90,15 @@ func (s *Store) GetFileByShareToken(token string) (*domain.File, *domain.Share,
 	var cachePath sql.NullString
 	var password sql.NullString
 	var sharingLink, url sql.NullString
+	var allowedIPs, deniedIPs string
 
-	err := s.db.QueryRow(query, token).Scan(
+	err := s.rdb.QueryRow(query, token).Scan(
 		&file.ID, &file.SynoFileID, &file.Path, &file.Size, &file.ModifiedAt, &file.AccessedAt,
-		&file.Starred, &file.Shared, &file.LastSyncAt, &file.Cached, &cachePath,
-		&file.Priority, &file.LastAccessInCacheAt, &file.CreatedAt, &file.UpdatedAt,
+		&file.Starred, &file.Shared, &file.LastSyncAt, &file.Cached, &cachePath, &file.CacheEncoding,
+		&file.Priority, &file.ContentType, &file.ExportFormat, &file.CacheState, &file.ContentHash, &file.LastAccessInCacheAt, &file.CreatedAt, &file.UpdatedAt,
 		&share.ID, &share.SynoShareID, &share.Token, &sharingLink, &url, &share.FileID,
 		&password, &share.ExpiresAt, &share.CreatedAt, &share.Revoked,
+		&share.MaxDownloads, &share.NASMaxDownloads, &share.DownloadCount, &allowedIPs, &deniedIPs, &share.RequireSignature, &share.CacheControl,
 	)
 
 	if err == sql.ErrNoRows {
@@ -89,6 +120,8 @@ func (s *Store) GetFileByShareToken(token string) (*domain.File, *domain.Share,
 	if url.Valid {
 		share.URL = url.String
 	}
+	share.AllowedIPs = domain.DecodeLabels(allowedIPs)
+	share.DeniedIPs = domain.DecodeLabels(deniedIPs)
 
 	return file, share, nil
 }
@@ -96,19 +129,21 @@ func (s *Store) GetFileByShareToken(token string) (*domain.File, *domain.Share,
 // CreateShare creates a new share record
 func (s *Store) CreateShare(share *domain.Share) error {
 	query := `
-		INSERT INTO shares (syno_share_id, token, sharing_link, url, file_id, password, expires_at, revoked)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO shares (syno_share_id, token, sharing_link, url, file_id, password, expires_at, revoked, max_downloads, nas_max_downloads,
+			allowed_ips, denied_ips, require_signature, cache_control)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
-	var password sql.NullString
-	if share.Password != "" {
-		password = sql.NullString{String: share.Password, Valid: true}
+	password, err := hashSharePassword(share)
+	if err != nil {
+		return err
 	}
 
-	result, err := s.db.Exec(
+	result, err := s.exec(
 		query,
 		share.SynoShareID, share.Token, share.SharingLink, share.URL,
-		share.FileID, password, share.ExpiresAt, share.Revoked,
+		share.FileID, password, share.ExpiresAt, share.Revoked, share.MaxDownloads, share.NASMaxDownloads,
+		domain.EncodeLabels(share.AllowedIPs), domain.EncodeLabels(share.DeniedIPs), share.RequireSignature, share.CacheControl,
 	)
 	if err != nil {
 		return err
@@ -120,22 +155,206 @@ func (s *Store) CreateShare(share *domain.Share) error {
 	}
 
 	share.ID = id
+
+	if s.shareCache != nil {
+		s.shareCache.invalidateToken(share.Token)
+	}
 	return nil
 }
 
-// UpdateShare updates an existing share record
+// UpdateShare updates an existing share record. The download count and the
+// local access settings are changed only by ClaimShareDownload,
+// SetShareMaxDownloads, SetShareIPRules, SetShareRequireSignature and
+// SetShareCacheControl.
 func (s *Store) UpdateShare(share *domain.Share) error {
 	query := `
 		UPDATE shares SET
-			sharing_link = ?, url = ?, password = ?, expires_at = ?, revoked = ?
+			sharing_link = ?, url = ?, password = ?, expires_at = ?, revoked = ?, nas_max_downloads = ?
 		WHERE id = ?
 	`
 
-	var password sql.NullString
-	if share.Password != "" {
-		password = sql.NullString{String: share.Password, Valid: true}
+	password, err := hashSharePassword(share)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.exec(query, share.SharingLink, share.URL, password, share.ExpiresAt, share.Revoked, share.NASMaxDownloads, share.ID)
+	if err != nil {
+		return err
+	}
+
+	if s.shareCache != nil {
+		s.shareCache.invalidateToken(share.Token)
+		s.shareCache.invalidateFile(share.FileID)
+	}
+	return nil
+}
+
+// ListActiveShares returns all shares that are not revoked
+func (s *Store) ListActiveShares() ([]*domain.Share, error) {
+	rows, err := s.rdb.Query(`
+		SELECT id, syno_share_id, token, sharing_link, url, file_id, password, expires_at, created_at, revoked,
+			max_downloads, nas_max_downloads, download_count, allowed_ips, denied_ips, require_signature, cache_control
+		FROM shares
+		WHERE revoked = FALSE
+		ORDER BY id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var shares []*domain.Share
+	for rows.Next() {
+		share := &domain.Share{}
+		var password, sharingLink, url sql.NullString
+		var allowedIPs, deniedIPs string
+		if err := rows.Scan(
+			&share.ID, &share.SynoShareID, &share.Token, &sharingLink, &url,
+			&share.FileID, &password, &share.ExpiresAt, &share.CreatedAt, &share.Revoked,
+			&share.MaxDownloads, &share.NASMaxDownloads, &share.DownloadCount, &allowedIPs, &deniedIPs, &share.RequireSignature, &share.CacheControl,
+		); err != nil {
+			return nil, err
+		}
+		share.Password = password.String
+		share.SharingLink = sharingLink.String
+		share.URL = url.String
+		share.AllowedIPs = domain.DecodeLabels(allowedIPs)
+		share.DeniedIPs = domain.DecodeLabels(deniedIPs)
+		shares = append(shares, share)
+	}
+	return shares, rows.Err()
+}
+
+// shareDownloadLimit is the SQL form of Share.DownloadLimit
+const shareDownloadLimit = `CASE
+	WHEN max_downloads > 0 THEN max_downloads
+	WHEN max_downloads < 0 THEN 0
+	ELSE nas_max_downloads
+END`
+
+// ClaimShareDownload counts a download of share unless its limit is reached.
+// The check and the increment are a single statement, so concurrent
+// downloads cannot exceed the limit.
+func (s *Store) ClaimShareDownload(share *domain.Share) (bool, error) {
+	err := s.queryRowWrite(`
+		UPDATE shares SET download_count = download_count + 1
+		WHERE id = ? AND (`+shareDownloadLimit+` = 0 OR download_count < `+shareDownloadLimit+`)
+		RETURNING download_count
+	`, []any{share.ID}, &share.DownloadCount)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// Cached lookups must see the new count once the limit is reached
+	if s.shareCache != nil && share.DownloadLimit() > 0 {
+		s.shareCache.invalidateToken(share.Token)
+	}
+	return true, nil
+}
+
+// SetShareMaxDownloads sets the local download limit override of a share
+func (s *Store) SetShareMaxDownloads(token string, maxDownloads int) error {
+	result, err := s.exec(`UPDATE shares SET max_downloads = ? WHERE token = ?`, maxDownloads, token)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrNotFound
+	}
+
+	if s.shareCache != nil {
+		s.shareCache.invalidateToken(token)
+	}
+	return nil
+}
+
+// SetShareIPRules sets the client networks allowed and denied for a share
+func (s *Store) SetShareIPRules(token string, allowed, denied []string) error {
+	result, err := s.exec(`UPDATE shares SET allowed_ips = ?, denied_ips = ? WHERE token = ?`,
+		domain.EncodeLabels(allowed), domain.EncodeLabels(denied), token)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrNotFound
+	}
+
+	if s.shareCache != nil {
+		s.shareCache.invalidateToken(token)
+	}
+	return nil
+}
+
+// SetShareRequireSignature sets whether a share is served only through signed links
+func (s *Store) SetShareRequireSignature(token string, required bool) error {
+	result, err := s.exec(`UPDATE shares SET require_signature = ? WHERE token = ?`, required, token)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrNotFound
+	}
+
+	if s.shareCache != nil {
+		s.shareCache.invalidateToken(token)
+	}
+	return nil
+}
+
+// SetShareCacheControl sets the Cache-Control of a share ("" = the global policy)
+func (s *Store) SetShareCacheControl(token, cacheControl string) error {
+	result, err := s.exec(`UPDATE shares SET cache_control = ? WHERE token = ?`, cacheControl, token)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrNotFound
+	}
+
+	if s.shareCache != nil {
+		s.shareCache.invalidateToken(token)
+	}
+	return nil
+}
+
+// hashSharePassword hashes a plaintext share password for storage.
+// share.Password is replaced with the stored hash so callers see the persisted value.
+func hashSharePassword(share *domain.Share) (sql.NullString, error) {
+	if share.Password == "" {
+		return sql.NullString{}, nil
+	}
+
+	if !passhash.IsHashed(share.Password) {
+		hashed, err := passhash.Hash(share.Password)
+		if err != nil {
+			return sql.NullString{}, fmt.Errorf("failed to hash share password: %w", err)
+		}
+		share.Password = hashed
 	}
 
-	_, err := s.db.Exec(query, share.SharingLink, share.URL, password, share.ExpiresAt, share.Revoked, share.ID)
-	return err
+	return sql.NullString{String: share.Password, Valid: true}, nil
 }
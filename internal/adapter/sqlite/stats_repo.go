@@ -0,0 +1,78 @@
+package sqlite
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+)
+
+const statSnapshotColumns = `instance, taken_at, total_files, cached_files, cached_bytes,
+	cache_hits, cache_misses, downloaded_bytes, served_bytes,
+	pending_tasks, in_progress_tasks, failed_tasks, queued_bytes`
+
+// AddStatSnapshot records a periodic statistics sample
+func (s *Store) AddStatSnapshot(snapshot *domain.StatSnapshot) error {
+	result, err := s.exec(`
+		INSERT INTO stat_snapshots (`+statSnapshotColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, snapshot.Instance, snapshot.TakenAt.UTC(), snapshot.TotalFiles, snapshot.CachedFiles, snapshot.CachedBytes,
+		snapshot.CacheHits, snapshot.CacheMisses, snapshot.DownloadedBytes, snapshot.ServedBytes,
+		snapshot.PendingTasks, snapshot.InProgressTasks, snapshot.FailedTasks, snapshot.QueuedBytes)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	snapshot.ID = id
+	return nil
+}
+
+// ListStatSnapshots returns the samples taken in [since, until), oldest first.
+// An empty instance returns the samples of all instances.
+func (s *Store) ListStatSnapshots(instance string, since, until time.Time) ([]*domain.StatSnapshot, error) {
+	rows, err := s.rdb.Query(`
+		SELECT id, `+statSnapshotColumns+`
+		FROM stat_snapshots
+		WHERE (? = '' OR instance = ?) AND taken_at >= ? AND taken_at < ?
+		ORDER BY taken_at, instance
+	`, instance, instance, since.UTC(), until.UTC())
+	if err != nil {
+		return nil, err
+	}
+	return scanStatSnapshots(rows)
+}
+
+// DeleteStatSnapshotsBefore removes samples older than the given age
+func (s *Store) DeleteStatSnapshotsBefore(maxAge time.Duration) (int, error) {
+	result, err := s.exec(`DELETE FROM stat_snapshots WHERE taken_at < ?`, time.Now().Add(-maxAge).UTC())
+	if err != nil {
+		return 0, err
+	}
+	affected, err := result.RowsAffected()
+	return int(affected), err
+}
+
+// scanStatSnapshots reads snapshot rows selected with the id and statSnapshotColumns
+func scanStatSnapshots(rows *sql.Rows) ([]*domain.StatSnapshot, error) {
+	defer rows.Close()
+
+	var snapshots []*domain.StatSnapshot
+	for rows.Next() {
+		snapshot := &domain.StatSnapshot{}
+		if err := rows.Scan(
+			&snapshot.ID, &snapshot.Instance, &snapshot.TakenAt,
+			&snapshot.TotalFiles, &snapshot.CachedFiles, &snapshot.CachedBytes,
+			&snapshot.CacheHits, &snapshot.CacheMisses, &snapshot.DownloadedBytes, &snapshot.ServedBytes,
+			&snapshot.PendingTasks, &snapshot.InProgressTasks, &snapshot.FailedTasks, &snapshot.QueuedBytes,
+		); err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, rows.Err()
+}
@@ -1,67 +1,164 @@
 package sqlite
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"path/filepath"
+	"strings"
+	"time"
 
 	_ "modernc.org/sqlite"
 
 	"github.com/vertextoedge/synology-file-cache/internal/domain"
 	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"github.com/vertextoedge/synology-file-cache/internal/util/wakeup"
 )
 
 // Store implements port.Store interface using SQLite
 type Store struct {
-	db *sql.DB
+	db         *sql.DB     // Read-write pool; writes go through writes
+	rdb        *sql.DB     // Query-only pool for read-heavy lookups
+	writes     *writeQueue // Single writer holding one connection of db
+	shareCache *shareCache // nil when share lookup caching is disabled
+
+	staleWhileRevalidate bool // Modified files keep their cached copy, marked stale
+
+	queued *wakeup.Signal // Fired when tasks become claimable
 }
 
 // Ensure Store implements port.Store
 var _ port.Store = (*Store)(nil)
 
-// Open opens a connection to the SQLite database
-func Open(dbPath string) (*Store, error) {
-	// Ensure directory exists
-	dir := filepath.Dir(dbPath)
-	if dir != "" && dir != "." {
-		// Directory will be created when the DB file is created
-	}
+// Options tunes the SQLite connections. Zero values select the defaults.
+type Options struct {
+	CacheSizeMB   int // Page cache per connection (default 64)
+	BusyTimeoutMs int // How long a connection waits for a lock (default 5000)
+	MaxOpenConns  int // Read-write pool size including the writer connection (default 4, at least 2)
+	MaxIdleConns  int // Idle read-write connections kept open (default MaxOpenConns)
+	ReadConns     int // Query-only pool size (default 8)
 
-	// Open database with WAL mode and busy timeout
-	db, err := sql.Open("sqlite", dbPath+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
-	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+	WriteBatchSize int // Queued writes committed in one transaction (default 64)
+}
+
+// withDefaults fills in the zero values of o
+func (o Options) withDefaults() Options {
+	if o.CacheSizeMB <= 0 {
+		o.CacheSizeMB = 64
+	}
+	if o.BusyTimeoutMs <= 0 {
+		o.BusyTimeoutMs = 5000
 	}
+	if o.MaxOpenConns <= 0 {
+		o.MaxOpenConns = 4
+	}
+	if o.MaxOpenConns < 2 {
+		o.MaxOpenConns = 2 // The writer keeps one connection for itself
+	}
+	if o.MaxIdleConns <= 0 || o.MaxIdleConns > o.MaxOpenConns {
+		o.MaxIdleConns = o.MaxOpenConns
+	}
+	if o.ReadConns <= 0 {
+		o.ReadConns = 8
+	}
+	if o.WriteBatchSize <= 0 {
+		o.WriteBatchSize = 64
+	}
+	return o
+}
 
-	// Set pragmas for better performance
+// dsn builds the connection string for dbPath. The pragmas are part of the DSN
+// so the driver applies them to every connection in the pool, not just the
+// first one.
+func (o Options) dsn(dbPath string, queryOnly bool) string {
 	pragmas := []string{
-		"PRAGMA journal_mode = WAL",
-		"PRAGMA synchronous = NORMAL",
-		"PRAGMA cache_size = -64000", // 64MB cache
-		"PRAGMA temp_store = MEMORY",
-		"PRAGMA busy_timeout = 5000",
+		"journal_mode(WAL)",
+		fmt.Sprintf("busy_timeout(%d)", o.BusyTimeoutMs),
+		"synchronous(NORMAL)",
+		fmt.Sprintf("cache_size(%d)", -o.CacheSizeMB*1024), // Negative sizes are in KiB
+		"temp_store(MEMORY)",
+	}
+	if queryOnly {
+		pragmas = append(pragmas, "query_only(1)")
 	}
 
-	for _, pragma := range pragmas {
-		if _, err := db.Exec(pragma); err != nil {
-			db.Close()
-			return nil, fmt.Errorf("failed to set pragma %s: %w", pragma, err)
-		}
+	return dbPath + "?_pragma=" + strings.Join(pragmas, "&_pragma=")
+}
+
+// Open opens a connection to the SQLite database
+func Open(dbPath string, opts Options) (*Store, error) {
+	opts = opts.withDefaults()
+
+	db, err := sql.Open("sqlite", opts.dsn(dbPath, false))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
+	db.SetMaxOpenConns(opts.MaxOpenConns)
+	db.SetMaxIdleConns(opts.MaxIdleConns)
 
-	store := &Store{db: db}
+	writes, err := newWriteQueue(db, opts.WriteBatchSize)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open writer connection: %w", err)
+	}
+	store := &Store{db: db, writes: writes, queued: wakeup.New()}
 
 	// Run migrations
 	if err := store.migrate(); err != nil {
-		db.Close()
+		store.Close()
 		return nil, fmt.Errorf("failed to migrate database: %w", err)
 	}
 
+	// The query-only pool is opened after the migrations created the database.
+	// In WAL mode its readers never block the writer, and a busy writer pool
+	// does not delay them.
+	rdb, err := sql.Open("sqlite", opts.dsn(dbPath, true))
+	if err != nil {
+		store.Close()
+		return nil, fmt.Errorf("failed to open read-only database: %w", err)
+	}
+	rdb.SetMaxOpenConns(opts.ReadConns)
+	rdb.SetMaxIdleConns(opts.ReadConns)
+	if err := rdb.Ping(); err != nil {
+		rdb.Close()
+		store.Close()
+		return nil, fmt.Errorf("failed to open read-only database: %w", err)
+	}
+	store.rdb = rdb
+
 	return store, nil
 }
 
-// Close closes the database connection
+// EnableStaleWhileRevalidate makes UpsertBySynoID keep the cached copy of a
+// file whose newer version is synced, marked stale, instead of invalidating it
+func (s *Store) EnableStaleWhileRevalidate() {
+	s.staleWhileRevalidate = true
+}
+
+// EnableShareCache enables an in-memory LRU cache for share token lookups.
+// Entries expire after ttl and are invalidated when the file or share is written.
+func (s *Store) EnableShareCache(capacity int, ttl time.Duration) {
+	if capacity <= 0 || ttl <= 0 {
+		s.shareCache = nil
+		return
+	}
+	s.shareCache = newShareCache(capacity, ttl)
+}
+
+// invalidateShareCacheFile drops cached share lookups referencing a file
+func (s *Store) invalidateShareCacheFile(fileID int64) {
+	if s.shareCache != nil {
+		s.shareCache.invalidateFile(fileID)
+	}
+}
+
+// Close closes the database connections
 func (s *Store) Close() error {
+	if s.writes != nil {
+		s.writes.close()
+	}
+	if s.rdb != nil {
+		s.rdb.Close()
+	}
 	if s.db != nil {
 		return s.db.Close()
 	}
@@ -78,131 +175,11 @@ func (s *Store) DB() *sql.DB {
 	return s.db
 }
 
-// migrate creates or updates the database schema
-func (s *Store) migrate() error {
-	migrations := []string{
-		// Create files table
-		`CREATE TABLE IF NOT EXISTS files (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			syno_file_id TEXT UNIQUE NOT NULL,
-			path TEXT NOT NULL,
-			size INTEGER NOT NULL DEFAULT 0,
-			modified_at TIMESTAMP,
-			accessed_at TIMESTAMP,
-			starred BOOLEAN DEFAULT FALSE,
-			shared BOOLEAN DEFAULT FALSE,
-			last_sync_at TIMESTAMP,
-			cached BOOLEAN DEFAULT FALSE,
-			cache_path TEXT,
-			priority INTEGER DEFAULT 5,
-			last_access_in_cache_at TIMESTAMP,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-		)`,
-
-		// Create shares table
-		`CREATE TABLE IF NOT EXISTS shares (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			syno_share_id TEXT UNIQUE NOT NULL,
-			token TEXT UNIQUE NOT NULL,
-			file_id INTEGER NOT NULL,
-			password TEXT,
-			expires_at TIMESTAMP,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-			revoked BOOLEAN DEFAULT FALSE,
-			FOREIGN KEY (file_id) REFERENCES files(id) ON DELETE CASCADE
-		)`,
-
-		// Create meta table for storing sync state
-		`CREATE TABLE IF NOT EXISTS meta (
-			key TEXT PRIMARY KEY,
-			value TEXT,
-			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-		)`,
-
-		// Create download_tasks table for task queue based downloads
-		`CREATE TABLE IF NOT EXISTS download_tasks (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			file_id INTEGER NOT NULL,
-			syno_path TEXT NOT NULL,
-			priority INTEGER NOT NULL DEFAULT 5,
-			size INTEGER NOT NULL DEFAULT 0,
-			status TEXT NOT NULL DEFAULT 'pending',
-			worker_id TEXT,
-			temp_file_path TEXT,
-			bytes_downloaded INTEGER NOT NULL DEFAULT 0,
-			retry_count INTEGER NOT NULL DEFAULT 0,
-			max_retries INTEGER NOT NULL DEFAULT 3,
-			next_retry_at TIMESTAMP,
-			last_error TEXT,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-			claimed_at TIMESTAMP,
-			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-			FOREIGN KEY (file_id) REFERENCES files(id) ON DELETE CASCADE
-		)`,
-
-		// Create indexes for better query performance
-		`CREATE INDEX IF NOT EXISTS idx_files_syno_file_id ON files(syno_file_id)`,
-		`CREATE INDEX IF NOT EXISTS idx_files_path ON files(path)`,
-		`CREATE INDEX IF NOT EXISTS idx_files_priority ON files(priority)`,
-		`CREATE INDEX IF NOT EXISTS idx_files_cached ON files(cached)`,
-		`CREATE INDEX IF NOT EXISTS idx_files_last_access ON files(last_access_in_cache_at)`,
-		`CREATE INDEX IF NOT EXISTS idx_shares_token ON shares(token)`,
-		`CREATE INDEX IF NOT EXISTS idx_shares_file_id ON shares(file_id)`,
-		`CREATE INDEX IF NOT EXISTS idx_download_tasks_status ON download_tasks(status)`,
-		`CREATE INDEX IF NOT EXISTS idx_download_tasks_priority ON download_tasks(priority, size)`,
-		`CREATE INDEX IF NOT EXISTS idx_download_tasks_file_id ON download_tasks(file_id)`,
-	}
-
-	// Run migrations
-	for _, migration := range migrations {
-		if _, err := s.db.Exec(migration); err != nil {
-			return fmt.Errorf("migration failed: %w\nSQL: %s", err, migration)
-		}
-	}
-
-	// Add new columns to shares table (safe ALTER TABLE - ignores if column exists)
-	alterMigrations := []string{
-		`ALTER TABLE shares ADD COLUMN sharing_link TEXT DEFAULT ''`,
-		`ALTER TABLE shares ADD COLUMN url TEXT DEFAULT ''`,
-	}
-
-	for _, migration := range alterMigrations {
-		// Ignore errors for ALTER TABLE as column may already exist
-		s.db.Exec(migration)
-	}
-
-	// Migrate existing download_temp_files to download_tasks (one-time migration)
-	s.migrateDownloadTempFiles()
-
-	return nil
-}
-
-// migrateDownloadTempFiles migrates data from old download_temp_files to new download_tasks
-func (s *Store) migrateDownloadTempFiles() {
-	// Check if old table exists
-	var tableName string
-	err := s.db.QueryRow("SELECT name FROM sqlite_master WHERE type='table' AND name='download_temp_files'").Scan(&tableName)
-	if err != nil {
-		// Table doesn't exist, nothing to migrate
-		return
-	}
-
-	// Migrate existing records to download_tasks
-	migrateQuery := `
-		INSERT OR IGNORE INTO download_tasks (file_id, syno_path, temp_file_path, bytes_downloaded, status, priority, size)
-		SELECT f.id, dtf.syno_path, dtf.temp_file_path, dtf.size_downloaded, 'pending', f.priority, f.size
-		FROM download_temp_files dtf
-		INNER JOIN files f ON dtf.syno_path = f.path
-		WHERE NOT EXISTS (
-			SELECT 1 FROM download_tasks dt
-			WHERE dt.file_id = f.id AND dt.status IN ('pending', 'in_progress')
-		)
-	`
-	s.db.Exec(migrateQuery)
-
-	// Drop the old table
-	s.db.Exec("DROP TABLE IF EXISTS download_temp_files")
+// withImmediateTx runs fn inside a BEGIN IMMEDIATE transaction on the writer
+// connection, possibly together with other queued writes (see writeQueue).
+// fn must only use conn; its changes are rolled back if it returns an error.
+func (s *Store) withImmediateTx(fn func(ctx context.Context, conn *sql.Conn) error) error {
+	return s.writes.submit(fn)
 }
 
 // GetCacheStats returns cache statistics
@@ -235,5 +212,21 @@ func (s *Store) GetCacheStats() (*domain.CacheStats, error) {
 		return nil, err
 	}
 
+	// Access counter totals
+	err = s.db.QueryRow(
+		"SELECT COALESCE(SUM(access_count), 0), COALESCE(SUM(bytes_served), 0), COALESCE(SUM(miss_count), 0) FROM files",
+	).Scan(&stats.AccessCount, &stats.BytesServed, &stats.MissCount)
+	if err != nil {
+		return nil, err
+	}
+
+	// Cached files nobody asked for yet
+	err = s.db.QueryRow(
+		"SELECT COALESCE(SUM(size), 0) FROM files WHERE cached = TRUE AND access_count = 0",
+	).Scan(&stats.UnservedCachedBytes)
+	if err != nil {
+		return nil, err
+	}
+
 	return stats, nil
 }
@@ -0,0 +1,202 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// errStoreClosed is returned for writes submitted after Close
+var errStoreClosed = errors.New("database is closed")
+
+// writeJob is a write waiting for the writer goroutine
+type writeJob struct {
+	fn   func(ctx context.Context, conn *sql.Conn) error
+	done chan error
+}
+
+// writeQueue serialises all writes of the process through one goroutine that
+// owns a single connection. Writers queue up in Go instead of contending for
+// the database lock, so they never see SQLITE_BUSY from each other. Jobs
+// waiting when the writer becomes free are committed together in one
+// transaction, each in its own savepoint so a failing job does not roll back
+// the others.
+type writeQueue struct {
+	conn     *sql.Conn
+	jobs     chan *writeJob
+	maxBatch int
+	quit     chan struct{}
+	stopped  chan struct{}
+	stopOnce sync.Once
+}
+
+// newWriteQueue takes a connection from db and starts the writer goroutine
+func newWriteQueue(db *sql.DB, maxBatch int) (*writeQueue, error) {
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	q := &writeQueue{
+		conn:     conn,
+		jobs:     make(chan *writeJob, maxBatch),
+		maxBatch: maxBatch,
+		quit:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go q.run()
+	return q, nil
+}
+
+// submit runs fn on the writer inside a transaction and waits for the commit
+func (q *writeQueue) submit(fn func(ctx context.Context, conn *sql.Conn) error) error {
+	job := &writeJob{fn: fn, done: make(chan error, 1)}
+
+	select {
+	case q.jobs <- job:
+	case <-q.quit:
+		return errStoreClosed
+	}
+
+	select {
+	case err := <-job.done:
+		return err
+	case <-q.stopped:
+		// The writer may have finished the job just before stopping
+		select {
+		case err := <-job.done:
+			return err
+		default:
+			return errStoreClosed
+		}
+	}
+}
+
+// close stops the writer after the batch in progress and releases its connection
+func (q *writeQueue) close() {
+	q.stopOnce.Do(func() {
+		close(q.quit)
+		<-q.stopped
+		q.conn.Close()
+	})
+}
+
+// run executes queued jobs until close
+func (q *writeQueue) run() {
+	defer close(q.stopped)
+
+	batch := make([]*writeJob, 0, q.maxBatch)
+	for {
+		select {
+		case <-q.quit:
+			return
+		case job := <-q.jobs:
+			batch = append(batch[:0], job)
+		}
+
+	drain:
+		for len(batch) < q.maxBatch {
+			select {
+			case job := <-q.jobs:
+				batch = append(batch, job)
+			default:
+				break drain
+			}
+		}
+
+		q.runBatch(batch)
+	}
+}
+
+// runBatch commits batch in one BEGIN IMMEDIATE transaction. Taking the write
+// lock up front makes read-then-write jobs atomic and avoids the
+// SQLITE_BUSY_SNAPSHOT errors deferred transactions hit on lock upgrade.
+func (q *writeQueue) runBatch(batch []*writeJob) {
+	ctx := context.Background()
+	results := make([]error, len(batch))
+
+	if _, err := q.conn.ExecContext(ctx, "BEGIN IMMEDIATE"); err != nil {
+		for _, job := range batch {
+			job.done <- err
+		}
+		return
+	}
+
+	committed := 0
+	for i, job := range batch {
+		if _, err := q.conn.ExecContext(ctx, "SAVEPOINT job"); err != nil {
+			results[i] = err
+			continue
+		}
+		results[i] = runJob(ctx, q.conn, job.fn)
+		if results[i] != nil {
+			q.conn.ExecContext(ctx, "ROLLBACK TO job")
+		} else {
+			committed++
+		}
+		q.conn.ExecContext(ctx, "RELEASE job")
+	}
+
+	if committed == 0 {
+		q.conn.ExecContext(ctx, "ROLLBACK")
+	} else if _, err := q.conn.ExecContext(ctx, "COMMIT"); err != nil {
+		q.conn.ExecContext(ctx, "ROLLBACK")
+		for i := range results {
+			if results[i] == nil {
+				results[i] = err
+			}
+		}
+	}
+
+	for i, job := range batch {
+		job.done <- results[i]
+	}
+}
+
+// runJob runs fn, turning a panic into an error so the writer keeps running
+func runJob(ctx context.Context, conn *sql.Conn, fn func(ctx context.Context, conn *sql.Conn) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("write panicked: %v", r)
+		}
+	}()
+	return fn(ctx, conn)
+}
+
+// execResult is the outcome of a single statement run by exec
+type execResult struct {
+	lastInsertID int64
+	rowsAffected int64
+}
+
+func (r execResult) LastInsertId() (int64, error) { return r.lastInsertID, nil }
+func (r execResult) RowsAffected() (int64, error) { return r.rowsAffected, nil }
+
+// exec runs a single write statement on the writer
+func (s *Store) exec(query string, args ...any) (sql.Result, error) {
+	var result execResult
+	err := s.writes.submit(func(ctx context.Context, conn *sql.Conn) error {
+		res, err := conn.ExecContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		// Read the result now; the connection moves on to other jobs
+		result.lastInsertID, _ = res.LastInsertId()
+		result.rowsAffected, _ = res.RowsAffected()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// queryRowWrite runs a write statement with a RETURNING clause on the writer
+// and scans the returned row into dest
+func (s *Store) queryRowWrite(query string, args []any, dest ...any) error {
+	return s.writes.submit(func(ctx context.Context, conn *sql.Conn) error {
+		return conn.QueryRowContext(ctx, query, args...).Scan(dest...)
+	})
+}
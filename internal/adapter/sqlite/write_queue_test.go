@@ -0,0 +1,105 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+)
+
+func TestWriteQueue_ConcurrentWrites(t *testing.T) {
+	s := openTestStore(t, filepath.Join(t.TempDir(), "cache.db"))
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 200)
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := s.UpsertBySynoID(&domain.File{SynoFileID: fmt.Sprint(i), Path: fmt.Sprintf("/%d", i)})
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("UpsertBySynoID() error = %v", err)
+		}
+	}
+	stats, err := s.GetCacheStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.TotalFiles != 200 {
+		t.Errorf("TotalFiles = %d, want 200", stats.TotalFiles)
+	}
+}
+
+func TestWriteQueue_FailedJobKeepsBatch(t *testing.T) {
+	s := openTestStore(t, filepath.Join(t.TempDir(), "cache.db"))
+
+	insert := func(path string) func(context.Context, *sql.Conn) error {
+		return func(ctx context.Context, conn *sql.Conn) error {
+			_, err := conn.ExecContext(ctx, "INSERT INTO files (syno_file_id, path) VALUES (?, ?)", path, path)
+			return err
+		}
+	}
+	errBoom := errors.New("boom")
+	batch := []*writeJob{
+		{fn: insert("/a"), done: make(chan error, 1)},
+		{fn: func(ctx context.Context, conn *sql.Conn) error {
+			if err := insert("/b")(ctx, conn); err != nil {
+				return err
+			}
+			return errBoom
+		}, done: make(chan error, 1)},
+		{fn: func(context.Context, *sql.Conn) error { panic("bad job") }, done: make(chan error, 1)},
+		{fn: insert("/c"), done: make(chan error, 1)},
+	}
+
+	// Stop the writer goroutine so the batch runs on its connection here
+	s.writes.close()
+	conn, err := s.db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	q := &writeQueue{conn: conn}
+	q.runBatch(batch)
+
+	want := []error{nil, errBoom, nil, nil}
+	for i, job := range batch {
+		err := <-job.done
+		if i == 2 {
+			if err == nil {
+				t.Error("panicking job returned no error")
+			}
+			continue
+		}
+		if !errors.Is(err, want[i]) {
+			t.Errorf("job %d error = %v, want %v", i, err, want[i])
+		}
+	}
+
+	var paths []string
+	rows, err := s.db.Query("SELECT path FROM files ORDER BY path")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var path string
+		rows.Scan(&path)
+		paths = append(paths, path)
+	}
+	if fmt.Sprint(paths) != "[/a /c]" {
+		t.Errorf("committed paths = %v, want [/a /c]", paths)
+	}
+}
@@ -1,29 +1,30 @@
 package synology
 
 import (
-	"crypto/tls"
-	"encoding/json"
-	"fmt"
-	"io"
-	"net/http"
+	"context"
+	"errors"
 	"net/url"
 	"sync"
 	"time"
 
 	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"github.com/vertextoedge/synology-file-cache/pkg/synoclient"
+	"go.uber.org/zap"
 )
 
-// Client is a Synology API client
+// Client adapts the public Synology API client to the port interfaces.
+// Transient errors are retried and repeated failures open a circuit breaker.
 type Client struct {
-	baseURL        string
-	username       string
-	password       string
-	httpClient     *http.Client
-	downloadClient *http.Client
-	sid            string
-	sidMu          sync.RWMutex
-	apiInfo        map[string]APIEndpoint
-	apiInfoMu      sync.RWMutex
+	api            *synoclient.Client
+	retryAttempts  int
+	retryBaseDelay time.Duration
+	retryMaxDelay  time.Duration
+	breaker        *breaker
+	logger         *zap.Logger
+
+	// connErr is the last login failure until Connect succeeds
+	connMu  sync.Mutex
+	connErr error
 }
 
 // Ensure Client implements port.SynologyClient
@@ -32,6 +33,17 @@ var _ port.SynologyClient = (*Client)(nil)
 // ClientConfig contains optional client configuration
 type ClientConfig struct {
 	BufferSizeMB int // Read/Write buffer size in MB (default: 8)
+
+	RetryAttempts       int           // Attempts per call including the first (default: 3)
+	RetryBaseDelay      time.Duration // First retry delay, doubled per attempt (default: 1s)
+	RetryMaxDelay       time.Duration // Retry delay cap (default: 30s)
+	BreakerThreshold    int           // Consecutive failed calls that pause calls (0 disables)
+	BreakerOpenDuration time.Duration // How long calls stay paused (default: 1m)
+
+	UserAgent     string            // User-Agent header of every request
+	RequestParams map[string]string // Extra query parameters of every request
+
+	Logger *zap.Logger
 }
 
 // NewClient creates a new Synology API client
@@ -41,348 +53,66 @@ func NewClient(baseURL, username, password string, skipTLSVerify bool) *Client {
 
 // NewClientWithConfig creates a new Synology API client with custom configuration
 func NewClientWithConfig(baseURL, username, password string, skipTLSVerify bool, cfg *ClientConfig) *Client {
-	bufferSize := 8 * 1024 * 1024 // 8MB default
-	if cfg != nil && cfg.BufferSizeMB > 0 {
-		bufferSize = cfg.BufferSizeMB * 1024 * 1024
-	}
-
-	transport := &http.Transport{
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: skipTLSVerify,
-		},
-		MaxIdleConns:        100,
-		MaxIdleConnsPerHost: 10,
-		IdleConnTimeout:     90 * time.Second,
-		ForceAttemptHTTP2:   true,
-	}
-
-	downloadTransport := &http.Transport{
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: skipTLSVerify,
-		},
-		// Connection pooling
-		MaxIdleConns:        200,
-		MaxIdleConnsPerHost: 50,
-		MaxConnsPerHost:     50,
-		IdleConnTimeout:     120 * time.Second,
-
-		// Buffer sizes for high-speed transfers
-		WriteBufferSize: bufferSize,
-		ReadBufferSize:  bufferSize,
-
-		// HTTP/2 support
-		ForceAttemptHTTP2: true,
-
-		// Disable compression for binary files (saves CPU)
-		DisableCompression: true,
-
-		// Response header timeout (not total download timeout)
-		ResponseHeaderTimeout: 30 * time.Second,
-	}
-
-	return &Client{
-		baseURL:  baseURL,
-		username: username,
-		password: password,
-		httpClient: &http.Client{
-			Transport: transport,
-			Timeout:   30 * time.Second,
-		},
-		downloadClient: &http.Client{
-			Transport: downloadTransport,
-			Timeout:   0, // No timeout for downloads
-		},
-		apiInfo: make(map[string]APIEndpoint),
-	}
-}
-
-// GetSID returns the current session ID
-func (c *Client) GetSID() string {
-	c.sidMu.RLock()
-	defer c.sidMu.RUnlock()
-	return c.sid
-}
-
-func (c *Client) setSID(sid string) {
-	c.sidMu.Lock()
-	defer c.sidMu.Unlock()
-	c.sid = sid
-}
-
-func (c *Client) clearSID() {
-	c.sidMu.Lock()
-	defer c.sidMu.Unlock()
-	c.sid = ""
-}
-
-// IsLoggedIn returns true if the client has a valid session
-func (c *Client) IsLoggedIn() bool {
-	return c.GetSID() != ""
-}
-
-// getAPIPath returns the API path for the given API name
-func (c *Client) getAPIPath(apiName string) (string, int, error) {
-	c.apiInfoMu.RLock()
-	info, ok := c.apiInfo[apiName]
-	c.apiInfoMu.RUnlock()
-
-	if ok {
-		return info.Path, info.MaxVersion, nil
-	}
-
-	// Fetch API info if not cached
-	if err := c.QueryAPIInfo(apiName); err != nil {
-		return "", 0, err
-	}
-
-	c.apiInfoMu.RLock()
-	info, ok = c.apiInfo[apiName]
-	c.apiInfoMu.RUnlock()
-
-	if !ok {
-		return "", 0, &APIError{Code: ErrAPINotExists, Message: fmt.Sprintf("api %s not found", apiName)}
-	}
-
-	return info.Path, info.MaxVersion, nil
-}
-
-// buildURL builds the full URL for an API request
-func (c *Client) buildURL(path string, params url.Values) string {
-	if sid := c.GetSID(); sid != "" {
-		params.Set("_sid", sid)
-	}
-	return fmt.Sprintf("%s/webapi/%s?%s", c.baseURL, path, params.Encode())
-}
-
-// doRequest performs an HTTP request
-func (c *Client) doRequest(method, urlStr string, body io.Reader) (*http.Response, error) {
-	req, err := http.NewRequest(method, urlStr, body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	if body != nil {
-		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if cfg == nil {
+		cfg = &ClientConfig{}
 	}
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("request failed: %w", err)
+	if cfg.RetryAttempts <= 0 {
+		cfg.RetryAttempts = 3
 	}
-
-	return resp, nil
-}
-
-// doDownloadRequest performs an HTTP request for file downloads
-func (c *Client) doDownloadRequest(method, urlStr string, body io.Reader) (*http.Response, error) {
-	return c.doDownloadRequestWithRange(method, urlStr, body, -1)
-}
-
-// doDownloadRequestWithRange performs an HTTP request with optional Range header
-func (c *Client) doDownloadRequestWithRange(method, urlStr string, body io.Reader, rangeStart int64) (*http.Response, error) {
-	req, err := http.NewRequest(method, urlStr, body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+	if cfg.RetryBaseDelay <= 0 {
+		cfg.RetryBaseDelay = time.Second
 	}
-
-	if body != nil {
-		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if cfg.RetryMaxDelay <= 0 {
+		cfg.RetryMaxDelay = 30 * time.Second
 	}
-
-	if rangeStart >= 0 {
-		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", rangeStart))
+	if cfg.BreakerOpenDuration <= 0 {
+		cfg.BreakerOpenDuration = time.Minute
 	}
-
-	resp, err := c.downloadClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("request failed: %w", err)
+	if cfg.Logger == nil {
+		cfg.Logger = zap.NewNop()
 	}
 
-	return resp, nil
-}
-
-// doAPIRequest performs an API request and parses the JSON response
-func (c *Client) doAPIRequest(path string, params url.Values) (*Response, error) {
-	urlStr := c.buildURL(path, params)
-
-	resp, err := c.doRequest("GET", urlStr, nil)
-	if err != nil {
-		return nil, err
+	opts := &synoclient.Options{
+		InsecureSkipVerify: skipTLSVerify,
+		BufferSizeMB:       cfg.BufferSizeMB,
+		UserAgent:          cfg.UserAgent,
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-	}
-
-	var apiResp Response
-	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
-	}
-
-	if !apiResp.Success {
-		code := 0
-		if apiResp.Error != nil {
-			code = apiResp.Error.Code
-		}
-		return nil, &APIError{Code: code, Message: GetErrorMessage(code)}
-	}
-
-	return &apiResp, nil
-}
-
-// doAPIRequestWithRetry performs an API request with automatic re-login on session errors
-func (c *Client) doAPIRequestWithRetry(path string, params url.Values) (*Response, error) {
-	resp, err := c.doAPIRequest(path, params)
-	if err != nil {
-		if apiErr, ok := err.(*APIError); ok && apiErr.IsSessionError() {
-			// Try to re-login
-			if loginErr := c.Login(); loginErr != nil {
-				return nil, fmt.Errorf("session expired and re-login failed: %w", loginErr)
-			}
-			// Retry the request
-			return c.doAPIRequest(path, params)
-		}
-		return nil, err
-	}
-	return resp, nil
-}
-
-// QueryAPIInfo queries available API information
-func (c *Client) QueryAPIInfo(apis ...string) error {
-	query := "all"
-	if len(apis) > 0 {
-		query = ""
-		for i, api := range apis {
-			if i > 0 {
-				query += ","
-			}
-			query += api
-		}
-	}
-
-	params := url.Values{
-		"api":     {"SYNO.API.Info"},
-		"version": {"1"},
-		"method":  {"query"},
-		"query":   {query},
-	}
-
-	urlStr := fmt.Sprintf("%s/webapi/%s?%s", c.baseURL, apiInfoPath, params.Encode())
-
-	resp, err := c.doRequest("GET", urlStr, nil)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	var apiResp struct {
-		Success bool                   `json:"success"`
-		Data    map[string]APIEndpoint `json:"data"`
-		Error   *ErrorInfo             `json:"error"`
-	}
-
-	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
-		return fmt.Errorf("failed to decode api info response: %w", err)
-	}
-
-	if !apiResp.Success {
-		code := 0
-		if apiResp.Error != nil {
-			code = apiResp.Error.Code
+	if len(cfg.RequestParams) > 0 {
+		opts.Params = make(url.Values, len(cfg.RequestParams))
+		for key, value := range cfg.RequestParams {
+			opts.Params.Set(key, value)
 		}
-		return &APIError{Code: code, Message: GetErrorMessage(code)}
 	}
-
-	// Cache the API info
-	c.apiInfoMu.Lock()
-	for name, info := range apiResp.Data {
-		c.apiInfo[name] = info
+	return &Client{
+		api:            synoclient.New(baseURL, username, password, opts),
+		retryAttempts:  cfg.RetryAttempts,
+		retryBaseDelay: cfg.RetryBaseDelay,
+		retryMaxDelay:  cfg.RetryMaxDelay,
+		breaker:        newBreaker(cfg.BreakerThreshold, cfg.BreakerOpenDuration),
+		logger:         cfg.Logger,
+		connErr:        errors.New("not connected to the NAS yet"),
 	}
-	c.apiInfoMu.Unlock()
-
-	return nil
 }
 
 // Login authenticates with the Synology NAS
-func (c *Client) Login() error {
-	params := url.Values{
-		"api":     {"SYNO.API.Auth"},
-		"version": {"3"},
-		"method":  {"login"},
-		"account": {c.username},
-		"passwd":  {c.password},
-		"session": {sessionName},
-		"format":  {"sid"},
-	}
-
-	urlStr := fmt.Sprintf("%s/webapi/%s?%s", c.baseURL, authPath, params.Encode())
-
-	resp, err := c.doRequest("GET", urlStr, nil)
-	if err != nil {
-		return fmt.Errorf("login request failed: %w", err)
-	}
-	defer resp.Body.Close()
-
-	var loginResp struct {
-		Success bool `json:"success"`
-		Data    struct {
-			SID string `json:"sid"`
-		} `json:"data"`
-		Error *ErrorInfo `json:"error"`
-	}
-
-	if err := json.NewDecoder(resp.Body).Decode(&loginResp); err != nil {
-		return fmt.Errorf("failed to decode login response: %w", err)
-	}
-
-	if !loginResp.Success {
-		code := 0
-		if loginResp.Error != nil {
-			code = loginResp.Error.Code
-		}
-		return &APIError{Code: code, Message: GetErrorMessage(code)}
-	}
-
-	c.setSID(loginResp.Data.SID)
-	return nil
+func (c *Client) Login(ctx context.Context) error {
+	_, err := call(ctx, c, "login", func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, c.api.Login(ctx)
+	})
+	return err
 }
 
 // Logout terminates the current session
-func (c *Client) Logout() error {
-	if !c.IsLoggedIn() {
-		return nil
-	}
-
-	params := url.Values{
-		"api":     {"SYNO.API.Auth"},
-		"version": {"1"},
-		"method":  {"logout"},
-		"session": {sessionName},
-	}
-
-	urlStr := fmt.Sprintf("%s/webapi/%s?%s", c.baseURL, authPath, params.Encode())
-
-	resp, err := c.doRequest("GET", urlStr, nil)
-	if err != nil {
-		return fmt.Errorf("logout request failed: %w", err)
-	}
-	defer resp.Body.Close()
-
-	var logoutResp Response
-	if err := json.NewDecoder(resp.Body).Decode(&logoutResp); err != nil {
-		return fmt.Errorf("failed to decode logout response: %w", err)
-	}
-
-	c.clearSID()
+func (c *Client) Logout(ctx context.Context) error {
+	return c.api.Logout(ctx)
+}
 
-	if !logoutResp.Success {
-		code := 0
-		if logoutResp.Error != nil {
-			code = logoutResp.Error.Code
-		}
-		return &APIError{Code: code, Message: GetErrorMessage(code)}
-	}
+// IsLoggedIn returns true if the client has a valid session
+func (c *Client) IsLoggedIn() bool {
+	return c.api.IsLoggedIn()
+}
 
-	return nil
+// Capabilities returns the DSM and Drive API variants detected at login
+func (c *Client) Capabilities() synoclient.Capabilities {
+	return c.api.Capabilities()
 }
@@ -0,0 +1,72 @@
+package synology
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"go.uber.org/zap"
+)
+
+// Connect logs in, retrying with jittered exponential backoff until it
+// succeeds or ctx ends. Until then ConnectionError reports the last failure,
+// so cached content can be served while the NAS is unreachable.
+func (c *Client) Connect(ctx context.Context) error {
+	for attempt := 1; ; attempt++ {
+		err := c.Login(ctx)
+		if err != nil && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		c.setConnErr(err)
+		if err == nil {
+			if attempt > 1 {
+				c.logger.Info("connected to Synology NAS after retrying", zap.Int("attempts", attempt))
+			}
+			caps := c.api.Capabilities()
+			c.logger.Info("detected NAS capabilities",
+				zap.String("dsm_version", caps.DSMVersion),
+				zap.Int("drive_api_version", caps.DriveVersion),
+				zap.String("recent_method", caps.RecentMethod),
+				zap.Bool("quote_label_ids", caps.QuoteLabelIDs))
+			return nil
+		}
+
+		delay := c.backoff(attempt)
+		c.logger.Warn("failed to login to Synology, retrying",
+			zap.Int("attempt", attempt),
+			zap.Duration("delay", delay),
+			zap.Error(err))
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// ConnectionError reports why the NAS cannot be used: the last login error
+// until Connect succeeded, or ErrUpstreamUnavailable while calls are paused
+// after repeated errors. Returns nil when the NAS is reachable.
+func (c *Client) ConnectionError() error {
+	c.connMu.Lock()
+	err := c.connErr
+	c.connMu.Unlock()
+	if err != nil {
+		return err
+	}
+	if c.breaker.isOpen() {
+		return fmt.Errorf("%w: NAS calls paused after repeated errors", domain.ErrUpstreamUnavailable)
+	}
+	return nil
+}
+
+// setConnErr records the outcome of a login attempt
+func (c *Client) setConnErr(err error) {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	c.connErr = err
+}
@@ -0,0 +1,72 @@
+package synology
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestConnect_RetriesUntilNASIsReachable(t *testing.T) {
+	var attempts atomic.Int32
+	nas := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Only logins are counted; the capability probe follows a successful one
+		if r.FormValue("api") != "SYNO.API.Auth" {
+			fmt.Fprint(w, `{"success":false,"error":{"code":102}}`)
+			return
+		}
+		// Rebooting: the first logins fail
+		if attempts.Add(1) <= 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"success":true,"data":{"sid":"sid-1"}}`)
+	}))
+	defer nas.Close()
+
+	c := NewClientWithConfig(nas.URL, "admin", "secret", false, &ClientConfig{
+		RetryAttempts:  1,
+		RetryBaseDelay: time.Millisecond,
+		RetryMaxDelay:  time.Millisecond,
+	})
+	if c.ConnectionError() == nil {
+		t.Fatal("ConnectionError() = nil before connecting")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.Connect(ctx); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	if got := attempts.Load(); got != 4 {
+		t.Errorf("login attempts = %d, want 4", got)
+	}
+	if err := c.ConnectionError(); err != nil {
+		t.Errorf("ConnectionError() = %v after connecting", err)
+	}
+}
+
+func TestConnect_StopsWhenCanceled(t *testing.T) {
+	nas := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer nas.Close()
+
+	c := NewClientWithConfig(nas.URL, "admin", "secret", false, &ClientConfig{
+		RetryAttempts:  1,
+		RetryBaseDelay: time.Millisecond,
+		RetryMaxDelay:  10 * time.Millisecond,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := c.Connect(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Connect() error = %v, want DeadlineExceeded", err)
+	}
+	if c.ConnectionError() == nil {
+		t.Error("ConnectionError() = nil, want the last login error")
+	}
+}
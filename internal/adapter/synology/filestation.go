@@ -0,0 +1,35 @@
+package synology
+
+import (
+	"context"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/port"
+)
+
+// FileStationClient wraps Client to implement port.FileStationClient
+type FileStationClient struct {
+	*Client
+}
+
+// Ensure FileStationClient implements port.FileStationClient
+var _ port.FileStationClient = (*FileStationClient)(nil)
+
+// NewFileStationClient creates a new File Station API client
+func NewFileStationClient(client *Client) *FileStationClient {
+	return &FileStationClient{Client: client}
+}
+
+// ListShareLinks returns sharing links owned by the current user
+func (c *FileStationClient) ListShareLinks(ctx context.Context, offset, limit int) (*port.FileStationShareListResponse, error) {
+	return call(ctx, c.Client, "list sharing links", func(ctx context.Context) (*port.FileStationShareListResponse, error) {
+		return c.api.ListShareLinks(ctx, offset, limit)
+	})
+}
+
+// CreateShareLink creates a sharing link to path, expiring at expiresAt (nil = never)
+func (c *FileStationClient) CreateShareLink(ctx context.Context, path string, expiresAt *time.Time) (*port.FileStationShareLink, error) {
+	return call(ctx, c.Client, "create sharing link", func(ctx context.Context) (*port.FileStationShareLink, error) {
+		return c.api.CreateShareLink(ctx, path, expiresAt)
+	})
+}
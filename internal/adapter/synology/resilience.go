@@ -0,0 +1,189 @@
+package synology
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/pkg/synoclient"
+	"go.uber.org/zap"
+)
+
+// breaker is a circuit breaker over calls to the NAS. After threshold
+// consecutive calls failed with transient errors it opens and rejects calls
+// for openFor; then a single probe call decides whether it closes again.
+type breaker struct {
+	mu        sync.Mutex
+	threshold int // 0 disables the breaker
+	openFor   time.Duration
+	failures  int
+	openUntil time.Time // Zero while closed
+	probing   bool      // A half-open probe call is in flight
+	now       func() time.Time
+}
+
+// newBreaker creates a closed breaker
+func newBreaker(threshold int, openFor time.Duration) *breaker {
+	return &breaker{threshold: threshold, openFor: openFor, now: time.Now}
+}
+
+// allow reports whether a call may proceed, or how long the breaker stays open
+func (b *breaker) allow() (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.threshold <= 0 || b.openUntil.IsZero() {
+		return 0, true
+	}
+	if wait := b.openUntil.Sub(b.now()); wait > 0 {
+		return wait, false
+	}
+	if b.probing {
+		return b.openFor, false
+	}
+	b.probing = true
+	return 0, true
+}
+
+// isOpen reports whether calls are currently being rejected or probed
+func (b *breaker) isOpen() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.threshold > 0 && !b.openUntil.IsZero()
+}
+
+// abort ends an allowed call without an outcome, e.g. when it was canceled
+func (b *breaker) abort() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// record reports the outcome of an allowed call and returns the state change
+func (b *breaker) record(failed bool) (opened, closed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.threshold <= 0 {
+		return false, false
+	}
+
+	wasOpen := !b.openUntil.IsZero()
+	b.probing = false
+
+	if !failed {
+		b.failures = 0
+		b.openUntil = time.Time{}
+		return false, wasOpen
+	}
+
+	b.failures++
+	if wasOpen || b.failures >= b.threshold {
+		b.openUntil = b.now().Add(b.openFor)
+		return !wasOpen, false
+	}
+	return false, false
+}
+
+// isTransient reports whether err is worth retrying: network failures, HTTP
+// 5xx/429 and DSM's temporary error codes. Errors after the caller's context
+// ended are never transient.
+func isTransient(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+
+	var apiErr *synoclient.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.IsTemporary()
+	}
+	var httpErr *synoclient.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.IsTemporary()
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// isNotFound reports whether err means the file no longer exists on the NAS
+func isNotFound(err error) bool {
+	var apiErr *synoclient.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.IsNotFound()
+	}
+	var httpErr *synoclient.HTTPError
+	return errors.As(err, &httpErr) && httpErr.IsNotFound()
+}
+
+// backoff returns the jittered delay before retry attempt n (1-based)
+func (c *Client) backoff(n int) time.Duration {
+	d := c.retryBaseDelay << (n - 1)
+	if d <= 0 || d > c.retryMaxDelay {
+		d = c.retryMaxDelay
+	}
+	// Equal jitter: at least half the delay, so retries still back off
+	return d/2 + rand.N(d/2+1)
+}
+
+// call runs fn through the circuit breaker, retrying transient errors with
+// jittered exponential backoff
+func call[T any](ctx context.Context, c *Client, op string, fn func(context.Context) (T, error)) (T, error) {
+	var zero T
+
+	if wait, ok := c.breaker.allow(); !ok {
+		return zero, domain.NewRetryableError(
+			fmt.Errorf("%s: %w: NAS calls paused after repeated errors", op, domain.ErrUpstreamUnavailable), wait)
+	}
+
+	var result T
+	var err error
+	for attempt := 1; ; attempt++ {
+		result, err = fn(ctx)
+		if !isTransient(ctx, err) || attempt >= c.retryAttempts {
+			break
+		}
+
+		delay := c.backoff(attempt)
+		c.logger.Debug("transient NAS error, retrying",
+			zap.String("op", op),
+			zap.Int("attempt", attempt),
+			zap.Duration("delay", delay),
+			zap.Error(err))
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			c.breaker.abort()
+			return zero, ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	if err != nil && ctx.Err() != nil {
+		// The caller gave up; that says nothing about the NAS
+		c.breaker.abort()
+		return result, err
+	}
+
+	opened, closed := c.breaker.record(isTransient(ctx, err))
+	if opened {
+		c.logger.Warn("NAS keeps failing, pausing calls",
+			zap.String("op", op),
+			zap.Duration("pause", c.breaker.openFor),
+			zap.Error(err))
+	}
+	if closed {
+		c.logger.Info("NAS reachable again, resuming calls", zap.String("op", op))
+	}
+	if isNotFound(err) {
+		// Callers tell deleted files from failures without knowing DSM error codes
+		err = fmt.Errorf("%s: %w: %w", op, domain.ErrMissingUpstream, err)
+	}
+	return result, err
+}
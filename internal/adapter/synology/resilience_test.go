@@ -0,0 +1,135 @@
+package synology
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/pkg/synoclient"
+	"go.uber.org/zap"
+)
+
+func newTestClient(threshold int) *Client {
+	return &Client{
+		retryAttempts:  3,
+		retryBaseDelay: time.Millisecond,
+		retryMaxDelay:  time.Millisecond,
+		breaker:        newBreaker(threshold, time.Minute),
+		logger:         zap.NewNop(),
+	}
+}
+
+var errBusy = &synoclient.APIError{Code: synoclient.ErrSystemBusy}
+
+func TestCall_RetriesTransientErrors(t *testing.T) {
+	c := newTestClient(0)
+
+	calls := 0
+	got, err := call(context.Background(), c, "test", func(context.Context) (int, error) {
+		calls++
+		if calls < 3 {
+			return 0, errBusy
+		}
+		return 42, nil
+	})
+	if err != nil || got != 42 {
+		t.Fatalf("call = %d, %v; want 42, nil", got, err)
+	}
+	if calls != 3 {
+		t.Errorf("calls = %d, want 3", calls)
+	}
+}
+
+func TestCall_DoesNotRetryPermanentErrors(t *testing.T) {
+	c := newTestClient(0)
+
+	calls := 0
+	_, err := call(context.Background(), c, "test", func(context.Context) (int, error) {
+		calls++
+		return 0, &synoclient.APIError{Code: synoclient.ErrNoPermission}
+	})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1", calls)
+	}
+}
+
+func TestCall_BreakerOpensAndRecovers(t *testing.T) {
+	c := newTestClient(2)
+	now := time.Now()
+	c.breaker.now = func() time.Time { return now }
+
+	failing := func(context.Context) (int, error) { return 0, errBusy }
+	for i := 0; i < 2; i++ {
+		if _, err := call(context.Background(), c, "test", failing); !errors.Is(err, errBusy) {
+			t.Fatalf("call %d: err = %v, want the NAS error", i, err)
+		}
+	}
+
+	// Open: calls are rejected without reaching the NAS
+	reached := false
+	_, err := call(context.Background(), c, "test", func(context.Context) (int, error) {
+		reached = true
+		return 0, nil
+	})
+	if reached {
+		t.Fatal("call reached the NAS while the breaker is open")
+	}
+	if !errors.Is(err, domain.ErrUpstreamUnavailable) || !domain.IsRetryable(err) {
+		t.Fatalf("err = %v, want retryable ErrUpstreamUnavailable", err)
+	}
+
+	// After the pause a successful probe closes the breaker
+	now = now.Add(2 * time.Minute)
+	if _, err := call(context.Background(), c, "test", func(context.Context) (int, error) { return 1, nil }); err != nil {
+		t.Fatalf("probe call: %v", err)
+	}
+	if _, ok := c.breaker.allow(); !ok {
+		t.Error("breaker still open after a successful probe")
+	}
+}
+
+func TestBreaker_SingleProbe(t *testing.T) {
+	b := newBreaker(1, time.Minute)
+	now := time.Now()
+	b.now = func() time.Time { return now }
+
+	b.record(true)
+	now = now.Add(2 * time.Minute)
+
+	if _, ok := b.allow(); !ok {
+		t.Fatal("first call after the pause should probe")
+	}
+	if _, ok := b.allow(); ok {
+		t.Fatal("second call allowed while the probe is in flight")
+	}
+
+	// A failed probe reopens the breaker
+	b.record(true)
+	if wait, ok := b.allow(); ok || wait != time.Minute {
+		t.Errorf("allow = %v, %v; want reopened for 1m", wait, ok)
+	}
+}
+
+func TestCall_WrapsNotFoundAsMissingUpstream(t *testing.T) {
+	c := newTestClient(0)
+
+	for _, notFound := range []error{
+		&synoclient.APIError{Code: synoclient.ErrFileNotFound},
+		&synoclient.HTTPError{StatusCode: 404, Status: "404 Not Found"},
+	} {
+		_, err := call(context.Background(), c, "download", func(context.Context) (int, error) {
+			return 0, notFound
+		})
+		if !errors.Is(err, domain.ErrMissingUpstream) {
+			t.Errorf("call error = %v, want ErrMissingUpstream", err)
+		}
+		if !errors.Is(err, notFound) {
+			t.Errorf("call error = %v, want it to wrap %v", err, notFound)
+		}
+	}
+}
@@ -0,0 +1,854 @@
+// Package app wires the storage, the Synology client, the services and the
+// HTTP server of the cache together into an App. cmd/synology-file-cache
+// parses flags and runs one; the e2e tests run the same App against a fake NAS.
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/adapter/clamav"
+	"github.com/vertextoedge/synology-file-cache/internal/adapter/replica"
+	"github.com/vertextoedge/synology-file-cache/internal/adapter/synology"
+	"github.com/vertextoedge/synology-file-cache/internal/config"
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"github.com/vertextoedge/synology-file-cache/internal/service/backup"
+	"github.com/vertextoedge/synology-file-cache/internal/service/cacher"
+	"github.com/vertextoedge/synology-file-cache/internal/service/chunk"
+	"github.com/vertextoedge/synology-file-cache/internal/service/events"
+	"github.com/vertextoedge/synology-file-cache/internal/service/leader"
+	"github.com/vertextoedge/synology-file-cache/internal/service/maintenance"
+	"github.com/vertextoedge/synology-file-cache/internal/service/metadata"
+	"github.com/vertextoedge/synology-file-cache/internal/service/namespace"
+	"github.com/vertextoedge/synology-file-cache/internal/service/partial"
+	"github.com/vertextoedge/synology-file-cache/internal/service/preview"
+	"github.com/vertextoedge/synology-file-cache/internal/service/replicator"
+	"github.com/vertextoedge/synology-file-cache/internal/service/server"
+	"github.com/vertextoedge/synology-file-cache/internal/service/stats"
+	"github.com/vertextoedge/synology-file-cache/internal/service/stream"
+	"github.com/vertextoedge/synology-file-cache/internal/service/syncer"
+	"github.com/vertextoedge/synology-file-cache/internal/util/inuse"
+	"github.com/vertextoedge/synology-file-cache/internal/util/rotate"
+	"github.com/vertextoedge/synology-file-cache/internal/util/systemd"
+	"go.uber.org/zap"
+)
+
+// Version is the version of synology-file-cache
+const Version = "0.2.0"
+
+// App is the cache server: storage, Synology client, services and HTTP
+// server wired from one configuration
+type App struct {
+	config *config.Config
+	logger *zap.Logger
+
+	storage     *storage
+	synology    *synology.Client
+	elector     *leader.Elector
+	syncer      *syncer.Syncer
+	cacher      *cacher.Cacher
+	maintenance *maintenance.Service
+	backups     *backup.Service
+	replicator  *replicator.Service
+	streams     *stream.Streamer
+	namespaces  *namespace.Manager
+	server      *server.Server
+	accessLog   *rotate.Writer
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// New opens the cache directory and database described by cfg and creates
+// all services and the HTTP server without starting them. Configuration
+// errors are returned before anything runs.
+func New(cfg *config.Config, zapLogger *zap.Logger) (_ *App, err error) {
+	st, err := openStorage(cfg, zapLogger)
+	if err != nil {
+		return nil, err
+	}
+	a := &App{config: cfg, logger: zapLogger, storage: st}
+	defer func() {
+		if err != nil {
+			a.Close()
+		}
+	}()
+	fsManager, store, encryptionKeys := st.fs, st.store, st.encryptionKeys
+
+	// Create backup service; scheduling is optional, manual backups always work.
+	// PostgreSQL deployments back up with pg_dump instead.
+	backupService, err := st.backupService(cfg, zapLogger)
+	if err != nil {
+		return nil, err
+	}
+	metadataService := metadata.New(store, fsManager, zapLogger)
+
+	// Create Synology API client
+	synoClient := synology.NewClientWithConfig(
+		cfg.Synology.BaseURL,
+		cfg.Synology.Username,
+		cfg.Synology.Password,
+		cfg.Synology.SkipTLSVerify,
+		&synology.ClientConfig{
+			BufferSizeMB:        cfg.Cache.BufferSizeMB,
+			RetryAttempts:       cfg.Synology.RetryAttempts,
+			RetryBaseDelay:      cfg.Synology.GetRetryBaseDelay(),
+			RetryMaxDelay:       cfg.Synology.GetRetryMaxDelay(),
+			BreakerThreshold:    cfg.Synology.CircuitFailureThreshold,
+			BreakerOpenDuration: cfg.Synology.GetCircuitOpenDuration(),
+			UserAgent:           synologyUserAgent(cfg),
+			RequestParams:       cfg.Synology.RequestParams,
+			Logger:              zapLogger,
+		},
+	)
+
+	// Create Drive client
+	driveClient := synology.NewDriveClient(synoClient)
+
+	// Create syncer
+	scanExclude, err := syncer.ParseExcludePatterns(cfg.Sync.ScanExclude)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sync.scan_exclude: %w", err)
+	}
+	includePaths, err := syncer.ParseIncludePaths(cfg.Sync.IncludePaths, domain.PriorityStarred)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sync.include_paths: %w", err)
+	}
+
+	syncerCfg := &syncer.Config{
+		FullScanInterval:    cfg.Sync.GetFullScanInterval(),
+		IncrementalInterval: cfg.Sync.GetIncrementalInterval(),
+		RecentModifiedDays:  cfg.Cache.RecentModifiedDays,
+		RecentAccessedDays:  cfg.Cache.RecentAccessedDays,
+		ExcludeLabels:       cfg.Sync.ExcludeLabels,
+		PageSize:            cfg.Sync.GetPageSize(),
+		FetchConcurrency:    cfg.Sync.GetFetchConcurrency(),
+		MaxDownloadRetries:  cfg.Cache.GetMaxDownloadRetries(),
+		MaxCacheSize:        int64(cfg.Cache.MaxSizeGB) * 1024 * 1024 * 1024,
+		PreseedPaths:        cfg.Cache.PreseedPaths,
+		TeamFolders:         cfg.Sync.TeamFolders,
+		TeamFolderPriority:  cfg.Sync.TeamFolderPriority,
+		IncludePaths:        includePaths,
+		MissingUpstreamTTL:  cfg.Cache.GetMissingUpstreamTTL(),
+		ScanMaxDepth:        cfg.Sync.ScanMaxDepth,
+		ScanMaxFiles:        cfg.Sync.ScanMaxFiles,
+		ScanMaxFileSize:     int64(cfg.Sync.ScanMaxFileSizeMB) * 1024 * 1024,
+		ScanExclude:         scanExclude,
+		AutoTune: syncer.AutoTuneConfig{
+			Enabled:             cfg.Sync.AutoTuneEnabled,
+			MinRequests:         int64(cfg.Sync.AutoTuneMinRequests),
+			WidenMissRatio:      cfg.Sync.AutoTuneWidenMissRatio,
+			ShrinkUnservedRatio: cfg.Sync.AutoTuneShrinkUnservedRatio,
+			MinRecentDays:       cfg.Sync.AutoTuneMinRecentDays,
+			MaxRecentDays:       cfg.Sync.AutoTuneMaxRecentDays,
+			MaxScanDepth:        cfg.Sync.AutoTuneMaxScanDepth,
+		},
+	}
+	if cfg.Sync.WebhookSecret != "" {
+		// Change notifications keep the cache current; polling only catches lost ones
+		syncerCfg.IncrementalInterval = cfg.Sync.GetWebhookFallbackInterval()
+	}
+	syncerService := syncer.New(syncerCfg, driveClient, store, store, store, zapLogger)
+	fileStationClient := synology.NewFileStationClient(synoClient)
+	if cfg.Sync.EnableFileStationShares {
+		syncerService.EnableFileStationShares(fileStationClient)
+	}
+	syncerService.EnableShareCreation(fileStationClient)
+	syncerService.EnableAudit(store)
+	syncerService.EnablePreseedPaths(store)
+	syncerService.EnableLabels(store)
+	if syncerCfg.AutoTune.Enabled {
+		syncerService.EnableAutoTune(store)
+	}
+
+	quota := domain.Quota{
+		OwnerBytes: int64(cfg.Cache.OwnerQuotaGB) * 1024 * 1024 * 1024,
+		LabelBytes: int64(cfg.Cache.LabelQuotaGB) * 1024 * 1024 * 1024,
+	}
+	if quota.Enabled() {
+		syncerService.EnableQuotas(quota)
+	}
+
+	// With several instances on one database only the elected leader scans
+	instanceID := cfg.Cluster.InstanceID
+	if instanceID == "" {
+		instanceID = cacher.DefaultInstanceID()
+	}
+	var elector *leader.Elector
+	if cfg.Cluster.Enabled {
+		elector, err = leader.New(&leader.Config{
+			Name:   "syncer",
+			Holder: fmt.Sprintf("%s:%d", instanceID, os.Getpid()),
+			TTL:    cfg.Cluster.GetLeaderLeaseTTL(),
+		}, store, zapLogger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create leader elector: %w", err)
+		}
+		syncerService.EnableLeaderElection(elector)
+	}
+
+	// Create the stats history sampling, snapshots are taken by the maintenance service
+	var statsService *stats.Service
+	var statsCounters *stats.Counters
+	if cfg.Stats.Enabled {
+		statsService = stats.New(&stats.Config{
+			Interval: cfg.Stats.GetInterval(),
+			Instance: instanceID,
+		}, store, zapLogger)
+		statsCounters = statsService.Counters()
+	}
+
+	// Copies the HTTP server is reading; the cacher does not evict them
+	readers := inuse.New()
+
+	// Create cacher
+	downloadWindows, err := cacher.ParseDownloadWindows(cfg.Cache.DownloadWindow)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cache.download_window: %w", err)
+	}
+
+	reservations := make([]cacher.Reservation, 0, len(cfg.Cache.ReservedWorkers))
+	for _, r := range cfg.Cache.ReservedWorkers {
+		reservations = append(reservations, cacher.Reservation{MaxPriority: r.MaxPriority, Workers: r.Workers})
+	}
+
+	cacherCfg := &cacher.Config{
+		MaxSizeBytes:           int64(cfg.Cache.MaxSizeGB) * 1024 * 1024 * 1024,
+		MaxDiskUsagePercent:    float64(cfg.Cache.MaxDiskUsagePercent),
+		EvictionInterval:       cfg.Cache.GetEvictionInterval(),
+		ConcurrentDownloads:    cfg.Cache.ConcurrentDownloads,
+		StaleTaskTimeout:       cfg.Cache.GetStaleTaskTimeout(),
+		ProgressUpdateInterval: cfg.Cache.GetProgressUpdateInterval(),
+		WorkerPollInterval:     cfg.Cache.GetWorkerPollInterval(),
+		WorkerErrorBackoff:     cfg.Cache.GetWorkerErrorBackoff(),
+		EvictionBatchSize:      cfg.Cache.GetEvictionBatchSize(),
+		MaxDownloadRetries:     cfg.Cache.GetMaxDownloadRetries(),
+		DrainTimeout:           cfg.Cache.GetDrainTimeout(),
+		HeartbeatInterval:      cfg.Cluster.GetHeartbeatInterval(),
+		InstanceID:             instanceID,
+		SharedQueue:            cfg.Cluster.Enabled,
+		CompressAtRest:         cfg.Cache.CompressAtRest,
+
+		LowSpaceHeadroomPercent: cfg.Cache.LowSpaceHeadroomPercent,
+		SpaceCheckInterval:      cfg.Cache.GetSpaceCheckInterval(),
+
+		DownloadWindows:      downloadWindows,
+		WindowBypassPriority: cfg.Cache.DownloadWindowBypassPriority,
+		Quota:                quota,
+		EvictionPolicy:       domain.EvictionPolicy(cfg.Cache.EvictionPolicy),
+		OfficeExport:         cfg.Cache.OfficeExport,
+		Dedup:                cfg.Cache.Dedup,
+		MissingUpstreamTTL:   cfg.Cache.GetMissingUpstreamTTL(),
+		SegmentsPerFile:      cfg.Cache.SegmentsPerFile,
+		SegmentMinSize:       int64(cfg.Cache.SegmentMinSizeMB) * 1024 * 1024,
+		ClaimBatchSize:       cfg.Cache.ClaimBatchSize,
+		ClaimBatchMaxBytes:   int64(cfg.Cache.ClaimBatchMaxMB) * 1024 * 1024,
+		Reservations:         reservations,
+
+		DownloadIdleTimeout:   cfg.Cache.GetDownloadIdleTimeout(),
+		DownloadMinThroughput: int64(cfg.Cache.DownloadMinThroughputKB) * 1024,
+		Stats:                 statsCounters,
+		Readers:               readers,
+	}
+	cacherService := cacher.New(cacherCfg, driveClient, store, store, fsManager, zapLogger)
+
+	// Scan downloaded copies before they are marked cached
+	var preServeHooks []port.PreServeHook
+	if cfg.Scan.Enabled {
+		scanner, err := clamav.New(cfg.Scan.ClamdAddress, cfg.Scan.GetTimeout(), int64(cfg.Scan.MaxFileSizeMB)*1024*1024)
+		if err != nil {
+			return nil, fmt.Errorf("invalid scan.clamd_address: %w", err)
+		}
+		pingCtx, cancelPing := context.WithTimeout(context.Background(), 10*time.Second)
+		err = scanner.Ping(pingCtx)
+		cancelPing()
+		if err != nil {
+			// Downloads are retried until clamd is reachable
+			zapLogger.Warn("clamd not reachable", zap.Error(err))
+		}
+		preServeHooks = append(preServeHooks, scanner)
+		cacherService.EnablePreServeHooks(preServeHooks...)
+		zapLogger.Info("virus scanning enabled",
+			zap.String("clamd", cfg.Scan.ClamdAddress),
+			zap.Bool("on_serve", cfg.Scan.OnServe))
+	}
+
+	// The cacher keeps deduplicated copies that other files still reference
+	if cfg.Sync.PurgeRevokedShares {
+		syncerService.EnableRevocationPurge(cacherService)
+	}
+
+	// Live events for /api/v1/events and the admin pages
+	var eventBus *events.Bus
+	if cfg.HTTP.EnableAdminAPI {
+		eventBus = events.NewBus(events.DefaultHistory)
+		cacherService.EnableEvents(eventBus)
+		syncerService.EnableEvents(eventBus)
+	}
+
+	// Create maintenance service
+	maintenanceCfg := &maintenance.Config{
+		StaleTaskCheckInterval: time.Minute,
+		StaleTaskTimeout:       cfg.Cache.GetStaleTaskTimeout(),
+		CleanupInterval:        time.Hour,
+		FailedTaskMaxAge:       cfg.Cache.GetFailedTaskRetention(),
+		TempFileMaxAge:         24 * time.Hour,
+		PriorityAgingAge:       cfg.Cache.GetPriorityAgingAge(),
+		AuditRetention:         cfg.Database.GetAuditRetention(),
+		PreviewMaxAge:          cfg.Preview.GetMaxAge(),
+		StreamMaxAge:           cfg.Stream.GetMaxAge(),
+		StatsInterval:          cfg.Stats.GetInterval(),
+		StatsRetention:         cfg.Stats.GetRetention(),
+		OrphanScanInterval:     cfg.Cache.GetOrphanScanInterval(),
+	}
+	maintenanceService := maintenance.New(maintenanceCfg, store, fsManager, zapLogger)
+	maintenanceService.EnableAuditCleanup(store)
+	if cfg.Cache.OrphanAction != "off" {
+		maintenanceService.EnableOrphanCollection(store, cfg.Cache.OrphanAction != "delete")
+	}
+	if statsService != nil {
+		maintenanceService.EnableStatsHistory(statsService, store)
+	}
+	if encryptionKeys != nil {
+		maintenanceService.EnableReencryption(fsManager)
+	}
+
+	// Create replicator mirroring the cache to a secondary site
+	var replicatorService *replicator.Service
+	if cfg.Replication.Enabled {
+		target, err := replicaTarget(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create replica target: %w", err)
+		}
+		replicatorService = replicator.New(&replicator.Config{
+			Interval: cfg.Replication.GetInterval(),
+		}, store, fsManager, target, zapLogger)
+		if elector != nil {
+			replicatorService.EnableLeaderElection(elector)
+		}
+	}
+	var replicaReceiver port.ReplicaStore
+	if cfg.Replication.ReceiveEnabled {
+		if replicaReceiver, err = replica.NewDir(replicaReceiveDir(cfg)); err != nil {
+			return nil, fmt.Errorf("failed to create replica receive dir: %w", err)
+		}
+	}
+
+	// Create preview generator
+	var previews *preview.Generator
+	if cfg.Preview.Enabled {
+		previewDir := cfg.Preview.Dir
+		if previewDir == "" {
+			previewDir = filepath.Join(cfg.Cache.RootDir, ".previews")
+		}
+		previews, err = preview.New(&preview.Config{
+			Dir:         previewDir,
+			FFmpegPath:  cfg.Preview.FFmpegPath,
+			DefaultSize: cfg.Preview.DefaultSize,
+			Concurrency: cfg.Preview.Concurrency,
+			Timeout:     cfg.Preview.GetTimeout(),
+			Keys:        encryptionKeys,
+		}, zapLogger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create preview generator: %w", err)
+		}
+		maintenanceService.EnablePreviewCleanup(previews)
+	}
+
+	// Create HLS streamer
+	var streams *stream.Streamer
+	if cfg.Stream.Enabled {
+		streamDir := cfg.Stream.Dir
+		if streamDir == "" {
+			streamDir = filepath.Join(cfg.Cache.RootDir, ".streams")
+		}
+		streams, err = stream.New(&stream.Config{
+			Dir:             streamDir,
+			FFmpegPath:      cfg.Stream.FFmpegPath,
+			FFprobePath:     cfg.Stream.FFprobePath,
+			Mode:            cfg.Stream.Mode,
+			SegmentDuration: cfg.Stream.GetSegmentDuration(),
+			Workers:         cfg.Stream.Workers,
+			ReadyTimeout:    cfg.Stream.GetReadyTimeout(),
+			Keys:            encryptionKeys,
+		}, zapLogger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create stream service: %w", err)
+		}
+		maintenanceService.EnableStreamCleanup(streams)
+	}
+
+	// Create chunk cache for very large files
+	var chunks *chunk.Cache
+	if cfg.Chunks.Enabled {
+		chunkDir := cfg.Chunks.Dir
+		if chunkDir == "" {
+			chunkDir = filepath.Join(cfg.Cache.RootDir, ".chunks")
+		}
+		chunks, err = chunk.New(&chunk.Config{
+			Dir:         chunkDir,
+			ChunkSize:   int64(cfg.Chunks.ChunkSizeMB) * 1024 * 1024,
+			MinFileSize: int64(cfg.Chunks.MinFileSizeMB) * 1024 * 1024,
+			MaxBytes:    int64(cfg.Chunks.MaxSizeGB) * 1024 * 1024 * 1024,
+			Keys:        encryptionKeys,
+		}, store, driveClient, zapLogger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create chunk cache: %w", err)
+		}
+	}
+
+	// Serve files being downloaded from their temp file
+	var partialSource *partial.Source
+	if cfg.Cache.ServeInProgress {
+		partialSource = partial.New(partialConfig(cfg), store, driveClient, zapLogger)
+	}
+
+	// Create HTTP server
+	// Access log in its own rotating file, independent of the application log
+	var accessLog *rotate.Writer
+	if cfg.Logging.AccessLogFile != "" {
+		accessLog, err = rotate.New(rotate.Config{
+			Filename:   cfg.Logging.AccessLogFile,
+			MaxSizeMB:  cfg.Logging.AccessLogMaxSizeMB,
+			MaxBackups: cfg.Logging.AccessLogMaxBackups,
+			MaxAge:     cfg.Logging.GetAccessLogMaxAge(),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to open access log: %w", err)
+		}
+		a.accessLog = accessLog
+	}
+
+	shareErrorPage, err := server.LoadShareErrorPage(cfg.HTTP.ShareErrorPage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load share error page: %w", err)
+	}
+	sessionSecret, err := loadSessionSecret(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load session secret: %w", err)
+	}
+
+	serverCfg := &server.Config{
+		BindAddrs:          cfg.HTTP.BindAddrs,
+		AdminUsername:      cfg.HTTP.AdminUsername,
+		AdminPassword:      cfg.HTTP.AdminPassword,
+		AdminPasswordHash:  cfg.HTTP.AdminPasswordHash,
+		EnableAdminBrowser: cfg.HTTP.EnableAdminBrowser,
+		EnableAdminAPI:     cfg.HTTP.EnableAdminAPI,
+		CacheRootDir:       cfg.Cache.RootDir,
+		WebhookSecret:      cfg.Sync.WebhookSecret,
+		SyncTrigger:        syncerService.TriggerSync,
+		DriveChanges:       syncerService.NotifyChanges,
+		SyncDryRun:         syncerService.DryRun,
+		CacheRequest:       syncerService.RequestCache,
+		CreateShare:        syncerService.CreateShare,
+		RejectCached:       cacherService.RejectCached,
+		Workers:            cacherService.Workers,
+		SyncScope:          syncerService.SyncScope,
+		Previews:           previews,
+		Streams:            streams,
+		Chunks:             chunks,
+		Partial:            partialSource,
+		Backups:            backupService,
+		Metadata:           metadataService,
+		Events:             eventBus,
+		ReplicaReceiver:    replicaReceiver,
+		PreseedPaths:       cfg.Cache.PreseedPaths,
+		PreseedTrigger:     syncerService.TriggerPreseedSync,
+		CompressionEnabled: cfg.HTTP.CompressionEnabled,
+		CopyBufferSize:     cfg.HTTP.CopyBufferKB * 1024,
+		EncryptionKeys:     encryptionKeys,
+		ReadTimeout:        cfg.HTTP.GetReadTimeout(),
+		WriteTimeout:       cfg.HTTP.GetWriteTimeout(),
+		IdleTimeout:        cfg.HTTP.GetIdleTimeout(),
+
+		RateLimitEnabled:         cfg.HTTP.RateLimitEnabled,
+		IPRateLimit:              cfg.HTTP.RateLimitIPRPS,
+		IPRateBurst:              cfg.HTTP.RateLimitIPBurst,
+		TokenRateLimit:           cfg.HTTP.RateLimitTokenRPS,
+		TokenRateBurst:           cfg.HTTP.RateLimitTokenBurst,
+		PasswordLockoutThreshold: cfg.HTTP.PasswordLockoutThreshold,
+		PasswordLockoutBase:      cfg.HTTP.GetPasswordLockoutBase(),
+		PasswordLockoutMax:       cfg.HTTP.GetPasswordLockoutMax(),
+		TrustProxyHeaders:        cfg.HTTP.TrustProxyHeaders,
+		TrustedProxies:           cfg.HTTP.TrustedProxies,
+		ShareAllowedIPs:          cfg.HTTP.ShareAllowedIPs,
+		ShareDeniedIPs:           cfg.HTTP.ShareDeniedIPs,
+		URLSigningSecret:         cfg.HTTP.URLSigningSecret,
+		SessionSecret:            sessionSecret,
+		SessionCookie: server.SessionCookieConfig{
+			Name:     cfg.HTTP.SessionCookieName,
+			Domain:   cfg.HTTP.SessionCookieDomain,
+			Secure:   cfg.HTTP.SessionCookieSecure,
+			SameSite: cfg.HTTP.SessionCookieSameSite,
+		},
+
+		Stats:         statsService,
+		CacheMaxBytes: int64(cfg.Cache.MaxSizeGB) * 1024 * 1024 * 1024,
+		Readers:       readers,
+
+		ExpiredShareGrace:  cfg.HTTP.GetExpiredShareGrace(),
+		ShareErrorPage:     shareErrorPage,
+		RedirectGoneShares: cfg.HTTP.RedirectGoneShares,
+
+		CacheControl:          cfg.HTTP.CacheControl,
+		ProtectedCacheControl: cfg.HTTP.ProtectedCacheControl,
+
+		ProxyUnknownShares: cfg.HTTP.ProxyUnknownShares,
+		Passthrough:        cfg.HTTP.Passthrough,
+		SynologyURL:        cfg.Synology.BaseURL,
+		SynologySkipTLS:    cfg.Synology.SkipTLSVerify,
+
+		CORS: server.CORSConfig{
+			AllowedOrigins:   cfg.HTTP.CORSAllowedOrigins,
+			AllowedMethods:   cfg.HTTP.CORSAllowedMethods,
+			AllowedHeaders:   cfg.HTTP.CORSAllowedHeaders,
+			AllowCredentials: cfg.HTTP.CORSAllowCredentials,
+			MaxAge:           cfg.HTTP.GetCORSMaxAge(),
+		},
+
+		UpstreamStatus: synoClient.ConnectionError,
+	}
+	if cfg.Scan.OnServe {
+		serverCfg.PreServeHooks = preServeHooks
+	}
+	if cfg.Cache.BoostOnAccess {
+		serverCfg.BoostPriority = cfg.Cache.BoostPriority
+	}
+	if accessLog != nil {
+		serverCfg.AccessLog = accessLog
+		serverCfg.AccessLogFormat = cfg.Logging.AccessLogFormat
+	}
+
+	// Namespaces run services of their own and are served below /t/{name}/
+	var namespaces *namespace.Manager
+	if len(cfg.Namespaces) > 0 {
+		base := &namespaceBase{
+			cfg:            cfg,
+			syncer:         syncerCfg,
+			cacher:         cacherCfg,
+			maintenance:    maintenanceCfg,
+			server:         serverCfg,
+			encryptionKeys: encryptionKeys,
+			preServeHooks:  preServeHooks,
+		}
+		namespaces = namespace.NewManager(zapLogger)
+		a.namespaces = namespaces
+		for i := range cfg.Namespaces {
+			inst, err := buildNamespace(base, &cfg.Namespaces[i], zapLogger)
+			if err == nil {
+				err = namespaces.Add(inst)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to create namespace %s: %w", cfg.Namespaces[i].Name, err)
+			}
+		}
+		serverCfg.Namespaces = namespaces
+	}
+
+	// Use the sockets passed by systemd socket activation instead of binding http.bind_addr
+	listeners, err := systemd.Listeners()
+	if err != nil {
+		return nil, fmt.Errorf("failed to use activated sockets: %w", err)
+	}
+	if len(listeners) > 0 {
+		serverCfg.Listeners = listeners
+		for _, l := range listeners {
+			zapLogger.Info("using socket from systemd", zap.String("addr", l.Addr().String()))
+		}
+	}
+	a.server = server.New(serverCfg, store, zapLogger)
+	a.synology = synoClient
+	a.elector = elector
+	a.syncer = syncerService
+	a.cacher = cacherService
+	a.maintenance = maintenanceService
+	a.backups = backupService
+	a.replicator = replicatorService
+	a.streams = streams
+	return a, nil
+}
+
+// Handler returns the HTTP handler of the cache, for serving it without Run
+func (a *App) Handler() http.Handler {
+	return a.server.Handler()
+}
+
+// Run serves until ctx is canceled, then stops all services gracefully and
+// closes the App. A failing HTTP server stops the services and is returned.
+// Sync and downloads start once the NAS is reachable.
+func (a *App) Run(ctx context.Context) error {
+	defer a.Close()
+	cfg, zapLogger := a.config, a.logger
+
+	if err := a.server.Listen(); err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", strings.Join(cfg.HTTP.BindAddrs, ", "), err)
+	}
+
+	// Services run until ctx is canceled
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Start HTTP server
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- a.server.Start()
+	}()
+
+	// Start leader election before the syncer waits for it
+	if a.elector != nil {
+		go func() {
+			if err := a.elector.Start(ctx); err != nil && err != context.Canceled {
+				zapLogger.Error("leader election stopped with error", zap.Error(err))
+			}
+		}()
+	}
+
+	// Login to Synology in the background so a NAS that is down does not keep
+	// cached content offline; sync and downloads start once it is reachable
+	go func() {
+		if err := a.synology.Connect(ctx); err != nil {
+			return
+		}
+		zapLogger.Info("connected to Synology NAS", zap.String("url", cfg.Synology.BaseURL))
+
+		// Start syncer
+		go func() {
+			if err := a.syncer.Start(ctx); err != nil && err != context.Canceled {
+				zapLogger.Error("syncer stopped with error", zap.Error(err))
+			}
+		}()
+
+		// Start cacher
+		go func() {
+			if err := a.cacher.Start(ctx); err != nil && err != context.Canceled {
+				zapLogger.Error("cacher stopped with error", zap.Error(err))
+			}
+		}()
+	}()
+
+	// Start maintenance service
+	go func() {
+		if err := a.maintenance.Start(ctx); err != nil && err != context.Canceled {
+			zapLogger.Error("maintenance service stopped with error", zap.Error(err))
+		}
+	}()
+
+	// Start the services of the a.namespaces
+	if a.namespaces != nil {
+		a.namespaces.Start(ctx)
+	}
+
+	// Start scheduled backups
+	if a.backups != nil {
+		go func() {
+			if err := a.backups.Start(ctx); err != nil && err != context.Canceled {
+				zapLogger.Error("backup service stopped with error", zap.Error(err))
+			}
+		}()
+	}
+
+	// Start replication
+	if a.replicator != nil {
+		go func() {
+			if err := a.replicator.Start(ctx); err != nil && err != context.Canceled {
+				zapLogger.Error("replicator stopped with error", zap.Error(err))
+			}
+		}()
+	}
+
+	zapLogger.Info("application started successfully",
+		zap.Strings("http_addrs", cfg.HTTP.BindAddrs),
+		zap.String("cache_dir", cfg.Cache.RootDir),
+	)
+	if _, err := systemd.Notify(systemd.Ready); err != nil {
+		zapLogger.Warn("failed to notify systemd of readiness", zap.Error(err))
+	}
+	go runWatchdog(ctx, a.server.CheckHealth, zapLogger)
+
+	// Run until the caller cancels ctx or the HTTP server fails
+	var runErr error
+	select {
+	case <-ctx.Done():
+		zapLogger.Info("shutdown signal received, stopping services...")
+	case err := <-serveErr:
+		runErr = fmt.Errorf("HTTP server failed: %w", err)
+		zapLogger.Error("HTTP server failed, stopping services...", zap.Error(err))
+	}
+	if _, err := systemd.Notify(systemd.Stopping); err != nil {
+		zapLogger.Warn("failed to notify systemd of shutdown", zap.Error(err))
+	}
+
+	// Cancel context to stop syncer and cacher
+	cancel()
+
+	// Create shutdown context with timeout
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer shutdownCancel()
+
+	// Stop syncer, cacher, and maintenance services
+	// The cacher lets in-flight downloads finish for up to cache.drain_timeout
+	a.syncer.Stop()
+	if a.elector != nil {
+		a.elector.Stop()
+	}
+	a.cacher.Stop()
+	a.maintenance.Stop()
+	if a.backups != nil {
+		a.backups.Stop()
+	}
+	if a.replicator != nil {
+		a.replicator.Stop()
+	}
+
+	// Stop HTTP server
+	if err := a.server.Stop(shutdownCtx); err != nil {
+		zapLogger.Error("failed to stop HTTP server gracefully", zap.Error(err))
+	}
+
+	// Abort running transcodes
+	if a.streams != nil {
+		a.streams.Stop()
+	}
+
+	// Logout from Synology
+	if err := a.synology.Logout(shutdownCtx); err != nil {
+		zapLogger.Error("failed to logout from Synology", zap.Error(err))
+	}
+
+	zapLogger.Info("application stopped successfully")
+	return runErr
+}
+
+// Close releases what New opened: the namespaces, the access log and the
+// database. Run closes the App when it returns; call Close only for an App
+// that is never run.
+func (a *App) Close() error {
+	a.closeOnce.Do(func() {
+		// Namespaces close their databases once no request uses them
+		if a.namespaces != nil {
+			a.namespaces.Stop()
+		}
+		if a.accessLog != nil {
+			a.accessLog.Close()
+		}
+		a.closeErr = a.storage.Close()
+	})
+	return a.closeErr
+}
+
+// runWatchdog sends systemd watchdog keep-alives at half the WatchdogSec=
+// interval while check succeeds, so systemd restarts an instance that hangs
+// or loses its database. It returns immediately when the watchdog is disabled.
+func runWatchdog(ctx context.Context, check func() error, log *zap.Logger) {
+	interval, err := systemd.WatchdogInterval()
+	if err != nil {
+		log.Warn("systemd watchdog disabled", zap.Error(err))
+		return
+	}
+	if interval == 0 {
+		return
+	}
+	log.Info("systemd watchdog enabled", zap.Duration("timeout", interval))
+
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := check(); err != nil {
+				log.Warn("health check failed, withholding watchdog keep-alive", zap.Error(err))
+				continue
+			}
+			if _, err := systemd.Notify(systemd.Watchdog); err != nil {
+				log.Warn("failed to send watchdog keep-alive", zap.Error(err))
+			}
+		}
+	}
+}
+
+// synologyUserAgent returns the User-Agent of NAS requests: the configured
+// product name, if any, followed by this app and its version
+func synologyUserAgent(cfg *config.Config) string {
+	userAgent := "synology-file-cache/" + Version
+	if cfg.Synology.UserAgent != "" {
+		userAgent = cfg.Synology.UserAgent + " " + userAgent
+	}
+	return userAgent
+}
+
+// partialConfig returns the configuration of serving files being downloaded
+func partialConfig(cfg *config.Config) *partial.Config {
+	partialCfg := partial.DefaultConfig()
+	partialCfg.WaitTimeout = cfg.Cache.GetServeInProgressWait()
+	partialCfg.OfficeExport = cfg.Cache.OfficeExport
+	return partialCfg
+}
+
+// loadSessionSecret returns http.session_secret, or else a secret generated
+// on first start and kept in the cache directory, so share sessions survive
+// restarts and are accepted by every instance sharing the directory
+func loadSessionSecret(cfg *config.Config) (string, error) {
+	if cfg.HTTP.SessionSecret != "" {
+		return cfg.HTTP.SessionSecret, nil
+	}
+
+	path := filepath.Join(cfg.Cache.RootDir, ".session_secret")
+	if data, err := os.ReadFile(path); err == nil {
+		if secret := strings.TrimSpace(string(data)); secret != "" {
+			return secret, nil
+		}
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	secret := hex.EncodeToString(key)
+	if err := os.MkdirAll(cfg.Cache.RootDir, 0755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, []byte(secret+"\n"), 0600); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// replicaReceiveDir returns where replicas received by a standby are stored
+func replicaReceiveDir(cfg *config.Config) string {
+	if cfg.Replication.ReceiveDir != "" {
+		return cfg.Replication.ReceiveDir
+	}
+	return filepath.Join(cfg.Cache.RootDir, ".replica")
+}
+
+// replicaTarget returns the replica configured as replication.target
+func replicaTarget(cfg *config.Config) (port.ReplicaStore, error) {
+	rc := cfg.Replication
+	if rc.Target == "http" {
+		return replica.NewHTTP(rc.HTTPURL, rc.HTTPToken, nil)
+	}
+	return replica.NewS3(replica.S3Config{
+		Endpoint:  rc.S3Endpoint,
+		Region:    rc.S3Region,
+		Bucket:    rc.S3Bucket,
+		Prefix:    rc.S3Prefix,
+		AccessKey: rc.S3AccessKey,
+		SecretKey: rc.S3SecretKey,
+		PathStyle: rc.S3PathStyle,
+	}, nil)
+}
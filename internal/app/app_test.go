@@ -0,0 +1,188 @@
+package app_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vertextoedge/synology-file-cache/internal/app"
+	"github.com/vertextoedge/synology-file-cache/internal/config"
+	"go.uber.org/zap"
+)
+
+// loadConfig loads a configuration for a cache in dir from the given YAML
+// sections, after the synology and cache.root_dir settings
+func loadConfig(t *testing.T, dir, nasURL, extra string) *config.Config {
+	t.Helper()
+	yaml := fmt.Sprintf(`synology:
+  base_url: %q
+  username: admin
+  password: secret
+cache:
+  root_dir: %q
+%s`, nasURL, filepath.Join(dir, "cache"), extra)
+
+	configPath := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(configPath, []byte(yaml), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("config.Load: %v", err)
+	}
+	return cfg
+}
+
+func TestNew_ServesWithoutRun(t *testing.T) {
+	dir := t.TempDir()
+	cfg := loadConfig(t, dir, "http://127.0.0.1:1", "")
+
+	a, err := app.New(cfg, zap.NewNop())
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer a.Close()
+
+	// New creates the database but starts nothing; the handler still answers
+	if _, err := os.Stat(filepath.Join(dir, "cache", "cache.db")); err != nil {
+		t.Errorf("database not created: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	a.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("GET /health = %d %q", rec.Code, rec.Body)
+	}
+	rec = httptest.NewRecorder()
+	a.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/f/unknown", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("GET /f/unknown = %d, want 404", rec.Code)
+	}
+
+	if err := a.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	if err := a.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+}
+
+func TestNew_UnusableCacheDir(t *testing.T) {
+	dir := t.TempDir()
+	cfg := loadConfig(t, dir, "http://127.0.0.1:1", "")
+
+	// cache.root_dir is a file
+	if err := os.WriteFile(cfg.Cache.RootDir, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.New(cfg, zap.NewNop()); err == nil {
+		t.Fatal("New with a file as cache.root_dir succeeded")
+	}
+}
+
+func TestNew_InvalidSettings(t *testing.T) {
+	dir := t.TempDir()
+	cfg := loadConfig(t, dir, "http://127.0.0.1:1", "")
+
+	// Settings parsed while wiring the services, after config validation
+	cfg.Sync.IncludePaths = []string{"relative/path"}
+	if _, err := app.New(cfg, zap.NewNop()); err == nil {
+		t.Fatal("New with an invalid sync.include_paths succeeded")
+	}
+
+	// The database was closed again, so the next App can open it
+	cfg.Sync.IncludePaths = nil
+	a, err := app.New(cfg, zap.NewNop())
+	if err != nil {
+		t.Fatalf("New after a failed New: %v", err)
+	}
+	a.Close()
+}
+
+func TestNew_SessionSecretPersists(t *testing.T) {
+	dir := t.TempDir()
+	cfg := loadConfig(t, dir, "http://127.0.0.1:1", "")
+
+	a, err := app.New(cfg, zap.NewNop())
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	a.Close()
+	path := filepath.Join(dir, "cache", ".session_secret")
+	secret, err := os.ReadFile(path)
+	if err != nil || len(secret) == 0 {
+		t.Fatalf("session secret not generated: %v", err)
+	}
+
+	// A restart signs share sessions with the same secret
+	a, err = app.New(cfg, zap.NewNop())
+	if err != nil {
+		t.Fatalf("second New: %v", err)
+	}
+	a.Close()
+	if again, _ := os.ReadFile(path); string(again) != string(secret) {
+		t.Errorf("session secret changed on restart: %q, was %q", again, secret)
+	}
+}
+
+func TestNew_NamespaceUnsupportedRoutes(t *testing.T) {
+	dir := t.TempDir()
+	cfg := loadConfig(t, dir, "http://127.0.0.1:1", fmt.Sprintf(`http:
+  enable_admin_api: true
+  admin_username: admin
+  admin_password: secret
+namespaces:
+  - name: design
+    synology_url: http://127.0.0.1:1
+    synology_username: design
+    synology_password: secret
+    root_dir: %q
+    max_size_gb: 1
+    admin_username: design
+    admin_password: secret
+`, filepath.Join(dir, "design")))
+
+	a, err := app.New(cfg, zap.NewNop())
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer a.Close()
+
+	// Features the namespace server is built without say so
+	for _, path := range []string{
+		"/t/design/f/token/thumb",
+		"/t/design/f/token/stream.m3u8",
+		"/t/design/f/token/seg00000.ts",
+		"/t/design/admin/browse",
+		"/t/design/admin/browse/mydrive",
+		"/t/design/api/v1/backups",
+		"/t/design/api/v1/backups/1",
+		"/t/design/api/v1/events",
+		"/t/design/api/v1/replica/objects",
+		"/t/design/api/v1/replica/objects/files/1",
+	} {
+		rec := httptest.NewRecorder()
+		a.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusNotImplemented || !strings.Contains(rec.Body.String(), "not available in namespaces") {
+			t.Errorf("GET %s = %d %q, want 501 naming namespaces", path, rec.Code, rec.Body)
+		}
+	}
+
+	// The main server keeps its plain answers
+	for path, want := range map[string]int{
+		"/f/token/thumb":   http.StatusNotFound,
+		"/admin/browse":    http.StatusNotFound,
+		"/api/v1/backups":  http.StatusUnauthorized,
+		"/api/v1/events":   http.StatusUnauthorized,
+		"/api/v1/replica/": http.StatusNotFound,
+	} {
+		rec := httptest.NewRecorder()
+		a.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != want {
+			t.Errorf("GET %s = %d %q, want %d", path, rec.Code, rec.Body, want)
+		}
+	}
+}
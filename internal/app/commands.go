@@ -0,0 +1,198 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/vertextoedge/synology-file-cache/internal/adapter/postgres"
+	"github.com/vertextoedge/synology-file-cache/internal/adapter/replica"
+	"github.com/vertextoedge/synology-file-cache/internal/adapter/sqlite"
+	"github.com/vertextoedge/synology-file-cache/internal/config"
+	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"github.com/vertextoedge/synology-file-cache/internal/service/metadata"
+	"github.com/vertextoedge/synology-file-cache/internal/service/replicator"
+	"go.uber.org/zap"
+)
+
+// Backup writes a database backup to the backup directory and returns its path
+func Backup(cfg *config.Config, zapLogger *zap.Logger) (string, error) {
+	st, err := openStorage(cfg, zapLogger)
+	if err != nil {
+		return "", err
+	}
+	defer st.Close()
+
+	backupService, err := st.backupService(cfg, zapLogger)
+	if err != nil {
+		return "", err
+	}
+	if backupService == nil {
+		return "", fmt.Errorf("-backup is only supported with the sqlite driver, use pg_dump for postgres")
+	}
+	info, err := backupService.Create()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(backupDir(cfg), info.Name), nil
+}
+
+// BootstrapReplica restores the database and cache from the replica
+func BootstrapReplica(ctx context.Context, cfg *config.Config, zapLogger *zap.Logger) error {
+	source, err := bootstrapSource(cfg)
+	if err != nil {
+		return fmt.Errorf("cannot bootstrap from replica: %w", err)
+	}
+	st, err := openStorage(cfg, zapLogger)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	result, err := replicator.Bootstrap(ctx, source, st.store, st.fs, zapLogger)
+	if err != nil {
+		return err
+	}
+	zapLogger.Info("bootstrapped from replica",
+		zap.Int("files", result.Files),
+		zap.Int64("bytes", result.Bytes),
+		zap.Int("skipped", result.Skipped),
+		zap.Int("shares", result.Shares))
+	return nil
+}
+
+// ExportMetadata writes the files and shares tables to dir in the named format
+func ExportMetadata(cfg *config.Config, zapLogger *zap.Logger, dir, formatName string) error {
+	st, err := openStorage(cfg, zapLogger)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	return exportMetadataTables(metadata.New(st.store, st.fs, zapLogger), dir, formatName)
+}
+
+// ImportMetadata imports files and shares exported with ExportMetadata from dir
+func ImportMetadata(cfg *config.Config, zapLogger *zap.Logger, dir string) error {
+	st, err := openStorage(cfg, zapLogger)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	return importMetadataTables(metadata.New(st.store, st.fs, zapLogger), dir, zapLogger)
+}
+
+// bootstrapSource returns the replica -bootstrap-replica restores from: the
+// replicas this instance received as a standby, else replication.target
+func bootstrapSource(cfg *config.Config) (port.ReplicaStore, error) {
+	if cfg.Replication.ReceiveEnabled {
+		return replica.NewDir(replicaReceiveDir(cfg))
+	}
+	if cfg.Replication.Target == "" || (cfg.Replication.S3Bucket == "" && cfg.Replication.HTTPURL == "") {
+		return nil, fmt.Errorf("set replication.receive_enabled on a standby or configure replication.target")
+	}
+	return replicaTarget(cfg)
+}
+
+// exportMetadataTables writes files.<format> and shares.<format> to dir
+func exportMetadataTables(service *metadata.Service, dir, formatName string) error {
+	format, err := metadata.ParseFormat(formatName)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	for _, table := range []metadata.Table{metadata.TableFiles, metadata.TableShares} {
+		path := filepath.Join(dir, string(table)+"."+string(format))
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		rows, err := service.Export(context.Background(), f, table, format)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("failed to export %s: %w", table, err)
+		}
+		fmt.Printf("%s: %d rows\n", path, rows)
+	}
+	return nil
+}
+
+// importMetadataTables imports the files, then the shares exported to dir,
+// in the format of the files found there
+func importMetadataTables(service *metadata.Service, dir string, logger *zap.Logger) error {
+	for _, table := range []metadata.Table{metadata.TableFiles, metadata.TableShares} {
+		path, format, err := findMetadataExport(dir, table)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		result, err := service.Import(context.Background(), f, table, format)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to import %s: %w", path, err)
+		}
+		logger.Info("imported metadata",
+			zap.String("path", path),
+			zap.Int("files", result.Files),
+			zap.Int("linked", result.Linked),
+			zap.Int("missing", result.Missing),
+			zap.Int("shares", result.Shares),
+			zap.Int("skipped", result.Skipped))
+	}
+	return nil
+}
+
+// findMetadataExport returns the export of table in dir and its format
+func findMetadataExport(dir string, table metadata.Table) (string, metadata.Format, error) {
+	for _, format := range []metadata.Format{metadata.FormatJSON, metadata.FormatCSV} {
+		path := filepath.Join(dir, string(table)+"."+string(format))
+		if _, err := os.Stat(path); err == nil {
+			return path, format, nil
+		}
+	}
+	return "", "", fmt.Errorf("no %s.json or %s.csv in %s", table, table, dir)
+}
+
+// RestoreBackup replaces the database with a backup given as a path or a
+// file name in the backup directory. Returns the backup path used.
+func RestoreBackup(cfg *config.Config, backupPath string) (string, error) {
+	if cfg.Database.Driver == "postgres" {
+		return "", fmt.Errorf("-restore-backup is only supported with the sqlite driver, use pg_restore for postgres")
+	}
+	if _, err := os.Stat(backupPath); err != nil && !strings.ContainsRune(backupPath, os.PathSeparator) {
+		backupPath = filepath.Join(backupDir(cfg), backupPath)
+	}
+	if err := sqlite.Restore(backupPath, databasePath(cfg)); err != nil {
+		return "", err
+	}
+	return backupPath, nil
+}
+
+// RevertMigrations reverts the schema migrations newer than version
+func RevertMigrations(cfg *config.Config, version int) error {
+	var store interface {
+		MigrateDown(version int) error
+		Close() error
+	}
+	var err error
+	if cfg.Database.Driver == "postgres" {
+		store, err = postgres.Open(cfg.Database.DSN)
+	} else {
+		store, err = sqlite.Open(databasePath(cfg), sqlite.Options{})
+	}
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	return store.MigrateDown(version)
+}
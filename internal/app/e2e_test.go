@@ -0,0 +1,341 @@
+//go:build e2e
+
+package app_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/app"
+	"github.com/vertextoedge/synology-file-cache/internal/testutil/synomock"
+	"go.uber.org/zap"
+)
+
+const (
+	adminUser     = "admin"
+	adminPassword = "e2e-password"
+)
+
+// instance is the whole application running against a fake NAS
+type instance struct {
+	url  string
+	root string // cache.root_dir
+	done chan error
+	stop context.CancelFunc
+}
+
+// start runs the application against nas and waits for /health
+func start(t *testing.T, nas *synomock.Server) *instance {
+	t.Helper()
+	dir := t.TempDir()
+	addr := freeAddr(t)
+	cfg := loadConfig(t, dir, nas.URL, fmt.Sprintf(`  max_disk_usage_percent: 100
+  low_space_headroom_percent: 0
+  worker_poll_interval: 20ms
+sync:
+  purge_revoked_shares: true
+http:
+  bind_addr: %q
+  enable_admin_api: true
+  admin_username: %q
+  admin_password: %q
+`, addr, adminUser, adminPassword))
+	cfg.Synology.RetryBaseDelay = "10ms"
+	cfg.Synology.RetryMaxDelay = "100ms"
+
+	a, err := app.New(cfg, zap.NewNop())
+	if err != nil {
+		t.Fatalf("app.New: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	inst := &instance{
+		url:  "http://" + addr,
+		root: cfg.Cache.RootDir,
+		done: make(chan error, 1),
+		stop: cancel,
+	}
+	go func() {
+		inst.done <- a.Run(ctx)
+	}()
+	t.Cleanup(func() { inst.shutdown(t) })
+
+	inst.waitFor(t, "/health", func(resp *http.Response, _ []byte) bool {
+		return resp.StatusCode == http.StatusOK
+	})
+	return inst
+}
+
+// shutdown cancels the context of Run and waits for it to return
+func (inst *instance) shutdown(t *testing.T) {
+	t.Helper()
+	inst.stop()
+	select {
+	case err, ok := <-inst.done:
+		if ok && err != nil {
+			t.Errorf("Run: %v", err)
+		}
+		close(inst.done)
+	case <-time.After(40 * time.Second):
+		t.Fatal("Run did not return after its context was canceled")
+	}
+}
+
+// get requests path, with the admin credentials for the admin API
+func (inst *instance) get(t *testing.T, method, path string, header http.Header) (*http.Response, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(method, inst.url+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.SetBasicAuth(adminUser, adminPassword)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading %s: %v", path, err)
+	}
+	return resp, body
+}
+
+// waitFor polls GET path until ok accepts the response or the test times out
+func (inst *instance) waitFor(t *testing.T, path string, ok func(*http.Response, []byte) bool) []byte {
+	t.Helper()
+	deadline := time.Now().Add(20 * time.Second)
+	for {
+		req, _ := http.NewRequest(http.MethodGet, inst.url+path, nil)
+		if resp, err := http.DefaultClient.Do(req); err == nil {
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if ok(resp, body) {
+				return body
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("GET %s: %d %q", path, resp.StatusCode, body)
+			}
+		} else if time.Now().After(deadline) {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// cachedCopies returns the files below the cache directory holding content
+func (inst *instance) cachedCopies(t *testing.T, content []byte) []string {
+	t.Helper()
+	var found []string
+	err := filepath.WalkDir(inst.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if data, err := os.ReadFile(path); err == nil && bytes.Equal(data, content) {
+			found = append(found, path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walking the cache directory: %v", err)
+	}
+	return found
+}
+
+// freeAddr returns a loopback address nothing listens on
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+func TestE2E_SyncDownloadServeAndPurge(t *testing.T) {
+	nas := synomock.New()
+	defer nas.Close()
+
+	report := bytes.Repeat([]byte("quarterly report "), 4096) // 68KB
+	nas.AddFile(synomock.File{Path: "/mydrive/report.pdf", Content: report, ShareToken: "report"})
+	nas.AddFile(synomock.File{Path: "/mydrive/notes.txt", Content: []byte("starred notes"), Starred: true})
+
+	inst := start(t, nas)
+
+	// The initial full sync queues the shared file, a worker downloads it and
+	// the share link serves the cached copy
+	body := inst.waitFor(t, "/f/report", func(resp *http.Response, _ []byte) bool {
+		return resp.StatusCode == http.StatusOK
+	})
+	if !bytes.Equal(body, report) {
+		t.Fatalf("GET /f/report returned %d bytes, want the %d bytes of the file", len(body), len(report))
+	}
+	if copies := inst.cachedCopies(t, report); len(copies) != 1 {
+		t.Fatalf("cached copies of report.pdf = %v, want one", copies)
+	}
+
+	// Ranges are served from the copy without asking the NAS again
+	downloads := len(nas.DownloadRanges("/mydrive/report.pdf"))
+	resp, body := inst.get(t, http.MethodGet, "/f/report", http.Header{"Range": {"bytes=100-199"}})
+	if resp.StatusCode != http.StatusPartialContent || !bytes.Equal(body, report[100:200]) {
+		t.Errorf("range request = %d %q", resp.StatusCode, body)
+	}
+	if got := len(nas.DownloadRanges("/mydrive/report.pdf")); got != downloads {
+		t.Errorf("range request downloaded from the NAS: %d downloads, want %d", got, downloads)
+	}
+
+	// The workers report the finished download
+	resp, body = inst.get(t, http.MethodGet, "/api/v1/workers", nil)
+	var workers struct {
+		Workers []struct {
+			TasksCompleted int `json:"tasks_completed"`
+		} `json:"workers"`
+	}
+	completed := 0
+	if err := json.Unmarshal(body, &workers); err == nil {
+		for _, w := range workers.Workers {
+			completed += w.TasksCompleted
+		}
+	}
+	if resp.StatusCode != http.StatusOK || completed == 0 {
+		t.Errorf("GET /api/v1/workers = %d %q, want a completed task", resp.StatusCode, body)
+	}
+
+	// The synology-style share URL serves the same copy
+	if resp, body := inst.get(t, http.MethodGet, "/d/s/report", nil); resp.StatusCode != http.StatusOK || !bytes.Equal(body, report) {
+		t.Errorf("GET /d/s/report = %d, %d bytes", resp.StatusCode, len(body))
+	}
+
+	// Starred files are cached even though no share serves them
+	inst.waitFor(t, "/health", func(*http.Response, []byte) bool {
+		return len(inst.cachedCopies(t, []byte("starred notes"))) == 1
+	})
+
+	// Unknown tokens are not served
+	if resp, _ := inst.get(t, http.MethodGet, "/f/missing", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET /f/missing = %d, want 404", resp.StatusCode)
+	}
+
+	// Once the share is removed on the NAS the next sync revokes it and
+	// evicts the copy, which no other share or star keeps in the cache
+	nas.RemoveFile("/mydrive/report.pdf")
+	if resp, body := inst.get(t, http.MethodPost, "/api/v1/sync", nil); resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("POST /api/v1/sync = %d %q", resp.StatusCode, body)
+	}
+	inst.waitFor(t, "/f/report", func(resp *http.Response, _ []byte) bool {
+		return resp.StatusCode == http.StatusGone
+	})
+	inst.waitFor(t, "/health", func(*http.Response, []byte) bool {
+		return len(inst.cachedCopies(t, report)) == 0
+	})
+	if copies := inst.cachedCopies(t, []byte("starred notes")); len(copies) != 1 {
+		t.Errorf("starred copy evicted with the share: %v", copies)
+	}
+}
+
+func TestE2E_PasswordProtectedShare(t *testing.T) {
+	nas := synomock.New()
+	defer nas.Close()
+	content := []byte("confidential")
+	nas.AddFile(synomock.File{Path: "/mydrive/secret.txt", Content: content, ShareToken: "locked", SharePassword: "open sesame"})
+
+	inst := start(t, nas)
+	noRedirects := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	do := func(method, path, contentType, body string, header http.Header) (*http.Response, []byte) {
+		t.Helper()
+		req, _ := http.NewRequest(method, inst.url+path, strings.NewReader(body))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		resp, err := noRedirects.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return resp, data
+	}
+
+	// The password as a query parameter, for players that cannot send Basic auth
+	body := inst.waitFor(t, "/f/locked?password=open+sesame", func(resp *http.Response, _ []byte) bool {
+		return resp.StatusCode == http.StatusOK
+	})
+	if !bytes.Equal(body, content) {
+		t.Fatalf("GET with ?password= returned %q", body)
+	}
+	if resp, _ := do(http.MethodGet, "/f/locked?password=wrong", "", "", nil); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("wrong ?password= = %d, want 403", resp.StatusCode)
+	}
+
+	// Other clients are challenged, browsers get a form
+	if resp, _ := do(http.MethodGet, "/f/locked", "", "", nil); resp.StatusCode != http.StatusUnauthorized || resp.Header.Get("WWW-Authenticate") == "" {
+		t.Errorf("GET without password = %d, WWW-Authenticate %q", resp.StatusCode, resp.Header.Get("WWW-Authenticate"))
+	}
+	resp, page := do(http.MethodGet, "/f/locked", "", "", http.Header{"Accept": {"text/html"}})
+	if resp.StatusCode != http.StatusUnauthorized || !strings.Contains(string(page), `<form method="post"`) {
+		t.Errorf("browser GET without password = %d %q, want the password form", resp.StatusCode, page)
+	}
+
+	// A form post sets the session cookie and redirects back to the share
+	resp, _ = do(http.MethodPost, "/f/locked", "application/x-www-form-urlencoded", "password=open+sesame", nil)
+	if resp.StatusCode != http.StatusSeeOther || resp.Header.Get("Location") != "/f/locked" || len(resp.Cookies()) == 0 {
+		t.Fatalf("form POST = %d, Location %q, cookies %v", resp.StatusCode, resp.Header.Get("Location"), resp.Cookies())
+	}
+	cookie := resp.Cookies()[0]
+	if cookie.Name != "share_session" || cookie.Secure || cookie.SameSite != http.SameSiteStrictMode {
+		t.Errorf("session cookie %v, want a strict, non-secure share_session cookie over plain HTTP", cookie)
+	}
+	if resp, body := do(http.MethodGet, "/f/locked", "", "", http.Header{"Cookie": {cookie.String()}}); resp.StatusCode != http.StatusOK || !bytes.Equal(body, content) {
+		t.Errorf("GET with the session cookie = %d %q", resp.StatusCode, body)
+	}
+	forged := &http.Cookie{Name: cookie.Name, Value: cookie.Value + "x"}
+	if resp, _ := do(http.MethodGet, "/f/locked", "", "", http.Header{"Cookie": {forged.String()}}); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("GET with a forged session cookie = %d, want 401", resp.StatusCode)
+	}
+
+	// A JSON post is answered with the file
+	resp, body = do(http.MethodPost, "/f/locked", "application/json", `{"password":"open sesame"}`, nil)
+	if resp.StatusCode != http.StatusOK || !bytes.Equal(body, content) || len(resp.Cookies()) == 0 {
+		t.Errorf("JSON POST = %d %q, cookies %v", resp.StatusCode, body, resp.Cookies())
+	}
+}
+
+func TestE2E_RunReturnsListenError(t *testing.T) {
+	nas := synomock.New()
+	defer nas.Close()
+	inst := start(t, nas)
+
+	// A second instance on the same address fails before serving anything
+	addr := strings.TrimPrefix(inst.url, "http://")
+	cfg := loadConfig(t, t.TempDir(), nas.URL, fmt.Sprintf("http:\n  bind_addr: %q\n", addr))
+	a, err := app.New(cfg, zap.NewNop())
+	if err != nil {
+		t.Fatalf("app.New: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := a.Run(ctx); err == nil {
+		t.Fatal("Run on an address in use returned nil")
+	}
+}
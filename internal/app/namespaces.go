@@ -0,0 +1,172 @@
+package app
+
+import (
+	"fmt"
+
+	"github.com/vertextoedge/synology-file-cache/internal/adapter/filesystem"
+	"github.com/vertextoedge/synology-file-cache/internal/adapter/sqlite"
+	"github.com/vertextoedge/synology-file-cache/internal/adapter/synology"
+	"github.com/vertextoedge/synology-file-cache/internal/config"
+	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"github.com/vertextoedge/synology-file-cache/internal/service/cacher"
+	"github.com/vertextoedge/synology-file-cache/internal/service/maintenance"
+	"github.com/vertextoedge/synology-file-cache/internal/service/metadata"
+	"github.com/vertextoedge/synology-file-cache/internal/service/namespace"
+	"github.com/vertextoedge/synology-file-cache/internal/service/partial"
+	"github.com/vertextoedge/synology-file-cache/internal/service/server"
+	"github.com/vertextoedge/synology-file-cache/internal/service/syncer"
+	"github.com/vertextoedge/synology-file-cache/internal/util/cryptfile"
+	"go.uber.org/zap"
+)
+
+// namespaceBase holds the main instance's service settings namespaces
+// start from
+type namespaceBase struct {
+	cfg            *config.Config
+	syncer         *syncer.Config
+	cacher         *cacher.Config
+	maintenance    *maintenance.Config
+	server         *server.Config
+	encryptionKeys *cryptfile.Keyring
+	preServeHooks  []port.PreServeHook
+}
+
+// buildNamespace creates the database, cache, Synology client, services and
+// HTTP handler of a namespace. Paths of the main instance (pre-seeded paths,
+// include paths, team folders) and its previews, streams, chunks, backups,
+// replication and event stream are not carried over; their routes answer
+// 501 Not Implemented.
+func buildNamespace(base *namespaceBase, ns *config.NamespaceConfig, logger *zap.Logger) (*namespace.Instance, error) {
+	cfg := base.cfg
+	logger = logger.With(zap.String("namespace", ns.Name))
+	maxBytes := int64(ns.MaxSizeGB) * 1024 * 1024 * 1024
+
+	fsManager, err := filesystem.NewManagerWithBufferSize(ns.RootDir, cfg.Cache.GetBufferSize())
+	if err != nil {
+		return nil, err
+	}
+	if base.encryptionKeys != nil {
+		fsManager.EnableEncryption(base.encryptionKeys)
+	}
+
+	store, err := sqlite.Open(ns.GetDatabasePath(), sqliteOptions(cfg))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	store.EnableShareCache(cfg.Database.GetShareCacheSize(), cfg.Database.GetShareCacheTTL())
+	if cfg.Cache.StaleWhileRevalidate {
+		store.EnableStaleWhileRevalidate()
+	}
+
+	synoClient := synology.NewClientWithConfig(
+		ns.SynologyURL,
+		ns.SynologyUsername,
+		ns.SynologyPassword,
+		ns.SkipTLSVerify,
+		&synology.ClientConfig{
+			BufferSizeMB:        cfg.Cache.BufferSizeMB,
+			RetryAttempts:       cfg.Synology.RetryAttempts,
+			RetryBaseDelay:      cfg.Synology.GetRetryBaseDelay(),
+			RetryMaxDelay:       cfg.Synology.GetRetryMaxDelay(),
+			BreakerThreshold:    cfg.Synology.CircuitFailureThreshold,
+			BreakerOpenDuration: cfg.Synology.GetCircuitOpenDuration(),
+			UserAgent:           synologyUserAgent(cfg),
+			RequestParams:       cfg.Synology.RequestParams,
+			Logger:              logger,
+		},
+	)
+	driveClient := synology.NewDriveClient(synoClient)
+
+	syncerCfg := *base.syncer
+	syncerCfg.MaxCacheSize = maxBytes
+	syncerCfg.PreseedPaths = nil
+	syncerCfg.TeamFolders = nil
+	syncerCfg.IncludePaths = nil
+	syncerService := syncer.New(&syncerCfg, driveClient, store, store, store, logger)
+	fileStationClient := synology.NewFileStationClient(synoClient)
+	if cfg.Sync.EnableFileStationShares {
+		syncerService.EnableFileStationShares(fileStationClient)
+	}
+	syncerService.EnableShareCreation(fileStationClient)
+	syncerService.EnableAudit(store)
+	syncerService.EnablePreseedPaths(store)
+	syncerService.EnableLabels(store)
+	if syncerCfg.AutoTune.Enabled {
+		syncerService.EnableAutoTune(store)
+	}
+	if base.cacher.Quota.Enabled() {
+		syncerService.EnableQuotas(base.cacher.Quota)
+	}
+
+	cacherCfg := *base.cacher
+	cacherCfg.MaxSizeBytes = maxBytes
+	cacherCfg.Stats = nil
+	cacherService := cacher.New(&cacherCfg, driveClient, store, store, fsManager, logger)
+	if len(base.preServeHooks) > 0 {
+		cacherService.EnablePreServeHooks(base.preServeHooks...)
+	}
+	if cfg.Sync.PurgeRevokedShares {
+		syncerService.EnableRevocationPurge(cacherService)
+	}
+
+	maintenanceCfg := *base.maintenance
+	maintenanceService := maintenance.New(&maintenanceCfg, store, fsManager, logger)
+	maintenanceService.EnableAuditCleanup(store)
+	if cfg.Cache.OrphanAction != "off" {
+		maintenanceService.EnableOrphanCollection(store, cfg.Cache.OrphanAction != "delete")
+	}
+	if base.encryptionKeys != nil {
+		maintenanceService.EnableReencryption(fsManager)
+	}
+
+	// Requests below /t/ skip the main server's middleware; this server logs,
+	// rate limits and compresses them with the main settings
+	serverCfg := *base.server
+	serverCfg.BindAddrs = nil
+	serverCfg.Listeners = nil
+	serverCfg.AdminUsername = ns.AdminUsername
+	serverCfg.AdminPassword = ns.AdminPassword
+	serverCfg.AdminPasswordHash = ns.AdminPasswordHash
+	serverCfg.EnableAdminBrowser = false
+	serverCfg.EnableAdminAPI = cfg.HTTP.EnableAdminAPI && ns.AdminUsername != ""
+	serverCfg.CacheRootDir = ns.RootDir
+	serverCfg.PathPrefix = namespace.PathPrefix + ns.Name
+	serverCfg.Unsupported = "not available in namespaces"
+	serverCfg.SyncTrigger = syncerService.TriggerSync
+	serverCfg.DriveChanges = syncerService.NotifyChanges
+	serverCfg.SyncDryRun = syncerService.DryRun
+	serverCfg.CacheRequest = syncerService.RequestCache
+	serverCfg.CreateShare = syncerService.CreateShare
+	serverCfg.RejectCached = cacherService.RejectCached
+	serverCfg.Workers = cacherService.Workers
+	serverCfg.SyncScope = syncerService.SyncScope
+	serverCfg.PreseedPaths = nil
+	serverCfg.PreseedTrigger = syncerService.TriggerPreseedSync
+	serverCfg.Previews = nil
+	serverCfg.Streams = nil
+	serverCfg.Chunks = nil
+	if cfg.Cache.ServeInProgress {
+		serverCfg.Partial = partial.New(partialConfig(cfg), store, driveClient, logger)
+	}
+	serverCfg.Backups = nil
+	serverCfg.Metadata = metadata.New(store, fsManager, logger)
+	serverCfg.Events = nil
+	serverCfg.ReplicaReceiver = nil
+	serverCfg.Namespaces = nil
+	serverCfg.Passthrough = false
+	serverCfg.Stats = nil
+	serverCfg.CacheMaxBytes = maxBytes
+	serverCfg.SynologyURL = ns.SynologyURL
+	serverCfg.SynologySkipTLS = ns.SkipTLSVerify
+	serverCfg.UpstreamStatus = synoClient.ConnectionError
+	nsServer := server.New(&serverCfg, store, logger)
+
+	return &namespace.Instance{
+		Name:     ns.Name,
+		Handler:  nsServer.Handler(),
+		Connect:  synoClient.Connect,
+		Services: []namespace.Runner{maintenanceService},
+		Upstream: []namespace.Runner{syncerService, cacherService},
+		Close:    store.Close,
+	}, nil
+}
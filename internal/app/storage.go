@@ -0,0 +1,137 @@
+package app
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/vertextoedge/synology-file-cache/internal/adapter/filesystem"
+	"github.com/vertextoedge/synology-file-cache/internal/adapter/postgres"
+	"github.com/vertextoedge/synology-file-cache/internal/adapter/sqlite"
+	"github.com/vertextoedge/synology-file-cache/internal/config"
+	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"github.com/vertextoedge/synology-file-cache/internal/service/backup"
+	"github.com/vertextoedge/synology-file-cache/internal/util/cryptfile"
+	"go.uber.org/zap"
+)
+
+// storage is the cache directory and database of the main instance
+type storage struct {
+	fs             *filesystem.Manager
+	store          port.Store
+	sqlite         *sqlite.Store // nil with the postgres driver
+	encryptionKeys *cryptfile.Keyring
+}
+
+// openStorage sets up the cache directory and opens the database
+func openStorage(cfg *config.Config, zapLogger *zap.Logger) (*storage, error) {
+	fsManager, err := filesystem.NewManagerWithBufferSize(cfg.Cache.RootDir, cfg.Cache.GetBufferSize())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create filesystem manager: %w", err)
+	}
+	if cfg.Cache.TempDir != "" {
+		sameFS, err := fsManager.SetTempDir(cfg.Cache.TempDir)
+		switch {
+		case err != nil:
+			zapLogger.Error("cache.temp_dir is unusable, writing temp files next to cached files",
+				zap.String("temp_dir", cfg.Cache.TempDir),
+				zap.Error(err))
+		case !sameFS:
+			zapLogger.Warn("cache.temp_dir is on another filesystem than cache.root_dir, completed downloads are copied into the cache",
+				zap.String("temp_dir", cfg.Cache.TempDir),
+				zap.String("root_dir", cfg.Cache.RootDir))
+		}
+	}
+	if cfg.Cache.TrashEnabled {
+		trashBytes := int64(cfg.Cache.TrashMaxSizeGB) * 1024 * 1024 * 1024
+		if err := fsManager.EnableTrash(trashBytes, cfg.Cache.GetTrashMaxAge()); err != nil {
+			zapLogger.Error("trash is unusable, deleting evicted files right away", zap.Error(err))
+		}
+	}
+	encryptionKeys, err := cfg.Cache.GetEncryptionKeys()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load cache encryption keys: %w", err)
+	}
+	if encryptionKeys != nil {
+		fsManager.EnableEncryption(encryptionKeys)
+		zapLogger.Info("cache encryption at rest enabled",
+			zap.String("key_id", encryptionKeys.Current().ID()))
+	}
+
+	st := &storage{fs: fsManager, encryptionKeys: encryptionKeys}
+	if cfg.Database.Driver == "postgres" {
+		pgStore, err := postgres.Open(cfg.Database.DSN)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open postgres database: %w", err)
+		}
+		if cfg.Cache.StaleWhileRevalidate {
+			pgStore.EnableStaleWhileRevalidate()
+		}
+		st.store = pgStore
+	} else {
+		dbPath := databasePath(cfg)
+		sqliteStore, err := sqlite.Open(dbPath, sqliteOptions(cfg))
+		if err != nil {
+			return nil, fmt.Errorf("failed to open database %s: %w", dbPath, err)
+		}
+		sqliteStore.EnableShareCache(cfg.Database.GetShareCacheSize(), cfg.Database.GetShareCacheTTL())
+		if cfg.Cache.StaleWhileRevalidate {
+			sqliteStore.EnableStaleWhileRevalidate()
+		}
+		st.store, st.sqlite = sqliteStore, sqliteStore
+	}
+	return st, nil
+}
+
+// Close closes the database
+func (st *storage) Close() error {
+	return st.store.Close()
+}
+
+// backupService returns the backup service of a SQLite database, nil with
+// the postgres driver
+func (st *storage) backupService(cfg *config.Config, zapLogger *zap.Logger) (*backup.Service, error) {
+	if st.sqlite == nil {
+		return nil, nil
+	}
+	backupCfg := &backup.Config{
+		Dir:  backupDir(cfg),
+		Keep: cfg.Backup.Keep,
+	}
+	if cfg.Backup.Enabled {
+		backupCfg.Interval = cfg.Backup.GetInterval()
+	}
+	service, err := backup.New(backupCfg, st.sqlite, zapLogger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create backup service: %w", err)
+	}
+	return service, nil
+}
+
+// databasePath returns the configured database path
+func databasePath(cfg *config.Config) string {
+	if cfg.Database.Path != "" {
+		return cfg.Database.Path
+	}
+	return filepath.Join(cfg.Cache.RootDir, "cache.db")
+}
+
+// sqliteOptions returns the options of SQLite databases
+func sqliteOptions(cfg *config.Config) sqlite.Options {
+	return sqlite.Options{
+		CacheSizeMB:   cfg.Database.CacheSizeMB,
+		BusyTimeoutMs: cfg.Database.BusyTimeoutMs,
+		MaxOpenConns:  cfg.Database.MaxOpenConns,
+		MaxIdleConns:  cfg.Database.MaxIdleConns,
+		ReadConns:     cfg.Database.ReadConns,
+
+		WriteBatchSize: cfg.Database.WriteBatchSize,
+	}
+}
+
+// backupDir returns the configured backup directory
+func backupDir(cfg *config.Config) string {
+	if cfg.Backup.Dir != "" {
+		return cfg.Backup.Dir
+	}
+	return filepath.Join(cfg.Cache.RootDir, ".backups")
+}
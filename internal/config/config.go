@@ -2,11 +2,19 @@ package config
 
 import (
 	"fmt"
+	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
+	"unicode"
 
 	"github.com/spf13/viper"
+	"github.com/vertextoedge/synology-file-cache/internal/util/cachecontrol"
+	"github.com/vertextoedge/synology-file-cache/internal/util/cryptfile"
+	"github.com/vertextoedge/synology-file-cache/internal/util/ipfilter"
+	"github.com/vertextoedge/synology-file-cache/internal/util/passhash"
 )
 
 // Config represents the entire application configuration
@@ -17,6 +25,16 @@ type Config struct {
 	HTTP     HTTPConfig     `mapstructure:"http"`
 	Logging  LoggingConfig  `mapstructure:"logging"`
 	Database DatabaseConfig `mapstructure:"database"`
+	Preview  PreviewConfig  `mapstructure:"preview"`
+	Stream   StreamConfig   `mapstructure:"stream"`
+	Chunks   ChunksConfig   `mapstructure:"chunks"`
+	Backup   BackupConfig   `mapstructure:"backup"`
+	Stats    StatsConfig    `mapstructure:"stats"`
+	Cluster  ClusterConfig  `mapstructure:"cluster"`
+	Scan     ScanConfig     `mapstructure:"scan"`
+
+	Replication ReplicationConfig `mapstructure:"replication"`
+	Namespaces  []NamespaceConfig `mapstructure:"namespaces"`
 }
 
 // SynologyConfig contains Synology API configuration
@@ -25,11 +43,23 @@ type SynologyConfig struct {
 	Username       string `mapstructure:"username"`
 	Password       string `mapstructure:"password"`
 	SkipTLSVerify  bool   `mapstructure:"skip_tls_verify"`
+
+	// Transient error handling (timeouts, 5xx, DSM busy during updates)
+	RetryAttempts           int    `mapstructure:"retry_attempts"`
+	RetryBaseDelay          string `mapstructure:"retry_base_delay"`
+	RetryMaxDelay           string `mapstructure:"retry_max_delay"`
+	CircuitFailureThreshold int    `mapstructure:"circuit_failure_threshold"` // Consecutive failed calls that pause NAS calls (0 = disabled)
+	CircuitOpenDuration     string `mapstructure:"circuit_open_duration"`
+
+	// Identification in DSM connection logs
+	UserAgent     string            `mapstructure:"user_agent"`     // Product name sent before "synology-file-cache/<version>"
+	RequestParams map[string]string `mapstructure:"request_params"` // Extra query parameters on every NAS request
 }
 
 // CacheConfig contains cache settings
 type CacheConfig struct {
 	RootDir                string `mapstructure:"root_dir"`
+	TempDir                string `mapstructure:"temp_dir"` // In-progress downloads, e.g. on a scratch disk (empty = next to the cached file)
 	MaxSizeGB              int    `mapstructure:"max_size_gb"`
 	MaxDiskUsagePercent    int    `mapstructure:"max_disk_usage_percent"`
 	RecentModifiedDays     int    `mapstructure:"recent_modified_days"`
@@ -42,7 +72,61 @@ type CacheConfig struct {
 	WorkerPollInterval     string `mapstructure:"worker_poll_interval"`
 	WorkerErrorBackoff     string `mapstructure:"worker_error_backoff"`
 	EvictionBatchSize      int    `mapstructure:"eviction_batch_size"`
+	EvictionPolicy         string `mapstructure:"eviction_policy"` // Order of same-priority files: "lru" or "lfu"
 	MaxDownloadRetries     int    `mapstructure:"max_download_retries"`
+	PriorityAgingAge       string `mapstructure:"priority_aging_age"`
+	FailedTaskRetention    string `mapstructure:"failed_task_retention"`
+	DrainTimeout           string `mapstructure:"drain_timeout"`
+	MissingUpstreamTTL     string `mapstructure:"missing_upstream_ttl"` // How long files found deleted on the NAS are not downloaded again
+
+	PreseedPaths []string `mapstructure:"preseed_paths"` // Drive folders that are always cached and never evicted
+
+	CompressAtRest bool `mapstructure:"compress_at_rest"` // Store cached text-like files gzip-compressed
+
+	LowSpaceHeadroomPercent float64 `mapstructure:"low_space_headroom_percent"` // Pause downloads below this free headroom (0 = disabled)
+	SpaceCheckInterval      string  `mapstructure:"space_check_interval"`
+
+	DownloadWindow               []string `mapstructure:"download_window"`                 // Off-peak "HH:MM-HH:MM" ranges for bulk downloads (empty = always)
+	DownloadWindowBypassPriority int      `mapstructure:"download_window_bypass_priority"` // Tasks at this priority or more urgent ignore the window
+
+	OwnerQuotaGB int `mapstructure:"owner_quota_gb"` // Max cached size per Drive owner (0 = unlimited)
+	LabelQuotaGB int `mapstructure:"label_quota_gb"` // Max cached size per label (0 = unlimited)
+
+	OfficeExport string `mapstructure:"office_export"` // Convert Synology Office documents: "native" (docx/xlsx/pptx), "pdf" or "" (as-is)
+
+	Dedup bool `mapstructure:"dedup"` // Share one copy between files with identical content
+
+	StaleWhileRevalidate bool `mapstructure:"stale_while_revalidate"` // Serve the old copy of a modified file until the new one is cached
+
+	BoostOnAccess bool `mapstructure:"boost_on_access"` // Promote requested files and move their queued downloads to the front
+	BoostPriority int  `mapstructure:"boost_priority"`  // Priority requested files are promoted to (1-5)
+
+	SegmentsPerFile  int `mapstructure:"segments_per_file"`   // Parallel range connections per large download (1 = single stream)
+	SegmentMinSizeMB int `mapstructure:"segment_min_size_mb"` // Smaller files are downloaded in one stream
+
+	ClaimBatchSize  int `mapstructure:"claim_batch_size"`   // Tasks a worker claims at once and downloads in turn (1 = one at a time)
+	ClaimBatchMaxMB int `mapstructure:"claim_batch_max_mb"` // Total size a batch of claimed tasks may not exceed
+
+	ReservedWorkers []WorkerReservation `mapstructure:"reserved_workers"` // Download workers kept for urgent priorities
+
+	DownloadIdleTimeout     string `mapstructure:"download_idle_timeout"`      // Abort a download receiving no data this long ("0" = never)
+	DownloadMinThroughputKB int    `mapstructure:"download_min_throughput_kb"` // KB/s a download may not fall below over the whole file (0 = no limit)
+
+	ServeInProgress     bool   `mapstructure:"serve_in_progress"`      // Serve files being downloaded from their temp file, proxying the rest from the NAS
+	ServeInProgressWait string `mapstructure:"serve_in_progress_wait"` // How long a response waits for the download before proxying from the NAS
+
+	OrphanAction       string `mapstructure:"orphan_action"`        // Cached files no DB row references: "quarantine", "delete" or "off"
+	OrphanScanInterval string `mapstructure:"orphan_scan_interval"` // How often the cache is scanned for orphans
+
+	TrashEnabled   bool   `mapstructure:"trash_enabled"`     // Move evicted and purged copies to a trash instead of deleting them
+	TrashMaxSizeGB int    `mapstructure:"trash_max_size_gb"` // Oldest trashed copies are purged beyond this size
+	TrashMaxAge    string `mapstructure:"trash_max_age"`     // Trashed copies are purged after this long
+
+	// AES-256-GCM encryption of cached copies at rest, with a 32 byte key given
+	// as 64 hex digits or base64, inline or in a file (both empty = disabled)
+	EncryptionKey         string   `mapstructure:"encryption_key"`
+	EncryptionKeyFile     string   `mapstructure:"encryption_key_file"`
+	EncryptionOldKeyFiles []string `mapstructure:"encryption_old_key_files"` // Previous keys, still decrypted and re-encrypted at startup
 }
 
 // SyncConfig contains synchronization settings
@@ -50,30 +134,251 @@ type SyncConfig struct {
 	FullScanInterval    string   `mapstructure:"full_scan_interval"`
 	IncrementalInterval string   `mapstructure:"incremental_interval"`
 	PrefetchInterval    string   `mapstructure:"prefetch_interval"`
-	ExcludeLabels       []string `mapstructure:"exclude_labels"` // Labels to exclude from caching
-	PageSize            int      `mapstructure:"page_size"`      // Pagination size for API calls
+	ExcludeLabels       []string `mapstructure:"exclude_labels"`    // Labels to exclude from caching
+	PageSize            int      `mapstructure:"page_size"`         // Pagination size for API calls
+	FetchConcurrency    int      `mapstructure:"fetch_concurrency"` // Listing pages fetched in parallel
+
+	// Limits for recursive scans of starred/shared folders (0 = unlimited)
+	ScanMaxDepth      int      `mapstructure:"scan_max_depth"`        // Folder levels to descend into
+	ScanMaxFiles      int      `mapstructure:"scan_max_files"`        // Files per folder scan
+	ScanMaxFileSizeMB int      `mapstructure:"scan_max_file_size_mb"` // Larger files are recorded but not cached
+	ScanExclude       []string `mapstructure:"scan_exclude"`          // Globs such as "**/*.iso" or "node_modules/"
+
+	TeamFolders        []string `mapstructure:"team_folders"`         // Team folder names or IDs scanned on every full sync
+	TeamFolderPriority int      `mapstructure:"team_folder_priority"` // Cache priority of team folder files (1-5)
+	IncludePaths       []string `mapstructure:"include_paths"`        // Personal Drive folders, "/path" or "N:/path" with priority N
+
+	EnableFileStationShares bool `mapstructure:"enable_filestation_shares"` // Import File Station sharing links
+	PurgeRevokedShares      bool `mapstructure:"purge_revoked_shares"`      // Delete cached copies once the last share of a file is removed on the NAS
+
+	WebhookSecret           string `mapstructure:"webhook_secret"`            // Enables /webhook/drive Drive change notifications
+	WebhookFallbackInterval string `mapstructure:"webhook_fallback_interval"` // Polling interval while change notifications keep the cache current
+
+	// Widen or shrink cache.recent_modified_days and scan_max_depth after each
+	// full sync, depending on how many share requests missed the cache
+	AutoTuneEnabled             bool    `mapstructure:"auto_tune_enabled"`
+	AutoTuneMinRequests         int     `mapstructure:"auto_tune_min_requests"`          // Share requests between decisions
+	AutoTuneWidenMissRatio      float64 `mapstructure:"auto_tune_widen_miss_ratio"`      // Widen at or above this miss ratio
+	AutoTuneShrinkUnservedRatio float64 `mapstructure:"auto_tune_shrink_unserved_ratio"` // Shrink at or above this share of never served cached bytes
+	AutoTuneMinRecentDays       int     `mapstructure:"auto_tune_min_recent_days"`
+	AutoTuneMaxRecentDays       int     `mapstructure:"auto_tune_max_recent_days"`
+	AutoTuneMaxScanDepth        int     `mapstructure:"auto_tune_max_scan_depth"` // 0 = scan depth is not tuned
 }
 
 // HTTPConfig contains HTTP server configuration
 type HTTPConfig struct {
-	BindAddr           string `mapstructure:"bind_addr"`
-	EnableAdminBrowser bool   `mapstructure:"enable_admin_browser"`
-	ReadTimeout        string `mapstructure:"read_timeout"`
-	WriteTimeout       string `mapstructure:"write_timeout"`
-	IdleTimeout        string `mapstructure:"idle_timeout"`
+	BindAddrs          []string `mapstructure:"bind_addr"` // One address or a list; "unix:/path" for Unix sockets
+	EnableAdminBrowser bool     `mapstructure:"enable_admin_browser"`
+	EnableAdminAPI     bool     `mapstructure:"enable_admin_api"`
+	AdminUsername      string   `mapstructure:"admin_username"`      // Built-in admin login, required with the admin browser or API
+	AdminPassword      string   `mapstructure:"admin_password"`      // Plaintext, hashed at startup; prefer admin_password_hash
+	AdminPasswordHash  string   `mapstructure:"admin_password_hash"` // Generate with -hash-password
+	ReadTimeout        string   `mapstructure:"read_timeout"`
+	WriteTimeout       string   `mapstructure:"write_timeout"`
+	IdleTimeout        string   `mapstructure:"idle_timeout"`
+	CompressionEnabled bool     `mapstructure:"compression_enabled"` // Gzip text-like responses
+	CopyBufferKB       int      `mapstructure:"copy_buffer_kb"`      // Buffer for responses that cannot use sendfile
+
+	// Share endpoint abuse protection
+	RateLimitEnabled         bool     `mapstructure:"rate_limit_enabled"`
+	RateLimitIPRPS           float64  `mapstructure:"rate_limit_ip_rps"`
+	RateLimitIPBurst         int      `mapstructure:"rate_limit_ip_burst"`
+	RateLimitTokenRPS        float64  `mapstructure:"rate_limit_token_rps"`
+	RateLimitTokenBurst      int      `mapstructure:"rate_limit_token_burst"`
+	PasswordLockoutThreshold int      `mapstructure:"password_lockout_threshold"`
+	PasswordLockoutBase      string   `mapstructure:"password_lockout_base"`
+	PasswordLockoutMax       string   `mapstructure:"password_lockout_max"`
+	TrustProxyHeaders        bool     `mapstructure:"trust_proxy_headers"`
+	TrustedProxies           []string `mapstructure:"trusted_proxies"` // Only honour proxy headers from these networks, "unix" for socket peers (required with trust_proxy_headers)
+
+	// Client networks allowed and denied on the share endpoints (CIDRs or addresses)
+	ShareAllowedIPs []string `mapstructure:"share_allowed_ips"` // Empty = all
+	ShareDeniedIPs  []string `mapstructure:"share_denied_ips"`
+
+	// Secret for signed, time-limited share links minted by the admin API (empty = disabled)
+	URLSigningSecret string `mapstructure:"url_signing_secret"`
+
+	// Secret signing share session cookies (empty = generated and kept in the cache directory)
+	SessionSecret string `mapstructure:"session_secret"`
+
+	// Share session cookie attributes
+	SessionCookieName     string `mapstructure:"session_cookie_name"`
+	SessionCookieDomain   string `mapstructure:"session_cookie_domain"`    // "" = the requested host only
+	SessionCookieSecure   string `mapstructure:"session_cookie_secure"`    // "auto" = on HTTPS requests, "always" or "never"
+	SessionCookieSameSite string `mapstructure:"session_cookie_same_site"` // "strict", "lax" or "none"
+
+	// Expired and revoked shares
+	ExpiredShareGrace  string `mapstructure:"expired_share_grace"`  // Keep serving expired shares for this long
+	ShareErrorPage     string `mapstructure:"share_error_page"`     // "" = plain text, "default" = built-in HTML page, else path to an HTML template
+	RedirectGoneShares bool   `mapstructure:"redirect_gone_shares"` // Redirect expired/revoked shares to their Synology URL
+	ProxyUnknownShares bool   `mapstructure:"proxy_unknown_shares"` // Proxy tokens not synced yet to the NAS and sync them
+	Passthrough        bool   `mapstructure:"passthrough"`          // Forward everything not served from the cache to DSM
+
+	// Cache-Control of served files, overridable per share ("" = no header)
+	CacheControl          string `mapstructure:"cache_control"`           // e.g. "public, max-age=3600"
+	ProtectedCacheControl string `mapstructure:"protected_cache_control"` // Shares with a password or requiring signed links
+
+	// Cross-origin access to share, preview and API endpoints from browser apps
+	CORSAllowedOrigins   []string `mapstructure:"cors_allowed_origins"` // Exact origins or "*" (empty = disabled)
+	CORSAllowedMethods   []string `mapstructure:"cors_allowed_methods"`
+	CORSAllowedHeaders   []string `mapstructure:"cors_allowed_headers"`
+	CORSAllowCredentials bool     `mapstructure:"cors_allow_credentials"` // Allow cookies and HTTP auth, not with "*"
+	CORSMaxAge           string   `mapstructure:"cors_max_age"`           // How long browsers cache preflight responses
 }
 
 // LoggingConfig contains logging settings
 type LoggingConfig struct {
 	Level  string `mapstructure:"level"`
 	Format string `mapstructure:"format"`
+
+	// Application log files, written in addition to stderr
+	File       string `mapstructure:"file"`       // Empty disables file output
+	ErrorFile  string `mapstructure:"error_file"` // Error-level entries only, empty disables
+	MaxSizeMB  int    `mapstructure:"max_size_mb"`
+	MaxBackups int    `mapstructure:"max_backups"`
+	MaxAge     string `mapstructure:"max_age"` // Remove rotated files older than this (0 = keep)
+
+	// HTTP access log, separate from the application log
+	AccessLogFile       string `mapstructure:"access_log_file"`   // Empty disables the access log
+	AccessLogFormat     string `mapstructure:"access_log_format"` // common, combined or json
+	AccessLogMaxSizeMB  int    `mapstructure:"access_log_max_size_mb"`
+	AccessLogMaxBackups int    `mapstructure:"access_log_max_backups"`
+	AccessLogMaxAge     string `mapstructure:"access_log_max_age"` // Remove rotated files older than this (0 = keep)
 }
 
 // DatabaseConfig contains database settings
 type DatabaseConfig struct {
-	Path          string `mapstructure:"path"`
-	CacheSizeMB   int    `mapstructure:"cache_size_mb"`
-	BusyTimeoutMs int    `mapstructure:"busy_timeout_ms"`
+	Driver         string `mapstructure:"driver"` // sqlite or postgres
+	DSN            string `mapstructure:"dsn"`    // PostgreSQL connection string
+	Path           string `mapstructure:"path"`
+	CacheSizeMB    int    `mapstructure:"cache_size_mb"`
+	BusyTimeoutMs  int    `mapstructure:"busy_timeout_ms"`
+	MaxOpenConns   int    `mapstructure:"max_open_conns"` // SQLite read-write pool size
+	MaxIdleConns   int    `mapstructure:"max_idle_conns"`
+	ReadConns      int    `mapstructure:"read_conns"`       // SQLite query-only pool size
+	WriteBatchSize int    `mapstructure:"write_batch_size"` // SQLite writes committed per transaction
+	ShareCacheSize int    `mapstructure:"share_cache_size"`
+	ShareCacheTTL  string `mapstructure:"share_cache_ttl"`
+	AuditRetention string `mapstructure:"audit_retention"`
+}
+
+// PreviewConfig contains thumbnail generation settings
+type PreviewConfig struct {
+	Enabled     bool   `mapstructure:"enabled"`
+	Dir         string `mapstructure:"dir"`         // Defaults to cache.root_dir/.previews
+	FFmpegPath  string `mapstructure:"ffmpeg_path"` // Optional; enables video posters
+	DefaultSize int    `mapstructure:"default_size"`
+	Concurrency int    `mapstructure:"concurrency"`
+	Timeout     string `mapstructure:"timeout"`
+	MaxAge      string `mapstructure:"max_age"`
+}
+
+// StreamConfig contains HLS video streaming settings
+type StreamConfig struct {
+	Enabled         bool   `mapstructure:"enabled"`
+	Dir             string `mapstructure:"dir"`          // Defaults to cache.root_dir/.streams
+	FFmpegPath      string `mapstructure:"ffmpeg_path"`  // Defaults to ffmpeg in PATH
+	FFprobePath     string `mapstructure:"ffprobe_path"` // Defaults to ffprobe in PATH
+	Mode            string `mapstructure:"mode"`         // auto, copy or transcode
+	SegmentDuration string `mapstructure:"segment_duration"`
+	Workers         int    `mapstructure:"workers"`
+	ReadyTimeout    string `mapstructure:"ready_timeout"`
+	MaxAge          string `mapstructure:"max_age"`
+}
+
+// ChunksConfig contains settings for caching very large files in chunks on demand
+type ChunksConfig struct {
+	Enabled       bool   `mapstructure:"enabled"`
+	Dir           string `mapstructure:"dir"`              // Defaults to cache.root_dir/.chunks
+	MinFileSizeMB int    `mapstructure:"min_file_size_mb"` // Uncached files from this size are served from chunks
+	ChunkSizeMB   int    `mapstructure:"chunk_size_mb"`
+	MaxSizeGB     int    `mapstructure:"max_size_gb"` // Total size of all chunks (0 = unlimited)
+}
+
+// BackupConfig contains database backup settings
+type BackupConfig struct {
+	Enabled  bool   `mapstructure:"enabled"`
+	Dir      string `mapstructure:"dir"` // Defaults to cache.root_dir/.backups
+	Interval string `mapstructure:"interval"`
+	Keep     int    `mapstructure:"keep"`
+}
+
+// StatsConfig contains settings for the stats history behind the admin dashboard and /api/v1/stats
+type StatsConfig struct {
+	Enabled   bool   `mapstructure:"enabled"`
+	Interval  string `mapstructure:"interval"`  // How often a snapshot is taken
+	Retention string `mapstructure:"retention"` // How long snapshots are kept
+}
+
+// ClusterConfig contains settings for running several instances on one database
+type ClusterConfig struct {
+	Enabled           bool   `mapstructure:"enabled"`
+	InstanceID        string `mapstructure:"instance_id"` // Defaults to the hostname
+	LeaderLeaseTTL    string `mapstructure:"leader_lease_ttl"`
+	HeartbeatInterval string `mapstructure:"heartbeat_interval"`
+}
+
+// ScanConfig contains settings for virus scanning cached copies with ClamAV
+type ScanConfig struct {
+	Enabled       bool   `mapstructure:"enabled"`
+	ClamdAddress  string `mapstructure:"clamd_address"` // unix:///path/to/clamd.sock, tcp://host:port or host:port
+	Timeout       string `mapstructure:"timeout"`
+	MaxFileSizeMB int    `mapstructure:"max_file_size_mb"` // Larger files are not scanned (0 = all); match clamd's StreamMaxLength
+	OnServe       bool   `mapstructure:"on_serve"`         // Also scan cached copies before share downloads
+}
+
+// ReplicationConfig contains settings for mirroring the cache to a secondary
+// site, and for receiving such a mirror as a standby
+type ReplicationConfig struct {
+	Enabled  bool   `mapstructure:"enabled"`
+	Target   string `mapstructure:"target"` // s3 or http
+	Interval string `mapstructure:"interval"`
+
+	// S3-compatible bucket (target s3)
+	S3Endpoint  string `mapstructure:"s3_endpoint"`
+	S3Region    string `mapstructure:"s3_region"`
+	S3Bucket    string `mapstructure:"s3_bucket"`
+	S3Prefix    string `mapstructure:"s3_prefix"`
+	S3AccessKey string `mapstructure:"s3_access_key"`
+	S3SecretKey string `mapstructure:"s3_secret_key"`
+	S3PathStyle bool   `mapstructure:"s3_path_style"` // Bucket in the path; needed by MinIO and most S3-compatible stores
+
+	// Standby instance (target http)
+	HTTPURL   string `mapstructure:"http_url"`
+	HTTPToken string `mapstructure:"http_token"` // API token of an admin user on the standby
+
+	// Standby side: store replicas received on /api/v1/replica/objects
+	ReceiveEnabled bool   `mapstructure:"receive_enabled"`
+	ReceiveDir     string `mapstructure:"receive_dir"` // Defaults to cache.root_dir/.replica
+}
+
+// WorkerReservation keeps download workers for tasks at MaxPriority or more
+// urgent, e.g. one worker that always picks up newly shared files (priority 1)
+type WorkerReservation struct {
+	MaxPriority int `mapstructure:"max_priority"` // 0 (pinned) to 5
+	Workers     int `mapstructure:"workers"`
+}
+
+// NamespaceConfig describes a tenant served under /t/{name}/ with its own
+// Synology account, database, cache directory, size limit and admins. The
+// other cache and sync settings are shared with the main instance.
+type NamespaceConfig struct {
+	Name string `mapstructure:"name"` // Lowercase letters, digits, '-' and '_'
+
+	// Synology account; retries and the circuit breaker follow synology.*
+	SynologyURL      string `mapstructure:"synology_url"`
+	SynologyUsername string `mapstructure:"synology_username"`
+	SynologyPassword string `mapstructure:"synology_password"`
+	SkipTLSVerify    bool   `mapstructure:"skip_tls_verify"`
+
+	RootDir      string `mapstructure:"root_dir"`      // Cache directory, outside cache.root_dir
+	DatabasePath string `mapstructure:"database_path"` // Defaults to root_dir/cache.db
+	MaxSizeGB    int    `mapstructure:"max_size_gb"`
+
+	// Admin of this namespace only; the namespace admin API is off when unset
+	AdminUsername     string `mapstructure:"admin_username"`
+	AdminPassword     string `mapstructure:"admin_password"`
+	AdminPasswordHash string `mapstructure:"admin_password_hash"`
 }
 
 // Load loads configuration from the specified file path
@@ -122,7 +427,13 @@ func Load(configPath string) (*Config, error) {
 // setDefaults sets all default values for configuration
 func setDefaults() {
 	viper.SetDefault("synology.skip_tls_verify", false)
+	viper.SetDefault("synology.retry_attempts", 3)
+	viper.SetDefault("synology.retry_base_delay", "1s")
+	viper.SetDefault("synology.retry_max_delay", "30s")
+	viper.SetDefault("synology.circuit_failure_threshold", 5)
+	viper.SetDefault("synology.circuit_open_duration", "1m")
 	viper.SetDefault("cache.root_dir", "/data")
+	viper.SetDefault("cache.temp_dir", "")
 	viper.SetDefault("cache.max_size_gb", 50)
 	viper.SetDefault("cache.max_disk_usage_percent", 50)
 	viper.SetDefault("cache.recent_modified_days", 30)
@@ -132,24 +443,183 @@ func setDefaults() {
 	viper.SetDefault("cache.buffer_size_mb", 8)
 	viper.SetDefault("cache.stale_task_timeout", "30m")
 	viper.SetDefault("cache.progress_update_interval", "10s")
-	viper.SetDefault("cache.worker_poll_interval", "1s")
+	viper.SetDefault("cache.worker_poll_interval", "15s")
 	viper.SetDefault("cache.worker_error_backoff", "5s")
 	viper.SetDefault("cache.eviction_batch_size", 10)
+	viper.SetDefault("cache.eviction_policy", "lru")
 	viper.SetDefault("cache.max_download_retries", 3)
+	viper.SetDefault("cache.priority_aging_age", "6h")
+	viper.SetDefault("cache.failed_task_retention", "24h")
+	viper.SetDefault("cache.drain_timeout", "20s")
+	viper.SetDefault("cache.missing_upstream_ttl", "24h")
+	viper.SetDefault("cache.orphan_action", "quarantine")
+	viper.SetDefault("cache.orphan_scan_interval", "24h")
+	viper.SetDefault("cache.trash_enabled", false)
+	viper.SetDefault("cache.trash_max_size_gb", 5)
+	viper.SetDefault("cache.trash_max_age", "24h")
+	viper.SetDefault("cache.encryption_key", "")
+	viper.SetDefault("cache.encryption_key_file", "")
+	viper.SetDefault("cache.encryption_old_key_files", []string{})
+	viper.SetDefault("cache.preseed_paths", []string{})
+	viper.SetDefault("cache.compress_at_rest", false)
+	viper.SetDefault("cache.low_space_headroom_percent", 5)
+	viper.SetDefault("cache.space_check_interval", "30s")
+	viper.SetDefault("cache.download_window", []string{})
+	viper.SetDefault("cache.download_window_bypass_priority", 1) // Pinned and shared files
+	viper.SetDefault("cache.owner_quota_gb", 0)
+	viper.SetDefault("cache.label_quota_gb", 0)
+	viper.SetDefault("cache.office_export", "")
+	viper.SetDefault("cache.dedup", false)
+	viper.SetDefault("cache.stale_while_revalidate", false)
+	viper.SetDefault("cache.boost_on_access", false)
+	viper.SetDefault("cache.boost_priority", 4) // Recently accessed
+	viper.SetDefault("cache.segments_per_file", 1)
+	viper.SetDefault("cache.segment_min_size_mb", 64)
+	viper.SetDefault("cache.claim_batch_size", 16)
+	viper.SetDefault("cache.claim_batch_max_mb", 4)
+	viper.SetDefault("cache.download_idle_timeout", "2m")
+	viper.SetDefault("cache.download_min_throughput_kb", 64)
+	viper.SetDefault("cache.serve_in_progress", false)
+	viper.SetDefault("cache.serve_in_progress_wait", "10s")
 	viper.SetDefault("sync.full_scan_interval", "1h")
 	viper.SetDefault("sync.incremental_interval", "1m")
 	viper.SetDefault("sync.prefetch_interval", "30s")
 	viper.SetDefault("sync.page_size", 200)
+	viper.SetDefault("sync.fetch_concurrency", 4)
+	viper.SetDefault("sync.scan_max_depth", 0)
+	viper.SetDefault("sync.scan_max_files", 0)
+	viper.SetDefault("sync.scan_max_file_size_mb", 0)
+	viper.SetDefault("sync.scan_exclude", []string{})
+	viper.SetDefault("sync.team_folders", []string{})
+	viper.SetDefault("sync.team_folder_priority", 2)
+	viper.SetDefault("sync.include_paths", []string{})
+	viper.SetDefault("sync.enable_filestation_shares", false)
+	viper.SetDefault("sync.purge_revoked_shares", false)
+	viper.SetDefault("sync.webhook_secret", "")
+	viper.SetDefault("sync.webhook_fallback_interval", "15m")
+	viper.SetDefault("sync.auto_tune_enabled", false)
+	viper.SetDefault("sync.auto_tune_min_requests", 100)
+	viper.SetDefault("sync.auto_tune_widen_miss_ratio", 0.2)
+	viper.SetDefault("sync.auto_tune_shrink_unserved_ratio", 0.8)
+	viper.SetDefault("sync.auto_tune_min_recent_days", 7)
+	viper.SetDefault("sync.auto_tune_max_recent_days", 90)
+	viper.SetDefault("sync.auto_tune_max_scan_depth", 0)
 	viper.SetDefault("http.bind_addr", "0.0.0.0:8080")
 	viper.SetDefault("http.enable_admin_browser", false)
+	viper.SetDefault("http.enable_admin_api", false)
+	viper.SetDefault("http.admin_username", "")
+	viper.SetDefault("http.admin_password", "")
+	viper.SetDefault("http.admin_password_hash", "")
 	viper.SetDefault("http.read_timeout", "30s")
 	viper.SetDefault("http.write_timeout", "30s")
 	viper.SetDefault("http.idle_timeout", "60s")
+	viper.SetDefault("http.compression_enabled", true)
+	viper.SetDefault("http.copy_buffer_kb", 256)
+	viper.SetDefault("http.rate_limit_enabled", true)
+	viper.SetDefault("http.rate_limit_ip_rps", 50)
+	viper.SetDefault("http.rate_limit_ip_burst", 200)
+	viper.SetDefault("http.rate_limit_token_rps", 0)
+	viper.SetDefault("http.rate_limit_token_burst", 0)
+	viper.SetDefault("http.password_lockout_threshold", 5)
+	viper.SetDefault("http.password_lockout_base", "30s")
+	viper.SetDefault("http.password_lockout_max", "1h")
+	viper.SetDefault("http.trust_proxy_headers", false)
+	viper.SetDefault("http.trusted_proxies", []string{})
+	viper.SetDefault("http.share_allowed_ips", []string{})
+	viper.SetDefault("http.share_denied_ips", []string{})
+	viper.SetDefault("http.url_signing_secret", "")
+	viper.SetDefault("http.session_secret", "")
+	viper.SetDefault("http.session_cookie_name", "share_session")
+	viper.SetDefault("http.session_cookie_domain", "")
+	viper.SetDefault("http.session_cookie_secure", "auto")
+	viper.SetDefault("http.session_cookie_same_site", "strict")
+	viper.SetDefault("http.expired_share_grace", "0s")
+	viper.SetDefault("http.share_error_page", "")
+	viper.SetDefault("http.redirect_gone_shares", false)
+	viper.SetDefault("http.proxy_unknown_shares", false)
+	viper.SetDefault("http.passthrough", false)
+	viper.SetDefault("http.cache_control", "")
+	viper.SetDefault("http.protected_cache_control", "private, no-store")
+	viper.SetDefault("http.cors_allowed_origins", []string{})
+	viper.SetDefault("http.cors_allowed_methods", []string{"GET", "HEAD", "POST", "PATCH", "DELETE"})
+	viper.SetDefault("http.cors_allowed_headers", []string{"Authorization", "Content-Type", "Range"})
+	viper.SetDefault("http.cors_allow_credentials", false)
+	viper.SetDefault("http.cors_max_age", "10m")
 	viper.SetDefault("logging.level", "info")
 	viper.SetDefault("logging.format", "json")
+	viper.SetDefault("logging.file", "")
+	viper.SetDefault("logging.error_file", "")
+	viper.SetDefault("logging.max_size_mb", 100)
+	viper.SetDefault("logging.max_backups", 10)
+	viper.SetDefault("logging.max_age", "0s")
+	viper.SetDefault("logging.access_log_file", "")
+	viper.SetDefault("logging.access_log_format", "combined")
+	viper.SetDefault("logging.access_log_max_size_mb", 100)
+	viper.SetDefault("logging.access_log_max_backups", 10)
+	viper.SetDefault("logging.access_log_max_age", "0s")
+	viper.SetDefault("database.driver", "sqlite")
+	viper.SetDefault("database.dsn", "")
 	viper.SetDefault("database.path", "")
 	viper.SetDefault("database.cache_size_mb", 64)
 	viper.SetDefault("database.busy_timeout_ms", 5000)
+	viper.SetDefault("database.max_open_conns", 4)
+	viper.SetDefault("database.max_idle_conns", 4)
+	viper.SetDefault("database.read_conns", 8)
+	viper.SetDefault("database.write_batch_size", 64)
+	viper.SetDefault("database.share_cache_size", 10000)
+	viper.SetDefault("database.share_cache_ttl", "5m")
+	viper.SetDefault("database.audit_retention", "2160h")
+	viper.SetDefault("preview.enabled", true)
+	viper.SetDefault("preview.dir", "")
+	viper.SetDefault("preview.ffmpeg_path", "")
+	viper.SetDefault("preview.default_size", 256)
+	viper.SetDefault("preview.concurrency", 2)
+	viper.SetDefault("preview.timeout", "30s")
+	viper.SetDefault("preview.max_age", "720h")
+	viper.SetDefault("stream.enabled", false)
+	viper.SetDefault("stream.dir", "")
+	viper.SetDefault("stream.ffmpeg_path", "")
+	viper.SetDefault("stream.ffprobe_path", "")
+	viper.SetDefault("stream.mode", "auto")
+	viper.SetDefault("stream.segment_duration", "6s")
+	viper.SetDefault("stream.workers", 2)
+	viper.SetDefault("stream.ready_timeout", "15s")
+	viper.SetDefault("stream.max_age", "168h")
+	viper.SetDefault("chunks.enabled", false)
+	viper.SetDefault("chunks.dir", "")
+	viper.SetDefault("chunks.min_file_size_mb", 1024)
+	viper.SetDefault("chunks.chunk_size_mb", 8)
+	viper.SetDefault("chunks.max_size_gb", 20)
+	viper.SetDefault("backup.enabled", true)
+	viper.SetDefault("backup.dir", "")
+	viper.SetDefault("backup.interval", "24h")
+	viper.SetDefault("backup.keep", 7)
+	viper.SetDefault("stats.enabled", true)
+	viper.SetDefault("stats.interval", "5m")
+	viper.SetDefault("stats.retention", "720h")
+	viper.SetDefault("cluster.enabled", false)
+	viper.SetDefault("cluster.instance_id", "")
+	viper.SetDefault("cluster.leader_lease_ttl", "30s")
+	viper.SetDefault("cluster.heartbeat_interval", "1m")
+	viper.SetDefault("scan.enabled", false)
+	viper.SetDefault("scan.clamd_address", "tcp://localhost:3310")
+	viper.SetDefault("scan.timeout", "5m")
+	viper.SetDefault("scan.max_file_size_mb", 25)
+	viper.SetDefault("scan.on_serve", false)
+	viper.SetDefault("replication.enabled", false)
+	viper.SetDefault("replication.target", "s3")
+	viper.SetDefault("replication.interval", "1m")
+	viper.SetDefault("replication.s3_endpoint", "")
+	viper.SetDefault("replication.s3_region", "us-east-1")
+	viper.SetDefault("replication.s3_bucket", "")
+	viper.SetDefault("replication.s3_prefix", "")
+	viper.SetDefault("replication.s3_access_key", "")
+	viper.SetDefault("replication.s3_secret_key", "")
+	viper.SetDefault("replication.s3_path_style", false)
+	viper.SetDefault("replication.http_url", "")
+	viper.SetDefault("replication.http_token", "")
+	viper.SetDefault("replication.receive_enabled", false)
+	viper.SetDefault("replication.receive_dir", "")
 }
 
 // Validate validates the configuration
@@ -164,6 +634,21 @@ func (c *Config) Validate() error {
 	if c.Synology.Password == "" {
 		return fmt.Errorf("synology.password is required")
 	}
+	if c.Synology.RetryAttempts < 1 || c.Synology.RetryAttempts > 10 {
+		return fmt.Errorf("synology.retry_attempts must be between 1 and 10")
+	}
+	if c.Synology.CircuitFailureThreshold < 0 {
+		return fmt.Errorf("synology.circuit_failure_threshold must not be negative")
+	}
+	if strings.ContainsFunc(c.Synology.UserAgent, unicode.IsControl) {
+		return fmt.Errorf("synology.user_agent must not contain control characters")
+	}
+	for key := range c.Synology.RequestParams {
+		switch key {
+		case "", "api", "method", "version", "_sid":
+			return fmt.Errorf("synology.request_params must not set %q", key)
+		}
+	}
 
 	// Validate cache config
 	if c.Cache.MaxSizeGB <= 0 {
@@ -175,6 +660,90 @@ func (c *Config) Validate() error {
 	if c.Cache.ConcurrentDownloads < 1 || c.Cache.ConcurrentDownloads > 10 {
 		return fmt.Errorf("cache.concurrent_downloads must be between 1 and 10")
 	}
+	if c.Cache.SegmentsPerFile < 1 || c.Cache.SegmentsPerFile > 16 {
+		return fmt.Errorf("cache.segments_per_file must be between 1 and 16")
+	}
+	if c.Cache.SegmentMinSizeMB < 0 {
+		return fmt.Errorf("cache.segment_min_size_mb must not be negative")
+	}
+	if c.Cache.ClaimBatchSize < 1 || c.Cache.ClaimBatchSize > 100 {
+		return fmt.Errorf("cache.claim_batch_size must be between 1 and 100")
+	}
+	if c.Cache.ClaimBatchMaxMB < 1 {
+		return fmt.Errorf("cache.claim_batch_max_mb must be at least 1")
+	}
+	if d, err := time.ParseDuration(c.Cache.DownloadIdleTimeout); c.Cache.DownloadIdleTimeout != "" && (err != nil || d < 0) {
+		return fmt.Errorf("cache.download_idle_timeout must be a non-negative duration")
+	}
+	if c.Cache.DownloadMinThroughputKB < 0 {
+		return fmt.Errorf("cache.download_min_throughput_kb must not be negative")
+	}
+	if d, err := time.ParseDuration(c.Cache.ServeInProgressWait); c.Cache.ServeInProgressWait != "" && (err != nil || d < 0) {
+		return fmt.Errorf("cache.serve_in_progress_wait must be a non-negative duration")
+	}
+	switch c.Cache.EvictionPolicy {
+	case "", "lru", "lfu":
+	default:
+		return fmt.Errorf("cache.eviction_policy must be lru or lfu")
+	}
+	switch c.Cache.OrphanAction {
+	case "", "quarantine", "delete", "off":
+	default:
+		return fmt.Errorf("cache.orphan_action must be quarantine, delete or off")
+	}
+	if c.Cache.TrashEnabled && c.Cache.TrashMaxSizeGB < 1 {
+		return fmt.Errorf("cache.trash_max_size_gb must be at least 1 when the trash is enabled")
+	}
+	for _, p := range c.Cache.PreseedPaths {
+		if !strings.HasPrefix(p, "/") {
+			return fmt.Errorf("cache.preseed_paths entry %q must be an absolute Drive path", p)
+		}
+	}
+	if c.Cache.LowSpaceHeadroomPercent < 0 || c.Cache.LowSpaceHeadroomPercent > 50 {
+		return fmt.Errorf("cache.low_space_headroom_percent must be between 0 and 50")
+	}
+
+	if c.Cache.DownloadWindowBypassPriority < 0 {
+		return fmt.Errorf("cache.download_window_bypass_priority must be >= 0")
+	}
+
+	reserved := 0
+	for _, r := range c.Cache.ReservedWorkers {
+		if r.MaxPriority < 0 || r.MaxPriority > 5 {
+			return fmt.Errorf("cache.reserved_workers: max_priority must be between 0 and 5")
+		}
+		if r.Workers < 1 {
+			return fmt.Errorf("cache.reserved_workers: workers must be at least 1")
+		}
+		reserved += r.Workers
+	}
+	if reserved > 0 && reserved >= c.Cache.ConcurrentDownloads {
+		return fmt.Errorf("cache.reserved_workers must leave at least one of the %d cache.concurrent_downloads workers unreserved", c.Cache.ConcurrentDownloads)
+	}
+
+	if c.Cache.BoostOnAccess && (c.Cache.BoostPriority < 1 || c.Cache.BoostPriority > 5) {
+		return fmt.Errorf("cache.boost_priority must be between 1 and 5")
+	}
+
+	if c.Cache.OwnerQuotaGB < 0 || c.Cache.LabelQuotaGB < 0 {
+		return fmt.Errorf("cache.owner_quota_gb and cache.label_quota_gb must be >= 0")
+	}
+
+	switch c.Cache.OfficeExport {
+	case "", "native", "pdf":
+	default:
+		return fmt.Errorf("cache.office_export must be \"native\", \"pdf\" or empty")
+	}
+
+	if c.Cache.EncryptionKey != "" && c.Cache.EncryptionKeyFile != "" {
+		return fmt.Errorf("cache.encryption_key and cache.encryption_key_file are mutually exclusive")
+	}
+	if c.Cache.EncryptionKey == "" && c.Cache.EncryptionKeyFile == "" && len(c.Cache.EncryptionOldKeyFiles) > 0 {
+		return fmt.Errorf("cache.encryption_old_key_files requires cache.encryption_key or cache.encryption_key_file")
+	}
+	if _, err := c.Cache.GetEncryptionKeys(); err != nil {
+		return fmt.Errorf("invalid cache encryption key: %w", err)
+	}
 
 	// Validate sync intervals
 	if _, err := time.ParseDuration(c.Sync.FullScanInterval); err != nil {
@@ -186,6 +755,192 @@ func (c *Config) Validate() error {
 	if _, err := time.ParseDuration(c.Sync.PrefetchInterval); err != nil {
 		return fmt.Errorf("invalid sync.prefetch_interval: %w", err)
 	}
+	if _, err := time.ParseDuration(c.Sync.WebhookFallbackInterval); c.Sync.WebhookSecret != "" && err != nil {
+		return fmt.Errorf("invalid sync.webhook_fallback_interval: %w", err)
+	}
+	if c.Sync.ScanMaxDepth < 0 || c.Sync.ScanMaxFiles < 0 || c.Sync.ScanMaxFileSizeMB < 0 {
+		return fmt.Errorf("sync.scan_max_depth, sync.scan_max_files and sync.scan_max_file_size_mb must be >= 0")
+	}
+	if c.Sync.TeamFolderPriority < 1 || c.Sync.TeamFolderPriority > 5 {
+		return fmt.Errorf("sync.team_folder_priority must be between 1 and 5")
+	}
+	if c.Sync.AutoTuneEnabled {
+		if c.Sync.AutoTuneMinRequests < 1 {
+			return fmt.Errorf("sync.auto_tune_min_requests must be at least 1")
+		}
+		if c.Sync.AutoTuneWidenMissRatio <= 0 || c.Sync.AutoTuneWidenMissRatio > 1 ||
+			c.Sync.AutoTuneShrinkUnservedRatio <= 0 || c.Sync.AutoTuneShrinkUnservedRatio > 1 {
+			return fmt.Errorf("sync.auto_tune_widen_miss_ratio and sync.auto_tune_shrink_unserved_ratio must be between 0 and 1")
+		}
+		if c.Sync.AutoTuneMinRecentDays < 1 || c.Sync.AutoTuneMaxRecentDays < c.Sync.AutoTuneMinRecentDays {
+			return fmt.Errorf("sync.auto_tune_min_recent_days must be at least 1 and not above sync.auto_tune_max_recent_days")
+		}
+		if c.Sync.AutoTuneMaxScanDepth < 0 {
+			return fmt.Errorf("sync.auto_tune_max_scan_depth must be >= 0")
+		}
+	}
+
+	// Validate database config
+	switch c.Database.Driver {
+	case "sqlite":
+	case "postgres":
+		if c.Database.DSN == "" {
+			return fmt.Errorf("database.dsn is required when database.driver is postgres")
+		}
+	default:
+		return fmt.Errorf("database.driver must be sqlite or postgres")
+	}
+	if c.Database.CacheSizeMB < 0 || c.Database.BusyTimeoutMs < 0 {
+		return fmt.Errorf("database.cache_size_mb and database.busy_timeout_ms must not be negative")
+	}
+	if c.Database.MaxOpenConns < 0 || c.Database.MaxIdleConns < 0 || c.Database.ReadConns < 0 || c.Database.WriteBatchSize < 0 {
+		return fmt.Errorf("database.max_open_conns, max_idle_conns, read_conns and write_batch_size must not be negative")
+	}
+
+	// Validate admin credentials; the Synology account is never used for admin login
+	if c.HTTP.AdminPasswordHash != "" && !passhash.IsHashed(c.HTTP.AdminPasswordHash) {
+		return fmt.Errorf("http.admin_password_hash must be a hash generated with -hash-password")
+	}
+	adminPasswordSet := c.HTTP.AdminPassword != "" || c.HTTP.AdminPasswordHash != ""
+	if c.HTTP.AdminUsername != "" && !adminPasswordSet {
+		return fmt.Errorf("http.admin_password_hash or http.admin_password is required when http.admin_username is set")
+	}
+	if (c.HTTP.EnableAdminBrowser || c.HTTP.EnableAdminAPI) && c.HTTP.AdminUsername == "" {
+		return fmt.Errorf("http.admin_username and http.admin_password_hash are required when http.enable_admin_browser or http.enable_admin_api is set")
+	}
+
+	// Validate client IP lists
+	if _, _, err := ipfilter.ParseProxies(c.HTTP.TrustedProxies); err != nil {
+		return fmt.Errorf("http.trusted_proxies: %w", err)
+	}
+	if c.HTTP.TrustProxyHeaders && len(c.HTTP.TrustedProxies) == 0 {
+		// Any client could send the headers and pick its own IP
+		return fmt.Errorf("http.trust_proxy_headers requires http.trusted_proxies")
+	}
+	if _, err := ipfilter.Parse(c.HTTP.ShareAllowedIPs); err != nil {
+		return fmt.Errorf("http.share_allowed_ips: %w", err)
+	}
+	if _, err := ipfilter.Parse(c.HTTP.ShareDeniedIPs); err != nil {
+		return fmt.Errorf("http.share_denied_ips: %w", err)
+	}
+
+	if c.HTTP.URLSigningSecret != "" && len(c.HTTP.URLSigningSecret) < 16 {
+		return fmt.Errorf("http.url_signing_secret must be at least 16 characters")
+	}
+	if c.HTTP.SessionSecret != "" && len(c.HTTP.SessionSecret) < 16 {
+		return fmt.Errorf("http.session_secret must be at least 16 characters")
+	}
+	if c.HTTP.SessionCookieName != "" && (&http.Cookie{Name: c.HTTP.SessionCookieName}).Valid() != nil {
+		return fmt.Errorf("http.session_cookie_name %q is not a valid cookie name", c.HTTP.SessionCookieName)
+	}
+	if c.HTTP.SessionCookieDomain != "" && (&http.Cookie{Name: "x", Domain: c.HTTP.SessionCookieDomain}).Valid() != nil {
+		return fmt.Errorf("http.session_cookie_domain %q is not a valid cookie domain", c.HTTP.SessionCookieDomain)
+	}
+	switch c.HTTP.SessionCookieSecure {
+	case "", "auto", "always", "never":
+	default:
+		return fmt.Errorf("http.session_cookie_secure must be auto, always or never")
+	}
+	switch c.HTTP.SessionCookieSameSite {
+	case "", "strict", "lax":
+	case "none":
+		// Browsers drop SameSite=None cookies without Secure
+		if c.HTTP.SessionCookieSecure != "always" {
+			return fmt.Errorf("http.session_cookie_same_site none requires http.session_cookie_secure always")
+		}
+	default:
+		return fmt.Errorf("http.session_cookie_same_site must be strict, lax or none")
+	}
+
+	// Validate Cache-Control policies
+	if c.HTTP.CacheControl != "" {
+		if err := cachecontrol.Validate(c.HTTP.CacheControl); err != nil {
+			return fmt.Errorf("http.cache_control: %w", err)
+		}
+	}
+	if c.HTTP.ProtectedCacheControl != "" {
+		if err := cachecontrol.Validate(c.HTTP.ProtectedCacheControl); err != nil {
+			return fmt.Errorf("http.protected_cache_control: %w", err)
+		}
+	}
+
+	// Validate CORS origins
+	for _, origin := range c.HTTP.CORSAllowedOrigins {
+		if origin == "*" {
+			if c.HTTP.CORSAllowCredentials {
+				return fmt.Errorf("http.cors_allow_credentials cannot be used with the \"*\" origin")
+			}
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || strings.Trim(u.Path, "/") != "" {
+			return fmt.Errorf("invalid http.cors_allowed_origins entry %q: must be \"*\" or scheme://host[:port]", origin)
+		}
+	}
+
+	// Validate stream config
+	if c.Stream.Enabled {
+		switch c.Stream.Mode {
+		case "auto", "copy", "transcode":
+			// Valid modes
+		default:
+			return fmt.Errorf("invalid stream.mode: %s", c.Stream.Mode)
+		}
+	}
+
+	// Validate chunks config
+	if c.Chunks.Enabled {
+		if c.Chunks.ChunkSizeMB <= 0 {
+			return fmt.Errorf("chunks.chunk_size_mb must be positive")
+		}
+		if c.Chunks.MinFileSizeMB < 0 || c.Chunks.MaxSizeGB < 0 {
+			return fmt.Errorf("chunks.min_file_size_mb and chunks.max_size_gb must be >= 0")
+		}
+	}
+
+	// Validate cluster config
+	if c.Cluster.GetHeartbeatInterval() >= c.Cache.GetStaleTaskTimeout() {
+		return fmt.Errorf("cluster.heartbeat_interval must be shorter than cache.stale_task_timeout")
+	}
+	if strings.Contains(c.Cluster.InstanceID, ":") {
+		return fmt.Errorf("cluster.instance_id must not contain ':'")
+	}
+
+	// Validate scan config
+	if c.Scan.Enabled {
+		if c.Scan.ClamdAddress == "" {
+			return fmt.Errorf("scan.clamd_address is required when scanning is enabled")
+		}
+		if c.Scan.MaxFileSizeMB < 0 {
+			return fmt.Errorf("scan.max_file_size_mb must be >= 0")
+		}
+	}
+
+	// Validate replication config
+	if c.Replication.Enabled {
+		switch c.Replication.Target {
+		case "s3":
+			if c.Replication.S3Endpoint == "" || c.Replication.S3Bucket == "" {
+				return fmt.Errorf("replication.s3_endpoint and replication.s3_bucket are required for target s3")
+			}
+			if c.Replication.S3AccessKey == "" || c.Replication.S3SecretKey == "" {
+				return fmt.Errorf("replication.s3_access_key and replication.s3_secret_key are required for target s3")
+			}
+		case "http":
+			if c.Replication.HTTPURL == "" || c.Replication.HTTPToken == "" {
+				return fmt.Errorf("replication.http_url and replication.http_token are required for target http")
+			}
+		default:
+			return fmt.Errorf("replication.target must be s3 or http")
+		}
+	}
+	if c.Replication.ReceiveEnabled && !c.HTTP.EnableAdminAPI {
+		return fmt.Errorf("replication.receive_enabled requires http.enable_admin_api")
+	}
+
+	if err := c.validateNamespaces(); err != nil {
+		return err
+	}
 
 	// Validate logging config
 	switch c.Logging.Level {
@@ -202,6 +957,13 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("invalid logging.format: %s", c.Logging.Format)
 	}
 
+	switch c.Logging.AccessLogFormat {
+	case "common", "combined", "json":
+		// Valid formats
+	default:
+		return fmt.Errorf("invalid logging.access_log_format: %s", c.Logging.AccessLogFormat)
+	}
+
 	return nil
 }
 
@@ -217,6 +979,16 @@ func (c *SyncConfig) GetIncrementalInterval() time.Duration {
 	return d
 }
 
+// GetWebhookFallbackInterval returns the polling interval used while Drive
+// change notifications are enabled
+func (c *SyncConfig) GetWebhookFallbackInterval() time.Duration {
+	d, _ := time.ParseDuration(c.WebhookFallbackInterval)
+	if d <= 0 {
+		return 15 * time.Minute
+	}
+	return d
+}
+
 // GetPrefetchInterval returns the prefetch interval as time.Duration
 func (c *SyncConfig) GetPrefetchInterval() time.Duration {
 	d, _ := time.ParseDuration(c.PrefetchInterval)
@@ -285,6 +1057,60 @@ func (c *HTTPConfig) GetIdleTimeout() time.Duration {
 	return d
 }
 
+// GetPasswordLockoutBase returns the first lockout duration after repeated wrong share passwords
+func (c *HTTPConfig) GetPasswordLockoutBase() time.Duration {
+	d, _ := time.ParseDuration(c.PasswordLockoutBase)
+	if d == 0 {
+		return 30 * time.Second
+	}
+	return d
+}
+
+// GetPasswordLockoutMax returns the maximum share password lockout duration
+func (c *HTTPConfig) GetPasswordLockoutMax() time.Duration {
+	d, _ := time.ParseDuration(c.PasswordLockoutMax)
+	if d == 0 {
+		return time.Hour
+	}
+	return d
+}
+
+// GetExpiredShareGrace returns how long expired shares are still served (0 = not at all)
+func (c *HTTPConfig) GetExpiredShareGrace() time.Duration {
+	d, _ := time.ParseDuration(c.ExpiredShareGrace)
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// GetCORSMaxAge returns how long browsers may cache preflight responses (0 = browser default)
+func (c *HTTPConfig) GetCORSMaxAge() time.Duration {
+	d, _ := time.ParseDuration(c.CORSMaxAge)
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// GetMaxAge returns how long rotated log files are kept (0 = no age limit)
+func (c *LoggingConfig) GetMaxAge() time.Duration {
+	d, _ := time.ParseDuration(c.MaxAge)
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// GetAccessLogMaxAge returns how long rotated access logs are kept (0 = no age limit)
+func (c *LoggingConfig) GetAccessLogMaxAge() time.Duration {
+	d, _ := time.ParseDuration(c.AccessLogMaxAge)
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
 // GetWorkerPollInterval returns the worker poll interval as time.Duration
 func (c *CacheConfig) GetWorkerPollInterval() time.Duration {
 	d, _ := time.ParseDuration(c.WorkerPollInterval)
@@ -319,10 +1145,362 @@ func (c *CacheConfig) GetMaxDownloadRetries() int {
 	return c.MaxDownloadRetries
 }
 
+// GetPriorityAgingAge returns how long a pending task waits before its priority is boosted
+func (c *CacheConfig) GetPriorityAgingAge() time.Duration {
+	d, _ := time.ParseDuration(c.PriorityAgingAge)
+	if d == 0 {
+		return 6 * time.Hour
+	}
+	return d
+}
+
+// GetDrainTimeout returns how long shutdown waits for in-flight downloads
+func (c *CacheConfig) GetDrainTimeout() time.Duration {
+	d, _ := time.ParseDuration(c.DrainTimeout)
+	if d == 0 {
+		return 20 * time.Second
+	}
+	return d
+}
+
+// GetDownloadIdleTimeout returns how long a download may receive no data (0 = no limit)
+func (c *CacheConfig) GetDownloadIdleTimeout() time.Duration {
+	if c.DownloadIdleTimeout == "" {
+		return 2 * time.Minute
+	}
+	d, _ := time.ParseDuration(c.DownloadIdleTimeout)
+	return d
+}
+
+// GetServeInProgressWait returns how long a response of a file being
+// downloaded waits for the download before proxying from the NAS
+func (c *CacheConfig) GetServeInProgressWait() time.Duration {
+	if c.ServeInProgressWait == "" {
+		return 10 * time.Second
+	}
+	d, _ := time.ParseDuration(c.ServeInProgressWait)
+	return d
+}
+
+// GetSpaceCheckInterval returns how often free space headroom is checked to adjust concurrency
+func (c *CacheConfig) GetSpaceCheckInterval() time.Duration {
+	d, _ := time.ParseDuration(c.SpaceCheckInterval)
+	if d == 0 {
+		return 30 * time.Second
+	}
+	return d
+}
+
+// GetFailedTaskRetention returns how long failed tasks are kept for manual retry before cleanup
+func (c *CacheConfig) GetFailedTaskRetention() time.Duration {
+	d, _ := time.ParseDuration(c.FailedTaskRetention)
+	if d == 0 {
+		return 24 * time.Hour
+	}
+	return d
+}
+
+// GetMissingUpstreamTTL returns how long a file found deleted on the NAS is not enqueued again
+func (c *CacheConfig) GetMissingUpstreamTTL() time.Duration {
+	d, _ := time.ParseDuration(c.MissingUpstreamTTL)
+	if d == 0 {
+		return 24 * time.Hour
+	}
+	return d
+}
+
+// GetOrphanScanInterval returns how often the cache is scanned for files no DB row references
+func (c *CacheConfig) GetOrphanScanInterval() time.Duration {
+	d, _ := time.ParseDuration(c.OrphanScanInterval)
+	if d == 0 {
+		return 24 * time.Hour
+	}
+	return d
+}
+
+// GetTrashMaxAge returns how long evicted and purged copies are kept in the trash
+func (c *CacheConfig) GetTrashMaxAge() time.Duration {
+	d, _ := time.ParseDuration(c.TrashMaxAge)
+	if d == 0 {
+		return 24 * time.Hour
+	}
+	return d
+}
+
+// GetEncryptionKeys loads the keys cached copies are encrypted with; nil
+// when encryption is disabled
+func (c *CacheConfig) GetEncryptionKeys() (*cryptfile.Keyring, error) {
+	var current *cryptfile.Key
+	var err error
+	switch {
+	case c.EncryptionKey != "":
+		current, err = cryptfile.ParseKey(c.EncryptionKey)
+	case c.EncryptionKeyFile != "":
+		current, err = cryptfile.LoadKeyFile(c.EncryptionKeyFile)
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	old := make([]*cryptfile.Key, 0, len(c.EncryptionOldKeyFiles))
+	for _, path := range c.EncryptionOldKeyFiles {
+		k, err := cryptfile.LoadKeyFile(path)
+		if err != nil {
+			return nil, err
+		}
+		old = append(old, k)
+	}
+	return cryptfile.NewKeyring(current, old...), nil
+}
+
+// GetRetryBaseDelay returns the backoff before the first retry of a transient NAS error
+func (c *SynologyConfig) GetRetryBaseDelay() time.Duration {
+	d, _ := time.ParseDuration(c.RetryBaseDelay)
+	if d == 0 {
+		return time.Second
+	}
+	return d
+}
+
+// GetRetryMaxDelay returns the upper bound of the retry backoff
+func (c *SynologyConfig) GetRetryMaxDelay() time.Duration {
+	d, _ := time.ParseDuration(c.RetryMaxDelay)
+	if d == 0 {
+		return 30 * time.Second
+	}
+	return d
+}
+
+// GetCircuitOpenDuration returns how long NAS calls are paused once the circuit opens
+func (c *SynologyConfig) GetCircuitOpenDuration() time.Duration {
+	d, _ := time.ParseDuration(c.CircuitOpenDuration)
+	if d == 0 {
+		return time.Minute
+	}
+	return d
+}
+
 // GetPageSize returns the pagination size for API calls
 func (c *SyncConfig) GetPageSize() int {
 	if c.PageSize <= 0 {
 		return 200
 	}
 	return c.PageSize
-}
\ No newline at end of file
+}
+
+// GetFetchConcurrency returns how many listing pages are fetched in parallel
+func (c *SyncConfig) GetFetchConcurrency() int {
+	if c.FetchConcurrency <= 0 {
+		return 4
+	}
+	return c.FetchConcurrency
+}
+
+// GetShareCacheSize returns the max number of cached share token lookups
+func (c *DatabaseConfig) GetShareCacheSize() int {
+	if c.ShareCacheSize <= 0 {
+		return 10000
+	}
+	return c.ShareCacheSize
+}
+
+// GetShareCacheTTL returns how long a share token lookup stays cached
+func (c *DatabaseConfig) GetShareCacheTTL() time.Duration {
+	d, _ := time.ParseDuration(c.ShareCacheTTL)
+	if d == 0 {
+		return 5 * time.Minute
+	}
+	return d
+}
+
+// GetAuditRetention returns how long audit events are kept
+func (c *DatabaseConfig) GetAuditRetention() time.Duration {
+	d, _ := time.ParseDuration(c.AuditRetention)
+	if d == 0 {
+		return 90 * 24 * time.Hour
+	}
+	return d
+}
+
+// GetTimeout returns the limit for generating a single thumbnail
+func (c *PreviewConfig) GetTimeout() time.Duration {
+	d, _ := time.ParseDuration(c.Timeout)
+	if d == 0 {
+		return 30 * time.Second
+	}
+	return d
+}
+
+// GetMaxAge returns how long generated thumbnails are kept
+func (c *PreviewConfig) GetMaxAge() time.Duration {
+	d, _ := time.ParseDuration(c.MaxAge)
+	if d == 0 {
+		return 30 * 24 * time.Hour
+	}
+	return d
+}
+
+// GetTimeout returns the limit for scanning a single file
+func (c *ScanConfig) GetTimeout() time.Duration {
+	d, _ := time.ParseDuration(c.Timeout)
+	if d == 0 {
+		return 5 * time.Minute
+	}
+	return d
+}
+
+// GetSegmentDuration returns the target HLS segment length
+func (c *StreamConfig) GetSegmentDuration() time.Duration {
+	d, _ := time.ParseDuration(c.SegmentDuration)
+	if d == 0 {
+		return 6 * time.Second
+	}
+	return d
+}
+
+// GetReadyTimeout returns how long a playlist request waits for the first segment
+func (c *StreamConfig) GetReadyTimeout() time.Duration {
+	d, _ := time.ParseDuration(c.ReadyTimeout)
+	if d == 0 {
+		return 15 * time.Second
+	}
+	return d
+}
+
+// GetMaxAge returns how long streams are kept after last playback
+func (c *StreamConfig) GetMaxAge() time.Duration {
+	d, _ := time.ParseDuration(c.MaxAge)
+	if d == 0 {
+		return 7 * 24 * time.Hour
+	}
+	return d
+}
+
+// GetInterval returns the time between scheduled backups
+func (c *BackupConfig) GetInterval() time.Duration {
+	d, _ := time.ParseDuration(c.Interval)
+	if d == 0 {
+		return 24 * time.Hour
+	}
+	return d
+}
+
+// GetInterval returns the time between statistics snapshots
+func (c *StatsConfig) GetInterval() time.Duration {
+	d, _ := time.ParseDuration(c.Interval)
+	if d <= 0 {
+		return 5 * time.Minute
+	}
+	return d
+}
+
+// GetRetention returns how long statistics snapshots are kept
+func (c *StatsConfig) GetRetention() time.Duration {
+	d, _ := time.ParseDuration(c.Retention)
+	if d <= 0 {
+		return 30 * 24 * time.Hour
+	}
+	return d
+}
+
+// GetLeaderLeaseTTL returns how long the sync leader lease is valid without renewal
+func (c *ClusterConfig) GetLeaderLeaseTTL() time.Duration {
+	d, _ := time.ParseDuration(c.LeaderLeaseTTL)
+	if d == 0 {
+		return 30 * time.Second
+	}
+	return d
+}
+
+// GetHeartbeatInterval returns how often workers renew the lease on their task
+func (c *ClusterConfig) GetHeartbeatInterval() time.Duration {
+	d, _ := time.ParseDuration(c.HeartbeatInterval)
+	if d == 0 {
+		return time.Minute
+	}
+	return d
+}
+
+// GetInterval returns the time between replication runs
+func (c *ReplicationConfig) GetInterval() time.Duration {
+	d, _ := time.ParseDuration(c.Interval)
+	if d <= 0 {
+		return time.Minute
+	}
+	return d
+}
+
+// validateNamespaces checks the namespaces; each needs a distinct name,
+// cache directory and database of its own
+func (c *Config) validateNamespaces() error {
+	if len(c.Namespaces) > 0 && c.Database.Driver == "postgres" {
+		return fmt.Errorf("namespaces are only supported with the sqlite driver")
+	}
+
+	names := make(map[string]bool)
+	dirs := map[string]bool{filepath.Clean(c.Cache.RootDir): true}
+	for i := range c.Namespaces {
+		ns := &c.Namespaces[i]
+		if !validNamespaceName(ns.Name) {
+			return fmt.Errorf("namespaces[%d].name must be lowercase letters, digits, '-' or '_'", i)
+		}
+		if names[ns.Name] {
+			return fmt.Errorf("namespace %q is defined twice", ns.Name)
+		}
+		names[ns.Name] = true
+
+		if ns.SynologyURL == "" || ns.SynologyUsername == "" || ns.SynologyPassword == "" {
+			return fmt.Errorf("namespace %q: synology_url, synology_username and synology_password are required", ns.Name)
+		}
+		if ns.RootDir == "" {
+			return fmt.Errorf("namespace %q: root_dir is required", ns.Name)
+		}
+		dir := filepath.Clean(ns.RootDir)
+		for other := range dirs {
+			if isSubdir(dir, other) || isSubdir(other, dir) {
+				return fmt.Errorf("namespace %q: root_dir must not overlap cache.root_dir or another namespace", ns.Name)
+			}
+		}
+		dirs[dir] = true
+		if ns.MaxSizeGB <= 0 {
+			return fmt.Errorf("namespace %q: max_size_gb must be positive", ns.Name)
+		}
+
+		if ns.AdminPasswordHash != "" && !passhash.IsHashed(ns.AdminPasswordHash) {
+			return fmt.Errorf("namespace %q: admin_password_hash must be a hash generated with -hash-password", ns.Name)
+		}
+		if ns.AdminUsername != "" && ns.AdminPassword == "" && ns.AdminPasswordHash == "" {
+			return fmt.Errorf("namespace %q: admin_password_hash or admin_password is required when admin_username is set", ns.Name)
+		}
+	}
+	return nil
+}
+
+// validNamespaceName reports whether name can be used in /t/{name}/ URLs
+func validNamespaceName(name string) bool {
+	if name == "" || len(name) > 64 {
+		return false
+	}
+	for _, r := range name {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' && r != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// isSubdir reports whether dir is parent or below it
+func isSubdir(dir, parent string) bool {
+	rel, err := filepath.Rel(parent, dir)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// GetDatabasePath returns the database file of the namespace
+func (n *NamespaceConfig) GetDatabasePath() string {
+	if n.DatabasePath != "" {
+		return n.DatabasePath
+	}
+	return filepath.Join(n.RootDir, "cache.db")
+}
@@ -0,0 +1,64 @@
+package domain
+
+import "time"
+
+// Admin role constants, from least to most privileged
+const (
+	RoleViewer   = "viewer"   // Read-only access to admin pages and APIs
+	RoleOperator = "operator" // Can act on the cache (retry tasks, evict, ...)
+	RoleAdmin    = "admin"    // Can manage users and API tokens
+)
+
+// roleLevels orders roles by privilege
+var roleLevels = map[string]int{
+	RoleViewer:   1,
+	RoleOperator: 2,
+	RoleAdmin:    3,
+}
+
+// IsValidRole returns true if role is a known admin role
+func IsValidRole(role string) bool {
+	_, ok := roleLevels[role]
+	return ok
+}
+
+// AdminUser represents an account allowed to use admin endpoints
+type AdminUser struct {
+	ID           int64
+	Username     string
+	PasswordHash string // passhash encoded
+	Role         string
+	Disabled     bool
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// HasRole returns true if the user is enabled and has at least the required role
+func (u *AdminUser) HasRole(required string) bool {
+	if u.Disabled {
+		return false
+	}
+	return roleLevels[u.Role] >= roleLevels[required] && roleLevels[required] > 0
+}
+
+// APIToken is a long-lived bearer token for automation, owned by an admin user.
+// Only a hash of the token is stored.
+type APIToken struct {
+	ID         int64
+	UserID     int64
+	Name       string
+	TokenHash  string // hex SHA-256 of the token
+	Prefix     string // first characters of the token, for identification
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+	ExpiresAt  *time.Time
+	Revoked    bool
+}
+
+// IsActive returns true if the token is neither revoked nor expired
+func (t *APIToken) IsActive() bool {
+	if t.Revoked {
+		return false
+	}
+	return t.ExpiresAt == nil || t.ExpiresAt.After(time.Now())
+}
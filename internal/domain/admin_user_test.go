@@ -0,0 +1,50 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAdminUser_HasRole(t *testing.T) {
+	tests := []struct {
+		name     string
+		user     AdminUser
+		required string
+		want     bool
+	}{
+		{"viewer reads", AdminUser{Role: RoleViewer}, RoleViewer, true},
+		{"viewer cannot operate", AdminUser{Role: RoleViewer}, RoleOperator, false},
+		{"operator operates", AdminUser{Role: RoleOperator}, RoleOperator, true},
+		{"operator cannot admin", AdminUser{Role: RoleOperator}, RoleAdmin, false},
+		{"admin has all roles", AdminUser{Role: RoleAdmin}, RoleViewer, true},
+		{"disabled user has no role", AdminUser{Role: RoleAdmin, Disabled: true}, RoleViewer, false},
+		{"unknown role", AdminUser{Role: "root"}, RoleViewer, false},
+		{"unknown required role", AdminUser{Role: RoleAdmin}, "root", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.user.HasRole(tt.required); got != tt.want {
+				t.Errorf("HasRole(%q) = %v, want %v", tt.required, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIToken_IsActive(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Minute)
+
+	if !(&APIToken{}).IsActive() {
+		t.Error("token without expiry should be active")
+	}
+	if !(&APIToken{ExpiresAt: &future}).IsActive() {
+		t.Error("unexpired token should be active")
+	}
+	if (&APIToken{ExpiresAt: &past}).IsActive() {
+		t.Error("expired token should not be active")
+	}
+	if (&APIToken{Revoked: true}).IsActive() {
+		t.Error("revoked token should not be active")
+	}
+}
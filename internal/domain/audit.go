@@ -0,0 +1,54 @@
+package domain
+
+import "time"
+
+// Audit action constants
+const (
+	AuditActionAdminBrowse    = "admin.browse"
+	AuditActionTaskRetry      = "task.retry"
+	AuditActionTaskRetryBulk  = "task.retry_bulk"
+	AuditActionUserCreate     = "user.create"
+	AuditActionUserUpdate     = "user.update"
+	AuditActionUserDelete     = "user.delete"
+	AuditActionTokenCreate    = "token.create"
+	AuditActionTokenRevoke    = "token.revoke"
+	AuditActionShareCreate    = "share.create"
+	AuditActionShareRevoke    = "share.revoke"
+	AuditActionShareRestore   = "share.restore"
+	AuditActionSharePassword  = "share.password_change"
+	AuditActionShareLimit     = "share.download_limit"
+	AuditActionShareIPRules   = "share.ip_rules"
+	AuditActionShareSignature = "share.require_signature"
+	AuditActionShareCaching   = "share.cache_control"
+	AuditActionShareSignLink  = "share.signed_link"
+	AuditActionBackupCreate   = "backup.create"
+	AuditActionBackupDownload = "backup.download"
+	AuditActionPreseedAdd     = "preseed.add"
+	AuditActionPreseedRemove  = "preseed.remove"
+	AuditActionCacheRequest   = "cache.request"
+	AuditActionMetadataExport = "metadata.export"
+	AuditActionMetadataImport = "metadata.import"
+)
+
+// AuditActorSync is the actor recorded for changes made by the sync service
+const AuditActorSync = "system:sync"
+
+// AuditEvent records an admin action or share lifecycle change
+type AuditEvent struct {
+	ID         int64
+	CreatedAt  time.Time
+	Actor      string            // Admin username or system actor
+	Action     string            // One of the AuditAction constants
+	Target     string            // Affected object, e.g. "task:12" or "share:abc"
+	RemoteAddr string            // Client address for HTTP-initiated actions
+	Details    map[string]string // Action specific details
+}
+
+// AuditFilter selects audit events. Empty fields match everything.
+type AuditFilter struct {
+	Actor  string
+	Action string // Exact action, or a prefix ending in "." (e.g. "share.")
+	Target string
+	Since  *time.Time
+	Until  *time.Time
+}
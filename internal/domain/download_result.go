@@ -13,4 +13,7 @@ type DownloadResult struct {
 
 	// ResumedFrom is the byte position from which the download was resumed
 	ResumedFrom int64
+
+	// ExportFormat is set when a Synology Office document was exported to this format
+	ExportFormat string
 }
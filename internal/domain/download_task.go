@@ -95,6 +95,13 @@ func (t *DownloadTask) ResetForRetry() {
 	t.NextRetryAt = nil
 }
 
+// FailedTaskFilter selects failed tasks for bulk operations
+// Empty fields match everything
+type FailedTaskFilter struct {
+	ErrorContains string // Substring of last_error
+	PathPrefix    string // Prefix of syno_path
+}
+
 // QueueStats represents download queue statistics
 type QueueStats struct {
 	PendingCount     int
@@ -102,3 +109,41 @@ type QueueStats struct {
 	FailedCount      int
 	TotalBytesQueued int64
 }
+
+// TaskProgress describes how far a download task has come
+type TaskProgress struct {
+	BytesDownloaded int64
+	Size            int64
+	Percent         float64       // 0-100
+	BytesPerSecond  float64       // 0 while the rate is unknown
+	ETA             time.Duration // -1 while unknown
+}
+
+// NewTaskProgress derives percent and ETA for a task downloading at bytesPerSecond
+func NewTaskProgress(t *DownloadTask, bytesPerSecond float64) TaskProgress {
+	p := TaskProgress{
+		BytesDownloaded: t.BytesDownloaded,
+		Size:            t.Size,
+		BytesPerSecond:  bytesPerSecond,
+		ETA:             -1,
+	}
+
+	if t.Size > 0 {
+		p.Percent = float64(t.BytesDownloaded) * 100 / float64(t.Size)
+		if p.Percent > 100 {
+			p.Percent = 100
+		}
+	}
+
+	remaining := t.Size - t.BytesDownloaded
+	switch {
+	case t.Size <= 0:
+		// Without a size there is nothing to estimate against
+	case remaining <= 0:
+		p.ETA = 0
+	case bytesPerSecond > 0:
+		p.ETA = time.Duration(float64(remaining) / bytesPerSecond * float64(time.Second)).Round(time.Second)
+	}
+
+	return p
+}
@@ -0,0 +1,35 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewTaskProgress(t *testing.T) {
+	tests := []struct {
+		name        string
+		downloaded  int64
+		size        int64
+		rate        float64
+		wantPercent float64
+		wantETA     time.Duration
+	}{
+		{"unknown rate", 250, 1000, 0, 25, -1},
+		{"halfway", 500, 1000, 100, 50, 5 * time.Second},
+		{"complete", 1000, 1000, 0, 100, 0},
+		{"unknown size", 500, 0, 100, 0, -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			task := &DownloadTask{BytesDownloaded: tt.downloaded, Size: tt.size}
+			p := NewTaskProgress(task, tt.rate)
+			if p.Percent != tt.wantPercent {
+				t.Errorf("Percent = %v, want %v", p.Percent, tt.wantPercent)
+			}
+			if p.ETA != tt.wantETA {
+				t.Errorf("ETA = %v, want %v", p.ETA, tt.wantETA)
+			}
+		})
+	}
+}
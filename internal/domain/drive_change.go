@@ -0,0 +1,30 @@
+package domain
+
+// Drive change type constants
+const (
+	DriveChangeCreate = "create"
+	DriveChangeUpdate = "update"
+	DriveChangeMove   = "move" // Also renames
+	DriveChangeDelete = "delete"
+)
+
+// DriveChange is a file change reported by a Synology Drive webhook notification
+type DriveChange struct {
+	// Position in the NAS's change sequence. Consecutive changes differ by
+	// one, so a jump means notifications were lost; 0 = not reported.
+	Seq     int64
+	Type    string
+	FileID  string // Drive file ID
+	Path    string // Path after the change
+	OldPath string // Path before a move
+	IsDir   bool
+}
+
+// IsDriveChangeType reports whether t is a known change type
+func IsDriveChangeType(t string) bool {
+	switch t {
+	case DriveChangeCreate, DriveChangeUpdate, DriveChangeMove, DriveChangeDelete:
+		return true
+	}
+	return false
+}
@@ -14,8 +14,38 @@ var (
 	ErrShareExpired      = errors.New("share has expired")
 	ErrFileNotCached     = errors.New("file not cached")
 	ErrInsufficientSpace = errors.New("insufficient space")
+
+	// ErrMissingUpstream means the NAS reported that the file no longer exists
+	ErrMissingUpstream = errors.New("file missing upstream")
+
+	// ErrUpstreamUnavailable means the NAS is failing repeatedly and calls
+	// are paused; it is wrapped in a RetryableError with the remaining pause
+	ErrUpstreamUnavailable = errors.New("upstream unavailable")
+
+	// ErrSchemaTooNew means the database was migrated by a newer build
+	ErrSchemaTooNew = errors.New("database schema is newer than this build")
+
+	// ErrFileRejected means a pre-serve hook refused a cached copy, e.g. a
+	// virus scanner found it infected; it is wrapped in a RejectedError
+	ErrFileRejected = errors.New("file rejected")
 )
 
+// RejectedError reports a copy refused by a pre-serve hook
+type RejectedError struct {
+	Hook   string // Name of the hook that refused the copy
+	Reason string // e.g. the name of the signature found
+}
+
+// Error returns the error message
+func (e *RejectedError) Error() string {
+	return "file rejected by " + e.Hook + ": " + e.Reason
+}
+
+// Unwrap returns ErrFileRejected
+func (e *RejectedError) Unwrap() error {
+	return ErrFileRejected
+}
+
 // SkippableError represents an error that can be logged and skipped.
 // Processing can continue with the next item when this error occurs.
 type SkippableError struct {
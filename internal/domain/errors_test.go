@@ -268,3 +268,18 @@ func TestPredefinedSkippableErrors(t *testing.T) {
 		t.Error("ErrSkipTaskExists should unwrap to ErrAlreadyExists")
 	}
 }
+
+func TestRejectedError(t *testing.T) {
+	err := fmt.Errorf("processing task: %w", &RejectedError{Hook: "clamav", Reason: "Eicar-Signature"})
+
+	if !errors.Is(err, ErrFileRejected) {
+		t.Error("errors.Is(err, ErrFileRejected) = false, want true")
+	}
+	var re *RejectedError
+	if !errors.As(err, &re) || re.Hook != "clamav" {
+		t.Fatalf("errors.As() = %v, want clamav RejectedError", re)
+	}
+	if got, want := re.Error(), "file rejected by clamav: Eicar-Signature"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
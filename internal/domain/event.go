@@ -0,0 +1,52 @@
+package domain
+
+import "time"
+
+// Event type constants
+const (
+	EventTaskStarted   = "task.started"
+	EventTaskCompleted = "task.completed"
+	EventTaskFailed    = "task.failed"
+	EventFileCached    = "file.cached"
+	EventFileEvicted   = "file.evicted"
+	EventSyncCompleted = "sync.completed"
+)
+
+// EventTypes lists every event type in a stable order
+var EventTypes = []string{
+	EventTaskStarted,
+	EventTaskCompleted,
+	EventTaskFailed,
+	EventFileCached,
+	EventFileEvicted,
+	EventSyncCompleted,
+}
+
+// Event is a change in the cache streamed live to admin clients. Events are
+// not stored; a client that connects later only sees the recent ones.
+type Event struct {
+	ID     int64 // Assigned when published, increasing
+	Type   string
+	Time   time.Time
+	TaskID int64
+	FileID int64
+	Path   string
+	Size   int64
+	Error  string // task.failed: the last error
+	Retry  bool   // task.failed: the task is retried later
+
+	// Kind and Counts describe sync.completed: "full" or "incremental" and
+	// the files seen per source (shared, starred, ...)
+	Kind   string
+	Counts map[string]int
+}
+
+// IsEventType reports whether t is a known event type
+func IsEventType(t string) bool {
+	for _, et := range EventTypes {
+		if et == t {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,10 @@
+package domain
+
+// EvictionPolicy orders cached files of the same priority for eviction
+type EvictionPolicy string
+
+// Eviction policies
+const (
+	EvictionLRU EvictionPolicy = "lru" // Least recently served first
+	EvictionLFU EvictionPolicy = "lfu" // Least often served first, then least recently
+)
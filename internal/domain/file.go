@@ -4,6 +4,17 @@ import (
 	"time"
 )
 
+// CacheEncodingGzip marks a cached copy stored gzip-compressed on disk
+const CacheEncodingGzip = "gzip"
+
+// Cache states of a file whose cached copy is being written or deleted.
+// The state is stored before the filesystem is touched, so a crash in between
+// leaves a marker that is reconciled on the next start.
+const (
+	CacheStateCaching  = "caching"  // A copy may appear at CachePath, not cached yet
+	CacheStateEvicting = "evicting" // The copy at CachePath is being deleted, no longer served
+)
+
 // File represents a file in the cache system
 type File struct {
 	ID                  int64
@@ -17,12 +28,37 @@ type File struct {
 	LastSyncAt          *time.Time
 	Cached              bool
 	CachePath           string
+	CacheEncoding       string // CacheEncodingGzip if the cached copy is compressed at rest
+	ContentType         string // MIME type from Drive metadata or detected when cached
+	ExportFormat        string // Format a Synology Office document was exported to when cached
+	CacheState          string // CacheStateCaching or CacheStateEvicting while the cached copy changes, "" otherwise
+	ContentHash         string // SHA-256 of the stored copy when it is a deduplicated blob shared by reference
 	Priority            int
+	Owner               string   // Drive owner user name, used for quotas
+	Labels              []string // Drive label names, used for quotas
 	LastAccessInCacheAt *time.Time
+	AccessCount         int64      // Share requests served from the cache
+	BytesServed         int64      // Bytes sent from the cache to share clients
+	MissCount           int64      // Share requests made while the file was not cached
+	MissingUpstreamAt   *time.Time // Set when a download found the file deleted on the NAS
+	RejectedReason      string     // Set when a pre-serve hook refused the downloaded copy
+	Stale               bool       // The cached copy is an older version, served until the new one is cached
 	CreatedAt           time.Time
 	UpdatedAt           time.Time
 }
 
+// IsMissingUpstream reports whether a download found the file deleted on the
+// NAS less than ttl ago, so it should not be enqueued again yet
+func (f *File) IsMissingUpstream(ttl time.Duration) bool {
+	return f.MissingUpstreamAt != nil && time.Since(*f.MissingUpstreamAt) < ttl
+}
+
+// IsRejected reports whether a pre-serve hook refused the last downloaded
+// copy, so the file should not be enqueued again until a newer version is synced
+func (f *File) IsRejected() bool {
+	return f.RejectedReason != ""
+}
+
 // ShouldInvalidateCache checks if the file should be invalidated based on new mtime
 func (f *File) ShouldInvalidateCache(newMTime time.Time) bool {
 	if !f.Cached {
@@ -38,12 +74,39 @@ func (f *File) ShouldInvalidateCache(newMTime time.Time) bool {
 func (f *File) InvalidateCache() {
 	f.Cached = false
 	f.CachePath = ""
+	f.CacheEncoding = ""
+	f.ExportFormat = ""
+	f.CacheState = ""
+	f.ContentHash = ""
+	f.Stale = false
+}
+
+// BeginCaching records that a copy is about to be written to cachePath
+func (f *File) BeginCaching(cachePath string) {
+	f.Cached = false
+	f.Stale = false
+	f.CachePath = cachePath
+	f.CacheState = CacheStateCaching
+}
+
+// BeginEviction records that the cached copy is about to be deleted.
+// The file stops being served but keeps its CachePath until the delete is done.
+func (f *File) BeginEviction() {
+	f.Cached = false
+	f.CacheState = CacheStateEvicting
 }
 
 // MarkCached marks the file as cached with the given path
 func (f *File) MarkCached(cachePath string) {
 	f.Cached = true
 	f.CachePath = cachePath
+	f.CacheEncoding = ""
+	f.ExportFormat = ""
+	f.CacheState = ""
+	f.ContentHash = ""
+	f.MissingUpstreamAt = nil
+	f.RejectedReason = ""
+	f.Stale = false
 	now := time.Now()
 	f.LastAccessInCacheAt = &now
 }
@@ -57,6 +120,26 @@ func (f *File) UpdatePriority(newPriority int) bool {
 	return false
 }
 
+// UpsertResult describes the outcome of an atomic file upsert
+type UpsertResult struct {
+	// File is the file record as stored after the upsert
+	File *File
+
+	// Created is true if the record did not exist before
+	Created bool
+
+	// Invalidated is true if the cached copy was invalidated because the
+	// upstream modification time moved forward
+	Invalidated bool
+
+	// Stale is true if the invalidated copy was kept, marked stale, to be
+	// served until the new version is cached (stale-while-revalidate)
+	Stale bool
+
+	// PreviousModifiedAt is the stored modification time before the upsert
+	PreviousModifiedAt *time.Time
+}
+
 // TempFile represents a temporary download file
 type TempFile struct {
 	ID             int64
@@ -73,4 +156,11 @@ type CacheStats struct {
 	CachedFiles     int64
 	CachedSizeBytes int64
 	ActiveShares    int64
+
+	// Totals of the per-file access counters
+	AccessCount int64
+	BytesServed int64
+	MissCount   int64
+
+	UnservedCachedBytes int64 // Size of the cached files never served from the cache
 }
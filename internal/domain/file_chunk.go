@@ -0,0 +1,23 @@
+package domain
+
+import "time"
+
+// FileChunk is a fixed-size piece of a file cached on demand for ranged
+// reads of files too large to cache whole
+type FileChunk struct {
+	FileID     int64
+	Index      int64 // Chunk number; the chunk starts at Index * chunk size
+	Size       int64 // Bytes stored, smaller than the chunk size for the last chunk
+	Version    int64 // File modification time (Unix seconds) the chunk was read at
+	AccessedAt time.Time
+	CreatedAt  time.Time
+}
+
+// ChunkVersion returns the version chunks of file are stored with; chunks
+// with another version were read before the file changed on the NAS
+func ChunkVersion(file *File) int64 {
+	if file.ModifiedAt == nil {
+		return 0
+	}
+	return file.ModifiedAt.Unix()
+}
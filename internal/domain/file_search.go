@@ -0,0 +1,50 @@
+package domain
+
+import "strings"
+
+// Sort keys of a file search
+const (
+	FileSortPath       = "path"
+	FileSortSize       = "size"
+	FileSortModified   = "modified"
+	FileSortPriority   = "priority"
+	FileSortLastAccess = "last_access" // Last read from the cache
+	FileSortAccesses   = "accesses"    // Share requests served from the cache
+	FileSortServed     = "served"      // Bytes served from the cache
+	FileSortMisses     = "misses"      // Share requests made while not cached
+)
+
+// FileSortKeys lists the accepted FileSearch.Sort values
+var FileSortKeys = []string{
+	FileSortPath, FileSortSize, FileSortModified, FileSortPriority, FileSortLastAccess,
+	FileSortAccesses, FileSortServed, FileSortMisses,
+}
+
+// FileSearch selects tracked files. Zero fields match everything.
+type FileSearch struct {
+	Path     string // Case-insensitive substring of the path, or a case-sensitive glob when IsGlob
+	Cached   *bool
+	Priority *int
+	MinSize  int64
+	MaxSize  int64 // 0 = no upper bound
+	Owner    string
+	Label    string
+	Sort     string // One of FileSortKeys, FileSortPath when empty
+	Desc     bool
+}
+
+// IsGlob reports whether Path is a glob pattern (*, ? or [...]) matched
+// against the whole path rather than a substring
+func (s FileSearch) IsGlob() bool {
+	return strings.ContainsAny(s.Path, "*?[")
+}
+
+// IsFileSortKey reports whether key is an accepted sort key
+func IsFileSortKey(key string) bool {
+	for _, k := range FileSortKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,33 @@
+package domain
+
+import "testing"
+
+func TestFileSearch_IsGlob(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"", false},
+		{"report", false},
+		{"/team/*.mp4", true},
+		{"/team/?.txt", true},
+		{"/team/[ab].txt", true},
+	}
+
+	for _, tt := range tests {
+		if got := (FileSearch{Path: tt.path}).IsGlob(); got != tt.want {
+			t.Errorf("FileSearch{Path: %q}.IsGlob() = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestIsFileSortKey(t *testing.T) {
+	for _, key := range FileSortKeys {
+		if !IsFileSortKey(key) {
+			t.Errorf("IsFileSortKey(%q) = false, want true", key)
+		}
+	}
+	if IsFileSortKey("path; DROP TABLE files") {
+		t.Error("IsFileSortKey accepted an unknown key")
+	}
+}
@@ -0,0 +1,41 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFile_IsMissingUpstream(t *testing.T) {
+	recent := time.Now().Add(-time.Hour)
+	old := time.Now().Add(-48 * time.Hour)
+
+	tests := []struct {
+		name      string
+		missingAt *time.Time
+		want      bool
+	}{
+		{"never missing", nil, false},
+		{"within ttl", &recent, true},
+		{"ttl expired", &old, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &File{MissingUpstreamAt: tt.missingAt}
+			if got := f.IsMissingUpstream(24 * time.Hour); got != tt.want {
+				t.Errorf("IsMissingUpstream() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFile_MarkCachedClearsMissingUpstream(t *testing.T) {
+	missingAt := time.Now()
+	f := &File{MissingUpstreamAt: &missingAt}
+
+	f.MarkCached("/cache/a")
+
+	if f.MissingUpstreamAt != nil {
+		t.Error("MarkCached should clear MissingUpstreamAt")
+	}
+}
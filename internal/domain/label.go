@@ -0,0 +1,22 @@
+package domain
+
+import "time"
+
+// Label is a Drive label as of the last sync. Files are mapped to labels by
+// the label names in File.Labels.
+type Label struct {
+	ID          int64
+	SynoLabelID string
+	Name        string
+	Excluded    bool // Listed in sync.exclude_labels, its files are not synced through the label
+	LastSyncAt  time.Time
+}
+
+// LabelUsage is a label with the tracked and cached files that carry it
+type LabelUsage struct {
+	Label
+	Files       int64
+	TotalBytes  int64
+	CachedFiles int64
+	CachedBytes int64
+}
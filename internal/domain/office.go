@@ -0,0 +1,68 @@
+package domain
+
+import (
+	"path"
+	"strings"
+)
+
+// Office export modes
+const (
+	OfficeExportNative = "native" // docx/xlsx/pptx
+	OfficeExportPDF    = "pdf"
+)
+
+// officeNativeFormats maps Synology Office extensions to their Microsoft Office export format
+var officeNativeFormats = map[string]string{
+	".odoc":    "docx",
+	".osheet":  "xlsx",
+	".oslides": "pptx",
+}
+
+// exportContentTypes are the MIME types of the export formats
+var exportContentTypes = map[string]string{
+	"docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	"xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	"pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	"pdf":  "application/pdf",
+}
+
+// OfficeExportFormat returns the format a Synology Office document at p is
+// exported to in the given mode, or "" if p is no Office document or export is off
+func OfficeExportFormat(p, mode string) string {
+	native, ok := officeNativeFormats[strings.ToLower(path.Ext(p))]
+	if !ok {
+		return ""
+	}
+	switch mode {
+	case OfficeExportNative:
+		return native
+	case OfficeExportPDF:
+		return "pdf"
+	default:
+		return ""
+	}
+}
+
+// ExportContentType returns the MIME type of an export format
+func ExportContentType(format string) string {
+	return exportContentTypes[format]
+}
+
+// ServedName returns the file name to serve the cached copy under; exported
+// Office documents get the extension of their export format
+func (f *File) ServedName() string {
+	name := path.Base(f.Path)
+	if f.ExportFormat == "" {
+		return name
+	}
+	return strings.TrimSuffix(name, path.Ext(name)) + "." + f.ExportFormat
+}
+
+// ServedContentType returns the MIME type to serve the cached copy with.
+// Drive metadata describes the original document, not an exported copy.
+func (f *File) ServedContentType() string {
+	if f.ExportFormat != "" {
+		return ExportContentType(f.ExportFormat)
+	}
+	return f.ContentType
+}
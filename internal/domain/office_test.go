@@ -0,0 +1,34 @@
+package domain
+
+import "testing"
+
+func TestOfficeExportFormat(t *testing.T) {
+	tests := []struct {
+		path string
+		mode string
+		want string
+	}{
+		{"/docs/report.odoc", OfficeExportNative, "docx"},
+		{"/docs/budget.OSHEET", OfficeExportNative, "xlsx"},
+		{"/docs/deck.oslides", OfficeExportNative, "pptx"},
+		{"/docs/deck.oslides", OfficeExportPDF, "pdf"},
+		{"/docs/report.odoc", "", ""},
+		{"/docs/report.docx", OfficeExportPDF, ""},
+	}
+	for _, tt := range tests {
+		if got := OfficeExportFormat(tt.path, tt.mode); got != tt.want {
+			t.Errorf("OfficeExportFormat(%q, %q) = %q, want %q", tt.path, tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestFile_ServedName(t *testing.T) {
+	f := &File{Path: "/docs/report.odoc"}
+	if got := f.ServedName(); got != "report.odoc" {
+		t.Errorf("ServedName() = %q, want report.odoc", got)
+	}
+	f.ExportFormat = "docx"
+	if got := f.ServedName(); got != "report.docx" {
+		t.Errorf("ServedName() = %q, want report.docx", got)
+	}
+}
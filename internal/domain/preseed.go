@@ -0,0 +1,20 @@
+package domain
+
+import (
+	"strings"
+	"time"
+)
+
+// PreseedPath is a Drive folder whose files are always kept cached
+type PreseedPath struct {
+	ID        int64
+	Path      string
+	CreatedBy string // Admin username that added the path
+	CreatedAt time.Time
+}
+
+// IsUnderPath reports whether path equals dir or lies below it
+func IsUnderPath(path, dir string) bool {
+	dir = strings.TrimSuffix(dir, "/")
+	return path == dir || strings.HasPrefix(path, dir+"/")
+}
@@ -0,0 +1,23 @@
+package domain
+
+import "testing"
+
+func TestIsUnderPath(t *testing.T) {
+	tests := []struct {
+		path string
+		dir  string
+		want bool
+	}{
+		{"/team/docs", "/team/docs", true},
+		{"/team/docs/a.pdf", "/team/docs", true},
+		{"/team/docs/a.pdf", "/team/docs/", true},
+		{"/team/docs-old/a.pdf", "/team/docs", false},
+		{"/team/a.pdf", "/team/docs", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsUnderPath(tt.path, tt.dir); got != tt.want {
+			t.Errorf("IsUnderPath(%q, %q) = %v, want %v", tt.path, tt.dir, got, tt.want)
+		}
+	}
+}
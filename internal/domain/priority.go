@@ -3,6 +3,7 @@ package domain
 // Priority levels for cache
 // Lower number = higher priority
 const (
+	PriorityPinned         = 0 // Pre-seeded paths, always cached and never evicted
 	PriorityShared         = 1 // Files shared with others (most important)
 	PriorityStarred        = 2 // Starred files and labeled files
 	PriorityRecentModified = 3 // Recently modified files
@@ -13,6 +14,8 @@ const (
 // PriorityName returns a human-readable name for the priority level
 func PriorityName(priority int) string {
 	switch priority {
+	case PriorityPinned:
+		return "pinned"
 	case PriorityShared:
 		return "shared"
 	case PriorityStarred:
@@ -0,0 +1,71 @@
+package domain
+
+import "strings"
+
+// Quota limits the cached bytes of any single Drive owner and of any single
+// label, so one user's large shared folder cannot fill the cache (0 = unlimited)
+type Quota struct {
+	OwnerBytes int64
+	LabelBytes int64
+}
+
+// Enabled reports whether any limit is set
+func (q Quota) Enabled() bool {
+	return q.OwnerBytes > 0 || q.LabelBytes > 0
+}
+
+// QuotaUsage is the cached size per Drive owner and per label name
+type QuotaUsage struct {
+	ByOwner map[string]int64
+	ByLabel map[string]int64
+}
+
+// NewQuotaUsage returns empty usage
+func NewQuotaUsage() *QuotaUsage {
+	return &QuotaUsage{
+		ByOwner: make(map[string]int64),
+		ByLabel: make(map[string]int64),
+	}
+}
+
+// Add counts size bytes for an owner and its labels; a negative size removes them
+func (u *QuotaUsage) Add(owner string, labels []string, size int64) {
+	if owner != "" {
+		u.ByOwner[owner] += size
+	}
+	for _, label := range labels {
+		u.ByLabel[label] += size
+	}
+}
+
+// Allows reports whether caching f stays within the quota. Pinned files
+// are always cached and not limited.
+func (q Quota) Allows(u *QuotaUsage, f *File) bool {
+	if f.Priority == PriorityPinned {
+		return true
+	}
+	if q.OwnerBytes > 0 && f.Owner != "" && u.ByOwner[f.Owner]+f.Size > q.OwnerBytes {
+		return false
+	}
+	if q.LabelBytes > 0 {
+		for _, label := range f.Labels {
+			if u.ByLabel[label]+f.Size > q.LabelBytes {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// EncodeLabels joins label names for storage in a single column
+func EncodeLabels(labels []string) string {
+	return strings.Join(labels, ",")
+}
+
+// DecodeLabels splits a stored label column
+func DecodeLabels(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
@@ -0,0 +1,38 @@
+package domain
+
+import "testing"
+
+func TestQuota_Allows(t *testing.T) {
+	q := Quota{OwnerBytes: 100, LabelBytes: 50}
+	u := NewQuotaUsage()
+	u.Add("alice", []string{"video"}, 40)
+
+	tests := []struct {
+		name string
+		file *File
+		want bool
+	}{
+		{"owner within quota", &File{Owner: "alice", Size: 60, Priority: PriorityDefault}, true},
+		{"owner over quota", &File{Owner: "alice", Size: 61, Priority: PriorityDefault}, false},
+		{"label over quota", &File{Owner: "bob", Labels: []string{"video"}, Size: 20, Priority: PriorityShared}, false},
+		{"unknown owner", &File{Size: 90, Priority: PriorityDefault}, true},
+		{"pinned ignores quota", &File{Owner: "alice", Size: 500, Priority: PriorityPinned}, true},
+	}
+
+	for _, tt := range tests {
+		if got := q.Allows(u, tt.file); got != tt.want {
+			t.Errorf("%s: Allows() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLabelsRoundTrip(t *testing.T) {
+	labels := []string{"work", "video"}
+	got := DecodeLabels(EncodeLabels(labels))
+	if len(got) != 2 || got[0] != "work" || got[1] != "video" {
+		t.Errorf("DecodeLabels(EncodeLabels()) = %v", got)
+	}
+	if DecodeLabels("") != nil {
+		t.Error("DecodeLabels(\"\") should be nil")
+	}
+}
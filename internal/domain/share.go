@@ -16,6 +16,21 @@ type Share struct {
 	ExpiresAt   *time.Time
 	CreatedAt   time.Time
 	Revoked     bool
+
+	// Download limits; see DownloadLimit
+	MaxDownloads    int   // Local override: 0 = use the NAS limit, negative = unlimited
+	NASMaxDownloads int   // Limit set on the NAS (0 = unlimited)
+	DownloadCount   int64 // Downloads served by the cache
+
+	// Client networks (CIDRs or addresses) on top of the global lists
+	AllowedIPs []string // When set, only these clients may fetch the share
+	DeniedIPs  []string // Always refused
+
+	// Only serve through signed, time-limited links; the token alone is refused
+	RequireSignature bool
+
+	// Cache-Control of files served through the share ("" = the global policy)
+	CacheControl string
 }
 
 // HasPassword returns true if the share is password protected
@@ -31,6 +46,25 @@ func (s *Share) IsExpired() bool {
 	return s.ExpiresAt.Before(time.Now())
 }
 
+// DownloadLimit returns how many downloads the share allows (0 = unlimited).
+// A local MaxDownloads overrides the limit synced from the NAS.
+func (s *Share) DownloadLimit() int {
+	switch {
+	case s.MaxDownloads > 0:
+		return s.MaxDownloads
+	case s.MaxDownloads < 0:
+		return 0
+	default:
+		return s.NASMaxDownloads
+	}
+}
+
+// DownloadsExhausted returns true if the share has reached its download limit
+func (s *Share) DownloadsExhausted() bool {
+	limit := s.DownloadLimit()
+	return limit > 0 && s.DownloadCount >= int64(limit)
+}
+
 // IsValid returns true if the share is valid (not revoked and not expired)
 func (s *Share) IsValid() bool {
 	return !s.Revoked && !s.IsExpired()
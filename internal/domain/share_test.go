@@ -0,0 +1,33 @@
+package domain
+
+import "testing"
+
+func TestShareDownloadLimit(t *testing.T) {
+	tests := []struct {
+		name          string
+		maxDownloads  int
+		nasMax        int
+		count         int64
+		wantLimit     int
+		wantExhausted bool
+	}{
+		{"unlimited", 0, 0, 100, 0, false},
+		{"NAS limit not reached", 0, 3, 2, 3, false},
+		{"NAS limit reached", 0, 3, 3, 3, true},
+		{"local override raises NAS limit", 10, 3, 3, 10, false},
+		{"local override lowers NAS limit", 1, 3, 1, 1, true},
+		{"local override removes NAS limit", -1, 3, 50, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			share := &Share{MaxDownloads: tt.maxDownloads, NASMaxDownloads: tt.nasMax, DownloadCount: tt.count}
+			if got := share.DownloadLimit(); got != tt.wantLimit {
+				t.Errorf("DownloadLimit() = %d, want %d", got, tt.wantLimit)
+			}
+			if got := share.DownloadsExhausted(); got != tt.wantExhausted {
+				t.Errorf("DownloadsExhausted() = %v, want %v", got, tt.wantExhausted)
+			}
+		})
+	}
+}
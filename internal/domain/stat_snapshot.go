@@ -0,0 +1,39 @@
+package domain
+
+import "time"
+
+// StatSnapshot is a periodic sample of cache and queue statistics.
+// Counters cover the period since the previous snapshot of the same instance.
+type StatSnapshot struct {
+	ID       int64
+	Instance string // Instance that took the snapshot; counters are per instance
+	TakenAt  time.Time
+
+	// Cache fill level
+	TotalFiles  int64
+	CachedFiles int64
+	CachedBytes int64
+
+	// Share requests served from the cache and for files not cached
+	CacheHits   int64
+	CacheMisses int64
+
+	// Bytes downloaded from the NAS and sent to share clients
+	DownloadedBytes int64
+	ServedBytes     int64
+
+	// Download queue backlog
+	PendingTasks    int
+	InProgressTasks int
+	FailedTasks     int
+	QueuedBytes     int64
+}
+
+// HitRatio returns the share of requests served from the cache (0-1), or -1 without requests
+func (s *StatSnapshot) HitRatio() float64 {
+	total := s.CacheHits + s.CacheMisses
+	if total == 0 {
+		return -1
+	}
+	return float64(s.CacheHits) / float64(total)
+}
@@ -0,0 +1,28 @@
+package domain
+
+import "time"
+
+// SyncChange is a file a dry-run sync would change
+type SyncChange struct {
+	Path     string
+	Size     int64
+	Priority int
+	Reason   string // Why the file would not be enqueued, set for skipped files
+}
+
+// SyncReport lists what a sync would add, update, invalidate and enqueue
+// without applying any of it
+type SyncReport struct {
+	StartedAt time.Time
+	Duration  time.Duration
+
+	Added       []SyncChange // Files not tracked yet
+	Updated     []SyncChange // Tracked files whose metadata would change
+	Invalidated []SyncChange // Cached files modified on the NAS
+	Enqueued    []SyncChange // Files a download task would be created for
+	Skipped     []SyncChange // Files that need caching but would not be enqueued
+
+	Folders        []string // Folders that would be scanned recursively; their contents are not listed
+	RevokedShares  []string // Tokens of shares that would be revoked
+	ExcludedLabels []string // Labels skipped because of sync.exclude_labels
+}
@@ -0,0 +1,36 @@
+package domain
+
+import "time"
+
+// Sync scope tuning actions
+const (
+	ScopeWiden  = "widen"  // Too many share requests missed the cache
+	ScopeShrink = "shrink" // The cache is mostly files nobody asked for
+	ScopeKeep   = "keep"
+)
+
+// SyncScope is how far the sync reaches for files to cache, as adjusted by
+// the hit ratio feedback loop
+type SyncScope struct {
+	RecentModifiedDays int
+	ScanMaxDepth       int // 0 = unlimited
+
+	Decisions []ScopeDecision // Most recent last
+}
+
+// ScopeDecision is one evaluation of the hit ratio after a full sync
+type ScopeDecision struct {
+	At     time.Time
+	Action string // ScopeWiden, ScopeShrink or ScopeKeep
+	Reason string
+
+	// Share requests since the previous evaluation
+	Hits   int64
+	Misses int64
+
+	MissRatio     float64 // Misses / requests
+	UnservedRatio float64 // Share of cached bytes never served
+
+	RecentModifiedDays int // Scope after the decision
+	ScanMaxDepth       int
+}
@@ -0,0 +1,32 @@
+package domain
+
+import "time"
+
+// Download worker states
+const (
+	WorkerIdle        = "idle"        // Waiting for a task to be queued
+	WorkerDownloading = "downloading" // Running a task
+	WorkerPaused      = "paused"      // Throttled for low space or waiting out an unavailable NAS
+)
+
+// WorkerStatus describes a download worker of this process
+type WorkerStatus struct {
+	ID    string
+	State string
+
+	// Reserved workers only claim tasks at this priority or more urgent (nil = any)
+	MaxPriority *int
+
+	// Task being downloaded (nil while idle or paused)
+	Task          *DownloadTask
+	TaskStartedAt *time.Time
+
+	BytesPerSecond float64 // Received over the last sampling interval
+	BytesReceived  int64   // Received since the cacher started
+	TasksCompleted int
+	TasksFailed    int
+	LastError      string
+
+	LastHeartbeat time.Time  // Last pass through the worker loop or task lease renewal
+	LastDataAt    *time.Time // Last read that returned data from the NAS
+}
@@ -0,0 +1,368 @@
+// Package integration runs the syncer and cacher against the fake NAS of
+// internal/testutil/synomock, with the real SQLite store and filesystem.
+package integration
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/adapter/filesystem"
+	"github.com/vertextoedge/synology-file-cache/internal/adapter/sqlite"
+	"github.com/vertextoedge/synology-file-cache/internal/adapter/synology"
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/service/cacher"
+	"github.com/vertextoedge/synology-file-cache/internal/service/syncer"
+	"github.com/vertextoedge/synology-file-cache/internal/testutil/synomock"
+	"github.com/vertextoedge/synology-file-cache/pkg/synoclient"
+	"go.uber.org/zap"
+)
+
+// stack is a cache server without HTTP: NAS client, store, filesystem and syncer
+type stack struct {
+	nas    *synomock.Server
+	drive  *synology.DriveClient
+	store  *sqlite.Store
+	fs     *filesystem.Manager
+	syncer *syncer.Syncer
+}
+
+func newStack(t *testing.T, nas *synomock.Server) *stack {
+	t.Helper()
+	dir := t.TempDir()
+
+	store, err := sqlite.Open(filepath.Join(dir, "cache.db"), sqlite.Options{})
+	if err != nil {
+		t.Fatalf("sqlite.Open: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	fs, err := filesystem.NewManager(filepath.Join(dir, "cache"))
+	if err != nil {
+		t.Fatalf("filesystem.NewManager: %v", err)
+	}
+
+	client := synology.NewClientWithConfig(nas.URL, synomock.Username, synomock.Password, false, &synology.ClientConfig{
+		RetryBaseDelay: time.Millisecond,
+		RetryMaxDelay:  10 * time.Millisecond,
+	})
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	drive := synology.NewDriveClient(client)
+
+	cfg := syncer.DefaultConfig()
+	cfg.PageSize = 2 // Several pages with a handful of files
+	return &stack{
+		nas:    nas,
+		drive:  drive,
+		store:  store,
+		fs:     fs,
+		syncer: syncer.New(cfg, drive, store, store, store, zap.NewNop()),
+	}
+}
+
+// startCacher runs a cacher with cfg until the returned stop is called
+func (s *stack) startCacher(cfg *cacher.Config) (stop func()) {
+	cfg.WorkerPollInterval = 10 * time.Millisecond
+	cfg.LowSpaceHeadroomPercent = 0 // Independent of the disk the test runs on
+	cfg.MaxDiskUsagePercent = 100
+	c := cacher.New(cfg, s.drive, s.store, s.store, s.fs, zap.NewNop())
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Start(context.Background())
+	}()
+	return func() {
+		c.Stop()
+		<-done
+	}
+}
+
+// cache runs a cacher until the files at paths are cached or the test times out
+func (s *stack) cache(t *testing.T, cfg *cacher.Config, paths ...string) {
+	t.Helper()
+	defer s.startCacher(cfg)()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for _, p := range paths {
+		for {
+			file, err := s.store.GetByPath(p)
+			if err != nil {
+				t.Fatalf("GetByPath(%s): %v", p, err)
+			}
+			if file != nil && file.Cached {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("%s not cached in time: %+v", p, file)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+// assertCached checks that the cached copy of a file holds content
+func (s *stack) assertCached(t *testing.T, filePath string, content []byte) {
+	t.Helper()
+	file, err := s.store.GetByPath(filePath)
+	if err != nil || file == nil || !file.Cached {
+		t.Fatalf("GetByPath(%s) = %+v, %v; want a cached file", filePath, file, err)
+	}
+	data, err := os.ReadFile(file.CachePath)
+	if err != nil {
+		t.Fatalf("reading cached copy of %s: %v", filePath, err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Errorf("cached copy of %s = %q, want %q", filePath, data, content)
+	}
+}
+
+func TestSyncAndCache(t *testing.T) {
+	nas := synomock.New()
+	defer nas.Close()
+
+	large := bytes.Repeat([]byte("0123456789abcdef"), 4096) // 64KB
+	nas.AddLabel("1", "Important")
+	nas.AddFile(synomock.File{Path: "/mydrive/starred.txt", Content: []byte("starred"), Starred: true})
+	nas.AddFile(synomock.File{Path: "/mydrive/report.pdf", Content: []byte("%PDF-1.7"), ShareToken: "tok1"})
+	nas.AddFile(synomock.File{Path: "/mydrive/video.bin", Content: large, Labels: []string{"1"}})
+	nas.AddFile(synomock.File{Path: "/mydrive/docs/nested.txt", Content: []byte("nested"), Starred: true})
+	nas.AddFile(synomock.File{Path: "/mydrive/old.txt", Content: []byte("old"), ModTime: time.Now().AddDate(-1, 0, 0)})
+
+	s := newStack(t, nas)
+
+	// A busy NAS is retried by the client without failing the sync
+	nas.FailNext(synoclient.APIDriveFiles, "list_starred", synoclient.ErrSystemBusy)
+	if err := s.syncer.FullSync(context.Background()); err != nil {
+		t.Fatalf("FullSync: %v", err)
+	}
+	if got := nas.Requests(synoclient.APIDriveFiles, "list_starred"); got < 2 {
+		t.Errorf("list_starred requests = %d, want a retry", got)
+	}
+
+	for path, priority := range map[string]int{
+		"/mydrive/report.pdf":       domain.PriorityShared,
+		"/mydrive/starred.txt":      domain.PriorityStarred,
+		"/mydrive/video.bin":        domain.PriorityStarred,
+		"/mydrive/docs/nested.txt":  domain.PriorityStarred,
+		"/mydrive/old.txt":          0, // Not recent and in no list
+		"/mydrive/does-not-exist/x": 0,
+	} {
+		file, err := s.store.GetByPath(path)
+		if err != nil {
+			t.Fatalf("GetByPath(%s): %v", path, err)
+		}
+		if priority == 0 {
+			if file != nil {
+				t.Errorf("%s synced: %+v", path, file)
+			}
+			continue
+		}
+		if file == nil || file.Priority != priority {
+			t.Errorf("%s = %+v, want priority %d", path, file, priority)
+		}
+	}
+
+	share, err := s.store.GetShareByToken("tok1")
+	if err != nil || share == nil || share.URL != nas.URL+"/d/s/tok1" {
+		t.Fatalf("share tok1 = %+v, %v", share, err)
+	}
+
+	// Large files are downloaded over several ranges at once
+	cfg := cacher.DefaultConfig()
+	cfg.SegmentsPerFile = 4
+	cfg.SegmentMinSize = 16 * 1024
+	s.cache(t, cfg, "/mydrive/report.pdf", "/mydrive/starred.txt", "/mydrive/video.bin", "/mydrive/docs/nested.txt")
+
+	s.assertCached(t, "/mydrive/report.pdf", []byte("%PDF-1.7"))
+	s.assertCached(t, "/mydrive/starred.txt", []byte("starred"))
+	s.assertCached(t, "/mydrive/docs/nested.txt", []byte("nested"))
+	s.assertCached(t, "/mydrive/video.bin", large)
+	if ranges := nas.DownloadRanges("/mydrive/video.bin"); len(ranges) != 4 {
+		t.Errorf("video.bin download ranges = %v, want 4 segments", ranges)
+	}
+}
+
+func TestResyncReplacesModifiedFile(t *testing.T) {
+	nas := synomock.New()
+	defer nas.Close()
+	nas.AddFile(synomock.File{Path: "/mydrive/notes.txt", Content: []byte("v1"), Starred: true})
+
+	s := newStack(t, nas)
+	ctx := context.Background()
+
+	if err := s.syncer.FullSync(ctx); err != nil {
+		t.Fatalf("FullSync: %v", err)
+	}
+	s.cache(t, cacher.DefaultConfig(), "/mydrive/notes.txt")
+	s.assertCached(t, "/mydrive/notes.txt", []byte("v1"))
+
+	nas.SetContent("/mydrive/notes.txt", []byte("version 2"))
+	if err := s.syncer.IncrementalSync(ctx); err != nil {
+		t.Fatalf("IncrementalSync: %v", err)
+	}
+	if file, _ := s.store.GetByPath("/mydrive/notes.txt"); file == nil || file.Cached {
+		t.Fatalf("modified file still cached after sync: %+v", file)
+	}
+
+	s.cache(t, cacher.DefaultConfig(), "/mydrive/notes.txt")
+	s.assertCached(t, "/mydrive/notes.txt", []byte("version 2"))
+}
+
+func TestDownloadResumesAfterDroppedConnection(t *testing.T) {
+	nas := synomock.New()
+	defer nas.Close()
+	content := bytes.Repeat([]byte("x"), 32*1024)
+	nas.AddFile(synomock.File{Path: "/mydrive/big.iso", Content: content, Starred: true})
+
+	s := newStack(t, nas)
+	ctx := context.Background()
+	if err := s.syncer.FullSync(ctx); err != nil {
+		t.Fatalf("FullSync: %v", err)
+	}
+
+	// The first attempt fails halfway and keeps its partial file
+	nas.TruncateNextDownload(10 * 1024)
+	cfg := cacher.DefaultConfig()
+	cfg.ConcurrentDownloads = 1
+	stop := s.startCacher(cfg)
+
+	file, _ := s.store.GetByPath("/mydrive/big.iso")
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		task, err := s.store.GetTaskByFileID(file.ID)
+		if err != nil {
+			t.Fatalf("GetTaskByFileID: %v", err)
+		}
+		if task != nil && task.RetryCount > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("download did not fail: %+v", task)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	stop()
+
+	// The retry is due in a minute; make it due now
+	task, _ := s.store.GetTaskByFileID(file.ID)
+	task.NextRetryAt = nil
+	if err := s.store.UpdateTask(task); err != nil {
+		t.Fatalf("UpdateTask: %v", err)
+	}
+
+	s.cache(t, cacher.DefaultConfig(), "/mydrive/big.iso")
+	s.assertCached(t, "/mydrive/big.iso", content)
+	if ranges := nas.DownloadRanges("/mydrive/big.iso"); len(ranges) != 2 || ranges[1] != 10*1024 {
+		t.Errorf("download ranges = %v, want a resume from 10240", ranges)
+	}
+}
+
+func TestDownloadRestartsWhenFileChangedBeforeResume(t *testing.T) {
+	nas := synomock.New()
+	defer nas.Close()
+	nas.AddFile(synomock.File{Path: "/mydrive/big.iso", Content: bytes.Repeat([]byte("x"), 32*1024), Starred: true})
+
+	s := newStack(t, nas)
+	ctx := context.Background()
+	if err := s.syncer.FullSync(ctx); err != nil {
+		t.Fatalf("FullSync: %v", err)
+	}
+
+	nas.TruncateNextDownload(10 * 1024)
+	cfg := cacher.DefaultConfig()
+	cfg.ConcurrentDownloads = 1
+	stop := s.startCacher(cfg)
+
+	file, _ := s.store.GetByPath("/mydrive/big.iso")
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		task, err := s.store.GetTaskByFileID(file.ID)
+		if err != nil {
+			t.Fatalf("GetTaskByFileID: %v", err)
+		}
+		if task != nil && task.RetryCount > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("download did not fail: %+v", task)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	stop()
+
+	// Edited on the NAS before the next sync, so the DB still has the old version
+	content := bytes.Repeat([]byte("y"), 40*1024)
+	nas.SetContent("/mydrive/big.iso", content)
+	task, _ := s.store.GetTaskByFileID(file.ID)
+	task.NextRetryAt = nil
+	if err := s.store.UpdateTask(task); err != nil {
+		t.Fatalf("UpdateTask: %v", err)
+	}
+
+	s.cache(t, cacher.DefaultConfig(), "/mydrive/big.iso")
+	s.assertCached(t, "/mydrive/big.iso", content)
+	if ranges := nas.DownloadRanges("/mydrive/big.iso"); len(ranges) != 2 || ranges[1] != -1 {
+		t.Errorf("download ranges = %v, want a fresh download after the edit", ranges)
+	}
+
+	// The record has the version that was cached, so a sync keeps it
+	if err := s.syncer.IncrementalSync(ctx); err != nil {
+		t.Fatalf("IncrementalSync: %v", err)
+	}
+	if file, _ := s.store.GetByPath("/mydrive/big.iso"); file == nil || !file.Cached {
+		t.Errorf("cached copy invalidated by the next sync: %+v", file)
+	}
+}
+
+func TestDriveChangesWithoutListing(t *testing.T) {
+	nas := synomock.New()
+	defer nas.Close()
+	nas.AddFile(synomock.File{Path: "/mydrive/notes.txt", Content: []byte("v1"), Starred: true})
+
+	s := newStack(t, nas)
+	ctx := context.Background()
+	if err := s.syncer.FullSync(ctx); err != nil {
+		t.Fatalf("FullSync: %v", err)
+	}
+	s.cache(t, cacher.DefaultConfig(), "/mydrive/notes.txt")
+	listings := nas.Requests(synoclient.APIDriveFiles, "list_recent")
+
+	// A new file, an edit and a deletion reported by notifications
+	nas.AddFile(synomock.File{Path: "/mydrive/new.txt", Content: []byte("new")})
+	nas.SetContent("/mydrive/notes.txt", []byte("version 2"))
+	notes, _ := s.store.GetByPath("/mydrive/notes.txt")
+	nas.RemoveFile("/mydrive/notes.txt")
+	applied, err := s.syncer.ApplyChanges(ctx, []domain.DriveChange{
+		{Seq: 1, Type: domain.DriveChangeCreate, Path: "/mydrive/new.txt"},
+		{Seq: 2, Type: domain.DriveChangeDelete, FileID: notes.SynoFileID, Path: "/mydrive/notes.txt"},
+	})
+	if err != nil || applied != 2 {
+		t.Fatalf("ApplyChanges = %d, %v; want 2 changes applied", applied, err)
+	}
+	if got := nas.Requests(synoclient.APIDriveFiles, "list_recent"); got != listings {
+		t.Errorf("list_recent requests = %d, want none for notified changes", got-listings)
+	}
+
+	if file, _ := s.store.GetByPath("/mydrive/new.txt"); file == nil || file.Priority != domain.PriorityRecentModified {
+		t.Errorf("created file = %+v, want it synced as recently modified", file)
+	}
+	if file, _ := s.store.GetByPath("/mydrive/notes.txt"); file == nil || file.MissingUpstreamAt == nil || !file.Cached {
+		t.Errorf("deleted file = %+v, want the cached copy kept and marked missing upstream", file)
+	}
+	s.cache(t, cacher.DefaultConfig(), "/mydrive/new.txt")
+	s.assertCached(t, "/mydrive/new.txt", []byte("new"))
+
+	// A hole in the sequence is reported so the caller lists the NAS instead
+	if _, err := s.syncer.ApplyChanges(ctx, []domain.DriveChange{
+		{Seq: 5, Type: domain.DriveChangeUpdate, Path: "/mydrive/new.txt"},
+	}); !errors.Is(err, syncer.ErrChangeGap) {
+		t.Errorf("ApplyChanges after lost notifications = %v, want ErrChangeGap", err)
+	}
+}
@@ -2,7 +2,9 @@ package logger
 
 import (
 	"fmt"
+	"time"
 
+	"github.com/vertextoedge/synology-file-cache/internal/util/rotate"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
@@ -13,14 +15,35 @@ var (
 
 	// logger is the underlying zap logger
 	logger *zap.Logger
+
+	// files are the log files opened by Init, closed by Close
+	files []*rotate.Writer
 )
 
+// Options contains logger settings
+type Options struct {
+	Level  string
+	Format string // json or text
+
+	// File output in addition to stderr, rotated by size
+	File       string // All entries, empty disables
+	ErrorFile  string // Error level and above only, empty disables
+	MaxSizeMB  int
+	MaxBackups int
+	MaxAge     time.Duration
+}
+
 // Init initializes the logger with the given level and format
 func Init(level, format string) error {
+	return InitWithOptions(Options{Level: level, Format: format})
+}
+
+// InitWithOptions initializes the logger, optionally also writing to rotated files
+func InitWithOptions(opts Options) error {
 	var config zap.Config
 
 	// Set base config based on format
-	if format == "json" {
+	if opts.Format == "json" {
 		config = zap.NewProductionConfig()
 	} else {
 		config = zap.NewDevelopmentConfig()
@@ -28,7 +51,7 @@ func Init(level, format string) error {
 	}
 
 	// Set log level
-	zapLevel, err := parseLevel(level)
+	zapLevel, err := parseLevel(opts.Level)
 	if err != nil {
 		return err
 	}
@@ -42,9 +65,18 @@ func Init(level, format string) error {
 	config.EncoderConfig.CallerKey = "caller"
 	config.EncoderConfig.EncodeCaller = zapcore.ShortCallerEncoder
 
+	// Tee file outputs next to stderr
+	fileCores, err := openFiles(opts, config)
+	if err != nil {
+		return err
+	}
+
 	// Build logger
-	logger, err = config.Build()
+	logger, err = config.Build(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return zapcore.NewTee(append([]zapcore.Core{core}, fileCores...)...)
+	}))
 	if err != nil {
+		closeFiles()
 		return fmt.Errorf("failed to build logger: %w", err)
 	}
 
@@ -52,6 +84,52 @@ func Init(level, format string) error {
 	return nil
 }
 
+// openFiles opens the configured log files and returns a core for each
+func openFiles(opts Options, config zap.Config) ([]zapcore.Core, error) {
+	var encoder zapcore.Encoder
+	if config.Encoding == "json" {
+		encoder = zapcore.NewJSONEncoder(config.EncoderConfig)
+	} else {
+		encoder = zapcore.NewConsoleEncoder(config.EncoderConfig)
+	}
+
+	outputs := []struct {
+		path  string
+		level zapcore.LevelEnabler
+	}{
+		{opts.File, config.Level},
+		{opts.ErrorFile, zapcore.ErrorLevel},
+	}
+
+	var cores []zapcore.Core
+	for _, out := range outputs {
+		if out.path == "" {
+			continue
+		}
+		w, err := rotate.New(rotate.Config{
+			Filename:   out.path,
+			MaxSizeMB:  opts.MaxSizeMB,
+			MaxBackups: opts.MaxBackups,
+			MaxAge:     opts.MaxAge,
+		})
+		if err != nil {
+			closeFiles()
+			return nil, fmt.Errorf("failed to open log file: %w", err)
+		}
+		files = append(files, w)
+		cores = append(cores, zapcore.NewCore(encoder.Clone(), w, out.level))
+	}
+	return cores, nil
+}
+
+// closeFiles closes all log files opened by Init
+func closeFiles() {
+	for _, f := range files {
+		f.Close()
+	}
+	files = nil
+}
+
 // parseLevel converts string log level to zapcore.Level
 func parseLevel(level string) (zapcore.Level, error) {
 	switch level {
@@ -76,6 +154,13 @@ func Sync() error {
 	return nil
 }
 
+// Close flushes the logger and closes its log files
+func Close() error {
+	err := Sync()
+	closeFiles()
+	return err
+}
+
 // GetZapLogger returns the underlying zap.Logger
 func GetZapLogger() *zap.Logger {
 	return logger
@@ -0,0 +1,9 @@
+package port
+
+import "github.com/vertextoedge/synology-file-cache/internal/domain"
+
+// EventPublisher receives cache events for live subscribers. Publish must
+// not block the caller.
+type EventPublisher interface {
+	Publish(event domain.Event)
+}
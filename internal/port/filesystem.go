@@ -13,6 +13,25 @@ type DiskUsage struct {
 	UsedPct float64 // Used percentage (0-100)
 }
 
+// SegmentFile is a preallocated temp file whose segments are written concurrently
+type SegmentFile interface {
+	io.WriterAt
+	io.Closer
+}
+
+// CachedFile is an open cached copy, read as its plain content whether or
+// not it is encrypted at rest
+type CachedFile interface {
+	io.ReadSeekCloser
+	io.ReaderAt
+
+	// Size returns the plain size of the copy
+	Size() int64
+
+	// ModTime returns the modification time of the copy on disk
+	ModTime() time.Time
+}
+
 // FileSystem defines the interface for filesystem operations
 type FileSystem interface {
 	// RootDir returns the cache root directory
@@ -21,6 +40,9 @@ type FileSystem interface {
 	// CachePath returns the local cache path for a Synology file path
 	CachePath(synoPath string) string
 
+	// TempPath returns where an in-progress download of a Synology file is written
+	TempPath(synoPath string) string
+
 	// WriteFile writes content to the cache
 	// Returns: cache path, bytes written, error
 	WriteFile(synoPath string, reader io.Reader) (string, int64, error)
@@ -30,13 +52,47 @@ type FileSystem interface {
 	// Returns: cache path, total bytes written, error
 	WriteFileWithResume(synoPath string, reader io.Reader, resume bool, tempPath string) (string, int64, error)
 
+	// CreateSegmentFile creates tempPath as a sparse file of size bytes
+	CreateSegmentFile(tempPath string, size int64) (SegmentFile, error)
+
+	// CommitTempFile moves a completed temp file to the cache path of synoPath
+	// Returns: cache path, error
+	CommitTempFile(synoPath, tempPath string) (string, error)
+
+	// OpenCached opens a cached copy for reading
+	OpenCached(cachePath string) (CachedFile, error)
+
 	// DeleteFile removes a cached file
 	DeleteFile(cachePath string) error
 
+	// CompressFile gzips a cached file in place
+	// Returns false, leaving the file untouched, if compression saves too little
+	CompressFile(cachePath string) (bool, error)
+
+	// SniffContentType detects the MIME type of a cached file from its first 512 bytes
+	SniffContentType(cachePath string) (string, error)
+
+	// HashFile returns the hex SHA-256 of a cached file
+	HashFile(cachePath string) (string, error)
+
+	// BlobPath returns the path of the deduplicated copy with a content hash
+	BlobPath(hash string) string
+
+	// StoreBlob moves a cached file to the blob for hash. If that blob already
+	// exists the file is deleted instead and true is returned.
+	StoreBlob(cachePath, hash string) (bool, error)
+
+	// LinkBlob adds a cached file to the blob for hash without moving it, so
+	// it stays readable at both paths. Returns true if the blob already existed.
+	LinkBlob(cachePath, hash string) (bool, error)
+
+	// ListBlobs returns the paths of all stored blobs
+	ListBlobs() ([]string, error)
+
 	// FileExists checks if a cached file exists
 	FileExists(cachePath string) bool
 
-	// GetFileSize returns the size of a cached file
+	// GetFileSize returns the plain size of a cached file
 	GetFileSize(cachePath string) (int64, error)
 
 	// GetTempFileInfo returns size and modification time of a temp file
@@ -55,4 +111,32 @@ type FileSystem interface {
 	// CleanOldTempFiles removes temp files older than the specified duration
 	// Returns the number of files deleted
 	CleanOldTempFiles(olderThan time.Duration) (int, error)
+
+	// WalkCacheFiles calls fn for every file under the root that may be a
+	// cached copy, skipping blobs, generated files, temp files and the database
+	WalkCacheFiles(fn func(cachePath string, size int64, modTime time.Time) error) error
+
+	// QuarantineFile moves a cached copy out of the cache tree into the quarantine directory
+	QuarantineFile(cachePath string) error
+
+	// CleanOldQuarantine deletes files quarantined longer than olderThan ago
+	// Returns the number of files deleted
+	CleanOldQuarantine(olderThan time.Duration) (int, error)
+
+	// TrashFile moves a cached copy to the trash, or deletes it if the trash
+	// is disabled or the copy does not fit its size budget
+	TrashFile(cachePath string) error
+
+	// RestoreTrashed moves a trashed copy of a Synology file back to its cache
+	// path if it has the given size and was written no earlier than modifiedAt
+	// Returns: cache path, whether a copy was restored, error
+	RestoreTrashed(synoPath string, size int64, modifiedAt time.Time) (string, bool, error)
+
+	// CleanTrash deletes trashed copies beyond the age and size budget
+	// Returns the number of files deleted
+	CleanTrash() (int, error)
+
+	// EmptyTrash deletes all trashed copies
+	// Returns the number of bytes freed
+	EmptyTrash() (int64, error)
 }
@@ -0,0 +1,19 @@
+package port
+
+import (
+	"context"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+)
+
+// PreServeHook inspects a cached copy after it is downloaded and before the
+// file is marked cached, and optionally before it is served
+type PreServeHook interface {
+	// Name identifies the hook in logs and task errors
+	Name() string
+
+	// Inspect checks the copy of file read from body. A copy that must not be served
+	// is reported with a *domain.RejectedError; any other error means the
+	// copy could not be checked and the caller should try again later.
+	Inspect(ctx context.Context, file *domain.File, body CachedFile) error
+}
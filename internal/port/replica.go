@@ -0,0 +1,22 @@
+package port
+
+import (
+	"context"
+	"io"
+)
+
+// ReplicaStore is an object store holding a mirror of the cache on a
+// secondary site (an S3 bucket or a standby instance)
+type ReplicaStore interface {
+	// Put stores size bytes read from body under key, replacing an existing object
+	Put(ctx context.Context, key string, body io.Reader, size int64) error
+
+	// Get opens the object stored under key (domain.ErrNotFound if missing)
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+
+	// Delete removes the object stored under key; a missing object is not an error
+	Delete(ctx context.Context, key string) error
+
+	// List returns the keys of all objects starting with prefix
+	List(ctx context.Context, prefix string) ([]string, error)
+}
@@ -28,6 +28,13 @@ type FileRepository interface {
 	// This prevents race condition between syncer and cacher
 	UpdateMetadata(file *domain.File) error
 
+	// UpsertBySynoID atomically creates or updates a file keyed by syno_file_id.
+	// Cache status fields are preserved unless the new modification time is newer,
+	// in which case the cached copy is invalidated in the same statement.
+	// Starred/shared flags take the incoming values, so un-starring and
+	// un-sharing stick; priority only moves up (lower number).
+	UpsertBySynoID(file *domain.File) (*domain.UpsertResult, error)
+
 	// InvalidateCache sets cached=false for a file (used when source file is modified)
 	InvalidateCache(fileID int64) error
 
@@ -35,8 +42,63 @@ type FileRepository interface {
 	Delete(id int64) error
 
 	// GetEvictionCandidates returns cached files that can be evicted
-	// Files are ordered by priority (lowest first) and then by LRU
-	GetEvictionCandidates(limit int) ([]*domain.File, error)
+	// Files are ordered by priority (lowest first) and then by the policy
+	// Pinned files (domain.PriorityPinned) and files with a download in
+	// progress (a stale copy being replaced) are never returned
+	GetEvictionCandidates(policy domain.EvictionPolicy, limit int) ([]*domain.File, error)
+
+	// GetEvictionCandidatesByOwner and GetEvictionCandidatesByLabel are
+	// GetEvictionCandidates limited to one Drive owner or label (quota enforcement)
+	GetEvictionCandidatesByOwner(policy domain.EvictionPolicy, owner string, limit int) ([]*domain.File, error)
+	GetEvictionCandidatesByLabel(policy domain.EvictionPolicy, label string, limit int) ([]*domain.File, error)
+
+	// ForEachEvictionCandidate streams the files GetEvictionCandidates would
+	// return, without a limit, calling fn for each until fn returns false
+	ForEachEvictionCandidate(policy domain.EvictionPolicy, fn func(*domain.File) bool) error
+
+	// GetFilesByCacheState returns files left in a domain.CacheStateCaching or
+	// domain.CacheStateEvicting state, used to reconcile the cache on startup
+	GetFilesByCacheState(state string) ([]*domain.File, error)
+
+	// CountCacheReferences returns how many files use the copy at cachePath:
+	// cached files and files currently being cached into it. Deduplicated
+	// copies are shared, so a copy may only be deleted when this is zero.
+	CountCacheReferences(cachePath string) (int, error)
+
+	// ForEachFileToCache streams uncached files that have no download task,
+	// ordered by priority and size, calling fn for each until fn returns false
+	ForEachFileToCache(fn func(*domain.File) bool) error
+
+	// GetQuotaUsage returns the size of cached, non-pinned files per owner and label.
+	// With includeQueued files with a pending or in-progress download task count too.
+	GetQuotaUsage(includeQueued bool) (*domain.QuotaUsage, error)
+
+	// UnpinFiles resets pinned files whose path is not under one of keepPrefixes
+	// to the default priority. Returns the number of unpinned files.
+	UnpinFiles(keepPrefixes []string) (int, error)
+
+	// SearchFiles returns a page of files matching the search, ordered by
+	// search.Sort, and the total number of matches
+	SearchFiles(search domain.FileSearch, limit, offset int) ([]*domain.File, int, error)
+
+	// MarkMissingUpstream records that a download found the file deleted on
+	// the NAS. The mark is cleared when the file is cached or modified again.
+	MarkMissingUpstream(fileID int64) error
+
+	// ListMissingUpstream returns a page of files marked missing upstream,
+	// most recently marked first, and their total number
+	ListMissingUpstream(limit, offset int) ([]*domain.File, int, error)
+
+	// RecordHit counts a share request served from the cache, adds the bytes
+	// sent to the file's total and updates its last access time
+	RecordHit(fileID, bytesServed int64) error
+
+	// RecordMiss counts a share request made while the file was not cached
+	RecordMiss(fileID int64) error
+
+	// BoostFilePriority raises the priority of a file to priority if it is
+	// less urgent (a higher number). Returns false if nothing changed.
+	BoostFilePriority(fileID int64, priority int) (bool, error)
 }
 
 // ShareRepository defines the interface for share persistence operations
@@ -52,6 +114,29 @@ type ShareRepository interface {
 
 	// UpdateShare updates an existing share record
 	UpdateShare(share *domain.Share) error
+
+	// ListActiveShares returns all shares that are not revoked
+	ListActiveShares() ([]*domain.Share, error)
+
+	// ClaimShareDownload counts a download of share and updates its DownloadCount
+	// Returns false without counting if the share reached its download limit
+	ClaimShareDownload(share *domain.Share) (bool, error)
+
+	// SetShareMaxDownloads sets the local download limit override of a share
+	// Returns domain.ErrNotFound if no share has this token
+	SetShareMaxDownloads(token string, maxDownloads int) error
+
+	// SetShareIPRules sets the client networks allowed and denied for a share
+	// Returns domain.ErrNotFound if no share has this token
+	SetShareIPRules(token string, allowed, denied []string) error
+
+	// SetShareRequireSignature sets whether a share is served only through signed links
+	// Returns domain.ErrNotFound if no share has this token
+	SetShareRequireSignature(token string, required bool) error
+
+	// SetShareCacheControl sets the Cache-Control of a share ("" = the global policy)
+	// Returns domain.ErrNotFound if no share has this token
+	SetShareCacheControl(token, cacheControl string) error
 }
 
 // DownloadTaskRepository defines the interface for download task queue operations
@@ -66,6 +151,25 @@ type DownloadTaskRepository interface {
 	// Only claims tasks where next_retry_at is NULL or <= now
 	ClaimNextTask(workerID string) (*domain.DownloadTask, error)
 
+	// ClaimNextTaskUpTo is ClaimNextTask limited to tasks with priority <= maxPriority
+	// Used outside download windows, when only urgent tasks are downloaded
+	ClaimNextTaskUpTo(workerID string, maxPriority int) (*domain.DownloadTask, error)
+
+	// ClaimNextTasks claims up to n pending tasks for a worker in queue order in
+	// one transaction, stopping before the task that would bring their total size
+	// over maxTotalBytes (<= 0 = no limit). The first task is claimed whatever
+	// its size. Returns an empty slice if no tasks are available.
+	ClaimNextTasks(workerID string, n int, maxTotalBytes int64) ([]*domain.DownloadTask, error)
+
+	// ClaimNextTasksUpTo is ClaimNextTasks limited to tasks with priority <= maxPriority
+	ClaimNextTasksUpTo(workerID string, n int, maxTotalBytes int64, maxPriority int) ([]*domain.DownloadTask, error)
+
+	// TasksQueued returns a channel that is closed when tasks may have become
+	// claimable through this repository (created, retried, released or boosted).
+	// Take it before claiming so a task queued in between still wakes the worker.
+	// Tasks queued by other processes sharing the database are only seen by polling.
+	TasksQueued() <-chan struct{}
+
 	// GetTask retrieves a task by ID
 	GetTask(id int64) (*domain.DownloadTask, error)
 
@@ -87,16 +191,51 @@ type DownloadTaskRepository interface {
 	// FailTask marks a task as failed and schedules retry if possible
 	FailTask(taskID int64, errMsg string, canRetry bool) error
 
+	// ReleaseTask returns an in-progress task to pending without counting a retry
+	// Used when a download is interrupted by shutdown
+	ReleaseTask(taskID int64) error
+
 	// ReleaseStaleInProgressTasks resets tasks stuck in in_progress state
 	// Used for tasks where worker died (claimed_at older than timeout)
 	ReleaseStaleInProgressTasks(staleDuration time.Duration) (int, error)
 
+	// RenewTaskLease refreshes claimed_at of an in-progress task held by workerID
+	// Returns false if the task is no longer held by the worker
+	RenewTaskLease(taskID int64, workerID string) (bool, error)
+
+	// ReleaseWorkerTasks resets in_progress tasks whose worker_id starts with prefix
+	// Used on startup to recover tasks of a previous run of the same instance
+	ReleaseWorkerTasks(workerPrefix string) (int, error)
+
+	// BoostAgedTasks raises the priority (lowers the number) of pending tasks
+	// that have waited longer than age since creation or their last boost.
+	// Each call boosts a task by at most one level, and never above PriorityStarred.
+	// Returns the number of boosted tasks.
+	BoostAgedTasks(age time.Duration) (int, error)
+
+	// BoostTaskPriority raises the priority of the pending download task of a
+	// file to priority if it is less urgent, moving it ahead in the queue.
+	// Returns false if the file has no pending task or it was already as urgent.
+	BoostTaskPriority(fileID int64, priority int) (bool, error)
+
 	// GetQueueStats returns queue statistics
 	GetQueueStats() (*domain.QueueStats, error)
 
 	// CleanupOldFailedTasks removes failed tasks older than the specified duration
 	CleanupOldFailedTasks(olderThan time.Duration) (int, error)
 
+	// ListTasksByStatus returns tasks with the given status, most recently updated first
+	ListTasksByStatus(status string, limit, offset int) ([]*domain.DownloadTask, error)
+
+	// RetryFailedTask resets a failed task to pending with a fresh retry budget
+	// Returns domain.ErrNotFound if no failed task exists with this ID and
+	// domain.ErrAlreadyExists if the file already has an active task
+	RetryFailedTask(taskID int64) error
+
+	// RetryFailedTasks resets all failed tasks matching the filter to pending
+	// Tasks whose file already has an active task are left untouched
+	RetryFailedTasks(filter domain.FailedTaskFilter) (int, error)
+
 	// GetOversizedTasks returns tasks whose file size exceeds maxSize
 	GetOversizedTasks(maxSize int64) ([]*domain.DownloadTask, error)
 
@@ -108,6 +247,147 @@ type DownloadTaskRepository interface {
 type StatsRepository interface {
 	// GetCacheStats returns cache statistics
 	GetCacheStats() (*domain.CacheStats, error)
+
+	// AddStatSnapshot records a periodic statistics sample
+	AddStatSnapshot(snapshot *domain.StatSnapshot) error
+
+	// ListStatSnapshots returns the samples taken in [since, until), oldest first.
+	// An empty instance returns the samples of all instances.
+	ListStatSnapshots(instance string, since, until time.Time) ([]*domain.StatSnapshot, error)
+
+	// DeleteStatSnapshotsBefore removes samples older than the given age
+	DeleteStatSnapshotsBefore(maxAge time.Duration) (int, error)
+}
+
+// UserRepository defines operations for admin user accounts
+type UserRepository interface {
+	// GetUserByID retrieves an admin user by ID
+	GetUserByID(id int64) (*domain.AdminUser, error)
+
+	// GetUserByUsername retrieves an admin user by username
+	GetUserByUsername(username string) (*domain.AdminUser, error)
+
+	// ListUsers returns all admin users ordered by username
+	ListUsers() ([]*domain.AdminUser, error)
+
+	// CreateUser creates a new admin user (ErrAlreadyExists if the username is taken)
+	CreateUser(user *domain.AdminUser) error
+
+	// UpdateUser updates password hash, role and disabled flag of an admin user
+	UpdateUser(user *domain.AdminUser) error
+
+	// DeleteUser deletes an admin user and their API tokens
+	DeleteUser(id int64) error
+}
+
+// APITokenRepository defines operations for admin API tokens
+type APITokenRepository interface {
+	// CreateAPIToken stores a new API token
+	CreateAPIToken(token *domain.APIToken) error
+
+	// GetAPITokenByHash retrieves an API token by the hash of its value
+	GetAPITokenByHash(tokenHash string) (*domain.APIToken, error)
+
+	// ListAPITokens returns the API tokens of a user
+	ListAPITokens(userID int64) ([]*domain.APIToken, error)
+
+	// RevokeAPIToken marks an API token as revoked (ErrNotFound if missing)
+	RevokeAPIToken(id int64) error
+
+	// TouchAPIToken records that an API token was just used
+	TouchAPIToken(id int64) error
+}
+
+// AuditRepository defines operations for the audit log
+type AuditRepository interface {
+	// RecordAuditEvent appends an event to the audit log
+	RecordAuditEvent(event *domain.AuditEvent) error
+
+	// ListAuditEvents returns events matching the filter, newest first
+	ListAuditEvents(filter domain.AuditFilter, limit, offset int) ([]*domain.AuditEvent, error)
+
+	// DeleteAuditEventsBefore removes events older than the given age
+	DeleteAuditEventsBefore(maxAge time.Duration) (int, error)
+}
+
+// LeaseRepository defines named leases used to elect a single active instance
+type LeaseRepository interface {
+	// AcquireLease takes or renews the named lease for holder until ttl from now
+	// Returns false if another holder owns an unexpired lease
+	AcquireLease(name, holder string, ttl time.Duration) (bool, error)
+
+	// ReleaseLease gives up the named lease if it is held by holder
+	ReleaseLease(name, holder string) error
+}
+
+// LabelRepository defines operations for Drive labels and the files carrying them
+type LabelRepository interface {
+	// SyncLabels replaces the stored labels with the given set, keyed by
+	// SynoLabelID, and rebuilds the file mappings from the files' label names
+	SyncLabels(labels []*domain.Label) error
+
+	// ListLabels returns all labels with their file counts, ordered by name
+	ListLabels() ([]*domain.LabelUsage, error)
+
+	// GetLabel returns a label with its file counts, or nil if it does not exist
+	GetLabel(id int64) (*domain.LabelUsage, error)
+
+	// ListLabelFiles returns a page of the files carrying a label, ordered by
+	// path, and the total number of them. cached restricts the cache state.
+	ListLabelFiles(labelID int64, cached *bool, limit, offset int) ([]*domain.File, int, error)
+}
+
+// PreseedRepository defines operations for paths that are always cached
+type PreseedRepository interface {
+	// ListPreseedPaths returns all pre-seeded paths ordered by path
+	ListPreseedPaths() ([]*domain.PreseedPath, error)
+
+	// AddPreseedPath stores a new path (ErrAlreadyExists if it is already listed)
+	AddPreseedPath(p *domain.PreseedPath) error
+
+	// DeletePreseedPath removes a path by ID (ErrNotFound if missing)
+	DeletePreseedPath(id int64) error
+}
+
+// ChunkRepository defines operations for chunks of partially cached files
+type ChunkRepository interface {
+	// GetChunks returns the cached chunks of a file ordered by index
+	GetChunks(fileID int64) ([]*domain.FileChunk, error)
+
+	// AddChunk records a cached chunk, replacing an existing record of the same index
+	AddChunk(chunk *domain.FileChunk) error
+
+	// TouchChunk records that a chunk was just read
+	TouchChunk(fileID, index int64) error
+
+	// DeleteChunk removes the record of a single chunk
+	DeleteChunk(fileID, index int64) error
+
+	// DeleteChunks removes the records of all chunks of a file
+	DeleteChunks(fileID int64) error
+
+	// GetChunkUsage returns the total size of all cached chunks
+	GetChunkUsage() (int64, error)
+
+	// GetLeastRecentChunks returns up to limit chunks, least recently read first
+	GetLeastRecentChunks(limit int) ([]*domain.FileChunk, error)
+}
+
+// ReplicationRepository tracks which cached copies were mirrored to the replica
+type ReplicationRepository interface {
+	// ListReplicationPending returns up to limit cached files that have no
+	// replica yet or whose copy changed since it was replicated
+	ListReplicationPending(limit int) ([]*domain.File, error)
+
+	// ListReplicationStale returns up to limit Synology file IDs that were
+	// replicated but are no longer cached
+	ListReplicationStale(limit int) ([]string, error)
+
+	// MarkReplicated records that the current copy of file was replicated
+	MarkReplicated(file *domain.File) error
+
+	// DeleteReplicated forgets the replica of a Synology file
+	DeleteReplicated(synoFileID string) error
 }
 
 // Store combines all repository interfaces
@@ -116,6 +396,14 @@ type Store interface {
 	ShareRepository
 	DownloadTaskRepository
 	StatsRepository
+	UserRepository
+	APITokenRepository
+	AuditRepository
+	LeaseRepository
+	PreseedRepository
+	ChunkRepository
+	LabelRepository
+	ReplicationRepository
 
 	// Close closes the database connection
 	Close() error
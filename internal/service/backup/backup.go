@@ -0,0 +1,246 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	filePrefix = "cache-"
+	fileSuffix = ".db"
+
+	// nameLayout is the timestamp part of backup file names; it sorts chronologically
+	nameLayout = "20060102-150405"
+)
+
+// Database creates consistent copies of the metadata database
+type Database interface {
+	Backup(destPath string) error
+}
+
+// Info describes a backup file
+type Info struct {
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Config contains backup service configuration
+type Config struct {
+	// Dir is where backups are written
+	Dir string
+
+	// Interval between scheduled backups; 0 disables scheduling
+	Interval time.Duration
+
+	// Keep is the number of most recent backups to retain
+	Keep int
+}
+
+// DefaultConfig returns default backup configuration
+func DefaultConfig() *Config {
+	return &Config{
+		Interval: 24 * time.Hour,
+		Keep:     7,
+	}
+}
+
+// Service writes scheduled and on-demand database backups with retention
+type Service struct {
+	config *Config
+	db     Database
+	logger *zap.Logger
+
+	// backupMu serialises backups so scheduled and manual runs don't overlap
+	backupMu sync.Mutex
+
+	mu      sync.Mutex
+	running bool
+	cancel  context.CancelFunc
+}
+
+// New creates a new backup Service
+func New(cfg *Config, db Database, logger *zap.Logger) (*Service, error) {
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+	if cfg.Keep <= 0 {
+		cfg.Keep = 7
+	}
+	if cfg.Dir == "" {
+		return nil, fmt.Errorf("backup directory is required")
+	}
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create backup dir: %w", err)
+	}
+
+	return &Service{
+		config: cfg,
+		db:     db,
+		logger: logger,
+	}, nil
+}
+
+// Start runs scheduled backups until ctx is cancelled
+func (s *Service) Start(ctx context.Context) error {
+	s.mu.Lock()
+	if s.running {
+		s.mu.Unlock()
+		return fmt.Errorf("backup service already running")
+	}
+	s.running = true
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.mu.Unlock()
+
+	if s.config.Interval <= 0 {
+		<-ctx.Done()
+		return nil
+	}
+
+	s.logger.Info("backup service started",
+		zap.String("dir", s.config.Dir),
+		zap.Duration("interval", s.config.Interval),
+		zap.Int("keep", s.config.Keep))
+
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.logger.Info("backup service stopped")
+			return nil
+		case <-ticker.C:
+			if _, err := s.Create(); err != nil {
+				s.logger.Error("scheduled backup failed", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Stop stops scheduled backups
+func (s *Service) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.running = false
+}
+
+// Create writes a new backup and removes backups beyond Keep
+func (s *Service) Create() (*Info, error) {
+	s.backupMu.Lock()
+	defer s.backupMu.Unlock()
+
+	start := time.Now()
+	name := filePrefix + start.UTC().Format(nameLayout) + fileSuffix
+	path := filepath.Join(s.config.Dir, name)
+
+	// Write under a temporary name so a partial backup is never listed
+	tmpPath := path + ".tmp"
+	os.Remove(tmpPath)
+	if err := s.db.Backup(tmpPath); err != nil {
+		os.Remove(tmpPath)
+		return nil, err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return nil, fmt.Errorf("failed to finalize backup: %w", err)
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat backup: %w", err)
+	}
+
+	s.logger.Info("database backup created",
+		zap.String("name", name),
+		zap.Int64("size", stat.Size()),
+		zap.Duration("duration", time.Since(start)))
+
+	if removed, err := s.prune(); err != nil {
+		s.logger.Warn("failed to prune old backups", zap.Error(err))
+	} else if removed > 0 {
+		s.logger.Info("removed old backups", zap.Int("count", removed))
+	}
+
+	return &Info{Name: name, Size: stat.Size(), CreatedAt: start}, nil
+}
+
+// List returns existing backups, newest first
+func (s *Service) List() ([]Info, error) {
+	entries, err := os.ReadDir(s.config.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	backups := make([]Info, 0, len(entries))
+	for _, entry := range entries {
+		createdAt, ok := parseName(entry.Name())
+		if !ok || entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		backups = append(backups, Info{Name: entry.Name(), Size: info.Size(), CreatedAt: createdAt})
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].CreatedAt.After(backups[j].CreatedAt)
+	})
+	return backups, nil
+}
+
+// Path returns the file path of a backup by name.
+// Returns false for names that are not backups written by this service.
+func (s *Service) Path(name string) (string, bool) {
+	if _, ok := parseName(name); !ok {
+		return "", false
+	}
+	path := filepath.Join(s.config.Dir, name)
+	if _, err := os.Stat(path); err != nil {
+		return "", false
+	}
+	return path, true
+}
+
+// prune removes backups beyond the newest Keep
+func (s *Service) prune() (int, error) {
+	backups, err := s.List()
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for i := s.config.Keep; i < len(backups); i++ {
+		if err := os.Remove(filepath.Join(s.config.Dir, backups[i].Name)); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// parseName returns the creation time encoded in a backup file name
+func parseName(name string) (time.Time, bool) {
+	if !strings.HasPrefix(name, filePrefix) || !strings.HasSuffix(name, fileSuffix) {
+		return time.Time{}, false
+	}
+	stamp := strings.TrimSuffix(strings.TrimPrefix(name, filePrefix), fileSuffix)
+	t, err := time.Parse(nameLayout, stamp)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
@@ -0,0 +1,89 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// fakeDatabase writes a small file as the backup
+type fakeDatabase struct{}
+
+func (fakeDatabase) Backup(destPath string) error {
+	return os.WriteFile(destPath, []byte("SQLite format 3"), 0644)
+}
+
+func TestService_CreateAndPrune(t *testing.T) {
+	dir := t.TempDir()
+
+	// Older backups plus files that must be left alone
+	for _, name := range []string{
+		"cache-20250101-000000.db",
+		"cache-20250102-000000.db",
+		"cache-20250103-000000.db",
+		"notes.txt",
+		"cache-latest.db",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s, err := New(&Config{Dir: dir, Keep: 2}, fakeDatabase{}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	info, err := s.Create()
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if info.Size == 0 {
+		t.Error("expected non-empty backup")
+	}
+
+	backups, err := s.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("List() returned %d backups, want 2", len(backups))
+	}
+	if backups[0].Name != info.Name || backups[1].Name != "cache-20250103-000000.db" {
+		t.Errorf("List() = %s, %s; want newest first", backups[0].Name, backups[1].Name)
+	}
+
+	for _, name := range []string{"notes.txt", "cache-latest.db"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s should not be pruned: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "cache-20250101-000000.db")); !os.IsNotExist(err) {
+		t.Error("oldest backup should be pruned")
+	}
+}
+
+func TestService_Path(t *testing.T) {
+	dir := t.TempDir()
+	s, err := New(&Config{Dir: dir}, fakeDatabase{}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name := "cache-" + time.Now().UTC().Format(nameLayout) + ".db"
+	if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := s.Path(name); !ok {
+		t.Errorf("Path(%q) not found", name)
+	}
+	for _, bad := range []string{"../cache.db", "cache-20250101-000000.db", "notes.txt"} {
+		if _, ok := s.Path(bad); ok {
+			t.Errorf("Path(%q) should be rejected", bad)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package cacher
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"go.uber.org/zap"
+)
+
+// blobStore tracks cached copies that may be shared by several files.
+// With deduplication enabled a downloaded copy is moved to a blob named after
+// its content hash, and files with identical content point at the same blob.
+// A copy is only deleted once no file references it anymore; the reference
+// count is the number of file rows using its cache path.
+type blobStore struct {
+	files  port.FileRepository
+	fs     port.FileSystem
+	logger *zap.Logger
+
+	// mu serialises adopting and releasing copies, so a blob is not deleted
+	// while another worker is pointing a file at it
+	mu sync.Mutex
+}
+
+// newBlobStore creates a new blobStore
+func newBlobStore(files port.FileRepository, fs port.FileSystem, logger *zap.Logger) *blobStore {
+	return &blobStore{
+		files:  files,
+		fs:     fs,
+		logger: logger,
+	}
+}
+
+// store moves the copy of file at cachePath into the blob for its content
+// hash and returns the blob path. If an identical blob already exists the
+// copy is dropped and true is returned. The file must be in the caching state;
+// it is recorded as referencing the blob before the copy is moved.
+func (b *blobStore) store(file *domain.File, cachePath string) (string, bool, error) {
+	hash, err := b.fs.HashFile(cachePath)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to hash cached file: %w", err)
+	}
+	blobPath := b.fs.BlobPath(hash)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	pending := *file
+	pending.BeginCaching(blobPath)
+	pending.ContentHash = hash
+	if err := b.files.Update(&pending); err != nil {
+		return "", false, fmt.Errorf("failed to record blob: %w", err)
+	}
+
+	existed, err := b.fs.StoreBlob(cachePath, hash)
+	if err != nil {
+		return "", false, err
+	}
+
+	file.CachePath = blobPath
+	file.ContentHash = hash
+	return blobPath, existed, nil
+}
+
+// keep moves the stale copy of file out of the way of its new download, into
+// the blob for its content hash, so it can be served until the download is
+// done. Copies already stored as a blob are left in place. The file row is
+// updated to reference the blob before the copy at its cache path is
+// overwritten.
+func (b *blobStore) keep(file *domain.File) error {
+	if file.ContentHash != "" {
+		return nil
+	}
+
+	hash, err := b.fs.HashFile(file.CachePath)
+	if err != nil {
+		return fmt.Errorf("failed to hash stale copy: %w", err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, err := b.fs.LinkBlob(file.CachePath, hash); err != nil {
+		return err
+	}
+
+	kept := *file
+	kept.CachePath = b.fs.BlobPath(hash)
+	kept.ContentHash = hash
+	if err := b.files.Update(&kept); err != nil {
+		return fmt.Errorf("failed to record stale copy: %w", err)
+	}
+
+	*file = kept
+	return nil
+}
+
+// release deletes the copy at cachePath unless a file still references it.
+// With trash set the copy is moved to the trash instead, so it can be restored
+// if the file is cached again. Callers mark their own file as evicting or
+// uncached first.
+func (b *blobStore) release(cachePath string, trash bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	refs, err := b.files.CountCacheReferences(cachePath)
+	if err != nil {
+		return fmt.Errorf("failed to count references: %w", err)
+	}
+	if refs > 0 {
+		b.logger.Debug("cached copy still referenced, keeping it",
+			zap.String("path", cachePath),
+			zap.Int("references", refs))
+		return nil
+	}
+	if trash {
+		return b.fs.TrashFile(cachePath)
+	}
+	return b.fs.DeleteFile(cachePath)
+}
+
+// quarantine moves the copy at cachePath to the quarantine directory unless
+// a file still references it. Callers mark their own file as uncached first.
+func (b *blobStore) quarantine(cachePath string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	refs, err := b.files.CountCacheReferences(cachePath)
+	if err != nil {
+		return fmt.Errorf("failed to count references: %w", err)
+	}
+	if refs > 0 {
+		b.logger.Debug("cached copy still referenced, keeping it",
+			zap.String("path", cachePath),
+			zap.Int("references", refs))
+		return nil
+	}
+	return b.fs.QuarantineFile(cachePath)
+}
+
+// collect deletes blobs no file references anymore, e.g. after the syncer
+// invalidated the last file using one. Returns the number of deleted blobs.
+func (b *blobStore) collect() int {
+	blobs, err := b.fs.ListBlobs()
+	if err != nil {
+		b.logger.Warn("failed to list blobs", zap.Error(err))
+		return 0
+	}
+
+	deleted := 0
+	for _, blobPath := range blobs {
+		b.mu.Lock()
+		refs, err := b.files.CountCacheReferences(blobPath)
+		if err == nil && refs == 0 {
+			err = b.fs.DeleteFile(blobPath)
+			if err == nil {
+				deleted++
+			}
+		}
+		b.mu.Unlock()
+
+		if err != nil {
+			b.logger.Warn("failed to collect blob",
+				zap.String("path", blobPath),
+				zap.Error(err))
+		}
+	}
+
+	if deleted > 0 {
+		b.logger.Info("deleted unreferenced blobs", zap.Int("count", deleted))
+	}
+	return deleted
+}
@@ -0,0 +1,134 @@
+package cacher
+
+import (
+	"testing"
+
+	"github.com/vertextoedge/synology-file-cache/internal/adapter/filesystem"
+	"github.com/vertextoedge/synology-file-cache/internal/adapter/sqlite"
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+)
+
+// cacheDeduplicated caches path with content the way processTask does with
+// dedup enabled and returns the file and whether its blob already existed
+func cacheDeduplicated(t *testing.T, c *Cacher, store *sqlite.Store, fs *filesystem.Manager, path, content string) (*domain.File, bool) {
+	t.Helper()
+	file, err := store.GetByPath(path)
+	if err != nil {
+		t.Fatalf("GetByPath() error = %v", err)
+	}
+	if file == nil {
+		file = addFile(t, store, path, domain.CacheStateCaching, fs.CachePath(path))
+	} else {
+		file.BeginCaching(fs.CachePath(path))
+		if err := store.Update(file); err != nil {
+			t.Fatalf("Update() error = %v", err)
+		}
+	}
+	writeCopy(t, file.CachePath, content)
+
+	file.MarkCached(file.CachePath)
+	_, existed, err := c.blobs.store(file, file.CachePath)
+	if err != nil {
+		t.Fatalf("store() error = %v", err)
+	}
+	if err := store.Update(file); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	return file, existed
+}
+
+func TestBlobStore_SharedBlobOutlivesEviction(t *testing.T) {
+	c, store, fs := newTestCacher(t)
+
+	a, existed := cacheDeduplicated(t, c, store, fs, "/mydrive/a.txt", "same content")
+	if existed {
+		t.Fatal("store() reported the first copy as a duplicate")
+	}
+	b, existed := cacheDeduplicated(t, c, store, fs, "/mydrive/b.txt", "same content")
+	if !existed || b.CachePath != a.CachePath {
+		t.Fatalf("second copy = %q (existed %v), want it deduplicated into %q", b.CachePath, existed, a.CachePath)
+	}
+	if exists(fs.CachePath(b.Path)) {
+		t.Error("duplicate download was not deleted")
+	}
+	if refs, _ := store.CountCacheReferences(a.CachePath); refs != 2 {
+		t.Errorf("references = %d, want 2", refs)
+	}
+
+	blobPath := a.CachePath
+	if !c.evictor.evictFile(a, false) {
+		t.Fatal("evictFile() failed")
+	}
+	if !exists(blobPath) {
+		t.Fatal("blob deleted while another file still uses it")
+	}
+	if refs, _ := store.CountCacheReferences(blobPath); refs != 1 {
+		t.Errorf("references after eviction = %d, want 1", refs)
+	}
+
+	if !c.evictor.evictFile(b, false) {
+		t.Fatal("evictFile() failed")
+	}
+	if exists(blobPath) {
+		t.Error("blob kept after the last file using it was evicted")
+	}
+}
+
+func TestBlobStore_RecacheSameContent(t *testing.T) {
+	c, store, fs := newTestCacher(t)
+
+	a, _ := cacheDeduplicated(t, c, store, fs, "/mydrive/a.txt", "same content")
+	cacheDeduplicated(t, c, store, fs, "/mydrive/b.txt", "same content")
+	blobPath := a.CachePath
+
+	// Invalidated by the syncer, then downloaded again without a change
+	a.InvalidateCache()
+	if err := store.Update(a); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	a, existed := cacheDeduplicated(t, c, store, fs, "/mydrive/a.txt", "same content")
+	if !existed || a.CachePath != blobPath {
+		t.Fatalf("re-cached copy = %q (existed %v), want it back in %q", a.CachePath, existed, blobPath)
+	}
+	if refs, _ := store.CountCacheReferences(blobPath); refs != 2 {
+		t.Errorf("references = %d, want 2", refs)
+	}
+	if got := c.blobs.collect(); got != 0 {
+		t.Errorf("collect() = %d, want the shared blob kept", got)
+	}
+	if !exists(blobPath) {
+		t.Error("blob deleted")
+	}
+}
+
+func TestBlobStore_Collect(t *testing.T) {
+	c, store, fs := newTestCacher(t)
+
+	cached := fs.BlobPath("aa01")
+	caching := fs.BlobPath("bb02")
+	invalidated := fs.BlobPath("cc03") // Row still names the blob but is not cached
+	orphaned := fs.BlobPath("dd04")    // No row at all
+	for _, blobPath := range []string{cached, caching, invalidated, orphaned} {
+		writeCopy(t, blobPath, blobPath)
+	}
+	addFile(t, store, "/mydrive/cached.txt", "cached", cached)
+	addFile(t, store, "/mydrive/caching.txt", domain.CacheStateCaching, caching)
+	stale := addFile(t, store, "/mydrive/invalidated.txt", "cached", invalidated)
+	stale.Cached = false
+	if err := store.Update(stale); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	if got := c.blobs.collect(); got != 2 {
+		t.Errorf("collect() = %d, want 2", got)
+	}
+	for blobPath, want := range map[string]bool{cached: true, caching: true, invalidated: false, orphaned: false} {
+		if exists(blobPath) != want {
+			t.Errorf("%s exists = %v, want %v", blobPath, !want, want)
+		}
+	}
+
+	if got := c.blobs.collect(); got != 0 {
+		t.Errorf("second collect() = %d, want 0", got)
+	}
+}
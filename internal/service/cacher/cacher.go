@@ -2,12 +2,19 @@ package cacher
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"mime"
+	"os"
+	"path/filepath"
 	"sync"
 	"time"
 
 	"github.com/vertextoedge/synology-file-cache/internal/domain"
 	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"github.com/vertextoedge/synology-file-cache/internal/service/stats"
+	"github.com/vertextoedge/synology-file-cache/internal/util/compress"
+	"github.com/vertextoedge/synology-file-cache/internal/util/inuse"
 	"go.uber.org/zap"
 )
 
@@ -19,28 +26,122 @@ type Config struct {
 	EvictionInterval       time.Duration
 	StaleTaskTimeout       time.Duration
 	ProgressUpdateInterval time.Duration
-	WorkerPollInterval     time.Duration
+	WorkerPollInterval     time.Duration // Fallback poll of idle workers; tasks queued in this process wake them at once
 	WorkerErrorBackoff     time.Duration
 	EvictionBatchSize      int
 	MaxDownloadRetries     int
+	DrainTimeout           time.Duration // How long Stop waits for in-flight downloads
+	HeartbeatInterval      time.Duration // How often a worker renews the lease on its task
+
+	// ClaimBatchSize lets a worker claim up to this many tasks at once and
+	// download them one after the other, as long as their sizes add up to at
+	// most ClaimBatchMaxBytes. Saves a claim transaction per file when many
+	// small files are queued (<= 1 = one task at a time).
+	ClaimBatchSize     int
+	ClaimBatchMaxBytes int64
+
+	// Reservations keep workers for urgent priority classes; they only claim
+	// tasks of their class or more urgent and idle otherwise
+	Reservations []Reservation
+
+	// InstanceID prefixes worker IDs (defaults to the hostname)
+	InstanceID string
+
+	// SharedQueue is set when other instances claim from the same queue.
+	// On startup only tasks of this instance are released, not every in-progress task.
+	SharedQueue bool
+
+	// CompressAtRest gzips cached text-like files to save disk space
+	CompressAtRest bool
+
+	// LowSpaceHeadroomPercent pauses claiming when less than this share of the
+	// cache/disk limit is left and reduces concurrency below twice that (0 = disabled)
+	LowSpaceHeadroomPercent float64
+	SpaceCheckInterval      time.Duration // How often headroom is checked
+
+	// DownloadWindows restricts bulk downloads to these times of day (empty = always).
+	// Outside them only tasks with priority <= WindowBypassPriority are claimed,
+	// so shared files requested by users are still cached immediately.
+	DownloadWindows      []DownloadWindow
+	WindowBypassPriority int
+
+	// Quota limits cached bytes per Drive owner and label, checked every EvictionInterval
+	Quota domain.Quota
+
+	// EvictionPolicy orders files of the same priority for eviction (defaults to LRU)
+	EvictionPolicy domain.EvictionPolicy
+
+	// OfficeExport converts Synology Office documents when caching:
+	// domain.OfficeExportNative (docx/xlsx/pptx), domain.OfficeExportPDF or "" (download as-is)
+	OfficeExport string
+
+	// Dedup stores downloaded copies as blobs named after their content hash,
+	// so files with identical content share one copy on disk
+	Dedup bool
+
+	// SegmentsPerFile downloads files of at least SegmentMinSize bytes over
+	// this many connections at once (<= 1 = single stream)
+	SegmentsPerFile int
+	SegmentMinSize  int64
+
+	// DownloadIdleTimeout aborts a download that receives no data for this
+	// long (0 = never). DownloadMinThroughput (bytes/s) bounds how long a
+	// download may take for its size (0 = unlimited). Both count as a failed
+	// attempt and keep the partial file for resuming.
+	DownloadIdleTimeout   time.Duration
+	DownloadMinThroughput int64
+
+	// MissingUpstreamTTL is how long a file whose download found it deleted on
+	// the NAS is not enqueued again, unless a newer version is synced (0 = always retry)
+	MissingUpstreamTTL time.Duration
+
+	// Stats counts bytes downloaded from the NAS for the dashboard (nil = disabled)
+	Stats *stats.Counters
+
+	// Readers tracks the cached copies the HTTP server is reading; the
+	// evictor skips them (nil = not tracked)
+	Readers *inuse.Tracker
 }
 
 // DefaultConfig returns default cacher configuration
 func DefaultConfig() *Config {
 	return &Config{
-		MaxSizeBytes:           50 * 1024 * 1024 * 1024, // 50GB
-		MaxDiskUsagePercent:    50,
-		ConcurrentDownloads:    3,
-		EvictionInterval:       30 * time.Second,
-		StaleTaskTimeout:       30 * time.Minute,
-		ProgressUpdateInterval: 10 * time.Second,
-		WorkerPollInterval:     time.Second,
-		WorkerErrorBackoff:     5 * time.Second,
-		EvictionBatchSize:      10,
-		MaxDownloadRetries:     3,
+		MaxSizeBytes:            50 * 1024 * 1024 * 1024, // 50GB
+		MaxDiskUsagePercent:     50,
+		ConcurrentDownloads:     3,
+		EvictionInterval:        30 * time.Second,
+		StaleTaskTimeout:        30 * time.Minute,
+		ProgressUpdateInterval:  10 * time.Second,
+		WorkerPollInterval:      15 * time.Second,
+		WorkerErrorBackoff:      5 * time.Second,
+		EvictionBatchSize:       10,
+		MaxDownloadRetries:      3,
+		DrainTimeout:            20 * time.Second,
+		HeartbeatInterval:       time.Minute,
+		ClaimBatchSize:          16,
+		ClaimBatchMaxBytes:      4 * 1024 * 1024, // 4MB
+		LowSpaceHeadroomPercent: 5,
+		SpaceCheckInterval:      30 * time.Second,
+		WindowBypassPriority:    domain.PriorityShared,
+		MissingUpstreamTTL:      24 * time.Hour,
+		SegmentsPerFile:         1,
+		SegmentMinSize:          64 * 1024 * 1024, // 64MB
+		DownloadIdleTimeout:     2 * time.Minute,
+		DownloadMinThroughput:   64 * 1024, // 64KB/s
 	}
 }
 
+// compressMinSize is the smallest file worth compressing at rest
+const compressMinSize = 4 * 1024
+
+// shouldCompressAtRest reports whether a cached file is text-like and large enough to compress
+func shouldCompressAtRest(contentType string, size int64) bool {
+	if size < compressMinSize {
+		return false
+	}
+	return compress.IsCompressible(contentType)
+}
+
 // Cacher handles file caching using a task queue
 type Cacher struct {
 	config       *Config
@@ -52,11 +153,25 @@ type Cacher struct {
 	downloader   *Downloader
 	evictor      *Evictor
 	spaceManager *SpaceManager
+	blobs        *blobStore
+	throttle     *throttle           // Limits claiming workers while free space is low
+	ceilings     []int               // Per worker: least urgent priority it may claim
+	workers      []*workerEntry      // Per worker: current task, heartbeat and throughput
+	hooks        []port.PreServeHook // Run on downloaded copies before they are marked cached
+	events       port.EventPublisher // nil unless events are streamed
 
 	mu      sync.Mutex
 	running bool
 	cancel  context.CancelFunc
 	wg      sync.WaitGroup
+
+	// Downloads run on their own context so they can finish while draining
+	downloadCtx    context.Context
+	abortDownloads context.CancelFunc
+
+	// Files being cached, so concurrent requests share one download
+	flightsMu sync.Mutex
+	flights   map[int64]*flight
 }
 
 // New creates a new Cacher
@@ -84,7 +199,7 @@ func New(
 		cfg.ProgressUpdateInterval = 10 * time.Second
 	}
 	if cfg.WorkerPollInterval == 0 {
-		cfg.WorkerPollInterval = time.Second
+		cfg.WorkerPollInterval = 15 * time.Second
 	}
 	if cfg.WorkerErrorBackoff == 0 {
 		cfg.WorkerErrorBackoff = 5 * time.Second
@@ -95,6 +210,18 @@ func New(
 	if cfg.MaxDownloadRetries == 0 {
 		cfg.MaxDownloadRetries = 3
 	}
+	if cfg.DrainTimeout == 0 {
+		cfg.DrainTimeout = 20 * time.Second
+	}
+	if cfg.HeartbeatInterval == 0 {
+		cfg.HeartbeatInterval = time.Minute
+	}
+	if cfg.InstanceID == "" {
+		cfg.InstanceID = DefaultInstanceID()
+	}
+	if cfg.SpaceCheckInterval == 0 {
+		cfg.SpaceCheckInterval = 30 * time.Second
+	}
 
 	spaceManager := NewSpaceManager(fs, cfg.MaxSizeBytes, cfg.MaxDiskUsagePercent)
 
@@ -106,14 +233,48 @@ func New(
 		fs:           fs,
 		logger:       logger,
 		spaceManager: spaceManager,
+		blobs:        newBlobStore(files, fs, logger),
+		throttle:     newThrottle(cfg.ConcurrentDownloads),
+		ceilings:     workerCeilings(cfg.ConcurrentDownloads, cfg.Reservations),
+		flights:      make(map[int64]*flight),
+	}
+
+	// Hostname and pid keep worker IDs unique across instances and restarts
+	names := make([]string, cfg.ConcurrentDownloads)
+	for i := range names {
+		names[i] = fmt.Sprintf("%s%d:worker-%d", c.workerPrefix(), os.Getpid(), i)
 	}
+	c.workers = newWorkerEntries(names, c.ceilings)
 
-	c.downloader = NewDownloader(drive, tasks, fs, logger, cfg.MaxSizeBytes, cfg.ProgressUpdateInterval)
-	c.evictor = NewEvictor(files, tasks, fs, spaceManager, logger, cfg.EvictionInterval, cfg.EvictionBatchSize)
+	c.downloader = NewDownloader(drive, tasks, fs, logger, cfg.MaxSizeBytes, cfg.ProgressUpdateInterval, cfg.OfficeExport)
+	c.downloader.stats = cfg.Stats
+	c.downloader.segments = cfg.SegmentsPerFile
+	c.downloader.segmentMinSize = cfg.SegmentMinSize
+	c.downloader.idleTimeout = cfg.DownloadIdleTimeout
+	c.downloader.minThroughput = cfg.DownloadMinThroughput
+	c.evictor = NewEvictor(files, tasks, fs, spaceManager, c.blobs, logger, cfg.EvictionInterval, cfg.EvictionBatchSize, cfg.EvictionPolicy)
+	c.evictor.readers = cfg.Readers
 
 	return c
 }
 
+// errLeaseLost cancels a download whose task was released and possibly claimed elsewhere
+var errLeaseLost = errors.New("task lease lost")
+
+// DefaultInstanceID returns the hostname, or "local" if it is unavailable
+func DefaultInstanceID() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		return "local"
+	}
+	return host
+}
+
+// workerPrefix is shared by the worker IDs of every process of this instance
+func (c *Cacher) workerPrefix() string {
+	return c.config.InstanceID + ":"
+}
+
 // Start starts the caching workers
 func (c *Cacher) Start(ctx context.Context) error {
 	c.mu.Lock()
@@ -123,22 +284,45 @@ func (c *Cacher) Start(ctx context.Context) error {
 	}
 	c.running = true
 	ctx, c.cancel = context.WithCancel(ctx)
+	c.downloadCtx, c.abortDownloads = context.WithCancel(context.Background())
+	c.wg.Add(c.config.ConcurrentDownloads)
 	c.mu.Unlock()
 
 	c.logger.Info("cacher started",
-		zap.Int("workers", c.config.ConcurrentDownloads))
+		zap.Int("workers", c.config.ConcurrentDownloads),
+		zap.Ints("priority_ceilings", c.ceilings))
 
-	// Release any stale tasks from previous run
-	released, err := c.tasks.ReleaseStaleInProgressTasks(0) // Release all in-progress tasks on startup
+	// Release any stale tasks from previous run. With a shared queue tasks of
+	// other instances are left alone; their leases expire if they died.
+	var released int
+	var err error
+	if c.config.SharedQueue {
+		released, err = c.tasks.ReleaseWorkerTasks(c.workerPrefix())
+	} else {
+		released, err = c.tasks.ReleaseStaleInProgressTasks(0) // Release all in-progress tasks on startup
+	}
 	if err != nil {
 		c.logger.Warn("failed to release stale tasks on startup", zap.Error(err))
 	} else if released > 0 {
 		c.logger.Info("released stale tasks from previous run", zap.Int("count", released))
 	}
 
+	c.reconcileCacheStates()
+	c.blobs.collect()
+	c.enqueueUntracked(ctx)
+
+	if c.adaptive() {
+		c.checkHeadroom(ctx)
+		go c.watchSpace(ctx)
+	}
+
+	if c.config.Quota.Enabled() {
+		go c.enforceQuotas(ctx)
+	}
+	go c.sampleWorkerRates(ctx)
+
 	// Start worker pool
 	for i := 0; i < c.config.ConcurrentDownloads; i++ {
-		c.wg.Add(1)
 		go c.worker(ctx, i)
 	}
 
@@ -148,21 +332,104 @@ func (c *Cacher) Start(ctx context.Context) error {
 	return nil
 }
 
-// Stop stops the cacher
+// enqueueUntracked creates download tasks for uncached files that have none,
+// e.g. when a task was dropped before the file was cached. Files are streamed
+// from the repository so large databases are not loaded into memory.
+func (c *Cacher) enqueueUntracked(ctx context.Context) {
+	var usage *domain.QuotaUsage
+	if c.config.Quota.Enabled() {
+		var err error
+		if usage, err = c.files.GetQuotaUsage(true); err != nil {
+			c.logger.Warn("failed to load quota usage, not enqueueing untracked files", zap.Error(err))
+			return
+		}
+	}
+
+	enqueued := 0
+	err := c.files.ForEachFileToCache(func(file *domain.File) bool {
+		if ctx.Err() != nil {
+			return false
+		}
+		if c.config.MaxSizeBytes > 0 && file.Size > c.config.MaxSizeBytes {
+			return true
+		}
+		if file.IsMissingUpstream(c.config.MissingUpstreamTTL) {
+			return true
+		}
+		if usage != nil {
+			if !c.config.Quota.Allows(usage, file) {
+				return true
+			}
+			if file.Priority != domain.PriorityPinned {
+				usage.Add(file.Owner, file.Labels, file.Size)
+			}
+		}
+
+		task := &domain.DownloadTask{
+			FileID:     file.ID,
+			SynoPath:   file.Path,
+			Priority:   file.Priority,
+			Size:       file.Size,
+			Status:     domain.TaskStatusPending,
+			MaxRetries: c.config.MaxDownloadRetries,
+		}
+		if err := c.tasks.CreateTask(task); err != nil {
+			if err != domain.ErrAlreadyExists {
+				c.logger.Warn("failed to enqueue untracked file",
+					zap.String("path", file.Path),
+					zap.Error(err))
+			}
+			return true
+		}
+		enqueued++
+		return true
+	})
+	if err != nil {
+		c.logger.Warn("failed to list files to cache", zap.Error(err))
+	}
+	if enqueued > 0 {
+		c.logger.Info("enqueued untracked files", zap.Int("count", enqueued))
+	}
+}
+
+// Stop stops claiming new tasks and waits up to DrainTimeout for in-flight
+// downloads to finish. Downloads still running after that are aborted with
+// their progress saved, so they resume on the next start.
 func (c *Cacher) Stop() {
 	c.mu.Lock()
-	defer c.mu.Unlock()
-	if c.cancel != nil {
-		c.cancel()
+	if c.cancel == nil {
+		c.mu.Unlock()
+		return
 	}
+	c.cancel()
 	c.running = false
+	abort := c.abortDownloads
+	c.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return
+	case <-time.After(c.config.DrainTimeout):
+	}
+
+	c.logger.Warn("drain timeout reached, aborting in-flight downloads",
+		zap.Duration("drain_timeout", c.config.DrainTimeout))
+	abort()
+	<-drained
 }
 
 // worker processes tasks from the queue
 func (c *Cacher) worker(ctx context.Context, workerID int) {
 	defer c.wg.Done()
 
-	workerName := fmt.Sprintf("worker-%d", workerID)
+	entry := c.workers[workerID]
+	workerName := entry.id
 	c.logger.Debug("cacher worker started", zap.String("worker", workerName))
 
 	for {
@@ -172,72 +439,346 @@ func (c *Cacher) worker(ctx context.Context, workerID int) {
 			return
 		default:
 		}
+		entry.beat()
+
+		// Idle while free space is low; the space watcher re-enables workers
+		if !c.throttle.mayClaim(workerID) {
+			entry.setState(domain.WorkerPaused)
+			c.wait(ctx, c.config.WorkerPollInterval)
+			continue
+		}
 
-		// Claim next task
-		task, err := c.tasks.ClaimNextTask(workerName)
+		// Claim next tasks; the queue signal is taken first so a task
+		// queued after an empty claim still wakes the worker
+		queued := c.tasks.TasksQueued()
+		tasks, err := c.claim(workerName, c.ceilings[workerID])
 		if err != nil {
 			c.logger.Error("failed to claim task",
 				zap.String("worker", workerName),
 				zap.Error(err))
-			time.Sleep(c.config.WorkerErrorBackoff)
+			c.wait(ctx, c.config.WorkerErrorBackoff)
 			continue
 		}
 
-		if task == nil {
-			// No tasks available, wait before polling again
-			time.Sleep(c.config.WorkerPollInterval)
+		if len(tasks) == 0 {
+			// No tasks available; sleep until one is queued. The poll still
+			// picks up retries coming due, download windows opening and tasks
+			// queued by other instances.
+			entry.setState(domain.WorkerIdle)
+			c.waitQueued(ctx, queued)
 			continue
 		}
 
-		c.logger.Info("claimed download task",
-			zap.String("worker", workerName),
-			zap.String("path", task.SynoPath),
-			zap.Int("priority", task.Priority),
-			zap.Int64("bytes_downloaded", task.BytesDownloaded))
+		// A batch of small files is processed one after the other. Tasks not
+		// started yet go back to the queue when the worker stops or pauses.
+		for i, task := range tasks {
+			if i > 0 && (ctx.Err() != nil || !c.throttle.mayClaim(workerID)) {
+				c.releaseTasks(tasks[i:])
+				break
+			}
+			if pause := c.runTask(task, entry); pause > 0 {
+				c.releaseTasks(tasks[i+1:])
+				entry.setState(domain.WorkerPaused)
+				c.wait(ctx, pause)
+				break
+			}
+		}
+	}
+}
+
+// runTask downloads a claimed task and records the outcome in the queue. It
+// returns how long the worker should pause when the NAS is unavailable.
+func (c *Cacher) runTask(task *domain.DownloadTask, entry *workerEntry) (pause time.Duration) {
+	workerName := entry.id
+	c.logger.Info("claimed download task",
+		zap.String("worker", workerName),
+		zap.String("path", task.SynoPath),
+		zap.Int("priority", task.Priority),
+		zap.Int64("bytes_downloaded", task.BytesDownloaded))
+	c.publishTask(domain.EventTaskStarted, task)
+	entry.start(task)
+
+	// Process the task; downloads keep running while draining and count
+	// their bytes in the worker's meter. The heartbeat keeps the task lease
+	// alive and aborts if it is lost.
+	taskCtx, cancelTask := context.WithCancelCause(withMeter(c.downloadCtx, &entry.meter))
+	go c.heartbeat(taskCtx, task, entry, cancelTask)
+	err := c.processTask(taskCtx, task, workerName)
+	cancelTask(nil)
+	entry.finish(err)
 
-		// Process the task
-		if err := c.processTask(ctx, task, workerName); err != nil {
+	if err != nil {
+		if errors.Is(context.Cause(taskCtx), errLeaseLost) {
+			// The task was released and may belong to another worker now
+			c.logger.Warn("task lease lost, abandoning download",
+				zap.String("worker", workerName),
+				zap.String("path", task.SynoPath))
+		} else if errors.Is(err, context.Canceled) && c.downloadCtx.Err() != nil {
+			// Aborted at shutdown, progress is saved; don't count it as a retry
+			c.logger.Info("download interrupted by shutdown",
+				zap.String("worker", workerName),
+				zap.String("path", task.SynoPath))
+
+			if err := c.tasks.ReleaseTask(task.ID); err != nil {
+				c.logger.Error("failed to release interrupted task",
+					zap.Int64("task_id", task.ID),
+					zap.Error(err))
+			}
+		} else if errors.Is(err, domain.ErrUpstreamUnavailable) {
+			// The NAS is down; requeue without using up a retry and wait it out
+			pause, _ = domain.GetRetryAfter(err)
+			c.logger.Warn("NAS unavailable, pausing worker",
+				zap.String("worker", workerName),
+				zap.String("path", task.SynoPath),
+				zap.Duration("pause", pause))
+
+			if err := c.tasks.ReleaseTask(task.ID); err != nil {
+				c.logger.Error("failed to release task",
+					zap.Int64("task_id", task.ID),
+					zap.Error(err))
+			}
+			return pause
+		} else if errors.Is(err, domain.ErrMissingUpstream) {
+			// Deleted on the NAS; retrying won't help until a sync sees it again
+			c.logger.Warn("file missing upstream, not retrying",
+				zap.String("worker", workerName),
+				zap.String("path", task.SynoPath),
+				zap.Error(err))
+
+			if err := c.files.MarkMissingUpstream(task.FileID); err != nil {
+				c.logger.Error("failed to mark file missing upstream",
+					zap.Int64("file_id", task.FileID),
+					zap.Error(err))
+			}
+			if err := c.tasks.FailTask(task.ID, err.Error(), false); err != nil {
+				c.logger.Error("failed to mark task as failed",
+					zap.Int64("task_id", task.ID),
+					zap.Error(err))
+			}
+			c.publishFailed(task, err, false)
+		} else if errors.Is(err, domain.ErrFileRejected) {
+			// The same content would be rejected again; the file stays
+			// rejected until a sync sees a newer version
+			c.logger.Warn("downloaded file rejected, quarantined",
+				zap.String("worker", workerName),
+				zap.String("path", task.SynoPath),
+				zap.Error(err))
+
+			if err := c.tasks.FailTask(task.ID, err.Error(), false); err != nil {
+				c.logger.Error("failed to mark task as failed",
+					zap.Int64("task_id", task.ID),
+					zap.Error(err))
+			}
+			c.publishFailed(task, err, false)
+		} else if err == domain.ErrInsufficientSpace {
 			// For insufficient space, use warn level and longer retry
-			if err == domain.ErrInsufficientSpace {
-				c.logger.Warn("task deferred due to insufficient space",
-					zap.String("worker", workerName),
-					zap.String("path", task.SynoPath),
-					zap.Int64("size", task.Size))
-
-				// Always retry space issues (they may resolve when files are evicted)
-				// FailTask will use exponential backoff
-				if err := c.tasks.FailTask(task.ID, err.Error(), true); err != nil {
-					c.logger.Error("failed to defer task",
-						zap.Int64("task_id", task.ID),
-						zap.Error(err))
-				}
-			} else {
-				c.logger.Error("task failed",
-					zap.String("worker", workerName),
-					zap.String("path", task.SynoPath),
-					zap.Int("retry_count", task.RetryCount),
+			c.logger.Warn("task deferred due to insufficient space",
+				zap.String("worker", workerName),
+				zap.String("path", task.SynoPath),
+				zap.Int64("size", task.Size))
+
+			// Always retry space issues (they may resolve when files are evicted)
+			// FailTask will use exponential backoff
+			if err := c.tasks.FailTask(task.ID, err.Error(), true); err != nil {
+				c.logger.Error("failed to defer task",
+					zap.Int64("task_id", task.ID),
 					zap.Error(err))
+			}
+			c.publishFailed(task, err, true)
 
-				// Determine if we should retry
-				canRetry := task.RetryCount < task.MaxRetries
-				if err := c.tasks.FailTask(task.ID, err.Error(), canRetry); err != nil {
-					c.logger.Error("failed to mark task as failed",
-						zap.Int64("task_id", task.ID),
-						zap.Error(err))
-				}
+			// Stop other workers from running into the same wall
+			if c.adaptive() {
+				c.logger.Info("reducing download concurrency",
+					zap.Int("workers", c.throttle.backoff()))
 			}
 		} else {
-			if err := c.tasks.CompleteTask(task.ID); err != nil {
-				c.logger.Error("failed to complete task",
+			c.logger.Error("task failed",
+				zap.String("worker", workerName),
+				zap.String("path", task.SynoPath),
+				zap.Int("retry_count", task.RetryCount),
+				zap.Error(err))
+
+			// Determine if we should retry
+			canRetry := task.RetryCount < task.MaxRetries
+			if err := c.tasks.FailTask(task.ID, err.Error(), canRetry); err != nil {
+				c.logger.Error("failed to mark task as failed",
+					zap.Int64("task_id", task.ID),
+					zap.Error(err))
+			}
+			c.publishFailed(task, err, canRetry)
+		}
+	} else {
+		if err := c.tasks.CompleteTask(task.ID); err != nil {
+			c.logger.Error("failed to complete task",
+				zap.Int64("task_id", task.ID),
+				zap.Error(err))
+		}
+		c.publishTask(domain.EventTaskCompleted, task)
+	}
+	return 0
+}
+
+// releaseTasks returns claimed tasks that were not started to the queue
+func (c *Cacher) releaseTasks(tasks []*domain.DownloadTask) {
+	for _, task := range tasks {
+		if err := c.tasks.ReleaseTask(task.ID); err != nil {
+			c.logger.Error("failed to release task",
+				zap.Int64("task_id", task.ID),
+				zap.Error(err))
+		}
+	}
+}
+
+// claim claims the next task, or a batch of small ones with ClaimBatchSize,
+// at ceiling or more urgent. Outside the download windows only tasks at
+// WindowBypassPriority or more urgent are claimed; downloads already running
+// when a window closes are finished.
+func (c *Cacher) claim(workerName string, ceiling int) ([]*domain.DownloadTask, error) {
+	n, maxBytes := c.config.ClaimBatchSize, c.config.ClaimBatchMaxBytes
+	if !inDownloadWindow(c.config.DownloadWindows, time.Now()) {
+		ceiling = min(ceiling, c.config.WindowBypassPriority)
+	}
+	if ceiling == noCeiling {
+		return c.tasks.ClaimNextTasks(workerName, n, maxBytes)
+	}
+	return c.tasks.ClaimNextTasksUpTo(workerName, n, maxBytes, ceiling)
+}
+
+// adaptive reports whether concurrency follows free space headroom
+func (c *Cacher) adaptive() bool {
+	return c.config.LowSpaceHeadroomPercent > 0
+}
+
+// watchSpace periodically adjusts how many workers may claim tasks
+func (c *Cacher) watchSpace(ctx context.Context) {
+	ticker := time.NewTicker(c.config.SpaceCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.checkHeadroom(ctx)
+		}
+	}
+}
+
+// enforceQuotas periodically evicts files of owners and labels over quota
+func (c *Cacher) enforceQuotas(ctx context.Context) {
+	ticker := time.NewTicker(c.config.EvictionInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.evictor.EnforceQuotas(ctx, c.config.Quota); err != nil && ctx.Err() == nil {
+				c.logger.Warn("failed to enforce quotas", zap.Error(err))
+			}
+		}
+	}
+}
+
+// checkHeadroom updates the worker throttle from the current free space.
+// While paused it evicts once on behalf of all workers instead of letting
+// every worker claim a task, fail the space check and evict on its own.
+func (c *Cacher) checkHeadroom(ctx context.Context) {
+	headroom, err := c.spaceManager.HeadroomPercent()
+	if err != nil {
+		c.logger.Warn("failed to check free space headroom", zap.Error(err))
+		return
+	}
+
+	threshold := c.config.LowSpaceHeadroomPercent
+	before := c.throttle.current()
+	after := c.throttle.adjust(headroom, threshold)
+
+	switch {
+	case after == 0 && before > 0:
+		c.logger.Warn("free space headroom low, pausing downloads",
+			zap.Float64("headroom_pct", headroom),
+			zap.Float64("threshold_pct", threshold))
+	case after > 0 && before == 0:
+		c.logger.Info("free space recovered, resuming downloads",
+			zap.Float64("headroom_pct", headroom),
+			zap.Int("workers", after))
+	case after != before:
+		c.logger.Info("adjusted download concurrency",
+			zap.Float64("headroom_pct", headroom),
+			zap.Int("workers", after))
+	}
+
+	if after == 0 {
+		// Aim for twice the threshold so downloads don't stop again right away
+		needed := int64(float64(c.config.MaxSizeBytes) * 2 * threshold / 100)
+		if err := c.evictor.TryEvict(ctx, needed, c.config.MaxSizeBytes, c.config.MaxDiskUsagePercent); err != nil {
+			c.logger.Debug("eviction while paused did not free enough space", zap.Error(err))
+		}
+	}
+}
+
+// heartbeat renews the lease on a claimed task until ctx is done.
+// If the task is no longer held by this worker the download is cancelled.
+func (c *Cacher) heartbeat(ctx context.Context, task *domain.DownloadTask, entry *workerEntry, cancel context.CancelCauseFunc) {
+	ticker := time.NewTicker(c.config.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			held, err := c.tasks.RenewTaskLease(task.ID, entry.id)
+			if err != nil {
+				c.logger.Warn("failed to renew task lease",
 					zap.Int64("task_id", task.ID),
 					zap.Error(err))
+				continue
 			}
+			if !held {
+				cancel(errLeaseLost)
+				return
+			}
+			entry.beat()
 		}
 	}
 }
 
-// processTask handles a single download task
+// wait sleeps for d or until ctx is cancelled
+func (c *Cacher) wait(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
+// waitQueued blocks until a task is queued, WorkerPollInterval passes or ctx is done
+func (c *Cacher) waitQueued(ctx context.Context, queued <-chan struct{}) {
+	timer := time.NewTimer(c.config.WorkerPollInterval)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+	case <-queued:
+	case <-timer.C:
+	}
+}
+
+// processTask handles a single download task. Tasks racing for the same
+// file share one download.
 func (c *Cacher) processTask(ctx context.Context, task *domain.DownloadTask, workerName string) error {
+	return c.cacheOnce(ctx, task.FileID, task.SynoPath, func() error {
+		return c.cacheFile(ctx, task, workerName)
+	})
+}
+
+// cacheFile downloads the file of a task into the cache and marks it cached
+func (c *Cacher) cacheFile(ctx context.Context, task *domain.DownloadTask, workerName string) error {
 	// Get the file record
 	file, err := c.files.GetByID(task.FileID)
 	if err != nil {
@@ -247,8 +788,8 @@ func (c *Cacher) processTask(ctx context.Context, task *domain.DownloadTask, wor
 		return fmt.Errorf("file not found: %d", task.FileID)
 	}
 
-	// Check if file is already cached
-	if file.Cached {
+	// Check if file is already cached; a stale copy is served until it is replaced
+	if file.Cached && !file.Stale {
 		c.logger.Debug("file already cached, skipping",
 			zap.String("path", task.SynoPath))
 		return nil
@@ -294,9 +835,67 @@ func (c *Cacher) processTask(ctx context.Context, task *domain.DownloadTask, wor
 		}
 	}
 
-	// Download with task
-	result, err := c.downloader.DownloadWithTask(ctx, file, task)
-	if err != nil {
+	// A stale copy keeps being served while the new version downloads. It is
+	// moved out of the way of the download first; if that fails, it stops
+	// being served like without stale-while-revalidate.
+	var stale *domain.File
+	dropped := ""
+	if file.Cached && file.Stale {
+		if err := c.blobs.keep(file); err != nil {
+			c.logger.Warn("failed to keep stale copy, invalidating it",
+				zap.String("path", file.Path),
+				zap.Error(err))
+			dropped = file.CachePath
+		} else {
+			kept := *file
+			stale = &kept
+		}
+	}
+
+	// Record where the copy will be written before touching the disk, so a
+	// crash before the final update is reconciled on startup. A file with a
+	// stale copy stays cached instead; a crash leaves it stale, so the next
+	// sync enqueues it again.
+	if stale == nil {
+		file.BeginCaching(c.fs.CachePath(file.Path))
+		if err := c.files.Update(file); err != nil {
+			return fmt.Errorf("failed to mark file as caching: %w", err)
+		}
+		if dropped != "" && dropped != file.CachePath {
+			c.blobs.release(dropped, false)
+		}
+	}
+	abort := func() {
+		if stale != nil {
+			c.restoreStale(stale)
+		} else {
+			c.abortCaching(file)
+		}
+	}
+
+	// A recently evicted copy is restored from the trash instead of downloaded
+	result := c.restoreTrashed(file, task)
+	if result == nil {
+		result, err = c.downloader.DownloadWithTask(ctx, file, task)
+		if err != nil {
+			// Nothing was moved into the cache; a leftover temp file is kept for resuming
+			abort()
+			return err
+		}
+	}
+
+	// Hooks see the copy as downloaded, before it is compressed or deduplicated
+	if err := c.inspect(ctx, file, result.CachePath); err != nil {
+		if errors.Is(err, domain.ErrFileRejected) {
+			c.reject(file, result.CachePath, err)
+			if stale != nil {
+				c.blobs.release(stale.CachePath, false)
+			}
+			return err
+		}
+		// Keep the copy in the trash, so the retry can restore it
+		c.fs.TrashFile(result.CachePath)
+		abort()
 		return err
 	}
 
@@ -306,15 +905,145 @@ func (c *Cacher) processTask(ctx context.Context, task *domain.DownloadTask, wor
 	file.Size = result.BytesWritten
 	file.LastAccessInCacheAt = &now
 
+	// Drive rarely reports a MIME type; use the extension, then the content
+	if result.ExportFormat != "" {
+		file.ExportFormat = result.ExportFormat
+		file.ContentType = domain.ExportContentType(result.ExportFormat)
+	} else if file.ContentType == "" {
+		file.ContentType = c.detectContentType(file.Path, result.CachePath)
+	}
+
+	if c.config.CompressAtRest && shouldCompressAtRest(file.ContentType, file.Size) {
+		compressed, err := c.fs.CompressFile(file.CachePath)
+		switch {
+		case err != nil:
+			// The uncompressed copy is still valid
+			c.logger.Warn("failed to compress cached file",
+				zap.String("path", file.Path),
+				zap.Error(err))
+		case compressed:
+			file.CacheEncoding = domain.CacheEncodingGzip
+		}
+	}
+
+	// Blobs are hashed as stored, so files compressed at rest share them too
+	if c.config.Dedup {
+		blobPath, existed, err := c.blobs.store(file, file.CachePath)
+		if err != nil {
+			c.fs.DeleteFile(result.CachePath)
+			abort()
+			return fmt.Errorf("failed to store blob: %w", err)
+		}
+		if existed {
+			c.logger.Debug("cached copy deduplicated",
+				zap.String("path", file.Path),
+				zap.String("blob", blobPath))
+		}
+	}
+
 	if err := c.files.Update(file); err != nil {
-		// Clean up the cached file if DB update fails
-		c.fs.DeleteFile(result.CachePath)
+		// Clean up the cached file if DB update fails; the file stays in the
+		// caching state, which reconciliation clears if this fails too
+		cachePath := file.CachePath
+		abort()
+		c.blobs.release(cachePath, false)
 		return fmt.Errorf("db update failed: %w", err)
 	}
 
+	// The stale copy is not served anymore
+	if stale != nil && stale.CachePath != file.CachePath {
+		if err := c.blobs.release(stale.CachePath, false); err != nil {
+			c.logger.Warn("failed to delete stale copy",
+				zap.String("path", stale.CachePath),
+				zap.Error(err))
+		}
+	}
+
+	publishFile(c.events, domain.EventFileCached, file)
 	return nil
 }
 
+// DeleteFile moves a cached copy to the trash, or deletes it if the trash is
+// disabled, unless another file still references it. The file being purged
+// must already be marked evicting or uncached.
+// It implements syncer.CacheDeleter.
+func (c *Cacher) DeleteFile(cachePath string) error {
+	return c.blobs.release(cachePath, true)
+}
+
+// restoreTrashed moves a trashed copy of file back to its cache path if it
+// is still current. Office documents are skipped since their copy may be an
+// export in another format. Returns nil if nothing was restored.
+func (c *Cacher) restoreTrashed(file *domain.File, task *domain.DownloadTask) *domain.DownloadResult {
+	if domain.OfficeExportFormat(file.Path, c.config.OfficeExport) != "" {
+		return nil
+	}
+
+	var modifiedAt time.Time
+	if file.ModifiedAt != nil {
+		modifiedAt = *file.ModifiedAt
+	}
+	cachePath, restored, err := c.fs.RestoreTrashed(file.Path, file.Size, modifiedAt)
+	if err != nil {
+		c.logger.Warn("failed to restore trashed file",
+			zap.String("path", file.Path),
+			zap.Error(err))
+		return nil
+	}
+	if !restored {
+		return nil
+	}
+
+	// A partial download is not needed anymore
+	if task.TempFilePath != "" {
+		c.fs.DeleteTempFile(task.TempFilePath)
+	}
+
+	c.logger.Info("file restored from trash",
+		zap.String("path", file.Path),
+		zap.Int64("size", file.Size))
+	return &domain.DownloadResult{
+		CachePath:    cachePath,
+		BytesWritten: file.Size,
+	}
+}
+
+// abortCaching clears the caching state of a file whose download failed
+func (c *Cacher) abortCaching(file *domain.File) {
+	file.InvalidateCache()
+	if err := c.files.Update(file); err != nil {
+		c.logger.Warn("failed to clear caching state",
+			zap.String("path", file.Path),
+			zap.Error(err))
+	}
+}
+
+// restoreStale serves the stale copy of a file again after its new version
+// failed to download
+func (c *Cacher) restoreStale(stale *domain.File) {
+	if err := c.files.Update(stale); err != nil {
+		c.logger.Warn("failed to restore stale copy",
+			zap.String("path", stale.Path),
+			zap.Error(err))
+	}
+}
+
+// detectContentType determines the MIME type of a freshly cached file from its
+// extension, or by sniffing its content for extensionless and unknown files
+func (c *Cacher) detectContentType(synoPath, cachePath string) string {
+	if contentType := mime.TypeByExtension(filepath.Ext(synoPath)); contentType != "" {
+		return contentType
+	}
+
+	contentType, err := c.fs.SniffContentType(cachePath)
+	if err != nil {
+		c.logger.Debug("failed to detect content type",
+			zap.String("path", synoPath),
+			zap.Error(err))
+		return ""
+	}
+	return contentType
+}
 
 // GetStats returns caching statistics
 func (c *Cacher) GetStats() (map[string]interface{}, error) {
@@ -335,6 +1064,8 @@ func (c *Cacher) GetStats() (map[string]interface{}, error) {
 	stats["disk_used_bytes"] = usage.Used
 	stats["disk_used_percent"] = usage.UsedPct
 	stats["max_disk_percent"] = c.config.MaxDiskUsagePercent
+	stats["allowed_workers"] = c.throttle.current()
+	stats["in_download_window"] = inDownloadWindow(c.config.DownloadWindows, time.Now())
 
 	// Add queue stats
 	queueStats, err := c.tasks.GetQueueStats()
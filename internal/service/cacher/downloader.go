@@ -2,12 +2,14 @@ package cacher
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"time"
 
 	"github.com/vertextoedge/synology-file-cache/internal/domain"
 	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"github.com/vertextoedge/synology-file-cache/internal/service/stats"
 	"go.uber.org/zap"
 )
 
@@ -19,6 +21,18 @@ type Downloader struct {
 	logger           *zap.Logger
 	maxCacheSize     int64
 	progressInterval time.Duration
+	officeExport     string // Export mode for Synology Office documents ("" = download as-is)
+	stats            *stats.Counters
+
+	// Files of at least segmentMinSize bytes are fetched over this many
+	// connections at once (<= 1 = single stream)
+	segments       int
+	segmentMinSize int64
+
+	// Downloads are aborted after idleTimeout without data, or when slower
+	// than minThroughput bytes/s over the whole file (0 = no limit)
+	idleTimeout   time.Duration
+	minThroughput int64
 }
 
 // NewDownloader creates a new Downloader
@@ -29,6 +43,7 @@ func NewDownloader(
 	logger *zap.Logger,
 	maxCacheSize int64,
 	progressInterval time.Duration,
+	officeExport string,
 ) *Downloader {
 	if progressInterval == 0 {
 		progressInterval = 10 * time.Second
@@ -40,12 +55,30 @@ func NewDownloader(
 		logger:           logger,
 		maxCacheSize:     maxCacheSize,
 		progressInterval: progressInterval,
+		officeExport:     officeExport,
 	}
 }
 
 // DownloadWithTask downloads a file using task for state tracking
-// Returns DownloadResult on success, which the caller should use to update the file record
+// Returns DownloadResult on success, which the caller should use to update the file record.
+// A download that stalls or runs too long fails with a retryable error and
+// keeps its partial file for resuming.
 func (d *Downloader) DownloadWithTask(ctx context.Context, file *domain.File, task *domain.DownloadTask) (*domain.DownloadResult, error) {
+	watchCtx, watch := d.watch(ctx, file, task)
+	defer watch.stop()
+
+	result, err := d.download(watchCtx, file, task, watch)
+	if cause := context.Cause(watchCtx); err != nil && ctx.Err() == nil && errors.Is(cause, errDownloadTimeout) {
+		d.logger.Warn("download timed out",
+			zap.String("path", file.Path),
+			zap.Error(cause))
+		return nil, fmt.Errorf("download failed: %w", cause)
+	}
+	return result, err
+}
+
+// download fetches file, reporting received data to watch
+func (d *Downloader) download(ctx context.Context, file *domain.File, task *domain.DownloadTask, watch *downloadWatchdog) (*domain.DownloadResult, error) {
 	d.logger.Debug("downloading file",
 		zap.String("path", file.Path),
 		zap.Int("priority", file.Priority),
@@ -66,6 +99,14 @@ func (d *Downloader) DownloadWithTask(ctx context.Context, file *domain.File, ta
 		return nil, fmt.Errorf("file size (%d bytes) exceeds max cache size (%d bytes)", file.Size, d.maxCacheSize)
 	}
 
+	// Office documents are converted on the NAS; exports cannot be resumed
+	exportFormat := domain.OfficeExportFormat(file.Path, d.officeExport)
+	if exportFormat != "" && task.TempFilePath != "" {
+		d.fs.DeleteTempFile(task.TempFilePath)
+		task.BytesDownloaded = 0
+		task.TempFilePath = ""
+	}
+
 	// Check for resume
 	var body io.ReadCloser
 	var resume bool
@@ -95,12 +136,39 @@ func (d *Downloader) DownloadWithTask(ctx context.Context, file *domain.File, ta
 		}
 	}
 
+	if resume {
+		// The DB may not have seen an edit on the NAS yet; appending the rest
+		// of a newer version to the partial file would corrupt the copy
+		changed, err := d.changedSinceSnapshot(ctx, file, task)
+		if errors.Is(err, domain.ErrUpstreamUnavailable) || ctx.Err() != nil {
+			return nil, fmt.Errorf("download failed: %w", err)
+		}
+		if err != nil {
+			d.logger.Warn("cannot check file on the NAS before resuming, starting fresh",
+				zap.String("path", file.Path),
+				zap.Error(err))
+		} else if changed {
+			d.logger.Info("file changed on the NAS since last attempt, starting fresh",
+				zap.String("path", file.Path))
+		}
+		if err != nil || changed {
+			d.fs.DeleteTempFile(tempPath)
+			resume = false
+			task.BytesDownloaded = 0
+			task.TempFilePath = ""
+		}
+	}
+
 	if resume {
 		d.logger.Info("resuming download",
 			zap.String("path", file.Path),
 			zap.Int64("from_byte", task.BytesDownloaded))
 
-		body, _, _, err = d.drive.DownloadFileWithRange(0, file.Path, task.BytesDownloaded)
+		body, _, _, err = d.drive.DownloadFileWithRange(ctx, 0, file.Path, task.BytesDownloaded)
+		if errors.Is(err, domain.ErrUpstreamUnavailable) || ctx.Err() != nil {
+			// Keep the partial file for when the NAS is back
+			return nil, fmt.Errorf("download failed: %w", err)
+		}
 		if err != nil {
 			// Range request failed, try fresh download
 			d.logger.Warn("resume failed, starting fresh",
@@ -112,18 +180,35 @@ func (d *Downloader) DownloadWithTask(ctx context.Context, file *domain.File, ta
 		}
 	}
 
+	if !resume && exportFormat == "" && d.segmented(file.Size) {
+		result, err := d.downloadSegmented(ctx, file, task, watch)
+		if !errors.Is(err, errRangeIgnored) {
+			return result, err
+		}
+		d.logger.Warn("NAS ignored range request, downloading in one stream",
+			zap.String("path", file.Path))
+	}
+
 	if !resume {
-		body, _, _, err = d.drive.DownloadFile(0, file.Path)
+		if exportFormat != "" {
+			body, _, _, err = d.drive.ExportOfficeFile(ctx, 0, file.Path, exportFormat)
+		} else {
+			body, _, _, err = d.drive.DownloadFile(ctx, 0, file.Path)
+		}
 		if err != nil {
 			return nil, fmt.Errorf("download failed: %w", err)
 		}
 
-		tempPath = d.fs.CachePath(file.Path) + ".downloading"
+		tempPath = d.fs.TempPath(file.Path)
 		task.TempFilePath = tempPath
 		task.BytesDownloaded = 0
 	}
 	defer body.Close()
 
+	// Closing the body unblocks a stalled read when the download is aborted
+	stopAbort := context.AfterFunc(ctx, func() { body.Close() })
+	defer stopAbort()
+
 	// Update task with temp path
 	if err := d.tasks.UpdateProgress(task.ID, task.BytesDownloaded, tempPath); err != nil {
 		d.logger.Warn("failed to update task progress",
@@ -133,13 +218,16 @@ func (d *Downloader) DownloadWithTask(ctx context.Context, file *domain.File, ta
 
 	// Create progress tracking wrapper
 	progressReader := &progressReader{
-		reader:        body,
-		taskID:        task.ID,
-		tasks:         d.tasks,
-		tempPath:      tempPath,
-		initialBytes:  task.BytesDownloaded,
-		interval:      d.progressInterval,
-		lastUpdate:    time.Now(),
+		ctx:          ctx,
+		reader:       body,
+		taskID:       task.ID,
+		tasks:        d.tasks,
+		tempPath:     tempPath,
+		initialBytes: task.BytesDownloaded,
+		interval:     d.progressInterval,
+		lastUpdate:   time.Now(),
+		stats:        d.stats,
+		watch:        watch,
 	}
 
 	// Write to cache
@@ -148,6 +236,12 @@ func (d *Downloader) DownloadWithTask(ctx context.Context, file *domain.File, ta
 		// Update progress before returning error
 		if actualSize, _, sizeErr := d.fs.GetTempFileInfo(tempPath); sizeErr == nil {
 			d.tasks.UpdateProgress(task.ID, actualSize, tempPath)
+		} else {
+			// Wiped by an encrypted cache, the next attempt starts over
+			d.tasks.UpdateProgress(task.ID, 0, "")
+		}
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("download interrupted: %w", ctx.Err())
 		}
 		return nil, fmt.Errorf("write failed: %w", err)
 	}
@@ -165,6 +259,7 @@ func (d *Downloader) DownloadWithTask(ctx context.Context, file *domain.File, ta
 	} else {
 		d.logger.Info("file cached",
 			zap.String("path", file.Path),
+			zap.String("export_format", exportFormat),
 			zap.Int64("size", written))
 	}
 
@@ -173,11 +268,41 @@ func (d *Downloader) DownloadWithTask(ctx context.Context, file *domain.File, ta
 		BytesWritten: written,
 		Resumed:      resume,
 		ResumedFrom:  resumedFrom,
+		ExportFormat: exportFormat,
 	}, nil
 }
 
+// changedSinceSnapshot asks the NAS whether the file still has the size and
+// modification time the partial download was started for. A changed file's
+// record takes the NAS's values, so the fresh copy is not invalidated by the
+// next sync.
+func (d *Downloader) changedSinceSnapshot(ctx context.Context, file *domain.File, task *domain.DownloadTask) (bool, error) {
+	info, err := d.drive.GetFileInfo(ctx, file.Path)
+	if err != nil {
+		return false, err
+	}
+
+	size := task.Size
+	if size == 0 {
+		size = file.Size
+	}
+	changed := info.Size != size
+	mtime := info.GetMTime()
+	if mtime != nil && file.ModifiedAt != nil && mtime.Unix() != file.ModifiedAt.Unix() {
+		changed = true
+	}
+	if changed {
+		file.Size = info.Size
+		if mtime != nil {
+			file.ModifiedAt = mtime
+		}
+	}
+	return changed, nil
+}
+
 // progressReader wraps a reader to report download progress
 type progressReader struct {
+	ctx          context.Context
 	reader       io.Reader
 	taskID       int64
 	tasks        port.DownloadTaskRepository
@@ -186,11 +311,20 @@ type progressReader struct {
 	bytesRead    int64
 	interval     time.Duration
 	lastUpdate   time.Time
+	stats        *stats.Counters
+	watch        *downloadWatchdog
 }
 
 func (r *progressReader) Read(p []byte) (int, error) {
+	// Stop at a read boundary so everything read so far is written out
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+
 	n, err := r.reader.Read(p)
 	r.bytesRead += int64(n)
+	r.stats.RecordDownload(int64(n))
+	r.watch.received(n)
 
 	// Periodically update progress
 	if time.Since(r.lastUpdate) >= r.interval {
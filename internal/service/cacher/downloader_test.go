@@ -0,0 +1,83 @@
+package cacher
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+)
+
+func TestProgressReader_StopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	r := &progressReader{
+		ctx:        ctx,
+		reader:     strings.NewReader("0123456789"),
+		interval:   time.Hour,
+		lastUpdate: time.Now(),
+	}
+
+	buf := make([]byte, 4)
+	if n, err := r.Read(buf); n != 4 || err != nil {
+		t.Fatalf("Read() = %d, %v; want 4, nil", n, err)
+	}
+
+	cancel()
+
+	if _, err := r.Read(buf); !errors.Is(err, context.Canceled) {
+		t.Errorf("Read() after cancel error = %v, want context.Canceled", err)
+	}
+	if r.bytesRead != 4 {
+		t.Errorf("bytesRead = %d, want 4", r.bytesRead)
+	}
+
+	// io.Copy surfaces the cancellation so the write is aborted
+	if _, err := io.Copy(io.Discard, r); !errors.Is(err, context.Canceled) {
+		t.Errorf("io.Copy() error = %v, want context.Canceled", err)
+	}
+}
+
+func TestMaxDownloadDuration(t *testing.T) {
+	d := &Downloader{minThroughput: 1024 * 1024}
+
+	if got, want := d.maxDownloadDuration(60*1024*1024, 0), downloadTimeoutGrace+time.Minute; got != want {
+		t.Errorf("maxDownloadDuration(60MB) = %s, want %s", got, want)
+	}
+	// A retry gets more time
+	if got, want := d.maxDownloadDuration(60*1024*1024, 2), 3*(downloadTimeoutGrace+time.Minute); got != want {
+		t.Errorf("maxDownloadDuration(60MB, retry 2) = %s, want %s", got, want)
+	}
+
+	d.minThroughput = 0
+	if got := d.maxDownloadDuration(60*1024*1024, 0); got != 0 {
+		t.Errorf("maxDownloadDuration() without a minimum throughput = %s, want 0", got)
+	}
+}
+
+func TestDownloadWatchdog_Idle(t *testing.T) {
+	d := &Downloader{idleTimeout: 50 * time.Millisecond}
+	ctx, watch := d.watch(context.Background(), &domain.File{Size: 10}, &domain.DownloadTask{})
+	defer watch.stop()
+
+	// Data keeps the download alive
+	for i := 0; i < 5; i++ {
+		time.Sleep(20 * time.Millisecond)
+		watch.touch()
+	}
+	if ctx.Err() != nil {
+		t.Fatal("download aborted while receiving data")
+	}
+
+	select {
+	case <-ctx.Done():
+		if !errors.Is(context.Cause(ctx), errDownloadTimeout) {
+			t.Errorf("cause = %v, want errDownloadTimeout", context.Cause(ctx))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("stalled download not aborted")
+	}
+}
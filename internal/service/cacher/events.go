@@ -0,0 +1,57 @@
+package cacher
+
+import (
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/port"
+)
+
+// EnableEvents publishes task.started, task.completed, task.failed,
+// file.cached and file.evicted events
+func (c *Cacher) EnableEvents(events port.EventPublisher) {
+	c.events = events
+	c.evictor.events = events
+}
+
+// publishTask publishes an event about task
+func (c *Cacher) publishTask(eventType string, task *domain.DownloadTask) {
+	if c.events == nil {
+		return
+	}
+	c.events.Publish(domain.Event{
+		Type:   eventType,
+		TaskID: task.ID,
+		FileID: task.FileID,
+		Path:   task.SynoPath,
+		Size:   task.Size,
+	})
+}
+
+// publishFailed publishes task.failed; retry tells whether the task is
+// attempted again later
+func (c *Cacher) publishFailed(task *domain.DownloadTask, err error, retry bool) {
+	if c.events == nil {
+		return
+	}
+	c.events.Publish(domain.Event{
+		Type:   domain.EventTaskFailed,
+		TaskID: task.ID,
+		FileID: task.FileID,
+		Path:   task.SynoPath,
+		Size:   task.Size,
+		Error:  err.Error(),
+		Retry:  retry,
+	})
+}
+
+// publishFile publishes an event about file
+func publishFile(events port.EventPublisher, eventType string, file *domain.File) {
+	if events == nil {
+		return
+	}
+	events.Publish(domain.Event{
+		Type:   eventType,
+		FileID: file.ID,
+		Path:   file.Path,
+		Size:   file.Size,
+	})
+}
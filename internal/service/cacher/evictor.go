@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
 	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"github.com/vertextoedge/synology-file-cache/internal/util/inuse"
 	"github.com/vertextoedge/synology-file-cache/internal/util/ratelimiter"
 	"go.uber.org/zap"
 )
@@ -16,24 +18,33 @@ type Evictor struct {
 	tasks        port.DownloadTaskRepository
 	fs           port.FileSystem
 	spaceManager port.SpaceManager
+	blobs        *blobStore
 	logger       *zap.Logger
 	limiter      *ratelimiter.Limiter
 	batchSize    int
+	policy       domain.EvictionPolicy
+	events       port.EventPublisher // nil unless events are streamed
+	readers      *inuse.Tracker      // nil unless open readers are tracked
 }
 
 // NewEvictor creates a new Evictor
-func NewEvictor(files port.FileRepository, tasks port.DownloadTaskRepository, fs port.FileSystem, spaceManager port.SpaceManager, logger *zap.Logger, evictionInterval time.Duration, batchSize int) *Evictor {
+func NewEvictor(files port.FileRepository, tasks port.DownloadTaskRepository, fs port.FileSystem, spaceManager port.SpaceManager, blobs *blobStore, logger *zap.Logger, evictionInterval time.Duration, batchSize int, policy domain.EvictionPolicy) *Evictor {
 	if batchSize <= 0 {
 		batchSize = 10
 	}
+	if policy == "" {
+		policy = domain.EvictionLRU
+	}
 	return &Evictor{
 		files:        files,
 		tasks:        tasks,
 		fs:           fs,
 		spaceManager: spaceManager,
+		blobs:        blobs,
 		logger:       logger,
 		limiter:      ratelimiter.New(evictionInterval),
 		batchSize:    batchSize,
+		policy:       policy,
 	}
 }
 
@@ -87,91 +98,238 @@ func (e *Evictor) evictUntilSpace(ctx context.Context, neededBytes int64, maxCac
 		}
 	}
 
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
+	// Check if we have enough space before looking at candidates
+	space, err := e.spaceManager.CheckSpace(neededBytes)
+	if err != nil {
+		return err
+	}
+	trashEmptied := false
+	if !space.HasSpace && space.LimitedByDiskUsage {
+		trashEmptied = true
+		if space, err = e.emptyTrash(neededBytes); err != nil {
+			return err
+		}
+	}
+	if space.HasSpace {
+		e.logger.Info("eviction completed",
+			zap.Int("evicted_count", evictedCount),
+			zap.Int64("evicted_bytes", evictedBytes))
+		return nil
+	}
+
+	// Stream candidates in eviction order and stop as soon as there is room,
+	// instead of loading them in batches. Copies go to the trash unless the
+	// disk is full, since trashing frees no disk space.
+	candidates := 0
+	var stopErr error
+	err = e.files.ForEachEvictionCandidate(e.policy, func(file *domain.File) bool {
+		if err := ctx.Err(); err != nil {
+			stopErr = err
+			return false
+		}
+		candidates++
+
+		if e.evictFile(file, !space.LimitedByDiskUsage) {
+			evictedCount++
+			evictedBytes += file.Size
 		}
 
-		// Check if we have enough space
-		hasSpace, err := e.spaceManager.HasSpace(neededBytes)
+		// Check if we have enough space after each eviction (early termination)
+		space, err = e.spaceManager.CheckSpace(neededBytes)
+		if err == nil && !space.HasSpace && space.LimitedByDiskUsage && !trashEmptied {
+			trashEmptied = true
+			space, err = e.emptyTrash(neededBytes)
+		}
 		if err != nil {
-			return err
+			stopErr = err
+			return false
 		}
-		if hasSpace {
-			e.logger.Info("eviction completed",
+		return !space.HasSpace
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get eviction candidates: %w", err)
+	}
+	if stopErr != nil {
+		return stopErr
+	}
+
+	if space.HasSpace {
+		e.logger.Info("eviction completed (early termination)",
+			zap.Int("evicted_count", evictedCount),
+			zap.Int64("evicted_bytes", evictedBytes))
+		return nil
+	}
+
+	// Blobs orphaned by invalidated files are not eviction candidates
+	if e.blobs.collect() > 0 {
+		if hasSpace, err := e.spaceManager.HasSpace(neededBytes); err == nil && hasSpace {
+			e.logger.Info("eviction completed after deleting unreferenced blobs",
 				zap.Int("evicted_count", evictedCount),
 				zap.Int64("evicted_bytes", evictedBytes))
 			return nil
 		}
+	}
 
-		// Get batch of candidates for eviction
-		candidates, err := e.files.GetEvictionCandidates(e.batchSize)
-		if err != nil {
-			return fmt.Errorf("failed to get eviction candidates: %w", err)
+	// Log current space situation for debugging
+	cacheSize, _ := e.fs.GetCacheSize()
+	usage, _ := e.fs.GetDiskUsage()
+	if candidates == 0 {
+		e.logger.Warn("no eviction candidates - disk may be full with non-cache files",
+			zap.Int64("cache_size_bytes", cacheSize),
+			zap.Int64("max_cache_size", maxCacheSize),
+			zap.Float64("disk_used_pct", usage.UsedPct),
+			zap.Float64("max_disk_pct", maxDiskUsagePct),
+			zap.Int64("needed_bytes", neededBytes))
+		return fmt.Errorf("no eviction candidates available (cache has no files to evict)")
+	}
+
+	e.logger.Warn("evicted all candidates without freeing enough space",
+		zap.Int("evicted_count", evictedCount),
+		zap.Int64("evicted_bytes", evictedBytes),
+		zap.Int64("cache_size_bytes", cacheSize),
+		zap.Float64("disk_used_pct", usage.UsedPct),
+		zap.Int64("needed_bytes", neededBytes))
+	return fmt.Errorf("not enough space after evicting %d of %d candidates", evictedCount, candidates)
+}
+
+// emptyTrash deletes all trashed copies to free disk space and checks the
+// space again
+func (e *Evictor) emptyTrash(neededBytes int64) (*port.SpaceCheckResult, error) {
+	freed, err := e.fs.EmptyTrash()
+	if err != nil {
+		e.logger.Warn("failed to empty trash", zap.Error(err))
+	} else if freed > 0 {
+		e.logger.Info("emptied trash to free disk space", zap.Int64("freed_bytes", freed))
+	}
+	return e.spaceManager.CheckSpace(neededBytes)
+}
+
+// evictFile removes a cached file, moving it to the trash if trash is set,
+// and marks it uncached. The file is marked as evicting first, so it is no
+// longer served while it is removed and a crash before the final update is
+// reconciled on startup. Copies a client is still reading are kept.
+func (e *Evictor) evictFile(file *domain.File, trash bool) bool {
+	if e.readers.InUse(file.CachePath) {
+		e.logger.Debug("not evicting file being served",
+			zap.String("path", file.Path))
+		return false
+	}
+
+	file.BeginEviction()
+	if err := e.files.Update(file); err != nil {
+		e.logger.Error("failed to mark file as evicting",
+			zap.String("path", file.Path),
+			zap.Error(err))
+		return false
+	}
+
+	if file.CachePath != "" {
+		// A deduplicated copy is kept while other files still use it
+		if err := e.blobs.release(file.CachePath, trash); err != nil {
+			// Left in the evicting state; the delete is retried on the next start
+			e.logger.Error("failed to delete cached file",
+				zap.String("path", file.CachePath),
+				zap.Error(err))
+			return false
+		}
+	}
+
+	// Update database
+	file.InvalidateCache()
+
+	if err := e.files.Update(file); err != nil {
+		e.logger.Error("failed to update file after eviction",
+			zap.String("path", file.Path),
+			zap.Error(err))
+		return false
+	}
+
+	e.logger.Debug("file evicted",
+		zap.String("path", file.Path),
+		zap.Int("priority", file.Priority),
+		zap.Int64("size", file.Size))
+	publishFile(e.events, domain.EventFileEvicted, file)
+	return true
+}
+
+// EnforceQuotas evicts the least important files of every owner and label
+// whose cached size exceeds the quota
+func (e *Evictor) EnforceQuotas(ctx context.Context, quota domain.Quota) error {
+	usage, err := e.files.GetQuotaUsage(false)
+	if err != nil {
+		return fmt.Errorf("failed to get quota usage: %w", err)
+	}
+
+	if quota.OwnerBytes > 0 {
+		for owner := range usage.ByOwner {
+			used := func() int64 { return usage.ByOwner[owner] }
+			if err := e.evictOverQuota(ctx, usage, "owner", owner, quota.OwnerBytes, used, e.files.GetEvictionCandidatesByOwner); err != nil {
+				return err
+			}
 		}
+	}
+
+	if quota.LabelBytes > 0 {
+		for label := range usage.ByLabel {
+			used := func() int64 { return usage.ByLabel[label] }
+			if err := e.evictOverQuota(ctx, usage, "label", label, quota.LabelBytes, used, e.files.GetEvictionCandidatesByLabel); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// evictOverQuota evicts candidates of one owner or label until used() is within limit
+func (e *Evictor) evictOverQuota(
+	ctx context.Context,
+	usage *domain.QuotaUsage,
+	scope, name string,
+	limit int64,
+	used func() int64,
+	candidates func(policy domain.EvictionPolicy, name string, limit int) ([]*domain.File, error),
+) error {
+	if used() <= limit {
+		return nil
+	}
 
-		if len(candidates) == 0 {
-			// Log current space situation for debugging
-			cacheSize, _ := e.fs.GetCacheSize()
-			usage, _ := e.fs.GetDiskUsage()
-			e.logger.Warn("no eviction candidates - disk may be full with non-cache files",
-				zap.Int64("cache_size_bytes", cacheSize),
-				zap.Int64("max_cache_size", maxCacheSize),
-				zap.Float64("disk_used_pct", usage.UsedPct),
-				zap.Float64("max_disk_pct", maxDiskUsagePct),
-				zap.Int64("needed_bytes", neededBytes))
-			return fmt.Errorf("no eviction candidates available (cache has no files to evict)")
+	e.logger.Info("quota exceeded, evicting",
+		zap.String(scope, name),
+		zap.Int64("used_bytes", used()),
+		zap.Int64("quota_bytes", limit))
+
+	for used() > limit {
+		batch, err := candidates(e.policy, name, e.batchSize)
+		if err != nil {
+			return fmt.Errorf("failed to get eviction candidates: %w", err)
 		}
 
-		// Process batch of candidates
-		for _, file := range candidates {
+		evicted := 0
+		for _, file := range batch {
 			select {
 			case <-ctx.Done():
 				return ctx.Err()
 			default:
 			}
 
-			// Check if we have enough space after each eviction (early termination)
-			hasSpace, err := e.spaceManager.HasSpace(neededBytes)
-			if err != nil {
-				return err
-			}
-			if hasSpace {
-				e.logger.Info("eviction completed (early termination)",
-					zap.Int("evicted_count", evictedCount),
-					zap.Int64("evicted_bytes", evictedBytes))
-				return nil
-			}
-
-			// Evict file
-			if file.CachePath != "" {
-				fileSize := file.Size
-				if err := e.fs.DeleteFile(file.CachePath); err != nil {
-					e.logger.Error("failed to delete cached file",
-						zap.String("path", file.CachePath),
-						zap.Error(err))
-					continue
-				}
-				evictedBytes += fileSize
+			if used() <= limit {
+				break
 			}
-
-			// Update database
-			file.InvalidateCache()
-
-			if err := e.files.Update(file); err != nil {
-				e.logger.Error("failed to update file after eviction",
-					zap.String("path", file.Path),
-					zap.Error(err))
-				continue
+			if e.evictFile(file, true) {
+				usage.Add(file.Owner, file.Labels, -file.Size)
+				evicted++
 			}
+		}
 
-			evictedCount++
-			e.logger.Debug("file evicted",
-				zap.String("path", file.Path),
-				zap.Int("priority", file.Priority),
-				zap.Int64("size", file.Size))
+		if evicted == 0 {
+			// Only pinned files left, or deletes keep failing
+			e.logger.Warn("cannot evict enough files to meet quota",
+				zap.String(scope, name),
+				zap.Int64("used_bytes", used()),
+				zap.Int64("quota_bytes", limit))
+			return nil
 		}
 	}
+	return nil
 }
@@ -0,0 +1,27 @@
+package cacher
+
+import (
+	"testing"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/util/inuse"
+	"go.uber.org/zap"
+)
+
+func TestEvictor_KeepsFilesBeingServed(t *testing.T) {
+	readers := inuse.New()
+	// No repository: a file being served must not even be marked as evicting
+	e := &Evictor{logger: zap.NewNop(), readers: readers}
+
+	file := &domain.File{ID: 1, Path: "/a.txt"}
+	file.MarkCached("/cache/a.txt")
+	release := readers.Acquire("/cache/a.txt")
+	defer release()
+
+	if e.evictFile(file, false) {
+		t.Fatal("evictFile() evicted a file being served")
+	}
+	if !file.Cached || file.CachePath != "/cache/a.txt" {
+		t.Errorf("file = cached %v, path %q; want it untouched", file.Cached, file.CachePath)
+	}
+}
@@ -0,0 +1,58 @@
+package cacher
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+// flight is a file being cached, shared by every caller caching it at once
+type flight struct {
+	done     chan struct{}
+	err      error
+	canceled bool // The caller running it gave up; a waiter runs it again
+}
+
+// cacheOnce runs cache for a file unless another caller is already caching
+// it, in which case it waits for that run and returns its result, so a file
+// is never downloaded twice at the same time. If the running caller's
+// context ended before it finished (shutdown, lost task lease), a waiter
+// runs cache itself instead of sharing the cancellation.
+func (c *Cacher) cacheOnce(ctx context.Context, fileID int64, path string, cache func() error) error {
+	for {
+		c.flightsMu.Lock()
+		f, ok := c.flights[fileID]
+		if !ok {
+			f = &flight{done: make(chan struct{})}
+			c.flights[fileID] = f
+			c.flightsMu.Unlock()
+			return c.runFlight(ctx, fileID, f, cache)
+		}
+		c.flightsMu.Unlock()
+
+		c.logger.Info("file is already being cached, waiting for it",
+			zap.String("path", path))
+		select {
+		case <-f.done:
+			if !f.canceled {
+				return f.err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// runFlight runs cache for f and hands its result to the waiters
+func (c *Cacher) runFlight(ctx context.Context, fileID int64, f *flight, cache func() error) error {
+	defer func() {
+		c.flightsMu.Lock()
+		delete(c.flights, fileID)
+		c.flightsMu.Unlock()
+		close(f.done)
+	}()
+
+	f.err = cache()
+	f.canceled = f.err != nil && ctx.Err() != nil
+	return f.err
+}
@@ -0,0 +1,81 @@
+package cacher
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestCacheOnce_Shared(t *testing.T) {
+	c := &Cacher{logger: zap.NewNop(), flights: make(map[int64]*flight)}
+	errFailed := errors.New("download failed")
+
+	var runs atomic.Int32
+	release := make(chan struct{})
+	cache := func() error {
+		runs.Add(1)
+		<-release
+		return errFailed
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, 3)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = c.cacheOnce(context.Background(), 1, "/a", cache)
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if runs.Load() != 1 {
+		t.Errorf("cache ran %d times, want 1", runs.Load())
+	}
+	for i, err := range errs {
+		if !errors.Is(err, errFailed) {
+			t.Errorf("caller %d error = %v, want the shared error", i, err)
+		}
+	}
+	if len(c.flights) != 0 {
+		t.Errorf("%d flights left", len(c.flights))
+	}
+}
+
+func TestCacheOnce_CanceledLeader(t *testing.T) {
+	c := &Cacher{logger: zap.NewNop(), flights: make(map[int64]*flight)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	leaderDone := make(chan error)
+	go func() {
+		leaderDone <- c.cacheOnce(ctx, 1, "/a", func() error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		})
+	}()
+	<-started
+
+	waiterDone := make(chan error)
+	go func() {
+		waiterDone <- c.cacheOnce(context.Background(), 1, "/a", func() error { return nil })
+	}()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	if err := <-leaderDone; !errors.Is(err, context.Canceled) {
+		t.Errorf("leader error = %v, want canceled", err)
+	}
+	// The waiter caches the file itself instead of sharing the cancellation
+	if err := <-waiterDone; err != nil {
+		t.Errorf("waiter error = %v", err)
+	}
+}
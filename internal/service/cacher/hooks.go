@@ -0,0 +1,91 @@
+package cacher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"go.uber.org/zap"
+)
+
+// EnablePreServeHooks runs hooks, e.g. a virus scanner, on every downloaded
+// or restored copy before the file is marked cached. A copy a hook rejects is
+// quarantined and the file is marked rejected; its task fails without
+// retrying. A hook that fails to run retries the task like a failed download.
+func (c *Cacher) EnablePreServeHooks(hooks ...port.PreServeHook) {
+	c.hooks = hooks
+}
+
+// inspect runs the pre-serve hooks on the copy of file at path in order,
+// stopping at the first error
+func (c *Cacher) inspect(ctx context.Context, file *domain.File, path string) error {
+	if len(c.hooks) == 0 {
+		return nil
+	}
+
+	body, err := c.fs.OpenCached(path)
+	if err != nil {
+		return fmt.Errorf("failed to open file for inspection: %w", err)
+	}
+	defer body.Close()
+
+	for _, hook := range c.hooks {
+		if _, err := body.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		if err := hook.Inspect(ctx, file, body); err != nil {
+			if errors.Is(err, domain.ErrFileRejected) {
+				return err
+			}
+			return fmt.Errorf("%s hook failed: %w", hook.Name(), err)
+		}
+	}
+	return nil
+}
+
+// reject quarantines a downloaded copy a pre-serve hook refused and marks the
+// file rejected, so syncs don't enqueue it again until it changes on the NAS
+func (c *Cacher) reject(file *domain.File, cachePath string, reason error) {
+	if err := c.fs.QuarantineFile(cachePath); err != nil {
+		c.logger.Warn("failed to quarantine rejected file, deleting it",
+			zap.String("path", file.Path),
+			zap.Error(err))
+		c.fs.DeleteFile(cachePath)
+	}
+
+	file.InvalidateCache()
+	file.RejectedReason = reason.Error()
+	if err := c.files.Update(file); err != nil {
+		c.logger.Warn("failed to mark file rejected",
+			zap.String("path", file.Path),
+			zap.Error(err))
+	}
+}
+
+// RejectCached stops serving a cached file a pre-serve hook refused when it
+// was about to be served. The file is marked rejected and its copy is
+// quarantined, unless another file still references it.
+func (c *Cacher) RejectCached(fileID int64, reason error) error {
+	file, err := c.files.GetByID(fileID)
+	if err != nil {
+		return fmt.Errorf("failed to get file: %w", err)
+	}
+	if file == nil || !file.Cached {
+		return nil
+	}
+
+	cachePath := file.CachePath
+	file.InvalidateCache()
+	file.RejectedReason = reason.Error()
+	if err := c.files.Update(file); err != nil {
+		return fmt.Errorf("failed to mark file rejected: %w", err)
+	}
+
+	c.logger.Warn("cached file rejected, quarantining it",
+		zap.String("path", file.Path),
+		zap.Error(reason))
+	return c.blobs.quarantine(cachePath)
+}
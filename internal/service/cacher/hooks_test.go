@@ -0,0 +1,52 @@
+package cacher
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/port"
+)
+
+// stubHook returns err and counts its calls
+type stubHook struct {
+	err   error
+	calls int
+}
+
+func (h *stubHook) Name() string { return "stub" }
+
+func (h *stubHook) Inspect(ctx context.Context, file *domain.File, body port.CachedFile) error {
+	h.calls++
+	return h.err
+}
+
+func TestCacher_Inspect(t *testing.T) {
+	rejecting := &stubHook{err: &domain.RejectedError{Hook: "stub", Reason: "infected"}}
+	failing := &stubHook{err: errors.New("connection refused")}
+	passing := &stubHook{}
+
+	path := filepath.Join(t.TempDir(), "a")
+	if err := os.WriteFile(path, []byte("content"), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	c := &Cacher{fs: &mockFileSystem{}}
+	c.EnablePreServeHooks(passing, rejecting, failing)
+	err := c.inspect(context.Background(), &domain.File{}, path)
+	if !errors.Is(err, domain.ErrFileRejected) {
+		t.Fatalf("inspect() error = %v, want ErrFileRejected", err)
+	}
+	if passing.calls != 1 || failing.calls != 0 {
+		t.Errorf("calls = %d/%d, want hooks after the rejection skipped", passing.calls, failing.calls)
+	}
+
+	c.EnablePreServeHooks(passing, failing)
+	err = c.inspect(context.Background(), &domain.File{}, path)
+	if err == nil || errors.Is(err, domain.ErrFileRejected) {
+		t.Errorf("inspect() error = %v, want a non-rejection error", err)
+	}
+}
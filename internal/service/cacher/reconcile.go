@@ -0,0 +1,92 @@
+package cacher
+
+import (
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"go.uber.org/zap"
+)
+
+// reconcileCacheStates finishes cache changes interrupted by a crash between
+// the database and the filesystem update. Files left evicting are marked
+// uncached and their copy deleted. Files left caching may have a complete,
+// partial or no copy on disk; they are marked uncached and the copy deleted so
+// the file is downloaded again (a temp file from the interrupted download is
+// resumed). Copies still referenced by other files are kept.
+//
+// It runs after stale tasks are released, so a caching file whose task is
+// still in progress belongs to a live worker of another instance and is skipped.
+func (c *Cacher) reconcileCacheStates() {
+	reconciled := 0
+
+	for _, state := range []string{domain.CacheStateEvicting, domain.CacheStateCaching} {
+		files, err := c.files.GetFilesByCacheState(state)
+		if err != nil {
+			c.logger.Warn("failed to list files to reconcile",
+				zap.String("state", state),
+				zap.Error(err))
+			continue
+		}
+
+		for _, file := range files {
+			if state == domain.CacheStateCaching && c.downloadInProgress(file) {
+				continue
+			}
+			if c.reconcileFile(file) {
+				reconciled++
+			}
+		}
+	}
+
+	if reconciled > 0 {
+		c.logger.Info("reconciled interrupted cache updates", zap.Int("count", reconciled))
+	}
+}
+
+// downloadInProgress reports whether another worker is caching file right now
+func (c *Cacher) downloadInProgress(file *domain.File) bool {
+	task, err := c.tasks.GetTaskByFileID(file.ID)
+	if err != nil {
+		c.logger.Warn("failed to look up download task",
+			zap.String("path", file.Path),
+			zap.Error(err))
+		return true
+	}
+	return task != nil && task.Status == domain.TaskStatusInProgress
+}
+
+// reconcileFile marks file uncached and deletes the copies it may have left:
+// the one at its cache path and, for an interrupted download, the one at its
+// download location (they differ when the copy was being moved to a blob).
+// A copy left behind if this fails is collected with the unreferenced blobs
+// or overwritten by the next download.
+func (c *Cacher) reconcileFile(file *domain.File) bool {
+	state := file.CacheState
+	paths := []string{file.CachePath}
+	if state == domain.CacheStateCaching {
+		paths = append(paths, c.fs.CachePath(file.Path))
+	}
+
+	file.InvalidateCache()
+	if err := c.files.Update(file); err != nil {
+		c.logger.Warn("failed to reconcile file",
+			zap.String("path", file.Path),
+			zap.Error(err))
+		return false
+	}
+
+	for _, cachePath := range paths {
+		if cachePath == "" {
+			continue
+		}
+		if err := c.blobs.release(cachePath, false); err != nil {
+			c.logger.Warn("failed to delete file left by interrupted cache update",
+				zap.String("path", cachePath),
+				zap.String("state", state),
+				zap.Error(err))
+		}
+	}
+
+	c.logger.Debug("reconciled interrupted cache update",
+		zap.String("path", file.Path),
+		zap.String("state", state))
+	return true
+}
@@ -0,0 +1,156 @@
+package cacher
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vertextoedge/synology-file-cache/internal/adapter/filesystem"
+	"github.com/vertextoedge/synology-file-cache/internal/adapter/sqlite"
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"go.uber.org/zap"
+)
+
+// newTestCacher creates a Cacher on a fresh SQLite store and cache directory
+func newTestCacher(t *testing.T) (*Cacher, *sqlite.Store, *filesystem.Manager) {
+	t.Helper()
+	dir := t.TempDir()
+	store, err := sqlite.Open(filepath.Join(dir, "cache.db"), sqlite.Options{})
+	if err != nil {
+		t.Fatalf("sqlite.Open() error = %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	fs, err := filesystem.NewManager(filepath.Join(dir, "cache"))
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	return New(DefaultConfig(), nil, store, store, fs, zap.NewNop()), store, fs
+}
+
+// addFile stores a file at path whose row points at cachePath. state is a
+// cache state, or "cached" for a file that is served from cachePath.
+func addFile(t *testing.T, store *sqlite.Store, path, state, cachePath string) *domain.File {
+	t.Helper()
+	result, err := store.UpsertBySynoID(&domain.File{
+		SynoFileID: path,
+		Path:       path,
+		Priority:   domain.PriorityDefault,
+	})
+	if err != nil {
+		t.Fatalf("UpsertBySynoID() error = %v", err)
+	}
+	file := result.File
+	switch state {
+	case "cached":
+		file.MarkCached(cachePath)
+	case domain.CacheStateCaching:
+		file.BeginCaching(cachePath)
+	case domain.CacheStateEvicting:
+		file.MarkCached(cachePath)
+		file.BeginEviction()
+	}
+	if err := store.Update(file); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	return file
+}
+
+// writeCopy writes content to path, creating its directory
+func writeCopy(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// exists reports whether a file exists at path
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestCacher_ReconcileCacheStates(t *testing.T) {
+	const path = "/mydrive/a.txt"
+
+	tests := []struct {
+		name       string
+		state      string
+		blob       bool // The row points at a blob instead of the download location
+		onDisk     bool // A copy exists where the row points
+		downloaded bool // A copy exists at the download location of a blob row
+		partial    bool // A temp file of the download exists
+		sharedWith bool // Another cached file uses the same copy
+		inProgress bool // The download task is claimed by a live worker
+		reconciled bool
+		kept       bool // The copy the row pointed at is still on disk
+	}{
+		{name: "evicting, copy on disk", state: domain.CacheStateEvicting, onDisk: true, reconciled: true},
+		{name: "evicting, copy already deleted", state: domain.CacheStateEvicting, reconciled: true},
+		{name: "evicting blob, used by another file", state: domain.CacheStateEvicting, blob: true, onDisk: true, sharedWith: true, reconciled: true, kept: true},
+		{name: "caching, nothing downloaded", state: domain.CacheStateCaching, reconciled: true},
+		{name: "caching, partial download", state: domain.CacheStateCaching, partial: true, reconciled: true},
+		{name: "caching, download committed", state: domain.CacheStateCaching, onDisk: true, reconciled: true},
+		{name: "caching blob, copy not moved yet", state: domain.CacheStateCaching, blob: true, downloaded: true, reconciled: true},
+		{name: "caching blob, copy moved", state: domain.CacheStateCaching, blob: true, onDisk: true, reconciled: true},
+		{name: "caching blob, used by another file", state: domain.CacheStateCaching, blob: true, onDisk: true, sharedWith: true, reconciled: true, kept: true},
+		{name: "caching, download in progress", state: domain.CacheStateCaching, onDisk: true, inProgress: true, kept: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, store, fs := newTestCacher(t)
+
+			cachePath := fs.CachePath(path)
+			if tt.blob {
+				cachePath = fs.BlobPath("0123abcd")
+			}
+			if tt.onDisk {
+				writeCopy(t, cachePath, "content")
+			}
+			if tt.downloaded {
+				writeCopy(t, fs.CachePath(path), "content")
+			}
+			if tt.partial {
+				writeCopy(t, fs.TempPath(path), "cont")
+			}
+			if tt.sharedWith {
+				addFile(t, store, "/mydrive/b.txt", "cached", cachePath)
+			}
+			file := addFile(t, store, path, tt.state, cachePath)
+			if tt.inProgress {
+				task := &domain.DownloadTask{FileID: file.ID, SynoPath: path, Priority: domain.PriorityDefault}
+				if err := store.CreateTask(task); err != nil {
+					t.Fatalf("CreateTask() error = %v", err)
+				}
+				if _, err := store.ClaimNextTask("other-host:worker-0"); err != nil {
+					t.Fatalf("ClaimNextTask() error = %v", err)
+				}
+			}
+
+			c.reconcileCacheStates()
+
+			got, err := store.GetByID(file.ID)
+			if err != nil {
+				t.Fatalf("GetByID() error = %v", err)
+			}
+			if reconciled := got.CacheState == "" && got.CachePath == ""; reconciled != tt.reconciled {
+				t.Errorf("row = state %q, path %q; want reconciled %v", got.CacheState, got.CachePath, tt.reconciled)
+			}
+			if got.Cached {
+				t.Error("row is cached, want it uncached")
+			}
+			if tt.onDisk && exists(cachePath) != tt.kept {
+				t.Errorf("copy on disk = %v, want %v", exists(cachePath), tt.kept)
+			}
+			if tt.downloaded && exists(fs.CachePath(path)) {
+				t.Error("copy at the download location was not deleted")
+			}
+			if tt.partial && !exists(fs.TempPath(path)) {
+				t.Error("temp file of the download was deleted, want it kept for resuming")
+			}
+		})
+	}
+}
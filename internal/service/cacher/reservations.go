@@ -0,0 +1,39 @@
+package cacher
+
+import (
+	"math"
+	"slices"
+)
+
+// noCeiling lets a worker claim tasks of any priority
+const noCeiling = math.MaxInt32
+
+// Reservation keeps Workers download workers for tasks at MaxPriority or more
+// urgent, so a backlog of less urgent tasks cannot hold up e.g. a newly shared file
+type Reservation struct {
+	MaxPriority int
+	Workers     int
+}
+
+// workerCeilings returns the most relaxed priority each of n workers may claim.
+// Reserved workers are taken from the highest indexes, the most urgent class
+// first, so the workers the space throttle keeps running stay unrestricted. At
+// least one worker is always left unrestricted.
+func workerCeilings(n int, reservations []Reservation) []int {
+	ceilings := make([]int, n)
+	for i := range ceilings {
+		ceilings[i] = noCeiling
+	}
+
+	sorted := slices.Clone(reservations)
+	slices.SortFunc(sorted, func(a, b Reservation) int { return a.MaxPriority - b.MaxPriority })
+
+	next := n - 1
+	for _, r := range sorted {
+		for w := 0; w < r.Workers && next > 0; w++ {
+			ceilings[next] = r.MaxPriority
+			next--
+		}
+	}
+	return ceilings
+}
@@ -0,0 +1,33 @@
+package cacher
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestWorkerCeilings(t *testing.T) {
+	tests := []struct {
+		name         string
+		workers      int
+		reservations []Reservation
+		want         []int
+	}{
+		{"none", 3, nil, []int{noCeiling, noCeiling, noCeiling}},
+		{"one shared worker", 3, []Reservation{{MaxPriority: 1, Workers: 1}}, []int{noCeiling, noCeiling, 1}},
+		{
+			"most urgent class last",
+			4,
+			[]Reservation{{MaxPriority: 2, Workers: 1}, {MaxPriority: 1, Workers: 1}},
+			[]int{noCeiling, noCeiling, 2, 1},
+		},
+		{"one worker stays unrestricted", 2, []Reservation{{MaxPriority: 1, Workers: 5}}, []int{noCeiling, 1}},
+		{"single worker", 1, []Reservation{{MaxPriority: 1, Workers: 1}}, []int{noCeiling}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := workerCeilings(tt.workers, tt.reservations); !slices.Equal(got, tt.want) {
+				t.Errorf("workerCeilings() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
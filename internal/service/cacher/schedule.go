@@ -0,0 +1,79 @@
+package cacher
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DownloadWindow is a daily time range in local time. A window whose end is
+// before its start wraps past midnight, e.g. 22:00-06:00.
+type DownloadWindow struct {
+	Start time.Duration // Offset from midnight
+	End   time.Duration
+}
+
+// ParseDownloadWindows parses "HH:MM-HH:MM" ranges
+func ParseDownloadWindows(specs []string) ([]DownloadWindow, error) {
+	windows := make([]DownloadWindow, 0, len(specs))
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+
+		from, to, ok := strings.Cut(spec, "-")
+		if !ok {
+			return nil, fmt.Errorf("invalid download window %q: expected HH:MM-HH:MM", spec)
+		}
+		start, err := parseClock(from)
+		if err != nil {
+			return nil, fmt.Errorf("invalid download window %q: %w", spec, err)
+		}
+		end, err := parseClock(to)
+		if err != nil {
+			return nil, fmt.Errorf("invalid download window %q: %w", spec, err)
+		}
+		if start == end {
+			return nil, fmt.Errorf("invalid download window %q: start equals end", spec)
+		}
+		windows = append(windows, DownloadWindow{Start: start, End: end})
+	}
+	return windows, nil
+}
+
+// parseClock parses HH:MM into an offset from midnight; 24:00 is allowed as an end
+func parseClock(s string) (time.Duration, error) {
+	var h, m int
+	if _, err := fmt.Sscanf(strings.TrimSpace(s), "%d:%d", &h, &m); err != nil {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	if h < 0 || m < 0 || m > 59 || h > 24 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute, nil
+}
+
+// contains reports whether the time of day t falls within the window
+func (w DownloadWindow) contains(t time.Time) bool {
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second
+	if w.Start < w.End {
+		return offset >= w.Start && offset < w.End
+	}
+	return offset >= w.Start || offset < w.End
+}
+
+// inDownloadWindow reports whether bulk downloads are allowed at t.
+// Without windows downloads are always allowed.
+func inDownloadWindow(windows []DownloadWindow, t time.Time) bool {
+	if len(windows) == 0 {
+		return true
+	}
+	for _, w := range windows {
+		if w.contains(t) {
+			return true
+		}
+	}
+	return false
+}
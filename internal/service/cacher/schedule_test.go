@@ -0,0 +1,50 @@
+package cacher
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDownloadWindows(t *testing.T) {
+	windows, err := ParseDownloadWindows([]string{"01:00-06:00", " 22:30-24:00 "})
+	if err != nil {
+		t.Fatalf("ParseDownloadWindows() error = %v", err)
+	}
+	if len(windows) != 2 || windows[0].Start != time.Hour || windows[1].End != 24*time.Hour {
+		t.Errorf("windows = %+v", windows)
+	}
+
+	for _, spec := range []string{"01:00", "1-6", "25:00-06:00", "01:60-02:00", "03:00-03:00"} {
+		if _, err := ParseDownloadWindows([]string{spec}); err == nil {
+			t.Errorf("ParseDownloadWindows(%q) succeeded, want error", spec)
+		}
+	}
+}
+
+func TestInDownloadWindow(t *testing.T) {
+	at := func(h, m int) time.Time { return time.Date(2026, 1, 1, h, m, 0, 0, time.Local) }
+
+	offPeak, _ := ParseDownloadWindows([]string{"01:00-06:00"})
+	overnight, _ := ParseDownloadWindows([]string{"22:00-02:00"})
+
+	tests := []struct {
+		name    string
+		windows []DownloadWindow
+		t       time.Time
+		want    bool
+	}{
+		{"no windows", nil, at(12, 0), true},
+		{"inside", offPeak, at(3, 0), true},
+		{"start inclusive", offPeak, at(1, 0), true},
+		{"end exclusive", offPeak, at(6, 0), false},
+		{"outside", offPeak, at(12, 0), false},
+		{"wraps before midnight", overnight, at(23, 0), true},
+		{"wraps after midnight", overnight, at(1, 30), true},
+		{"outside wrapped", overnight, at(12, 0), false},
+	}
+	for _, tt := range tests {
+		if got := inDownloadWindow(tt.windows, tt.t); got != tt.want {
+			t.Errorf("%s: inDownloadWindow() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
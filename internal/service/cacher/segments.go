@@ -0,0 +1,200 @@
+package cacher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"github.com/vertextoedge/synology-file-cache/internal/service/stats"
+	"go.uber.org/zap"
+)
+
+// errRangeIgnored means the NAS answered a range request with the whole file
+var errRangeIgnored = errors.New("NAS ignored the range request")
+
+// segment is a byte range of a file fetched over its own connection
+type segment struct {
+	start  int64
+	length int64
+}
+
+// splitSegments divides size bytes into n ranges of nearly equal length
+func splitSegments(size int64, n int) []segment {
+	if n < 1 {
+		n = 1
+	}
+	if int64(n) > size {
+		n = int(max(size, 1))
+	}
+
+	segments := make([]segment, 0, n)
+	base, extra := size/int64(n), size%int64(n)
+	var start int64
+	for i := 0; i < n; i++ {
+		length := base
+		if int64(i) < extra {
+			length++
+		}
+		segments = append(segments, segment{start: start, length: length})
+		start += length
+	}
+	return segments
+}
+
+// segmented reports whether a file is downloaded in parallel segments
+func (d *Downloader) segmented(size int64) bool {
+	return d.segments > 1 && size >= d.segmentMinSize
+}
+
+// downloadSegmented fetches a file over several connections at once, each
+// writing its range into a sparse temp file. Segmented downloads are not
+// resumed: the temp file is deleted when any segment fails. Returns
+// errRangeIgnored when the NAS does not support ranges.
+func (d *Downloader) downloadSegmented(ctx context.Context, file *domain.File, task *domain.DownloadTask, watch *downloadWatchdog) (*domain.DownloadResult, error) {
+	tempPath := d.fs.TempPath(file.Path)
+	out, err := d.fs.CreateSegmentFile(tempPath, file.Size)
+	if err != nil {
+		return nil, fmt.Errorf("write failed: %w", err)
+	}
+
+	// The temp path is not recorded, a sparse file cannot be resumed by size
+	task.BytesDownloaded = 0
+	task.TempFilePath = ""
+	if err := d.tasks.UpdateProgress(task.ID, 0, ""); err != nil {
+		d.logger.Warn("failed to update task progress",
+			zap.String("path", file.Path),
+			zap.Error(err))
+	}
+
+	segments := splitSegments(file.Size, d.segments)
+	d.logger.Info("downloading file in segments",
+		zap.String("path", file.Path),
+		zap.Int64("size", file.Size),
+		zap.Int("segments", len(segments)))
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	var downloaded atomic.Int64
+	stopProgress := d.reportSegmentProgress(ctx, task.ID, &downloaded)
+
+	var wg sync.WaitGroup
+	for _, seg := range segments {
+		wg.Add(1)
+		go func(seg segment) {
+			defer wg.Done()
+			if err := d.downloadSegment(ctx, file, out, seg, &downloaded, watch); err != nil {
+				cancel(err)
+			}
+		}(seg)
+	}
+	wg.Wait()
+	stopProgress()
+
+	err = context.Cause(ctx)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && downloaded.Load() != file.Size {
+		err = fmt.Errorf("downloaded %d bytes, expected %d", downloaded.Load(), file.Size)
+	}
+	if err != nil {
+		d.fs.DeleteTempFile(tempPath)
+		if errors.Is(err, errRangeIgnored) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("download failed: %w", err)
+	}
+
+	cachePath, err := d.fs.CommitTempFile(file.Path, tempPath)
+	if err != nil {
+		d.fs.DeleteTempFile(tempPath)
+		return nil, fmt.Errorf("write failed: %w", err)
+	}
+
+	d.logger.Info("file cached",
+		zap.String("path", file.Path),
+		zap.Int("segments", len(segments)),
+		zap.Int64("size", file.Size))
+
+	return &domain.DownloadResult{
+		CachePath:    cachePath,
+		BytesWritten: file.Size,
+	}, nil
+}
+
+// downloadSegment fetches one range of a file into out
+func (d *Downloader) downloadSegment(ctx context.Context, file *domain.File, out port.SegmentFile, seg segment, downloaded *atomic.Int64, watch *downloadWatchdog) error {
+	body, _, size, err := d.drive.DownloadFileWithRange(ctx, 0, file.Path, seg.start)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	if seg.start > 0 && size == file.Size {
+		return errRangeIgnored
+	}
+
+	// Closing the body unblocks a stalled read when another segment fails
+	stopAbort := context.AfterFunc(ctx, func() { body.Close() })
+	defer stopAbort()
+
+	src := &segmentReader{reader: body, downloaded: downloaded, stats: d.stats, watch: watch}
+	n, err := io.CopyN(io.NewOffsetWriter(out, seg.start), src, seg.length)
+	if err != nil {
+		if ctx.Err() != nil {
+			return context.Cause(ctx)
+		}
+		return fmt.Errorf("segment at %d failed after %d of %d bytes: %w", seg.start, n, seg.length, err)
+	}
+	return nil
+}
+
+// reportSegmentProgress records the bytes downloaded by all segments every
+// progress interval until the returned function is called
+func (d *Downloader) reportSegmentProgress(ctx context.Context, taskID int64, downloaded *atomic.Int64) func() {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(d.progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				d.tasks.UpdateProgress(taskID, downloaded.Load(), "")
+			case <-ctx.Done():
+				return
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+// segmentReader counts the bytes read by a segment
+type segmentReader struct {
+	reader     io.Reader
+	downloaded *atomic.Int64
+	stats      *stats.Counters
+	watch      *downloadWatchdog
+}
+
+func (r *segmentReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.downloaded.Add(int64(n))
+	r.stats.RecordDownload(int64(n))
+	r.watch.received(n)
+	return n, err
+}
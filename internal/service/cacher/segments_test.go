@@ -0,0 +1,40 @@
+package cacher
+
+import "testing"
+
+func TestSplitSegments(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int64
+		n       int
+		lengths []int64
+	}{
+		{"even", 12, 3, []int64{4, 4, 4}},
+		{"remainder spread over first", 14, 4, []int64{4, 4, 3, 3}},
+		{"more segments than bytes", 2, 4, []int64{1, 1}},
+		{"single", 10, 1, []int64{10}},
+		{"invalid count", 10, 0, []int64{10}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			segments := splitSegments(tt.size, tt.n)
+			if len(segments) != len(tt.lengths) {
+				t.Fatalf("got %d segments, want %d", len(segments), len(tt.lengths))
+			}
+			var next int64
+			for i, seg := range segments {
+				if seg.start != next {
+					t.Errorf("segment %d starts at %d, want %d", i, seg.start, next)
+				}
+				if seg.length != tt.lengths[i] {
+					t.Errorf("segment %d length = %d, want %d", i, seg.length, tt.lengths[i])
+				}
+				next = seg.start + seg.length
+			}
+			if next != tt.size {
+				t.Errorf("segments cover %d bytes, want %d", next, tt.size)
+			}
+		})
+	}
+}
@@ -63,6 +63,26 @@ func (sm *SpaceManager) CheckSpace(fileSize int64) (*port.SpaceCheckResult, erro
 	return result, nil
 }
 
+// HeadroomPercent returns the space left before the tighter of the cache size
+// and disk usage limits is reached, as a percentage of that limit
+func (sm *SpaceManager) HeadroomPercent() (float64, error) {
+	cacheSize, err := sm.fs.GetCacheSize()
+	if err != nil {
+		return 0, err
+	}
+	headroom := 100 * float64(sm.maxCacheSize-cacheSize) / float64(sm.maxCacheSize)
+
+	usage, err := sm.fs.GetDiskUsage()
+	if err != nil {
+		return 0, err
+	}
+	if sm.maxDiskUsagePct > 0 {
+		headroom = min(headroom, 100*(sm.maxDiskUsagePct-usage.UsedPct)/sm.maxDiskUsagePct)
+	}
+
+	return max(headroom, 0), nil
+}
+
 // HasSpace returns true if there's enough space for the given file size
 func (sm *SpaceManager) HasSpace(fileSize int64) (bool, error) {
 	result, err := sm.CheckSpace(fileSize)
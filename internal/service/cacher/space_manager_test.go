@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"github.com/vertextoedge/synology-file-cache/internal/util/cryptfile"
 )
 
 // mockFileSystem implements port.FileSystem for testing
@@ -26,16 +27,40 @@ func (m *mockFileSystem) GetDiskUsage() (*port.DiskUsage, error) {
 // Stub implementations for other FileSystem methods
 func (m *mockFileSystem) RootDir() string                                                          { return "" }
 func (m *mockFileSystem) CachePath(synoPath string) string                                         { return "" }
+func (m *mockFileSystem) TempPath(synoPath string) string                                          { return "" }
 func (m *mockFileSystem) WriteFile(synoPath string, r io.Reader) (string, int64, error)            { return "", 0, nil }
 func (m *mockFileSystem) WriteFileWithResume(synoPath string, r io.Reader, resume bool, tempPath string) (string, int64, error) {
 	return "", 0, nil
 }
+func (m *mockFileSystem) CreateSegmentFile(tempPath string, size int64) (port.SegmentFile, error) {
+	return nil, nil
+}
+func (m *mockFileSystem) CommitTempFile(synoPath, tempPath string) (string, error) { return "", nil }
+func (m *mockFileSystem) OpenCached(path string) (port.CachedFile, error) {
+	return cryptfile.Open(path, nil)
+}
 func (m *mockFileSystem) DeleteFile(path string) error                                             { return nil }
+func (m *mockFileSystem) CompressFile(path string) (bool, error)                                   { return false, nil }
+func (m *mockFileSystem) SniffContentType(path string) (string, error)                             { return "", nil }
+func (m *mockFileSystem) HashFile(path string) (string, error)                                     { return "", nil }
+func (m *mockFileSystem) BlobPath(hash string) string                                              { return "" }
+func (m *mockFileSystem) StoreBlob(path, hash string) (bool, error)                                { return false, nil }
+func (m *mockFileSystem) LinkBlob(path, hash string) (bool, error)                                 { return false, nil }
+func (m *mockFileSystem) ListBlobs() ([]string, error)                                             { return nil, nil }
 func (m *mockFileSystem) FileExists(path string) bool                                              { return false }
 func (m *mockFileSystem) GetFileSize(path string) (int64, error)                                   { return 0, nil }
 func (m *mockFileSystem) GetTempFileInfo(path string) (int64, time.Time, error)                    { return 0, time.Time{}, nil }
 func (m *mockFileSystem) DeleteTempFile(path string) error                                         { return nil }
 func (m *mockFileSystem) CleanOldTempFiles(olderThan time.Duration) (int, error)                   { return 0, nil }
+func (m *mockFileSystem) WalkCacheFiles(fn func(string, int64, time.Time) error) error             { return nil }
+func (m *mockFileSystem) QuarantineFile(path string) error                                         { return nil }
+func (m *mockFileSystem) CleanOldQuarantine(olderThan time.Duration) (int, error)                  { return 0, nil }
+func (m *mockFileSystem) TrashFile(path string) error                                              { return nil }
+func (m *mockFileSystem) RestoreTrashed(synoPath string, size int64, modifiedAt time.Time) (string, bool, error) {
+	return "", false, nil
+}
+func (m *mockFileSystem) CleanTrash() (int, error)                                                 { return 0, nil }
+func (m *mockFileSystem) EmptyTrash() (int64, error)                                               { return 0, nil }
 
 func TestSpaceManager_CheckSpace(t *testing.T) {
 	tests := []struct {
@@ -264,3 +289,25 @@ func TestSpaceManager_AvailableBytes(t *testing.T) {
 		t.Errorf("AvailableBytes = %v, want %v", result.AvailableBytes, expectedAvailable)
 	}
 }
+
+func TestSpaceManager_HeadroomPercent(t *testing.T) {
+	fs := &mockFileSystem{
+		cacheSize: 45 * 1024 * 1024 * 1024, // 45GB of 50GB: 10% left
+		diskUsage: &port.DiskUsage{
+			Total:   1000 * 1024 * 1024 * 1024,
+			Used:    760 * 1024 * 1024 * 1024,
+			Free:    240 * 1024 * 1024 * 1024,
+			UsedPct: 76, // 76% of 80%: 5% left
+		},
+	}
+
+	sm := NewSpaceManager(fs, 50*1024*1024*1024, 80)
+
+	headroom, err := sm.HeadroomPercent()
+	if err != nil {
+		t.Fatalf("HeadroomPercent() error = %v", err)
+	}
+	if headroom != 5 {
+		t.Errorf("HeadroomPercent() = %v, want 5 (disk limit is tighter)", headroom)
+	}
+}
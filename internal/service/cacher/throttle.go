@@ -0,0 +1,69 @@
+package cacher
+
+import (
+	"math"
+	"sync"
+)
+
+// throttle limits how many workers may claim tasks while free space is low.
+// Workers with an index below the allowed count claim as usual, the others idle.
+// Running short of space halves the allowed count; it then grows back by one
+// worker per check while headroom permits (AIMD).
+type throttle struct {
+	mu      sync.Mutex
+	max     int
+	allowed int
+}
+
+// newThrottle creates a throttle that initially allows all max workers
+func newThrottle(max int) *throttle {
+	return &throttle{max: max, allowed: max}
+}
+
+// mayClaim reports whether the worker with the given index may claim a task
+func (t *throttle) mayClaim(workerID int) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return workerID < t.allowed
+}
+
+// current returns the number of workers currently allowed to claim tasks
+func (t *throttle) current() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.allowed
+}
+
+// backoff halves the allowed workers after a task failed for lack of space
+func (t *throttle) backoff() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.allowed /= 2
+	return t.allowed
+}
+
+// adjust recomputes the allowed workers from the free space headroom (percent
+// of the configured limits). Below threshold claiming pauses; between threshold
+// and twice the threshold the ceiling scales linearly; above it all workers run.
+func (t *throttle) adjust(headroomPct, thresholdPct float64) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ceiling := t.max
+	switch {
+	case headroomPct < thresholdPct:
+		ceiling = 0
+	case headroomPct < 2*thresholdPct:
+		ceiling = int(math.Ceil(float64(t.max) * (headroomPct - thresholdPct) / thresholdPct))
+		if ceiling < 1 {
+			ceiling = 1
+		}
+	}
+
+	if t.allowed < ceiling {
+		t.allowed++
+	} else {
+		t.allowed = ceiling
+	}
+	return t.allowed
+}
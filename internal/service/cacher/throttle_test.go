@@ -0,0 +1,53 @@
+package cacher
+
+import "testing"
+
+func TestThrottle_PausesBelowThreshold(t *testing.T) {
+	th := newThrottle(4)
+
+	if got := th.adjust(3, 5); got != 0 {
+		t.Fatalf("allowed = %d, want 0 below threshold", got)
+	}
+	if th.mayClaim(0) {
+		t.Error("worker 0 may claim while paused")
+	}
+}
+
+func TestThrottle_RecoversGradually(t *testing.T) {
+	th := newThrottle(4)
+	th.adjust(1, 5)
+
+	// Plenty of headroom again: one more worker per check
+	for want := 1; want <= 4; want++ {
+		if got := th.adjust(50, 5); got != want {
+			t.Fatalf("allowed = %d, want %d", got, want)
+		}
+	}
+	if got := th.adjust(50, 5); got != 4 {
+		t.Errorf("allowed = %d, want capped at 4", got)
+	}
+}
+
+func TestThrottle_ScalesBetweenThresholds(t *testing.T) {
+	th := newThrottle(4)
+
+	// Halfway between threshold and twice the threshold allows half the workers
+	if got := th.adjust(7.5, 5); got != 2 {
+		t.Fatalf("allowed = %d, want 2", got)
+	}
+	if !th.mayClaim(1) || th.mayClaim(2) {
+		t.Error("expected workers 0-1 to claim and 2-3 to idle")
+	}
+}
+
+func TestThrottle_Backoff(t *testing.T) {
+	th := newThrottle(4)
+
+	if got := th.backoff(); got != 2 {
+		t.Fatalf("allowed = %d, want 2 after first backoff", got)
+	}
+	th.backoff()
+	if got := th.backoff(); got != 0 {
+		t.Errorf("allowed = %d, want 0 after repeated backoff", got)
+	}
+}
@@ -0,0 +1,105 @@
+package cacher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+)
+
+// errDownloadTimeout is the cause of a download aborted by its watchdog
+var errDownloadTimeout = errors.New("download timed out")
+
+// downloadTimeoutGrace is added to the time a download may take at the
+// minimum throughput, covering the NAS preparing the file
+const downloadTimeoutGrace = time.Minute
+
+// maxDownloadDuration returns how long downloading remaining bytes may take
+// (0 = unlimited). Each retry of a task that timed out gets more time, so a
+// NAS that is merely slower than expected eventually gets the file through.
+func (d *Downloader) maxDownloadDuration(remaining int64, retryCount int) time.Duration {
+	if d.minThroughput <= 0 {
+		return 0
+	}
+	if remaining < 0 {
+		remaining = 0
+	}
+	limit := downloadTimeoutGrace + time.Duration(float64(remaining)/float64(d.minThroughput)*float64(time.Second))
+	return limit * time.Duration(retryCount+1)
+}
+
+// downloadWatchdog cancels a download that receives no data for the idle
+// timeout or runs past its maximum duration
+type downloadWatchdog struct {
+	lastRead atomic.Int64 // Unix nanoseconds of the last read that returned data
+	done     chan struct{}
+	cancel   context.CancelCauseFunc
+	timer    *time.Timer
+	meter    *meter // Counts the bytes for the worker running the download
+}
+
+// watch returns a context for downloading file that its watchdog cancels
+// with errDownloadTimeout. Call stop when the download ends.
+func (d *Downloader) watch(ctx context.Context, file *domain.File, task *domain.DownloadTask) (context.Context, *downloadWatchdog) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	w := &downloadWatchdog{
+		done:   make(chan struct{}),
+		cancel: cancel,
+		meter:  meterFrom(ctx),
+	}
+	w.touch()
+
+	if limit := d.maxDownloadDuration(file.Size-task.BytesDownloaded, task.RetryCount); limit > 0 {
+		w.timer = time.AfterFunc(limit, func() {
+			cancel(fmt.Errorf("%w: not finished after %s", errDownloadTimeout, limit))
+		})
+	}
+	if d.idleTimeout > 0 {
+		go w.run(d.idleTimeout)
+	}
+	return ctx, w
+}
+
+// run cancels the download once no data was received for idle
+func (w *downloadWatchdog) run(idle time.Duration) {
+	ticker := time.NewTicker(max(idle/4, 10*time.Millisecond))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			if time.Since(time.Unix(0, w.lastRead.Load())) >= idle {
+				w.cancel(fmt.Errorf("%w: no data received for %s", errDownloadTimeout, idle))
+				return
+			}
+		}
+	}
+}
+
+// touch records that data was received; nil-safe
+func (w *downloadWatchdog) touch() {
+	if w != nil {
+		w.lastRead.Store(time.Now().UnixNano())
+	}
+}
+
+// received records n bytes read from the NAS; nil-safe
+func (w *downloadWatchdog) received(n int) {
+	if w != nil && n > 0 {
+		w.touch()
+		w.meter.add(n)
+	}
+}
+
+// stop ends the watchdog and releases its context
+func (w *downloadWatchdog) stop() {
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	close(w.done)
+	w.cancel(nil)
+}
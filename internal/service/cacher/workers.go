@@ -0,0 +1,182 @@
+package cacher
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+)
+
+// workerRateInterval is how often the receive rate of every worker is sampled
+const workerRateInterval = 10 * time.Second
+
+// meter counts the bytes a worker receives from the NAS; nil-safe
+type meter struct {
+	bytes    atomic.Int64
+	lastData atomic.Int64 // Unix nanoseconds of the last read with data, 0 = none yet
+}
+
+// add records n received bytes
+func (m *meter) add(n int) {
+	if m == nil || n <= 0 {
+		return
+	}
+	m.bytes.Add(int64(n))
+	m.lastData.Store(time.Now().UnixNano())
+}
+
+type meterKey struct{}
+
+// withMeter returns a context whose downloads count received bytes in m
+func withMeter(ctx context.Context, m *meter) context.Context {
+	return context.WithValue(ctx, meterKey{}, m)
+}
+
+// meterFrom returns the meter of ctx, nil for downloads outside a worker
+func meterFrom(ctx context.Context) *meter {
+	m, _ := ctx.Value(meterKey{}).(*meter)
+	return m
+}
+
+// workerEntry is what the registry knows about one worker
+type workerEntry struct {
+	id      string
+	ceiling int
+	meter   meter
+
+	mu          sync.Mutex
+	state       string
+	task        *domain.DownloadTask
+	taskStarted time.Time
+	taskBytes   int64 // meter.bytes when the task started
+	heartbeat   time.Time
+	completed   int
+	failed      int
+	lastError   string
+	sampleBytes int64
+	rate        float64
+}
+
+// newWorkerEntries registers a worker per name, idle until it starts
+func newWorkerEntries(names []string, ceilings []int) []*workerEntry {
+	entries := make([]*workerEntry, len(names))
+	for i, name := range names {
+		entries[i] = &workerEntry{id: name, ceiling: ceilings[i], state: domain.WorkerIdle}
+	}
+	return entries
+}
+
+// beat records that the worker is alive
+func (w *workerEntry) beat() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.heartbeat = time.Now()
+}
+
+// setState records what the worker is doing between tasks
+func (w *workerEntry) setState(state string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.state = state
+	w.heartbeat = time.Now()
+}
+
+// start records that the worker began running task
+func (w *workerEntry) start(task *domain.DownloadTask) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.state = domain.WorkerDownloading
+	w.task = task
+	w.taskStarted = time.Now()
+	w.taskBytes = w.meter.bytes.Load()
+	w.heartbeat = w.taskStarted
+}
+
+// finish records the outcome of the running task
+func (w *workerEntry) finish(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err != nil {
+		w.failed++
+		w.lastError = err.Error()
+	} else {
+		w.completed++
+	}
+	w.state = domain.WorkerIdle
+	w.task = nil
+	w.heartbeat = time.Now()
+}
+
+// sample updates the receive rate from the bytes received over elapsed
+func (w *workerEntry) sample(elapsed time.Duration) {
+	bytes := w.meter.bytes.Load()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.rate = float64(bytes-w.sampleBytes) / elapsed.Seconds()
+	w.sampleBytes = bytes
+}
+
+// status returns a snapshot of the worker
+func (w *workerEntry) status() domain.WorkerStatus {
+	bytes := w.meter.bytes.Load()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	s := domain.WorkerStatus{
+		ID:             w.id,
+		State:          w.state,
+		BytesPerSecond: w.rate,
+		BytesReceived:  bytes,
+		TasksCompleted: w.completed,
+		TasksFailed:    w.failed,
+		LastError:      w.lastError,
+		LastHeartbeat:  w.heartbeat,
+	}
+	if w.ceiling != noCeiling {
+		ceiling := w.ceiling
+		s.MaxPriority = &ceiling
+	}
+	if w.task != nil {
+		// The task row is only updated every progress interval
+		task := *w.task
+		task.BytesDownloaded += bytes - w.taskBytes
+		started := w.taskStarted
+		s.Task = &task
+		s.TaskStartedAt = &started
+	}
+	if last := w.meter.lastData.Load(); last != 0 {
+		t := time.Unix(0, last)
+		s.LastDataAt = &t
+	}
+	return s
+}
+
+// Workers returns the status of every download worker of this process
+func (c *Cacher) Workers() []domain.WorkerStatus {
+	statuses := make([]domain.WorkerStatus, len(c.workers))
+	for i, w := range c.workers {
+		statuses[i] = w.status()
+	}
+	return statuses
+}
+
+// sampleWorkerRates periodically samples the receive rate of every worker
+func (c *Cacher) sampleWorkerRates(ctx context.Context) {
+	ticker := time.NewTicker(workerRateInterval)
+	defer ticker.Stop()
+
+	last := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, w := range c.workers {
+				w.sample(now.Sub(last))
+			}
+			last = now
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package cacher
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+)
+
+func TestWorkerEntry_Status(t *testing.T) {
+	entries := newWorkerEntries([]string{"host:1:worker-0", "host:1:worker-1"}, []int{noCeiling, 1})
+	w := entries[1]
+
+	s := w.status()
+	if s.State != domain.WorkerIdle || s.Task != nil || s.LastDataAt != nil {
+		t.Fatalf("new worker = %+v, want idle without a task", s)
+	}
+	if s.MaxPriority == nil || *s.MaxPriority != 1 {
+		t.Errorf("MaxPriority = %v, want 1", s.MaxPriority)
+	}
+	if entries[0].status().MaxPriority != nil {
+		t.Error("unrestricted worker has a MaxPriority")
+	}
+
+	// Bytes received while a task runs show up on the task before its
+	// progress is written to the queue
+	w.start(&domain.DownloadTask{ID: 7, SynoPath: "/a.bin", BytesDownloaded: 100})
+	meterFrom(withMeter(context.Background(), &w.meter)).add(50)
+	w.sample(time.Second / 2)
+
+	s = w.status()
+	if s.State != domain.WorkerDownloading || s.Task == nil || s.Task.ID != 7 {
+		t.Fatalf("running worker = %+v", s)
+	}
+	if s.Task.BytesDownloaded != 150 || s.BytesReceived != 50 {
+		t.Errorf("task bytes = %d, received = %d; want 150 and 50", s.Task.BytesDownloaded, s.BytesReceived)
+	}
+	if s.BytesPerSecond != 100 {
+		t.Errorf("BytesPerSecond = %v, want 100", s.BytesPerSecond)
+	}
+	if s.LastDataAt == nil || s.TaskStartedAt == nil {
+		t.Errorf("LastDataAt = %v, TaskStartedAt = %v; want both set", s.LastDataAt, s.TaskStartedAt)
+	}
+
+	w.finish(errors.New("boom"))
+	w.start(&domain.DownloadTask{ID: 8})
+	w.finish(nil)
+	w.sample(time.Second)
+
+	s = w.status()
+	if s.State != domain.WorkerIdle || s.Task != nil {
+		t.Errorf("finished worker = %+v, want idle", s)
+	}
+	if s.TasksCompleted != 1 || s.TasksFailed != 1 || s.LastError != "boom" {
+		t.Errorf("completed = %d, failed = %d, last error = %q", s.TasksCompleted, s.TasksFailed, s.LastError)
+	}
+	if s.BytesPerSecond != 0 {
+		t.Errorf("BytesPerSecond without data = %v, want 0", s.BytesPerSecond)
+	}
+}
+
+func TestMeter_NilSafe(t *testing.T) {
+	if m := meterFrom(context.Background()); m != nil {
+		t.Fatalf("meterFrom without a meter = %v", m)
+	}
+	var m *meter
+	m.add(10)
+	var w *downloadWatchdog
+	w.received(10)
+}
@@ -0,0 +1,445 @@
+package chunk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"github.com/vertextoedge/synology-file-cache/internal/util/cryptfile"
+	"github.com/vertextoedge/synology-file-cache/internal/util/reqid"
+	"go.uber.org/zap"
+)
+
+// fetchTimeout bounds downloading a single chunk from the NAS
+const fetchTimeout = 5 * time.Minute
+
+// evictBatch is how many chunks are loaded at a time when enforcing the size limit
+const evictBatch = 64
+
+// errRangeIgnored is returned when the NAS answers a range request with the whole file
+var errRangeIgnored = errors.New("NAS ignored the range request")
+
+// Downloader reads file ranges from the NAS
+type Downloader interface {
+	DownloadFileWithRange(ctx context.Context, fileID int64, path string, rangeStart int64) (io.ReadCloser, string, int64, error)
+}
+
+// Config contains chunk cache configuration
+type Config struct {
+	// Dir is where chunks are stored, one directory per file
+	Dir string
+
+	// ChunkSize is the size of the pieces files are cached in
+	ChunkSize int64
+
+	// MinFileSize is the size from which uncached files are served from chunks
+	MinFileSize int64
+
+	// MaxBytes limits the total size of all chunks; least recently read
+	// chunks are deleted beyond it (0 = unlimited)
+	MaxBytes int64
+
+	// Keys encrypts new chunks with the current key and decrypts stored ones
+	// (nil = chunks are stored in plain)
+	Keys *cryptfile.Keyring
+}
+
+// DefaultConfig returns default chunk cache configuration
+func DefaultConfig() *Config {
+	return &Config{
+		ChunkSize:   8 * 1024 * 1024,
+		MinFileSize: 1024 * 1024 * 1024,
+		MaxBytes:    20 * 1024 * 1024 * 1024,
+	}
+}
+
+// chunkKey identifies a chunk being downloaded
+type chunkKey struct {
+	fileID int64
+	index  int64
+}
+
+// fetch is a chunk download shared by all readers waiting for it
+type fetch struct {
+	done chan struct{}
+	err  error
+}
+
+// Cache serves files too large to cache whole as fixed-size chunks. Chunks
+// are downloaded from the NAS the first time a reader needs them, kept on
+// disk and recorded in the repository, and deleted least recently read first
+// once the cache exceeds its size limit.
+type Cache struct {
+	config *Config
+	chunks port.ChunkRepository
+	drive  Downloader
+	logger *zap.Logger
+
+	mu       sync.Mutex
+	inflight map[chunkKey]*fetch
+
+	evicting atomic.Bool
+}
+
+// New creates a chunk cache storing chunks in cfg.Dir
+func New(cfg *Config, chunks port.ChunkRepository, drive Downloader, logger *zap.Logger) (*Cache, error) {
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+	if cfg.ChunkSize <= 0 {
+		return nil, fmt.Errorf("chunk size must be positive")
+	}
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create chunk directory: %w", err)
+	}
+
+	return &Cache{
+		config:   cfg,
+		chunks:   chunks,
+		drive:    drive,
+		logger:   logger,
+		inflight: make(map[chunkKey]*fetch),
+	}, nil
+}
+
+// Eligible reports whether file is served from chunks: it is not cached
+// whole, is a regular Drive file and at least the configured minimum size
+func (c *Cache) Eligible(file *domain.File) bool {
+	return !file.Cached && file.ExportFormat == "" &&
+		file.Size > 0 && file.Size >= c.config.MinFileSize
+}
+
+// Open returns a reader over the whole file. Chunks cached for an older
+// version of the file or with another chunk size are deleted first.
+func (c *Cache) Open(ctx context.Context, file *domain.File) (*Reader, error) {
+	chunks, err := c.chunks.GetChunks(file.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load chunks: %w", err)
+	}
+
+	version := domain.ChunkVersion(file)
+	present := make(map[int64]bool, len(chunks))
+	for _, chunk := range chunks {
+		if chunk.Version != version || chunk.Size != c.chunkLength(file, chunk.Index) {
+			if err := c.dropFile(file.ID); err != nil {
+				return nil, fmt.Errorf("failed to delete stale chunks: %w", err)
+			}
+			reqid.Logger(ctx, c.logger).Debug("deleted stale chunks", zap.String("path", file.Path))
+			clear(present)
+			break
+		}
+		present[chunk.Index] = true
+	}
+
+	return &Reader{
+		cache:   c,
+		ctx:     ctx,
+		file:    file,
+		version: version,
+		present: present,
+		index:   -1,
+	}, nil
+}
+
+// chunkLength returns the number of bytes chunk index of file holds
+func (c *Cache) chunkLength(file *domain.File, index int64) int64 {
+	return max(0, min(c.config.ChunkSize, file.Size-index*c.config.ChunkSize))
+}
+
+// chunkPath returns where chunk index of a file is stored
+func (c *Cache) chunkPath(fileID, index int64) string {
+	return filepath.Join(c.config.Dir, strconv.FormatInt(fileID, 10), strconv.FormatInt(index, 10))
+}
+
+// dropFile deletes all chunks of a file
+func (c *Cache) dropFile(fileID int64) error {
+	if err := c.chunks.DeleteChunks(fileID); err != nil {
+		return err
+	}
+	return os.RemoveAll(filepath.Join(c.config.Dir, strconv.FormatInt(fileID, 10)))
+}
+
+// fetch downloads chunk index of file unless another reader is already
+// downloading it, in which case it waits for that download. The download
+// outlives a reader that gives up, so the chunk is still cached.
+func (c *Cache) fetch(ctx context.Context, file *domain.File, version, index int64) error {
+	key := chunkKey{fileID: file.ID, index: index}
+
+	c.mu.Lock()
+	f, ok := c.inflight[key]
+	if !ok {
+		f = &fetch{done: make(chan struct{})}
+		c.inflight[key] = f
+
+		go func() {
+			fetchCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), fetchTimeout)
+			defer cancel()
+
+			f.err = c.download(fetchCtx, file, version, index)
+
+			c.mu.Lock()
+			delete(c.inflight, key)
+			c.mu.Unlock()
+			close(f.done)
+		}()
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// download reads chunk index of file from the NAS, stores and records it
+func (c *Cache) download(ctx context.Context, file *domain.File, version, index int64) error {
+	start := index * c.config.ChunkSize
+	length := c.chunkLength(file, index)
+
+	body, _, size, err := c.drive.DownloadFileWithRange(ctx, 0, file.Path, start)
+	if err != nil {
+		return fmt.Errorf("download failed: %w", err)
+	}
+	defer body.Close()
+
+	if start > 0 && size == file.Size {
+		return errRangeIgnored
+	}
+
+	path := c.chunkPath(file.ID, index)
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create chunk directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, ".chunk-*")
+	if err != nil {
+		return fmt.Errorf("failed to create chunk file: %w", err)
+	}
+	err = c.writeChunk(tmp, body, length)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to store chunk: %w", err)
+	}
+
+	chunk := &domain.FileChunk{FileID: file.ID, Index: index, Size: length, Version: version}
+	if err := c.chunks.AddChunk(chunk); err != nil {
+		os.Remove(path)
+		return fmt.Errorf("failed to record chunk: %w", err)
+	}
+
+	reqid.Logger(ctx, c.logger).Debug("chunk cached",
+		zap.String("path", file.Path),
+		zap.Int64("index", index),
+		zap.Int64("size", length))
+
+	go c.enforceLimit()
+	return nil
+}
+
+// writeChunk copies length bytes of body to w, encrypted when keys are set
+func (c *Cache) writeChunk(w io.Writer, body io.Reader, length int64) error {
+	if c.config.Keys == nil {
+		_, err := io.CopyN(w, body, length)
+		return err
+	}
+	cw, err := cryptfile.NewWriter(w, c.config.Keys.Current())
+	if err != nil {
+		return err
+	}
+	if _, err := io.CopyN(cw, body, length); err != nil {
+		return err
+	}
+	return cw.Close()
+}
+
+// enforceLimit deletes least recently read chunks until the cache fits MaxBytes
+func (c *Cache) enforceLimit() {
+	if c.config.MaxBytes <= 0 || !c.evicting.CompareAndSwap(false, true) {
+		return
+	}
+	defer c.evicting.Store(false)
+
+	usage, err := c.chunks.GetChunkUsage()
+	if err != nil {
+		c.logger.Warn("failed to get chunk cache usage", zap.Error(err))
+		return
+	}
+
+	evicted := 0
+	for usage > c.config.MaxBytes {
+		chunks, err := c.chunks.GetLeastRecentChunks(evictBatch)
+		if err != nil {
+			c.logger.Warn("failed to list chunks to evict", zap.Error(err))
+			break
+		}
+		if len(chunks) == 0 {
+			break
+		}
+
+		for _, chunk := range chunks {
+			if usage <= c.config.MaxBytes {
+				break
+			}
+			if err := os.Remove(c.chunkPath(chunk.FileID, chunk.Index)); err != nil && !os.IsNotExist(err) {
+				c.logger.Warn("failed to delete chunk", zap.Int64("file_id", chunk.FileID), zap.Error(err))
+				return
+			}
+			if err := c.chunks.DeleteChunk(chunk.FileID, chunk.Index); err != nil {
+				c.logger.Warn("failed to delete chunk record", zap.Int64("file_id", chunk.FileID), zap.Error(err))
+				return
+			}
+			usage -= chunk.Size
+			evicted++
+		}
+	}
+
+	if evicted > 0 {
+		c.logger.Info("evicted chunks", zap.Int("count", evicted), zap.Int64("usage", usage))
+	}
+}
+
+// Reader reads a file through the chunk cache. Missing chunks are downloaded
+// from the NAS when the read reaches them. It is not safe for concurrent use.
+type Reader struct {
+	cache   *Cache
+	ctx     context.Context
+	file    *domain.File
+	version int64
+	present map[int64]bool
+	offset  int64
+
+	current *cryptfile.File // Open chunk, index is its number (-1 = none)
+	index   int64
+
+	fetched int   // Chunks downloaded from the NAS
+	err     error // Last read error other than io.EOF
+}
+
+// Read reads from the current offset, at most up to the end of its chunk
+func (r *Reader) Read(p []byte) (int, error) {
+	if r.offset >= r.file.Size {
+		return 0, io.EOF
+	}
+
+	chunkSize := r.cache.config.ChunkSize
+	index := r.offset / chunkSize
+	f, err := r.open(index)
+	if err != nil {
+		r.err = err
+		return 0, err
+	}
+
+	within := r.offset - index*chunkSize
+	if remaining := r.cache.chunkLength(r.file, index) - within; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+
+	n, err := f.ReadAt(p, within)
+	r.offset += int64(n)
+	if err == io.EOF {
+		if n == 0 {
+			r.err = fmt.Errorf("chunk %d of %s is truncated", index, r.file.Path)
+			return 0, r.err
+		}
+		err = nil
+	}
+	if err != nil {
+		r.err = err
+	}
+	return n, err
+}
+
+// Seek sets the offset for the next Read
+func (r *Reader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.file.Size
+	default:
+		return 0, fmt.Errorf("invalid whence %d", whence)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("negative offset")
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+// Close closes the open chunk
+func (r *Reader) Close() error {
+	if r.current == nil {
+		return nil
+	}
+	err := r.current.Close()
+	r.current = nil
+	r.index = -1
+	return err
+}
+
+// Fetched returns how many chunks were downloaded from the NAS for this reader
+func (r *Reader) Fetched() int {
+	return r.fetched
+}
+
+// Err returns the last error a Read failed with, nil if all reads succeeded
+func (r *Reader) Err() error {
+	return r.err
+}
+
+// open returns chunk index, downloading it first if it is not cached. A
+// chunk evicted since the reader was opened is downloaded again.
+func (r *Reader) open(index int64) (*cryptfile.File, error) {
+	if r.current != nil && r.index == index {
+		return r.current, nil
+	}
+	r.Close()
+
+	path := r.cache.chunkPath(r.file.ID, index)
+	if r.present[index] {
+		f, err := cryptfile.Open(path, r.cache.config.Keys)
+		if err == nil {
+			if err := r.cache.chunks.TouchChunk(r.file.ID, index); err != nil {
+				reqid.Logger(r.ctx, r.cache.logger).Warn("failed to update chunk access time", zap.Error(err))
+			}
+			r.current, r.index = f, index
+			return f, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to open chunk: %w", err)
+		}
+		r.present[index] = false
+	}
+
+	if err := r.cache.fetch(r.ctx, r.file, r.version, index); err != nil {
+		return nil, fmt.Errorf("failed to fetch chunk %d: %w", index, err)
+	}
+	r.present[index] = true
+	r.fetched++
+
+	f, err := cryptfile.Open(path, r.cache.config.Keys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open chunk: %w", err)
+	}
+	r.current, r.index = f, index
+	return f, nil
+}
@@ -0,0 +1,345 @@
+package chunk
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/util/cryptfile"
+	"go.uber.org/zap"
+)
+
+// mockChunkRepository keeps chunk records in memory
+type mockChunkRepository struct {
+	mu      sync.Mutex
+	chunks  map[chunkKey]*domain.FileChunk
+	touched int
+}
+
+func newMockChunkRepository() *mockChunkRepository {
+	return &mockChunkRepository{chunks: make(map[chunkKey]*domain.FileChunk)}
+}
+
+func (m *mockChunkRepository) GetChunks(fileID int64) ([]*domain.FileChunk, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var result []*domain.FileChunk
+	for key, c := range m.chunks {
+		if key.fileID == fileID {
+			copied := *c
+			result = append(result, &copied)
+		}
+	}
+	slices.SortFunc(result, func(a, b *domain.FileChunk) int { return int(a.Index - b.Index) })
+	return result, nil
+}
+
+func (m *mockChunkRepository) AddChunk(chunk *domain.FileChunk) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	chunk.AccessedAt = time.Now()
+	chunk.CreatedAt = chunk.AccessedAt
+	copied := *chunk
+	m.chunks[chunkKey{chunk.FileID, chunk.Index}] = &copied
+	return nil
+}
+
+func (m *mockChunkRepository) TouchChunk(fileID, index int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.touched++
+	if c, ok := m.chunks[chunkKey{fileID, index}]; ok {
+		c.AccessedAt = time.Now()
+	}
+	return nil
+}
+
+func (m *mockChunkRepository) DeleteChunk(fileID, index int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.chunks, chunkKey{fileID, index})
+	return nil
+}
+
+func (m *mockChunkRepository) DeleteChunks(fileID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key := range m.chunks {
+		if key.fileID == fileID {
+			delete(m.chunks, key)
+		}
+	}
+	return nil
+}
+
+func (m *mockChunkRepository) GetChunkUsage() (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var total int64
+	for _, c := range m.chunks {
+		total += c.Size
+	}
+	return total, nil
+}
+
+func (m *mockChunkRepository) GetLeastRecentChunks(limit int) ([]*domain.FileChunk, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var result []*domain.FileChunk
+	for _, c := range m.chunks {
+		copied := *c
+		result = append(result, &copied)
+	}
+	slices.SortFunc(result, func(a, b *domain.FileChunk) int { return a.AccessedAt.Compare(b.AccessedAt) })
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+// mockDownloader serves ranges of content and counts requests
+type mockDownloader struct {
+	mu          sync.Mutex
+	content     []byte
+	requests    []int64
+	ignoreRange bool
+}
+
+func (m *mockDownloader) DownloadFileWithRange(ctx context.Context, fileID int64, path string, rangeStart int64) (io.ReadCloser, string, int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests = append(m.requests, rangeStart)
+	if m.ignoreRange || rangeStart < 0 {
+		rangeStart = 0
+	}
+	body := m.content[rangeStart:]
+	return io.NopCloser(bytes.NewReader(body)), "file", int64(len(body)), nil
+}
+
+func (m *mockDownloader) requestCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.requests)
+}
+
+func newTestCache(t *testing.T, cfg *Config, content []byte) (*Cache, *mockChunkRepository, *mockDownloader, *domain.File) {
+	t.Helper()
+
+	cfg.Dir = t.TempDir()
+	repo := newMockChunkRepository()
+	drive := &mockDownloader{content: content}
+	c, err := New(cfg, repo, drive, zap.NewNop())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	modified := time.Unix(1700000000, 0)
+	file := &domain.File{ID: 3, Path: "/videos/movie.mkv", Size: int64(len(content)), ModifiedAt: &modified}
+	return c, repo, drive, file
+}
+
+func testContent(size int) []byte {
+	content := make([]byte, size)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	return content
+}
+
+func TestEligible(t *testing.T) {
+	c, _, _, file := newTestCache(t, &Config{ChunkSize: 4, MinFileSize: 10}, testContent(10))
+
+	if !c.Eligible(file) {
+		t.Error("uncached file at the minimum size should be eligible")
+	}
+
+	small := *file
+	small.Size = 9
+	if c.Eligible(&small) {
+		t.Error("file below the minimum size should not be eligible")
+	}
+
+	cached := *file
+	cached.Cached = true
+	if c.Eligible(&cached) {
+		t.Error("cached file should not be eligible")
+	}
+
+	office := *file
+	office.ExportFormat = "docx"
+	if c.Eligible(&office) {
+		t.Error("exported Office file should not be eligible")
+	}
+}
+
+func TestReaderFetchesMissingChunksOnce(t *testing.T) {
+	content := testContent(10)
+	c, repo, drive, file := newTestCache(t, &Config{ChunkSize: 4}, content)
+
+	r, err := c.Open(context.Background(), file)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	got, err := io.ReadAll(r)
+	r.Close()
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("content = %v, want %v", got, content)
+	}
+	if r.Fetched() != 3 {
+		t.Errorf("Fetched() = %d, want 3", r.Fetched())
+	}
+	if !slices.Equal(drive.requests, []int64{0, 4, 8}) {
+		t.Errorf("range starts = %v, want [0 4 8]", drive.requests)
+	}
+	if usage, _ := repo.GetChunkUsage(); usage != 10 {
+		t.Errorf("chunk usage = %d, want 10", usage)
+	}
+
+	// A second reader serves everything locally, starting at an offset
+	r, err = c.Open(context.Background(), file)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer r.Close()
+	if _, err := r.Seek(6, io.SeekStart); err != nil {
+		t.Fatalf("Seek() error = %v", err)
+	}
+	got, err = io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	if !bytes.Equal(got, content[6:]) {
+		t.Errorf("content from offset 6 = %v, want %v", got, content[6:])
+	}
+	if drive.requestCount() != 3 {
+		t.Errorf("NAS requests = %d, want 3", drive.requestCount())
+	}
+	if repo.touched != 2 {
+		t.Errorf("touched chunks = %d, want 2", repo.touched)
+	}
+}
+
+func TestReaderEncryptsChunks(t *testing.T) {
+	content := testContent(10)
+	key, err := cryptfile.NewKey(bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, _, _, file := newTestCache(t, &Config{ChunkSize: 4, Keys: cryptfile.NewKeyring(key)}, content)
+
+	r, err := c.Open(context.Background(), file)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	got, err := io.ReadAll(r)
+	r.Close()
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("content = %v, want %v", got, content)
+	}
+
+	stored, err := os.ReadFile(c.chunkPath(file.ID, 0))
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if bytes.Contains(stored, content[:4]) {
+		t.Error("stored chunk holds the plain content")
+	}
+
+	// A second reader decrypts the stored chunks
+	r, err = c.Open(context.Background(), file)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer r.Close()
+	if got, err = io.ReadAll(r); err != nil || !bytes.Equal(got, content) {
+		t.Errorf("stored content = %v (err %v), want %v", got, err, content)
+	}
+	if r.Fetched() != 0 {
+		t.Errorf("Fetched() = %d, want 0", r.Fetched())
+	}
+}
+
+func TestOpenDropsChunksOfOlderVersion(t *testing.T) {
+	content := testContent(8)
+	c, repo, drive, file := newTestCache(t, &Config{ChunkSize: 4}, content)
+
+	r, _ := c.Open(context.Background(), file)
+	if _, err := io.ReadAll(r); err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	r.Close()
+
+	modified := file.ModifiedAt.Add(time.Hour)
+	file.ModifiedAt = &modified
+
+	r, err := c.Open(context.Background(), file)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer r.Close()
+	if chunks, _ := repo.GetChunks(file.ID); len(chunks) != 0 {
+		t.Errorf("chunks after modification = %d, want 0", len(chunks))
+	}
+	if _, err := io.ReadAll(r); err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	if drive.requestCount() != 4 {
+		t.Errorf("NAS requests = %d, want 4", drive.requestCount())
+	}
+}
+
+func TestReaderRejectsIgnoredRange(t *testing.T) {
+	c, _, drive, file := newTestCache(t, &Config{ChunkSize: 4}, testContent(8))
+	drive.ignoreRange = true
+
+	r, _ := c.Open(context.Background(), file)
+	defer r.Close()
+	r.Seek(4, io.SeekStart)
+
+	if _, err := r.Read(make([]byte, 4)); !errors.Is(err, errRangeIgnored) {
+		t.Errorf("Read() error = %v, want %v", err, errRangeIgnored)
+	}
+	if !errors.Is(r.Err(), errRangeIgnored) {
+		t.Errorf("Err() = %v, want %v", r.Err(), errRangeIgnored)
+	}
+}
+
+func TestEnforceLimitEvictsLeastRecentChunks(t *testing.T) {
+	c, repo, _, file := newTestCache(t, &Config{ChunkSize: 4, MaxBytes: 8}, testContent(12))
+
+	for _, index := range []int64{0, 1, 2} {
+		if err := c.download(context.Background(), file, domain.ChunkVersion(file), index); err != nil {
+			t.Fatalf("download(%d) error = %v", index, err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Each download starts an eviction run in the background
+	deadline := time.Now().Add(time.Second)
+	for usage, _ := repo.GetChunkUsage(); usage > 8 && time.Now().Before(deadline); usage, _ = repo.GetChunkUsage() {
+		c.enforceLimit()
+		time.Sleep(time.Millisecond)
+	}
+
+	chunks, _ := repo.GetChunks(file.ID)
+	var indexes []int64
+	for _, chunk := range chunks {
+		indexes = append(indexes, chunk.Index)
+	}
+	if !slices.Equal(indexes, []int64{1, 2}) {
+		t.Errorf("remaining chunks = %v, want [1 2]", indexes)
+	}
+}
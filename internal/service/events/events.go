@@ -0,0 +1,144 @@
+// Package events fans out cache events (downloads, evictions, syncs) to the
+// live subscribers of /api/v1/events.
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+)
+
+const (
+	// DefaultHistory is how many recent events are kept for reconnecting clients
+	DefaultHistory = 256
+
+	// subscriberBuffer is how many events a subscriber may lag behind
+	// before it is disconnected
+	subscriberBuffer = 64
+)
+
+// Bus delivers published events to live subscribers. It keeps the most
+// recent events, so a client that reconnects with the last ID it saw
+// receives what it missed.
+type Bus struct {
+	mu      sync.Mutex
+	lastID  int64
+	history []domain.Event // Oldest first
+	size    int
+	subs    map[*Subscription]struct{}
+	now     func() time.Time
+}
+
+// NewBus creates a Bus keeping history recent events (DefaultHistory if <= 0)
+func NewBus(history int) *Bus {
+	if history <= 0 {
+		history = DefaultHistory
+	}
+	return &Bus{
+		size: history,
+		subs: make(map[*Subscription]struct{}),
+		now:  time.Now,
+	}
+}
+
+// Publish assigns the event an ID and delivers it to the subscribers that
+// want its type. It never blocks: a subscriber whose buffer is full is
+// closed and has to resubscribe from the last event it received.
+// It implements port.EventPublisher.
+func (b *Bus) Publish(event domain.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	event.ID = b.lastID
+	if event.Time.IsZero() {
+		event.Time = b.now()
+	}
+
+	if len(b.history) == b.size {
+		copy(b.history, b.history[1:])
+		b.history = b.history[:b.size-1]
+	}
+	b.history = append(b.history, event)
+
+	for sub := range b.subs {
+		if !sub.wants(event.Type) {
+			continue
+		}
+		select {
+		case sub.ch <- event:
+		default:
+			b.remove(sub)
+		}
+	}
+}
+
+// Subscribe returns a subscription to events of the given types (all types
+// when empty) and the recent events published after lastID, oldest first.
+// lastID 0 skips the history.
+func (b *Bus) Subscribe(types []string, lastID int64) (*Subscription, []domain.Event) {
+	sub := &Subscription{
+		ch:  make(chan domain.Event, subscriberBuffer),
+		bus: b,
+	}
+	sub.C = sub.ch
+	if len(types) > 0 {
+		sub.types = make(map[string]bool, len(types))
+		for _, t := range types {
+			sub.types[t] = true
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var missed []domain.Event
+	if lastID > 0 {
+		for _, event := range b.history {
+			if event.ID > lastID && sub.wants(event.Type) {
+				missed = append(missed, event)
+			}
+		}
+	}
+	b.subs[sub] = struct{}{}
+	return sub, missed
+}
+
+// Subscribers returns the number of open subscriptions
+func (b *Bus) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs)
+}
+
+// remove closes a subscription; b.mu must be held
+func (b *Bus) remove(sub *Subscription) {
+	if _, ok := b.subs[sub]; !ok {
+		return
+	}
+	delete(b.subs, sub)
+	close(sub.ch)
+}
+
+// Subscription receives events on C until it is closed, either by Close or
+// by the bus when the subscriber fell too far behind
+type Subscription struct {
+	C <-chan domain.Event
+
+	ch    chan domain.Event
+	types map[string]bool // nil = all types
+	bus   *Bus
+}
+
+// wants reports whether the subscription receives events of type t
+func (s *Subscription) wants(t string) bool {
+	return s.types == nil || s.types[t]
+}
+
+// Close stops the subscription and closes C
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	s.bus.remove(s)
+}
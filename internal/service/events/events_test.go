@@ -0,0 +1,53 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+)
+
+func TestBus_Subscribe(t *testing.T) {
+	b := NewBus(2)
+	b.Publish(domain.Event{Type: domain.EventTaskStarted, TaskID: 1})
+	b.Publish(domain.Event{Type: domain.EventFileCached, FileID: 1})
+	b.Publish(domain.Event{Type: domain.EventTaskCompleted, TaskID: 1})
+
+	// Only the last two events are kept
+	sub, missed := b.Subscribe(nil, 1)
+	if len(missed) != 2 || missed[0].ID != 2 || missed[1].ID != 3 {
+		t.Fatalf("missed = %+v, want events 2 and 3", missed)
+	}
+	if missed[0].Time.IsZero() {
+		t.Error("published event has no time")
+	}
+	sub.Close()
+
+	sub, missed = b.Subscribe([]string{domain.EventTaskFailed}, 0)
+	defer sub.Close()
+	if len(missed) != 0 {
+		t.Errorf("missed = %+v without a last ID", missed)
+	}
+	b.Publish(domain.Event{Type: domain.EventFileEvicted})
+	b.Publish(domain.Event{Type: domain.EventTaskFailed, TaskID: 2, Retry: true})
+	if event := <-sub.C; event.Type != domain.EventTaskFailed || event.ID != 5 || !event.Retry {
+		t.Errorf("received %+v, want task.failed 5", event)
+	}
+}
+
+func TestBus_SlowSubscriber(t *testing.T) {
+	b := NewBus(0)
+	slow, _ := b.Subscribe(nil, 0)
+	for i := 0; i <= subscriberBuffer; i++ {
+		b.Publish(domain.Event{Type: domain.EventFileCached})
+	}
+
+	// The subscriber is closed instead of blocking the publisher
+	received := 0
+	for range slow.C {
+		received++
+	}
+	if received != subscriberBuffer || b.Subscribers() != 0 {
+		t.Errorf("received %d events, %d subscribers left", received, b.Subscribers())
+	}
+	slow.Close() // Closing again is a no-op
+}
@@ -0,0 +1,157 @@
+package leader
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"go.uber.org/zap"
+)
+
+// Config contains leader election configuration
+type Config struct {
+	// Name of the lease instances compete for
+	Name string
+
+	// Holder uniquely identifies this instance
+	Holder string
+
+	// TTL is how long the lease stays valid without renewal; it is renewed every TTL/3
+	TTL time.Duration
+}
+
+// DefaultConfig returns default leader election configuration
+func DefaultConfig() *Config {
+	return &Config{
+		Name: "syncer",
+		TTL:  30 * time.Second,
+	}
+}
+
+// Elector keeps a database lease so that only one of several instances
+// sharing a database acts as leader at a time
+type Elector struct {
+	config *Config
+	leases port.LeaseRepository
+	logger *zap.Logger
+
+	leader  atomic.Bool
+	elected chan struct{} // Signalled each time this instance becomes leader
+
+	mu      sync.Mutex
+	running bool
+	cancel  context.CancelFunc
+}
+
+// New creates a new Elector
+func New(cfg *Config, leases port.LeaseRepository, logger *zap.Logger) (*Elector, error) {
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+	if cfg.Name == "" {
+		cfg.Name = "syncer"
+	}
+	if cfg.TTL == 0 {
+		cfg.TTL = 30 * time.Second
+	}
+	if cfg.Holder == "" {
+		return nil, fmt.Errorf("leader election holder is required")
+	}
+
+	return &Elector{
+		config:  cfg,
+		leases:  leases,
+		logger:  logger,
+		elected: make(chan struct{}, 1),
+	}, nil
+}
+
+// Start campaigns for the lease until ctx is cancelled, then releases it
+func (e *Elector) Start(ctx context.Context) error {
+	e.mu.Lock()
+	if e.running {
+		e.mu.Unlock()
+		return fmt.Errorf("leader elector already running")
+	}
+	e.running = true
+	ctx, e.cancel = context.WithCancel(ctx)
+	e.mu.Unlock()
+
+	e.logger.Info("leader election started",
+		zap.String("lease", e.config.Name),
+		zap.String("holder", e.config.Holder),
+		zap.Duration("ttl", e.config.TTL))
+
+	e.campaign()
+
+	ticker := time.NewTicker(e.config.TTL / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			e.resign()
+			return nil
+		case <-ticker.C:
+			e.campaign()
+		}
+	}
+}
+
+// Stop stops campaigning and gives up leadership
+func (e *Elector) Stop() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.cancel != nil {
+		e.cancel()
+	}
+	e.running = false
+}
+
+// IsLeader reports whether this instance currently holds the lease
+func (e *Elector) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// Elected is signalled whenever this instance becomes leader.
+// Signals are coalesced, so a slow reader sees at most one pending signal.
+func (e *Elector) Elected() <-chan struct{} {
+	return e.elected
+}
+
+// campaign acquires or renews the lease and updates the leader state
+func (e *Elector) campaign() {
+	acquired, err := e.leases.AcquireLease(e.config.Name, e.config.Holder, e.config.TTL)
+	if err != nil {
+		// Without a confirmed renewal another instance may take over; step down
+		e.logger.Warn("failed to renew leader lease", zap.Error(err))
+		acquired = false
+	}
+
+	was := e.leader.Swap(acquired)
+	switch {
+	case acquired && !was:
+		e.logger.Info("acquired leadership", zap.String("lease", e.config.Name))
+		select {
+		case e.elected <- struct{}{}:
+		default:
+		}
+	case !acquired && was:
+		e.logger.Warn("lost leadership", zap.String("lease", e.config.Name))
+	}
+}
+
+// resign releases the lease so another instance can take over immediately
+func (e *Elector) resign() {
+	if !e.leader.Swap(false) {
+		return
+	}
+	if err := e.leases.ReleaseLease(e.config.Name, e.config.Holder); err != nil {
+		e.logger.Warn("failed to release leader lease", zap.Error(err))
+		return
+	}
+	e.logger.Info("released leadership", zap.String("lease", e.config.Name))
+}
@@ -0,0 +1,143 @@
+package leader
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// fakeLeases is an in-memory lease table with a controllable clock
+type fakeLeases struct {
+	mu      sync.Mutex
+	now     time.Time
+	holders map[string]string
+	expires map[string]time.Time
+	err     error
+}
+
+func newFakeLeases() *fakeLeases {
+	return &fakeLeases{
+		now:     time.Unix(1_700_000_000, 0),
+		holders: make(map[string]string),
+		expires: make(map[string]time.Time),
+	}
+}
+
+func (f *fakeLeases) AcquireLease(name, holder string, ttl time.Duration) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return false, f.err
+	}
+	if current, ok := f.holders[name]; ok && current != holder && f.expires[name].After(f.now) {
+		return false, nil
+	}
+	f.holders[name] = holder
+	f.expires[name] = f.now.Add(ttl)
+	return true, nil
+}
+
+func (f *fakeLeases) ReleaseLease(name, holder string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.holders[name] == holder {
+		delete(f.holders, name)
+		delete(f.expires, name)
+	}
+	return nil
+}
+
+func (f *fakeLeases) advance(d time.Duration) {
+	f.mu.Lock()
+	f.now = f.now.Add(d)
+	f.mu.Unlock()
+}
+
+func newElector(t *testing.T, leases *fakeLeases, holder string) *Elector {
+	t.Helper()
+	e, err := New(&Config{Name: "syncer", Holder: holder, TTL: 30 * time.Second}, leases, zap.NewNop())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return e
+}
+
+func TestElector_SingleLeader(t *testing.T) {
+	leases := newFakeLeases()
+	a := newElector(t, leases, "a")
+	b := newElector(t, leases, "b")
+
+	a.campaign()
+	b.campaign()
+
+	if !a.IsLeader() || b.IsLeader() {
+		t.Fatalf("leaders: a=%v b=%v, want only a", a.IsLeader(), b.IsLeader())
+	}
+	select {
+	case <-a.Elected():
+	default:
+		t.Error("expected elected signal for a")
+	}
+
+	// a keeps renewing, b stays follower
+	leases.advance(20 * time.Second)
+	a.campaign()
+	leases.advance(20 * time.Second)
+	b.campaign()
+	if !a.IsLeader() || b.IsLeader() {
+		t.Fatalf("after renewal: a=%v b=%v, want only a", a.IsLeader(), b.IsLeader())
+	}
+}
+
+func TestElector_Failover(t *testing.T) {
+	leases := newFakeLeases()
+	a := newElector(t, leases, "a")
+	b := newElector(t, leases, "b")
+
+	a.campaign()
+
+	// a stops renewing; once the lease expires b takes over
+	leases.advance(31 * time.Second)
+	b.campaign()
+	if !b.IsLeader() {
+		t.Fatal("expected b to take over the expired lease")
+	}
+
+	a.campaign()
+	if a.IsLeader() {
+		t.Error("expected a to notice it lost leadership")
+	}
+}
+
+func TestElector_ResignHandsOver(t *testing.T) {
+	leases := newFakeLeases()
+	a := newElector(t, leases, "a")
+	b := newElector(t, leases, "b")
+
+	a.campaign()
+	a.resign()
+	if a.IsLeader() {
+		t.Error("expected a to step down")
+	}
+
+	b.campaign()
+	if !b.IsLeader() {
+		t.Error("expected b to acquire the released lease without waiting for expiry")
+	}
+}
+
+func TestElector_StepsDownOnError(t *testing.T) {
+	leases := newFakeLeases()
+	a := newElector(t, leases, "a")
+
+	a.campaign()
+	leases.err = errors.New("database unavailable")
+	a.campaign()
+
+	if a.IsLeader() {
+		t.Error("expected leader to step down when the lease cannot be renewed")
+	}
+}
@@ -0,0 +1,93 @@
+package maintenance
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ReferenceCounter counts the files using a cached copy (port.FileRepository)
+type ReferenceCounter interface {
+	CountCacheReferences(cachePath string) (int, error)
+}
+
+// EnableOrphanCollection scans the cache every OrphanScanInterval for copies no
+// file references, e.g. after the database was restored from a backup or rows
+// were deleted by hand. Such copies never count toward eviction. They are moved
+// to the quarantine directory and deleted after OrphanRetention, or deleted
+// right away when quarantine is false.
+func (s *Service) EnableOrphanCollection(references ReferenceCounter, quarantine bool) {
+	s.references = references
+	s.quarantine = quarantine
+}
+
+// collectOrphans removes unreferenced cached copies older than OrphanMinAge.
+// Younger copies are skipped since a finished download is moved into place
+// before its file row is updated.
+func (s *Service) collectOrphans() {
+	if s.references == nil {
+		return
+	}
+
+	threshold := time.Now().Add(-s.config.OrphanMinAge)
+	var count int
+	var bytes int64
+
+	err := s.fs.WalkCacheFiles(func(cachePath string, size int64, modTime time.Time) error {
+		if modTime.After(threshold) {
+			return nil
+		}
+
+		refs, err := s.references.CountCacheReferences(cachePath)
+		if err != nil {
+			return err
+		}
+		if refs > 0 {
+			return nil
+		}
+
+		if s.quarantine {
+			err = s.fs.QuarantineFile(cachePath)
+		} else {
+			err = s.fs.DeleteFile(cachePath)
+		}
+		if err != nil {
+			s.logger.Warn("failed to remove orphaned cache file",
+				zap.String("path", cachePath),
+				zap.Error(err))
+			return nil
+		}
+
+		s.logger.Debug("removed orphaned cache file",
+			zap.String("path", cachePath),
+			zap.Int64("size", size),
+			zap.Bool("quarantined", s.quarantine))
+		count++
+		bytes += size
+		return nil
+	})
+	if err != nil {
+		s.logger.Error("failed to scan cache for orphaned files", zap.Error(err))
+	}
+
+	if count > 0 {
+		s.logger.Info("removed orphaned cache files",
+			zap.Int("count", count),
+			zap.Int64("bytes", bytes),
+			zap.Bool("quarantined", s.quarantine))
+	}
+}
+
+// cleanupQuarantine deletes quarantined orphans older than the retention
+func (s *Service) cleanupQuarantine() {
+	if s.references == nil || !s.quarantine {
+		return
+	}
+
+	deleted, err := s.fs.CleanOldQuarantine(s.config.OrphanRetention)
+	if err != nil {
+		s.logger.Error("failed to cleanup quarantined files", zap.Error(err))
+	} else if deleted > 0 {
+		s.logger.Info("deleted quarantined orphaned files", zap.Int("count", deleted))
+	}
+}
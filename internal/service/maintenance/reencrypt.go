@@ -0,0 +1,74 @@
+package maintenance
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Reencrypter rewrites a cached copy with the current encryption key
+// (filesystem.Manager)
+type Reencrypter interface {
+	ReencryptFile(path string) (bool, error)
+}
+
+// EnableReencryption rewrites cached copies and blobs stored in plain or
+// encrypted with an old key with the current key, once after Start. This
+// completes enabling encryption or rotating its key; old keys can be dropped
+// from the configuration once the run has finished.
+func (s *Service) EnableReencryption(reencrypter Reencrypter) {
+	s.reencrypter = reencrypter
+}
+
+// reencryptAll runs the re-encryption over all cached copies and blobs
+func (s *Service) reencryptAll(ctx context.Context) {
+	if s.reencrypter == nil {
+		return
+	}
+
+	s.logger.Info("re-encrypting cache files")
+	var count, failed int
+
+	reencrypt := func(path string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rewritten, err := s.reencrypter.ReencryptFile(path)
+		if err != nil {
+			failed++
+			s.logger.Warn("failed to re-encrypt cache file",
+				zap.String("path", path),
+				zap.Error(err))
+			return nil
+		}
+		if rewritten {
+			count++
+		}
+		return nil
+	}
+
+	err := s.fs.WalkCacheFiles(func(cachePath string, _ int64, _ time.Time) error {
+		return reencrypt(cachePath)
+	})
+	if err == nil {
+		var blobs []string
+		if blobs, err = s.fs.ListBlobs(); err == nil {
+			for _, blob := range blobs {
+				if err = reencrypt(blob); err != nil {
+					break
+				}
+			}
+		}
+	}
+	if err != nil {
+		if ctx.Err() == nil {
+			s.logger.Error("failed to scan cache for re-encryption", zap.Error(err))
+		}
+		return
+	}
+
+	s.logger.Info("re-encryption finished",
+		zap.Int("rewritten", count),
+		zap.Int("failed", failed))
+}
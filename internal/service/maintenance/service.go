@@ -26,6 +26,43 @@ type Config struct {
 
 	// TempFileMaxAge is the maximum age of temp files before cleanup
 	TempFileMaxAge time.Duration
+
+	// PriorityAgingAge is how long a pending task waits before its priority is boosted
+	PriorityAgingAge time.Duration
+
+	// AuditRetention is how long audit events are kept
+	AuditRetention time.Duration
+
+	// PreviewMaxAge is how long generated thumbnails are kept before regeneration
+	PreviewMaxAge time.Duration
+
+	// StreamMaxAge is how long HLS segments are kept after last playback
+	StreamMaxAge time.Duration
+
+	// StatsInterval is how often a statistics snapshot is taken
+	StatsInterval time.Duration
+
+	// StatsRetention is how long statistics snapshots are kept
+	StatsRetention time.Duration
+
+	// OrphanScanInterval is how often the cache is scanned for unreferenced copies
+	OrphanScanInterval time.Duration
+
+	// OrphanMinAge is how old an unreferenced copy must be before it is removed
+	OrphanMinAge time.Duration
+
+	// OrphanRetention is how long quarantined copies are kept
+	OrphanRetention time.Duration
+}
+
+// AgeCleaner removes generated files (previews, stream segments) older than a given age
+type AgeCleaner interface {
+	CleanOld(maxAge time.Duration) (int, error)
+}
+
+// Snapshotter records a statistics snapshot (stats.Service)
+type Snapshotter interface {
+	Snapshot()
 }
 
 // DefaultConfig returns default maintenance configuration
@@ -36,15 +73,34 @@ func DefaultConfig() *Config {
 		CleanupInterval:        time.Hour,
 		FailedTaskMaxAge:       24 * time.Hour,
 		TempFileMaxAge:         24 * time.Hour,
+		PriorityAgingAge:       6 * time.Hour,
+		AuditRetention:         90 * 24 * time.Hour,
+		PreviewMaxAge:          30 * 24 * time.Hour,
+		StreamMaxAge:           7 * 24 * time.Hour,
+		StatsInterval:          5 * time.Minute,
+		StatsRetention:         30 * 24 * time.Hour,
+		OrphanScanInterval:     24 * time.Hour,
+		OrphanMinAge:           time.Hour,
+		OrphanRetention:        7 * 24 * time.Hour,
 	}
 }
 
 // Service handles periodic maintenance tasks
 type Service struct {
-	config *Config
-	tasks  port.DownloadTaskRepository
-	fs     port.FileSystem
-	logger *zap.Logger
+	config    *Config
+	tasks     port.DownloadTaskRepository
+	fs        port.FileSystem
+	audit     port.AuditRepository // nil disables audit log cleanup
+	previews  AgeCleaner           // nil disables preview cleanup
+	streams   AgeCleaner           // nil disables stream cleanup
+	snapshots Snapshotter          // nil disables the stats history
+	history   port.StatsRepository
+	logger    *zap.Logger
+
+	references ReferenceCounter // nil disables orphan collection
+	quarantine bool             // Move orphans aside instead of deleting them
+
+	reencrypter Reencrypter // nil disables the re-encryption run
 
 	mu      sync.Mutex
 	running bool
@@ -72,6 +128,33 @@ func New(cfg *Config, tasks port.DownloadTaskRepository, fs port.FileSystem, log
 	if cfg.TempFileMaxAge == 0 {
 		cfg.TempFileMaxAge = 24 * time.Hour
 	}
+	if cfg.PriorityAgingAge == 0 {
+		cfg.PriorityAgingAge = 6 * time.Hour
+	}
+	if cfg.AuditRetention == 0 {
+		cfg.AuditRetention = 90 * 24 * time.Hour
+	}
+	if cfg.PreviewMaxAge == 0 {
+		cfg.PreviewMaxAge = 30 * 24 * time.Hour
+	}
+	if cfg.StreamMaxAge == 0 {
+		cfg.StreamMaxAge = 7 * 24 * time.Hour
+	}
+	if cfg.StatsInterval == 0 {
+		cfg.StatsInterval = 5 * time.Minute
+	}
+	if cfg.StatsRetention == 0 {
+		cfg.StatsRetention = 30 * 24 * time.Hour
+	}
+	if cfg.OrphanScanInterval == 0 {
+		cfg.OrphanScanInterval = 24 * time.Hour
+	}
+	if cfg.OrphanMinAge == 0 {
+		cfg.OrphanMinAge = time.Hour
+	}
+	if cfg.OrphanRetention == 0 {
+		cfg.OrphanRetention = 7 * 24 * time.Hour
+	}
 
 	return &Service{
 		config: cfg,
@@ -81,6 +164,28 @@ func New(cfg *Config, tasks port.DownloadTaskRepository, fs port.FileSystem, log
 	}
 }
 
+// EnableAuditCleanup removes audit events older than AuditRetention on every cleanup run
+func (s *Service) EnableAuditCleanup(audit port.AuditRepository) {
+	s.audit = audit
+}
+
+// EnablePreviewCleanup removes thumbnails older than PreviewMaxAge on every cleanup run
+func (s *Service) EnablePreviewCleanup(previews AgeCleaner) {
+	s.previews = previews
+}
+
+// EnableStreamCleanup removes HLS streams not played within StreamMaxAge on every cleanup run
+func (s *Service) EnableStreamCleanup(streams AgeCleaner) {
+	s.streams = streams
+}
+
+// EnableStatsHistory takes a statistics snapshot every StatsInterval and removes
+// snapshots older than StatsRetention on every cleanup run
+func (s *Service) EnableStatsHistory(snapshots Snapshotter, history port.StatsRepository) {
+	s.snapshots = snapshots
+	s.history = history
+}
+
 // Start starts the maintenance service
 func (s *Service) Start(ctx context.Context) error {
 	s.mu.Lock()
@@ -99,6 +204,14 @@ func (s *Service) Start(ctx context.Context) error {
 	s.wg.Add(1)
 	go s.maintenanceLoop(ctx)
 
+	if s.reencrypter != nil {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.reencryptAll(ctx)
+		}()
+	}
+
 	<-ctx.Done()
 	s.wg.Wait()
 	s.logger.Info("maintenance service stopped")
@@ -125,15 +238,41 @@ func (s *Service) maintenanceLoop(ctx context.Context) {
 	cleanupTicker := time.NewTicker(s.config.CleanupInterval)
 	defer cleanupTicker.Stop()
 
+	// A nil channel never fires when the stats history is disabled
+	var statsTick <-chan time.Time
+	if s.snapshots != nil {
+		statsTicker := time.NewTicker(s.config.StatsInterval)
+		defer statsTicker.Stop()
+		statsTick = statsTicker.C
+	}
+
+	var orphanTick <-chan time.Time
+	if s.references != nil {
+		orphanTicker := time.NewTicker(s.config.OrphanScanInterval)
+		defer orphanTicker.Stop()
+		orphanTick = orphanTicker.C
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case <-staleTaskTicker.C:
 			s.releaseStaleTask()
+			s.boostAgedTasks()
 		case <-cleanupTicker.C:
 			s.cleanupFailedTasks()
 			s.cleanupTempFiles()
+			s.cleanupAuditEvents()
+			s.cleanupPreviews()
+			s.cleanupStreams()
+			s.cleanupStatsHistory()
+			s.cleanupQuarantine()
+			s.cleanupTrash()
+		case <-statsTick:
+			s.snapshots.Snapshot()
+		case <-orphanTick:
+			s.collectOrphans()
 		}
 	}
 }
@@ -148,6 +287,16 @@ func (s *Service) releaseStaleTask() {
 	}
 }
 
+// boostAgedTasks raises the priority of long-waiting tasks to prevent starvation
+func (s *Service) boostAgedTasks() {
+	boosted, err := s.tasks.BoostAgedTasks(s.config.PriorityAgingAge)
+	if err != nil {
+		s.logger.Error("failed to boost aged tasks", zap.Error(err))
+	} else if boosted > 0 {
+		s.logger.Info("boosted priority of aged tasks", zap.Int("count", boosted))
+	}
+}
+
 // cleanupFailedTasks removes old failed tasks
 func (s *Service) cleanupFailedTasks() {
 	cleared, err := s.tasks.CleanupOldFailedTasks(s.config.FailedTaskMaxAge)
@@ -167,3 +316,70 @@ func (s *Service) cleanupTempFiles() {
 		s.logger.Info("cleaned up old temp files from filesystem", zap.Int("count", fileCount))
 	}
 }
+
+// cleanupTrash purges trashed copies beyond the trash budget.
+// Does nothing when the trash is disabled.
+func (s *Service) cleanupTrash() {
+	deleted, err := s.fs.CleanTrash()
+	if err != nil {
+		s.logger.Error("failed to cleanup trash", zap.Error(err))
+	} else if deleted > 0 {
+		s.logger.Info("purged trashed files", zap.Int("count", deleted))
+	}
+}
+
+// cleanupAuditEvents removes audit events past the retention period
+func (s *Service) cleanupAuditEvents() {
+	if s.audit == nil {
+		return
+	}
+
+	deleted, err := s.audit.DeleteAuditEventsBefore(s.config.AuditRetention)
+	if err != nil {
+		s.logger.Error("failed to cleanup audit events", zap.Error(err))
+	} else if deleted > 0 {
+		s.logger.Info("cleaned up old audit events", zap.Int("count", deleted))
+	}
+}
+
+// cleanupPreviews removes old generated thumbnails
+func (s *Service) cleanupPreviews() {
+	if s.previews == nil {
+		return
+	}
+
+	removed, err := s.previews.CleanOld(s.config.PreviewMaxAge)
+	if err != nil {
+		s.logger.Error("failed to cleanup previews", zap.Error(err))
+	} else if removed > 0 {
+		s.logger.Info("cleaned up old previews", zap.Int("count", removed))
+	}
+}
+
+// cleanupStreams removes HLS streams that haven't been played recently
+func (s *Service) cleanupStreams() {
+	if s.streams == nil {
+		return
+	}
+
+	removed, err := s.streams.CleanOld(s.config.StreamMaxAge)
+	if err != nil {
+		s.logger.Error("failed to cleanup streams", zap.Error(err))
+	} else if removed > 0 {
+		s.logger.Info("cleaned up old streams", zap.Int("count", removed))
+	}
+}
+
+// cleanupStatsHistory removes statistics snapshots older than the retention
+func (s *Service) cleanupStatsHistory() {
+	if s.history == nil {
+		return
+	}
+
+	deleted, err := s.history.DeleteStatSnapshotsBefore(s.config.StatsRetention)
+	if err != nil {
+		s.logger.Error("failed to cleanup stats history", zap.Error(err))
+	} else if deleted > 0 {
+		s.logger.Info("cleaned up old stats snapshots", zap.Int("count", deleted))
+	}
+}
@@ -3,6 +3,7 @@ package maintenance
 import (
 	"context"
 	"io"
+	"reflect"
 	"sync"
 	"testing"
 	"time"
@@ -21,6 +22,9 @@ type mockDownloadTaskRepository struct {
 	cleanupFailedErr     error
 	releaseStaleCalled   int
 	cleanupFailedCalled  int
+	boostAgedCount       int
+	boostAgedCalled      int
+	boostAgedAge         time.Duration
 }
 
 func (m *mockDownloadTaskRepository) CreateTask(task *domain.DownloadTask) error {
@@ -29,6 +33,18 @@ func (m *mockDownloadTaskRepository) CreateTask(task *domain.DownloadTask) error
 func (m *mockDownloadTaskRepository) ClaimNextTask(workerID string) (*domain.DownloadTask, error) {
 	return nil, nil
 }
+func (m *mockDownloadTaskRepository) ClaimNextTaskUpTo(workerID string, maxPriority int) (*domain.DownloadTask, error) {
+	return nil, nil
+}
+func (m *mockDownloadTaskRepository) ClaimNextTasks(workerID string, n int, maxTotalBytes int64) ([]*domain.DownloadTask, error) {
+	return nil, nil
+}
+func (m *mockDownloadTaskRepository) ClaimNextTasksUpTo(workerID string, n int, maxTotalBytes int64, maxPriority int) ([]*domain.DownloadTask, error) {
+	return nil, nil
+}
+func (m *mockDownloadTaskRepository) TasksQueued() <-chan struct{} {
+	return nil
+}
 func (m *mockDownloadTaskRepository) GetTask(id int64) (*domain.DownloadTask, error) {
 	return nil, nil
 }
@@ -50,12 +66,31 @@ func (m *mockDownloadTaskRepository) CompleteTask(taskID int64) error {
 func (m *mockDownloadTaskRepository) FailTask(taskID int64, errMsg string, canRetry bool) error {
 	return nil
 }
+func (m *mockDownloadTaskRepository) ReleaseTask(taskID int64) error {
+	return nil
+}
 func (m *mockDownloadTaskRepository) ReleaseStaleInProgressTasks(staleDuration time.Duration) (int, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	m.releaseStaleCalled++
 	return m.releaseStaleCount, m.releaseStaleErr
 }
+func (m *mockDownloadTaskRepository) RenewTaskLease(taskID int64, workerID string) (bool, error) {
+	return true, nil
+}
+func (m *mockDownloadTaskRepository) ReleaseWorkerTasks(workerPrefix string) (int, error) {
+	return 0, nil
+}
+func (m *mockDownloadTaskRepository) BoostAgedTasks(age time.Duration) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.boostAgedCalled++
+	m.boostAgedAge = age
+	return m.boostAgedCount, nil
+}
+func (m *mockDownloadTaskRepository) BoostTaskPriority(fileID int64, priority int) (bool, error) {
+	return false, nil
+}
 func (m *mockDownloadTaskRepository) GetQueueStats() (*domain.QueueStats, error) {
 	return nil, nil
 }
@@ -65,6 +100,15 @@ func (m *mockDownloadTaskRepository) CleanupOldFailedTasks(olderThan time.Durati
 	m.cleanupFailedCalled++
 	return m.cleanupFailedCount, m.cleanupFailedErr
 }
+func (m *mockDownloadTaskRepository) ListTasksByStatus(status string, limit, offset int) ([]*domain.DownloadTask, error) {
+	return nil, nil
+}
+func (m *mockDownloadTaskRepository) RetryFailedTask(taskID int64) error {
+	return nil
+}
+func (m *mockDownloadTaskRepository) RetryFailedTasks(filter domain.FailedTaskFilter) (int, error) {
+	return 0, nil
+}
 func (m *mockDownloadTaskRepository) GetOversizedTasks(maxSize int64) ([]*domain.DownloadTask, error) {
 	return nil, nil
 }
@@ -78,17 +122,48 @@ type mockFileSystem struct {
 	cleanTempFilesCount   int
 	cleanTempFilesErr     error
 	cleanTempFilesCalled  int
+
+	cacheFiles        []mockCacheFile
+	deleted           []string
+	quarantined       []string
+	cleanQuarantineAge time.Duration
+	cleanTrashCalled   int
+}
+
+// mockCacheFile is a file returned by mockFileSystem.WalkCacheFiles
+type mockCacheFile struct {
+	path    string
+	size    int64
+	modTime time.Time
 }
 
 func (m *mockFileSystem) RootDir() string                               { return "" }
 func (m *mockFileSystem) CachePath(synoPath string) string              { return "" }
+func (m *mockFileSystem) TempPath(synoPath string) string               { return "" }
 func (m *mockFileSystem) WriteFile(synoPath string, r io.Reader) (string, int64, error) {
 	return "", 0, nil
 }
 func (m *mockFileSystem) WriteFileWithResume(synoPath string, r io.Reader, resume bool, tempPath string) (string, int64, error) {
 	return "", 0, nil
 }
-func (m *mockFileSystem) DeleteFile(path string) error                  { return nil }
+func (m *mockFileSystem) CreateSegmentFile(tempPath string, size int64) (port.SegmentFile, error) {
+	return nil, nil
+}
+func (m *mockFileSystem) CommitTempFile(synoPath, tempPath string) (string, error) { return "", nil }
+func (m *mockFileSystem) OpenCached(path string) (port.CachedFile, error)     { return nil, nil }
+func (m *mockFileSystem) DeleteFile(path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deleted = append(m.deleted, path)
+	return nil
+}
+func (m *mockFileSystem) CompressFile(path string) (bool, error)        { return false, nil }
+func (m *mockFileSystem) SniffContentType(path string) (string, error)  { return "", nil }
+func (m *mockFileSystem) HashFile(path string) (string, error)          { return "", nil }
+func (m *mockFileSystem) BlobPath(hash string) string                   { return "" }
+func (m *mockFileSystem) StoreBlob(path, hash string) (bool, error)     { return false, nil }
+func (m *mockFileSystem) LinkBlob(path, hash string) (bool, error)      { return false, nil }
+func (m *mockFileSystem) ListBlobs() ([]string, error)                  { return nil, nil }
 func (m *mockFileSystem) FileExists(path string) bool                   { return false }
 func (m *mockFileSystem) GetFileSize(path string) (int64, error)        { return 0, nil }
 func (m *mockFileSystem) GetCacheSize() (int64, error)                  { return 0, nil }
@@ -103,6 +178,37 @@ func (m *mockFileSystem) CleanOldTempFiles(olderThan time.Duration) (int, error)
 	m.cleanTempFilesCalled++
 	return m.cleanTempFilesCount, m.cleanTempFilesErr
 }
+func (m *mockFileSystem) WalkCacheFiles(fn func(string, int64, time.Time) error) error {
+	for _, f := range m.cacheFiles {
+		if err := fn(f.path, f.size, f.modTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+func (m *mockFileSystem) QuarantineFile(path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.quarantined = append(m.quarantined, path)
+	return nil
+}
+func (m *mockFileSystem) CleanOldQuarantine(olderThan time.Duration) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cleanQuarantineAge = olderThan
+	return 0, nil
+}
+func (m *mockFileSystem) TrashFile(path string) error { return nil }
+func (m *mockFileSystem) RestoreTrashed(synoPath string, size int64, modifiedAt time.Time) (string, bool, error) {
+	return "", false, nil
+}
+func (m *mockFileSystem) CleanTrash() (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cleanTrashCalled++
+	return 0, nil
+}
+func (m *mockFileSystem) EmptyTrash() (int64, error) { return 0, nil }
 
 func TestService_New(t *testing.T) {
 	logger := zap.NewNop()
@@ -255,6 +361,48 @@ func TestService_ReleaseStaleTask(t *testing.T) {
 	}
 }
 
+func TestService_BoostAgedTasks(t *testing.T) {
+	logger := zap.NewNop()
+	tasks := &mockDownloadTaskRepository{
+		boostAgedCount: 4,
+	}
+	fs := &mockFileSystem{}
+
+	cfg := &Config{
+		StaleTaskCheckInterval: 10 * time.Millisecond,
+		StaleTaskTimeout:       time.Minute,
+		CleanupInterval:        time.Hour,
+		FailedTaskMaxAge:       time.Hour,
+		TempFileMaxAge:         time.Hour,
+		PriorityAgingAge:       2 * time.Hour,
+	}
+	s := New(cfg, tasks, fs, logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	go func() {
+		s.Start(ctx)
+	}()
+
+	// Wait for the check to run
+	time.Sleep(50 * time.Millisecond)
+
+	cancel()
+	s.Stop()
+
+	tasks.mu.Lock()
+	called := tasks.boostAgedCalled
+	age := tasks.boostAgedAge
+	tasks.mu.Unlock()
+
+	if called == 0 {
+		t.Error("BoostAgedTasks was not called")
+	}
+	if age != 2*time.Hour {
+		t.Errorf("BoostAgedTasks age = %v, want %v", age, 2*time.Hour)
+	}
+}
+
 func TestService_CleanupTasks(t *testing.T) {
 	logger := zap.NewNop()
 	tasks := &mockDownloadTaskRepository{
@@ -291,6 +439,7 @@ func TestService_CleanupTasks(t *testing.T) {
 
 	fs.mu.Lock()
 	tempCleanupCalled := fs.cleanTempFilesCalled
+	trashCleanupCalled := fs.cleanTrashCalled
 	fs.mu.Unlock()
 
 	if cleanupCalled == 0 {
@@ -299,6 +448,9 @@ func TestService_CleanupTasks(t *testing.T) {
 	if tempCleanupCalled == 0 {
 		t.Error("CleanOldTempFiles was not called")
 	}
+	if trashCleanupCalled == 0 {
+		t.Error("CleanTrash was not called")
+	}
 }
 
 func TestDefaultConfig(t *testing.T) {
@@ -319,4 +471,180 @@ func TestDefaultConfig(t *testing.T) {
 	if cfg.TempFileMaxAge != 24*time.Hour {
 		t.Errorf("TempFileMaxAge = %v, want %v", cfg.TempFileMaxAge, 24*time.Hour)
 	}
+	if cfg.PriorityAgingAge != 6*time.Hour {
+		t.Errorf("PriorityAgingAge = %v, want %v", cfg.PriorityAgingAge, 6*time.Hour)
+	}
+}
+
+// mockStatsHistory counts snapshots and retention cleanups
+type mockStatsHistory struct {
+	mu           sync.Mutex
+	snapshots    int
+	deleteCalled int
+	deleteMaxAge time.Duration
+}
+
+func (m *mockStatsHistory) Snapshot() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.snapshots++
+}
+
+func (m *mockStatsHistory) GetCacheStats() (*domain.CacheStats, error) {
+	return &domain.CacheStats{}, nil
+}
+
+func (m *mockStatsHistory) AddStatSnapshot(snapshot *domain.StatSnapshot) error {
+	return nil
+}
+
+func (m *mockStatsHistory) ListStatSnapshots(instance string, since, until time.Time) ([]*domain.StatSnapshot, error) {
+	return nil, nil
+}
+
+func (m *mockStatsHistory) DeleteStatSnapshotsBefore(maxAge time.Duration) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deleteCalled++
+	m.deleteMaxAge = maxAge
+	return 1, nil
+}
+
+func TestService_StatsHistory(t *testing.T) {
+	history := &mockStatsHistory{}
+
+	cfg := &Config{
+		StaleTaskCheckInterval: time.Hour,
+		CleanupInterval:        10 * time.Millisecond,
+		StatsInterval:          10 * time.Millisecond,
+		StatsRetention:         48 * time.Hour,
+	}
+	s := New(cfg, &mockDownloadTaskRepository{}, &mockFileSystem{}, zap.NewNop())
+	s.EnableStatsHistory(history, history)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	go func() {
+		s.Start(ctx)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+
+	cancel()
+	s.Stop()
+
+	history.mu.Lock()
+	defer history.mu.Unlock()
+
+	if history.snapshots == 0 {
+		t.Error("Snapshot was not called")
+	}
+	if history.deleteCalled == 0 {
+		t.Error("DeleteStatSnapshotsBefore was not called")
+	}
+	if history.deleteMaxAge != 48*time.Hour {
+		t.Errorf("DeleteStatSnapshotsBefore maxAge = %v, want %v", history.deleteMaxAge, 48*time.Hour)
+	}
+}
+
+// mockReferences implements ReferenceCounter for testing
+type mockReferences map[string]int
+
+func (m mockReferences) CountCacheReferences(cachePath string) (int, error) {
+	return m[cachePath], nil
+}
+
+func TestService_CollectOrphans(t *testing.T) {
+	old := time.Now().Add(-2 * time.Hour)
+	files := []mockCacheFile{
+		{path: "/cache/mydrive/kept.txt", size: 10, modTime: old},
+		{path: "/cache/mydrive/orphan.txt", size: 20, modTime: old},
+		{path: "/cache/mydrive/fresh.txt", size: 30, modTime: time.Now()},
+	}
+	refs := mockReferences{"/cache/mydrive/kept.txt": 1}
+
+	tests := []struct {
+		name            string
+		quarantine      bool
+		wantDeleted     []string
+		wantQuarantined []string
+	}{
+		{name: "quarantine", quarantine: true, wantQuarantined: []string{"/cache/mydrive/orphan.txt"}},
+		{name: "delete", quarantine: false, wantDeleted: []string{"/cache/mydrive/orphan.txt"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := &mockFileSystem{cacheFiles: files}
+			s := New(&Config{OrphanMinAge: time.Hour}, &mockDownloadTaskRepository{}, fs, zap.NewNop())
+			s.EnableOrphanCollection(refs, tt.quarantine)
+
+			s.collectOrphans()
+
+			if !reflect.DeepEqual(fs.deleted, tt.wantDeleted) {
+				t.Errorf("deleted = %v, want %v", fs.deleted, tt.wantDeleted)
+			}
+			if !reflect.DeepEqual(fs.quarantined, tt.wantQuarantined) {
+				t.Errorf("quarantined = %v, want %v", fs.quarantined, tt.wantQuarantined)
+			}
+		})
+	}
+}
+
+func TestService_CleanupQuarantine(t *testing.T) {
+	fs := &mockFileSystem{}
+	s := New(&Config{OrphanRetention: 48 * time.Hour}, &mockDownloadTaskRepository{}, fs, zap.NewNop())
+
+	// Disabled without orphan collection
+	s.cleanupQuarantine()
+	if fs.cleanQuarantineAge != 0 {
+		t.Fatal("CleanOldQuarantine called with orphan collection disabled")
+	}
+
+	s.EnableOrphanCollection(mockReferences{}, true)
+	s.cleanupQuarantine()
+	if fs.cleanQuarantineAge != 48*time.Hour {
+		t.Errorf("CleanOldQuarantine olderThan = %v, want %v", fs.cleanQuarantineAge, 48*time.Hour)
+	}
+}
+
+// mockReencrypter rewrites the paths listed in plain
+type mockReencrypter struct {
+	plain     map[string]bool
+	rewritten []string
+}
+
+func (m *mockReencrypter) ReencryptFile(path string) (bool, error) {
+	if !m.plain[path] {
+		return false, nil
+	}
+	m.rewritten = append(m.rewritten, path)
+	return true, nil
+}
+
+func TestService_ReencryptAll(t *testing.T) {
+	fs := &mockFileSystem{cacheFiles: []mockCacheFile{
+		{path: "/cache/mydrive/plain.txt"},
+		{path: "/cache/mydrive/current.txt"},
+	}}
+	re := &mockReencrypter{plain: map[string]bool{"/cache/mydrive/plain.txt": true}}
+	s := New(nil, &mockDownloadTaskRepository{}, fs, zap.NewNop())
+
+	// Disabled without a reencrypter
+	s.reencryptAll(context.Background())
+
+	s.EnableReencryption(re)
+	s.reencryptAll(context.Background())
+	if !reflect.DeepEqual(re.rewritten, []string{"/cache/mydrive/plain.txt"}) {
+		t.Errorf("rewritten = %v, want the plain copy", re.rewritten)
+	}
+
+	// A cancelled run stops
+	re.rewritten = nil
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s.reencryptAll(ctx)
+	if len(re.rewritten) != 0 {
+		t.Errorf("rewritten = %v after cancel, want none", re.rewritten)
+	}
 }
@@ -0,0 +1,247 @@
+package metadata
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+)
+
+// Format is the encoding of an export
+type Format string
+
+const (
+	FormatJSON Format = "json" // A JSON array of rows
+	FormatCSV  Format = "csv"  // A header line, then one line per row
+)
+
+// ParseFormat parses a format name, FormatJSON when empty
+func ParseFormat(s string) (Format, error) {
+	switch Format(s) {
+	case "", FormatJSON:
+		return FormatJSON, nil
+	case FormatCSV:
+		return FormatCSV, nil
+	}
+	return "", fmt.Errorf("%w: unknown format %q, use json or csv", domain.ErrInvalidInput, s)
+}
+
+// ContentType returns the MIME type of the format
+func (f Format) ContentType() string {
+	if f == FormatCSV {
+		return "text/csv; charset=utf-8"
+	}
+	return "application/json"
+}
+
+// Table is an exported table
+type Table string
+
+const (
+	TableFiles  Table = "files"
+	TableShares Table = "shares"
+)
+
+// ParseTable parses a table name
+func ParseTable(s string) (Table, error) {
+	switch Table(s) {
+	case TableFiles, TableShares:
+		return Table(s), nil
+	}
+	return "", fmt.Errorf("%w: unknown table %q, use files or shares", domain.ErrInvalidInput, s)
+}
+
+// row is a FileRow or ShareRow
+type row interface {
+	validate() error
+	csvRecord() []string
+	parseCSV(rec *csvRecord) error
+}
+
+// encoder writes rows in a format
+type encoder struct {
+	format Format
+	bw     *bufio.Writer
+	cw     *csv.Writer
+	rows   int
+}
+
+func newEncoder(w io.Writer, format Format, columns []string) (*encoder, error) {
+	e := &encoder{format: format, bw: bufio.NewWriter(w)}
+	if format == FormatCSV {
+		e.cw = csv.NewWriter(e.bw)
+		if err := e.cw.Write(columns); err != nil {
+			return nil, err
+		}
+		return e, nil
+	}
+	if _, err := e.bw.WriteString("["); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *encoder) encode(r row) error {
+	e.rows++
+	if e.cw != nil {
+		return e.cw.Write(r.csvRecord())
+	}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	sep := ",\n"
+	if e.rows == 1 {
+		sep = "\n"
+	}
+	if _, err := e.bw.WriteString(sep); err != nil {
+		return err
+	}
+	_, err = e.bw.Write(data)
+	return err
+}
+
+// close ends the output and flushes it
+func (e *encoder) close() error {
+	if e.cw != nil {
+		e.cw.Flush()
+		if err := e.cw.Error(); err != nil {
+			return err
+		}
+	} else if _, err := e.bw.WriteString("\n]\n"); err != nil {
+		return err
+	}
+	return e.bw.Flush()
+}
+
+// decoder reads rows in a format
+type decoder struct {
+	json *json.Decoder
+	csv  *csv.Reader
+
+	index map[string]int // CSV column positions
+	line  int
+}
+
+func newDecoder(r io.Reader, format Format) (*decoder, error) {
+	if format == FormatCSV {
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = -1
+		header, err := cr.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, fmt.Errorf("%w: empty CSV", domain.ErrInvalidInput)
+			}
+			return nil, fmt.Errorf("%w: %v", domain.ErrInvalidInput, err)
+		}
+		index := make(map[string]int, len(header))
+		for i, name := range header {
+			index[name] = i
+		}
+		return &decoder{csv: cr, index: index, line: 1}, nil
+	}
+
+	jd := json.NewDecoder(r)
+	if tok, err := jd.Token(); err != nil || tok != json.Delim('[') {
+		return nil, fmt.Errorf("%w: expected a JSON array", domain.ErrInvalidInput)
+	}
+	return &decoder{json: jd}, nil
+}
+
+// decode reads the next row into r. Returns io.EOF after the last row.
+func (d *decoder) decode(r row) error {
+	d.line++
+	var err error
+	if d.csv != nil {
+		var values []string
+		values, err = d.csv.Read()
+		if errors.Is(err, io.EOF) {
+			return io.EOF
+		}
+		if err == nil {
+			err = r.parseCSV(&csvRecord{index: d.index, values: values})
+		}
+	} else {
+		if !d.json.More() {
+			return io.EOF
+		}
+		err = d.json.Decode(r)
+	}
+	if err == nil {
+		err = r.validate()
+	}
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidInput) {
+			return fmt.Errorf("row %d: %w", d.line, err)
+		}
+		return fmt.Errorf("%w: row %d: %v", domain.ErrInvalidInput, d.line, err)
+	}
+	return nil
+}
+
+// csvRecord reads the columns of a CSV line by name, keeping the first
+// parse error
+type csvRecord struct {
+	index  map[string]int
+	values []string
+	err    error
+}
+
+// get returns a column, "" when it is missing
+func (rec *csvRecord) get(column string) string {
+	i, ok := rec.index[column]
+	if !ok || i >= len(rec.values) {
+		return ""
+	}
+	return rec.values[i]
+}
+
+func (rec *csvRecord) int64(column string) int64 {
+	s := rec.get(column)
+	if s == "" {
+		return 0
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		rec.fail(column, err)
+	}
+	return n
+}
+
+func (rec *csvRecord) bool(column string) bool {
+	s := rec.get(column)
+	if s == "" {
+		return false
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		rec.fail(column, err)
+	}
+	return b
+}
+
+func (rec *csvRecord) time(column string) *time.Time {
+	s := rec.get(column)
+	if s == "" {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		rec.fail(column, err)
+		return nil
+	}
+	return &t
+}
+
+func (rec *csvRecord) fail(column string, err error) {
+	if rec.err == nil {
+		rec.err = fmt.Errorf("%w: invalid %s: %v", domain.ErrInvalidInput, column, err)
+	}
+}
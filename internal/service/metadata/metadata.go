@@ -0,0 +1,285 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"go.uber.org/zap"
+)
+
+// exportPageSize is the number of files read from the database at a time
+const exportPageSize = 1000
+
+// Store is the part of the database exports and imports use
+type Store interface {
+	GetByID(id int64) (*domain.File, error)
+	GetBySynoID(synoID string) (*domain.File, error)
+	SearchFiles(search domain.FileSearch, limit, offset int) ([]*domain.File, int, error)
+	UpsertBySynoID(file *domain.File) (*domain.UpsertResult, error)
+	Update(file *domain.File) error
+	GetShareByToken(token string) (*domain.Share, error)
+	CreateShare(share *domain.Share) error
+	ListActiveShares() ([]*domain.Share, error)
+}
+
+// Cache is the part of the cache imports check copies in (port.FileSystem)
+type Cache interface {
+	RootDir() string
+	FileExists(cachePath string) bool
+	GetFileSize(cachePath string) (int64, error)
+}
+
+// ImportResult summarizes an import
+type ImportResult struct {
+	Files   int `json:"files"`   // Files created or updated
+	Linked  int `json:"linked"`  // Files re-linked to their copy on disk
+	Missing int `json:"missing"` // Cached files whose copy was not found, to be downloaded again
+	Shares  int `json:"shares"`  // Shares created
+	Skipped int `json:"skipped"` // Existing shares and shares of unknown files
+}
+
+// Service exports the files and shares tables and imports them into another
+// instance, re-linking cached files to the copies found under its cache root
+type Service struct {
+	store  Store
+	cache  Cache
+	logger *zap.Logger
+}
+
+// New creates a new metadata Service
+func New(store Store, cache Cache, logger *zap.Logger) *Service {
+	return &Service{
+		store:  store,
+		cache:  cache,
+		logger: logger,
+	}
+}
+
+// Export writes table to w in format. Returns the number of rows written.
+func (s *Service) Export(ctx context.Context, w io.Writer, table Table, format Format) (int, error) {
+	columns := fileColumns
+	if table == TableShares {
+		columns = shareColumns
+	}
+	enc, err := newEncoder(w, format, columns)
+	if err != nil {
+		return 0, err
+	}
+
+	if table == TableShares {
+		err = s.exportShares(enc)
+	} else {
+		err = s.exportFiles(ctx, enc)
+	}
+	if err != nil {
+		return enc.rows, err
+	}
+	return enc.rows, enc.close()
+}
+
+// exportFiles writes all files, page by page in path order
+func (s *Service) exportFiles(ctx context.Context, enc *encoder) error {
+	search := domain.FileSearch{Sort: domain.FileSortPath}
+	for offset := 0; ; offset += exportPageSize {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		files, _, err := s.store.SearchFiles(search, exportPageSize, offset)
+		if err != nil {
+			return fmt.Errorf("failed to list files: %w", err)
+		}
+		for _, file := range files {
+			if err := enc.encode(newFileRow(file, s.exportPath(file.CachePath))); err != nil {
+				return err
+			}
+		}
+		if len(files) < exportPageSize {
+			return nil
+		}
+	}
+}
+
+// exportShares writes the shares that are not revoked
+func (s *Service) exportShares(enc *encoder) error {
+	shares, err := s.store.ListActiveShares()
+	if err != nil {
+		return fmt.Errorf("failed to list shares: %w", err)
+	}
+
+	synoFileIDs := make(map[int64]string)
+	for _, share := range shares {
+		synoFileID, ok := synoFileIDs[share.FileID]
+		if !ok {
+			file, err := s.store.GetByID(share.FileID)
+			if err != nil {
+				return err
+			}
+			if file != nil {
+				synoFileID = file.SynoFileID
+			}
+			synoFileIDs[share.FileID] = synoFileID
+		}
+		if synoFileID == "" {
+			continue
+		}
+		if err := enc.encode(newShareRow(share, synoFileID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportPath returns cachePath relative to the cache root in slash form,
+// or unchanged when it is outside the root
+func (s *Service) exportPath(cachePath string) string {
+	if cachePath == "" {
+		return ""
+	}
+	rel, err := filepath.Rel(s.cache.RootDir(), cachePath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return cachePath
+	}
+	return filepath.ToSlash(rel)
+}
+
+// importPath resolves an exported cache path under the cache root
+func (s *Service) importPath(cachePath string) string {
+	native := filepath.FromSlash(cachePath)
+	if filepath.IsAbs(native) {
+		return native
+	}
+	return filepath.Join(s.cache.RootDir(), native)
+}
+
+// Import reads table in format from r into the database. Files are created
+// or updated; files exported as cached are marked cached again when their
+// copy is found under the cache root with the expected size, and are left
+// for the cacher to download otherwise. Shares are created unless a share
+// with the same token exists. Import files before their shares.
+func (s *Service) Import(ctx context.Context, r io.Reader, table Table, format Format) (*ImportResult, error) {
+	dec, err := newDecoder(r, format)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ImportResult{}
+	for {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		if table == TableShares {
+			err = s.importShare(dec, result)
+		} else {
+			err = s.importFile(dec, result)
+		}
+		if errors.Is(err, io.EOF) {
+			return result, nil
+		}
+		if err != nil {
+			return result, err
+		}
+	}
+}
+
+// importFile imports the next file row
+func (s *Service) importFile(dec *decoder, result *ImportResult) error {
+	var row FileRow
+	if err := dec.decode(&row); err != nil {
+		return err
+	}
+
+	upserted, err := s.store.UpsertBySynoID(row.file())
+	if err != nil {
+		return fmt.Errorf("failed to import file %s: %w", row.Path, err)
+	}
+	result.Files++
+
+	file := upserted.File
+	if !row.Cached || file.Cached || file.CacheState != "" {
+		return nil
+	}
+
+	cachePath := s.importPath(row.CachePath)
+	if !s.copyMatches(&row, cachePath) {
+		result.Missing++
+		return nil
+	}
+
+	file.MarkCached(cachePath)
+	file.CacheEncoding = row.CacheEncoding
+	file.ExportFormat = row.ExportFormat
+	file.ContentHash = row.ContentHash
+	if row.LastAccessInCacheAt != nil {
+		file.LastAccessInCacheAt = row.LastAccessInCacheAt
+	}
+	if err := s.store.Update(file); err != nil {
+		return fmt.Errorf("failed to link file %s: %w", row.Path, err)
+	}
+	result.Linked++
+	return nil
+}
+
+// copyMatches reports whether the copy of row exists at cachePath.
+// Compressed copies and exported Office documents differ in size from the
+// file, so only plain copies have their size checked.
+func (s *Service) copyMatches(row *FileRow, cachePath string) bool {
+	if row.CachePath == "" || !s.cache.FileExists(cachePath) {
+		s.logger.Debug("cached copy not found",
+			zap.String("path", row.Path),
+			zap.String("cache_path", cachePath))
+		return false
+	}
+	if row.CacheEncoding != "" || row.ExportFormat != "" {
+		return true
+	}
+
+	size, err := s.cache.GetFileSize(cachePath)
+	if err != nil || size != row.Size {
+		s.logger.Warn("cached copy does not match the file, it will be downloaded again",
+			zap.String("path", row.Path),
+			zap.String("cache_path", cachePath),
+			zap.Int64("size", size),
+			zap.Int64("expected_size", row.Size),
+			zap.Error(err))
+		return false
+	}
+	return true
+}
+
+// importShare imports the next share row
+func (s *Service) importShare(dec *decoder, result *ImportResult) error {
+	var row ShareRow
+	if err := dec.decode(&row); err != nil {
+		return err
+	}
+
+	existing, err := s.store.GetShareByToken(row.Token)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		result.Skipped++
+		return nil
+	}
+	file, err := s.store.GetBySynoID(row.SynoFileID)
+	if err != nil {
+		return err
+	}
+	if file == nil {
+		s.logger.Warn("skipping share of an unknown file",
+			zap.String("syno_file_id", row.SynoFileID))
+		result.Skipped++
+		return nil
+	}
+
+	if err := s.store.CreateShare(row.share(file.ID)); err != nil {
+		return fmt.Errorf("failed to create share: %w", err)
+	}
+	result.Shares++
+	return nil
+}
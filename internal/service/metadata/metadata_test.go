@@ -0,0 +1,218 @@
+package metadata
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"go.uber.org/zap"
+)
+
+type fakeStore struct {
+	files  []*domain.File
+	shares []*domain.Share
+}
+
+func (f *fakeStore) GetByID(id int64) (*domain.File, error) {
+	for _, file := range f.files {
+		if file.ID == id {
+			return file, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeStore) GetBySynoID(synoID string) (*domain.File, error) {
+	for _, file := range f.files {
+		if file.SynoFileID == synoID {
+			return file, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeStore) SearchFiles(search domain.FileSearch, limit, offset int) ([]*domain.File, int, error) {
+	if offset >= len(f.files) {
+		return nil, len(f.files), nil
+	}
+	return f.files[offset:min(offset+limit, len(f.files))], len(f.files), nil
+}
+
+func (f *fakeStore) UpsertBySynoID(file *domain.File) (*domain.UpsertResult, error) {
+	if existing, _ := f.GetBySynoID(file.SynoFileID); existing != nil {
+		existing.Path, existing.Size, existing.ModifiedAt = file.Path, file.Size, file.ModifiedAt
+		return &domain.UpsertResult{File: existing}, nil
+	}
+	file.ID = int64(len(f.files) + 1)
+	f.files = append(f.files, file)
+	return &domain.UpsertResult{File: file, Created: true}, nil
+}
+
+func (f *fakeStore) Update(file *domain.File) error {
+	return nil
+}
+
+func (f *fakeStore) GetShareByToken(token string) (*domain.Share, error) {
+	for _, share := range f.shares {
+		if share.Token == token {
+			return share, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeStore) CreateShare(share *domain.Share) error {
+	share.ID = int64(len(f.shares) + 1)
+	f.shares = append(f.shares, share)
+	return nil
+}
+
+func (f *fakeStore) ListActiveShares() ([]*domain.Share, error) {
+	return f.shares, nil
+}
+
+// dirCache checks copies on disk under root
+type dirCache struct {
+	root string
+}
+
+func (c dirCache) RootDir() string {
+	return c.root
+}
+
+func (c dirCache) FileExists(cachePath string) bool {
+	_, err := os.Stat(cachePath)
+	return err == nil
+}
+
+func (c dirCache) GetFileSize(cachePath string) (int64, error) {
+	info, err := os.Stat(cachePath)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func writeCopy(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("MkdirAll() error = %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+}
+
+// sourceStore returns a store with a cached file, an uncached file, a cached
+// file whose copy will be missing on the new host and a share
+func sourceStore(root string) *fakeStore {
+	modified := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	expires := modified.Add(30 * 24 * time.Hour)
+	return &fakeStore{
+		files: []*domain.File{
+			{ID: 1, SynoFileID: "f1", Path: "/team/a, b.txt", Size: 5, ModifiedAt: &modified, Starred: true,
+				Priority: domain.PriorityPinned, Labels: []string{"red", "blue"},
+				Cached: true, CachePath: filepath.Join(root, "team", "a, b.txt")},
+			{ID: 2, SynoFileID: "f2", Path: "/team/big.iso", Size: 1 << 40, Priority: 5},
+			{ID: 3, SynoFileID: "f3", Path: "/team/gone.txt", Size: 3,
+				Cached: true, CachePath: filepath.Join(root, "team", "gone.txt")},
+		},
+		shares: []*domain.Share{
+			{ID: 1, Token: "tok1", SynoShareID: "s1", FileID: 1, Password: "$2a$10$hash", ExpiresAt: &expires,
+				AllowedIPs: []string{"10.0.0.0/8", "192.168.1.1"}, RequireSignature: true, CacheControl: "public, max-age=60"},
+		},
+	}
+}
+
+func TestService_ExportImport(t *testing.T) {
+	for _, format := range []Format{FormatJSON, FormatCSV} {
+		t.Run(string(format), func(t *testing.T) {
+			ctx := context.Background()
+			oldRoot, newRoot := t.TempDir(), t.TempDir()
+			source := New(sourceStore(oldRoot), dirCache{root: oldRoot}, zap.NewNop())
+
+			var files, shares bytes.Buffer
+			if n, err := source.Export(ctx, &files, TableFiles, format); err != nil || n != 3 {
+				t.Fatalf("Export(files) = %d, %v", n, err)
+			}
+			if n, err := source.Export(ctx, &shares, TableShares, format); err != nil || n != 1 {
+				t.Fatalf("Export(shares) = %d, %v", n, err)
+			}
+			if strings.Contains(files.String(), oldRoot) {
+				t.Errorf("export contains the old cache root:\n%s", files.String())
+			}
+
+			// The cache was copied to another root; one copy was lost
+			writeCopy(t, filepath.Join(newRoot, "team", "a, b.txt"), "hello")
+
+			store := &fakeStore{}
+			target := New(store, dirCache{root: newRoot}, zap.NewNop())
+			result, err := target.Import(ctx, &files, TableFiles, format)
+			if err != nil {
+				t.Fatalf("Import(files) error = %v", err)
+			}
+			if result.Files != 3 || result.Linked != 1 || result.Missing != 1 {
+				t.Errorf("Import(files) = %+v", result)
+			}
+
+			f1, _ := store.GetBySynoID("f1")
+			if !f1.Cached || f1.CachePath != filepath.Join(newRoot, "team", "a, b.txt") {
+				t.Errorf("f1 cached = %v at %q", f1.Cached, f1.CachePath)
+			}
+			if f1.Priority != domain.PriorityPinned || !f1.Starred || strings.Join(f1.Labels, ",") != "red,blue" {
+				t.Errorf("f1 = %+v", f1)
+			}
+			if f1.ModifiedAt == nil || !f1.ModifiedAt.Equal(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)) {
+				t.Errorf("f1 modified at %v", f1.ModifiedAt)
+			}
+			if f3, _ := store.GetBySynoID("f3"); f3.Cached {
+				t.Error("file with a missing copy imported as cached")
+			}
+			if f2, _ := store.GetBySynoID("f2"); f2.Size != 1<<40 || f2.Cached {
+				t.Errorf("f2 = %+v", f2)
+			}
+
+			result, err = target.Import(ctx, &shares, TableShares, format)
+			if err != nil {
+				t.Fatalf("Import(shares) error = %v", err)
+			}
+			if result.Shares != 1 {
+				t.Errorf("Import(shares) = %+v", result)
+			}
+			share, _ := store.GetShareByToken("tok1")
+			if share == nil || share.FileID != f1.ID || share.Password != "$2a$10$hash" ||
+				!share.RequireSignature || len(share.AllowedIPs) != 2 || share.ExpiresAt == nil ||
+				share.CacheControl != "public, max-age=60" {
+				t.Errorf("share = %+v", share)
+			}
+		})
+	}
+}
+
+func TestService_ImportInvalid(t *testing.T) {
+	s := New(&fakeStore{}, dirCache{root: t.TempDir()}, zap.NewNop())
+	tests := []struct {
+		name   string
+		format Format
+		input  string
+	}{
+		{"not an array", FormatJSON, `{"syno_file_id": "f1"}`},
+		{"missing path", FormatJSON, `[{"syno_file_id": "f1"}]`},
+		{"bad size", FormatCSV, "syno_file_id,path,size\nf1,/a,big\n"},
+		{"empty csv", FormatCSV, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.Import(context.Background(), strings.NewReader(tt.input), TableFiles, tt.format)
+			if !errors.Is(err, domain.ErrInvalidInput) {
+				t.Errorf("Import() error = %v, want ErrInvalidInput", err)
+			}
+		})
+	}
+}
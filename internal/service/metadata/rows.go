@@ -0,0 +1,231 @@
+package metadata
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+)
+
+// FileRow is an exported file. CachePath is relative to the cache root when
+// the copy is inside it, so the copy can be re-linked under another root.
+type FileRow struct {
+	SynoFileID          string     `json:"syno_file_id"`
+	Path                string     `json:"path"`
+	Size                int64      `json:"size"`
+	ModifiedAt          *time.Time `json:"modified_at,omitempty"`
+	Starred             bool       `json:"starred"`
+	Shared              bool       `json:"shared"`
+	Priority            int        `json:"priority"`
+	Owner               string     `json:"owner,omitempty"`
+	Labels              []string   `json:"labels,omitempty"`
+	ContentType         string     `json:"content_type,omitempty"`
+	Cached              bool       `json:"cached"`
+	CachePath           string     `json:"cache_path,omitempty"`
+	CacheEncoding       string     `json:"cache_encoding,omitempty"`
+	ExportFormat        string     `json:"export_format,omitempty"`
+	ContentHash         string     `json:"content_hash,omitempty"`
+	LastAccessInCacheAt *time.Time `json:"last_access_in_cache_at,omitempty"`
+}
+
+// fileColumns is the CSV header of files
+var fileColumns = []string{
+	"syno_file_id", "path", "size", "modified_at", "starred", "shared", "priority", "owner", "labels",
+	"content_type", "cached", "cache_path", "cache_encoding", "export_format", "content_hash", "last_access_in_cache_at",
+}
+
+// newFileRow describes file, with cachePath as it is exported
+func newFileRow(file *domain.File, cachePath string) *FileRow {
+	row := &FileRow{
+		SynoFileID:  file.SynoFileID,
+		Path:        file.Path,
+		Size:        file.Size,
+		ModifiedAt:  file.ModifiedAt,
+		Starred:     file.Starred,
+		Shared:      file.Shared,
+		Priority:    file.Priority,
+		Owner:       file.Owner,
+		Labels:      file.Labels,
+		ContentType: file.ContentType,
+		Cached:      file.Cached,
+	}
+	if file.Cached {
+		row.CachePath = cachePath
+		row.CacheEncoding = file.CacheEncoding
+		row.ExportFormat = file.ExportFormat
+		row.ContentHash = file.ContentHash
+		row.LastAccessInCacheAt = file.LastAccessInCacheAt
+	}
+	return row
+}
+
+// file returns the file described, not cached
+func (r *FileRow) file() *domain.File {
+	return &domain.File{
+		SynoFileID:  r.SynoFileID,
+		Path:        r.Path,
+		Size:        r.Size,
+		ModifiedAt:  r.ModifiedAt,
+		Starred:     r.Starred,
+		Shared:      r.Shared,
+		Priority:    r.Priority,
+		Owner:       r.Owner,
+		Labels:      r.Labels,
+		ContentType: r.ContentType,
+	}
+}
+
+func (r *FileRow) validate() error {
+	if r.SynoFileID == "" || r.Path == "" {
+		return fmt.Errorf("%w: file without syno_file_id or path", domain.ErrInvalidInput)
+	}
+	return nil
+}
+
+func (r *FileRow) csvRecord() []string {
+	return []string{
+		r.SynoFileID, r.Path, formatInt(r.Size), formatTime(r.ModifiedAt),
+		strconv.FormatBool(r.Starred), strconv.FormatBool(r.Shared), strconv.Itoa(r.Priority),
+		r.Owner, domain.EncodeLabels(r.Labels), r.ContentType, strconv.FormatBool(r.Cached),
+		r.CachePath, r.CacheEncoding, r.ExportFormat, r.ContentHash, formatTime(r.LastAccessInCacheAt),
+	}
+}
+
+func (r *FileRow) parseCSV(rec *csvRecord) error {
+	r.SynoFileID = rec.get("syno_file_id")
+	r.Path = rec.get("path")
+	r.Owner = rec.get("owner")
+	r.Labels = domain.DecodeLabels(rec.get("labels"))
+	r.ContentType = rec.get("content_type")
+	r.CachePath = rec.get("cache_path")
+	r.CacheEncoding = rec.get("cache_encoding")
+	r.ExportFormat = rec.get("export_format")
+	r.ContentHash = rec.get("content_hash")
+
+	r.Size = rec.int64("size")
+	r.ModifiedAt = rec.time("modified_at")
+	r.Starred = rec.bool("starred")
+	r.Shared = rec.bool("shared")
+	r.Priority = int(rec.int64("priority"))
+	r.Cached = rec.bool("cached")
+	r.LastAccessInCacheAt = rec.time("last_access_in_cache_at")
+	return rec.err
+}
+
+// ShareRow is an exported share, referring to its file by Synology file ID.
+// Passwords are exported hashed. CreatedAt and DownloadCount are for
+// reference only; imported shares start with a new creation time and count.
+type ShareRow struct {
+	SynoFileID       string     `json:"syno_file_id"`
+	SynoShareID      string     `json:"syno_share_id"`
+	Token            string     `json:"token"`
+	SharingLink      string     `json:"sharing_link,omitempty"`
+	URL              string     `json:"url,omitempty"`
+	Password         string     `json:"password,omitempty"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	MaxDownloads     int        `json:"max_downloads,omitempty"`
+	NASMaxDownloads  int        `json:"nas_max_downloads,omitempty"`
+	DownloadCount    int64      `json:"download_count,omitempty"`
+	AllowedIPs       []string   `json:"allowed_ips,omitempty"`
+	DeniedIPs        []string   `json:"denied_ips,omitempty"`
+	RequireSignature bool       `json:"require_signature,omitempty"`
+	CacheControl     string     `json:"cache_control,omitempty"`
+}
+
+// shareColumns is the CSV header of shares
+var shareColumns = []string{
+	"syno_file_id", "syno_share_id", "token", "sharing_link", "url", "password", "expires_at", "created_at",
+	"max_downloads", "nas_max_downloads", "download_count", "allowed_ips", "denied_ips", "require_signature", "cache_control",
+}
+
+// newShareRow describes share of the file with a Synology file ID
+func newShareRow(share *domain.Share, synoFileID string) *ShareRow {
+	return &ShareRow{
+		SynoFileID:       synoFileID,
+		SynoShareID:      share.SynoShareID,
+		Token:            share.Token,
+		SharingLink:      share.SharingLink,
+		URL:              share.URL,
+		Password:         share.Password,
+		ExpiresAt:        share.ExpiresAt,
+		CreatedAt:        share.CreatedAt,
+		MaxDownloads:     share.MaxDownloads,
+		NASMaxDownloads:  share.NASMaxDownloads,
+		DownloadCount:    share.DownloadCount,
+		AllowedIPs:       share.AllowedIPs,
+		DeniedIPs:        share.DeniedIPs,
+		RequireSignature: share.RequireSignature,
+		CacheControl:     share.CacheControl,
+	}
+}
+
+// share returns the share described, for the file with fileID
+func (r *ShareRow) share(fileID int64) *domain.Share {
+	return &domain.Share{
+		SynoShareID:      r.SynoShareID,
+		Token:            r.Token,
+		SharingLink:      r.SharingLink,
+		URL:              r.URL,
+		FileID:           fileID,
+		Password:         r.Password,
+		ExpiresAt:        r.ExpiresAt,
+		MaxDownloads:     r.MaxDownloads,
+		NASMaxDownloads:  r.NASMaxDownloads,
+		AllowedIPs:       r.AllowedIPs,
+		DeniedIPs:        r.DeniedIPs,
+		RequireSignature: r.RequireSignature,
+		CacheControl:     r.CacheControl,
+	}
+}
+
+func (r *ShareRow) validate() error {
+	if r.SynoFileID == "" || r.Token == "" {
+		return fmt.Errorf("%w: share without syno_file_id or token", domain.ErrInvalidInput)
+	}
+	return nil
+}
+
+func (r *ShareRow) csvRecord() []string {
+	return []string{
+		r.SynoFileID, r.SynoShareID, r.Token, r.SharingLink, r.URL, r.Password,
+		formatTime(r.ExpiresAt), formatTime(&r.CreatedAt),
+		strconv.Itoa(r.MaxDownloads), strconv.Itoa(r.NASMaxDownloads), formatInt(r.DownloadCount),
+		domain.EncodeLabels(r.AllowedIPs), domain.EncodeLabels(r.DeniedIPs), strconv.FormatBool(r.RequireSignature), r.CacheControl,
+	}
+}
+
+func (r *ShareRow) parseCSV(rec *csvRecord) error {
+	r.SynoFileID = rec.get("syno_file_id")
+	r.SynoShareID = rec.get("syno_share_id")
+	r.Token = rec.get("token")
+	r.SharingLink = rec.get("sharing_link")
+	r.URL = rec.get("url")
+	r.Password = rec.get("password")
+	r.AllowedIPs = domain.DecodeLabels(rec.get("allowed_ips"))
+	r.DeniedIPs = domain.DecodeLabels(rec.get("denied_ips"))
+	r.CacheControl = rec.get("cache_control")
+
+	r.ExpiresAt = rec.time("expires_at")
+	if createdAt := rec.time("created_at"); createdAt != nil {
+		r.CreatedAt = *createdAt
+	}
+	r.MaxDownloads = int(rec.int64("max_downloads"))
+	r.NASMaxDownloads = int(rec.int64("nas_max_downloads"))
+	r.DownloadCount = rec.int64("download_count")
+	r.RequireSignature = rec.bool("require_signature")
+	return rec.err
+}
+
+func formatInt(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
+
+// formatTime formats an optional time for CSV, "" for none
+func formatTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
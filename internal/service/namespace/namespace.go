@@ -0,0 +1,187 @@
+package namespace
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/vertextoedge/synology-file-cache/internal/util/reqid"
+	"go.uber.org/zap"
+)
+
+// PathPrefix is the URL prefix namespaces are served under: /t/{name}/
+const PathPrefix = "/t/"
+
+// Runner is a background service of a namespace (syncer, cacher, maintenance)
+type Runner interface {
+	Start(ctx context.Context) error
+	Stop()
+}
+
+// Instance is one namespace: its HTTP handler and the services that keep
+// its cache filled
+type Instance struct {
+	Name string
+
+	// Handler serves the namespace with paths relative to its prefix
+	// (/f/{token}, /api/v1/...)
+	Handler http.Handler
+
+	// Connect is called before Upstream services start and returns once the
+	// NAS of the namespace is reachable; nil starts them right away
+	Connect func(ctx context.Context) error
+
+	Services []Runner // Started right away
+	Upstream []Runner // Started after Connect succeeds
+
+	// Close releases what the instance holds (database) after its services stopped
+	Close func() error
+
+	prefix http.Handler
+}
+
+// Manager runs the namespaces and routes /t/{name}/ requests to them
+type Manager struct {
+	logger *zap.Logger
+
+	mu        sync.Mutex
+	instances map[string]*Instance
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+}
+
+// NewManager creates a Manager without namespaces
+func NewManager(logger *zap.Logger) *Manager {
+	return &Manager{
+		logger:    logger,
+		instances: make(map[string]*Instance),
+	}
+}
+
+// Add registers a namespace; it must be called before Start
+func (m *Manager) Add(inst *Instance) error {
+	if inst.Name == "" || strings.Contains(inst.Name, "/") {
+		return fmt.Errorf("invalid namespace name %q", inst.Name)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.instances[inst.Name]; ok {
+		return fmt.Errorf("namespace %q already exists", inst.Name)
+	}
+	inst.prefix = http.StripPrefix(strings.TrimSuffix(PathPrefix, "/")+"/"+inst.Name, inst.Handler)
+	m.instances[inst.Name] = inst
+	return nil
+}
+
+// Names returns the namespace names in order
+func (m *Manager) Names() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := make([]string, 0, len(m.instances))
+	for name := range m.instances {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Start starts the services of every namespace and returns; Stop stops them
+func (m *Manager) Start(ctx context.Context) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ctx, m.cancel = context.WithCancel(ctx)
+
+	for _, inst := range m.instances {
+		logger := m.logger.With(zap.String("namespace", inst.Name))
+		for _, svc := range inst.Services {
+			m.run(ctx, svc, logger)
+		}
+		if len(inst.Upstream) == 0 {
+			continue
+		}
+
+		m.wg.Add(1)
+		go func() {
+			defer m.wg.Done()
+			if inst.Connect != nil {
+				if err := inst.Connect(ctx); err != nil {
+					return
+				}
+			}
+			logger.Info("namespace connected to Synology NAS")
+			for _, svc := range inst.Upstream {
+				m.run(ctx, svc, logger)
+			}
+		}()
+	}
+	m.logger.Info("namespaces started", zap.Int("count", len(m.instances)))
+}
+
+// run starts svc in the background
+func (m *Manager) run(ctx context.Context, svc Runner, logger *zap.Logger) {
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		if err := svc.Start(ctx); err != nil && err != context.Canceled {
+			logger.Error("namespace service stopped with error", zap.Error(err))
+		}
+	}()
+}
+
+// Stop stops the services of every namespace, waits for them and closes
+// the namespaces
+func (m *Manager) Stop() {
+	m.mu.Lock()
+	if m.cancel != nil {
+		m.cancel()
+	}
+	instances := make([]*Instance, 0, len(m.instances))
+	for _, inst := range m.instances {
+		instances = append(instances, inst)
+	}
+	m.mu.Unlock()
+
+	for _, inst := range instances {
+		for _, svc := range inst.Services {
+			svc.Stop()
+		}
+		for _, svc := range inst.Upstream {
+			svc.Stop()
+		}
+	}
+	m.wg.Wait()
+
+	for _, inst := range instances {
+		if inst.Close == nil {
+			continue
+		}
+		if err := inst.Close(); err != nil {
+			m.logger.Warn("failed to close namespace",
+				zap.String("namespace", inst.Name),
+				zap.Error(err))
+		}
+	}
+}
+
+// ServeHTTP routes /t/{name}/... to the namespace with its prefix removed
+func (m *Manager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, PathPrefix), "/")
+
+	m.mu.Lock()
+	inst, ok := m.instances[name]
+	m.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	// Keep the request ID assigned by the outer server
+	if id := reqid.FromContext(r.Context()); id != "" {
+		r.Header.Set(reqid.Header, id)
+	}
+	inst.prefix.ServeHTTP(w, r)
+}
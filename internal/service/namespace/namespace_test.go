@@ -0,0 +1,111 @@
+package namespace
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/vertextoedge/synology-file-cache/internal/util/reqid"
+	"go.uber.org/zap"
+)
+
+type fakeRunner struct {
+	mu      sync.Mutex
+	started bool
+	stopped bool
+}
+
+func (f *fakeRunner) Start(ctx context.Context) error {
+	f.mu.Lock()
+	f.started = true
+	f.mu.Unlock()
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (f *fakeRunner) Stop() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.stopped = true
+}
+
+func (f *fakeRunner) state() (bool, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.started, f.stopped
+}
+
+func TestManager_ServeHTTP(t *testing.T) {
+	m := NewManager(zap.NewNop())
+	var gotPath, gotID string
+	err := m.Add(&Instance{
+		Name: "design",
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotPath = r.URL.Path
+			gotID = r.Header.Get(reqid.Header)
+		}),
+	})
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if err := m.Add(&Instance{Name: "design"}); err == nil {
+		t.Error("Add(duplicate) error = nil")
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/t/design/f/abc", nil)
+	r = r.WithContext(reqid.WithID(r.Context(), "req-1", zap.NewNop()))
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || gotPath != "/f/abc" || gotID != "req-1" {
+		t.Errorf("ServeHTTP() = %d, path %q, request ID %q", w.Code, gotPath, gotID)
+	}
+
+	w = httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/t/sales/f/abc", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unknown namespace status = %d, want 404", w.Code)
+	}
+}
+
+func TestManager_StartStop(t *testing.T) {
+	m := NewManager(zap.NewNop())
+	maintenance, syncer, unreachable := &fakeRunner{}, &fakeRunner{}, &fakeRunner{}
+	closed := 0
+	connected := make(chan struct{})
+
+	m.Add(&Instance{
+		Name:     "design",
+		Handler:  http.NotFoundHandler(),
+		Connect:  func(ctx context.Context) error { close(connected); return nil },
+		Services: []Runner{maintenance},
+		Upstream: []Runner{syncer},
+		Close:    func() error { closed++; return nil },
+	})
+	m.Add(&Instance{
+		Name:     "sales",
+		Handler:  http.NotFoundHandler(),
+		Connect:  func(ctx context.Context) error { <-ctx.Done(); return errors.New("NAS down") },
+		Upstream: []Runner{unreachable},
+		Close:    func() error { closed++; return nil },
+	})
+
+	m.Start(context.Background())
+	<-connected
+	m.Stop()
+
+	if started, stopped := maintenance.state(); !started || !stopped {
+		t.Errorf("maintenance started = %v, stopped = %v", started, stopped)
+	}
+	if started, stopped := syncer.state(); !started || !stopped {
+		t.Errorf("syncer started = %v, stopped = %v", started, stopped)
+	}
+	if started, _ := unreachable.state(); started {
+		t.Error("service started before its NAS was reachable")
+	}
+	if closed != 2 {
+		t.Errorf("closed %d namespaces, want 2", closed)
+	}
+}
@@ -0,0 +1,288 @@
+// Package partial serves files whose download into the cache is still in
+// progress. Bytes already downloaded are read from the growing temp file as
+// the download writes them; ranges the download has not reached are proxied
+// from the NAS.
+package partial
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"github.com/vertextoedge/synology-file-cache/internal/util/reqid"
+	"go.uber.org/zap"
+)
+
+// pollInterval is how often a read waiting for the download checks the temp file
+const pollInterval = 100 * time.Millisecond
+
+// errRangeIgnored is returned when the NAS answers a range request with the whole file
+var errRangeIgnored = errors.New("NAS ignored the range request")
+
+// Downloader reads file ranges from the NAS
+type Downloader interface {
+	DownloadFileWithRange(ctx context.Context, fileID int64, path string, rangeStart int64) (io.ReadCloser, string, int64, error)
+}
+
+// Config contains partial serving configuration
+type Config struct {
+	// WaitTimeout is how long a read waits for the download to reach it.
+	// After that the rest of the response is proxied from the NAS.
+	WaitTimeout time.Duration
+
+	// MaxLead is how far past the downloaded bytes a read may start and still
+	// wait for the download; reads further ahead are proxied right away
+	MaxLead int64
+
+	// OfficeExport is cache.office_export. Office documents being exported
+	// are not served, their temp file holds the export.
+	OfficeExport string
+}
+
+// DefaultConfig returns default partial serving configuration
+func DefaultConfig() *Config {
+	return &Config{
+		WaitTimeout: 10 * time.Second,
+		MaxLead:     16 * 1024 * 1024,
+	}
+}
+
+// Source opens readers over files being downloaded by the cacher
+type Source struct {
+	config *Config
+	tasks  port.DownloadTaskRepository
+	drive  Downloader
+	logger *zap.Logger
+}
+
+// New creates a new Source
+func New(cfg *Config, tasks port.DownloadTaskRepository, drive Downloader, logger *zap.Logger) *Source {
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+	return &Source{
+		config: cfg,
+		tasks:  tasks,
+		drive:  drive,
+		logger: logger,
+	}
+}
+
+// Open returns a reader over file if a worker of this instance is
+// downloading it in one stream, nil otherwise. Segmented downloads and
+// downloads of other instances record no temp file readable here.
+func (s *Source) Open(ctx context.Context, file *domain.File) (*Reader, error) {
+	if file.Size <= 0 || domain.OfficeExportFormat(file.Path, s.config.OfficeExport) != "" {
+		return nil, nil
+	}
+
+	task, err := s.tasks.GetTaskByFileID(file.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get download task: %w", err)
+	}
+	if task == nil || task.Status != domain.TaskStatusInProgress || task.TempFilePath == "" {
+		return nil, nil
+	}
+
+	temp, err := os.Open(task.TempFilePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open temp file: %w", err)
+	}
+
+	// A temp file left by an attempt at an older version is about to be replaced
+	info, err := temp.Stat()
+	if err != nil || (file.ModifiedAt != nil && file.ModifiedAt.After(info.ModTime())) {
+		temp.Close()
+		return nil, err
+	}
+
+	return &Reader{
+		source:     s,
+		ctx:        ctx,
+		file:       file,
+		temp:       temp,
+		downloaded: info.Size(),
+	}, nil
+}
+
+// Reader reads a file being downloaded, following its temp file and
+// switching to the NAS for good once the download falls behind
+type Reader struct {
+	source *Source
+	ctx    context.Context
+	file   *domain.File
+	offset int64
+
+	temp       *os.File
+	downloaded int64 // Largest temp file size seen
+	proxy      bool  // Reads go to the NAS
+
+	upstream   io.ReadCloser // Open NAS response, positioned at upstreamAt
+	upstreamAt int64
+
+	proxied int64 // Bytes read from the NAS
+	err     error // Last read error other than io.EOF
+}
+
+// Read reads from the current offset
+func (r *Reader) Read(p []byte) (int, error) {
+	if r.offset >= r.file.Size {
+		return 0, io.EOF
+	}
+	if remaining := r.file.Size - r.offset; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+
+	if !r.proxy {
+		n, err := r.readTemp(p)
+		if n > 0 || err != nil {
+			return n, r.fail(err)
+		}
+	}
+	n, err := r.readUpstream(p)
+	return n, r.fail(err)
+}
+
+// readTemp reads from the temp file, waiting for the download to reach the
+// offset. Returns 0 and no error once the reader has switched to the NAS.
+func (r *Reader) readTemp(p []byte) (int, error) {
+	lastGrowth := time.Now()
+	for {
+		info, err := r.temp.Stat()
+		if err != nil {
+			return 0, fmt.Errorf("failed to stat temp file: %w", err)
+		}
+		switch size := info.Size(); {
+		case size < r.downloaded:
+			// The download started over; the temp file no longer follows it
+			return r.switchToNAS("download restarted")
+		case size > r.downloaded:
+			r.downloaded = size
+			lastGrowth = time.Now()
+		}
+
+		if r.offset < r.downloaded {
+			if available := r.downloaded - r.offset; int64(len(p)) > available {
+				p = p[:available]
+			}
+			n, err := r.temp.ReadAt(p, r.offset)
+			r.offset += int64(n)
+			if err == io.EOF && n > 0 {
+				err = nil
+			}
+			return n, err
+		}
+
+		if r.offset-r.downloaded > r.source.config.MaxLead {
+			return r.switchToNAS("range not downloaded yet")
+		}
+		if time.Since(lastGrowth) >= r.source.config.WaitTimeout {
+			return r.switchToNAS("download stalled")
+		}
+
+		select {
+		case <-r.ctx.Done():
+			return 0, r.ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// switchToNAS makes all further reads go to the NAS
+func (r *Reader) switchToNAS(reason string) (int, error) {
+	reqid.Logger(r.ctx, r.source.logger).Debug("proxying rest of in-progress download from the NAS",
+		zap.String("path", r.file.Path),
+		zap.String("reason", reason),
+		zap.Int64("offset", r.offset),
+		zap.Int64("downloaded", r.downloaded))
+	r.proxy = true
+	return 0, nil
+}
+
+// readUpstream reads from the NAS, opening a range request at the offset
+// unless the open response is already there
+func (r *Reader) readUpstream(p []byte) (int, error) {
+	if r.upstream == nil || r.upstreamAt != r.offset {
+		r.closeUpstream()
+		body, _, size, err := r.source.drive.DownloadFileWithRange(r.ctx, 0, r.file.Path, r.offset)
+		if err != nil {
+			return 0, fmt.Errorf("download failed: %w", err)
+		}
+		if r.offset > 0 && size == r.file.Size {
+			body.Close()
+			return 0, errRangeIgnored
+		}
+		r.upstream, r.upstreamAt = body, r.offset
+	}
+
+	n, err := r.upstream.Read(p)
+	r.offset += int64(n)
+	r.upstreamAt = r.offset
+	r.proxied += int64(n)
+	if err == io.EOF {
+		r.closeUpstream()
+		if n == 0 {
+			return 0, fmt.Errorf("NAS response for %s ended early", r.file.Path)
+		}
+		err = nil
+	}
+	return n, err
+}
+
+// Seek sets the offset for the next Read
+func (r *Reader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.file.Size
+	default:
+		return 0, fmt.Errorf("invalid whence %d", whence)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("negative offset")
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+// Close closes the temp file and any open NAS response
+func (r *Reader) Close() error {
+	r.closeUpstream()
+	return r.temp.Close()
+}
+
+// closeUpstream closes the open NAS response, if any
+func (r *Reader) closeUpstream() {
+	if r.upstream != nil {
+		r.upstream.Close()
+		r.upstream = nil
+	}
+}
+
+// fail records err as the last read error
+func (r *Reader) fail(err error) error {
+	if err != nil {
+		r.err = err
+	}
+	return err
+}
+
+// Proxied returns how many bytes were read from the NAS instead of the temp file
+func (r *Reader) Proxied() int64 {
+	return r.proxied
+}
+
+// Err returns the last error a Read failed with, nil if all reads succeeded
+func (r *Reader) Err() error {
+	return r.err
+}
@@ -0,0 +1,107 @@
+package partial
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"go.uber.org/zap"
+)
+
+// mockTaskRepository returns one task for every file
+type mockTaskRepository struct {
+	port.DownloadTaskRepository
+	task *domain.DownloadTask
+}
+
+func (m *mockTaskRepository) GetTaskByFileID(fileID int64) (*domain.DownloadTask, error) {
+	return m.task, nil
+}
+
+// mockDownloader serves ranges of content
+type mockDownloader struct {
+	content []byte
+	starts  []int64
+}
+
+func (m *mockDownloader) DownloadFileWithRange(ctx context.Context, fileID int64, path string, rangeStart int64) (io.ReadCloser, string, int64, error) {
+	m.starts = append(m.starts, rangeStart)
+	body := m.content[rangeStart:]
+	return io.NopCloser(bytes.NewReader(body)), "", int64(len(body)), nil
+}
+
+func TestReader_FollowsDownload(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 100)
+	tempPath := filepath.Join(t.TempDir(), "a.downloading")
+	if err := os.WriteFile(tempPath, content[:300], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tasks := &mockTaskRepository{task: &domain.DownloadTask{Status: domain.TaskStatusInProgress, TempFilePath: tempPath}}
+	drive := &mockDownloader{content: content}
+	source := New(&Config{WaitTimeout: time.Second, MaxLead: 1000}, tasks, drive, zap.NewNop())
+	file := &domain.File{ID: 1, Path: "/a.bin", Size: int64(len(content))}
+
+	reader, err := source.Open(context.Background(), file)
+	if err != nil || reader == nil {
+		t.Fatalf("Open() = %v, %v", reader, err)
+	}
+	defer reader.Close()
+
+	// The rest of the file arrives while the reader waits for it
+	go func() {
+		time.Sleep(3 * pollInterval)
+		f, _ := os.OpenFile(tempPath, os.O_WRONLY|os.O_APPEND, 0644)
+		f.Write(content[300:])
+		f.Close()
+	}()
+
+	got, err := io.ReadAll(reader)
+	if err != nil || !bytes.Equal(got, content) {
+		t.Fatalf("ReadAll() = %d bytes, %v", len(got), err)
+	}
+	if reader.Proxied() != 0 || len(drive.starts) != 0 {
+		t.Errorf("proxied %d bytes from %v, want none", reader.Proxied(), drive.starts)
+	}
+}
+
+func TestReader_ProxiesAhead(t *testing.T) {
+	content := bytes.Repeat([]byte("abcdefghij"), 100)
+	tempPath := filepath.Join(t.TempDir(), "a.downloading")
+	if err := os.WriteFile(tempPath, content[:100], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tasks := &mockTaskRepository{task: &domain.DownloadTask{Status: domain.TaskStatusInProgress, TempFilePath: tempPath}}
+	drive := &mockDownloader{content: content}
+	source := New(&Config{WaitTimeout: time.Second, MaxLead: 200}, tasks, drive, zap.NewNop())
+	reader, err := source.Open(context.Background(), &domain.File{ID: 1, Path: "/a.bin", Size: int64(len(content))})
+	if err != nil || reader == nil {
+		t.Fatalf("Open() = %v, %v", reader, err)
+	}
+	defer reader.Close()
+
+	// A range far past the downloaded bytes comes from the NAS right away
+	if _, err := reader.Seek(900, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(reader)
+	if err != nil || !bytes.Equal(got, content[900:]) {
+		t.Fatalf("ReadAll() = %q, %v", got, err)
+	}
+	if reader.Proxied() != 100 || len(drive.starts) != 1 || drive.starts[0] != 900 {
+		t.Errorf("proxied %d bytes from %v, want 100 from 900", reader.Proxied(), drive.starts)
+	}
+
+	// Files without a download in progress are not served
+	tasks.task = &domain.DownloadTask{Status: domain.TaskStatusPending, TempFilePath: tempPath}
+	if reader, err := source.Open(context.Background(), &domain.File{ID: 1, Path: "/a.bin", Size: 1000}); reader != nil || err != nil {
+		t.Errorf("Open() of a pending task = %v, %v, want nil", reader, err)
+	}
+}
@@ -0,0 +1,393 @@
+package preview
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	// Register stdlib image decoders
+	_ "image/gif"
+	_ "image/png"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/util/cryptfile"
+	"go.uber.org/zap"
+)
+
+// ErrUnsupported is returned for files that have no preview
+var ErrUnsupported = errors.New("preview not supported for this file type")
+
+// sizeBuckets are the thumbnail sizes generated; requested sizes are rounded up
+// so arbitrary size parameters cannot fill the preview directory
+var sizeBuckets = []int{64, 128, 256, 512, 1024}
+
+// maxImagePixels bounds in-process image decoding (about 400MB as RGBA)
+const maxImagePixels = 100_000_000
+
+// imageExtensions are decoded with the Go standard library
+var imageExtensions = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true,
+}
+
+// ffmpegExtensions need ffmpeg: videos (poster frame) and image formats the stdlib can't decode
+var ffmpegExtensions = map[string]bool{
+	".mp4": true, ".m4v": true, ".mov": true, ".mkv": true, ".avi": true,
+	".webm": true, ".wmv": true, ".mpg": true, ".mpeg": true, ".ts": true, ".3gp": true,
+	".webp": true, ".heic": true, ".heif": true, ".bmp": true, ".tif": true, ".tiff": true,
+}
+
+// Config contains preview generator configuration
+type Config struct {
+	// Dir is where generated thumbnails are stored
+	Dir string
+
+	// FFmpegPath is the ffmpeg binary; empty looks up "ffmpeg" in PATH.
+	// Video posters are unavailable when ffmpeg cannot be found.
+	FFmpegPath string
+
+	// DefaultSize is used when no size is requested
+	DefaultSize int
+
+	// MaxSourceSize is the largest image decoded in-process, to bound memory use
+	MaxSourceSize int64
+
+	// Concurrency limits simultaneous thumbnail generations
+	Concurrency int
+
+	// Timeout bounds a single generation (mostly relevant for ffmpeg)
+	Timeout time.Duration
+
+	// JPEGQuality of generated thumbnails
+	JPEGQuality int
+
+	// Keys decrypts cached files encrypted at rest (nil = read as stored).
+	// Files ffmpeg reads are decrypted to a temporary copy in Dir.
+	Keys *cryptfile.Keyring
+}
+
+// DefaultConfig returns default preview configuration
+func DefaultConfig() *Config {
+	return &Config{
+		DefaultSize:   256,
+		MaxSourceSize: 64 * 1024 * 1024,
+		Concurrency:   2,
+		Timeout:       30 * time.Second,
+		JPEGQuality:   80,
+	}
+}
+
+// Generator creates and caches thumbnails of cached files
+type Generator struct {
+	config *Config
+	ffmpeg string // resolved ffmpeg path, empty if unavailable
+	logger *zap.Logger
+
+	sem chan struct{}
+
+	mu       sync.Mutex
+	inflight map[string]*generation
+}
+
+// generation is a thumbnail being generated, shared by concurrent requests
+type generation struct {
+	done chan struct{}
+	err  error
+}
+
+// New creates a new Generator
+func New(cfg *Config, logger *zap.Logger) (*Generator, error) {
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+	defaults := DefaultConfig()
+	if cfg.DefaultSize <= 0 {
+		cfg.DefaultSize = defaults.DefaultSize
+	}
+	if cfg.MaxSourceSize <= 0 {
+		cfg.MaxSourceSize = defaults.MaxSourceSize
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = defaults.Concurrency
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaults.Timeout
+	}
+	if cfg.JPEGQuality <= 0 || cfg.JPEGQuality > 100 {
+		cfg.JPEGQuality = defaults.JPEGQuality
+	}
+	if cfg.Dir == "" {
+		return nil, fmt.Errorf("preview directory is required")
+	}
+
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create preview dir: %w", err)
+	}
+
+	ffmpegName := cfg.FFmpegPath
+	if ffmpegName == "" {
+		ffmpegName = "ffmpeg"
+	}
+	ffmpeg, err := exec.LookPath(ffmpegName)
+	if err != nil {
+		logger.Info("ffmpeg not found, video previews disabled", zap.String("ffmpeg", ffmpegName))
+		ffmpeg = ""
+	}
+
+	return &Generator{
+		config:   cfg,
+		ffmpeg:   ffmpeg,
+		logger:   logger,
+		sem:      make(chan struct{}, cfg.Concurrency),
+		inflight: make(map[string]*generation),
+	}, nil
+}
+
+// Supports reports whether a preview can be generated for a file path
+func (g *Generator) Supports(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return imageExtensions[ext] || (g.ffmpeg != "" && ffmpegExtensions[ext])
+}
+
+// bucketSize rounds a requested size up to a generated size bucket
+func (g *Generator) bucketSize(size int) int {
+	if size <= 0 {
+		size = g.config.DefaultSize
+	}
+	for _, b := range sizeBuckets {
+		if size <= b {
+			return b
+		}
+	}
+	return sizeBuckets[len(sizeBuckets)-1]
+}
+
+// Thumbnail returns the path of a JPEG thumbnail of a cached file, fitting
+// within size x size. Thumbnails are generated on first request and
+// regenerated when the cached file is newer than the thumbnail.
+func (g *Generator) Thumbnail(ctx context.Context, file *domain.File, size int) (string, error) {
+	if !g.Supports(file.Path) {
+		return "", ErrUnsupported
+	}
+	if !file.Cached || file.CachePath == "" {
+		return "", domain.ErrFileNotCached
+	}
+
+	size = g.bucketSize(size)
+	thumbPath := filepath.Join(g.config.Dir, fmt.Sprintf("%d-%d.jpg", file.ID, size))
+
+	srcInfo, err := os.Stat(file.CachePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to stat cached file: %w", err)
+	}
+	if thumbInfo, err := os.Stat(thumbPath); err == nil && !thumbInfo.ModTime().Before(srcInfo.ModTime()) {
+		return thumbPath, nil
+	}
+
+	// Share the work with concurrent requests for the same thumbnail
+	g.mu.Lock()
+	if gen, ok := g.inflight[thumbPath]; ok {
+		g.mu.Unlock()
+		select {
+		case <-gen.done:
+			return thumbPath, gen.err
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+	gen := &generation{done: make(chan struct{})}
+	g.inflight[thumbPath] = gen
+	g.mu.Unlock()
+
+	gen.err = g.generate(ctx, file, srcInfo.Size(), size, thumbPath)
+
+	g.mu.Lock()
+	delete(g.inflight, thumbPath)
+	g.mu.Unlock()
+	close(gen.done)
+
+	if gen.err != nil {
+		return "", gen.err
+	}
+	return thumbPath, nil
+}
+
+// generate renders a thumbnail into thumbPath
+func (g *Generator) generate(ctx context.Context, file *domain.File, srcSize int64, size int, thumbPath string) error {
+	select {
+	case g.sem <- struct{}{}:
+		defer func() { <-g.sem }()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, g.config.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	ext := strings.ToLower(filepath.Ext(file.Path))
+
+	var data []byte
+	var err error
+	if imageExtensions[ext] && srcSize <= g.config.MaxSourceSize {
+		data, err = g.renderImage(file.CachePath, size)
+	} else if g.ffmpeg != "" {
+		data, err = g.renderFFmpeg(ctx, file.CachePath, size)
+	} else {
+		return ErrUnsupported
+	}
+	if err != nil {
+		return err
+	}
+
+	// Write atomically so readers never see a partial thumbnail
+	tmp, err := os.CreateTemp(g.config.Dir, ".thumb-*")
+	if err != nil {
+		return fmt.Errorf("failed to create thumbnail: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write thumbnail: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write thumbnail: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), thumbPath); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to store thumbnail: %w", err)
+	}
+
+	g.logger.Debug("thumbnail generated",
+		zap.Int64("file_id", file.ID),
+		zap.Int("size", size),
+		zap.Int("bytes", len(data)),
+		zap.Duration("duration", time.Since(start)))
+
+	return nil
+}
+
+// renderImage decodes an image with the standard library and encodes a JPEG thumbnail
+func (g *Generator) renderImage(path string, size int) ([]byte, error) {
+	f, err := cryptfile.Open(path, g.config.Keys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open image: %w", err)
+	}
+	defer f.Close()
+
+	// Check dimensions first so small files with huge dimensions can't exhaust memory
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > maxImagePixels {
+		return nil, ErrUnsupported
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	thumb := flatten(downscale(img, size))
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: g.config.JPEGQuality}); err != nil {
+		return nil, fmt.Errorf("failed to encode thumbnail: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// renderFFmpeg extracts a poster frame (or converts an image) with ffmpeg
+func (g *Generator) renderFFmpeg(ctx context.Context, path string, size int) ([]byte, error) {
+	path, cleanup, err := cryptfile.PlainPath(path, g.config.Keys, g.config.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt cached file: %w", err)
+	}
+	defer cleanup()
+
+	// Seek a little into videos to skip black intro frames; fall back to the
+	// first frame for clips shorter than the offset (and for still images)
+	data, err := g.runFFmpeg(ctx, path, size, "1")
+	if err == nil && len(data) > 0 {
+		return data, nil
+	}
+
+	data, err = g.runFFmpeg(ctx, path, size, "0")
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("ffmpeg produced no frame")
+	}
+	return data, nil
+}
+
+// runFFmpeg renders a single JPEG frame starting at seek seconds
+func (g *Generator) runFFmpeg(ctx context.Context, path string, size int, seek string) ([]byte, error) {
+	// thumbnail picks a representative frame, scale keeps the aspect ratio
+	filter := fmt.Sprintf("thumbnail,scale=w=%d:h=%d:force_original_aspect_ratio=decrease", size, size)
+	quality := strconv.Itoa(2 + (100-g.config.JPEGQuality)*29/100) // map quality 100..0 to ffmpeg q 2..31
+
+	cmd := exec.CommandContext(ctx, g.ffmpeg,
+		"-hide_banner", "-loglevel", "error",
+		"-ss", seek,
+		"-i", path,
+		"-frames:v", "1",
+		"-vf", filter,
+		"-q:v", quality,
+		"-f", "image2", "-c:v", "mjpeg",
+		"pipe:1",
+	)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// CleanOld removes thumbnails generated more than maxAge ago; they are
+// regenerated on the next request. Returns the number of files removed.
+func (g *Generator) CleanOld(maxAge time.Duration) (int, error) {
+	threshold := time.Now().Add(-maxAge)
+
+	entries, err := os.ReadDir(g.config.Dir)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if info.ModTime().Before(threshold) {
+			if err := os.Remove(filepath.Join(g.config.Dir, entry.Name())); err == nil {
+				count++
+			}
+		}
+	}
+	return count, nil
+}
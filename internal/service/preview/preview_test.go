@@ -0,0 +1,114 @@
+package preview
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"go.uber.org/zap"
+)
+
+func TestFitSize(t *testing.T) {
+	tests := []struct {
+		w, h, max    int
+		wantW, wantH int
+	}{
+		{1000, 500, 100, 100, 50},
+		{500, 1000, 100, 50, 100},
+		{80, 60, 100, 80, 60},
+		{10000, 1, 100, 100, 1},
+	}
+
+	for _, tt := range tests {
+		w, h := fitSize(tt.w, tt.h, tt.max)
+		if w != tt.wantW || h != tt.wantH {
+			t.Errorf("fitSize(%d, %d, %d) = %dx%d, want %dx%d", tt.w, tt.h, tt.max, w, h, tt.wantW, tt.wantH)
+		}
+	}
+}
+
+func TestDownscale_AveragesPixels(t *testing.T) {
+	// 2x1 black/white image averages to mid grey at 1x1
+	src := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	src.Set(0, 0, color.RGBA{0, 0, 0, 255})
+	src.Set(1, 0, color.RGBA{255, 255, 255, 255})
+
+	dst := downscale(src, 1)
+	if b := dst.Bounds(); b.Dx() != 1 || b.Dy() != 1 {
+		t.Fatalf("size = %v, want 1x1", b)
+	}
+	r, _, _, _ := dst.At(0, 0).RGBA()
+	if r>>8 < 120 || r>>8 > 135 {
+		t.Errorf("red = %d, want about 127", r>>8)
+	}
+}
+
+func newTestGenerator(t *testing.T) *Generator {
+	t.Helper()
+	g, err := New(&Config{Dir: filepath.Join(t.TempDir(), "previews"), FFmpegPath: "ffmpeg-not-installed"}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return g
+}
+
+func TestGenerator_Thumbnail(t *testing.T) {
+	g := newTestGenerator(t)
+
+	srcPath := filepath.Join(t.TempDir(), "photo.png")
+	f, err := os.Create(srcPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(f, image.NewRGBA(image.Rect(0, 0, 400, 200))); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	file := &domain.File{ID: 7, Path: "/photos/photo.png", Cached: true, CachePath: srcPath}
+
+	thumbPath, err := g.Thumbnail(context.Background(), file, 100)
+	if err != nil {
+		t.Fatalf("Thumbnail() error = %v", err)
+	}
+
+	tf, err := os.Open(thumbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tf.Close()
+
+	cfg, err := jpeg.DecodeConfig(tf)
+	if err != nil {
+		t.Fatalf("thumbnail is not a JPEG: %v", err)
+	}
+	// 100 is rounded up to the 128 bucket
+	if cfg.Width != 128 || cfg.Height != 64 {
+		t.Errorf("thumbnail size = %dx%d, want 128x64", cfg.Width, cfg.Height)
+	}
+
+	// Second request is served from the preview directory
+	again, err := g.Thumbnail(context.Background(), file, 128)
+	if err != nil || again != thumbPath {
+		t.Errorf("Thumbnail() = %q, %v, want cached %q", again, err, thumbPath)
+	}
+}
+
+func TestGenerator_Unsupported(t *testing.T) {
+	g := newTestGenerator(t)
+
+	// Videos need ffmpeg, which is not available here
+	for _, path := range []string{"/docs/report.pdf", "/videos/clip.mkv"} {
+		file := &domain.File{ID: 1, Path: path, Cached: true, CachePath: "/nonexistent"}
+		if _, err := g.Thumbnail(context.Background(), file, 0); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("Thumbnail(%s) error = %v, want ErrUnsupported", path, err)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package preview
+
+import (
+	"image"
+	"image/color"
+)
+
+// fitSize returns the dimensions of w x h scaled down to fit within max x max,
+// preserving the aspect ratio. Images that already fit are not enlarged.
+func fitSize(w, h, max int) (int, int) {
+	if w <= max && h <= max {
+		return w, h
+	}
+	if w >= h {
+		nh := h * max / w
+		if nh < 1 {
+			nh = 1
+		}
+		return max, nh
+	}
+	nw := w * max / h
+	if nw < 1 {
+		nw = 1
+	}
+	return nw, max
+}
+
+// downscale resizes src to fit within max x max using a box filter.
+// Every destination pixel is the average of the source pixels it covers, which
+// gives good quality for the large reduction factors typical of thumbnails.
+func downscale(src image.Image, max int) image.Image {
+	bounds := src.Bounds()
+	sw, sh := bounds.Dx(), bounds.Dy()
+	dw, dh := fitSize(sw, sh, max)
+	if dw == sw && dh == sh {
+		return src
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	// Per destination column, the source column range it covers
+	x0s := make([]int, dw)
+	x1s := make([]int, dw)
+	for dx := 0; dx < dw; dx++ {
+		x0s[dx] = bounds.Min.X + dx*sw/dw
+		x1s[dx] = bounds.Min.X + (dx+1)*sw/dw
+		if x1s[dx] <= x0s[dx] {
+			x1s[dx] = x0s[dx] + 1
+		}
+	}
+
+	for dy := 0; dy < dh; dy++ {
+		y0 := bounds.Min.Y + dy*sh/dh
+		y1 := bounds.Min.Y + (dy+1)*sh/dh
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+
+		for dx := 0; dx < dw; dx++ {
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0s[dx]; sx < x1s[dx]; sx++ {
+					pr, pg, pb, pa := src.At(sx, sy).RGBA()
+					r += uint64(pr)
+					g += uint64(pg)
+					b += uint64(pb)
+					a += uint64(pa)
+					n++
+				}
+			}
+			dst.SetRGBA(dx, dy, color.RGBA{
+				R: uint8(r / n >> 8),
+				G: uint8(g / n >> 8),
+				B: uint8(b / n >> 8),
+				A: uint8(a / n >> 8),
+			})
+		}
+	}
+
+	return dst
+}
+
+// flatten draws img onto an opaque white background, since JPEG has no alpha
+func flatten(img image.Image) image.Image {
+	bounds := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, a := img.At(x, y).RGBA()
+			// Premultiplied colour over white: c + (1 - a) * white
+			inv := 0xffff - a
+			dst.SetRGBA(x-bounds.Min.X, y-bounds.Min.Y, color.RGBA{
+				R: uint8((r + inv) >> 8),
+				G: uint8((g + inv) >> 8),
+				B: uint8((b + inv) >> 8),
+				A: 0xff,
+			})
+		}
+	}
+	return dst
+}
@@ -0,0 +1,184 @@
+package replicator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"go.uber.org/zap"
+)
+
+// BootstrapStore is the part of the database Bootstrap writes
+type BootstrapStore interface {
+	GetBySynoID(synoID string) (*domain.File, error)
+	UpsertBySynoID(file *domain.File) (*domain.UpsertResult, error)
+	Update(file *domain.File) error
+	GetShareByToken(token string) (*domain.Share, error)
+	CreateShare(share *domain.Share) error
+}
+
+// CacheWriter writes copies into the cache (port.FileSystem)
+type CacheWriter interface {
+	WriteFile(synoPath string, reader io.Reader) (string, int64, error)
+}
+
+// BootstrapResult summarizes a Bootstrap
+type BootstrapResult struct {
+	Files   int   // Files restored into the cache
+	Bytes   int64 // Size of the restored copies
+	Skipped int   // Files already cached in the same version, or whose copy is missing
+	Shares  int   // Shares created
+}
+
+// Bootstrap restores a standby from a replica: it creates the replicated
+// files in the database, writes their copies into the cache and marks them
+// cached, then creates the replicated shares. Files already cached in the
+// same version and existing shares are left alone, so an interrupted
+// bootstrap can be run again.
+func Bootstrap(ctx context.Context, replica port.ReplicaStore, store BootstrapStore, cache CacheWriter, logger *zap.Logger) (*BootstrapResult, error) {
+	keys, err := replica.List(ctx, metaPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list replicated files: %w", err)
+	}
+
+	result := &BootstrapResult{}
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		if _, ok := synoFileIDFromMetaKey(key); !ok {
+			continue
+		}
+		restored, size, err := restoreFile(ctx, replica, store, cache, key)
+		if err != nil {
+			return result, fmt.Errorf("failed to restore %s: %w", key, err)
+		}
+		if !restored {
+			result.Skipped++
+			continue
+		}
+		result.Files++
+		result.Bytes += size
+	}
+
+	created, err := restoreShares(ctx, replica, store, logger)
+	result.Shares = created
+	if err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// restoreFile restores the file whose Record is stored under key. Returns
+// false when there was nothing to restore.
+func restoreFile(ctx context.Context, replica port.ReplicaStore, store BootstrapStore, cache CacheWriter, key string) (bool, int64, error) {
+	var record Record
+	if err := getJSON(ctx, replica, key, &record); err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return false, 0, nil // Removed while listing
+		}
+		return false, 0, err
+	}
+
+	existing, err := store.GetBySynoID(record.SynoFileID)
+	if err != nil {
+		return false, 0, err
+	}
+	if existing != nil && existing.Cached && existing.Size == record.Size && sameTime(existing.ModifiedAt, record.ModifiedAt) {
+		return false, 0, nil
+	}
+
+	body, err := replica.Get(ctx, contentKey(record.SynoFileID))
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return false, 0, nil
+		}
+		return false, 0, err
+	}
+	defer body.Close()
+
+	upserted, err := store.UpsertBySynoID(record.file())
+	if err != nil {
+		return false, 0, err
+	}
+	cachePath, written, err := cache.WriteFile(record.Path, body)
+	if err != nil {
+		return false, 0, err
+	}
+	if written != record.StoredSize {
+		return false, 0, fmt.Errorf("copy is %d bytes, want %d", written, record.StoredSize)
+	}
+
+	file := upserted.File
+	file.MarkCached(cachePath)
+	file.CacheEncoding = record.CacheEncoding
+	file.ExportFormat = record.ExportFormat
+	if record.ContentType != "" {
+		file.ContentType = record.ContentType
+	}
+	if err := store.Update(file); err != nil {
+		return false, 0, err
+	}
+	return true, written, nil
+}
+
+// restoreShares creates the replicated shares that don't exist yet.
+// Returns the number of shares created.
+func restoreShares(ctx context.Context, replica port.ReplicaStore, store BootstrapStore, logger *zap.Logger) (int, error) {
+	var records []ShareRecord
+	if err := getJSON(ctx, replica, sharesKey, &records); err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to read replicated shares: %w", err)
+	}
+
+	created := 0
+	for i := range records {
+		record := &records[i]
+		existing, err := store.GetShareByToken(record.Token)
+		if err != nil {
+			return created, err
+		}
+		if existing != nil {
+			continue
+		}
+		file, err := store.GetBySynoID(record.SynoFileID)
+		if err != nil {
+			return created, err
+		}
+		if file == nil {
+			logger.Warn("skipping replicated share of an unknown file",
+				zap.String("syno_file_id", record.SynoFileID))
+			continue
+		}
+		if err := store.CreateShare(record.share(file.ID)); err != nil {
+			return created, fmt.Errorf("failed to create share: %w", err)
+		}
+		created++
+	}
+	return created, nil
+}
+
+// getJSON decodes the object stored under key into v
+func getJSON(ctx context.Context, replica port.ReplicaStore, key string, v interface{}) error {
+	body, err := replica.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	return json.NewDecoder(body).Decode(v)
+}
+
+// sameTime reports whether two optional times are equal
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
@@ -0,0 +1,145 @@
+package replicator
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+)
+
+// Object layout in the replica
+const (
+	filesPrefix = "files/"      // files/<syno file id>: the cached copy, decrypted
+	metaPrefix  = "meta/files/" // meta/files/<syno file id>.json: its Record
+	metaSuffix  = ".json"
+	sharesKey   = "meta/shares.json" // Active shares, []ShareRecord
+)
+
+// contentKey returns the key of the copy of a Synology file
+func contentKey(synoFileID string) string {
+	return filesPrefix + url.PathEscape(synoFileID)
+}
+
+// metaKey returns the key of the Record of a Synology file
+func metaKey(synoFileID string) string {
+	return metaPrefix + url.PathEscape(synoFileID) + metaSuffix
+}
+
+// synoFileIDFromMetaKey returns the Synology file ID of a Record key
+func synoFileIDFromMetaKey(key string) (string, bool) {
+	if !strings.HasPrefix(key, metaPrefix) || !strings.HasSuffix(key, metaSuffix) {
+		return "", false
+	}
+	id, err := url.PathUnescape(strings.TrimSuffix(strings.TrimPrefix(key, metaPrefix), metaSuffix))
+	return id, err == nil && id != ""
+}
+
+// Record is the metadata of a replicated file, stored next to its copy
+type Record struct {
+	SynoFileID    string     `json:"syno_file_id"`
+	Path          string     `json:"path"`
+	Size          int64      `json:"size"`
+	ModifiedAt    *time.Time `json:"modified_at,omitempty"`
+	Starred       bool       `json:"starred"`
+	Shared        bool       `json:"shared"`
+	Priority      int        `json:"priority"`
+	Owner         string     `json:"owner,omitempty"`
+	Labels        []string   `json:"labels,omitempty"`
+	ContentType   string     `json:"content_type,omitempty"`
+	ExportFormat  string     `json:"export_format,omitempty"`
+	CacheEncoding string     `json:"cache_encoding,omitempty"` // The copy is gzip-compressed
+	StoredSize    int64      `json:"stored_size"`              // Size of the copy object
+	ReplicatedAt  time.Time  `json:"replicated_at"`
+}
+
+// newRecord describes the copy of file that is stored storedSize bytes long
+func newRecord(file *domain.File, storedSize int64) *Record {
+	return &Record{
+		SynoFileID:    file.SynoFileID,
+		Path:          file.Path,
+		Size:          file.Size,
+		ModifiedAt:    file.ModifiedAt,
+		Starred:       file.Starred,
+		Shared:        file.Shared,
+		Priority:      file.Priority,
+		Owner:         file.Owner,
+		Labels:        file.Labels,
+		ContentType:   file.ContentType,
+		ExportFormat:  file.ExportFormat,
+		CacheEncoding: file.CacheEncoding,
+		StoredSize:    storedSize,
+		ReplicatedAt:  time.Now(),
+	}
+}
+
+// file returns the file record described, not cached yet
+func (r *Record) file() *domain.File {
+	return &domain.File{
+		SynoFileID:  r.SynoFileID,
+		Path:        r.Path,
+		Size:        r.Size,
+		ModifiedAt:  r.ModifiedAt,
+		Starred:     r.Starred,
+		Shared:      r.Shared,
+		Priority:    r.Priority,
+		Owner:       r.Owner,
+		Labels:      r.Labels,
+		ContentType: r.ContentType,
+	}
+}
+
+// ShareRecord is a replicated share, referring to its file by Synology file ID
+type ShareRecord struct {
+	SynoFileID       string     `json:"syno_file_id"`
+	SynoShareID      string     `json:"syno_share_id"`
+	Token            string     `json:"token"`
+	SharingLink      string     `json:"sharing_link,omitempty"`
+	URL              string     `json:"url,omitempty"`
+	Password         string     `json:"password,omitempty"` // Hashed
+	ExpiresAt        *time.Time `json:"expires_at,omitempty"`
+	MaxDownloads     int        `json:"max_downloads,omitempty"`
+	NASMaxDownloads  int        `json:"nas_max_downloads,omitempty"`
+	AllowedIPs       []string   `json:"allowed_ips,omitempty"`
+	DeniedIPs        []string   `json:"denied_ips,omitempty"`
+	RequireSignature bool       `json:"require_signature,omitempty"`
+	CacheControl     string     `json:"cache_control,omitempty"`
+}
+
+// newShareRecord describes share of the file with a Synology file ID
+func newShareRecord(share *domain.Share, synoFileID string) ShareRecord {
+	return ShareRecord{
+		SynoFileID:       synoFileID,
+		SynoShareID:      share.SynoShareID,
+		Token:            share.Token,
+		SharingLink:      share.SharingLink,
+		URL:              share.URL,
+		Password:         share.Password,
+		ExpiresAt:        share.ExpiresAt,
+		MaxDownloads:     share.MaxDownloads,
+		NASMaxDownloads:  share.NASMaxDownloads,
+		AllowedIPs:       share.AllowedIPs,
+		DeniedIPs:        share.DeniedIPs,
+		RequireSignature: share.RequireSignature,
+		CacheControl:     share.CacheControl,
+	}
+}
+
+// share returns the share described, for the file with fileID
+func (r *ShareRecord) share(fileID int64) *domain.Share {
+	return &domain.Share{
+		SynoShareID:      r.SynoShareID,
+		Token:            r.Token,
+		SharingLink:      r.SharingLink,
+		URL:              r.URL,
+		FileID:           fileID,
+		Password:         r.Password,
+		ExpiresAt:        r.ExpiresAt,
+		MaxDownloads:     r.MaxDownloads,
+		NASMaxDownloads:  r.NASMaxDownloads,
+		AllowedIPs:       r.AllowedIPs,
+		DeniedIPs:        r.DeniedIPs,
+		RequireSignature: r.RequireSignature,
+		CacheControl:     r.CacheControl,
+	}
+}
@@ -0,0 +1,305 @@
+package replicator
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"go.uber.org/zap"
+)
+
+// Store is the part of the database the replicator reads
+type Store interface {
+	port.ReplicationRepository
+	GetByID(id int64) (*domain.File, error)
+	ListActiveShares() ([]*domain.Share, error)
+}
+
+// Cache opens cached copies (port.FileSystem)
+type Cache interface {
+	OpenCached(cachePath string) (port.CachedFile, error)
+}
+
+// Leadership reports whether this instance is the elected leader (leader.Elector)
+type Leadership interface {
+	IsLeader() bool
+}
+
+// Config contains replicator configuration
+type Config struct {
+	// Interval between replication runs
+	Interval time.Duration
+
+	// BatchSize is the number of files listed per query
+	BatchSize int
+}
+
+// DefaultConfig returns default replicator configuration
+func DefaultConfig() *Config {
+	return &Config{
+		Interval:  time.Minute,
+		BatchSize: 100,
+	}
+}
+
+// Service mirrors cached copies, their metadata and the active shares to a
+// replica on a secondary site, and deletes the copies of files that are no
+// longer cached from it. A standby restores its database and cache from the
+// replica with Bootstrap.
+type Service struct {
+	config  *Config
+	store   Store
+	cache   Cache
+	replica port.ReplicaStore
+	logger  *zap.Logger
+
+	leadership Leadership
+
+	// sharesHash is the hash of the last uploaded shares snapshot
+	sharesHash [sha256.Size]byte
+
+	mu      sync.Mutex
+	running bool
+	cancel  context.CancelFunc
+}
+
+// New creates a new replicator Service
+func New(cfg *Config, store Store, cache Cache, replica port.ReplicaStore, logger *zap.Logger) *Service {
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Minute
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	return &Service{
+		config:  cfg,
+		store:   store,
+		cache:   cache,
+		replica: replica,
+		logger:  logger,
+	}
+}
+
+// EnableLeaderElection restricts replication to the instance holding
+// leadership, so instances sharing a database and cache upload each copy once
+func (s *Service) EnableLeaderElection(leadership Leadership) {
+	s.leadership = leadership
+}
+
+// Start replicates right away and then every interval until ctx is cancelled
+func (s *Service) Start(ctx context.Context) error {
+	s.mu.Lock()
+	if s.running {
+		s.mu.Unlock()
+		return fmt.Errorf("replicator already running")
+	}
+	s.running = true
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.mu.Unlock()
+
+	s.logger.Info("replicator started", zap.Duration("interval", s.config.Interval))
+
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		if s.leadership != nil && !s.leadership.IsLeader() {
+			// Another instance replicates; resend the shares once leading
+			s.sharesHash = [sha256.Size]byte{}
+		} else if err := s.Run(ctx); err != nil && ctx.Err() == nil {
+			s.logger.Error("replication run failed", zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			s.logger.Info("replicator stopped")
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stop stops the replicator
+func (s *Service) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.running = false
+}
+
+// Run replicates new and changed copies, removes the copies of files that
+// are no longer cached and uploads the shares when they changed. Files that
+// fail are logged and retried on the next run.
+func (s *Service) Run(ctx context.Context) error {
+	start := time.Now()
+
+	replicated, failed, err := s.replicatePending(ctx)
+	if err != nil {
+		return err
+	}
+	removed, err := s.removeStale(ctx)
+	if err != nil {
+		return err
+	}
+	if err := s.replicateShares(ctx); err != nil {
+		return err
+	}
+
+	if replicated > 0 || removed > 0 || failed > 0 {
+		s.logger.Info("replication run finished",
+			zap.Int("replicated", replicated),
+			zap.Int("removed", removed),
+			zap.Int("failed", failed),
+			zap.Duration("duration", time.Since(start)))
+	}
+	return nil
+}
+
+// replicatePending uploads the copies of cached files that have no replica
+// or an outdated one. Returns the number of files replicated and failed.
+func (s *Service) replicatePending(ctx context.Context) (int, int, error) {
+	var replicated int
+	failed := make(map[int64]bool)
+	for {
+		files, err := s.store.ListReplicationPending(s.config.BatchSize + len(failed))
+		if err != nil {
+			return replicated, len(failed), fmt.Errorf("failed to list files to replicate: %w", err)
+		}
+
+		progress := false
+		for _, file := range files {
+			if failed[file.ID] {
+				continue
+			}
+			if err := ctx.Err(); err != nil {
+				return replicated, len(failed), err
+			}
+			progress = true
+			if err := s.replicateFile(ctx, file); err != nil {
+				if ctx.Err() != nil {
+					return replicated, len(failed), ctx.Err()
+				}
+				failed[file.ID] = true
+				s.logger.Warn("failed to replicate file",
+					zap.String("path", file.Path),
+					zap.Error(err))
+				continue
+			}
+			replicated++
+		}
+		if !progress || len(files) < s.config.BatchSize+len(failed) {
+			return replicated, len(failed), nil
+		}
+	}
+}
+
+// replicateFile uploads the copy of file and then its Record, so a Record
+// is only listed once its copy is complete
+func (s *Service) replicateFile(ctx context.Context, file *domain.File) error {
+	f, err := s.cache.OpenCached(file.CachePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("cached copy is missing: %w", err)
+		}
+		return err
+	}
+	defer f.Close()
+
+	size := f.Size()
+	if err := s.replica.Put(ctx, contentKey(file.SynoFileID), f, size); err != nil {
+		return fmt.Errorf("failed to upload copy: %w", err)
+	}
+
+	meta, err := json.Marshal(newRecord(file, size))
+	if err != nil {
+		return err
+	}
+	if err := s.replica.Put(ctx, metaKey(file.SynoFileID), bytes.NewReader(meta), int64(len(meta))); err != nil {
+		return fmt.Errorf("failed to upload metadata: %w", err)
+	}
+
+	return s.store.MarkReplicated(file)
+}
+
+// removeStale deletes the replicas of files that are no longer cached.
+// Returns the number of replicas deleted.
+func (s *Service) removeStale(ctx context.Context) (int, error) {
+	var removed int
+	for {
+		ids, err := s.store.ListReplicationStale(s.config.BatchSize)
+		if err != nil {
+			return removed, fmt.Errorf("failed to list stale replicas: %w", err)
+		}
+		for _, id := range ids {
+			// The Record goes first so the copy is never listed without it
+			if err := s.replica.Delete(ctx, metaKey(id)); err != nil {
+				return removed, fmt.Errorf("failed to delete replica metadata: %w", err)
+			}
+			if err := s.replica.Delete(ctx, contentKey(id)); err != nil {
+				return removed, fmt.Errorf("failed to delete replica copy: %w", err)
+			}
+			if err := s.store.DeleteReplicated(id); err != nil {
+				return removed, err
+			}
+			removed++
+		}
+		if len(ids) < s.config.BatchSize {
+			return removed, nil
+		}
+	}
+}
+
+// replicateShares uploads the active shares when they changed since the
+// last upload
+func (s *Service) replicateShares(ctx context.Context) error {
+	shares, err := s.store.ListActiveShares()
+	if err != nil {
+		return fmt.Errorf("failed to list shares: %w", err)
+	}
+
+	synoFileIDs := make(map[int64]string)
+	records := make([]ShareRecord, 0, len(shares))
+	for _, share := range shares {
+		id, ok := synoFileIDs[share.FileID]
+		if !ok {
+			file, err := s.store.GetByID(share.FileID)
+			if err != nil {
+				return fmt.Errorf("failed to get shared file: %w", err)
+			}
+			if file != nil {
+				id = file.SynoFileID
+			}
+			synoFileIDs[share.FileID] = id
+		}
+		if id != "" {
+			records = append(records, newShareRecord(share, id))
+		}
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Token < records[j].Token })
+
+	data, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+	hash := sha256.Sum256(data)
+	if hash == s.sharesHash {
+		return nil
+	}
+	if err := s.replica.Put(ctx, sharesKey, bytes.NewReader(data), int64(len(data))); err != nil {
+		return fmt.Errorf("failed to upload shares: %w", err)
+	}
+	s.sharesHash = hash
+	return nil
+}
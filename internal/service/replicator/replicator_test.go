@@ -0,0 +1,307 @@
+package replicator
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"github.com/vertextoedge/synology-file-cache/internal/util/cryptfile"
+	"go.uber.org/zap"
+)
+
+// memReplica is an in-memory port.ReplicaStore counting uploads
+type memReplica struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	puts    int
+}
+
+func newMemReplica() *memReplica {
+	return &memReplica{objects: make(map[string][]byte)}
+}
+
+func (m *memReplica) Put(ctx context.Context, key string, body io.Reader, size int64) error {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[key] = data
+	m.puts++
+	return nil
+}
+
+func (m *memReplica) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.objects[key]
+	if !ok {
+		return nil, domain.ErrNotFound
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (m *memReplica) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.objects, key)
+	return nil
+}
+
+func (m *memReplica) List(ctx context.Context, prefix string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var keys []string
+	for key := range m.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// fakeStore keeps files, shares and replication state in memory
+type fakeStore struct {
+	files      []*domain.File
+	shares     []*domain.Share
+	replicated map[string]int64 // syno file ID -> replicated size
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{replicated: make(map[string]int64)}
+}
+
+func (f *fakeStore) ListReplicationPending(limit int) ([]*domain.File, error) {
+	var files []*domain.File
+	for _, file := range f.files {
+		if size, ok := f.replicated[file.SynoFileID]; file.Cached && (!ok || size != file.Size) && len(files) < limit {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+func (f *fakeStore) ListReplicationStale(limit int) ([]string, error) {
+	var ids []string
+	for id := range f.replicated {
+		if file, _ := f.GetBySynoID(id); (file == nil || !file.Cached) && len(ids) < limit {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (f *fakeStore) MarkReplicated(file *domain.File) error {
+	f.replicated[file.SynoFileID] = file.Size
+	return nil
+}
+
+func (f *fakeStore) DeleteReplicated(synoFileID string) error {
+	delete(f.replicated, synoFileID)
+	return nil
+}
+
+func (f *fakeStore) GetByID(id int64) (*domain.File, error) {
+	for _, file := range f.files {
+		if file.ID == id {
+			return file, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeStore) GetBySynoID(synoID string) (*domain.File, error) {
+	for _, file := range f.files {
+		if file.SynoFileID == synoID {
+			return file, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeStore) UpsertBySynoID(file *domain.File) (*domain.UpsertResult, error) {
+	if existing, _ := f.GetBySynoID(file.SynoFileID); existing != nil {
+		existing.Path, existing.Size, existing.ModifiedAt = file.Path, file.Size, file.ModifiedAt
+		return &domain.UpsertResult{File: existing}, nil
+	}
+	stored := *file
+	stored.ID = int64(len(f.files) + 1)
+	f.files = append(f.files, &stored)
+	return &domain.UpsertResult{File: &stored, Created: true}, nil
+}
+
+func (f *fakeStore) Update(file *domain.File) error {
+	for i, existing := range f.files {
+		if existing.ID == file.ID {
+			f.files[i] = file
+		}
+	}
+	return nil
+}
+
+func (f *fakeStore) ListActiveShares() ([]*domain.Share, error) {
+	return f.shares, nil
+}
+
+func (f *fakeStore) GetShareByToken(token string) (*domain.Share, error) {
+	for _, share := range f.shares {
+		if share.Token == token {
+			return share, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeStore) CreateShare(share *domain.Share) error {
+	f.shares = append(f.shares, share)
+	return nil
+}
+
+// dirCache reads and writes copies in a directory
+type dirCache struct {
+	dir string
+}
+
+func (c *dirCache) OpenCached(cachePath string) (port.CachedFile, error) {
+	f, err := cryptfile.Open(cachePath, nil)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (c *dirCache) WriteFile(synoPath string, reader io.Reader) (string, int64, error) {
+	path := filepath.Join(c.dir, filepath.FromSlash(synoPath))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", 0, err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	n, err := io.Copy(f, reader)
+	return path, n, err
+}
+
+// cacheFile adds a cached file with content to store and cache
+func cacheFile(t *testing.T, store *fakeStore, cache *dirCache, synoID, path, content string) *domain.File {
+	t.Helper()
+	result, _ := store.UpsertBySynoID(&domain.File{SynoFileID: synoID, Path: path, Size: int64(len(content)), Priority: domain.PriorityDefault})
+	cachePath, _, err := cache.WriteFile(path, strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	result.File.MarkCached(cachePath)
+	return result.File
+}
+
+func TestService_Run(t *testing.T) {
+	store := newFakeStore()
+	cache := &dirCache{dir: t.TempDir()}
+	replica := newMemReplica()
+
+	a := cacheFile(t, store, cache, "1", "/docs/a.txt", "alpha")
+	cacheFile(t, store, cache, "2", "/docs/b.txt", "bravo!")
+	store.shares = []*domain.Share{{Token: "tok", FileID: a.ID, Password: "$hash"}}
+
+	s := New(&Config{BatchSize: 1}, store, cache, replica, zap.NewNop())
+	if err := s.Run(context.Background()); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if got := string(replica.objects["files/1"]); got != "alpha" {
+		t.Errorf("files/1 = %q, want alpha", got)
+	}
+	if _, ok := replica.objects["meta/files/2.json"]; !ok {
+		t.Error("meta/files/2.json not uploaded")
+	}
+	if !bytes.Contains(replica.objects[sharesKey], []byte(`"syno_file_id":"1"`)) {
+		t.Errorf("shares = %s, want the share of file 1", replica.objects[sharesKey])
+	}
+
+	// Nothing changed, nothing is uploaded
+	puts := replica.puts
+	if err := s.Run(context.Background()); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if replica.puts != puts {
+		t.Errorf("second Run() uploaded %d objects, want 0", replica.puts-puts)
+	}
+
+	// Evicted files are removed from the replica
+	a.InvalidateCache()
+	if err := s.Run(context.Background()); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if _, ok := replica.objects["files/1"]; ok {
+		t.Error("files/1 still replicated after eviction")
+	}
+	if _, ok := replica.objects["meta/files/1.json"]; ok {
+		t.Error("meta/files/1.json still replicated after eviction")
+	}
+	if _, ok := store.replicated["1"]; ok {
+		t.Error("file 1 still marked replicated")
+	}
+}
+
+func TestBootstrap(t *testing.T) {
+	// Replicate from a primary
+	primary, replica := newFakeStore(), newMemReplica()
+	primaryCache := &dirCache{dir: t.TempDir()}
+	modifiedAt := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	a := cacheFile(t, primary, primaryCache, "1", "/docs/a.txt", "alpha")
+	a.ModifiedAt = &modifiedAt
+	a.ContentType = "text/plain"
+	cacheFile(t, primary, primaryCache, "2", "/docs/b.txt", "bravo!")
+	primary.shares = []*domain.Share{{Token: "tok", FileID: a.ID}}
+	if err := New(nil, primary, primaryCache, replica, zap.NewNop()).Run(context.Background()); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	// A record whose copy is gone is skipped
+	replica.objects[metaKey("3")] = []byte(`{"syno_file_id":"3","path":"/gone","size":1,"stored_size":1}`)
+
+	standby := newFakeStore()
+	standbyCache := &dirCache{dir: t.TempDir()}
+	result, err := Bootstrap(context.Background(), replica, standby, standbyCache, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Bootstrap() error = %v", err)
+	}
+	if result.Files != 2 || result.Bytes != 11 || result.Skipped != 1 || result.Shares != 1 {
+		t.Errorf("Bootstrap() = %+v, want 2 files, 11 bytes, 1 skipped, 1 share", result)
+	}
+
+	file, _ := standby.GetBySynoID("1")
+	if file == nil || !file.Cached || file.ContentType != "text/plain" || !sameTime(file.ModifiedAt, &modifiedAt) {
+		t.Fatalf("restored file = %+v", file)
+	}
+	content, err := os.ReadFile(file.CachePath)
+	if err != nil || string(content) != "alpha" {
+		t.Errorf("restored copy = %q, %v", content, err)
+	}
+	share, _ := standby.GetShareByToken("tok")
+	if share == nil || share.FileID != file.ID {
+		t.Errorf("restored share = %+v, want file %d", share, file.ID)
+	}
+
+	// Running it again restores nothing
+	result, err = Bootstrap(context.Background(), replica, standby, standbyCache, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Bootstrap() again error = %v", err)
+	}
+	if result.Files != 0 || result.Shares != 0 {
+		t.Errorf("Bootstrap() again = %+v, want nothing restored", result)
+	}
+}
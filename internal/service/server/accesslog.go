@@ -0,0 +1,198 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/util/reqid"
+)
+
+// Access log formats
+const (
+	AccessLogCommon   = "common"   // Apache Common Log Format
+	AccessLogCombined = "combined" // Common plus referer and user agent
+	AccessLogJSON     = "json"     // One JSON object per line
+)
+
+// clfTimeFormat is the timestamp format of Apache access logs
+const clfTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// accessLogWriter captures status and response size for the access log
+type accessLogWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *accessLogWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *accessLogWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// ReadFrom keeps sendfile for cached files when the underlying writer supports it
+func (w *accessLogWriter) ReadFrom(src io.Reader) (int64, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	var n int64
+	var err error
+	if rf, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(src)
+	} else {
+		n, err = io.Copy(w.ResponseWriter, src)
+	}
+	w.bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach Flush on the underlying writer
+func (w *accessLogWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// accessLogEntry is one line of the JSON access log
+type accessLogEntry struct {
+	Time       string `json:"time"`
+	RemoteAddr string `json:"remote_addr"`
+	User       string `json:"user,omitempty"`
+	Method     string `json:"method"`
+	URI        string `json:"uri"`
+	Proto      string `json:"proto"`
+	Status     int    `json:"status"`
+	Bytes      int64  `json:"bytes"`
+	Referer    string `json:"referer,omitempty"`
+	UserAgent  string `json:"user_agent,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+	RequestID  string `json:"request_id,omitempty"`
+}
+
+// AccessLogMiddleware writes one access log line per request to out, in the
+// common, combined or json format. Each line is a single serialized Write.
+func AccessLogMiddleware(out io.Writer, format string, trust ProxyTrust) func(http.Handler) http.Handler {
+	var mu sync.Mutex
+	write := func(line []byte) {
+		mu.Lock()
+		defer mu.Unlock()
+		out.Write(line)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			aw := &accessLogWriter{ResponseWriter: w}
+
+			next.ServeHTTP(aw, r)
+
+			if aw.status == 0 {
+				aw.status = http.StatusOK
+			}
+			write(formatAccessLog(format, r, aw.status, aw.bytes, start, trust.ClientIP(r)))
+		})
+	}
+}
+
+// formatAccessLog renders an access log line including the trailing newline
+func formatAccessLog(format string, r *http.Request, status int, bytes int64, start time.Time, remote string) []byte {
+	if remote == "" {
+		remote = "-"
+	}
+	user, _, _ := r.BasicAuth()
+
+	if format == AccessLogJSON {
+		line, _ := json.Marshal(accessLogEntry{
+			Time:       start.Format(time.RFC3339),
+			RemoteAddr: remote,
+			User:       user,
+			Method:     r.Method,
+			URI:        redactedURI(r),
+			Proto:      r.Proto,
+			Status:     status,
+			Bytes:      bytes,
+			Referer:    r.Referer(),
+			UserAgent:  r.UserAgent(),
+			DurationMS: time.Since(start).Milliseconds(),
+			RequestID:  reqid.FromContext(r.Context()),
+		})
+		return append(line, '\n')
+	}
+
+	size := "-"
+	if bytes > 0 {
+		size = strconv.FormatInt(bytes, 10)
+	}
+
+	line := fmt.Sprintf("%s - %s [%s] \"%s %s %s\" %d %s",
+		remote, clfEscape(clfField(user)), start.Format(clfTimeFormat),
+		r.Method, clfEscape(redactedURI(r)), r.Proto, status, size)
+	if format == AccessLogCombined {
+		line += fmt.Sprintf(" \"%s\" \"%s\"", clfEscape(clfField(r.Referer())), clfEscape(clfField(r.UserAgent())))
+	}
+	return []byte(line + "\n")
+}
+
+// clfField returns "-" for empty values, as Apache does
+func clfField(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// clfEscape escapes quotes, backslashes and control characters so a value
+// cannot break out of its quoted field or forge extra lines
+func clfEscape(s string) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c == 0x7f:
+			fmt.Fprintf(&b, "\\x%02x", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// redactedQueryParams carry credentials: share passwords and the webhook secret
+var redactedQueryParams = []string{"password", "secret"}
+
+// redactedURI is the request URI with the values of credential query parameters replaced
+func redactedURI(r *http.Request) string {
+	query := r.URL.Query()
+	redacted := false
+	for _, name := range redactedQueryParams {
+		if query.Has(name) {
+			query.Set(name, "REDACTED")
+			redacted = true
+		}
+	}
+	if !redacted {
+		return r.RequestURI
+	}
+	// RequestURI keeps the /t/{name} prefix that a namespace's r.URL has lost
+	path, _, _ := strings.Cut(r.RequestURI, "?")
+	if path == "" {
+		path = r.URL.EscapedPath()
+	}
+	return path + "?" + query.Encode()
+}
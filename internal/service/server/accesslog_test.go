@@ -0,0 +1,31 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRedactedURI(t *testing.T) {
+	tests := []struct{ uri, want string }{
+		{"/f/abc", "/f/abc"},
+		{"/f/abc?dl=1", "/f/abc?dl=1"},
+		{"/f/abc?password=open+sesame&dl=1", "/f/abc?dl=1&password=REDACTED"},
+		{"/webhook/drive?secret=s3cret", "/webhook/drive?secret=REDACTED"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, tt.uri, nil)
+		if got := redactedURI(r); got != tt.want {
+			t.Errorf("redactedURI(%q) = %q, want %q", tt.uri, got, tt.want)
+		}
+	}
+}
+
+func TestRedactedURI_KeepsNamespacePrefix(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/t/design/f/abc?password=open+sesame", nil)
+	// As seen by the namespace, below http.StripPrefix
+	r.URL.Path = "/f/abc"
+	if got, want := redactedURI(r), "/t/design/f/abc?password=REDACTED"; got != want {
+		t.Errorf("redactedURI() = %q, want %q", got, want)
+	}
+}
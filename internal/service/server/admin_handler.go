@@ -2,35 +2,37 @@ package server
 
 import (
 	"fmt"
-	"io"
-	"mime"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
 	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"github.com/vertextoedge/synology-file-cache/internal/util/bufpool"
+	"github.com/vertextoedge/synology-file-cache/internal/util/cryptfile"
+	"github.com/vertextoedge/synology-file-cache/internal/util/disposition"
+	"github.com/vertextoedge/synology-file-cache/internal/util/inuse"
 	"go.uber.org/zap"
 )
 
 // AdminHandler handles admin browser requests
 type AdminHandler struct {
-	store         port.Store
-	logger        *zap.Logger
-	cacheRootDir  string
-	adminUsername string
-	adminPassword string
+	store        port.Store
+	logger       *zap.Logger
+	cacheRootDir string
+	buffers      *bufpool.Pool      // Copy buffers for responses that cannot use sendfile (nil = io.Copy)
+	keys         *cryptfile.Keyring // Decrypts copies encrypted at rest (nil = read as stored)
+	readers      *inuse.Tracker     // Keeps copies being served from eviction (nil = not tracked)
 }
 
 // NewAdminHandler creates a new AdminHandler
-func NewAdminHandler(store port.Store, adminUsername, adminPassword, cacheRootDir string, logger *zap.Logger) *AdminHandler {
+func NewAdminHandler(store port.Store, cacheRootDir string, logger *zap.Logger) *AdminHandler {
 	return &AdminHandler{
-		store:         store,
-		logger:        logger,
-		cacheRootDir:  cacheRootDir,
-		adminUsername: adminUsername,
-		adminPassword: adminPassword,
+		store:        store,
+		logger:       logger,
+		cacheRootDir: cacheRootDir,
 	}
 }
 
@@ -45,7 +47,7 @@ func (h *AdminHandler) HandleBrowse(w http.ResponseWriter, r *http.Request) {
 	requestPath := strings.TrimPrefix(r.URL.Path, "/admin/browse")
 	requestPath = strings.TrimPrefix(requestPath, "/")
 
-	h.logger.Debug("admin browse request", zap.String("path", requestPath))
+	reqLogger(r, h.logger).Debug("admin browse request", zap.String("path", requestPath))
 
 	// Build full filesystem path
 	fullPath := filepath.Join(h.cacheRootDir, requestPath)
@@ -62,22 +64,24 @@ func (h *AdminHandler) HandleBrowse(w http.ResponseWriter, r *http.Request) {
 		if os.IsNotExist(err) {
 			http.Error(w, "Path not found", http.StatusNotFound)
 		} else {
-			h.logger.Error("failed to stat path", zap.String("path", fullPath), zap.Error(err))
+			reqLogger(r, h.logger).Error("failed to stat path", zap.String("path", fullPath), zap.Error(err))
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 		}
 		return
 	}
 
+	recordAudit(h.store, h.logger, r, domain.AuditActionAdminBrowse, "path:/"+requestPath, nil)
+
 	// If it's a file, serve it directly
 	if !info.IsDir() {
-		h.serveFile(w, r, fullPath)
+		h.serveFile(w, r, fullPath, "/"+filepath.ToSlash(requestPath))
 		return
 	}
 
 	// Read directory contents
 	entries, err := os.ReadDir(fullPath)
 	if err != nil {
-		h.logger.Error("failed to read directory", zap.String("path", fullPath), zap.Error(err))
+		reqLogger(r, h.logger).Error("failed to read directory", zap.String("path", fullPath), zap.Error(err))
 		http.Error(w, "Failed to read directory", http.StatusInternalServerError)
 		return
 	}
@@ -331,53 +335,55 @@ func (h *AdminHandler) buildBreadcrumb(requestPath string) string {
 	return breadcrumb
 }
 
-// serveFile serves a file from the filesystem
-func (h *AdminHandler) serveFile(w http.ResponseWriter, r *http.Request, fullPath string) {
-	f, err := os.Open(fullPath)
+// serveFile serves a file from the filesystem; synoPath locates its DB record
+func (h *AdminHandler) serveFile(w http.ResponseWriter, r *http.Request, fullPath, synoPath string) {
+	release := h.readers.Acquire(fullPath)
+	defer release()
+	f, err := cryptfile.Open(fullPath, h.keys)
 	if err != nil {
 		if os.IsNotExist(err) {
 			http.Error(w, "File not found", http.StatusNotFound)
 		} else {
-			h.logger.Error("failed to open file", zap.String("path", fullPath), zap.Error(err))
+			reqLogger(r, h.logger).Error("failed to open file", zap.String("path", fullPath), zap.Error(err))
 			http.Error(w, "File not available", http.StatusInternalServerError)
 		}
 		return
 	}
 	defer f.Close()
 
-	stat, err := f.Stat()
-	if err != nil {
-		h.logger.Error("failed to stat file", zap.String("path", fullPath), zap.Error(err))
-		http.Error(w, "File not available", http.StatusInternalServerError)
-		return
-	}
-
-	if stat.IsDir() {
-		http.Error(w, "Cannot download directory", http.StatusBadRequest)
-		return
+	// Files compressed at rest or exported are only recognisable through their DB record
+	filename := filepath.Base(fullPath)
+	encoding, storedType := "", ""
+	if dbFile, err := h.store.GetByPath(synoPath); err == nil && dbFile != nil && dbFile.CachePath == fullPath {
+		encoding = dbFile.CacheEncoding
+		storedType = dbFile.ServedContentType()
+		filename = dbFile.ServedName()
 	}
 
 	// Determine content type
-	filename := filepath.Base(fullPath)
-	contentType := mime.TypeByExtension(filepath.Ext(filename))
-	if contentType == "" {
-		contentType = "application/octet-stream"
+	contentType := cachedContentType(filename, storedType, encoding, f)
+
+	body, size, closeBody, err := cachedBody(w, r, f, encoding)
+	if err != nil {
+		reqLogger(r, h.logger).Error("failed to read compressed cache file", zap.String("path", fullPath), zap.Error(err))
+		http.Error(w, "File not available", http.StatusInternalServerError)
+		return
 	}
+	defer closeBody()
 
 	// Set headers
 	w.Header().Set("Content-Type", contentType)
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", stat.Size()))
-	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=\"%s\"", filename))
+	w.Header().Set("Content-Disposition", disposition.Format(disposition.Inline, filename))
 
 	// Stream file
-	if _, err := io.Copy(w, f); err != nil {
-		h.logger.Error("failed to stream file", zap.String("path", fullPath), zap.Error(err))
+	if err := serveCachedBody(w, r, body, size, f.ModTime(), h.buffers); err != nil {
+		reqLogger(r, h.logger).Error("failed to stream file", zap.String("path", fullPath), zap.Error(err))
 		return
 	}
 
-	h.logger.Info("file served via admin access",
+	reqLogger(r, h.logger).Info("file served via admin access",
 		zap.String("path", fullPath),
-		zap.Int64("size", stat.Size()))
+		zap.Int64("size", size))
 }
 
 // formatSize formats file size in human-readable format
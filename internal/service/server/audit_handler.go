@@ -0,0 +1,117 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"go.uber.org/zap"
+)
+
+// AuditHandler handles audit log queries
+type AuditHandler struct {
+	store  port.Store
+	logger *zap.Logger
+}
+
+// NewAuditHandler creates a new AuditHandler
+func NewAuditHandler(store port.Store, logger *zap.Logger) *AuditHandler {
+	return &AuditHandler{
+		store:  store,
+		logger: logger,
+	}
+}
+
+// auditEventResponse is the JSON representation of an audit event
+type auditEventResponse struct {
+	ID         int64             `json:"id"`
+	CreatedAt  time.Time         `json:"created_at"`
+	Actor      string            `json:"actor"`
+	Action     string            `json:"action"`
+	Target     string            `json:"target,omitempty"`
+	RemoteAddr string            `json:"remote_addr,omitempty"`
+	Details    map[string]string `json:"details,omitempty"`
+}
+
+// HandleAudit lists audit events
+//
+//	GET /api/v1/audit?actor=&action=&target=&since=&until=&limit=&offset=
+//
+// action matches exactly, or by prefix when it ends in "." (e.g. "share.").
+// since/until are RFC3339 timestamps.
+func (h *AuditHandler) HandleAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := domain.AuditFilter{
+		Actor:  query.Get("actor"),
+		Action: query.Get("action"),
+		Target: query.Get("target"),
+	}
+
+	for _, bound := range []struct {
+		name string
+		dst  **time.Time
+	}{{"since", &filter.Since}, {"until", &filter.Until}} {
+		v := query.Get(bound.name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, bound.name+" must be an RFC3339 timestamp", http.StatusBadRequest)
+			return
+		}
+		*bound.dst = &t
+	}
+
+	limit, offset := parsePagination(r)
+
+	events, err := h.store.ListAuditEvents(filter, limit, offset)
+	if err != nil {
+		reqLogger(r, h.logger).Error("failed to list audit events", zap.Error(err))
+		http.Error(w, "Failed to list audit events", http.StatusInternalServerError)
+		return
+	}
+
+	items := make([]auditEventResponse, 0, len(events))
+	for _, event := range events {
+		items = append(items, auditEventResponse{
+			ID:         event.ID,
+			CreatedAt:  event.CreatedAt,
+			Actor:      event.Actor,
+			Action:     event.Action,
+			Target:     event.Target,
+			RemoteAddr: event.RemoteAddr,
+			Details:    event.Details,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"events": items,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// recordAudit appends an audit event for an authenticated admin request.
+// Failures are logged and never fail the request itself.
+func recordAudit(audit port.AuditRepository, logger *zap.Logger, r *http.Request, action, target string, details map[string]string) {
+	event := &domain.AuditEvent{
+		Actor:      actorName(r),
+		Action:     action,
+		Target:     target,
+		RemoteAddr: clientIP(r),
+		Details:    details,
+	}
+	if err := audit.RecordAuditEvent(event); err != nil {
+		reqLogger(r, logger).Error("failed to record audit event",
+			zap.String("action", action),
+			zap.String("target", target),
+			zap.Error(err))
+	}
+}
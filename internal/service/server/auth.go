@@ -0,0 +1,274 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"github.com/vertextoedge/synology-file-cache/internal/util/passhash"
+	"github.com/vertextoedge/synology-file-cache/internal/util/ratelimiter"
+	"go.uber.org/zap"
+)
+
+// apiTokenPrefix marks API tokens so they are recognisable in configs and logs
+const apiTokenPrefix = "sfc_"
+
+// apiTokenTouchInterval limits how often last_used_at is written for a token
+const apiTokenTouchInterval = time.Minute
+
+// verifiedPasswordTTL is how long a verified password is remembered so browsers
+// re-sending Basic credentials on every request don't pay the hash cost
+const verifiedPasswordTTL = 5 * time.Minute
+
+type contextKey int
+
+const userContextKey contextKey = iota
+
+// UserFromContext returns the authenticated admin user of a request, or nil
+func UserFromContext(ctx context.Context) *domain.AdminUser {
+	user, _ := ctx.Value(userContextKey).(*domain.AdminUser)
+	return user
+}
+
+// actorName returns the username of the authenticated request user
+func actorName(r *http.Request) string {
+	if user := UserFromContext(r.Context()); user != nil {
+		return user.Username
+	}
+	return ""
+}
+
+// verifiedPassword remembers a successfully verified password for a user
+type verifiedPassword struct {
+	passwordHash string // stored hash the password was verified against
+	digest       [sha256.Size]byte
+	until        time.Time
+}
+
+// Authenticator authenticates admin requests with HTTP Basic credentials of
+// database users or the configured built-in admin, or with bearer API tokens.
+type Authenticator struct {
+	store               port.Store
+	builtinUsername     string
+	builtinPasswordHash string
+	logger              *zap.Logger
+	lockout             *ratelimiter.Lockout // Failed Basic logins per client IP (nil = none)
+
+	mu       sync.Mutex
+	verified map[string]verifiedPassword
+}
+
+// NewAuthenticator creates a new Authenticator.
+// The built-in account (if username and hash are set) always has the admin role.
+func NewAuthenticator(store port.Store, builtinUsername, builtinPasswordHash string, logger *zap.Logger) *Authenticator {
+	return &Authenticator{
+		store:               store,
+		builtinUsername:     builtinUsername,
+		builtinPasswordHash: builtinPasswordHash,
+		logger:              logger,
+		verified:            make(map[string]verifiedPassword),
+	}
+}
+
+// Middleware requires an authenticated user with at least minRole.
+// Unauthenticated requests get 401, authenticated users lacking the role get 403.
+func (a *Authenticator) Middleware(minRole string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			// Locked out clients are refused before their password is hashed
+			if _, _, basic := r.BasicAuth(); basic && a.lockout != nil {
+				if locked, remaining := a.lockout.Locked(clientIP(r)); locked {
+					setRetryAfter(w, remaining)
+					http.Error(w, "Too many failed login attempts", http.StatusTooManyRequests)
+					return
+				}
+			}
+
+			user := a.authenticate(r)
+			if user == nil {
+				w.Header().Set("WWW-Authenticate", `Basic realm="Admin Access"`)
+				http.Error(w, "Authentication required", http.StatusUnauthorized)
+				return
+			}
+
+			if !user.HasRole(minRole) {
+				reqLogger(r, a.logger).Warn("admin request denied by role",
+					zap.String("username", user.Username),
+					zap.String("role", user.Role),
+					zap.String("required", minRole),
+					zap.String("path", r.URL.Path))
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+
+			next(w, r.WithContext(context.WithValue(r.Context(), userContextKey, user)))
+		}
+	}
+}
+
+// requireRole writes 403 and returns false if the request user lacks role.
+// Used by handlers that mix read and write operations under one route.
+func requireRole(w http.ResponseWriter, r *http.Request, role string) bool {
+	user := UserFromContext(r.Context())
+	if user == nil || !user.HasRole(role) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// authenticate returns the user for the request credentials, or nil
+func (a *Authenticator) authenticate(r *http.Request) *domain.AdminUser {
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return a.authenticateToken(r, strings.TrimSpace(strings.TrimPrefix(header, "Bearer ")))
+	}
+
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return nil
+	}
+
+	user := a.authenticatePassword(username, password)
+	if user == nil {
+		reqLogger(r, a.logger).Warn("failed admin authentication attempt",
+			zap.String("username", username),
+			zap.String("client_ip", clientIP(r)))
+		if a.lockout != nil {
+			if d := a.lockout.Failure(clientIP(r)); d > 0 {
+				reqLogger(r, a.logger).Warn("admin login locked out after repeated failures",
+					zap.String("client_ip", clientIP(r)),
+					zap.Duration("lockout", d))
+			}
+		}
+	} else if a.lockout != nil {
+		a.lockout.Success(clientIP(r))
+	}
+	return user
+}
+
+// authenticatePassword checks Basic credentials against the built-in account and database users
+func (a *Authenticator) authenticatePassword(username, password string) *domain.AdminUser {
+	if a.builtinUsername != "" && a.builtinPasswordHash != "" &&
+		subtle.ConstantTimeCompare([]byte(username), []byte(a.builtinUsername)) == 1 {
+		if !a.checkPassword(username, a.builtinPasswordHash, password) {
+			return nil
+		}
+		return &domain.AdminUser{Username: a.builtinUsername, Role: domain.RoleAdmin}
+	}
+
+	user, err := a.store.GetUserByUsername(username)
+	if err != nil {
+		a.logger.Error("failed to look up admin user", zap.String("username", username), zap.Error(err))
+		return nil
+	}
+	if user == nil || user.Disabled {
+		return nil
+	}
+	if !a.checkPassword(username, user.PasswordHash, password) {
+		return nil
+	}
+	if passhash.NeedsRehash(user.PasswordHash) {
+		a.rehashPassword(user, password)
+	}
+	return user
+}
+
+// rehashPassword stores a hash of the current scheme for a user whose
+// password verified against an older one
+func (a *Authenticator) rehashPassword(user *domain.AdminUser, password string) {
+	hashed, err := passhash.Hash(password)
+	if err != nil {
+		a.logger.Warn("failed to rehash admin password", zap.String("username", user.Username), zap.Error(err))
+		return
+	}
+	user.PasswordHash = hashed
+	if err := a.store.UpdateUser(user); err != nil {
+		a.logger.Warn("failed to store rehashed admin password", zap.String("username", user.Username), zap.Error(err))
+		return
+	}
+	a.logger.Info("upgraded admin password hash", zap.String("username", user.Username))
+}
+
+// checkPassword verifies a password against a stored hash, using the verified cache
+func (a *Authenticator) checkPassword(username, passwordHash, password string) bool {
+	digest := sha256.Sum256([]byte(password))
+
+	a.mu.Lock()
+	entry, ok := a.verified[username]
+	a.mu.Unlock()
+	if ok && entry.passwordHash == passwordHash && time.Now().Before(entry.until) &&
+		subtle.ConstantTimeCompare(digest[:], entry.digest[:]) == 1 {
+		return true
+	}
+
+	if !passhash.Verify(passwordHash, password) {
+		return false
+	}
+
+	a.mu.Lock()
+	a.verified[username] = verifiedPassword{
+		passwordHash: passwordHash,
+		digest:       digest,
+		until:        time.Now().Add(verifiedPasswordTTL),
+	}
+	a.mu.Unlock()
+	return true
+}
+
+// authenticateToken resolves a bearer API token to its owning user
+func (a *Authenticator) authenticateToken(r *http.Request, value string) *domain.AdminUser {
+	if !strings.HasPrefix(value, apiTokenPrefix) {
+		return nil
+	}
+
+	token, err := a.store.GetAPITokenByHash(hashAPIToken(value))
+	if err != nil {
+		reqLogger(r, a.logger).Error("failed to look up api token", zap.Error(err))
+		return nil
+	}
+	if token == nil || !token.IsActive() {
+		reqLogger(r, a.logger).Warn("invalid api token used", zap.String("client_ip", clientIP(r)))
+		return nil
+	}
+
+	user, err := a.store.GetUserByID(token.UserID)
+	if err != nil {
+		reqLogger(r, a.logger).Error("failed to look up api token owner", zap.Int64("token_id", token.ID), zap.Error(err))
+		return nil
+	}
+	if user == nil || user.Disabled {
+		return nil
+	}
+
+	if token.LastUsedAt == nil || time.Since(*token.LastUsedAt) > apiTokenTouchInterval {
+		if err := a.store.TouchAPIToken(token.ID); err != nil {
+			reqLogger(r, a.logger).Warn("failed to record api token use", zap.Int64("token_id", token.ID), zap.Error(err))
+		}
+	}
+
+	return user
+}
+
+// generateAPIToken returns a new random API token value
+func generateAPIToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return apiTokenPrefix + hex.EncodeToString(b), nil
+}
+
+// hashAPIToken returns the hex SHA-256 of a token value.
+// Tokens are high-entropy, so a fast unsalted hash is sufficient.
+func hashAPIToken(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"crypto/pbkdf2"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/util/passhash"
+	"github.com/vertextoedge/synology-file-cache/internal/util/ratelimiter"
+	"go.uber.org/zap"
+)
+
+// basicRequest builds an admin request from ip with Basic credentials
+func basicRequest(ip, username, password string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/users", nil)
+	r.RemoteAddr = ip + ":1234"
+	r.SetBasicAuth(username, password)
+	return r
+}
+
+func TestAuthenticator_LocksOutFailedLogins(t *testing.T) {
+	_, store := newTestServer(t, nil)
+	hash, err := passhash.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := NewAuthenticator(store, "admin", hash, zap.NewNop())
+	auth.lockout = ratelimiter.NewLockout(3, time.Minute, time.Hour)
+	handler := auth.Middleware(domain.RoleViewer)(func(w http.ResponseWriter, r *http.Request) {})
+
+	serve := func(r *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+
+	for i := 0; i < 3; i++ {
+		if w := serve(basicRequest("198.51.100.2", "admin", "guess")); w.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: status = %d, want %d", i, w.Code, http.StatusUnauthorized)
+		}
+	}
+
+	// Even the right password is refused while locked out
+	w := serve(basicRequest("198.51.100.2", "admin", "correct horse"))
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("locked out status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("locked out response has no Retry-After")
+	}
+
+	// Other clients are unaffected
+	if w := serve(basicRequest("198.51.100.3", "admin", "correct horse")); w.Code != http.StatusOK {
+		t.Errorf("other client status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestAuthenticator_RehashesLegacyPassword(t *testing.T) {
+	_, store := newTestServer(t, nil)
+	salt := []byte("0123456789abcdef")
+	key, err := pbkdf2.Key(sha256.New, "s3cret", salt, 1000, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy := fmt.Sprintf("pbkdf2-sha256$1000$%s$%s",
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+	if err := store.CreateUser(&domain.AdminUser{Username: "ops", PasswordHash: legacy, Role: domain.RoleOperator}); err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+
+	auth := NewAuthenticator(store, "", "", zap.NewNop())
+	if user := auth.authenticate(basicRequest("198.51.100.2", "ops", "s3cret")); user == nil {
+		t.Fatal("legacy hash did not authenticate")
+	}
+
+	user, err := store.GetUserByUsername("ops")
+	if err != nil {
+		t.Fatalf("GetUserByUsername() error = %v", err)
+	}
+	if !strings.HasPrefix(user.PasswordHash, passhash.Prefix) || passhash.NeedsRehash(user.PasswordHash) {
+		t.Errorf("stored hash = %q, want a current argon2id hash", user.PasswordHash)
+	}
+	if !passhash.Verify(user.PasswordHash, "s3cret") {
+		t.Error("rehashed password does not verify")
+	}
+}
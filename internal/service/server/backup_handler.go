@@ -0,0 +1,106 @@
+package server
+
+import (
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"github.com/vertextoedge/synology-file-cache/internal/service/backup"
+	"go.uber.org/zap"
+)
+
+// BackupHandler handles database backup requests
+type BackupHandler struct {
+	store   port.Store
+	backups *backup.Service
+	logger  *zap.Logger
+}
+
+// NewBackupHandler creates a new BackupHandler
+func NewBackupHandler(store port.Store, backups *backup.Service, logger *zap.Logger) *BackupHandler {
+	return &BackupHandler{
+		store:   store,
+		backups: backups,
+		logger:  logger,
+	}
+}
+
+// HandleBackups routes backup requests
+//
+//	GET  /api/v1/backups         - list backups, newest first
+//	POST /api/v1/backups         - create a backup now
+//	GET  /api/v1/backups/{name}  - download a backup
+//
+// Restoring is done offline with the -restore-backup flag.
+func (h *BackupHandler) HandleBackups(w http.ResponseWriter, r *http.Request) {
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/backups"), "/")
+
+	switch {
+	case name == "" && r.Method == http.MethodGet:
+		h.listBackups(w, r)
+	case name == "" && r.Method == http.MethodPost:
+		h.createBackup(w, r)
+	case name != "" && r.Method == http.MethodGet:
+		h.downloadBackup(w, r, name)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// listBackups returns the existing backups
+func (h *BackupHandler) listBackups(w http.ResponseWriter, r *http.Request) {
+	backups, err := h.backups.List()
+	if err != nil {
+		reqLogger(r, h.logger).Error("failed to list backups", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"backups": backups,
+	})
+}
+
+// createBackup writes a new backup immediately
+func (h *BackupHandler) createBackup(w http.ResponseWriter, r *http.Request) {
+	info, err := h.backups.Create()
+	if err != nil {
+		reqLogger(r, h.logger).Error("manual backup failed", zap.Error(err))
+		http.Error(w, "Backup failed", http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(h.store, h.logger, r, domain.AuditActionBackupCreate, "backup:"+info.Name, nil)
+
+	writeJSON(w, http.StatusCreated, info)
+}
+
+// downloadBackup streams a backup file so it can be stored off the host
+func (h *BackupHandler) downloadBackup(w http.ResponseWriter, r *http.Request, name string) {
+	path, ok := h.backups.Path(name)
+	if !ok {
+		http.Error(w, "Backup not found", http.StatusNotFound)
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		http.Error(w, "Backup not found", http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(h.store, h.logger, r, domain.AuditActionBackupDownload, "backup:"+name, nil)
+
+	w.Header().Set("Content-Type", "application/vnd.sqlite3")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	http.ServeContent(w, r, name, stat.ModTime(), f)
+}
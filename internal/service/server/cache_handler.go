@@ -0,0 +1,126 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"go.uber.org/zap"
+)
+
+// CacheRequestFunc records a file by path and enqueues its download. The task
+// is nil when the file is already cached.
+type CacheRequestFunc func(ctx context.Context, path string, priority int) (*domain.File, *domain.DownloadTask, error)
+
+// CacheHandler handles client requests to cache specific files
+type CacheHandler struct {
+	audit   port.AuditRepository
+	request CacheRequestFunc // nil when the syncer is not available
+	logger  *zap.Logger
+}
+
+// NewCacheHandler creates a new CacheHandler
+func NewCacheHandler(audit port.AuditRepository, request CacheRequestFunc, logger *zap.Logger) *CacheHandler {
+	return &CacheHandler{
+		audit:   audit,
+		request: request,
+		logger:  logger,
+	}
+}
+
+// cacheRequestResponse is the JSON representation of a requested file
+type cacheRequestResponse struct {
+	FileID   int64  `json:"file_id"`
+	Path     string `json:"path"`
+	Priority int    `json:"priority"`
+	Status   string `json:"status"` // cached, pending or in_progress
+	TaskID   int64  `json:"task_id,omitempty"`
+}
+
+// HandleCache handles POST /api/v1/cache and requires the operator role.
+// The file is looked up on the NAS, recorded with at least the given priority
+// (default 2, like starred files) and its download is enqueued.
+//
+//	POST /api/v1/cache  {"path": "/mydrive/x.pdf", "priority": 1}
+func (h *CacheHandler) HandleCache(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireRole(w, r, domain.RoleOperator) {
+		return
+	}
+	if h.request == nil {
+		http.Error(w, "Cache requests not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	var req struct {
+		Path     string `json:"path"`
+		Priority int    `json:"priority"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !strings.HasPrefix(req.Path, "/") {
+		http.Error(w, "path must be an absolute Drive path", http.StatusBadRequest)
+		return
+	}
+	if req.Priority == 0 {
+		req.Priority = domain.PriorityStarred
+	}
+	filePath := path.Clean(req.Path)
+
+	file, task, err := h.request(r.Context(), filePath, req.Priority)
+	if err != nil {
+		writeUpstreamError(w, r, h.logger, "failed to request caching", filePath, err)
+		return
+	}
+
+	resp := cacheRequestResponse{
+		FileID:   file.ID,
+		Path:     file.Path,
+		Priority: file.Priority,
+		Status:   "cached",
+	}
+	status := http.StatusOK
+	details := map[string]string{"priority": strconv.Itoa(req.Priority)}
+	if task != nil {
+		resp.Status = task.Status
+		resp.TaskID = task.ID
+		status = http.StatusAccepted
+		details["task_id"] = strconv.FormatInt(task.ID, 10)
+	}
+
+	recordAudit(h.audit, h.logger, r, domain.AuditActionCacheRequest, "file:"+file.Path, details)
+	reqLogger(r, h.logger).Info("caching requested",
+		zap.String("path", file.Path),
+		zap.Int("priority", req.Priority),
+		zap.String("status", resp.Status),
+		zap.String("by", actorName(r)))
+
+	writeJSON(w, status, resp)
+}
+
+// writeUpstreamError writes the response for a failed request that looked up
+// a file on the NAS by path
+func writeUpstreamError(w http.ResponseWriter, r *http.Request, logger *zap.Logger, msg, filePath string, err error) {
+	switch {
+	case errors.Is(err, domain.ErrInvalidInput):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, domain.ErrMissingUpstream), errors.Is(err, domain.ErrNotFound):
+		http.Error(w, "File not found on the NAS", http.StatusNotFound)
+	case errors.Is(err, domain.ErrUpstreamUnavailable):
+		http.Error(w, "NAS unavailable", http.StatusServiceUnavailable)
+	default:
+		reqLogger(r, logger).Error(msg, zap.String("path", filePath), zap.Error(err))
+		http.Error(w, "NAS request failed: "+err.Error(), http.StatusBadGateway)
+	}
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/util/bufpool"
+	"github.com/vertextoedge/synology-file-cache/internal/util/compress"
+	"github.com/vertextoedge/synology-file-cache/internal/util/cryptfile"
+)
+
+// cachedBody returns the response body and Content-Length for an open cache file.
+// Files compressed at rest are sent as-is with Content-Encoding: gzip to clients
+// that accept it and decompressed on the fly for everyone else.
+// The returned closer must be called once the body has been copied.
+func cachedBody(w http.ResponseWriter, r *http.Request, f *cryptfile.File, encoding string) (io.Reader, int64, func(), error) {
+	size := f.Size()
+	if encoding != domain.CacheEncodingGzip {
+		return f, size, func() {}, nil
+	}
+
+	w.Header().Add("Vary", "Accept-Encoding")
+	if compress.Accepts(r.Header.Get("Accept-Encoding"), compress.Gzip) {
+		w.Header().Set("Content-Encoding", compress.Gzip)
+		return f, size, func() {}, nil
+	}
+
+	plainSize, err := gzipPlainSize(f, size)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, 0, nil, fmt.Errorf("invalid gzip data: %w", err)
+	}
+	return zr, plainSize, func() { zr.Close() }, nil
+}
+
+// serveCachedBody writes a body returned by cachedBody. A cache file sent as
+// stored goes through http.ServeContent, which answers range requests and,
+// for files not encrypted at rest, lets the kernel copy the file to the
+// socket (sendfile). Files compressed at rest are copied through a pooled
+// buffer with the given Content-Length.
+func serveCachedBody(w http.ResponseWriter, r *http.Request, body io.Reader, size int64, modTime time.Time, buffers *bufpool.Pool) error {
+	if f, ok := body.(*cryptfile.File); ok && w.Header().Get("Content-Encoding") == "" {
+		if osFile := f.OSFile(); osFile != nil {
+			http.ServeContent(w, r, "", modTime, osFile)
+		} else {
+			http.ServeContent(w, r, "", modTime, f)
+		}
+		return nil
+	}
+
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	_, err := buffers.Copy(w, body)
+	return err
+}
+
+// countingWriter counts the response body bytes of a single request
+type countingWriter struct {
+	http.ResponseWriter
+	bytes int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// ReadFrom keeps sendfile for cached files when the underlying writer supports it
+func (w *countingWriter) ReadFrom(src io.Reader) (int64, error) {
+	var n int64
+	var err error
+	if rf, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(src)
+	} else {
+		n, err = io.Copy(w.ResponseWriter, src)
+	}
+	w.bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach Flush on the underlying writer
+func (w *countingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// cachedContentType returns the Content-Type for a cache file: the type stored
+// with the file, else the one for the file name's extension, else one sniffed
+// from the first 512 bytes (not for files compressed at rest)
+func cachedContentType(name, stored, encoding string, f io.ReaderAt) string {
+	if stored != "" {
+		return stored
+	}
+	if contentType := mime.TypeByExtension(filepath.Ext(name)); contentType != "" {
+		return contentType
+	}
+	if encoding == "" {
+		head := make([]byte, 512)
+		if n, _ := f.ReadAt(head, 0); n > 0 {
+			return http.DetectContentType(head[:n])
+		}
+	}
+	return "application/octet-stream"
+}
+
+// gzipPlainSize reads the uncompressed size from the gzip trailer (ISIZE) and
+// rewinds f. Files compressed at rest are single-member and below 4 GiB
+// uncompressed, so the trailer holds the exact size.
+func gzipPlainSize(f *cryptfile.File, compressedSize int64) (int64, error) {
+	if compressedSize < 4 {
+		return 0, fmt.Errorf("gzip file too short")
+	}
+
+	var trailer [4]byte
+	if _, err := f.ReadAt(trailer[:], compressedSize-4); err != nil {
+		return 0, fmt.Errorf("failed to read gzip trailer: %w", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return int64(binary.LittleEndian.Uint32(trailer[:])), nil
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// corsPathPrefixes are the routes browser apps on other origins may call:
+// share downloads with their previews and streams, and the JSON API
+var corsPathPrefixes = []string{"/f/", "/d/s/", "/sharing/", "/api/"}
+
+// corsExposedHeaders are the response headers scripts on other origins may read
+const corsExposedHeaders = "Content-Length, Content-Range, Content-Disposition, Accept-Ranges, ETag, Last-Modified, Retry-After, X-Request-ID"
+
+// CORSConfig controls cross-origin access by browser apps on other domains
+type CORSConfig struct {
+	AllowedOrigins   []string      // Exact origins such as https://app.example.com, or "*" for any (empty = disabled)
+	AllowedMethods   []string      // Methods allowed by preflight responses
+	AllowedHeaders   []string      // Request headers allowed by preflight responses
+	AllowCredentials bool          // Let browsers send cookies and HTTP auth; not together with "*"
+	MaxAge           time.Duration // How long browsers may cache a preflight response (0 = browser default)
+}
+
+// Enabled reports whether any origin is allowed
+func (c CORSConfig) Enabled() bool {
+	return len(c.AllowedOrigins) > 0
+}
+
+// CORSMiddleware adds CORS headers to share and API responses for allowed
+// origins and answers their preflight requests. Requests from other origins
+// pass through without CORS headers, so browsers keep them from scripts.
+func CORSMiddleware(cfg CORSConfig) func(http.Handler) http.Handler {
+	anyOrigin := slices.Contains(cfg.AllowedOrigins, "*")
+	origins := make(map[string]bool, len(cfg.AllowedOrigins))
+	for _, origin := range cfg.AllowedOrigins {
+		origins[strings.ToLower(strings.TrimSuffix(origin, "/"))] = true
+	}
+	// Browsers refuse credentialed responses for "*", and echoing any origin
+	// with credentials would hand every site the user's session
+	credentials := cfg.AllowCredentials && !anyOrigin
+	methods := strings.Join(cfg.AllowedMethods, ", ")
+	headers := strings.Join(cfg.AllowedHeaders, ", ")
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" || !isCORSPath(r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			h.Add("Vary", "Origin")
+			if !anyOrigin && !origins[strings.ToLower(origin)] {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if anyOrigin {
+				h.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				h.Set("Access-Control-Allow-Origin", origin)
+			}
+			if credentials {
+				h.Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			// Preflight requests never reach the handlers, which only know their own methods
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				h.Add("Vary", "Access-Control-Request-Method")
+				h.Add("Vary", "Access-Control-Request-Headers")
+				h.Set("Access-Control-Allow-Methods", methods)
+				if headers != "" {
+					h.Set("Access-Control-Allow-Headers", headers)
+				}
+				if cfg.MaxAge > 0 {
+					h.Set("Access-Control-Max-Age", strconv.Itoa(int(cfg.MaxAge.Seconds())))
+				}
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			h.Set("Access-Control-Expose-Headers", corsExposedHeaders)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// isCORSPath reports whether cross-origin requests may reach path
+func isCORSPath(path string) bool {
+	for _, prefix := range corsPathPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
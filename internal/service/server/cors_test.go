@@ -0,0 +1,125 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// serveCORS runs r through the CORS middleware and reports whether it reached the handler
+func serveCORS(cfg CORSConfig, r *http.Request) (*httptest.ResponseRecorder, bool) {
+	reached := false
+	handler := CORSMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w, reached
+}
+
+func testCORSConfig() CORSConfig {
+	return CORSConfig{
+		AllowedOrigins:   []string{"https://app.example.com/"},
+		AllowedMethods:   []string{"GET", "HEAD", "POST"},
+		AllowedHeaders:   []string{"Authorization", "Range"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	}
+}
+
+func TestCORSMiddleware_Preflight(t *testing.T) {
+	r := httptest.NewRequest(http.MethodOptions, "/f/abc", nil)
+	r.Header.Set("Origin", "https://App.example.com")
+	r.Header.Set("Access-Control-Request-Method", "GET")
+
+	w, reached := serveCORS(testCORSConfig(), r)
+	if reached {
+		t.Error("preflight reached the handler")
+	}
+	if w.Code != http.StatusNoContent {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusNoContent)
+	}
+
+	want := map[string]string{
+		"Access-Control-Allow-Origin":      "https://App.example.com",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Allow-Methods":     "GET, HEAD, POST",
+		"Access-Control-Allow-Headers":     "Authorization, Range",
+		"Access-Control-Max-Age":           "600",
+	}
+	for name, value := range want {
+		if got := w.Header().Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+}
+
+func TestCORSMiddleware_SimpleRequest(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/files", nil)
+	r.Header.Set("Origin", "https://app.example.com")
+
+	w, reached := serveCORS(testCORSConfig(), r)
+	if !reached {
+		t.Fatal("request did not reach the handler")
+	}
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want the request origin", got)
+	}
+	if got := w.Header().Get("Access-Control-Expose-Headers"); got != corsExposedHeaders {
+		t.Errorf("Access-Control-Expose-Headers = %q, want %q", got, corsExposedHeaders)
+	}
+	if got := w.Header().Get("Vary"); got != "Origin" {
+		t.Errorf("Vary = %q, want Origin", got)
+	}
+}
+
+func TestCORSMiddleware_NotAllowed(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		origin string
+	}{
+		{"other origin", http.MethodGet, "/f/abc", "https://evil.example.com"},
+		{"other origin preflight", http.MethodOptions, "/f/abc", "https://evil.example.com"},
+		{"admin page", http.MethodGet, "/admin/", "https://app.example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			r.Header.Set("Origin", tt.origin)
+			r.Header.Set("Access-Control-Request-Method", "GET")
+
+			w, reached := serveCORS(testCORSConfig(), r)
+			if !reached {
+				t.Error("request did not reach the handler")
+			}
+			for _, name := range []string{"Access-Control-Allow-Origin", "Access-Control-Allow-Credentials", "Access-Control-Allow-Methods"} {
+				if got := w.Header().Get(name); got != "" {
+					t.Errorf("%s = %q, want none", name, got)
+				}
+			}
+		})
+	}
+}
+
+func TestCORSMiddleware_AnyOriginWithoutCredentials(t *testing.T) {
+	cfg := testCORSConfig()
+	cfg.AllowedOrigins = []string{"*"}
+
+	for _, method := range []string{http.MethodGet, http.MethodOptions} {
+		r := httptest.NewRequest(method, "/f/abc", nil)
+		r.Header.Set("Origin", "https://anywhere.example.com")
+		r.Header.Set("Access-Control-Request-Method", "GET")
+
+		w, _ := serveCORS(cfg, r)
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+			t.Errorf("%s: Access-Control-Allow-Origin = %q, want *", method, got)
+		}
+		// Credentials are never allowed together with "*"
+		if got := w.Header().Get("Access-Control-Allow-Credentials"); got != "" {
+			t.Errorf("%s: Access-Control-Allow-Credentials = %q, want none", method, got)
+		}
+	}
+}
@@ -0,0 +1,537 @@
+package server
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"github.com/vertextoedge/synology-file-cache/internal/service/stats"
+	"go.uber.org/zap"
+)
+
+const (
+	// dashboardRange is the default time span of the dashboard charts
+	dashboardRange = 24 * time.Hour
+
+	// dashboardMaxRange bounds the requested time span
+	dashboardMaxRange = 30 * 24 * time.Hour
+
+	// dashboardLiveInterval is the minimum time between live reloads of the
+	// dashboard, which renders charts from the stats history
+	dashboardLiveInterval = 10 * time.Second
+
+	// dashboardErrors is how many recent failed downloads the dashboard lists
+	dashboardErrors = 10
+
+	// Chart size in SVG user units
+	chartWidth  = 600
+	chartHeight = 120
+)
+
+// DashboardHandler serves the admin dashboard and the statistics history
+type DashboardHandler struct {
+	store         port.Store
+	stats         *stats.Service           // nil = sampling disabled, only current values are shown
+	cacheMaxBytes int64                    // Cache size limit for the fill level (0 = unknown)
+	live          bool                     // Event stream available, the page reloads on cache events
+	scope         func() *domain.SyncScope // nil or nil result = sync scope not tuned
+	logger        *zap.Logger
+}
+
+// NewDashboardHandler creates a new DashboardHandler
+func NewDashboardHandler(store port.Store, statsService *stats.Service, cacheMaxBytes int64, logger *zap.Logger) *DashboardHandler {
+	return &DashboardHandler{
+		store:         store,
+		stats:         statsService,
+		cacheMaxBytes: cacheMaxBytes,
+		logger:        logger,
+	}
+}
+
+// statSnapshotResponse is the JSON representation of a statistics snapshot
+type statSnapshotResponse struct {
+	Instance        string    `json:"instance"`
+	TakenAt         time.Time `json:"taken_at"`
+	TotalFiles      int64     `json:"total_files"`
+	CachedFiles     int64     `json:"cached_files"`
+	CachedBytes     int64     `json:"cached_bytes"`
+	CacheHits       int64     `json:"cache_hits"`
+	CacheMisses     int64     `json:"cache_misses"`
+	DownloadedBytes int64     `json:"downloaded_bytes"`
+	ServedBytes     int64     `json:"served_bytes"`
+	PendingTasks    int       `json:"pending_tasks"`
+	InProgressTasks int       `json:"in_progress_tasks"`
+	FailedTasks     int       `json:"failed_tasks"`
+	QueuedBytes     int64     `json:"queued_bytes"`
+}
+
+// statsSummaryResponse totals the snapshots of a stats history query
+type statsSummaryResponse struct {
+	Snapshots         int     `json:"snapshots"`
+	CacheHits         int64   `json:"cache_hits"`
+	CacheMisses       int64   `json:"cache_misses"`
+	HitRatio          float64 `json:"hit_ratio"` // -1 without requests
+	DownloadedBytes   int64   `json:"downloaded_bytes"`
+	ServedBytes       int64   `json:"served_bytes"`
+	CachedBytesGrowth int64   `json:"cached_bytes_growth"` // Last minus first cached_bytes
+	PeakCachedBytes   int64   `json:"peak_cached_bytes"`
+	PeakPendingTasks  int     `json:"peak_pending_tasks"`
+}
+
+// accessTotalsResponse holds the per-file access counters summed over all
+// files, i.e. since the files were first tracked rather than within the range
+type accessTotalsResponse struct {
+	CacheHits   int64   `json:"cache_hits"`
+	CacheMisses int64   `json:"cache_misses"`
+	HitRatio    float64 `json:"hit_ratio"` // -1 without requests
+	ServedBytes int64   `json:"served_bytes"`
+}
+
+// syncScopeResponse is the sync scope tuned from the hit ratio
+type syncScopeResponse struct {
+	RecentModifiedDays int                     `json:"recent_modified_days"`
+	ScanMaxDepth       int                     `json:"scan_max_depth"` // 0 = unlimited
+	Decisions          []scopeDecisionResponse `json:"decisions"`      // Most recent last
+}
+
+// scopeDecisionResponse is one evaluation of the hit ratio after a full sync
+type scopeDecisionResponse struct {
+	At                 time.Time `json:"at"`
+	Action             string    `json:"action"` // widen, shrink or keep
+	Reason             string    `json:"reason"`
+	Hits               int64     `json:"hits"`
+	Misses             int64     `json:"misses"`
+	MissRatio          float64   `json:"miss_ratio"`
+	UnservedRatio      float64   `json:"unserved_ratio"`
+	RecentModifiedDays int       `json:"recent_modified_days"`
+	ScanMaxDepth       int       `json:"scan_max_depth"`
+}
+
+func newSyncScopeResponse(scope *domain.SyncScope) syncScopeResponse {
+	resp := syncScopeResponse{
+		RecentModifiedDays: scope.RecentModifiedDays,
+		ScanMaxDepth:       scope.ScanMaxDepth,
+		Decisions:          make([]scopeDecisionResponse, 0, len(scope.Decisions)),
+	}
+	for _, d := range scope.Decisions {
+		resp.Decisions = append(resp.Decisions, scopeDecisionResponse{
+			At:                 d.At,
+			Action:             d.Action,
+			Reason:             d.Reason,
+			Hits:               d.Hits,
+			Misses:             d.Misses,
+			MissRatio:          d.MissRatio,
+			UnservedRatio:      d.UnservedRatio,
+			RecentModifiedDays: d.RecentModifiedDays,
+			ScanMaxDepth:       d.ScanMaxDepth,
+		})
+	}
+	return resp
+}
+
+// HandleStats returns the stats history
+//
+//	GET /api/v1/stats?range=24h
+//	GET /api/v1/stats?since=2025-01-01T00:00:00Z&until=2025-02-01T00:00:00Z&instance=all
+//
+// range counts back from now and is ignored when since is set. since/until
+// are RFC3339 timestamps, until defaults to now. instance defaults to this
+// instance, "all" returns the snapshots of every instance.
+func (h *DashboardHandler) HandleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	until := time.Now()
+	if v := query.Get("until"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "until must be an RFC3339 timestamp", http.StatusBadRequest)
+			return
+		}
+		until = t
+	}
+
+	var since time.Time
+	if v := query.Get("since"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "since must be an RFC3339 timestamp", http.StatusBadRequest)
+			return
+		}
+		if !t.Before(until) {
+			http.Error(w, "since must be before until", http.StatusBadRequest)
+			return
+		}
+		since = t
+	} else {
+		span, err := parseDashboardRange(query.Get("range"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		since = until.Add(-span)
+	}
+
+	instance := query.Get("instance")
+	switch {
+	case instance == "all":
+		instance = ""
+	case instance == "" && h.stats != nil:
+		instance = h.stats.Instance()
+	}
+
+	snapshots, err := h.store.ListStatSnapshots(instance, since, until)
+	if err != nil {
+		reqLogger(r, h.logger).Error("failed to list stats snapshots", zap.Error(err))
+		http.Error(w, "Failed to list statistics", http.StatusInternalServerError)
+		return
+	}
+
+	items := make([]statSnapshotResponse, 0, len(snapshots))
+	summary := statsSummaryResponse{Snapshots: len(snapshots), HitRatio: -1}
+	for _, s := range snapshots {
+		items = append(items, statSnapshotResponse{
+			Instance:        s.Instance,
+			TakenAt:         s.TakenAt,
+			TotalFiles:      s.TotalFiles,
+			CachedFiles:     s.CachedFiles,
+			CachedBytes:     s.CachedBytes,
+			CacheHits:       s.CacheHits,
+			CacheMisses:     s.CacheMisses,
+			DownloadedBytes: s.DownloadedBytes,
+			ServedBytes:     s.ServedBytes,
+			PendingTasks:    s.PendingTasks,
+			InProgressTasks: s.InProgressTasks,
+			FailedTasks:     s.FailedTasks,
+			QueuedBytes:     s.QueuedBytes,
+		})
+
+		summary.CacheHits += s.CacheHits
+		summary.CacheMisses += s.CacheMisses
+		summary.DownloadedBytes += s.DownloadedBytes
+		summary.ServedBytes += s.ServedBytes
+		summary.PeakCachedBytes = max(summary.PeakCachedBytes, s.CachedBytes)
+		summary.PeakPendingTasks = max(summary.PeakPendingTasks, s.PendingTasks)
+	}
+	if requests := summary.CacheHits + summary.CacheMisses; requests > 0 {
+		summary.HitRatio = float64(summary.CacheHits) / float64(requests)
+	}
+	if len(snapshots) > 0 {
+		summary.CachedBytesGrowth = snapshots[len(snapshots)-1].CachedBytes - snapshots[0].CachedBytes
+	}
+
+	response := map[string]interface{}{
+		"since":           since.UTC(),
+		"until":           until.UTC(),
+		"snapshots":       items,
+		"summary":         summary,
+		"cache_max_bytes": h.cacheMaxBytes,
+	}
+	if cacheStats, err := h.store.GetCacheStats(); err != nil {
+		reqLogger(r, h.logger).Warn("failed to get access counter totals", zap.Error(err))
+	} else {
+		totals := accessTotalsResponse{
+			CacheHits:   cacheStats.AccessCount,
+			CacheMisses: cacheStats.MissCount,
+			HitRatio:    -1,
+			ServedBytes: cacheStats.BytesServed,
+		}
+		if requests := totals.CacheHits + totals.CacheMisses; requests > 0 {
+			totals.HitRatio = float64(totals.CacheHits) / float64(requests)
+		}
+		response["totals"] = totals
+	}
+	if h.scope != nil {
+		if scope := h.scope(); scope != nil {
+			response["sync_scope"] = newSyncScopeResponse(scope)
+		}
+	}
+	if h.stats != nil {
+		response["instance"] = h.stats.Instance()
+		response["interval_seconds"] = int64(h.stats.Interval().Seconds())
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// HandleDashboard renders the dashboard page
+//
+//	GET /admin/dashboard?range=24h
+func (h *DashboardHandler) HandleDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	span, err := parseDashboardRange(r.URL.Query().Get("range"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	cacheStats, err := h.store.GetCacheStats()
+	if err != nil {
+		reqLogger(r, h.logger).Error("failed to get cache stats", zap.Error(err))
+		http.Error(w, "Failed to get cache stats", http.StatusInternalServerError)
+		return
+	}
+	queueStats, err := h.store.GetQueueStats()
+	if err != nil {
+		reqLogger(r, h.logger).Error("failed to get queue stats", zap.Error(err))
+		http.Error(w, "Failed to get queue stats", http.StatusInternalServerError)
+		return
+	}
+	failed, err := h.store.ListTasksByStatus(domain.TaskStatusFailed, dashboardErrors, 0)
+	if err != nil {
+		reqLogger(r, h.logger).Error("failed to list failed tasks", zap.Error(err))
+		http.Error(w, "Failed to list tasks", http.StatusInternalServerError)
+		return
+	}
+	snapshots, err := h.snapshots(span)
+	if err != nil {
+		reqLogger(r, h.logger).Error("failed to list stats snapshots", zap.Error(err))
+		http.Error(w, "Failed to list statistics", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Range    string
+		Ranges   []string
+		Sampling bool
+		Cache    *domain.CacheStats
+		CacheMax int64
+		Queue    *domain.QueueStats
+		Charts   []chart
+		Errors   []*domain.DownloadTask
+		Live     template.HTML
+	}{
+		Range:    formatRange(span),
+		Ranges:   []string{"6h", "24h", "7d", "30d"},
+		Sampling: h.stats != nil,
+		Cache:    cacheStats,
+		CacheMax: h.cacheMaxBytes,
+		Queue:    queueStats,
+		Charts:   h.charts(snapshots, time.Now().Add(-span), time.Now()),
+		Errors:   failed,
+	}
+	if h.live {
+		data.Live = liveReload([]string{
+			domain.EventTaskCompleted,
+			domain.EventTaskFailed,
+			domain.EventFileEvicted,
+			domain.EventSyncCompleted,
+		}, dashboardLiveInterval)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := dashboardPage.Execute(w, data); err != nil {
+		reqLogger(r, h.logger).Error("failed to render dashboard", zap.Error(err))
+	}
+}
+
+// snapshots returns this instance's snapshots of the last span
+func (h *DashboardHandler) snapshots(span time.Duration) ([]*domain.StatSnapshot, error) {
+	if h.stats == nil {
+		return nil, nil
+	}
+	now := time.Now()
+	return h.store.ListStatSnapshots(h.stats.Instance(), now.Add(-span), now)
+}
+
+// chart is a line chart of one statistic rendered as an SVG polyline
+type chart struct {
+	Title  string
+	Latest string // Formatted most recent value ("-" without data)
+	Peak   string // Formatted value at the top of the chart
+	Points string // SVG polyline points
+}
+
+// charts builds the dashboard charts from snapshots between start and end
+func (h *DashboardHandler) charts(snapshots []*domain.StatSnapshot, start, end time.Time) []chart {
+	fill := make([]chartPoint, 0, len(snapshots))
+	ratio := make([]chartPoint, 0, len(snapshots))
+	throughput := make([]chartPoint, 0, len(snapshots))
+	served := make([]chartPoint, 0, len(snapshots))
+	backlog := make([]chartPoint, 0, len(snapshots))
+
+	for i, s := range snapshots {
+		fill = append(fill, chartPoint{s.TakenAt, float64(s.CachedBytes)})
+		if hr := s.HitRatio(); hr >= 0 {
+			ratio = append(ratio, chartPoint{s.TakenAt, hr * 100})
+		}
+		backlog = append(backlog, chartPoint{s.TakenAt, float64(s.PendingTasks + s.InProgressTasks)})
+
+		// Transfers are counted since the previous snapshot
+		if i > 0 {
+			if seconds := s.TakenAt.Sub(snapshots[i-1].TakenAt).Seconds(); seconds > 0 {
+				throughput = append(throughput, chartPoint{s.TakenAt, float64(s.DownloadedBytes) / seconds})
+				served = append(served, chartPoint{s.TakenAt, float64(s.ServedBytes) / seconds})
+			}
+		}
+	}
+
+	sizeFormat := func(v float64) string { return formatSize(int64(v)) }
+	return []chart{
+		newChart("Cache fill level", fill, float64(h.cacheMaxBytes), start, end, sizeFormat),
+		newChart("Hit ratio", ratio, 100, start, end, func(v float64) string { return fmt.Sprintf("%.0f%%", v) }),
+		newChart("Download throughput", throughput, 0, start, end, formatSpeed),
+		newChart("Served throughput", served, 0, start, end, formatSpeed),
+		newChart("Queue backlog (tasks)", backlog, 0, start, end, func(v float64) string { return fmt.Sprintf("%.0f", v) }),
+	}
+}
+
+// chartPoint is one value of a chart
+type chartPoint struct {
+	at    time.Time
+	value float64
+}
+
+// newChart scales points into the chart area. The top of the chart is peak,
+// or the largest value when peak is 0 or exceeded.
+func newChart(title string, points []chartPoint, peak float64, start, end time.Time, format func(float64) string) chart {
+	c := chart{Title: title, Latest: "-"}
+	for _, p := range points {
+		peak = max(peak, p.value)
+	}
+	if peak <= 0 {
+		peak = 1
+	}
+	c.Peak = format(peak)
+	if len(points) == 0 {
+		return c
+	}
+	c.Latest = format(points[len(points)-1].value)
+
+	span := end.Sub(start).Seconds()
+	coords := make([]string, 0, len(points))
+	for _, p := range points {
+		x := p.at.Sub(start).Seconds() / span * chartWidth
+		y := chartHeight - p.value/peak*chartHeight
+		coords = append(coords, fmt.Sprintf("%.1f,%.1f", x, y))
+	}
+	c.Points = strings.Join(coords, " ")
+	return c
+}
+
+// parseDashboardRange parses a time span like "24h" or "7d"
+func parseDashboardRange(s string) (time.Duration, error) {
+	if s == "" {
+		return dashboardRange, nil
+	}
+
+	var d time.Duration
+	var err error
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		d, err = time.ParseDuration(days + "h")
+		d *= 24
+	} else {
+		d, err = time.ParseDuration(s)
+	}
+	if err != nil || d <= 0 || d > dashboardMaxRange {
+		return 0, fmt.Errorf("range must be a positive duration of at most 30d")
+	}
+	return d, nil
+}
+
+// formatRange formats a time span the way parseDashboardRange accepts it
+func formatRange(d time.Duration) string {
+	if d%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(d.String(), "0s"), "0m")
+}
+
+var dashboardPage = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"size": formatSize,
+	"time": func(t time.Time) string { return t.Local().Format("2006-01-02 15:04:05") },
+	"percent": func(part, total int64) string {
+		if total <= 0 {
+			return "-"
+		}
+		return fmt.Sprintf("%.0f%%", float64(part)/float64(total)*100)
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <meta http-equiv="refresh" content="60">
+    <title>Dashboard</title>
+    <style>
+        body { font-family: sans-serif; margin: 20px; }
+        h1 { font-size: 24px; font-weight: normal; border-bottom: 2px solid #333; padding-bottom: 10px; }
+        h2 { font-size: 18px; font-weight: normal; margin-top: 30px; }
+        .cards { display: flex; flex-wrap: wrap; gap: 12px; }
+        .card { border: 1px solid #ddd; border-radius: 6px; padding: 10px 16px; min-width: 160px; }
+        .card .label { color: #666; font-size: 13px; }
+        .card .value { font-size: 20px; margin-top: 4px; }
+        .charts { display: grid; grid-template-columns: repeat(auto-fill, minmax(420px, 1fr)); gap: 20px; margin-top: 20px; }
+        .chart h3 { font-size: 15px; font-weight: normal; margin: 0 0 6px 0; }
+        .chart .latest { float: right; color: #333; }
+        .chart svg { width: 100%; height: 120px; background-color: #fafafa; border: 1px solid #eee; }
+        .chart polyline { fill: none; stroke: #0066cc; stroke-width: 2; vector-effect: non-scaling-stroke; }
+        .chart .peak { color: #666; font-size: 12px; }
+        table { border-collapse: collapse; width: 100%; margin-top: 10px; }
+        th, td { text-align: left; padding: 8px 12px; border-bottom: 1px solid #ddd; }
+        th { background-color: #f0f0f0; font-weight: bold; }
+        .ranges a { margin-right: 10px; }
+        .empty { color: #666; }
+    </style>
+</head>
+<body>
+    <h1>Dashboard</h1>
+    <div class="cards">
+        <div class="card"><div class="label">Cached</div><div class="value">{{size .Cache.CachedSizeBytes}}{{if .CacheMax}} / {{size .CacheMax}} ({{percent .Cache.CachedSizeBytes .CacheMax}}){{end}}</div></div>
+        <div class="card"><div class="label">Cached files</div><div class="value">{{.Cache.CachedFiles}} / {{.Cache.TotalFiles}}</div></div>
+        <div class="card"><div class="label">Active shares</div><div class="value">{{.Cache.ActiveShares}}</div></div>
+        <div class="card"><div class="label">Queue</div><div class="value">{{.Queue.PendingCount}} pending, {{.Queue.InProgressCount}} active</div></div>
+        <div class="card"><div class="label">Queued</div><div class="value">{{size .Queue.TotalBytesQueued}}</div></div>
+        <div class="card"><div class="label">Failed downloads</div><div class="value">{{.Queue.FailedCount}}</div></div>
+    </div>
+
+    <h2>Last {{.Range}}</h2>
+    {{if .Sampling}}
+    <div class="ranges">{{range .Ranges}}<a href="?range={{.}}">{{.}}</a>{{end}}</div>
+    <div class="charts">
+        {{range .Charts}}
+        <div class="chart">
+            <h3>{{.Title}} <span class="latest">{{.Latest}}</span></h3>
+            <svg viewBox="0 0 600 120" preserveAspectRatio="none">{{if .Points}}<polyline points="{{.Points}}"/>{{end}}</svg>
+            <div class="peak">Top: {{.Peak}}</div>
+        </div>
+        {{end}}
+    </div>
+    {{else}}
+    <p class="empty">Statistics sampling is disabled (stats.enabled).</p>
+    {{end}}
+
+    <h2>Recent errors</h2>
+    {{if .Errors}}
+    <table>
+        <tr>
+            <th>Updated</th>
+            <th>Path</th>
+            <th>Retries</th>
+            <th>Error</th>
+        </tr>
+        {{range .Errors}}
+        <tr>
+            <td>{{time .UpdatedAt}}</td>
+            <td>{{.SynoPath}}</td>
+            <td>{{.RetryCount}}</td>
+            <td>{{.LastError}}</td>
+        </tr>
+        {{end}}
+    </table>
+    {{else}}
+    <p class="empty">No failed downloads.</p>
+    {{end}}
+    {{.Live}}
+</body>
+</html>`))
@@ -31,7 +31,7 @@ func (h *DebugHandler) HandleStats(w http.ResponseWriter, r *http.Request) {
 
 	stats, err := h.store.GetCacheStats()
 	if err != nil {
-		h.logger.Error("failed to get cache stats", zap.Error(err))
+		reqLogger(r, h.logger).Error("failed to get cache stats", zap.Error(err))
 		http.Error(w, "Failed to get cache stats", http.StatusInternalServerError)
 		return
 	}
@@ -50,7 +50,7 @@ func (h *DebugHandler) HandleFiles(w http.ResponseWriter, r *http.Request) {
 	// Get cache stats
 	stats, err := h.store.GetCacheStats()
 	if err != nil {
-		h.logger.Error("failed to get cache stats", zap.Error(err))
+		reqLogger(r, h.logger).Error("failed to get cache stats", zap.Error(err))
 		http.Error(w, "Failed to get cache stats", http.StatusInternalServerError)
 		return
 	}
@@ -58,7 +58,7 @@ func (h *DebugHandler) HandleFiles(w http.ResponseWriter, r *http.Request) {
 	// Get queue stats
 	queueStats, err := h.store.GetQueueStats()
 	if err != nil {
-		h.logger.Error("failed to get queue stats", zap.Error(err))
+		reqLogger(r, h.logger).Error("failed to get queue stats", zap.Error(err))
 		http.Error(w, "Failed to get queue stats", http.StatusInternalServerError)
 		return
 	}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/service/events"
+	"go.uber.org/zap"
+)
+
+const (
+	// eventsHeartbeat is how often an idle event stream sends a comment, so
+	// proxies don't close it and dead clients are noticed
+	eventsHeartbeat = 15 * time.Second
+
+	// eventsRetry is the reconnect delay suggested to EventSource clients
+	eventsRetry = 3 * time.Second
+)
+
+// EventsHandler streams cache events over Server-Sent Events
+type EventsHandler struct {
+	bus      *events.Bus
+	shutdown <-chan struct{} // Closed when the server shuts down
+	logger   *zap.Logger
+}
+
+// NewEventsHandler creates a new EventsHandler; streams end when shutdown is closed
+func NewEventsHandler(bus *events.Bus, shutdown <-chan struct{}, logger *zap.Logger) *EventsHandler {
+	return &EventsHandler{
+		bus:      bus,
+		shutdown: shutdown,
+		logger:   logger,
+	}
+}
+
+// eventResponse is the JSON representation of an event
+type eventResponse struct {
+	ID     int64          `json:"id"`
+	Type   string         `json:"type"`
+	Time   time.Time      `json:"time"`
+	TaskID int64          `json:"task_id,omitempty"`
+	FileID int64          `json:"file_id,omitempty"`
+	Path   string         `json:"path,omitempty"`
+	Size   int64          `json:"size,omitempty"`
+	Error  string         `json:"error,omitempty"`
+	Retry  bool           `json:"retry,omitempty"`
+	Kind   string         `json:"kind,omitempty"`
+	Counts map[string]int `json:"counts,omitempty"`
+}
+
+// HandleEvents streams events as text/event-stream
+//
+//	GET /api/v1/events
+//	GET /api/v1/events?types=task.failed,file.cached
+//
+// Each event is sent with its type as the SSE event name and its ID, so an
+// EventSource that reconnects with Last-Event-ID (or ?last_event_id=)
+// receives the recent events it missed. A client that falls too far behind
+// is disconnected and catches up the same way.
+func (h *EventsHandler) HandleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var types []string
+	if v := r.URL.Query().Get("types"); v != "" {
+		for _, t := range strings.Split(v, ",") {
+			t = strings.TrimSpace(t)
+			if !domain.IsEventType(t) {
+				http.Error(w, "types must be a comma-separated list of "+strings.Join(domain.EventTypes, ", "), http.StatusBadRequest)
+				return
+			}
+			types = append(types, t)
+		}
+	}
+
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("last_event_id")
+	}
+	var after int64
+	if lastID != "" {
+		id, err := strconv.ParseInt(lastID, 10, 64)
+		if err != nil || id < 0 {
+			http.Error(w, "Invalid last event ID", http.StatusBadRequest)
+			return
+		}
+		after = id
+	}
+
+	// The stream stays open far longer than the server write timeout
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		reqLogger(r, h.logger).Debug("failed to clear write deadline", zap.Error(err))
+	}
+
+	sub, missed := h.bus.Subscribe(types, after)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // nginx would hold events back
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", eventsRetry.Milliseconds())
+	for _, event := range missed {
+		if err := writeEvent(w, event); err != nil {
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		reqLogger(r, h.logger).Debug("event stream cannot be flushed", zap.Error(err))
+		return
+	}
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-h.shutdown:
+			return
+		case event, ok := <-sub.C:
+			if !ok {
+				reqLogger(r, h.logger).Debug("event subscriber fell behind, closing stream")
+				return
+			}
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// writeEvent writes an event in the SSE wire format
+func writeEvent(w http.ResponseWriter, event domain.Event) error {
+	data, err := json.Marshal(eventResponse{
+		ID:     event.ID,
+		Type:   event.Type,
+		Time:   event.Time,
+		TaskID: event.TaskID,
+		FileID: event.FileID,
+		Path:   event.Path,
+		Size:   event.Size,
+		Error:  event.Error,
+		Retry:  event.Retry,
+		Kind:   event.Kind,
+		Counts: event.Counts,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
+
+// liveReload returns a script for admin pages that reloads the page when an
+// event of the given types arrives, at most once per interval. The page's
+// meta refresh stays as a fallback when the stream is unavailable.
+func liveReload(types []string, interval time.Duration) template.HTML {
+	list, _ := json.Marshal(types)
+	return template.HTML(fmt.Sprintf(`<script>
+(function() {
+    var source = new EventSource("/api/v1/events?types=" + %s.join(","));
+    var loaded = Date.now(), timer = null;
+    function reload() {
+        if (timer) { return; }
+        timer = setTimeout(function() { location.reload(); }, Math.max(0, loaded + %d - Date.now()));
+    }
+    %s.forEach(function(t) { source.addEventListener(t, reload); });
+})();
+</script>`, list, interval.Milliseconds(), list))
+}
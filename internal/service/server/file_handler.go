@@ -1,36 +1,110 @@
 package server
 
 import (
-	"crypto/rand"
-	"crypto/sha256"
-	"crypto/subtle"
-	"encoding/hex"
+	"errors"
 	"fmt"
-	"io"
+	"html/template"
 	"mime"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
-	"sync"
 	"time"
 
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
 	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"github.com/vertextoedge/synology-file-cache/internal/service/chunk"
+	"github.com/vertextoedge/synology-file-cache/internal/service/partial"
+	"github.com/vertextoedge/synology-file-cache/internal/service/preview"
+	"github.com/vertextoedge/synology-file-cache/internal/service/stats"
+	"github.com/vertextoedge/synology-file-cache/internal/service/stream"
+	"github.com/vertextoedge/synology-file-cache/internal/util/bufpool"
+	"github.com/vertextoedge/synology-file-cache/internal/util/cachecontrol"
+	"github.com/vertextoedge/synology-file-cache/internal/util/compress"
+	"github.com/vertextoedge/synology-file-cache/internal/util/cryptfile"
+	"github.com/vertextoedge/synology-file-cache/internal/util/disposition"
+	"github.com/vertextoedge/synology-file-cache/internal/util/inuse"
+	"github.com/vertextoedge/synology-file-cache/internal/util/ipfilter"
+	"github.com/vertextoedge/synology-file-cache/internal/util/passhash"
+	"github.com/vertextoedge/synology-file-cache/internal/util/ratelimiter"
+	"github.com/vertextoedge/synology-file-cache/internal/util/urlsign"
 	"go.uber.org/zap"
 )
 
-// sessionEntry represents an authenticated session for a share
-type sessionEntry struct {
-	token     string
-	expiresAt time.Time
-}
+// sessionTTL is how long a share password is remembered
+const sessionTTL = 24 * time.Hour
 
 // FileHandler handles file download requests
 type FileHandler struct {
-	store    port.Store
-	logger   *zap.Logger
-	sessions map[string]sessionEntry
-	sessLock sync.RWMutex
+	store  port.Store
+	logger *zap.Logger
+
+	// Signs the session cookies of unlocked shares
+	sessions      *urlsign.Signer
+	sessionCookie SessionCookieConfig
+
+	// Wrong share password lockout, keyed by client IP and share token (nil = disabled)
+	lockout *ratelimiter.Lockout
+
+	// Resolves the client IP for lockouts and per-share IP rules
+	proxyTrust ProxyTrust
+
+	// Prefix of the share URLs of a server mounted below the root
+	pathPrefix string
+
+	// Reason previews and streams are left out, answered with 501 (empty = 404)
+	unsupported string
+
+	// Verifies signed, time-limited share links (nil = disabled)
+	signer *urlsign.Signer
+
+	// Counts cache hits and misses for the dashboard (nil = disabled)
+	stats *stats.Counters
+
+	// Thumbnail generator for /f/{token}/thumb (nil = disabled)
+	previews *preview.Generator
+
+	// HLS streamer for /f/{token}/stream.m3u8 (nil = disabled)
+	streams *stream.Streamer
+
+	// Chunk cache for downloads of very large uncached files (nil = disabled)
+	chunks *chunk.Cache
+
+	// Marks the cached copies being served so they are not evicted (nil = disabled)
+	readers *inuse.Tracker
+
+	// Serves files being downloaded from their temp file (nil = disabled)
+	partial *partial.Source
+
+	// Expired and revoked shares
+	expiredGrace time.Duration      // Expired shares are still served for this long
+	errorPage    *template.Template // HTML page instead of plain text (nil = plain text)
+	redirectGone bool               // Redirect to the share on the NAS instead
+
+	// Forwards unknown share tokens to the NAS (nil = 404)
+	proxy *shareProxy
+
+	// Forwards share requests the cache cannot answer to DSM (nil = 404/503)
+	passthrough *passthrough
+
+	// Copy buffers for responses that cannot use sendfile (nil = io.Copy)
+	buffers *bufpool.Pool
+
+	// Pre-serve hooks run on cached copies before they are downloaded (nil = disabled)
+	serveCheck *serveCheck
+
+	// Decrypts cached copies encrypted at rest (nil = read as stored)
+	keys *cryptfile.Keyring
+
+	// Requested files are promoted to this priority (0 = disabled)
+	boostPriority int
+
+	// Cache-Control of served files ("" = no header). Shares with a password
+	// or requiring signed links use protectedCacheControl; a share's own
+	// setting overrides both.
+	cacheControl          string
+	protectedCacheControl string
 }
 
 // NewFileHandler creates a new FileHandler
@@ -38,30 +112,55 @@ func NewFileHandler(store port.Store, logger *zap.Logger) *FileHandler {
 	return &FileHandler{
 		store:    store,
 		logger:   logger,
-		sessions: make(map[string]sessionEntry),
+		sessions: newSessionSigner(""),
 	}
 }
 
 // HandleDownload handles file download by share token: /f/{token}
+// previews: /f/{token}/thumb?size= and HLS streams: /f/{token}/stream.m3u8
+// HEAD and POST (password of a protected share) are answered for the file itself only.
 func (h *FileHandler) HandleDownload(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	token := strings.TrimPrefix(r.URL.Path, "/f/")
+	token, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/f/"), "/")
 	if token == "" {
 		http.Error(w, "Token required", http.StatusBadRequest)
 		return
 	}
 
-	h.logger.Debug("file download requested", zap.String("token", token))
-	h.serveFileByToken(w, r, token)
+	if r.Method != http.MethodGet && rest != "" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.Method == http.MethodHead {
+		h.serveFileHead(w, r, token)
+		return
+	}
+
+	switch rest {
+	case "":
+		reqLogger(r, h.logger).Debug("file download requested", zap.String("token", token))
+		h.serveFileByToken(w, r, token)
+	case "thumb":
+		h.serveThumbnail(w, r, token)
+	case "stream.m3u8":
+		h.serveStreamPlaylist(w, r, token)
+	default:
+		if stream.IsSegmentName(rest) {
+			h.serveStreamSegment(w, r, token, rest)
+			return
+		}
+		http.Error(w, "Not found", http.StatusNotFound)
+	}
 }
 
-// HandleSynologyDownload handles Synology Drive format: /d/s/{token}/{extra}
+// HandleSynologyDownload handles Synology Drive format: /d/s/{token}/{extra}.
+// GET, HEAD and POST (password of a protected share) are allowed.
 func (h *FileHandler) HandleSynologyDownload(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
@@ -74,179 +173,783 @@ func (h *FileHandler) HandleSynologyDownload(w http.ResponseWriter, r *http.Requ
 	}
 
 	token := parts[0]
-	h.logger.Debug("synology download requested", zap.String("token", token))
+	if r.Method == http.MethodHead {
+		h.serveFileHead(w, r, token)
+		return
+	}
+	reqLogger(r, h.logger).Debug("synology download requested", zap.String("token", token))
 	h.serveFileByToken(w, r, token)
 }
 
-// serveFileByToken serves a cached file by its share token
-func (h *FileHandler) serveFileByToken(w http.ResponseWriter, r *http.Request, token string) {
+// HandleFileStationDownload handles File Station sharing links: /sharing/{id}.
+// GET, HEAD and POST (password of a protected share) are allowed.
+func (h *FileHandler) HandleFileStationDownload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/sharing/")
+	parts := strings.SplitN(path, "/", 2)
+	if len(parts) == 0 || parts[0] == "" {
+		http.Error(w, "Link ID required", http.StatusBadRequest)
+		return
+	}
+
+	linkID := parts[0]
+	if r.Method == http.MethodHead {
+		h.serveFileHead(w, r, linkID)
+		return
+	}
+	reqLogger(r, h.logger).Debug("file station download requested", zap.String("link_id", linkID))
+	h.serveFileByToken(w, r, linkID)
+}
+
+// shareTokenFromPath extracts the share token from /f/, /d/s/ and /sharing/ paths
+func shareTokenFromPath(path string) string {
+	for _, prefix := range []string{"/f/", "/d/s/", "/sharing/"} {
+		if strings.HasPrefix(path, prefix) {
+			token, _, _ := strings.Cut(strings.TrimPrefix(path, prefix), "/")
+			return token
+		}
+	}
+	return ""
+}
+
+// resolveShare looks up the file for a share token and enforces revocation,
+// expiry, password and cache state. Writes an error response and returns nil
+// if the file cannot be served.
+func (h *FileHandler) resolveShare(w http.ResponseWriter, r *http.Request, token string) *domain.File {
+	file, _ := h.lookupShare(w, r, token)
+	if file == nil {
+		return nil
+	}
+
+	if !file.Cached || file.CachePath == "" {
+		http.Error(w, "File not cached", http.StatusServiceUnavailable)
+		return nil
+	}
+
+	return file
+}
+
+// lookupShare is resolveShare without the cache state check; it also returns the share
+func (h *FileHandler) lookupShare(w http.ResponseWriter, r *http.Request, token string) (*domain.File, *domain.Share) {
 	file, share, err := h.store.GetFileByShareToken(token)
 	if err != nil {
-		h.logger.Error("failed to get file by share token", zap.String("token", token), zap.Error(err))
+		reqLogger(r, h.logger).Error("failed to get file by share token", zap.String("token", token), zap.Error(err))
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
+		return nil, nil
 	}
 
 	if file == nil || share == nil {
-		http.Error(w, "Share not found", http.StatusNotFound)
-		return
+		switch {
+		case h.proxy != nil && canProxy(r):
+			h.proxy.serve(w, r, token)
+		case h.passthrough != nil && canProxy(r):
+			h.passthrough.ServeHTTP(w, r)
+		default:
+			http.Error(w, "Share not found", http.StatusNotFound)
+		}
+		return nil, nil
+	}
+
+	if !h.allowsClient(r, share) {
+		http.Error(w, "Access denied", http.StatusForbidden)
+		return nil, nil
 	}
 
 	if share.Revoked {
-		http.Error(w, "Share has been revoked", http.StatusGone)
-		return
+		h.shareGone(w, r, share, shareGoneRevoked)
+		return nil, nil
 	}
 
-	if share.ExpiresAt != nil && share.ExpiresAt.Before(time.Now()) {
-		http.Error(w, "Share has expired", http.StatusGone)
-		return
+	if share.IsExpired() && !h.inGrace(share) {
+		h.shareGone(w, r, share, shareGoneExpired)
+		return nil, nil
 	}
 
-	// Check password
-	if share.HasPassword() {
+	if share.DownloadsExhausted() {
+		h.shareGone(w, r, share, shareGoneDownloadLimit)
+		return nil, nil
+	}
+
+	signed, ok := h.verifySignature(w, r, share)
+	if !ok {
+		return nil, nil
+	}
+
+	// Check password; a signed link stands in for it
+	if share.HasPassword() && !signed {
 		if !h.verifySharePassword(w, r, token, share.Password) {
-			return
+			return nil, nil
 		}
 	}
 
-	if !file.Cached || file.CachePath == "" {
-		http.Error(w, "File not cached", http.StatusServiceUnavailable)
+	return file, share
+}
+
+// verifySignature checks the exp and sig parameters of a signed link. It
+// reports whether the request carries a valid signature, and whether it may
+// proceed: shares requiring signatures refuse requests without one unless a
+// session was opened by an earlier signed request.
+func (h *FileHandler) verifySignature(w http.ResponseWriter, r *http.Request, share *domain.Share) (signed, ok bool) {
+	query := r.URL.Query()
+	if !query.Has("sig") && !query.Has("exp") {
+		if share.RequireSignature && !h.hasSession(r, share.Token, share.Password) {
+			http.Error(w, "Signed link required", http.StatusForbidden)
+			return false, false
+		}
+		return false, true
+	}
+
+	if h.signer == nil {
+		http.Error(w, "Invalid signature", http.StatusForbidden)
+		return false, false
+	}
+
+	expires, err := h.signer.Verify(share.Token, query, time.Now())
+	switch {
+	case errors.Is(err, urlsign.ErrExpired):
+		http.Error(w, "Link expired", http.StatusGone)
+		return false, false
+	case err != nil:
+		reqLogger(r, h.logger).Warn("invalid share link signature",
+			zap.String("token", share.Token),
+			zap.String("client_ip", h.proxyTrust.ClientIP(r)))
+		http.Error(w, "Invalid signature", http.StatusForbidden)
+		return false, false
+	}
+
+	// Thumbnails and stream segments are requested without the signature
+	if !h.hasSession(r, share.Token, share.Password) {
+		h.setSessionCookie(w, r, share.Token, share.Password, time.Until(expires))
+	}
+	return true, true
+}
+
+// allowsClient checks the client IP against the share's own allow and deny lists.
+// Rules that no longer parse refuse every client.
+func (h *FileHandler) allowsClient(r *http.Request, share *domain.Share) bool {
+	if len(share.AllowedIPs) == 0 && len(share.DeniedIPs) == 0 {
+		return true
+	}
+
+	rules, err := ipfilter.ParseRules(share.AllowedIPs, share.DeniedIPs)
+	if err != nil {
+		reqLogger(r, h.logger).Error("invalid share IP rules", zap.String("token", share.Token), zap.Error(err))
+		return false
+	}
+
+	ip := h.proxyTrust.ClientIP(r)
+	if !rules.Allows(ip) {
+		reqLogger(r, h.logger).Warn("share request refused by share IP rules",
+			zap.String("token", share.Token),
+			zap.String("client_ip", ip))
+		return false
+	}
+	return true
+}
+
+// serveFileByToken serves a cached file by its share token. Very large files
+// that are not cached are served from the chunk cache.
+func (h *FileHandler) serveFileByToken(w http.ResponseWriter, r *http.Request, token string) {
+	file, share := h.lookupShare(w, r, token)
+	if file == nil {
+		return
+	}
+
+	chunked := !file.Cached || file.CachePath == ""
+	if chunked {
+		h.stats.RecordMiss()
+		if err := h.store.RecordMiss(file.ID); err != nil {
+			reqLogger(r, h.logger).Warn("failed to count cache miss", zap.Error(err))
+		}
+	} else {
+		h.stats.RecordHit()
+	}
+	h.boost(r, file, chunked)
+
+	// A file being downloaded is served as the download proceeds
+	var downloading *partial.Reader
+	if chunked {
+		downloading = h.openPartial(r, file)
+	}
+	if downloading != nil {
+		defer downloading.Close()
+	} else if chunked && (h.chunks == nil || !h.chunks.Eligible(file)) {
+		h.notCached(w, r)
+		return
+	}
+	if !chunked && !h.checkBeforeServe(w, r, file) {
 		return
 	}
 
-	// Open cached file
-	f, err := os.Open(file.CachePath)
+	if !h.claimDownload(w, r, share) {
+		return
+	}
+
+	if downloading != nil {
+		h.servePartial(w, r, token, file, share, downloading)
+		return
+	}
+	if chunked {
+		h.serveChunked(w, r, token, file, share)
+		return
+	}
+
+	// Open cached file, kept from eviction until the response is written
+	release := h.readers.Acquire(file.CachePath)
+	defer release()
+	f, err := cryptfile.Open(file.CachePath, h.keys)
 	if err != nil {
-		h.logger.Error("failed to open cached file", zap.String("path", file.CachePath), zap.Error(err))
+		reqLogger(r, h.logger).Error("failed to open cached file", zap.String("path", file.CachePath), zap.Error(err))
 		http.Error(w, "File not available", http.StatusServiceUnavailable)
 		return
 	}
 	defer f.Close()
 
-	stat, err := f.Stat()
+	// Determine content type
+	filename := file.ServedName()
+	contentType := cachedContentType(filename, file.ServedContentType(), file.CacheEncoding, f)
+
+	body, size, closeBody, err := cachedBody(w, r, f, file.CacheEncoding)
 	if err != nil {
-		h.logger.Error("failed to stat cached file", zap.String("path", file.CachePath), zap.Error(err))
+		reqLogger(r, h.logger).Error("failed to read compressed cache file", zap.String("path", file.CachePath), zap.Error(err))
 		http.Error(w, "File not available", http.StatusServiceUnavailable)
 		return
 	}
+	defer closeBody()
 
-	// Determine content type
-	filename := filepath.Base(file.Path)
-	contentType := mime.TypeByExtension(filepath.Ext(filename))
+	// Set headers
+	w.Header().Set("ETag", fileETag(file, f.Size(), f.ModTime(), w.Header().Get("Content-Encoding") != ""))
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", downloadDisposition(r, filename))
+	h.setCacheControl(w, share)
+
+	// Stream file, counting the bytes sent into the file's access counters
+	counted := &countingWriter{ResponseWriter: w}
+	err = serveCachedBody(counted, r, body, size, f.ModTime(), h.buffers)
+	if recordErr := h.store.RecordHit(file.ID, counted.bytes); recordErr != nil {
+		reqLogger(r, h.logger).Warn("failed to update file access counters", zap.Error(recordErr))
+	}
+	if err != nil {
+		reqLogger(r, h.logger).Error("failed to stream file", zap.String("path", file.CachePath), zap.Error(err))
+		return
+	}
+
+	reqLogger(r, h.logger).Info("file served from cache",
+		zap.String("token", token),
+		zap.String("path", file.Path),
+		zap.Int64("size", size))
+}
+
+// boost promotes a requested file to the boost priority, so it is evicted
+// after the files nobody asks for. The pending download of an uncached file
+// is moved to the front of the queue, ahead of everything but other
+// requested and pre-seeded files.
+func (h *FileHandler) boost(r *http.Request, file *domain.File, uncached bool) {
+	if h.boostPriority <= 0 {
+		return
+	}
+
+	if file.Priority > h.boostPriority {
+		promoted, err := h.store.BoostFilePriority(file.ID, h.boostPriority)
+		if err != nil {
+			reqLogger(r, h.logger).Warn("failed to promote requested file", zap.String("path", file.Path), zap.Error(err))
+		} else if promoted {
+			reqLogger(r, h.logger).Debug("requested file promoted",
+				zap.String("path", file.Path),
+				zap.Int("from", file.Priority),
+				zap.Int("to", h.boostPriority))
+		}
+	}
+
+	if uncached {
+		bumped, err := h.store.BoostTaskPriority(file.ID, domain.PriorityPinned)
+		if err != nil {
+			reqLogger(r, h.logger).Warn("failed to move download of requested file forward", zap.String("path", file.Path), zap.Error(err))
+		} else if bumped {
+			reqLogger(r, h.logger).Debug("download of requested file moved to the front of the queue",
+				zap.String("path", file.Path))
+		}
+	}
+}
+
+// checkBeforeServe runs the pre-serve hooks on the cached copy of file.
+// Rejected copies get 403 and copies that could not be checked 503.
+// Returns false if a response was written.
+func (h *FileHandler) checkBeforeServe(w http.ResponseWriter, r *http.Request, file *domain.File) bool {
+	if h.serveCheck == nil {
+		return true
+	}
+
+	err := h.serveCheck.inspect(r.Context(), file)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, domain.ErrFileRejected):
+		reqLogger(r, h.logger).Warn("cached file rejected before serving",
+			zap.String("path", file.Path),
+			zap.Error(err))
+		http.Error(w, "File blocked", http.StatusForbidden)
+	default:
+		reqLogger(r, h.logger).Error("failed to check cached file before serving",
+			zap.String("path", file.Path),
+			zap.Error(err))
+		http.Error(w, "File not available", http.StatusServiceUnavailable)
+	}
+	return false
+}
+
+// serveFileHead answers a HEAD request for a shared file with the headers a
+// GET would send, taken from the database and a stat of the cached copy. The
+// copy is not opened, and neither the access counters nor the share's
+// download count are touched. The Content-Type of files without a stored type
+// or known extension is not sniffed.
+func (h *FileHandler) serveFileHead(w http.ResponseWriter, r *http.Request, token string) {
+	file, share := h.lookupShare(w, r, token)
+	if file == nil {
+		return
+	}
+
+	filename := file.ServedName()
+	contentType := file.ServedContentType()
+	if contentType == "" {
+		contentType = mime.TypeByExtension(filepath.Ext(filename))
+	}
 	if contentType == "" {
 		contentType = "application/octet-stream"
 	}
 
-	// Set headers
+	size := file.Size
+	var modTime time.Time
+	encoded := false
+	if file.Cached && file.CachePath != "" {
+		stored, modified, err := h.storedSize(file.CachePath)
+		if err != nil {
+			reqLogger(r, h.logger).Error("failed to stat cached file", zap.String("path", file.CachePath), zap.Error(err))
+			http.Error(w, "File not available", http.StatusServiceUnavailable)
+			return
+		}
+		modTime = modified
+		if file.CacheEncoding == domain.CacheEncodingGzip {
+			// The plain size is the size on the NAS
+			w.Header().Add("Vary", "Accept-Encoding")
+			if compress.Accepts(r.Header.Get("Accept-Encoding"), compress.Gzip) {
+				w.Header().Set("Content-Encoding", compress.Gzip)
+				size, encoded = stored, true
+			}
+		} else {
+			size = stored
+		}
+		w.Header().Set("ETag", fileETag(file, stored, modTime, encoded))
+	} else {
+		if (h.chunks == nil || !h.chunks.Eligible(file)) && !h.downloading(r, file) {
+			h.notCached(w, r)
+			return
+		}
+		if file.ModifiedAt != nil {
+			modTime = *file.ModifiedAt
+		}
+		w.Header().Set("ETag", fileETag(file, file.Size, modTime, false))
+	}
+
 	w.Header().Set("Content-Type", contentType)
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", stat.Size()))
-	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=\"%s\"", filename))
+	w.Header().Set("Content-Disposition", downloadDisposition(r, filename))
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	h.setCacheControl(w, share)
+	if !modTime.IsZero() {
+		w.Header().Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	}
+	if file.CacheEncoding == "" || encoded {
+		w.Header().Set("Accept-Ranges", "bytes")
+	}
+	w.WriteHeader(http.StatusOK)
+}
 
-	// Update last access time
-	now := time.Now()
-	file.LastAccessInCacheAt = &now
-	if err := h.store.Update(file); err != nil {
-		h.logger.Warn("failed to update file access time", zap.Error(err))
+// notCached answers a request for a file the cache cannot serve yet: DSM
+// serves it in passthrough mode, otherwise the client gets 503
+func (h *FileHandler) notCached(w http.ResponseWriter, r *http.Request) {
+	if h.passthrough != nil {
+		h.passthrough.ServeHTTP(w, r)
+		return
 	}
+	http.Error(w, "File not cached", http.StatusServiceUnavailable)
+}
 
-	// Stream file
-	if _, err := io.Copy(w, f); err != nil {
-		h.logger.Error("failed to stream file", zap.String("path", file.CachePath), zap.Error(err))
+// storedSize returns the size of a cached copy as stored, decrypted if it is
+// encrypted at rest, and its modification time. Only the header of an
+// encrypted copy is read.
+func (h *FileHandler) storedSize(cachePath string) (int64, time.Time, error) {
+	if h.keys == nil {
+		stat, err := os.Stat(cachePath)
+		if err != nil {
+			return 0, time.Time{}, err
+		}
+		return stat.Size(), stat.ModTime(), nil
+	}
+
+	f, err := cryptfile.Open(cachePath, h.keys)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	defer f.Close()
+	return f.Size(), f.ModTime(), nil
+}
+
+// fileETag returns the ETag of a served file. It changes whenever the cached
+// copy is replaced and differs between the gzip and plain bodies of files
+// compressed at rest.
+func fileETag(file *domain.File, size int64, modTime time.Time, encoded bool) string {
+	suffix := ""
+	if encoded {
+		suffix = "-gz"
+	}
+	return fmt.Sprintf(`"%s-%x-%x%s"`, file.SynoFileID, modTime.UnixNano(), size, suffix)
+}
+
+// claimDownload counts the request against the share's download limit.
+// Range requests past the first byte continue a download already counted,
+// e.g. a resumed download or a video player seeking. Writes an error
+// response and returns false if the limit is reached.
+func (h *FileHandler) claimDownload(w http.ResponseWriter, r *http.Request, share *domain.Share) bool {
+	if rangeHeader := r.Header.Get("Range"); rangeHeader != "" && !strings.HasPrefix(rangeHeader, "bytes=0-") {
+		return true
+	}
+
+	claimed, err := h.store.ClaimShareDownload(share)
+	if err != nil {
+		reqLogger(r, h.logger).Error("failed to count share download", zap.String("token", share.Token), zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return false
+	}
+	if !claimed {
+		h.shareGone(w, r, share, shareGoneDownloadLimit)
+		return false
+	}
+	return true
+}
+
+// serveChunked serves an uncached file through the chunk cache with range
+// support; chunks missing locally are downloaded from the NAS as the
+// response reaches them
+func (h *FileHandler) serveChunked(w http.ResponseWriter, r *http.Request, token string, file *domain.File, share *domain.Share) {
+	reader, err := h.chunks.Open(r.Context(), file)
+	if err != nil {
+		reqLogger(r, h.logger).Error("failed to open chunked file", zap.String("path", file.Path), zap.Error(err))
+		http.Error(w, "File not available", http.StatusServiceUnavailable)
+		return
+	}
+	defer reader.Close()
+
+	// A multi-GB response can take longer than the server write timeout
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		reqLogger(r, h.logger).Debug("failed to clear write deadline", zap.Error(err))
+	}
+
+	// Without a stored type, ServeContent derives it from the name or content
+	filename := file.ServedName()
+	if contentType := file.ServedContentType(); contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	w.Header().Set("Content-Disposition", downloadDisposition(r, filename))
+
+	var modTime time.Time
+	if file.ModifiedAt != nil {
+		modTime = *file.ModifiedAt
+	}
+	w.Header().Set("ETag", fileETag(file, file.Size, modTime, false))
+	h.setCacheControl(w, share)
+	http.ServeContent(w, r, filename, modTime, reader)
+
+	if err := reader.Err(); err != nil {
+		reqLogger(r, h.logger).Error("failed to serve file from chunks", zap.String("path", file.Path), zap.Error(err))
 		return
 	}
 
-	h.logger.Info("file served from cache",
+	reqLogger(r, h.logger).Info("file served from chunks",
 		zap.String("token", token),
 		zap.String("path", file.Path),
-		zap.Int64("size", stat.Size()))
+		zap.Int("chunks_fetched", reader.Fetched()))
 }
 
-// verifySharePassword verifies password for protected share
-func (h *FileHandler) verifySharePassword(w http.ResponseWriter, r *http.Request, shareToken, correctPassword string) bool {
-	// Check session cookie
-	if cookie, err := r.Cookie("share_session"); err == nil {
-		if h.validateSession(cookie.Value, shareToken) {
-			return true
-		}
+// openPartial returns a reader over file if it is being downloaded, nil if
+// it is not or partial serving is disabled
+func (h *FileHandler) openPartial(r *http.Request, file *domain.File) *partial.Reader {
+	if h.partial == nil {
+		return nil
+	}
+	reader, err := h.partial.Open(r.Context(), file)
+	if err != nil {
+		reqLogger(r, h.logger).Warn("failed to open in-progress download", zap.String("path", file.Path), zap.Error(err))
+		return nil
 	}
+	return reader
+}
 
-	// Check Basic Auth
-	_, password, ok := r.BasicAuth()
-	if ok {
-		if subtle.ConstantTimeCompare([]byte(password), []byte(correctPassword)) == 1 {
-			sessionID := h.createSession(shareToken)
-			h.setSessionCookie(w, sessionID)
-			return true
-		}
-		http.Error(w, "Invalid password", http.StatusForbidden)
+// downloading reports whether file can be served from its in-progress download
+func (h *FileHandler) downloading(r *http.Request, file *domain.File) bool {
+	reader := h.openPartial(r, file)
+	if reader == nil {
 		return false
 	}
+	reader.Close()
+	return true
+}
 
-	w.Header().Set("WWW-Authenticate", `Basic realm="Password Protected Share"`)
-	http.Error(w, "Password required", http.StatusUnauthorized)
-	return false
+// servePartial serves a file that is still being downloaded with range
+// support, from the temp file as far as the download got and from the NAS
+// beyond that
+func (h *FileHandler) servePartial(w http.ResponseWriter, r *http.Request, token string, file *domain.File, share *domain.Share, reader *partial.Reader) {
+	// The response may have to wait for the download
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		reqLogger(r, h.logger).Debug("failed to clear write deadline", zap.Error(err))
+	}
+
+	filename := file.ServedName()
+	if contentType := file.ServedContentType(); contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	w.Header().Set("Content-Disposition", downloadDisposition(r, filename))
+
+	var modTime time.Time
+	if file.ModifiedAt != nil {
+		modTime = *file.ModifiedAt
+	}
+	w.Header().Set("ETag", fileETag(file, file.Size, modTime, false))
+	h.setCacheControl(w, share)
+	http.ServeContent(w, r, filename, modTime, reader)
+
+	if err := reader.Err(); err != nil {
+		reqLogger(r, h.logger).Error("failed to serve in-progress download", zap.String("path", file.Path), zap.Error(err))
+		return
+	}
+
+	reqLogger(r, h.logger).Info("file served from in-progress download",
+		zap.String("token", token),
+		zap.String("path", file.Path),
+		zap.Int64("proxied_bytes", reader.Proxied()))
 }
 
-// createSession creates a new session
-func (h *FileHandler) createSession(shareToken string) string {
-	bytes := make([]byte, 32)
-	if _, err := rand.Read(bytes); err != nil {
-		hash := sha256.Sum256([]byte(shareToken + time.Now().String()))
-		bytes = hash[:]
+// setCacheControl sets the Cache-Control policy of share on a file
+// response, keeping max-age within the share's expiry
+func (h *FileHandler) setCacheControl(w http.ResponseWriter, share *domain.Share) {
+	policy := h.cacheControl
+	switch {
+	case share.CacheControl != "":
+		policy = share.CacheControl
+	case share.HasPassword() || share.RequireSignature:
+		policy = h.protectedCacheControl
 	}
-	sessionID := hex.EncodeToString(bytes)
+	cachecontrol.Set(w.Header(), policy, time.Now(), share.ExpiresAt)
+}
 
-	h.sessLock.Lock()
-	defer h.sessLock.Unlock()
+// downloadDisposition builds the Content-Disposition header for a share download.
+// ?dl=1 forces a download instead of inline display and ?filename= overrides
+// the saved name.
+func downloadDisposition(r *http.Request, filename string) string {
+	query := r.URL.Query()
 
-	if len(h.sessions) > 1000 {
-		h.cleanExpiredSessions()
+	dispositionType := disposition.Inline
+	if dl, _ := strconv.ParseBool(query.Get("dl")); dl {
+		dispositionType = disposition.Attachment
+	}
+	if name := disposition.Sanitize(query.Get("filename")); name != "" {
+		filename = name
 	}
 
-	h.sessions[sessionID] = sessionEntry{
-		token:     shareToken,
-		expiresAt: time.Now().Add(24 * time.Hour),
+	return disposition.Format(dispositionType, filename)
+}
+
+// featureDisabled answers a request for a feature that is off: 404, or 501
+// with the reason on servers built without it
+func (h *FileHandler) featureDisabled(w http.ResponseWriter, feature string) {
+	if h.unsupported != "" {
+		http.Error(w, feature+" "+h.unsupported, http.StatusNotImplemented)
+		return
+	}
+	http.Error(w, feature+" disabled", http.StatusNotFound)
+}
+
+// serveThumbnail serves a JPEG preview of a shared file: /f/{token}/thumb?size=
+func (h *FileHandler) serveThumbnail(w http.ResponseWriter, r *http.Request, token string) {
+	if h.previews == nil {
+		h.featureDisabled(w, "Previews")
+		return
+	}
+
+	size := 0
+	if v := r.URL.Query().Get("size"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Invalid size", http.StatusBadRequest)
+			return
+		}
+		size = parsed
+	}
+
+	file := h.resolveShare(w, r, token)
+	if file == nil {
+		return
+	}
+
+	thumbPath, err := h.previews.Thumbnail(r.Context(), file, size)
+	switch {
+	case errors.Is(err, preview.ErrUnsupported):
+		http.Error(w, "No preview available", http.StatusNotFound)
+		return
+	case err != nil:
+		reqLogger(r, h.logger).Warn("failed to generate thumbnail",
+			zap.String("token", token),
+			zap.String("path", file.Path),
+			zap.Error(err))
+		http.Error(w, "Preview not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	f, err := os.Open(thumbPath)
+	if err != nil {
+		reqLogger(r, h.logger).Error("failed to open thumbnail", zap.String("path", thumbPath), zap.Error(err))
+		http.Error(w, "Preview not available", http.StatusServiceUnavailable)
+		return
 	}
+	defer f.Close()
 
-	return sessionID
+	stat, err := f.Stat()
+	if err != nil {
+		http.Error(w, "Preview not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	http.ServeContent(w, r, "thumb.jpg", stat.ModTime(), f)
 }
 
-// validateSession validates a session
-func (h *FileHandler) validateSession(sessionID, shareToken string) bool {
-	h.sessLock.RLock()
-	defer h.sessLock.RUnlock()
+// serveStreamPlaylist serves the HLS playlist of a shared video: /f/{token}/stream.m3u8
+// Segment URIs in the playlist are relative, so they resolve to /f/{token}/segNNNNN.ts.
+func (h *FileHandler) serveStreamPlaylist(w http.ResponseWriter, r *http.Request, token string) {
+	if h.streams == nil {
+		h.featureDisabled(w, "Streaming")
+		return
+	}
+
+	file := h.resolveShare(w, r, token)
+	if file == nil {
+		return
+	}
 
-	session, exists := h.sessions[sessionID]
-	if !exists {
-		return false
+	playlist, err := h.streams.Playlist(r.Context(), file)
+	switch {
+	case errors.Is(err, stream.ErrUnsupported):
+		http.Error(w, "Streaming not available for this file", http.StatusNotFound)
+		return
+	case errors.Is(err, stream.ErrNotReady):
+		w.Header().Set("Retry-After", "5")
+		http.Error(w, "Stream is being prepared", http.StatusServiceUnavailable)
+		return
+	case err != nil:
+		reqLogger(r, h.logger).Warn("failed to prepare stream",
+			zap.String("token", token),
+			zap.String("path", file.Path),
+			zap.Error(err))
+		http.Error(w, "Stream not available", http.StatusServiceUnavailable)
+		return
 	}
 
-	if time.Now().After(session.expiresAt) {
-		return false
+	data, err := os.ReadFile(playlist)
+	if err != nil {
+		reqLogger(r, h.logger).Error("failed to read playlist", zap.String("path", playlist), zap.Error(err))
+		http.Error(w, "Stream not available", http.StatusServiceUnavailable)
+		return
 	}
 
-	return session.token == shareToken
+	// The playlist grows while segmenting, players must re-fetch it
+	w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(data)
 }
 
-// setSessionCookie sets the session cookie
-func (h *FileHandler) setSessionCookie(w http.ResponseWriter, sessionID string) {
-	http.SetCookie(w, &http.Cookie{
-		Name:     "share_session",
-		Value:    sessionID,
-		Path:     "/",
-		MaxAge:   86400,
-		HttpOnly: true,
-		SameSite: http.SameSiteStrictMode,
-		Secure:   false,
-	})
+// serveStreamSegment serves one HLS segment of a shared video: /f/{token}/segNNNNN.ts
+func (h *FileHandler) serveStreamSegment(w http.ResponseWriter, r *http.Request, token, name string) {
+	if h.streams == nil {
+		h.featureDisabled(w, "Streaming")
+		return
+	}
+
+	file := h.resolveShare(w, r, token)
+	if file == nil {
+		return
+	}
+
+	segPath, err := h.streams.Segment(file, name)
+	if err != nil {
+		http.Error(w, "Segment not found", http.StatusNotFound)
+		return
+	}
+
+	f, err := os.Open(segPath)
+	if err != nil {
+		http.Error(w, "Segment not found", http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		http.Error(w, "Segment not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "video/mp2t")
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	http.ServeContent(w, r, name, stat.ModTime(), f)
 }
 
-// cleanExpiredSessions removes expired sessions
-func (h *FileHandler) cleanExpiredSessions() {
-	now := time.Now()
-	for id, session := range h.sessions {
-		if now.After(session.expiresAt) {
-			delete(h.sessions, id)
+// verifySharePassword verifies password for protected share
+func (h *FileHandler) verifySharePassword(w http.ResponseWriter, r *http.Request, shareToken, passwordHash string) bool {
+	if h.hasSession(r, shareToken, passwordHash) {
+		return true
+	}
+
+	// Basic auth, ?password= or a JSON or form POST body
+	password, form, ok := sharePassword(w, r)
+	if !ok {
+		h.askSharePassword(w, r, http.StatusUnauthorized, "Password required")
+		return false
+	}
+
+	lockoutKey := h.proxyTrust.ClientIP(r) + "|" + shareToken
+	if h.lockout != nil {
+		if locked, remaining := h.lockout.Locked(lockoutKey); locked {
+			setRetryAfter(w, remaining)
+			h.askSharePassword(w, r, http.StatusTooManyRequests, "Too many failed password attempts")
+			return false
+		}
+	}
+
+	if passhash.Verify(passwordHash, password) {
+		if h.lockout != nil {
+			h.lockout.Success(lockoutKey)
+		}
+		h.setSessionCookie(w, r, shareToken, passwordHash, sessionTTL)
+		if form {
+			// Back to the share URL, so reloading does not post the password again
+			http.Redirect(w, r, h.passwordFormAction(r), http.StatusSeeOther)
+			return false
 		}
+		return true
 	}
+
+	if h.lockout != nil {
+		if d := h.lockout.Failure(lockoutKey); d > 0 {
+			reqLogger(r, h.logger).Warn("share password locked out after repeated failures",
+				zap.String("token", shareToken),
+				zap.String("client_ip", h.proxyTrust.ClientIP(r)),
+				zap.Duration("lockout", d))
+		}
+	}
+	h.askSharePassword(w, r, http.StatusForbidden, "Invalid password")
+	return false
 }
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// serve sends a request from a fixed client through handler
+func serve(handler http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	r.RemoteAddr = "198.51.100.2:1234"
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestFileHandler_Head(t *testing.T) {
+	srv, store := newTestServer(t, nil)
+	addCachedShare(t, store, "tok", []byte("hello"), "")
+	handler := srv.Handler()
+
+	for _, path := range []string{"/f/tok", "/d/s/tok/hello.bin", "/sharing/tok"} {
+		w := serve(handler, httptest.NewRequest(http.MethodHead, path, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("HEAD %s: status = %d, want %d", path, w.Code, http.StatusOK)
+		}
+		if w.Body.Len() != 0 {
+			t.Errorf("HEAD %s: body = %q, want none", path, w.Body.String())
+		}
+		want := map[string]string{
+			"Content-Length": "5",
+			"Content-Type":   "application/octet-stream",
+			"Accept-Ranges":  "bytes",
+		}
+		for name, value := range want {
+			if got := w.Header().Get(name); got != value {
+				t.Errorf("HEAD %s: %s = %q, want %q", path, name, got, value)
+			}
+		}
+		if w.Header().Get("ETag") == "" || w.Header().Get("Last-Modified") == "" {
+			t.Errorf("HEAD %s: missing validators, headers = %v", path, w.Header())
+		}
+	}
+
+	// The ETag matches the one a GET sends
+	head := serve(handler, httptest.NewRequest(http.MethodHead, "/f/tok", nil))
+	get := serve(handler, httptest.NewRequest(http.MethodGet, "/f/tok", nil))
+	if head.Header().Get("ETag") != get.Header().Get("ETag") {
+		t.Errorf("HEAD ETag = %q, GET ETag = %q", head.Header().Get("ETag"), get.Header().Get("ETag"))
+	}
+}
+
+func TestFileHandler_HeadDoesNotCountDownloads(t *testing.T) {
+	srv, store := newTestServer(t, nil)
+	addCachedShare(t, store, "once", []byte("hello"), "")
+	if err := store.SetShareMaxDownloads("once", 1); err != nil {
+		t.Fatalf("SetShareMaxDownloads() error = %v", err)
+	}
+	handler := srv.Handler()
+
+	for i := 0; i < 3; i++ {
+		if w := serve(handler, httptest.NewRequest(http.MethodHead, "/f/once", nil)); w.Code != http.StatusOK {
+			t.Fatalf("HEAD %d: status = %d, want %d", i, w.Code, http.StatusOK)
+		}
+	}
+	if w := serve(handler, httptest.NewRequest(http.MethodGet, "/f/once", nil)); w.Code != http.StatusOK {
+		t.Fatalf("GET status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if w := serve(handler, httptest.NewRequest(http.MethodHead, "/f/once", nil)); w.Code != http.StatusGone {
+		t.Errorf("HEAD after the last download: status = %d, want %d", w.Code, http.StatusGone)
+	}
+}
+
+func TestFileHandler_HeadRefused(t *testing.T) {
+	srv, store := newTestServer(t, nil)
+	addCachedShare(t, store, "tok", []byte("hello"), "")
+	addCachedShare(t, store, "locked", []byte("secret"), "pw")
+	handler := srv.Handler()
+
+	tests := []struct {
+		name string
+		path string
+		want int
+	}{
+		{"preview", "/f/tok/thumb", http.StatusMethodNotAllowed},
+		{"stream", "/f/tok/stream.m3u8", http.StatusMethodNotAllowed},
+		{"unknown token", "/f/missing", http.StatusNotFound},
+		{"password protected", "/f/locked", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		w := serve(handler, httptest.NewRequest(http.MethodHead, tt.path, nil))
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.want)
+		}
+		if w.Header().Get("Content-Length") == "6" {
+			t.Errorf("%s: HEAD disclosed the file size", tt.name)
+		}
+	}
+}
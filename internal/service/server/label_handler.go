@@ -0,0 +1,297 @@
+package server
+
+import (
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"go.uber.org/zap"
+)
+
+// LabelHandler browses Drive labels and the files they pull into the cache
+type LabelHandler struct {
+	store  port.Store
+	logger *zap.Logger
+}
+
+// NewLabelHandler creates a new LabelHandler
+func NewLabelHandler(store port.Store, logger *zap.Logger) *LabelHandler {
+	return &LabelHandler{
+		store:  store,
+		logger: logger,
+	}
+}
+
+// labelResponse is the JSON representation of a label and its files
+type labelResponse struct {
+	ID          int64     `json:"id"`
+	SynoLabelID string    `json:"syno_label_id"`
+	Name        string    `json:"name"`
+	Excluded    bool      `json:"excluded"` // Matched by sync.exclude_labels
+	LastSyncAt  time.Time `json:"last_sync_at"`
+	Files       int64     `json:"files"`
+	TotalBytes  int64     `json:"total_bytes"`
+	CachedFiles int64     `json:"cached_files"`
+	CachedBytes int64     `json:"cached_bytes"`
+}
+
+func toLabelResponse(l *domain.LabelUsage) labelResponse {
+	return labelResponse{
+		ID:          l.ID,
+		SynoLabelID: l.SynoLabelID,
+		Name:        l.Name,
+		Excluded:    l.Excluded,
+		LastSyncAt:  l.LastSyncAt,
+		Files:       l.Files,
+		TotalBytes:  l.TotalBytes,
+		CachedFiles: l.CachedFiles,
+		CachedBytes: l.CachedBytes,
+	}
+}
+
+// HandleLabels routes /api/v1/labels requests
+//
+//	GET /api/v1/labels                                         list labels with file counts
+//	GET /api/v1/labels/{id}/files?cached=true&limit=100&offset=0   files carrying a label
+func (h *LabelHandler) HandleLabels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/labels"), "/")
+	if rest == "" {
+		h.handleList(w, r)
+		return
+	}
+
+	id, sub, _ := strings.Cut(rest, "/")
+	labelID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid label ID", http.StatusBadRequest)
+		return
+	}
+
+	switch sub {
+	case "":
+		h.handleGet(w, r, labelID)
+	case "files":
+		h.handleFiles(w, r, labelID)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleList returns all labels with their file counts
+func (h *LabelHandler) handleList(w http.ResponseWriter, r *http.Request) {
+	labels, err := h.store.ListLabels()
+	if err != nil {
+		reqLogger(r, h.logger).Error("failed to list labels", zap.Error(err))
+		http.Error(w, "Failed to list labels", http.StatusInternalServerError)
+		return
+	}
+
+	items := make([]labelResponse, 0, len(labels))
+	for _, l := range labels {
+		items = append(items, toLabelResponse(l))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"labels": items})
+}
+
+// handleGet returns a single label with its file counts
+func (h *LabelHandler) handleGet(w http.ResponseWriter, r *http.Request, labelID int64) {
+	label, ok := h.getLabel(w, r, labelID)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, toLabelResponse(label))
+}
+
+// handleFiles returns a page of the files carrying a label
+func (h *LabelHandler) handleFiles(w http.ResponseWriter, r *http.Request, labelID int64) {
+	if _, ok := h.getLabel(w, r, labelID); !ok {
+		return
+	}
+
+	cached, ok := parseCachedFilter(w, r)
+	if !ok {
+		return
+	}
+	limit, offset := parsePagination(r)
+
+	files, total, err := h.store.ListLabelFiles(labelID, cached, limit, offset)
+	if err != nil {
+		reqLogger(r, h.logger).Error("failed to list label files", zap.Int64("label_id", labelID), zap.Error(err))
+		http.Error(w, "Failed to list label files", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"files":  toFileResponses(files),
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// getLabel loads a label, writing an error response when it cannot be found
+func (h *LabelHandler) getLabel(w http.ResponseWriter, r *http.Request, labelID int64) (*domain.LabelUsage, bool) {
+	label, err := h.store.GetLabel(labelID)
+	if err != nil {
+		reqLogger(r, h.logger).Error("failed to get label", zap.Int64("label_id", labelID), zap.Error(err))
+		http.Error(w, "Failed to get label", http.StatusInternalServerError)
+		return nil, false
+	}
+	if label == nil {
+		http.Error(w, "Label not found", http.StatusNotFound)
+		return nil, false
+	}
+	return label, true
+}
+
+// parseCachedFilter reads the optional cached=true|false query parameter
+func parseCachedFilter(w http.ResponseWriter, r *http.Request) (*bool, bool) {
+	v := r.URL.Query().Get("cached")
+	if v == "" {
+		return nil, true
+	}
+	cached, err := strconv.ParseBool(v)
+	if err != nil {
+		http.Error(w, "cached must be true or false", http.StatusBadRequest)
+		return nil, false
+	}
+	return &cached, true
+}
+
+// labelPageSize is the number of files shown per label page
+const labelPageSize = 200
+
+var labelsPage = template.Must(template.New("labels").Funcs(template.FuncMap{
+	"size": formatSize,
+	"time": func(t time.Time) string { return t.Local().Format("2006-01-02 15:04:05") },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>{{if .Label}}Label: {{.Label.Name}}{{else}}Labels{{end}}</title>
+    <style>
+        body { font-family: sans-serif; margin: 20px; }
+        h1 { font-size: 24px; font-weight: normal; border-bottom: 2px solid #333; padding-bottom: 10px; }
+        table { border-collapse: collapse; width: 100%; margin-top: 20px; }
+        th, td { text-align: left; padding: 8px 12px; border-bottom: 1px solid #ddd; }
+        th { background-color: #f0f0f0; font-weight: bold; }
+        tr:hover { background-color: #f9f9f9; }
+        a { color: #0066cc; text-decoration: none; }
+        a:hover { text-decoration: underline; }
+        .num { text-align: right; white-space: nowrap; }
+        .empty { color: #666; }
+        .excluded { color: #999; }
+    </style>
+</head>
+<body>
+    {{if .Label}}
+    <h1><a href="/admin/labels">Labels</a> / {{.Label.Name}}</h1>
+    <p>{{.Label.CachedFiles}} of {{.Label.Files}} files cached ({{size .Label.CachedBytes}} of {{size .Label.TotalBytes}}){{if .Label.Excluded}}, excluded from sync{{end}}.</p>
+    {{if .Files}}
+    <table>
+        <tr>
+            <th>Path</th>
+            <th class="num">Size</th>
+            <th>Cached</th>
+            <th class="num">Priority</th>
+        </tr>
+        {{range .Files}}
+        <tr>
+            <td>{{.Path}}</td>
+            <td class="num">{{size .Size}}</td>
+            <td>{{if .Cached}}yes{{else}}no{{end}}</td>
+            <td class="num">{{.Priority}}</td>
+        </tr>
+        {{end}}
+    </table>
+    {{if gt .Total (len .Files)}}<p class="empty">Showing the first {{len .Files}} of {{.Total}} files.</p>{{end}}
+    {{else}}
+    <p class="empty">No tracked files carry this label.</p>
+    {{end}}
+    {{else}}
+    <h1>Labels ({{len .Labels}})</h1>
+    {{if .Labels}}
+    <table>
+        <tr>
+            <th>Label</th>
+            <th class="num">Files</th>
+            <th class="num">Cached Files</th>
+            <th class="num">Cached Size</th>
+            <th class="num">Total Size</th>
+            <th>Last Sync</th>
+        </tr>
+        {{range .Labels}}
+        <tr{{if .Excluded}} class="excluded"{{end}}>
+            <td><a href="/admin/labels/{{.ID}}">{{.Name}}</a>{{if .Excluded}} (excluded){{end}}</td>
+            <td class="num">{{.Files}}</td>
+            <td class="num">{{.CachedFiles}}</td>
+            <td class="num">{{size .CachedBytes}}</td>
+            <td class="num">{{size .TotalBytes}}</td>
+            <td>{{time .LastSyncAt}}</td>
+        </tr>
+        {{end}}
+    </table>
+    {{else}}
+    <p class="empty">No labels have been synced yet.</p>
+    {{end}}
+    {{end}}
+</body>
+</html>`))
+
+// HandleLabelsPage renders the label list at /admin/labels and the files of
+// a label at /admin/labels/{id}
+func (h *LabelHandler) HandleLabelsPage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	data := struct {
+		Labels []*domain.LabelUsage
+		Label  *domain.LabelUsage
+		Files  []*domain.File
+		Total  int
+	}{}
+
+	if id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/labels"), "/"); id != "" {
+		labelID, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid label ID", http.StatusBadRequest)
+			return
+		}
+		label, ok := h.getLabel(w, r, labelID)
+		if !ok {
+			return
+		}
+		files, total, err := h.store.ListLabelFiles(labelID, nil, labelPageSize, 0)
+		if err != nil {
+			reqLogger(r, h.logger).Error("failed to list label files", zap.Int64("label_id", labelID), zap.Error(err))
+			http.Error(w, "Failed to list label files", http.StatusInternalServerError)
+			return
+		}
+		data.Label, data.Files, data.Total = label, files, total
+	} else {
+		labels, err := h.store.ListLabels()
+		if err != nil {
+			reqLogger(r, h.logger).Error("failed to list labels", zap.Error(err))
+			http.Error(w, "Failed to list labels", http.StatusInternalServerError)
+			return
+		}
+		data.Labels = labels
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := labelsPage.Execute(w, data); err != nil {
+		reqLogger(r, h.logger).Error("failed to render labels page", zap.Error(err))
+	}
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// unixAddrPrefix marks a bind address as a Unix domain socket path
+const unixAddrPrefix = "unix:"
+
+// listen binds all addresses, closing those already bound if one fails.
+// With several addresses IP literals are bound per family, so "0.0.0.0:8080"
+// and "[::]:8080" can be combined; a single address keeps dual-stack binding.
+func listen(addrs []string) ([]net.Listener, error) {
+	if len(addrs) == 0 {
+		addrs = []string{":http"}
+	}
+
+	listeners := make([]net.Listener, 0, len(addrs))
+	for _, addr := range addrs {
+		network, address := bindNetwork(addr, len(addrs) > 1)
+		if network == "unix" {
+			if err := removeStaleSocket(address); err != nil {
+				closeListeners(listeners)
+				return nil, err
+			}
+		}
+
+		l, err := net.Listen(network, address)
+		if err != nil {
+			closeListeners(listeners)
+			return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+// bindNetwork returns the network and address to listen on for a bind address
+func bindNetwork(addr string, perFamily bool) (network, address string) {
+	if path, ok := strings.CutPrefix(addr, unixAddrPrefix); ok {
+		return "unix", path
+	}
+	if !perFamily {
+		return "tcp", addr
+	}
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "tcp", addr
+	}
+	ip := net.ParseIP(host)
+	switch {
+	case ip == nil:
+		return "tcp", addr
+	case ip.To4() != nil:
+		return "tcp4", addr
+	default:
+		return "tcp6", addr
+	}
+}
+
+// removeStaleSocket removes a socket file left behind by a previous run.
+// Regular files are never removed.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+	return os.Remove(path)
+}
+
+// closeListeners closes all listeners, ignoring errors
+func closeListeners(listeners []net.Listener) {
+	for _, l := range listeners {
+		l.Close()
+	}
+}
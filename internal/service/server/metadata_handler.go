@@ -0,0 +1,112 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"github.com/vertextoedge/synology-file-cache/internal/service/metadata"
+	"go.uber.org/zap"
+)
+
+// MetadataHandler exports and imports the files and shares tables, for
+// moving an instance to another host without downloading its cache again
+type MetadataHandler struct {
+	store    port.Store
+	metadata *metadata.Service
+	logger   *zap.Logger
+}
+
+// NewMetadataHandler creates a new MetadataHandler
+func NewMetadataHandler(store port.Store, meta *metadata.Service, logger *zap.Logger) *MetadataHandler {
+	return &MetadataHandler{
+		store:    store,
+		metadata: meta,
+		logger:   logger,
+	}
+}
+
+// HandleMetadata routes metadata requests
+//
+//	GET  /api/v1/metadata/{files|shares}?format=json|csv  - export a table
+//	POST /api/v1/metadata/{files|shares}?format=json|csv  - import a table from the body
+//
+// Import files before shares; cached files are re-linked to the copies found
+// under this instance's cache root.
+func (h *MetadataHandler) HandleMetadata(w http.ResponseWriter, r *http.Request) {
+	table, err := metadata.ParseTable(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/metadata"), "/"))
+	if err != nil {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	format, err := metadata.ParseFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.export(w, r, table, format)
+	case http.MethodPost:
+		h.importTable(w, r, table, format)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// export streams a table
+func (h *MetadataHandler) export(w http.ResponseWriter, r *http.Request, table metadata.Table, format metadata.Format) {
+	// Exporting a large cache can take longer than the server write timeout
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		reqLogger(r, h.logger).Debug("failed to clear write deadline", zap.Error(err))
+	}
+
+	recordAudit(h.store, h.logger, r, domain.AuditActionMetadataExport, "metadata:"+string(table), map[string]string{
+		"format": string(format),
+	})
+
+	name := string(table) + "." + string(format)
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	if _, err := h.metadata.Export(r.Context(), w, table, format); err != nil {
+		// The status line is already sent; the truncated body shows the failure
+		reqLogger(r, h.logger).Error("metadata export failed",
+			zap.String("table", string(table)),
+			zap.Error(err))
+	}
+}
+
+// importTable reads a table from the request body
+func (h *MetadataHandler) importTable(w http.ResponseWriter, r *http.Request, table metadata.Table, format metadata.Format) {
+	// Uploading a large export can take longer than the server read timeout
+	if err := http.NewResponseController(w).SetReadDeadline(time.Time{}); err != nil {
+		reqLogger(r, h.logger).Debug("failed to clear read deadline", zap.Error(err))
+	}
+
+	result, err := h.metadata.Import(r.Context(), r.Body, table, format)
+	if result != nil {
+		recordAudit(h.store, h.logger, r, domain.AuditActionMetadataImport, "metadata:"+string(table), map[string]string{
+			"files":  strconv.Itoa(result.Files),
+			"linked": strconv.Itoa(result.Linked),
+			"shares": strconv.Itoa(result.Shares),
+		})
+	}
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidInput) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		reqLogger(r, h.logger).Error("metadata import failed",
+			zap.String("table", string(table)),
+			zap.Error(err))
+		http.Error(w, "Import failed", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
@@ -1,10 +1,22 @@
 package server
 
 import (
-	"crypto/subtle"
+	"compress/gzip"
+	"context"
+	"io"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/vertextoedge/synology-file-cache/internal/service/stats"
+	"github.com/vertextoedge/synology-file-cache/internal/util/compress"
+	"github.com/vertextoedge/synology-file-cache/internal/util/ipfilter"
+	"github.com/vertextoedge/synology-file-cache/internal/util/ratelimiter"
+	"github.com/vertextoedge/synology-file-cache/internal/util/reqid"
 	"go.uber.org/zap"
 )
 
@@ -19,6 +31,72 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
+// ReadFrom keeps sendfile for cached files when the underlying writer supports
+// it. The status stays the 200 set up front unless WriteHeader was called.
+func (rw *responseWriter) ReadFrom(src io.Reader) (int64, error) {
+	if rf, ok := rw.ResponseWriter.(io.ReaderFrom); ok {
+		return rf.ReadFrom(src)
+	}
+	return io.Copy(rw.ResponseWriter, src)
+}
+
+// Flush sends buffered data to the client
+func (rw *responseWriter) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach Flush and the deadlines on the
+// underlying writer
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// RequestIDMiddleware tags every request with an ID: a valid incoming
+// X-Request-ID is kept, otherwise one is generated. The ID is returned in the
+// response and added to every log entry written through reqLogger.
+func RequestIDMiddleware(logger *zap.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(reqid.Header)
+			if !reqid.Valid(id) {
+				id = reqid.New()
+			}
+			w.Header().Set(reqid.Header, id)
+			next.ServeHTTP(w, r.WithContext(reqid.WithID(r.Context(), id, logger)))
+		})
+	}
+}
+
+// reqLogger returns the logger for entries about request r, tagged with its ID
+func reqLogger(r *http.Request, logger *zap.Logger) *zap.Logger {
+	return reqid.Logger(r.Context(), logger)
+}
+
+// clientIPKey is the context key of the resolved client IP
+type clientIPKey struct{}
+
+// ClientIPMiddleware resolves the client IP of every request once, so logs and
+// audit events name the client rather than a reverse proxy in front
+func ClientIPMiddleware(trust ProxyTrust) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), clientIPKey{}, trust.ClientIP(r))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// clientIP returns the client IP resolved by ClientIPMiddleware, or the peer
+// address for requests that did not pass through it
+func clientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey{}).(string); ok {
+		return ip
+	}
+	return peerIP(r)
+}
+
 // LoggingMiddleware adds request logging
 func LoggingMiddleware(logger *zap.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
@@ -28,36 +106,265 @@ func LoggingMiddleware(logger *zap.Logger) func(http.Handler) http.Handler {
 
 			next.ServeHTTP(rw, r)
 
-			logger.Debug("HTTP request",
+			reqLogger(r, logger).Debug("HTTP request",
 				zap.String("method", r.Method),
 				zap.String("path", r.URL.Path),
 				zap.String("remote_addr", r.RemoteAddr),
+				zap.String("client_ip", clientIP(r)),
 				zap.Int("status", rw.statusCode),
 				zap.Int64("duration_ms", time.Since(start).Milliseconds()))
 		})
 	}
 }
 
-// BasicAuthMiddleware adds HTTP Basic Auth protection
-func BasicAuthMiddleware(username, password string, logger *zap.Logger) func(http.HandlerFunc) http.HandlerFunc {
+// compressMinSize is the smallest response with a known length worth compressing
+const compressMinSize = 1024
+
+var gzipWriters = sync.Pool{
+	New: func() interface{} { return gzip.NewWriter(io.Discard) },
+}
+
+// CompressionMiddleware gzips text-like responses for clients that accept it.
+// Responses that are already encoded, partial, or of compressed media types
+// pass through unchanged.
+func CompressionMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodHead || !compress.Accepts(r.Header.Get("Accept-Encoding"), compress.Gzip) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressResponseWriter{ResponseWriter: w}
+			defer cw.close()
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// compressResponseWriter decides on compression when the header is written
+type compressResponseWriter struct {
+	http.ResponseWriter
+	zw          *gzip.Writer
+	wroteHeader bool
+}
+
+func (cw *compressResponseWriter) WriteHeader(code int) {
+	if !cw.wroteHeader {
+		cw.wroteHeader = true
+		if cw.shouldCompress(code) {
+			h := cw.Header()
+			h.Del("Content-Length")
+			h.Set("Content-Encoding", compress.Gzip)
+			h.Add("Vary", "Accept-Encoding")
+
+			cw.zw = gzipWriters.Get().(*gzip.Writer)
+			cw.zw.Reset(cw.ResponseWriter)
+		}
+	}
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *compressResponseWriter) Write(p []byte) (int, error) {
+	if !cw.wroteHeader {
+		// Mirror net/http, which sniffs the type of the first write
+		if cw.Header().Get("Content-Type") == "" {
+			cw.Header().Set("Content-Type", http.DetectContentType(p))
+		}
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.zw != nil {
+		return cw.zw.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// ReadFrom keeps sendfile for responses that are not compressed
+func (cw *compressResponseWriter) ReadFrom(src io.Reader) (int64, error) {
+	if rf, ok := cw.ResponseWriter.(io.ReaderFrom); ok && cw.wroteHeader && cw.zw == nil {
+		return rf.ReadFrom(src)
+	}
+	// Hide ReadFrom so io.Copy goes through Write
+	return io.Copy(struct{ io.Writer }{cw}, src)
+}
+
+// Flush sends buffered compressed data to the client
+func (cw *compressResponseWriter) Flush() {
+	if cw.zw != nil {
+		cw.zw.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (cw *compressResponseWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// shouldCompress inspects the response header for a response with status code
+func (cw *compressResponseWriter) shouldCompress(code int) bool {
+	h := cw.Header()
+	switch {
+	case code < http.StatusOK, code == http.StatusNoContent, code == http.StatusPartialContent, code == http.StatusNotModified:
+		return false
+	case h.Get("Content-Encoding") != "", h.Get("Content-Range") != "":
+		return false
+	case !compress.IsCompressible(h.Get("Content-Type")):
+		return false
+	}
+	if n, err := strconv.ParseInt(h.Get("Content-Length"), 10, 64); err == nil && n < compressMinSize {
+		return false
+	}
+	return true
+}
+
+// close finishes the gzip stream and returns the writer to the pool
+func (cw *compressResponseWriter) close() {
+	if cw.zw == nil {
+		return
+	}
+	cw.zw.Close()
+	cw.zw.Reset(io.Discard)
+	gzipWriters.Put(cw.zw)
+	cw.zw = nil
+}
+
+// RateLimitMiddleware rejects requests with 429 when the limiter denies the request key.
+// Requests for which keyFn returns an empty key are not limited.
+func RateLimitMiddleware(limiter *ratelimiter.KeyedLimiter, keyFn func(*http.Request) string, logger *zap.Logger) func(http.HandlerFunc) http.HandlerFunc {
 	return func(next http.HandlerFunc) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
-			user, pass, ok := r.BasicAuth()
-			if !ok {
-				w.Header().Set("WWW-Authenticate", `Basic realm="Admin Access"`)
-				http.Error(w, "Authentication required", http.StatusUnauthorized)
+			key := keyFn(r)
+			if key == "" {
+				next(w, r)
 				return
 			}
 
-			validUser := subtle.ConstantTimeCompare([]byte(user), []byte(username)) == 1
-			validPass := subtle.ConstantTimeCompare([]byte(pass), []byte(password)) == 1
+			if allowed, wait := limiter.Allow(key); !allowed {
+				setRetryAfter(w, wait)
+				http.Error(w, "Too many requests", http.StatusTooManyRequests)
+				reqLogger(r, logger).Debug("request rate limited",
+					zap.String("key", key),
+					zap.String("path", r.URL.Path),
+					zap.String("client_ip", clientIP(r)))
+				return
+			}
+
+			next(w, r)
+		}
+	}
+}
+
+// ProxyTrust decides which proxy headers are believed when resolving the client IP
+type ProxyTrust struct {
+	Headers bool           // Use X-Forwarded-For / X-Real-IP
+	Proxies *ipfilter.List // Only when the peer is one of these proxies (empty = never)
+	Unix    bool           // Or when the peer connected over a Unix domain socket
+}
+
+// trusts reports whether the proxy headers of a request are believed
+func (p ProxyTrust) trusts(r *http.Request) bool {
+	if !p.Headers {
+		return false
+	}
+	if unixPeer(r) {
+		return p.Unix
+	}
+	return !p.Proxies.Empty() && p.Proxies.ContainsString(peerIP(r))
+}
+
+// unixPeer reports whether the request came in on a Unix domain socket,
+// whose peers have no address ("@" on Linux)
+func unixPeer(r *http.Request) bool {
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok && addr.Network() == "unix" {
+		return true
+	}
+	return r.RemoteAddr == "@"
+}
+
+// peerIP returns the address of the connection's other end
+func peerIP(r *http.Request) string {
+	peer, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return peer
+}
+
+// ClientIP returns the client IP for a request.
+// Proxy headers are only honoured from trusted proxies, since clients can
+// forge them: the right-most X-Forwarded-For address that is not a trusted
+// proxy is the client, X-Real-IP is used when there is no X-Forwarded-For.
+func (p ProxyTrust) ClientIP(r *http.Request) string {
+	peer := peerIP(r)
+	if !p.trusts(r) {
+		return peer
+	}
+
+	xff := r.Header.Values("X-Forwarded-For")
+	if len(xff) == 0 {
+		// Repeated or malformed values would make up an arbitrary client key
+		if real := r.Header.Values("X-Real-IP"); len(real) == 1 {
+			if ip := headerIP(real[0]); ip != "" {
+				return ip
+			}
+		}
+		return peer
+	}
 
-			if !validUser || !validPass {
-				w.Header().Set("WWW-Authenticate", `Basic realm="Admin Access"`)
-				http.Error(w, "Invalid credentials", http.StatusUnauthorized)
-				logger.Warn("failed admin authentication attempt",
-					zap.String("username", user),
-					zap.String("remote_addr", r.RemoteAddr))
+	// Walk back through the proxy chain; addresses left of the first
+	// untrusted hop may have been forged by the client
+	hops := strings.Split(strings.Join(xff, ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		if strings.TrimSpace(hops[i]) == "" {
+			continue
+		}
+		ip := headerIP(hops[i])
+		if ip == "" {
+			// Nothing left of a malformed hop can be told apart
+			return peer
+		}
+		if !p.Proxies.ContainsString(ip) {
+			return ip
+		}
+		peer = ip
+	}
+	return peer
+}
+
+// headerIP returns the address in a proxy header value in canonical form,
+// or "" if it is not a single IP address
+func headerIP(value string) string {
+	ip := net.ParseIP(strings.TrimSpace(value))
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
+}
+
+// IsHTTPS reports whether the client reached the server over HTTPS, directly
+// or through a trusted proxy sending X-Forwarded-Proto
+func (p ProxyTrust) IsHTTPS(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+	if !p.trusts(r) {
+		return false
+	}
+	return strings.EqualFold(strings.TrimSpace(r.Header.Get("X-Forwarded-Proto")), "https")
+}
+
+// IPFilterMiddleware refuses share requests from clients outside the allowed networks
+func IPFilterMiddleware(rules ipfilter.Rules, trust ProxyTrust, logger *zap.Logger) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if ip := trust.ClientIP(r); !rules.Allows(ip) {
+				reqLogger(r, logger).Warn("share request refused by IP filter",
+					zap.String("client_ip", ip),
+					zap.String("path", r.URL.Path))
+				http.Error(w, "Access denied", http.StatusForbidden)
 				return
 			}
 
@@ -65,3 +372,51 @@ func BasicAuthMiddleware(username, password string, logger *zap.Logger) func(htt
 		}
 	}
 }
+
+// ServedBytesMiddleware counts the response bytes of share requests into the statistics
+func ServedBytesMiddleware(counters *stats.Counters) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			next(&servedBytesWriter{ResponseWriter: w, counters: counters}, r)
+		}
+	}
+}
+
+// servedBytesWriter records written bytes as served
+type servedBytesWriter struct {
+	http.ResponseWriter
+	counters *stats.Counters
+}
+
+func (w *servedBytesWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.counters.RecordServed(int64(n))
+	return n, err
+}
+
+// ReadFrom keeps sendfile for cached files when the underlying writer supports it
+func (w *servedBytesWriter) ReadFrom(src io.Reader) (int64, error) {
+	var n int64
+	var err error
+	if rf, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(src)
+	} else {
+		n, err = io.Copy(w.ResponseWriter, src)
+	}
+	w.counters.RecordServed(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach Flush on the underlying writer
+func (w *servedBytesWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// setRetryAfter sets the Retry-After header in whole seconds
+func setRetryAfter(w http.ResponseWriter, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+}
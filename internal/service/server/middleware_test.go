@@ -0,0 +1,203 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/vertextoedge/synology-file-cache/internal/util/ipfilter"
+)
+
+// testTrust trusts proxy headers from the 10.0.0.0/8 network
+func testTrust(t *testing.T) ProxyTrust {
+	t.Helper()
+	proxies, err := ipfilter.Parse([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ProxyTrust{Headers: true, Proxies: proxies}
+}
+
+func TestProxyTrust_ClientIP(t *testing.T) {
+	tests := []struct {
+		name   string
+		trust  ProxyTrust
+		peer   string
+		header http.Header
+		want   string
+	}{
+		{
+			name:   "headers not trusted",
+			trust:  ProxyTrust{},
+			peer:   "10.0.0.1:1234",
+			header: http.Header{"X-Forwarded-For": {"203.0.113.7"}},
+			want:   "10.0.0.1",
+		},
+		{
+			name:   "no trusted proxies configured",
+			trust:  ProxyTrust{Headers: true},
+			peer:   "198.51.100.2:1234",
+			header: http.Header{"X-Forwarded-For": {"203.0.113.7"}},
+			want:   "198.51.100.2",
+		},
+		{
+			name:   "spoofed X-Forwarded-For from an untrusted peer",
+			trust:  testTrust(t),
+			peer:   "198.51.100.2:1234",
+			header: http.Header{"X-Forwarded-For": {"203.0.113.7"}},
+			want:   "198.51.100.2",
+		},
+		{
+			name:   "spoofed X-Real-IP from an untrusted peer",
+			trust:  testTrust(t),
+			peer:   "198.51.100.2:1234",
+			header: http.Header{"X-Real-Ip": {"203.0.113.7"}},
+			want:   "198.51.100.2",
+		},
+		{
+			name:   "trusted proxy",
+			trust:  testTrust(t),
+			peer:   "10.0.0.1:1234",
+			header: http.Header{"X-Forwarded-For": {"203.0.113.7"}},
+			want:   "203.0.113.7",
+		},
+		{
+			name:   "X-Real-IP from a trusted proxy",
+			trust:  testTrust(t),
+			peer:   "10.0.0.1:1234",
+			header: http.Header{"X-Real-Ip": {"203.0.113.7"}},
+			want:   "203.0.113.7",
+		},
+		{
+			name:   "garbage X-Real-IP from a trusted proxy",
+			trust:  testTrust(t),
+			peer:   "10.0.0.1:1234",
+			header: http.Header{"X-Real-Ip": {"203.0.113.7, 192.0.2.1<script>"}},
+			want:   "10.0.0.1",
+		},
+		{
+			name:   "repeated X-Real-IP from a trusted proxy",
+			trust:  testTrust(t),
+			peer:   "10.0.0.1:1234",
+			header: http.Header{"X-Real-Ip": {"203.0.113.7", "192.0.2.1"}},
+			want:   "10.0.0.1",
+		},
+		{
+			name:   "garbage X-Forwarded-For hop",
+			trust:  testTrust(t),
+			peer:   "10.0.0.1:1234",
+			header: http.Header{"X-Forwarded-For": {"203.0.113.7, not-an-ip, 10.0.0.2"}},
+			want:   "10.0.0.2",
+		},
+		{
+			name:   "client prepends a forged address",
+			trust:  testTrust(t),
+			peer:   "10.0.0.1:1234",
+			header: http.Header{"X-Forwarded-For": {"192.0.2.1, 203.0.113.7"}},
+			want:   "203.0.113.7",
+		},
+		{
+			name:   "multi-hop chain through trusted proxies",
+			trust:  testTrust(t),
+			peer:   "10.0.0.1:1234",
+			header: http.Header{"X-Forwarded-For": {"192.0.2.1, 203.0.113.7", "10.0.0.3, 10.0.0.2"}},
+			want:   "203.0.113.7",
+		},
+		{
+			name:   "only trusted hops",
+			trust:  testTrust(t),
+			peer:   "10.0.0.1:1234",
+			header: http.Header{"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"}},
+			want:   "10.0.0.3",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/f/token", nil)
+			r.RemoteAddr = tt.peer
+			r.Header = tt.header
+			if got := tt.trust.ClientIP(r); got != tt.want {
+				t.Errorf("ClientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProxyTrust_ClientIP_UnixSocket(t *testing.T) {
+	socketTrust := testTrust(t)
+	socketTrust.Unix = true
+
+	tests := []struct {
+		name  string
+		trust ProxyTrust
+		want  string
+	}{
+		{"socket peers not trusted", testTrust(t), "@"},
+		{"socket peers trusted", socketTrust, "203.0.113.7"},
+		{"socket peers trusted without headers", ProxyTrust{Unix: true}, "@"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/f/token", nil)
+			r.RemoteAddr = "@"
+			r.Header.Set("X-Forwarded-For", "192.0.2.1, 203.0.113.7")
+			if got := tt.trust.ClientIP(r); got != tt.want {
+				t.Errorf("ClientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// A TCP peer is not trusted just because socket peers are
+	r := httptest.NewRequest(http.MethodGet, "/f/token", nil)
+	r.RemoteAddr = "198.51.100.2:1234"
+	r.Header.Set("X-Forwarded-For", "203.0.113.7")
+	if got := socketTrust.ClientIP(r); got != "198.51.100.2" {
+		t.Errorf("ClientIP from a TCP peer = %q, want 198.51.100.2", got)
+	}
+}
+
+func TestProxyTrust_IsHTTPS(t *testing.T) {
+	trust := testTrust(t)
+	r := httptest.NewRequest(http.MethodGet, "/f/token", nil)
+	r.Header.Set("X-Forwarded-Proto", "https")
+
+	r.RemoteAddr = "198.51.100.2:1234"
+	if trust.IsHTTPS(r) {
+		t.Error("X-Forwarded-Proto believed from an untrusted peer")
+	}
+	r.RemoteAddr = "10.0.0.1:1234"
+	if !trust.IsHTTPS(r) {
+		t.Error("X-Forwarded-Proto ignored from a trusted proxy")
+	}
+	if (ProxyTrust{Headers: true}).IsHTTPS(r) {
+		t.Error("X-Forwarded-Proto believed without trusted proxies")
+	}
+}
+
+func TestClientIPMiddleware(t *testing.T) {
+	var got string
+	handler := ClientIPMiddleware(testTrust(t))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = clientIP(r)
+	}))
+
+	for _, tt := range []struct{ peer, xff, want string }{
+		{"10.0.0.1:1234", "203.0.113.7", "203.0.113.7"},
+		{"198.51.100.2:1234", "203.0.113.7", "198.51.100.2"},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/f/token", nil)
+		r.RemoteAddr = tt.peer
+		r.Header.Set("X-Forwarded-For", tt.xff)
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+		if got != tt.want {
+			t.Errorf("peer %s: clientIP = %q, want %q", tt.peer, got, tt.want)
+		}
+	}
+
+	// Requests that did not pass through the middleware use the peer
+	r := httptest.NewRequest(http.MethodGet, "/f/token", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("X-Forwarded-For", "203.0.113.7")
+	if ip := clientIP(r); ip != "10.0.0.1" {
+		t.Errorf("clientIP without middleware = %q, want the peer", ip)
+	}
+}
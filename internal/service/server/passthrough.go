@@ -0,0 +1,65 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// passthrough forwards every request the cache does not serve to DSM, so the
+// server can take the place of the Synology Drive hostname: share links it
+// has cached are answered locally, the DSM web UI, its APIs and everything
+// else reach the NAS unchanged. Our /f/{token} links go to /d/s/{token}.
+type passthrough struct {
+	proxy  *httputil.ReverseProxy
+	logger *zap.Logger
+}
+
+// newPassthrough creates a passthrough to the DSM at baseURL
+func newPassthrough(baseURL string, skipTLSVerify bool, logger *zap.Logger) (*passthrough, error) {
+	target, err := url.Parse(baseURL)
+	if err != nil || target.Scheme == "" || target.Host == "" {
+		return nil, fmt.Errorf("invalid synology base URL %q", baseURL)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if skipTLSVerify {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	p := &passthrough{logger: logger}
+	p.proxy = &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.Out.URL.Path = nasSharePath(pr.In.URL.Path)
+			pr.Out.URL.RawPath = ""
+			pr.SetURL(target)
+			pr.SetXForwarded()
+			// DSM builds redirects and cookies for the hostname clients use
+			pr.Out.Host = pr.In.Host
+		},
+		Transport: transport,
+		// Long polls and event streams of the DSM UI must not be buffered
+		FlushInterval: -1,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			reqLogger(r, logger).Warn("failed to pass request through to DSM", zap.String("path", r.URL.Path), zap.Error(err))
+			http.Error(w, "Bad gateway", http.StatusBadGateway)
+		},
+	}
+	return p, nil
+}
+
+// ServeHTTP forwards the request to DSM
+func (p *passthrough) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Downloads and long polls through DSM outlast the server write timeout
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		reqLogger(r, p.logger).Debug("failed to clear write deadline", zap.Error(err))
+	}
+
+	reqLogger(r, p.logger).Debug("passing request through to DSM", zap.String("path", r.URL.Path))
+	p.proxy.ServeHTTP(w, r)
+}
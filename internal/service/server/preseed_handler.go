@@ -0,0 +1,172 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"go.uber.org/zap"
+)
+
+// PreseedHandler handles requests managing paths that are always cached
+type PreseedHandler struct {
+	store       port.Store
+	configured  []string // Paths from cache.preseed_paths, read-only here
+	syncTrigger func()   // Requests a scan of pre-seeded paths, may be nil
+	logger      *zap.Logger
+}
+
+// NewPreseedHandler creates a new PreseedHandler
+func NewPreseedHandler(store port.Store, configured []string, syncTrigger func(), logger *zap.Logger) *PreseedHandler {
+	return &PreseedHandler{
+		store:       store,
+		configured:  configured,
+		syncTrigger: syncTrigger,
+		logger:      logger,
+	}
+}
+
+// preseedResponse is the JSON representation of a pre-seeded path.
+// Paths from the configuration have no ID and cannot be removed through the API.
+type preseedResponse struct {
+	ID        int64      `json:"id,omitempty"`
+	Path      string     `json:"path"`
+	Source    string     `json:"source"` // "config" or "api"
+	CreatedBy string     `json:"created_by,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+}
+
+// HandlePreseed routes /api/v1/preseed requests. Listing requires the viewer
+// role, changes require operator.
+//
+//	GET    /api/v1/preseed        list configured and API-managed paths
+//	POST   /api/v1/preseed        add a folder {"path"} and scan it now
+//	DELETE /api/v1/preseed/{id}   remove an API-managed path
+func (h *PreseedHandler) HandlePreseed(w http.ResponseWriter, r *http.Request) {
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/preseed"), "/")
+
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		h.handleList(w, r)
+	case id == "" && r.Method == http.MethodPost:
+		h.handleAdd(w, r)
+	case id != "" && r.Method == http.MethodDelete:
+		preseedID, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid preseed ID", http.StatusBadRequest)
+			return
+		}
+		h.handleDelete(w, r, preseedID)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleList returns configured paths followed by API-managed ones
+func (h *PreseedHandler) handleList(w http.ResponseWriter, r *http.Request) {
+	stored, err := h.store.ListPreseedPaths()
+	if err != nil {
+		reqLogger(r, h.logger).Error("failed to list preseed paths", zap.Error(err))
+		http.Error(w, "Failed to list preseed paths", http.StatusInternalServerError)
+		return
+	}
+
+	items := make([]preseedResponse, 0, len(h.configured)+len(stored))
+	for _, p := range h.configured {
+		items = append(items, preseedResponse{Path: p, Source: "config"})
+	}
+	for _, p := range stored {
+		createdAt := p.CreatedAt
+		items = append(items, preseedResponse{
+			ID:        p.ID,
+			Path:      p.Path,
+			Source:    "api",
+			CreatedBy: p.CreatedBy,
+			CreatedAt: &createdAt,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"paths": items})
+}
+
+// handleAdd stores a new pre-seeded folder and requests a scan
+func (h *PreseedHandler) handleAdd(w http.ResponseWriter, r *http.Request) {
+	if !requireRole(w, r, domain.RoleOperator) {
+		return
+	}
+
+	var req struct {
+		Path string `json:"path"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !strings.HasPrefix(req.Path, "/") {
+		http.Error(w, "path must be an absolute Drive path", http.StatusBadRequest)
+		return
+	}
+
+	p := &domain.PreseedPath{
+		Path:      path.Clean(req.Path),
+		CreatedBy: actorName(r),
+	}
+	err := h.store.AddPreseedPath(p)
+	switch {
+	case errors.Is(err, domain.ErrAlreadyExists):
+		http.Error(w, "Path is already pre-seeded", http.StatusConflict)
+		return
+	case err != nil:
+		reqLogger(r, h.logger).Error("failed to add preseed path", zap.String("path", p.Path), zap.Error(err))
+		http.Error(w, "Failed to add preseed path", http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(h.store, h.logger, r, domain.AuditActionPreseedAdd, "preseed:"+p.Path, nil)
+	reqLogger(r, h.logger).Info("preseed path added", zap.String("path", p.Path), zap.String("by", p.CreatedBy))
+
+	if h.syncTrigger != nil {
+		h.syncTrigger()
+	}
+
+	writeJSON(w, http.StatusCreated, preseedResponse{
+		ID:        p.ID,
+		Path:      p.Path,
+		Source:    "api",
+		CreatedBy: p.CreatedBy,
+		CreatedAt: &p.CreatedAt,
+	})
+}
+
+// handleDelete removes an API-managed path; its files are unpinned on the next scan
+func (h *PreseedHandler) handleDelete(w http.ResponseWriter, r *http.Request, id int64) {
+	if !requireRole(w, r, domain.RoleOperator) {
+		return
+	}
+
+	err := h.store.DeletePreseedPath(id)
+	switch {
+	case errors.Is(err, domain.ErrNotFound):
+		http.Error(w, "Preseed path not found", http.StatusNotFound)
+		return
+	case err != nil:
+		reqLogger(r, h.logger).Error("failed to delete preseed path", zap.Int64("id", id), zap.Error(err))
+		http.Error(w, "Failed to delete preseed path", http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(h.store, h.logger, r, domain.AuditActionPreseedRemove, "preseed:"+strconv.FormatInt(id, 10), nil)
+	reqLogger(r, h.logger).Info("preseed path removed", zap.Int64("id", id), zap.String("by", actorName(r)))
+
+	if h.syncTrigger != nil {
+		h.syncTrigger()
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+)
+
+// progressForgetAfter drops tracked tasks that have not been observed for this long
+const progressForgetAfter = 10 * time.Minute
+
+// progressEntry is the last observed progress update of a task
+type progressEntry struct {
+	workerID string
+	bytes    int64
+	at       time.Time // updated_at of the task row
+	seen     time.Time // when the entry was last observed
+	rate     float64   // Smoothed bytes per second, 0 until two updates were seen
+}
+
+// progressTracker derives download speed from successive progress updates.
+// Workers only persist bytes_downloaded every cache.progress_update_interval,
+// so the rate is computed between the updates observed by API requests.
+type progressTracker struct {
+	mu      sync.Mutex
+	entries map[int64]*progressEntry
+}
+
+// newProgressTracker creates an empty progressTracker
+func newProgressTracker() *progressTracker {
+	return &progressTracker{entries: make(map[int64]*progressEntry)}
+}
+
+// observe records the task's current progress and returns its progress view
+func (t *progressTracker) observe(task *domain.DownloadTask) domain.TaskProgress {
+	now := time.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for id, e := range t.entries {
+		if now.Sub(e.seen) > progressForgetAfter {
+			delete(t.entries, id)
+		}
+	}
+
+	if task.Status != domain.TaskStatusInProgress {
+		delete(t.entries, task.ID)
+		return domain.NewTaskProgress(task, 0)
+	}
+
+	e, ok := t.entries[task.ID]
+	switch {
+	case !ok || e.workerID != task.WorkerID || task.BytesDownloaded < e.bytes:
+		// New claim or restarted download; start measuring afresh
+		e = &progressEntry{workerID: task.WorkerID, bytes: task.BytesDownloaded, at: task.UpdatedAt}
+		t.entries[task.ID] = e
+	case task.UpdatedAt.After(e.at):
+		rate := float64(task.BytesDownloaded-e.bytes) / task.UpdatedAt.Sub(e.at).Seconds()
+		if e.rate > 0 {
+			rate = (e.rate + rate) / 2
+		}
+		e.rate = rate
+		e.bytes = task.BytesDownloaded
+		e.at = task.UpdatedAt
+	}
+	e.seen = now
+
+	return domain.NewTaskProgress(task, e.rate)
+}
+
+// forget drops all tasks not in active
+func (t *progressTracker) forget(active map[int64]bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for id := range t.entries {
+		if !active[id] {
+			delete(t.entries, id)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"go.uber.org/zap"
+)
+
+// ReplicaHandler stores the objects another instance replicates to this one
+// (a warm standby), for -bootstrap-replica to restore from
+type ReplicaHandler struct {
+	replica port.ReplicaStore
+	logger  *zap.Logger
+}
+
+// NewReplicaHandler creates a new ReplicaHandler
+func NewReplicaHandler(replica port.ReplicaStore, logger *zap.Logger) *ReplicaHandler {
+	return &ReplicaHandler{
+		replica: replica,
+		logger:  logger,
+	}
+}
+
+// HandleObjects routes replica object requests
+//
+//	GET    /api/v1/replica/objects?prefix=  - list object keys
+//	PUT    /api/v1/replica/objects/{key}    - store an object (Content-Length required)
+//	GET    /api/v1/replica/objects/{key}    - read an object
+//	DELETE /api/v1/replica/objects/{key}    - remove an object
+func (h *ReplicaHandler) HandleObjects(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/api/v1/replica/objects"), "/")
+
+	switch {
+	case key == "" && r.Method == http.MethodGet:
+		h.listObjects(w, r)
+	case key != "" && r.Method == http.MethodPut:
+		h.putObject(w, r, key)
+	case key != "" && r.Method == http.MethodGet:
+		h.getObject(w, r, key)
+	case key != "" && r.Method == http.MethodDelete:
+		h.deleteObject(w, r, key)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// replicaError writes the response for a failed replica operation
+func (h *ReplicaHandler) replicaError(w http.ResponseWriter, r *http.Request, msg string, err error) {
+	switch {
+	case errors.Is(err, domain.ErrInvalidInput):
+		http.Error(w, "Invalid object key", http.StatusBadRequest)
+	case errors.Is(err, domain.ErrNotFound):
+		http.Error(w, "Object not found", http.StatusNotFound)
+	default:
+		reqLogger(r, h.logger).Error(msg, zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// listObjects returns the keys of the stored objects
+func (h *ReplicaHandler) listObjects(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.replica.List(r.Context(), r.URL.Query().Get("prefix"))
+	if err != nil {
+		h.replicaError(w, r, "failed to list replica objects", err)
+		return
+	}
+	if keys == nil {
+		keys = []string{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": keys,
+	})
+}
+
+// putObject stores the request body under key
+func (h *ReplicaHandler) putObject(w http.ResponseWriter, r *http.Request, key string) {
+	if r.ContentLength < 0 {
+		http.Error(w, "Content-Length required", http.StatusLengthRequired)
+		return
+	}
+
+	// Uploading a large copy can take longer than the server read timeout
+	if err := http.NewResponseController(w).SetReadDeadline(time.Time{}); err != nil {
+		reqLogger(r, h.logger).Debug("failed to clear read deadline", zap.Error(err))
+	}
+
+	if err := h.replica.Put(r.Context(), key, r.Body, r.ContentLength); err != nil {
+		h.replicaError(w, r, "failed to store replica object", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getObject streams an object
+func (h *ReplicaHandler) getObject(w http.ResponseWriter, r *http.Request, key string) {
+	body, err := h.replica.Get(r.Context(), key)
+	if err != nil {
+		h.replicaError(w, r, "failed to read replica object", err)
+		return
+	}
+	defer body.Close()
+
+	// Reading a large copy can take longer than the server write timeout
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		reqLogger(r, h.logger).Debug("failed to clear write deadline", zap.Error(err))
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	if _, err := io.Copy(w, body); err != nil {
+		reqLogger(r, h.logger).Debug("failed to send replica object", zap.Error(err))
+	}
+}
+
+// deleteObject removes an object
+func (h *ReplicaHandler) deleteObject(w http.ResponseWriter, r *http.Request, key string) {
+	if err := h.replica.Delete(r.Context(), key); err != nil {
+		h.replicaError(w, r, "failed to delete replica object", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
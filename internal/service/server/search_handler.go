@@ -0,0 +1,188 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"go.uber.org/zap"
+)
+
+// SearchHandler searches the tracked files
+type SearchHandler struct {
+	store  port.Store
+	logger *zap.Logger
+}
+
+// NewSearchHandler creates a new SearchHandler
+func NewSearchHandler(store port.Store, logger *zap.Logger) *SearchHandler {
+	return &SearchHandler{
+		store:  store,
+		logger: logger,
+	}
+}
+
+// fileResponse is the JSON representation of a tracked file
+type fileResponse struct {
+	ID                int64      `json:"id"`
+	Path              string     `json:"path"`
+	Size              int64      `json:"size"`
+	ModifiedAt        *time.Time `json:"modified_at,omitempty"`
+	Cached            bool       `json:"cached"`
+	Stale             bool       `json:"stale,omitempty"` // The cached copy is an older version being replaced
+	Priority          int        `json:"priority"`
+	Owner             string     `json:"owner,omitempty"`
+	Labels            []string   `json:"labels,omitempty"`
+	ContentType       string     `json:"content_type,omitempty"`
+	Starred           bool       `json:"starred"`
+	Shared            bool       `json:"shared"`
+	LastAccessAt      *time.Time `json:"last_access_at,omitempty"`      // Last read from the cache
+	AccessCount       int64      `json:"access_count"`                  // Share requests served from the cache
+	BytesServed       int64      `json:"bytes_served"`                  // Bytes served from the cache
+	MissCount         int64      `json:"miss_count"`                    // Share requests made while not cached
+	MissingUpstreamAt *time.Time `json:"missing_upstream_at,omitempty"` // A download found it deleted on the NAS
+}
+
+// HandleSearch searches tracked files
+//
+//	GET /api/v1/files/search?q=report&cached=true&priority=1&min_size=1048576&max_size=0
+//	    &owner=alice&label=finance&sort=size&order=desc&limit=100&offset=0
+//
+// q matches a case-insensitive substring of the path, or the whole path as a
+// case-sensitive glob when it contains *, ? or [...] (e.g. "/team/*.mp4").
+// sort is one of path (default), size, modified, priority, last_access,
+// accesses, served or misses; sort=accesses&order=desc lists the hottest files.
+func (h *SearchHandler) HandleSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	search := domain.FileSearch{
+		Path:  query.Get("q"),
+		Owner: query.Get("owner"),
+		Label: query.Get("label"),
+		Sort:  query.Get("sort"),
+	}
+
+	cached, ok := parseCachedFilter(w, r)
+	if !ok {
+		return
+	}
+	search.Cached = cached
+	if v := query.Get("priority"); v != "" {
+		priority, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "priority must be an integer", http.StatusBadRequest)
+			return
+		}
+		search.Priority = &priority
+	}
+	for _, bound := range []struct {
+		name string
+		dst  *int64
+	}{{"min_size", &search.MinSize}, {"max_size", &search.MaxSize}} {
+		v := query.Get(bound.name)
+		if v == "" {
+			continue
+		}
+		size, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || size < 0 {
+			http.Error(w, bound.name+" must be a byte count", http.StatusBadRequest)
+			return
+		}
+		*bound.dst = size
+	}
+	if search.MaxSize > 0 && search.MinSize > search.MaxSize {
+		http.Error(w, "min_size must not exceed max_size", http.StatusBadRequest)
+		return
+	}
+
+	if search.Sort != "" && !domain.IsFileSortKey(search.Sort) {
+		http.Error(w, "sort must be one of "+strings.Join(domain.FileSortKeys, ", "), http.StatusBadRequest)
+		return
+	}
+	switch query.Get("order") {
+	case "", "asc":
+	case "desc":
+		search.Desc = true
+	default:
+		http.Error(w, "order must be asc or desc", http.StatusBadRequest)
+		return
+	}
+
+	limit, offset := parsePagination(r)
+
+	files, total, err := h.store.SearchFiles(search, limit, offset)
+	if err != nil {
+		reqLogger(r, h.logger).Error("failed to search files", zap.Error(err))
+		http.Error(w, "Failed to search files", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"files":  toFileResponses(files),
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// HandleMissingUpstream lists files whose download found them deleted on the
+// NAS, most recently found first. They are not downloaded again until
+// cache.missing_upstream_ttl passes or a sync sees a newer version.
+//
+//	GET /api/v1/files/missing?limit=100&offset=0
+func (h *SearchHandler) HandleMissingUpstream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit, offset := parsePagination(r)
+
+	files, total, err := h.store.ListMissingUpstream(limit, offset)
+	if err != nil {
+		reqLogger(r, h.logger).Error("failed to list files missing upstream", zap.Error(err))
+		http.Error(w, "Failed to list files missing upstream", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"files":  toFileResponses(files),
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// toFileResponses converts tracked files to their JSON representation
+func toFileResponses(files []*domain.File) []fileResponse {
+	items := make([]fileResponse, 0, len(files))
+	for _, f := range files {
+		items = append(items, fileResponse{
+			ID:                f.ID,
+			Path:              f.Path,
+			Size:              f.Size,
+			ModifiedAt:        f.ModifiedAt,
+			Cached:            f.Cached,
+			Stale:             f.Stale,
+			Priority:          f.Priority,
+			Owner:             f.Owner,
+			Labels:            f.Labels,
+			ContentType:       f.ContentType,
+			Starred:           f.Starred,
+			Shared:            f.Shared,
+			LastAccessAt:      f.LastAccessInCacheAt,
+			AccessCount:       f.AccessCount,
+			BytesServed:       f.BytesServed,
+			MissCount:         f.MissCount,
+			MissingUpstreamAt: f.MissingUpstreamAt,
+		})
+	}
+	return items
+}
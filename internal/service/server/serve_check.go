@@ -0,0 +1,99 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"github.com/vertextoedge/synology-file-cache/internal/util/cryptfile"
+)
+
+// RejectCachedFunc stops serving a cached file a pre-serve hook refused
+type RejectCachedFunc func(fileID int64, reason error) error
+
+// maxCheckedCopies bounds the copies remembered as passed; the memory is
+// cleared when it is full
+const maxCheckedCopies = 10000
+
+// copyVersion identifies a cached copy as it was inspected
+type copyVersion struct {
+	size    int64
+	modTime time.Time
+}
+
+// serveCheck runs the pre-serve hooks on cached copies before they are
+// served. Copies that pass are remembered by path, size and modification
+// time, so each copy is only inspected again after it changed.
+type serveCheck struct {
+	hooks  []port.PreServeHook
+	reject RejectCachedFunc
+	keys   *cryptfile.Keyring // Decrypts copies encrypted at rest (nil = read as stored)
+
+	mu     sync.Mutex
+	passed map[string]copyVersion
+}
+
+// newServeCheck creates a serveCheck running hooks in order
+func newServeCheck(hooks []port.PreServeHook, reject RejectCachedFunc, keys *cryptfile.Keyring) *serveCheck {
+	return &serveCheck{
+		hooks:  hooks,
+		reject: reject,
+		keys:   keys,
+		passed: make(map[string]copyVersion),
+	}
+}
+
+// inspect checks the cached copy of file. A copy a hook refuses is handed to
+// reject and reported with a *domain.RejectedError.
+func (c *serveCheck) inspect(ctx context.Context, file *domain.File) error {
+	info, err := os.Stat(file.CachePath)
+	if err != nil {
+		return fmt.Errorf("failed to stat cached file: %w", err)
+	}
+	version := copyVersion{size: info.Size(), modTime: info.ModTime()}
+
+	c.mu.Lock()
+	known, ok := c.passed[file.CachePath]
+	c.mu.Unlock()
+	if ok && known == version {
+		return nil
+	}
+
+	body, err := cryptfile.Open(file.CachePath, c.keys)
+	if err != nil {
+		return fmt.Errorf("failed to open cached file: %w", err)
+	}
+	defer body.Close()
+
+	for _, hook := range c.hooks {
+		if _, err := body.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		err := hook.Inspect(ctx, file, body)
+		if errors.Is(err, domain.ErrFileRejected) {
+			if c.reject != nil {
+				if rejectErr := c.reject(file.ID, err); rejectErr != nil {
+					return fmt.Errorf("%w (%v)", err, rejectErr)
+				}
+			}
+			return err
+		}
+		if err != nil {
+			return fmt.Errorf("%s hook failed: %w", hook.Name(), err)
+		}
+	}
+
+	c.mu.Lock()
+	if len(c.passed) >= maxCheckedCopies {
+		clear(c.passed)
+	}
+	c.passed[file.CachePath] = version
+	c.mu.Unlock()
+	return nil
+}
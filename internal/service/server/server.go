@@ -2,32 +2,164 @@ package server
 
 import (
 	"context"
+	"html/template"
+	"io"
+	"math"
+	"net"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
 	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"github.com/vertextoedge/synology-file-cache/internal/service/backup"
+	"github.com/vertextoedge/synology-file-cache/internal/service/chunk"
+	"github.com/vertextoedge/synology-file-cache/internal/service/events"
+	"github.com/vertextoedge/synology-file-cache/internal/service/metadata"
+	"github.com/vertextoedge/synology-file-cache/internal/service/partial"
+	"github.com/vertextoedge/synology-file-cache/internal/service/preview"
+	"github.com/vertextoedge/synology-file-cache/internal/service/stats"
+	"github.com/vertextoedge/synology-file-cache/internal/service/stream"
+	"github.com/vertextoedge/synology-file-cache/internal/util/bufpool"
+	"github.com/vertextoedge/synology-file-cache/internal/util/cryptfile"
+	"github.com/vertextoedge/synology-file-cache/internal/util/inuse"
+	"github.com/vertextoedge/synology-file-cache/internal/util/ipfilter"
+	"github.com/vertextoedge/synology-file-cache/internal/util/passhash"
+	"github.com/vertextoedge/synology-file-cache/internal/util/ratelimiter"
+	"github.com/vertextoedge/synology-file-cache/internal/util/urlsign"
 	"go.uber.org/zap"
 )
 
 // Config contains HTTP server configuration
 type Config struct {
-	BindAddr           string
-	AdminUsername      string
-	AdminPassword      string
+	BindAddrs          []string // host:port, [ipv6]:port or unix:/path/to.sock
+	AdminUsername      string   // Built-in admin account, always has the admin role
+	AdminPassword      string   // Plaintext, hashed at startup; ignored when AdminPasswordHash is set
+	AdminPasswordHash  string   // passhash encoded admin password
 	EnableAdminBrowser bool
+	EnableAdminAPI     bool
 	CacheRootDir       string
+	WebhookSecret      string                     // Enables /webhook/drive when set together with SyncTrigger and DriveChanges
+	SyncTrigger        func()                     // Requests an incremental sync, e.g. for notifications without changes
+	DriveChanges       func([]domain.DriveChange) // Queues the changes of authenticated Drive notifications
+	Previews           *preview.Generator         // Enables /f/{token}/thumb when set
+	Streams            *stream.Streamer           // Enables /f/{token}/stream.m3u8 when set
+	Chunks             *chunk.Cache               // Serves very large uncached files from chunks when set
+	Partial            *partial.Source            // Serves files being downloaded from their temp file when set
+	Backups            *backup.Service            // Enables /api/v1/backups when set
+	Metadata           *metadata.Service          // Enables /api/v1/metadata (export/import of files and shares) when set
+	Events             *events.Bus                // Enables /api/v1/events (live event stream) when set
+	ReplicaReceiver    port.ReplicaStore          // Enables /api/v1/replica/objects, storing objects replicated to this instance, when set
+	Namespaces         http.Handler               // Serves /t/{namespace}/ when set
+	PathPrefix         string                     // Prefix of share links handed out by the API and the password form, for a server mounted below the root
+	Unsupported        string                     // Reason given with 501 by the routes of features left out (previews, streams, backups, events, replication, admin browser); empty = 404
+	PreseedPaths       []string                   // Pre-seeded paths from configuration, listed read-only
+	PreseedTrigger     func()                     // Called after pre-seeded paths change through the API
+	CompressionEnabled bool                       // Gzip text-like responses for clients that accept it
+	CopyBufferSize     int                        // Buffer for responses that cannot use sendfile, in bytes (0 = bufpool.DefaultSize)
+	EncryptionKeys     *cryptfile.Keyring         // Decrypts copies encrypted at rest (nil = copies are read as stored)
+	Listeners          []net.Listener             // Pre-bound listeners (systemd socket activation), override BindAddrs
+	AccessLog          io.Writer                  // Access log destination, nil disables
+	AccessLogFormat    string                     // AccessLogCommon, AccessLogCombined or AccessLogJSON
+	CORS               CORSConfig                 // Cross-origin access to shares and the API
 	ReadTimeout        time.Duration
 	WriteTimeout       time.Duration
 	IdleTimeout        time.Duration
+
+	// SyncDryRun reports what a sync would change for POST /api/v1/sync?dry_run=true
+	SyncDryRun func(ctx context.Context) (*domain.SyncReport, error)
+
+	// CacheRequest looks up a file by path and enqueues it for POST /api/v1/cache
+	CacheRequest CacheRequestFunc
+
+	// CreateShare shares a file on the NAS and caches it for POST /api/v1/shares
+	CreateShare CreateShareFunc
+
+	// Workers reports the download workers of this process for GET /api/v1/workers
+	Workers func() []domain.WorkerStatus
+
+	// SyncScope reports the hit ratio tuned sync scope in GET /api/v1/stats (nil result = not tuned)
+	SyncScope func() *domain.SyncScope
+
+	// PreServeHooks inspect cached copies before share downloads; copies they
+	// refuse are handed to RejectCached (empty = not checked when served)
+	PreServeHooks []port.PreServeHook
+	RejectCached  RejectCachedFunc
+
+	// Expired and revoked shares
+	ExpiredShareGrace  time.Duration      // Keep serving expired shares for this long
+	ShareErrorPage     *template.Template // Rendered with status 410 instead of plain text, see LoadShareErrorPage
+	RedirectGoneShares bool               // Redirect expired/revoked shares to their Synology URL
+
+	// Cache-Control of served files ("" = no header); ProtectedCacheControl
+	// applies to shares with a password or requiring signed links. Shares
+	// may override both (domain.Share.CacheControl).
+	CacheControl          string
+	ProtectedCacheControl string
+
+	// Unknown share tokens are proxied to the NAS when ProxyUnknownShares is set;
+	// SyncTrigger is called so the new share gets recorded and cached
+	ProxyUnknownShares bool
+	SynologyURL        string
+	SynologySkipTLS    bool
+
+	// Passthrough forwards every request the cache does not serve to
+	// SynologyURL, so the server can run on the Synology Drive hostname
+	Passthrough bool
+
+	// Share endpoint abuse protection
+	RateLimitEnabled         bool
+	IPRateLimit              float64 // Requests per second per client IP
+	IPRateBurst              int
+	TokenRateLimit           float64       // Requests per second per share token (0 = not limited)
+	TokenRateBurst           int           // 0 = twice TokenRateLimit
+	PasswordLockoutThreshold int           // Wrong passwords before lockout
+	PasswordLockoutBase      time.Duration // First lockout, doubled on every further failure
+	PasswordLockoutMax       time.Duration
+	TrustProxyHeaders        bool     // Use X-Forwarded-For / X-Real-IP for client IP
+	TrustedProxies           []string // Only honour those headers from these networks, "unix" for socket peers (empty = never)
+
+	// Client networks allowed and denied on the share endpoints, on top of per-share rules
+	ShareAllowedIPs []string // Empty = all
+	ShareDeniedIPs  []string
+
+	// Secret for signed, time-limited share links (empty = disabled)
+	URLSigningSecret string
+
+	// Secret signing the session cookies of password-protected shares
+	// (empty = a random key, sessions end with the process)
+	SessionSecret string
+	SessionCookie SessionCookieConfig
+
+	// UpstreamStatus reports why the NAS cannot be used, nil when it can;
+	// /health then reports the degraded state (nil = not checked)
+	UpstreamStatus func() error
+
+	// Files requested through a share are promoted to this priority, and the
+	// queued download of an uncached one is moved to the front (0 = disabled)
+	BoostPriority int
+
+	// Statistics snapshots for the admin dashboard (nil = sampling disabled)
+	Stats         *stats.Service
+	CacheMaxBytes int64 // Cache size limit shown as the dashboard fill level
+
+	// Cached copies being read, kept from eviction (nil = not tracked)
+	Readers *inuse.Tracker
 }
 
 // DefaultConfig returns default server configuration
 func DefaultConfig() *Config {
 	return &Config{
-		BindAddr:     "0.0.0.0:8080",
-		ReadTimeout:  30 * time.Second,
-		WriteTimeout: 30 * time.Second,
-		IdleTimeout:  60 * time.Second,
+		BindAddrs:                []string{"0.0.0.0:8080"},
+		ReadTimeout:              30 * time.Second,
+		WriteTimeout:             30 * time.Second,
+		IdleTimeout:              60 * time.Second,
+		RateLimitEnabled:         true,
+		IPRateLimit:              50,
+		IPRateBurst:              200,
+		PasswordLockoutThreshold: 5,
+		PasswordLockoutBase:      30 * time.Second,
+		PasswordLockoutMax:       time.Hour,
 	}
 }
 
@@ -37,9 +169,14 @@ type Server struct {
 	store        port.Store
 	logger       *zap.Logger
 	server       *http.Server
+	listeners    []net.Listener
 	fileHandler  *FileHandler
 	adminHandler *AdminHandler
 	debugHandler *DebugHandler
+	taskHandler  *TaskHandler
+	userHandler  *UserHandler
+	auditHandler *AuditHandler
+	shutdown     chan struct{} // Closed on Stop, ends event streams
 }
 
 // New creates a new HTTP server
@@ -48,63 +185,385 @@ func New(cfg *Config, store port.Store, logger *zap.Logger) *Server {
 		cfg = DefaultConfig()
 	}
 
+	// Fill in rate limit defaults
+	defaults := DefaultConfig()
+	if cfg.IPRateLimit <= 0 {
+		cfg.IPRateLimit = defaults.IPRateLimit
+	}
+	if cfg.IPRateBurst <= 0 {
+		cfg.IPRateBurst = defaults.IPRateBurst
+	}
+	if cfg.TokenRateLimit > 0 && cfg.TokenRateBurst <= 0 {
+		cfg.TokenRateBurst = int(math.Ceil(2 * cfg.TokenRateLimit))
+	}
+	if cfg.PasswordLockoutThreshold <= 0 {
+		cfg.PasswordLockoutThreshold = defaults.PasswordLockoutThreshold
+	}
+	if cfg.PasswordLockoutBase <= 0 {
+		cfg.PasswordLockoutBase = defaults.PasswordLockoutBase
+	}
+	if cfg.PasswordLockoutMax <= 0 {
+		cfg.PasswordLockoutMax = defaults.PasswordLockoutMax
+	}
+
 	s := &Server{
-		config: cfg,
-		store:  store,
-		logger: logger,
+		config:   cfg,
+		store:    store,
+		logger:   logger,
+		shutdown: make(chan struct{}),
 	}
 
+	adminPasswordHash := cfg.AdminPasswordHash
+	if adminPasswordHash == "" && cfg.AdminPassword != "" {
+		hashed, err := passhash.Hash(cfg.AdminPassword)
+		if err != nil {
+			logger.Error("failed to hash admin password, admin endpoints will reject all logins", zap.Error(err))
+		}
+		adminPasswordHash = hashed
+	}
+
+	buffers := bufpool.New(cfg.CopyBufferSize)
 	s.fileHandler = NewFileHandler(store, logger)
-	s.adminHandler = NewAdminHandler(store, cfg.AdminUsername, cfg.AdminPassword, cfg.CacheRootDir, logger)
+	s.fileHandler.buffers = buffers
+	s.fileHandler.keys = cfg.EncryptionKeys
+	s.fileHandler.previews = cfg.Previews
+	s.fileHandler.streams = cfg.Streams
+	s.fileHandler.chunks = cfg.Chunks
+	s.fileHandler.partial = cfg.Partial
+	s.fileHandler.boostPriority = cfg.BoostPriority
+	s.fileHandler.readers = cfg.Readers
+	if len(cfg.PreServeHooks) > 0 {
+		s.fileHandler.serveCheck = newServeCheck(cfg.PreServeHooks, cfg.RejectCached, cfg.EncryptionKeys)
+	}
+	if cfg.Stats != nil {
+		s.fileHandler.stats = cfg.Stats.Counters()
+	}
+	s.fileHandler.expiredGrace = cfg.ExpiredShareGrace
+	s.fileHandler.errorPage = cfg.ShareErrorPage
+	s.fileHandler.redirectGone = cfg.RedirectGoneShares
+	s.fileHandler.cacheControl = cfg.CacheControl
+	s.fileHandler.protectedCacheControl = cfg.ProtectedCacheControl
+	s.fileHandler.sessions = newSessionSigner(cfg.SessionSecret)
+	s.fileHandler.sessionCookie = cfg.SessionCookie
+	s.fileHandler.pathPrefix = cfg.PathPrefix
+	var signer *urlsign.Signer
+	if cfg.URLSigningSecret != "" {
+		signer = urlsign.New(cfg.URLSigningSecret)
+		s.fileHandler.signer = signer
+	}
+	if cfg.ProxyUnknownShares {
+		proxy, err := newShareProxy(cfg.SynologyURL, cfg.SynologySkipTLS, cfg.SyncTrigger, logger)
+		if err != nil {
+			logger.Error("share proxy disabled", zap.Error(err))
+		} else {
+			s.fileHandler.proxy = proxy
+		}
+	}
+	if cfg.Passthrough {
+		passthrough, err := newPassthrough(cfg.SynologyURL, cfg.SynologySkipTLS, logger)
+		if err != nil {
+			logger.Error("passthrough disabled", zap.Error(err))
+		} else {
+			s.fileHandler.passthrough = passthrough
+		}
+	}
+	s.adminHandler = NewAdminHandler(store, cfg.CacheRootDir, logger)
+	s.adminHandler.buffers = buffers
+	s.adminHandler.keys = cfg.EncryptionKeys
+	s.adminHandler.readers = cfg.Readers
 	s.debugHandler = NewDebugHandler(store, logger)
+	s.taskHandler = NewTaskHandler(store, logger)
+	s.userHandler = NewUserHandler(store, logger)
+	s.auditHandler = NewAuditHandler(store, logger)
 
 	mux := http.NewServeMux()
 
 	// Health check
 	mux.HandleFunc("/health", s.handleHealth)
 
+	// Client IP resolution; the lists were checked by config validation
+	trust := ProxyTrust{Headers: cfg.TrustProxyHeaders}
+	trustedProxies, trustUnix, err := ipfilter.ParseProxies(cfg.TrustedProxies)
+	if err != nil {
+		logger.Error("invalid trusted proxies, proxy headers will be ignored", zap.Error(err))
+		trust.Headers = false
+	}
+	trust.Proxies = trustedProxies
+	trust.Unix = trustUnix
+	if trust.Headers && trust.Proxies.Empty() && !trust.Unix {
+		logger.Warn("no trusted proxies configured, proxy headers will be ignored")
+	}
+	s.fileHandler.proxyTrust = trust
+
 	// File download endpoints
-	mux.HandleFunc("/f/", s.fileHandler.HandleDownload)
-	mux.HandleFunc("/d/s/", s.fileHandler.HandleSynologyDownload)
+	shareLimit := func(next http.HandlerFunc) http.HandlerFunc { return next }
+	if rules, err := ipfilter.ParseRules(cfg.ShareAllowedIPs, cfg.ShareDeniedIPs); err != nil {
+		logger.Error("invalid share IP lists, share endpoints will refuse all clients", zap.Error(err))
+		shareLimit = func(http.HandlerFunc) http.HandlerFunc {
+			return func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "Access denied", http.StatusForbidden)
+			}
+		}
+	} else if !rules.Empty() {
+		shareLimit = IPFilterMiddleware(rules, trust, logger)
+	}
+	if cfg.RateLimitEnabled {
+		ipFilter := shareLimit
+		ipLimit := RateLimitMiddleware(
+			ratelimiter.NewKeyed(cfg.IPRateLimit, cfg.IPRateBurst),
+			trust.ClientIP,
+			logger)
+		// A link posted to a group or a player seeking through a video sends
+		// many requests for one token, so limiting per token is opt-in
+		tokenLimit := func(next http.HandlerFunc) http.HandlerFunc { return next }
+		if cfg.TokenRateLimit > 0 {
+			tokenLimit = RateLimitMiddleware(
+				ratelimiter.NewKeyed(cfg.TokenRateLimit, cfg.TokenRateBurst),
+				func(r *http.Request) string { return shareTokenFromPath(r.URL.Path) },
+				logger)
+		}
+		shareLimit = func(next http.HandlerFunc) http.HandlerFunc { return ipFilter(ipLimit(tokenLimit(next))) }
+
+		s.fileHandler.lockout = ratelimiter.NewLockout(cfg.PasswordLockoutThreshold, cfg.PasswordLockoutBase, cfg.PasswordLockoutMax)
+	}
+	if cfg.Stats != nil {
+		limit, served := shareLimit, ServedBytesMiddleware(cfg.Stats.Counters())
+		shareLimit = func(next http.HandlerFunc) http.HandlerFunc { return limit(served(next)) }
+	}
+	mux.HandleFunc("/f/", shareLimit(s.fileHandler.HandleDownload))
+	mux.HandleFunc("/d/s/", shareLimit(s.fileHandler.HandleSynologyDownload))
+	mux.HandleFunc("/sharing/", shareLimit(s.fileHandler.HandleFileStationDownload))
+
+	// Admin users from the database plus the built-in config account
+	auth := NewAuthenticator(store, cfg.AdminUsername, adminPasswordHash, logger)
+	auth.lockout = ratelimiter.NewLockout(cfg.PasswordLockoutThreshold, cfg.PasswordLockoutBase, cfg.PasswordLockoutMax)
+	if passhash.NeedsRehash(adminPasswordHash) {
+		logger.Warn("http.admin_password_hash uses an older hash scheme, generate a new one with -hash-password")
+	}
+	viewer := auth.Middleware(domain.RoleViewer)
+	admin := auth.Middleware(domain.RoleAdmin)
 
 	// Admin browser
 	if cfg.EnableAdminBrowser {
-		adminAuth := BasicAuthMiddleware(cfg.AdminUsername, cfg.AdminPassword, logger)
-		mux.HandleFunc("/admin/browse", adminAuth(s.adminHandler.HandleBrowse))
-		mux.HandleFunc("/admin/browse/", adminAuth(s.adminHandler.HandleBrowse))
+		mux.HandleFunc("/admin/browse", viewer(s.adminHandler.HandleBrowse))
+		mux.HandleFunc("/admin/browse/", viewer(s.adminHandler.HandleBrowse))
 		mux.HandleFunc("/admin/logout", s.adminHandler.HandleLogout)
 	}
 
-	// Debug endpoints
+	// Admin JSON API (per-endpoint roles are checked by the handlers)
+	if cfg.EnableAdminAPI {
+		s.taskHandler.live = cfg.Events != nil
+		mux.HandleFunc("/api/v1/tasks/", viewer(s.taskHandler.HandleTasks))
+		mux.HandleFunc("/admin/downloads", viewer(s.taskHandler.HandleDownloadsPage))
+		dashboardHandler := NewDashboardHandler(store, cfg.Stats, cfg.CacheMaxBytes, logger)
+		dashboardHandler.live = cfg.Events != nil
+		dashboardHandler.scope = cfg.SyncScope
+		mux.HandleFunc("/admin/dashboard", viewer(dashboardHandler.HandleDashboard))
+		mux.HandleFunc("/api/v1/stats", viewer(dashboardHandler.HandleStats))
+		mux.HandleFunc("/api/v1/users", admin(s.userHandler.HandleUsers))
+		mux.HandleFunc("/api/v1/users/", admin(s.userHandler.HandleUsers))
+		mux.HandleFunc("/api/v1/tokens", viewer(s.userHandler.HandleTokens))
+		mux.HandleFunc("/api/v1/tokens/", viewer(s.userHandler.HandleTokens))
+		mux.HandleFunc("/api/v1/audit", admin(s.auditHandler.HandleAudit))
+		searchHandler := NewSearchHandler(store, logger)
+		mux.HandleFunc("/api/v1/files/search", viewer(searchHandler.HandleSearch))
+		mux.HandleFunc("/api/v1/files/missing", viewer(searchHandler.HandleMissingUpstream))
+		labelHandler := NewLabelHandler(store, logger)
+		mux.HandleFunc("/api/v1/labels", viewer(labelHandler.HandleLabels))
+		mux.HandleFunc("/api/v1/labels/", viewer(labelHandler.HandleLabels))
+		mux.HandleFunc("/admin/labels", viewer(labelHandler.HandleLabelsPage))
+		mux.HandleFunc("/admin/labels/", viewer(labelHandler.HandleLabelsPage))
+		preseedHandler := NewPreseedHandler(store, cfg.PreseedPaths, cfg.PreseedTrigger, logger)
+		mux.HandleFunc("/api/v1/preseed", viewer(preseedHandler.HandlePreseed))
+		mux.HandleFunc("/api/v1/preseed/", viewer(preseedHandler.HandlePreseed))
+		shareHandler := NewShareHandler(store, logger)
+		shareHandler.signer = signer
+		shareHandler.create = cfg.CreateShare
+		shareHandler.pathPrefix = cfg.PathPrefix
+		mux.HandleFunc("/api/v1/shares", viewer(shareHandler.HandleShares))
+		mux.HandleFunc("/api/v1/shares/", viewer(shareHandler.HandleShares))
+		syncHandler := NewSyncHandler(cfg.SyncTrigger, cfg.SyncDryRun, logger)
+		mux.HandleFunc("/api/v1/sync", viewer(syncHandler.HandleSync))
+		cacheHandler := NewCacheHandler(store, cfg.CacheRequest, logger)
+		mux.HandleFunc("/api/v1/cache", viewer(cacheHandler.HandleCache))
+		if cfg.Workers != nil {
+			workerHandler := NewWorkerHandler(cfg.Workers, logger)
+			mux.HandleFunc("/api/v1/workers", viewer(workerHandler.HandleWorkers))
+		}
+		if cfg.Backups != nil {
+			backupHandler := NewBackupHandler(store, cfg.Backups, logger)
+			mux.HandleFunc("/api/v1/backups", admin(backupHandler.HandleBackups))
+			mux.HandleFunc("/api/v1/backups/", admin(backupHandler.HandleBackups))
+		}
+		if cfg.Metadata != nil {
+			metadataHandler := NewMetadataHandler(store, cfg.Metadata, logger)
+			mux.HandleFunc("/api/v1/metadata/", admin(metadataHandler.HandleMetadata))
+		}
+		if cfg.Events != nil {
+			eventsHandler := NewEventsHandler(cfg.Events, s.shutdown, logger)
+			mux.HandleFunc("/api/v1/events", viewer(eventsHandler.HandleEvents))
+		}
+		if cfg.ReplicaReceiver != nil {
+			replicaHandler := NewReplicaHandler(cfg.ReplicaReceiver, logger)
+			mux.HandleFunc("/api/v1/replica/objects", admin(replicaHandler.HandleObjects))
+			mux.HandleFunc("/api/v1/replica/objects/", admin(replicaHandler.HandleObjects))
+		}
+	}
+
+	// Features this server was built without say so instead of a bare 404
+	if cfg.Unsupported != "" {
+		s.fileHandler.unsupported = cfg.Unsupported
+		if !cfg.EnableAdminBrowser {
+			mux.HandleFunc("/admin/browse", unsupportedHandler("Admin browser", cfg.Unsupported))
+			mux.HandleFunc("/admin/browse/", unsupportedHandler("Admin browser", cfg.Unsupported))
+		}
+		if cfg.EnableAdminAPI {
+			if cfg.Backups == nil {
+				mux.HandleFunc("/api/v1/backups", unsupportedHandler("Backups", cfg.Unsupported))
+				mux.HandleFunc("/api/v1/backups/", unsupportedHandler("Backups", cfg.Unsupported))
+			}
+			if cfg.Events == nil {
+				mux.HandleFunc("/api/v1/events", unsupportedHandler("Event stream", cfg.Unsupported))
+			}
+			if cfg.ReplicaReceiver == nil {
+				mux.HandleFunc("/api/v1/replica/objects", unsupportedHandler("Replication", cfg.Unsupported))
+				mux.HandleFunc("/api/v1/replica/objects/", unsupportedHandler("Replication", cfg.Unsupported))
+			}
+		}
+	}
+
+	// Drive change notifications
+	if cfg.WebhookSecret != "" && cfg.SyncTrigger != nil && cfg.DriveChanges != nil {
+		webhookHandler := NewWebhookHandler(cfg.WebhookSecret, cfg.DriveChanges, cfg.SyncTrigger, logger)
+		mux.HandleFunc("/webhook/drive", webhookHandler.HandleDriveWebhook)
+	}
+
+	// Debug endpoints; the admin dashboard replaces the statistics when the admin API is on
 	mux.HandleFunc("/debug/files", s.debugHandler.HandleFiles)
-	mux.HandleFunc("/debug/stats", s.debugHandler.HandleStats)
+	if cfg.EnableAdminAPI {
+		mux.Handle("/debug/stats", http.RedirectHandler("/admin/dashboard", http.StatusMovedPermanently))
+	} else {
+		mux.HandleFunc("/debug/stats", s.debugHandler.HandleStats)
+	}
+
+	// Everything else belongs to DSM in passthrough mode
+	if s.fileHandler.passthrough != nil {
+		mux.Handle("/", s.fileHandler.passthrough)
+	}
+
+	var handler http.Handler = mux
+	if cfg.CompressionEnabled {
+		handler = CompressionMiddleware()(handler)
+	}
+	if cfg.CORS.Enabled() {
+		handler = CORSMiddleware(cfg.CORS)(handler)
+	}
+
+	handler = LoggingMiddleware(logger)(handler)
+	if cfg.AccessLog != nil {
+		handler = AccessLogMiddleware(cfg.AccessLog, cfg.AccessLogFormat, trust)(handler)
+	}
+	handler = ClientIPMiddleware(trust)(handler)
+	handler = RequestIDMiddleware(logger)(handler)
+
+	// Namespaces are Servers of their own with the whole middleware stack, so
+	// their requests skip this one's
+	if cfg.Namespaces != nil {
+		handler = routeNamespaces(cfg.Namespaces, handler)
+	}
 
 	s.server = &http.Server{
-		Addr:         cfg.BindAddr,
-		Handler:      LoggingMiddleware(logger)(mux),
+		Handler:      handler,
 		ReadTimeout:  cfg.ReadTimeout,
 		WriteTimeout: cfg.WriteTimeout,
 		IdleTimeout:  cfg.IdleTimeout,
 	}
+	// Shutdown waits for open requests; event streams would never end
+	s.server.RegisterOnShutdown(func() { close(s.shutdown) })
+
+	s.listeners = cfg.Listeners
 
 	return s
 }
 
-// Start starts the HTTP server
+// routeNamespaces sends requests below /t/ to namespaces and everything else to next
+func routeNamespaces(namespaces, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/t/") {
+			namespaces.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// unsupportedHandler answers 501 for a feature the server was built without
+func unsupportedHandler(feature, reason string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, feature+" "+reason, http.StatusNotImplemented)
+	}
+}
+
+// Handler returns the handler serving requests, with its middleware, for
+// mounting the server below another one
+func (s *Server) Handler() http.Handler {
+	return s.server.Handler
+}
+
+// Listen binds the configured addresses unless listeners were provided.
+// Calling it before Start lets bind errors surface synchronously.
+func (s *Server) Listen() error {
+	if len(s.listeners) > 0 {
+		return nil
+	}
+	listeners, err := listen(s.config.BindAddrs)
+	if err != nil {
+		return err
+	}
+	s.listeners = listeners
+	return nil
+}
+
+// Start serves on all listeners until Stop; it returns the first serve error
 func (s *Server) Start() error {
-	s.logger.Info("starting HTTP server", zap.String("addr", s.server.Addr))
-	if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+	if err := s.Listen(); err != nil {
 		return err
 	}
+
+	errCh := make(chan error, len(s.listeners))
+	for _, l := range s.listeners {
+		s.logger.Info("starting HTTP server", zap.String("addr", l.Addr().String()))
+		go func(l net.Listener) {
+			errCh <- s.server.Serve(l)
+		}(l)
+	}
+
+	for range s.listeners {
+		if err := <-errCh; err != nil && err != http.ErrServerClosed {
+			return err
+		}
+	}
 	return nil
 }
 
+// CheckHealth reports whether the server can answer requests
+func (s *Server) CheckHealth() error {
+	return s.store.Ping()
+}
+
 // Stop gracefully stops the HTTP server
 func (s *Server) Stop(ctx context.Context) error {
 	s.logger.Info("stopping HTTP server")
 	return s.server.Shutdown(ctx)
 }
 
+// healthResponse is the body of /health
+type healthResponse struct {
+	Status        string `json:"status"` // healthy or degraded
+	Time          string `json:"time"`
+	UpstreamError string `json:"upstream_error,omitempty"`
+}
+
 // handleHealth handles health check requests
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -112,12 +571,20 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := s.store.Ping(); err != nil {
-		s.logger.Error("health check failed", zap.Error(err))
+	if err := s.CheckHealth(); err != nil {
+		reqLogger(r, s.logger).Error("health check failed", zap.Error(err))
 		http.Error(w, "Database connection failed", http.StatusServiceUnavailable)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte(`{"status":"healthy","time":"` + time.Now().Format(time.RFC3339) + `"}`))
+	// Cached content is still served while the NAS is down, so degraded
+	// is reported with 200 to keep the instance in load balancer rotation
+	resp := healthResponse{Status: "healthy", Time: time.Now().Format(time.RFC3339)}
+	if s.config.UpstreamStatus != nil {
+		if err := s.config.UpstreamStatus(); err != nil {
+			resp.Status = "degraded"
+			resp.UpstreamError = err.Error()
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
 }
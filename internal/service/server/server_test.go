@@ -0,0 +1,179 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vertextoedge/synology-file-cache/internal/adapter/sqlite"
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/service/stats"
+	"github.com/vertextoedge/synology-file-cache/internal/util/reqid"
+	"go.uber.org/zap"
+)
+
+// newTestServer creates a server on a fresh SQLite store
+func newTestServer(t *testing.T, cfg *Config) (*Server, *sqlite.Store) {
+	t.Helper()
+	store, err := sqlite.Open(filepath.Join(t.TempDir(), "cache.db"), sqlite.Options{})
+	if err != nil {
+		t.Fatalf("sqlite.Open() error = %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return New(cfg, store, zap.NewNop()), store
+}
+
+// addCachedShare stores a cached file holding content and a share of it
+func addCachedShare(t *testing.T, store *sqlite.Store, token string, content []byte, password string) *domain.Share {
+	t.Helper()
+	cachePath := filepath.Join(t.TempDir(), token)
+	if err := os.WriteFile(cachePath, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	result, err := store.UpsertBySynoID(&domain.File{
+		SynoFileID: token,
+		Path:       "/mydrive/" + token + ".bin",
+		Size:       int64(len(content)),
+		Priority:   domain.PriorityDefault,
+	})
+	if err != nil {
+		t.Fatalf("UpsertBySynoID() error = %v", err)
+	}
+	file := result.File
+	file.MarkCached(cachePath)
+	if err := store.Update(file); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	share := &domain.Share{SynoShareID: token, Token: token, FileID: file.ID, Password: password}
+	if err := store.CreateShare(share); err != nil {
+		t.Fatalf("CreateShare() error = %v", err)
+	}
+	return share
+}
+
+func TestServer_RangeBurstNotRateLimited(t *testing.T) {
+	cfg := DefaultConfig()
+	srv, store := newTestServer(t, cfg)
+	content := make([]byte, 1<<20)
+	addCachedShare(t, store, "video", content, "")
+	handler := srv.Handler()
+
+	// A player seeking through a video sends a quick run of Range requests
+	const chunk = 4096
+	for i := 0; i < 150; i++ {
+		r := httptest.NewRequest(http.MethodGet, "/f/video", nil)
+		r.RemoteAddr = "198.51.100.2:1234"
+		r.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", i*chunk, (i+1)*chunk-1))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != http.StatusPartialContent {
+			t.Fatalf("request %d: status = %d, want %d", i, w.Code, http.StatusPartialContent)
+		}
+		if w.Body.Len() != chunk {
+			t.Fatalf("request %d: body = %d bytes, want %d", i, w.Body.Len(), chunk)
+		}
+	}
+}
+
+func TestServer_TokenRateLimitOptIn(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.TokenRateLimit = 1
+	cfg.TokenRateBurst = 2
+	srv, store := newTestServer(t, cfg)
+	addCachedShare(t, store, "hot", []byte("hello"), "")
+	handler := srv.Handler()
+
+	codes := make([]int, 3)
+	for i := range codes {
+		r := httptest.NewRequest(http.MethodGet, "/f/hot", nil)
+		r.RemoteAddr = fmt.Sprintf("198.51.100.%d:1234", i+1)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		codes[i] = w.Code
+	}
+	if codes[0] != http.StatusOK || codes[1] != http.StatusOK || codes[2] != http.StatusTooManyRequests {
+		t.Errorf("statuses = %v, want [200 200 429]", codes)
+	}
+}
+
+func TestServer_NamespacesSkipMiddleware(t *testing.T) {
+	var accessLog bytes.Buffer
+	cfg := DefaultConfig()
+	cfg.AccessLog = &accessLog
+	cfg.CompressionEnabled = true
+	var served string
+	cfg.Namespaces = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served = r.URL.Path
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(strings.Repeat("namespace ", 500)))
+	})
+	srv, _ := newTestServer(t, cfg)
+	handler := srv.Handler()
+
+	r := httptest.NewRequest(http.MethodGet, "/t/design/health", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := serve(handler, r)
+	if served != "/t/design/health" {
+		t.Fatalf("namespace served %q, want /t/design/health", served)
+	}
+	// The namespace's own server logs, compresses and tags the request
+	if w.Header().Get("Content-Encoding") != "" || w.Header().Get(reqid.Header) != "" {
+		t.Errorf("main middleware ran on a namespace request, headers = %v", w.Header())
+	}
+	if accessLog.Len() != 0 {
+		t.Errorf("main access log = %q, want nothing", accessLog.String())
+	}
+
+	serve(handler, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if !strings.Contains(accessLog.String(), "/health") {
+		t.Errorf("main access log = %q, want the /health request", accessLog.String())
+	}
+}
+
+// readFromRecorder records whether a response body reached ReadFrom, which
+// net/http's writer implements with sendfile
+type readFromRecorder struct {
+	*httptest.ResponseRecorder
+	readFrom bool
+}
+
+func (w *readFromRecorder) ReadFrom(src io.Reader) (int64, error) {
+	w.readFrom = true
+	return io.Copy(w.ResponseRecorder, src)
+}
+
+func TestServer_CachedFilesReachReadFrom(t *testing.T) {
+	store, err := sqlite.Open(filepath.Join(t.TempDir(), "cache.db"), sqlite.Options{})
+	if err != nil {
+		t.Fatalf("sqlite.Open() error = %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	// Every writer wrapper a share download passes through
+	cfg := DefaultConfig()
+	cfg.CompressionEnabled = true
+	cfg.AccessLog = io.Discard
+	cfg.RateLimitEnabled = true
+	cfg.Stats = stats.New(nil, store, zap.NewNop())
+	content := bytes.Repeat([]byte{0xff, 0x00}, 32<<10)
+	addCachedShare(t, store, "video", content, "")
+	handler := New(cfg, store, zap.NewNop()).Handler()
+
+	w := &readFromRecorder{ResponseRecorder: httptest.NewRecorder()}
+	r := httptest.NewRequest(http.MethodGet, "/f/video", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), content) {
+		t.Fatalf("status = %d, body %d bytes; want 200 with the file", w.Code, w.Body.Len())
+	}
+	if !w.readFrom {
+		t.Error("cached file was copied without reaching ReadFrom, so sendfile cannot run")
+	}
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"go.uber.org/zap"
+)
+
+// Reasons a share can no longer be served, passed to the error page as .Reason
+const (
+	shareGoneExpired       = "expired"
+	shareGoneRevoked       = "revoked"
+	shareGoneDownloadLimit = "download_limit"
+)
+
+// defaultShareErrorPage is used when http.share_error_page is "default"
+var defaultShareErrorPage = template.Must(template.New("share_error").Parse(`<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>{{.Title}}</title>
+    <style>
+        body { font-family: sans-serif; margin: 0; background-color: #f5f5f5; color: #333; }
+        .box { max-width: 480px; margin: 80px auto; padding: 32px; background-color: #fff; border-radius: 8px; box-shadow: 0 1px 4px rgba(0,0,0,0.1); }
+        h1 { font-size: 22px; font-weight: normal; margin-top: 0; }
+        p { color: #666; line-height: 1.5; }
+    </style>
+</head>
+<body>
+    <div class="box">
+        <h1>{{.Title}}</h1>
+        <p>{{.Message}}</p>
+        {{if .ExpiresAt}}<p>Expired on {{.ExpiresAt.Local.Format "2006-01-02 15:04"}}.</p>{{end}}
+    </div>
+</body>
+</html>`))
+
+// shareErrorData is passed to share error page templates
+type shareErrorData struct {
+	Status    int
+	Reason    string // "expired", "revoked" or "download_limit"
+	Title     string
+	Message   string
+	Token     string
+	ExpiresAt *time.Time
+}
+
+// LoadShareErrorPage returns the page rendered for expired, revoked and used up shares:
+// nil for "" (plain text), the built-in page for "default", otherwise the
+// html/template at path. Templates receive Status, Reason, Title, Message,
+// Token and ExpiresAt.
+func LoadShareErrorPage(path string) (*template.Template, error) {
+	switch path {
+	case "":
+		return nil, nil
+	case "default":
+		return defaultShareErrorPage, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read share error page: %w", err)
+	}
+	tmpl, err := template.New("share_error").Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse share error page: %w", err)
+	}
+	return tmpl, nil
+}
+
+// inGrace reports whether an expired share is still served because it expired
+// less than the configured grace period ago
+func (h *FileHandler) inGrace(share *domain.Share) bool {
+	return h.expiredGrace > 0 && share.ExpiresAt.Add(h.expiredGrace).After(time.Now())
+}
+
+// shareGone responds to a request for an expired, revoked or used up share: a
+// redirect to the share on the NAS if enabled and known, else the error page or text
+func (h *FileHandler) shareGone(w http.ResponseWriter, r *http.Request, share *domain.Share, reason string) {
+	if h.redirectGone {
+		if target := share.URL; target != "" {
+			http.Redirect(w, r, target, http.StatusFound)
+			return
+		}
+	}
+
+	data := shareErrorData{
+		Status: http.StatusGone,
+		Reason: reason,
+		Token:  share.Token,
+	}
+	switch reason {
+	case shareGoneExpired:
+		data.Title = "Share has expired"
+		data.Message = "This link is no longer available. Ask the owner for a new link."
+		data.ExpiresAt = share.ExpiresAt
+	case shareGoneDownloadLimit:
+		data.Title = "Download limit reached"
+		data.Message = "This link has been downloaded the maximum number of times. Ask the owner for a new link."
+	default:
+		data.Title = "Share has been revoked"
+		data.Message = "The owner has stopped sharing this file."
+	}
+
+	if h.errorPage == nil {
+		http.Error(w, data.Title, http.StatusGone)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusGone)
+	if err := h.errorPage.Execute(w, data); err != nil {
+		reqLogger(r, h.logger).Error("failed to render share error page", zap.String("token", share.Token), zap.Error(err))
+	}
+}
@@ -0,0 +1,413 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"github.com/vertextoedge/synology-file-cache/internal/util/cachecontrol"
+	"github.com/vertextoedge/synology-file-cache/internal/util/ipfilter"
+	"github.com/vertextoedge/synology-file-cache/internal/util/urlsign"
+	"go.uber.org/zap"
+)
+
+// ShareHandler handles requests inspecting and adjusting shares
+type ShareHandler struct {
+	store  port.Store
+	logger *zap.Logger
+
+	// Mints signed, time-limited share links (nil = disabled)
+	signer *urlsign.Signer
+
+	// Creates shares on the NAS for POST /api/v1/shares (nil = disabled)
+	create CreateShareFunc
+
+	// Prepended to the share links returned (namespaces)
+	pathPrefix string
+}
+
+// CreateShareFunc creates a sharing link to a file on the NAS, records it
+// locally and enqueues the file's download. The task is nil when the file is
+// already cached.
+type CreateShareFunc func(ctx context.Context, path string, expiresAt *time.Time) (*domain.Share, *domain.DownloadTask, error)
+
+const (
+	defaultSignedLinkTTL = 24 * time.Hour
+	maxSignedLinkTTL     = 30 * 24 * time.Hour
+)
+
+// NewShareHandler creates a new ShareHandler
+func NewShareHandler(store port.Store, logger *zap.Logger) *ShareHandler {
+	return &ShareHandler{
+		store:  store,
+		logger: logger,
+	}
+}
+
+// shareResponse is the JSON representation of a share. Passwords are never returned.
+type shareResponse struct {
+	Token            string   `json:"token"`
+	FileID           int64    `json:"file_id"`
+	Revoked          bool     `json:"revoked"`
+	Expired          bool     `json:"expired"`
+	HasPassword      bool     `json:"has_password"`
+	MaxDownloads     int      `json:"max_downloads"`     // Local override: 0 = NAS limit, negative = unlimited
+	NASMaxDownloads  int      `json:"nas_max_downloads"` // Limit synced from the NAS (0 = unlimited)
+	DownloadLimit    int      `json:"download_limit"`    // Limit in effect (0 = unlimited)
+	DownloadCount    int64    `json:"download_count"`
+	AllowedIPs       []string `json:"allowed_ips"`
+	DeniedIPs        []string `json:"denied_ips"`
+	RequireSignature bool     `json:"require_signature"` // Only signed links are served
+	CacheControl     string   `json:"cache_control"`     // Overrides the global policy when set
+}
+
+// HandleShares routes /api/v1/shares requests. Reading requires the viewer
+// role, changes require operator.
+//
+//	POST  /api/v1/shares                      share {"path"} on the NAS, expiring at
+//	                                          {"expires_at"}, and cache it
+//	GET   /api/v1/shares/{token}              show a share with its download count and limits
+//	PATCH /api/v1/shares/{token}              set the local download limit {"max_downloads"},
+//	                                          client IP rules {"allowed_ips", "denied_ips"}
+//	                                          {"require_signature"} and {"cache_control"}
+//	                                          ("" = global policy)
+//	POST  /api/v1/shares/{token}/signed-link  mint a signed link valid for {"ttl"}
+func (h *ShareHandler) HandleShares(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/shares"), "/")
+	parts := strings.Split(path, "/")
+	token := parts[0]
+	if token == "" && r.Method == http.MethodPost {
+		h.handleCreate(w, r)
+		return
+	}
+	if token == "" || len(parts) > 2 {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	switch {
+	case len(parts) == 2 && parts[1] == "signed-link" && r.Method == http.MethodPost:
+		h.handleSignedLink(w, r, token)
+	case len(parts) == 2:
+		http.Error(w, "Not found", http.StatusNotFound)
+	case r.Method == http.MethodGet:
+		h.handleGet(w, r, token)
+	case r.Method == http.MethodPatch:
+		h.handleUpdate(w, r, token)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// createShareResponse is the JSON representation of a share created on the NAS
+type createShareResponse struct {
+	Token     string     `json:"token"`
+	URL       string     `json:"url"`     // Local link served by the cache
+	NASURL    string     `json:"nas_url"` // Sharing link on the NAS
+	FileID    int64      `json:"file_id"`
+	Path      string     `json:"path"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Status    string     `json:"status"` // cached, pending or in_progress
+	TaskID    int64      `json:"task_id,omitempty"`
+}
+
+// handleCreate shares a file on the NAS and caches it, returning the local link
+func (h *ShareHandler) handleCreate(w http.ResponseWriter, r *http.Request) {
+	if !requireRole(w, r, domain.RoleOperator) {
+		return
+	}
+	if h.create == nil {
+		http.Error(w, "Share creation not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	var req struct {
+		Path      string     `json:"path"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !strings.HasPrefix(req.Path, "/") {
+		http.Error(w, "path must be an absolute Drive path", http.StatusBadRequest)
+		return
+	}
+	filePath := path.Clean(req.Path)
+
+	share, task, err := h.create(r.Context(), filePath, req.ExpiresAt)
+	if err != nil {
+		writeUpstreamError(w, r, h.logger, "failed to create share", filePath, err)
+		return
+	}
+
+	resp := createShareResponse{
+		Token:     share.Token,
+		URL:       h.pathPrefix + "/f/" + url.PathEscape(share.Token),
+		NASURL:    share.URL,
+		FileID:    share.FileID,
+		Path:      filePath,
+		ExpiresAt: share.ExpiresAt,
+		Status:    "cached",
+	}
+	details := map[string]string{"source": "api", "path": filePath}
+	if task != nil {
+		resp.Status = task.Status
+		resp.TaskID = task.ID
+	}
+	if share.ExpiresAt != nil {
+		details["expires_at"] = share.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+
+	recordAudit(h.store, h.logger, r, domain.AuditActionShareCreate, "share:"+share.Token, details)
+	reqLogger(r, h.logger).Info("share created",
+		zap.String("token", share.Token),
+		zap.String("path", filePath),
+		zap.String("status", resp.Status),
+		zap.String("by", actorName(r)))
+
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+// handleGet returns a share
+func (h *ShareHandler) handleGet(w http.ResponseWriter, r *http.Request, token string) {
+	share, err := h.store.GetShareByToken(token)
+	if err != nil {
+		reqLogger(r, h.logger).Error("failed to get share", zap.String("token", token), zap.Error(err))
+		http.Error(w, "Failed to get share", http.StatusInternalServerError)
+		return
+	}
+	if share == nil {
+		http.Error(w, "Share not found", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, toShareResponse(share))
+}
+
+// handleUpdate sets the local download limit, IP rules, signature requirement
+// and Cache-Control of a share.
+// Fields left out of the body are not changed.
+func (h *ShareHandler) handleUpdate(w http.ResponseWriter, r *http.Request, token string) {
+	if !requireRole(w, r, domain.RoleOperator) {
+		return
+	}
+
+	var req struct {
+		MaxDownloads     *int     `json:"max_downloads"`
+		AllowedIPs       []string `json:"allowed_ips"`
+		DeniedIPs        []string `json:"denied_ips"`
+		RequireSignature *bool    `json:"require_signature"`
+		CacheControl     *string  `json:"cache_control"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	setIPs := req.AllowedIPs != nil || req.DeniedIPs != nil
+	if req.MaxDownloads == nil && !setIPs && req.RequireSignature == nil && req.CacheControl == nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.CacheControl != nil {
+		*req.CacheControl = strings.TrimSpace(*req.CacheControl)
+		if *req.CacheControl != "" {
+			if err := cachecontrol.Validate(*req.CacheControl); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	var allowed, denied []string
+	if setIPs {
+		share, err := h.store.GetShareByToken(token)
+		if err != nil {
+			reqLogger(r, h.logger).Error("failed to get share", zap.String("token", token), zap.Error(err))
+			http.Error(w, "Failed to update share", http.StatusInternalServerError)
+			return
+		}
+		if share == nil {
+			http.Error(w, "Share not found", http.StatusNotFound)
+			return
+		}
+
+		allowed, denied = share.AllowedIPs, share.DeniedIPs
+		if req.AllowedIPs != nil {
+			allowed = trimEntries(req.AllowedIPs)
+		}
+		if req.DeniedIPs != nil {
+			denied = trimEntries(req.DeniedIPs)
+		}
+		if _, err := ipfilter.ParseRules(allowed, denied); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if req.MaxDownloads != nil {
+		if !h.update(w, r, token, h.store.SetShareMaxDownloads(token, *req.MaxDownloads)) {
+			return
+		}
+		recordAudit(h.store, h.logger, r, domain.AuditActionShareLimit, "share:"+token, map[string]string{
+			"max_downloads": strconv.Itoa(*req.MaxDownloads),
+		})
+		reqLogger(r, h.logger).Info("share download limit set",
+			zap.String("token", token),
+			zap.Int("max_downloads", *req.MaxDownloads),
+			zap.String("by", actorName(r)))
+	}
+
+	if setIPs {
+		if !h.update(w, r, token, h.store.SetShareIPRules(token, allowed, denied)) {
+			return
+		}
+		recordAudit(h.store, h.logger, r, domain.AuditActionShareIPRules, "share:"+token, map[string]string{
+			"allowed_ips": domain.EncodeLabels(allowed),
+			"denied_ips":  domain.EncodeLabels(denied),
+		})
+		reqLogger(r, h.logger).Info("share IP rules set",
+			zap.String("token", token),
+			zap.Strings("allowed_ips", allowed),
+			zap.Strings("denied_ips", denied),
+			zap.String("by", actorName(r)))
+	}
+
+	if req.RequireSignature != nil {
+		if !h.update(w, r, token, h.store.SetShareRequireSignature(token, *req.RequireSignature)) {
+			return
+		}
+		recordAudit(h.store, h.logger, r, domain.AuditActionShareSignature, "share:"+token, map[string]string{
+			"require_signature": strconv.FormatBool(*req.RequireSignature),
+		})
+		reqLogger(r, h.logger).Info("share signature requirement set",
+			zap.String("token", token),
+			zap.Bool("require_signature", *req.RequireSignature),
+			zap.String("by", actorName(r)))
+	}
+
+	if req.CacheControl != nil {
+		if !h.update(w, r, token, h.store.SetShareCacheControl(token, *req.CacheControl)) {
+			return
+		}
+		recordAudit(h.store, h.logger, r, domain.AuditActionShareCaching, "share:"+token, map[string]string{
+			"cache_control": *req.CacheControl,
+		})
+		reqLogger(r, h.logger).Info("share cache control set",
+			zap.String("token", token),
+			zap.String("cache_control", *req.CacheControl),
+			zap.String("by", actorName(r)))
+	}
+
+	h.handleGet(w, r, token)
+}
+
+// handleSignedLink mints a signed link to a share that expires after the
+// requested TTL (default 24h, at most 30 days)
+func (h *ShareHandler) handleSignedLink(w http.ResponseWriter, r *http.Request, token string) {
+	if !requireRole(w, r, domain.RoleOperator) {
+		return
+	}
+	if h.signer == nil {
+		http.Error(w, "Signed links disabled", http.StatusNotFound)
+		return
+	}
+
+	var req struct {
+		TTL string `json:"ttl"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	ttl := defaultSignedLinkTTL
+	if req.TTL != "" {
+		d, err := time.ParseDuration(req.TTL)
+		if err != nil || d <= 0 || d > maxSignedLinkTTL {
+			http.Error(w, "ttl must be a positive duration of at most 720h", http.StatusBadRequest)
+			return
+		}
+		ttl = d
+	}
+
+	share, err := h.store.GetShareByToken(token)
+	if err != nil {
+		reqLogger(r, h.logger).Error("failed to get share", zap.String("token", token), zap.Error(err))
+		http.Error(w, "Failed to get share", http.StatusInternalServerError)
+		return
+	}
+	if share == nil {
+		http.Error(w, "Share not found", http.StatusNotFound)
+		return
+	}
+
+	expires := time.Now().Add(ttl).Truncate(time.Second)
+	link := h.pathPrefix + "/f/" + url.PathEscape(token) + "?" + h.signer.Sign(token, expires).Encode()
+
+	recordAudit(h.store, h.logger, r, domain.AuditActionShareSignLink, "share:"+token, map[string]string{
+		"expires_at": expires.UTC().Format(time.RFC3339),
+	})
+	reqLogger(r, h.logger).Info("signed share link created",
+		zap.String("token", token),
+		zap.Time("expires_at", expires),
+		zap.String("by", actorName(r)))
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"url":        link,
+		"expires_at": expires.UTC(),
+	})
+}
+
+// update reports whether a share update succeeded, writing the error response otherwise
+func (h *ShareHandler) update(w http.ResponseWriter, r *http.Request, token string, err error) bool {
+	switch {
+	case errors.Is(err, domain.ErrNotFound):
+		http.Error(w, "Share not found", http.StatusNotFound)
+		return false
+	case err != nil:
+		reqLogger(r, h.logger).Error("failed to update share", zap.String("token", token), zap.Error(err))
+		http.Error(w, "Failed to update share", http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// trimEntries trims whitespace and drops empty entries
+func trimEntries(entries []string) []string {
+	result := []string{}
+	for _, entry := range entries {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+// toShareResponse converts a share to its JSON representation
+func toShareResponse(share *domain.Share) shareResponse {
+	return shareResponse{
+		Token:            share.Token,
+		FileID:           share.FileID,
+		Revoked:          share.Revoked,
+		Expired:          share.IsExpired(),
+		HasPassword:      share.HasPassword(),
+		MaxDownloads:     share.MaxDownloads,
+		NASMaxDownloads:  share.NASMaxDownloads,
+		DownloadLimit:    share.DownloadLimit(),
+		DownloadCount:    share.DownloadCount,
+		AllowedIPs:       nonNil(share.AllowedIPs),
+		DeniedIPs:        nonNil(share.DeniedIPs),
+		RequireSignature: share.RequireSignature,
+		CacheControl:     share.CacheControl,
+	}
+}
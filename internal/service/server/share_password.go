@@ -0,0 +1,122 @@
+package server
+
+import (
+	"encoding/json"
+	"html/template"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// maxPasswordBody limits POST bodies carrying a share password
+const maxPasswordBody = 64 << 10
+
+// sharePasswordPage asks browsers for the password of a protected share.
+// The form posts back to the share URL, which redirects to itself once the
+// session cookie is set.
+var sharePasswordPage = template.Must(template.New("share_password").Parse(`<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>Password required</title>
+    <style>
+        body { font-family: sans-serif; margin: 0; background-color: #f5f5f5; color: #333; }
+        .box { max-width: 480px; margin: 80px auto; padding: 32px; background-color: #fff; border-radius: 8px; box-shadow: 0 1px 4px rgba(0,0,0,0.1); }
+        h1 { font-size: 22px; font-weight: normal; margin-top: 0; }
+        p { color: #666; line-height: 1.5; }
+        .error { color: #c62828; }
+        input[type=password] { width: 100%; box-sizing: border-box; padding: 8px; margin: 8px 0 16px; font-size: 16px; }
+        button { padding: 8px 24px; font-size: 16px; }
+    </style>
+</head>
+<body>
+    <div class="box">
+        <h1>Password required</h1>
+        <p>This shared file is protected by a password.</p>
+        {{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+        <form method="post" action="{{.Action}}">
+            <input type="password" name="password" autofocus required autocomplete="current-password">
+            <button type="submit">Open</button>
+        </form>
+    </div>
+</body>
+</html>`))
+
+// sharePassword returns the password sent with a request: Basic auth, the
+// password query parameter, or a POST body as JSON ({"password": "..."}) or
+// form. form reports a browser form submission.
+func sharePassword(w http.ResponseWriter, r *http.Request) (password string, form, ok bool) {
+	if _, password, ok := r.BasicAuth(); ok {
+		return password, false, true
+	}
+	if query := r.URL.Query(); query.Has("password") {
+		return query.Get("password"), false, true
+	}
+	if r.Method != http.MethodPost {
+		return "", false, false
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxPasswordBody)
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/json":
+		var body struct {
+			Password *string `json:"password"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Password == nil {
+			return "", false, false
+		}
+		return *body.Password, false, true
+	case "application/x-www-form-urlencoded", "multipart/form-data":
+		if err := r.ParseMultipartForm(maxPasswordBody); err != nil && err != http.ErrNotMultipart {
+			return "", false, false
+		}
+		if _, ok := r.PostForm["password"]; !ok {
+			return "", false, false
+		}
+		return r.PostForm.Get("password"), true, true
+	}
+	return "", false, false
+}
+
+// wantsHTML reports whether the request comes from a browser that can show the password form
+func wantsHTML(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+// passwordFormAction is the share URL the password form posts to, without a
+// password in the query. It keeps the prefix of a server mounted below the root.
+func (h *FileHandler) passwordFormAction(r *http.Request) string {
+	u := url.URL{Path: h.pathPrefix + r.URL.Path}
+	query := r.URL.Query()
+	query.Del("password")
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// askSharePassword responds with the password form for browsers, a Basic
+// auth challenge for everything else. message is shown on the form.
+func (h *FileHandler) askSharePassword(w http.ResponseWriter, r *http.Request, status int, message string) {
+	if !wantsHTML(r) {
+		if status == http.StatusUnauthorized {
+			w.Header().Set("WWW-Authenticate", `Basic realm="Password Protected Share"`)
+		}
+		http.Error(w, message, status)
+		return
+	}
+
+	data := struct{ Action, Error string }{Action: h.passwordFormAction(r)}
+	if status != http.StatusUnauthorized {
+		data.Error = message
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := sharePasswordPage.Execute(w, data); err != nil {
+		reqLogger(r, h.logger).Error("failed to render share password page", zap.Error(err))
+	}
+}
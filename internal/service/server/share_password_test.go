@@ -0,0 +1,164 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestSharePassword_Methods(t *testing.T) {
+	srv, store := newTestServer(t, nil)
+	addCachedShare(t, store, "locked", []byte("secret"), "pw")
+	handler := srv.Handler()
+
+	jsonPost := func(body string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/f/locked", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		return r
+	}
+	basic := func(password string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/f/locked", nil)
+		r.SetBasicAuth("", password)
+		return r
+	}
+
+	tests := []struct {
+		name string
+		req  *http.Request
+		want int
+	}{
+		{"no password", httptest.NewRequest(http.MethodGet, "/f/locked", nil), http.StatusUnauthorized},
+		{"basic auth", basic("pw"), http.StatusOK},
+		{"wrong basic auth", basic("nope"), http.StatusForbidden},
+		{"query", httptest.NewRequest(http.MethodGet, "/f/locked?password=pw", nil), http.StatusOK},
+		{"wrong query", httptest.NewRequest(http.MethodGet, "/f/locked?password=nope", nil), http.StatusForbidden},
+		{"JSON body", jsonPost(`{"password": "pw"}`), http.StatusOK},
+		{"wrong JSON body", jsonPost(`{"password": "nope"}`), http.StatusForbidden},
+		{"JSON body without password", jsonPost(`{}`), http.StatusUnauthorized},
+		{"malformed JSON body", jsonPost(`{"password":`), http.StatusUnauthorized},
+		{"HEAD with query", httptest.NewRequest(http.MethodHead, "/f/locked?password=pw", nil), http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := serve(handler, tt.req)
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.want)
+			continue
+		}
+		switch {
+		case w.Code == http.StatusUnauthorized:
+			if w.Header().Get("WWW-Authenticate") == "" {
+				t.Errorf("%s: no Basic auth challenge", tt.name)
+			}
+		case w.Code == http.StatusOK && tt.req.Method == http.MethodHead:
+			if w.Body.Len() != 0 || w.Header().Get("Content-Length") != "6" {
+				t.Errorf("%s: body = %q, Content-Length = %q", tt.name, w.Body.String(), w.Header().Get("Content-Length"))
+			}
+		case w.Code == http.StatusOK:
+			if w.Body.String() != "secret" {
+				t.Errorf("%s: body = %q, want the file", tt.name, w.Body.String())
+			}
+		}
+	}
+}
+
+func TestSharePassword_Form(t *testing.T) {
+	srv, store := newTestServer(t, nil)
+	addCachedShare(t, store, "locked", []byte("secret"), "pw")
+	handler := srv.Handler()
+
+	// Browsers get the form, posting back to the share URL without the password
+	r := httptest.NewRequest(http.MethodGet, "/f/locked?dl=1&password=nope", nil)
+	r.Header.Set("Accept", "text/html,application/xhtml+xml")
+	w := serve(handler, r)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("form status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("form Content-Type = %q, want text/html", ct)
+	}
+	if w.Header().Get("WWW-Authenticate") != "" {
+		t.Error("form response carries a Basic auth challenge")
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, `action="/f/locked?dl=1"`) || !strings.Contains(body, "Invalid password") {
+		t.Errorf("form body = %s", body)
+	}
+
+	post := func(password string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/f/locked?dl=1", strings.NewReader(url.Values{"password": {password}}.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("Accept", "text/html")
+		return serve(handler, r)
+	}
+
+	if w := post("nope"); w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "<form") {
+		t.Errorf("wrong form password: status = %d, want %d with the form", w.Code, http.StatusForbidden)
+	}
+
+	// The right password opens a session and redirects back to the share
+	w = post("pw")
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("form post status = %d, want %d", w.Code, http.StatusSeeOther)
+	}
+	if loc := w.Header().Get("Location"); loc != "/f/locked?dl=1" {
+		t.Errorf("Location = %q, want /f/locked?dl=1", loc)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("cookies = %v, want a session cookie", cookies)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/f/locked?dl=1", nil)
+	r.AddCookie(cookies[0])
+	if w := serve(handler, r); w.Code != http.StatusOK || w.Body.String() != "secret" {
+		t.Errorf("with session: status = %d, body = %q", w.Code, w.Body.String())
+	}
+}
+
+func TestSharePassword_FormBelowPrefix(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.PathPrefix = "/t/design"
+	srv, store := newTestServer(t, cfg)
+	addCachedShare(t, store, "locked", []byte("secret"), "pw")
+	// Mounted the way namespaces are
+	handler := http.StripPrefix("/t/design", srv.Handler())
+
+	r := httptest.NewRequest(http.MethodGet, "/t/design/f/locked?dl=1", nil)
+	r.Header.Set("Accept", "text/html")
+	w := serve(handler, r)
+	if body := w.Body.String(); !strings.Contains(body, `action="/t/design/f/locked?dl=1"`) {
+		t.Errorf("form body = %s", body)
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/t/design/f/locked?dl=1", strings.NewReader(url.Values{"password": {"pw"}}.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("Accept", "text/html")
+	w = serve(handler, r)
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("form post status = %d, want %d", w.Code, http.StatusSeeOther)
+	}
+	if loc := w.Header().Get("Location"); loc != "/t/design/f/locked?dl=1" {
+		t.Errorf("Location = %q, want /t/design/f/locked?dl=1", loc)
+	}
+}
+
+func TestSharePassword_Lockout(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.PasswordLockoutThreshold = 2
+	srv, store := newTestServer(t, cfg)
+	addCachedShare(t, store, "locked", []byte("secret"), "pw")
+	handler := srv.Handler()
+
+	for i := 0; i < 2; i++ {
+		serve(handler, httptest.NewRequest(http.MethodGet, "/f/locked?password=nope", nil))
+	}
+	w := serve(handler, httptest.NewRequest(http.MethodGet, "/f/locked?password=pw", nil))
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("status while locked out = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("locked out response has no Retry-After")
+	}
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// shareProxySyncGap is the minimum time between syncs requested for unknown tokens
+	shareProxySyncGap = 30 * time.Second
+
+	// shareProxyRemember is how long a proxied token does not request another sync
+	shareProxyRemember = 10 * time.Minute
+)
+
+// shareProxy forwards requests for share tokens that are not in the database
+// yet (e.g. links created after the last sync) to the NAS, and requests a sync
+// so the share is recorded and its file cached for the next request
+type shareProxy struct {
+	proxy   *httputil.ReverseProxy
+	trigger func() // Requests an incremental sync, may be nil
+	logger  *zap.Logger
+
+	mu       sync.Mutex
+	lastSync time.Time
+	recent   map[string]time.Time // Recently proxied tokens
+}
+
+// newShareProxy creates a proxy to the Synology NAS at baseURL
+func newShareProxy(baseURL string, skipTLSVerify bool, trigger func(), logger *zap.Logger) (*shareProxy, error) {
+	target, err := url.Parse(baseURL)
+	if err != nil || target.Scheme == "" || target.Host == "" {
+		return nil, fmt.Errorf("invalid synology base URL %q", baseURL)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if skipTLSVerify {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	p := &shareProxy{
+		trigger: trigger,
+		logger:  logger,
+		recent:  make(map[string]time.Time),
+	}
+	p.proxy = &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.Out.URL.Path = nasSharePath(pr.In.URL.Path)
+			pr.Out.URL.RawPath = ""
+			pr.SetURL(target)
+			pr.SetXForwarded()
+			// Admin credentials for this server are meaningless to the NAS
+			pr.Out.Header.Del("Authorization")
+		},
+		Transport: transport,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			reqLogger(r, logger).Warn("failed to proxy share to NAS", zap.String("path", r.URL.Path), zap.Error(err))
+			http.Error(w, "Share not available", http.StatusBadGateway)
+		},
+	}
+	return p, nil
+}
+
+// nasSharePath maps a share request path to the NAS: our /f/{token} becomes the
+// Drive share URL /d/s/{token}; /d/s/ and /sharing/ paths already match
+func nasSharePath(p string) string {
+	if token, ok := strings.CutPrefix(p, "/f/"); ok {
+		return "/d/s/" + token
+	}
+	return p
+}
+
+// canProxy reports whether the request is for the shared file itself rather
+// than a sub-resource (thumbnail, stream) that only exists in the cache
+func canProxy(r *http.Request) bool {
+	rest, ok := strings.CutPrefix(r.URL.Path, "/f/")
+	return !ok || !strings.Contains(rest, "/")
+}
+
+// serve proxies the request to the NAS and requests a sync for a new token
+func (p *shareProxy) serve(w http.ResponseWriter, r *http.Request, token string) {
+	if p.remember(token) && p.trigger != nil {
+		p.trigger()
+	}
+
+	reqLogger(r, p.logger).Info("proxying unknown share to NAS", zap.String("token", token))
+	p.proxy.ServeHTTP(w, r)
+}
+
+// remember records a proxied token and reports whether a sync should be
+// requested: the token was not seen recently and the last requested sync is
+// long enough ago, so random tokens cannot keep the syncer busy
+func (p *shareProxy) remember(token string) bool {
+	now := time.Now()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for t, seen := range p.recent {
+		if now.Sub(seen) > shareProxyRemember {
+			delete(p.recent, t)
+		}
+	}
+
+	if _, ok := p.recent[token]; ok || now.Sub(p.lastSync) < shareProxySyncGap {
+		return false
+	}
+	p.recent[token] = now
+	p.lastSync = now
+	return true
+}
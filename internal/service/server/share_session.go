@@ -0,0 +1,97 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/util/urlsign"
+)
+
+// defaultSessionCookie is the name of the cookie remembering an unlocked share
+const defaultSessionCookie = "share_session"
+
+// SessionCookieConfig sets the attributes of share session cookies
+type SessionCookieConfig struct {
+	Name     string // "" = share_session
+	Domain   string // "" = the requested host only
+	Secure   string // "auto" (or "") = on HTTPS requests, "always" or "never"
+	SameSite string // "strict" (or ""), "lax" or "none"
+}
+
+// name returns the cookie name
+func (c SessionCookieConfig) name() string {
+	if c.Name == "" {
+		return defaultSessionCookie
+	}
+	return c.Name
+}
+
+// sameSite returns the SameSite attribute
+func (c SessionCookieConfig) sameSite() http.SameSite {
+	switch c.SameSite {
+	case "lax":
+		return http.SameSiteLaxMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteStrictMode
+	}
+}
+
+// Share sessions are stateless: the cookie holds its expiry and an HMAC of
+// the share token, the expiry and the share's password hash, as
+// "<unix seconds>.<signature>". Any instance with the same secret accepts it,
+// across restarts, and changing a share's password ends its sessions.
+
+// newSessionSigner signs session cookies with secret, or with a random key
+// that only lasts as long as the process when secret is empty
+func newSessionSigner(secret string) *urlsign.Signer {
+	if secret == "" {
+		key := make([]byte, 32)
+		rand.Read(key)
+		secret = hex.EncodeToString(key)
+	}
+	return urlsign.New(secret)
+}
+
+// sessionSubject is what a session cookie of a share is signed over
+func sessionSubject(shareToken, passwordHash string) string {
+	return shareToken + "\n" + passwordHash
+}
+
+// hasSession reports whether the request carries a valid session cookie for the share
+func (h *FileHandler) hasSession(r *http.Request, shareToken, passwordHash string) bool {
+	cookie, err := r.Cookie(h.sessionCookie.name())
+	if err != nil {
+		return false
+	}
+	exp, sig, ok := strings.Cut(cookie.Value, ".")
+	if !ok {
+		return false
+	}
+	_, err = h.sessions.Verify(sessionSubject(shareToken, passwordHash), url.Values{"exp": {exp}, "sig": {sig}}, time.Now())
+	return err == nil
+}
+
+// setSessionCookie opens a session for the share lasting ttl
+func (h *FileHandler) setSessionCookie(w http.ResponseWriter, r *http.Request, shareToken, passwordHash string, ttl time.Duration) {
+	signed := h.sessions.Sign(sessionSubject(shareToken, passwordHash), time.Now().Add(ttl))
+	secure := h.sessionCookie.Secure == "always"
+	if h.sessionCookie.Secure == "" || h.sessionCookie.Secure == "auto" {
+		secure = h.proxyTrust.IsHTTPS(r)
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     h.sessionCookie.name(),
+		Value:    signed.Get("exp") + "." + signed.Get("sig"),
+		Path:     "/",
+		Domain:   h.sessionCookie.Domain,
+		MaxAge:   max(int(ttl.Seconds()), 1),
+		HttpOnly: true,
+		SameSite: h.sessionCookie.sameSite(),
+		Secure:   secure,
+	})
+}
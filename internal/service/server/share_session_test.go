@@ -0,0 +1,175 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// openSession unlocks a share with its password and returns the session cookie
+func openSession(t *testing.T, handler http.Handler, token, password string) *http.Cookie {
+	t.Helper()
+	w := serve(handler, httptest.NewRequest(http.MethodGet, "/f/"+token+"?password="+password, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("unlock status = %d, want %d", w.Code, http.StatusOK)
+	}
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == defaultSessionCookie {
+			return cookie
+		}
+	}
+	t.Fatalf("no %s cookie in %v", defaultSessionCookie, w.Result().Cookies())
+	return nil
+}
+
+// getWithCookie requests a share with cookie and returns the status
+func getWithCookie(handler http.Handler, token string, cookie *http.Cookie) int {
+	r := httptest.NewRequest(http.MethodGet, "/f/"+token, nil)
+	r.AddCookie(cookie)
+	return serve(handler, r).Code
+}
+
+func TestShareSession_Valid(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.SessionSecret = "session-secret"
+	srv, store := newTestServer(t, cfg)
+	addCachedShare(t, store, "locked", []byte("secret"), "pw")
+	addCachedShare(t, store, "other", []byte("other"), "pw")
+	handler := srv.Handler()
+
+	cookie := openSession(t, handler, "locked", "pw")
+	if !cookie.HttpOnly || cookie.MaxAge != int(sessionTTL.Seconds()) || cookie.Path != "/" {
+		t.Errorf("cookie = %+v, want HttpOnly, Path=/ and MaxAge=%d", cookie, int(sessionTTL.Seconds()))
+	}
+	if got := getWithCookie(handler, "locked", cookie); got != http.StatusOK {
+		t.Errorf("with session: status = %d, want %d", got, http.StatusOK)
+	}
+
+	// A session opens only the share it was signed for, even with the same password
+	if got := getWithCookie(handler, "other", cookie); got != http.StatusUnauthorized {
+		t.Errorf("other share: status = %d, want %d", got, http.StatusUnauthorized)
+	}
+
+	// Another instance with the same secret accepts it, one with another secret does not
+	same := New(cfg, store, zap.NewNop())
+	if got := getWithCookie(same.Handler(), "locked", cookie); got != http.StatusOK {
+		t.Errorf("same secret: status = %d, want %d", got, http.StatusOK)
+	}
+	otherCfg := DefaultConfig()
+	otherCfg.SessionSecret = "another-secret"
+	other := New(otherCfg, store, zap.NewNop())
+	if got := getWithCookie(other.Handler(), "locked", cookie); got != http.StatusUnauthorized {
+		t.Errorf("other secret: status = %d, want %d", got, http.StatusUnauthorized)
+	}
+}
+
+func TestShareSession_Rejected(t *testing.T) {
+	srv, store := newTestServer(t, nil)
+	share := addCachedShare(t, store, "locked", []byte("secret"), "pw")
+	handler := srv.Handler()
+	cookie := openSession(t, handler, "locked", "pw")
+
+	t.Run("expired", func(t *testing.T) {
+		signed := srv.fileHandler.sessions.Sign(sessionSubject("locked", share.Password), time.Now().Add(-time.Minute))
+		expired := &http.Cookie{Name: defaultSessionCookie, Value: signed.Get("exp") + "." + signed.Get("sig")}
+		if got := getWithCookie(handler, "locked", expired); got != http.StatusUnauthorized {
+			t.Errorf("status = %d, want %d", got, http.StatusUnauthorized)
+		}
+	})
+
+	t.Run("tampered signature", func(t *testing.T) {
+		exp, sig, _ := strings.Cut(cookie.Value, ".")
+		// The first character of the signature has no unused bits
+		flipped := "A"
+		if sig[0] == 'A' {
+			flipped = "B"
+		}
+		tampered := &http.Cookie{Name: cookie.Name, Value: exp + "." + flipped + sig[1:]}
+		if got := getWithCookie(handler, "locked", tampered); got != http.StatusUnauthorized {
+			t.Errorf("status = %d, want %d", got, http.StatusUnauthorized)
+		}
+	})
+
+	t.Run("extended expiry", func(t *testing.T) {
+		_, sig, _ := strings.Cut(cookie.Value, ".")
+		extended := &http.Cookie{Name: cookie.Name, Value: "9999999999." + sig}
+		if got := getWithCookie(handler, "locked", extended); got != http.StatusUnauthorized {
+			t.Errorf("status = %d, want %d", got, http.StatusUnauthorized)
+		}
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		malformed := &http.Cookie{Name: cookie.Name, Value: "garbage"}
+		if got := getWithCookie(handler, "locked", malformed); got != http.StatusUnauthorized {
+			t.Errorf("status = %d, want %d", got, http.StatusUnauthorized)
+		}
+	})
+
+	// Runs last: changing the password ends every open session
+	t.Run("password changed", func(t *testing.T) {
+		share.Password = "new-pw"
+		if err := store.UpdateShare(share); err != nil {
+			t.Fatalf("UpdateShare() error = %v", err)
+		}
+		if got := getWithCookie(handler, "locked", cookie); got != http.StatusUnauthorized {
+			t.Errorf("status = %d, want %d", got, http.StatusUnauthorized)
+		}
+		openSession(t, handler, "locked", "new-pw")
+	})
+}
+
+func TestShareSession_CookieAttributes(t *testing.T) {
+	tests := []struct {
+		name     string
+		cookie   SessionCookieConfig
+		peer     string
+		proto    string
+		secure   bool
+		sameSite http.SameSite
+	}{
+		{"plain HTTP", SessionCookieConfig{}, "198.51.100.2", "", false, http.SameSiteStrictMode},
+		{"HTTPS from a trusted proxy", SessionCookieConfig{}, "10.0.0.1", "https", true, http.SameSiteStrictMode},
+		{"HTTPS claimed by an untrusted peer", SessionCookieConfig{}, "198.51.100.2", "https", false, http.SameSiteStrictMode},
+		{"always secure", SessionCookieConfig{Secure: "always", SameSite: "lax"}, "198.51.100.2", "", true, http.SameSiteLaxMode},
+		{"never secure", SessionCookieConfig{Secure: "never", SameSite: "none"}, "10.0.0.1", "https", false, http.SameSiteNoneMode},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.TrustProxyHeaders = true
+			cfg.TrustedProxies = []string{"10.0.0.0/8"}
+			cfg.SessionCookie = tt.cookie
+			cfg.SessionCookie.Name = "sfc_session"
+			cfg.SessionCookie.Domain = "files.example.com"
+			srv, store := newTestServer(t, cfg)
+			addCachedShare(t, store, "locked", []byte("secret"), "pw")
+
+			r := httptest.NewRequest(http.MethodGet, "/f/locked?password=pw", nil)
+			r.RemoteAddr = tt.peer + ":1234"
+			if tt.proto != "" {
+				r.Header.Set("X-Forwarded-Proto", tt.proto)
+			}
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, r)
+
+			cookies := w.Result().Cookies()
+			if len(cookies) != 1 {
+				t.Fatalf("cookies = %v, want one", cookies)
+			}
+			cookie := cookies[0]
+			if cookie.Name != "sfc_session" || cookie.Domain != "files.example.com" {
+				t.Errorf("cookie %s for %q, want sfc_session for files.example.com", cookie.Name, cookie.Domain)
+			}
+			if cookie.Secure != tt.secure {
+				t.Errorf("Secure = %v, want %v", cookie.Secure, tt.secure)
+			}
+			if cookie.SameSite != tt.sameSite {
+				t.Errorf("SameSite = %v, want %v", cookie.SameSite, tt.sameSite)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"go.uber.org/zap"
+)
+
+// SyncHandler handles requests starting a sync
+type SyncHandler struct {
+	trigger func()                                                // Requests an incremental sync, may be nil
+	dryRun  func(ctx context.Context) (*domain.SyncReport, error) // Computes a change report, may be nil
+	logger  *zap.Logger
+}
+
+// NewSyncHandler creates a new SyncHandler
+func NewSyncHandler(trigger func(), dryRun func(ctx context.Context) (*domain.SyncReport, error), logger *zap.Logger) *SyncHandler {
+	return &SyncHandler{
+		trigger: trigger,
+		dryRun:  dryRun,
+		logger:  logger,
+	}
+}
+
+// syncChangeResponse is the JSON representation of a file a sync would change
+type syncChangeResponse struct {
+	Path     string `json:"path"`
+	Size     int64  `json:"size"`
+	Priority int    `json:"priority"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// syncReportResponse is the JSON representation of a dry-run sync
+type syncReportResponse struct {
+	StartedAt      time.Time            `json:"started_at"`
+	DurationMs     int64                `json:"duration_ms"`
+	Added          []syncChangeResponse `json:"added"`
+	Updated        []syncChangeResponse `json:"updated"`
+	Invalidated    []syncChangeResponse `json:"invalidated"`
+	Enqueued       []syncChangeResponse `json:"enqueued"`
+	Skipped        []syncChangeResponse `json:"skipped"`
+	Folders        []string             `json:"folders"`
+	RevokedShares  []string             `json:"revoked_shares"`
+	ExcludedLabels []string             `json:"excluded_labels"`
+}
+
+// HandleSync handles POST /api/v1/sync and requires the operator role.
+//
+//	POST /api/v1/sync               request an incremental sync
+//	POST /api/v1/sync?dry_run=true  report what a full sync would change without applying it
+func (h *SyncHandler) HandleSync(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireRole(w, r, domain.RoleOperator) {
+		return
+	}
+
+	if r.URL.Query().Get("dry_run") == "true" {
+		h.handleDryRun(w, r)
+		return
+	}
+
+	if h.trigger == nil {
+		http.Error(w, "Sync not available", http.StatusServiceUnavailable)
+		return
+	}
+	h.trigger()
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "sync requested"})
+}
+
+// handleDryRun runs a dry-run sync and returns its report
+func (h *SyncHandler) handleDryRun(w http.ResponseWriter, r *http.Request) {
+	if h.dryRun == nil {
+		http.Error(w, "Dry run not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	// Listing a large Drive can take longer than the server write timeout
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		reqLogger(r, h.logger).Debug("failed to clear write deadline", zap.Error(err))
+	}
+
+	report, err := h.dryRun(r.Context())
+	if err != nil {
+		reqLogger(r, h.logger).Error("dry-run sync failed", zap.Error(err))
+		http.Error(w, "Dry run failed: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, syncReportResponse{
+		StartedAt:      report.StartedAt,
+		DurationMs:     report.Duration.Milliseconds(),
+		Added:          syncChanges(report.Added),
+		Updated:        syncChanges(report.Updated),
+		Invalidated:    syncChanges(report.Invalidated),
+		Enqueued:       syncChanges(report.Enqueued),
+		Skipped:        syncChanges(report.Skipped),
+		Folders:        nonNil(report.Folders),
+		RevokedShares:  nonNil(report.RevokedShares),
+		ExcludedLabels: nonNil(report.ExcludedLabels),
+	})
+}
+
+// syncChanges converts report entries, keeping empty lists as [] in JSON
+func syncChanges(changes []domain.SyncChange) []syncChangeResponse {
+	items := make([]syncChangeResponse, 0, len(changes))
+	for _, c := range changes {
+		items = append(items, syncChangeResponse{
+			Path:     c.Path,
+			Size:     c.Size,
+			Priority: c.Priority,
+			Reason:   c.Reason,
+		})
+	}
+	return items
+}
+
+// nonNil returns an empty list instead of nil so it is encoded as []
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
@@ -0,0 +1,329 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"go.uber.org/zap"
+)
+
+// TaskHandler handles download task admin API requests
+type TaskHandler struct {
+	store    port.Store
+	logger   *zap.Logger
+	progress *progressTracker
+	live     bool // Event stream available, the downloads page reloads on task events
+}
+
+// NewTaskHandler creates a new TaskHandler
+func NewTaskHandler(store port.Store, logger *zap.Logger) *TaskHandler {
+	return &TaskHandler{
+		store:    store,
+		logger:   logger,
+		progress: newProgressTracker(),
+	}
+}
+
+// taskResponse is the JSON representation of a download task
+type taskResponse struct {
+	ID              int64      `json:"id"`
+	FileID          int64      `json:"file_id"`
+	SynoPath        string     `json:"syno_path"`
+	Priority        int        `json:"priority"`
+	Size            int64      `json:"size"`
+	Status          string     `json:"status"`
+	WorkerID        string     `json:"worker_id,omitempty"`
+	BytesDownloaded int64      `json:"bytes_downloaded"`
+	RetryCount      int        `json:"retry_count"`
+	MaxRetries      int        `json:"max_retries"`
+	NextRetryAt     *time.Time `json:"next_retry_at,omitempty"`
+	LastError       string     `json:"last_error,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	ClaimedAt       *time.Time `json:"claimed_at,omitempty"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// newTaskResponse converts a domain task to its JSON representation
+func newTaskResponse(task *domain.DownloadTask) taskResponse {
+	return taskResponse{
+		ID:              task.ID,
+		FileID:          task.FileID,
+		SynoPath:        task.SynoPath,
+		Priority:        task.Priority,
+		Size:            task.Size,
+		Status:          task.Status,
+		WorkerID:        task.WorkerID,
+		BytesDownloaded: task.BytesDownloaded,
+		RetryCount:      task.RetryCount,
+		MaxRetries:      task.MaxRetries,
+		NextRetryAt:     task.NextRetryAt,
+		LastError:       task.LastError,
+		CreatedAt:       task.CreatedAt,
+		ClaimedAt:       task.ClaimedAt,
+		UpdatedAt:       task.UpdatedAt,
+	}
+}
+
+// progressResponse is the JSON representation of a task's download progress
+type progressResponse struct {
+	TaskID          int64      `json:"task_id"`
+	SynoPath        string     `json:"syno_path"`
+	Status          string     `json:"status"`
+	WorkerID        string     `json:"worker_id,omitempty"`
+	BytesDownloaded int64      `json:"bytes_downloaded"`
+	Size            int64      `json:"size"`
+	Percent         float64    `json:"percent"`
+	BytesPerSecond  float64    `json:"bytes_per_second"`
+	ETASeconds      *int64     `json:"eta_seconds"` // null while the speed is unknown
+	ClaimedAt       *time.Time `json:"claimed_at,omitempty"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// newProgressResponse converts a task and its progress to JSON representation
+func newProgressResponse(task *domain.DownloadTask, p domain.TaskProgress) progressResponse {
+	resp := progressResponse{
+		TaskID:          task.ID,
+		SynoPath:        task.SynoPath,
+		Status:          task.Status,
+		WorkerID:        task.WorkerID,
+		BytesDownloaded: p.BytesDownloaded,
+		Size:            p.Size,
+		Percent:         math.Round(p.Percent*10) / 10,
+		BytesPerSecond:  math.Round(p.BytesPerSecond),
+		ClaimedAt:       task.ClaimedAt,
+		UpdatedAt:       task.UpdatedAt,
+	}
+	if p.ETA >= 0 {
+		eta := int64(p.ETA / time.Second)
+		resp.ETASeconds = &eta
+	}
+	return resp
+}
+
+// HandleTasks routes /api/v1/tasks/ requests. Listing requires the viewer
+// role, retrying requires operator.
+//
+//	GET  /api/v1/tasks/active              list in-progress downloads with progress
+//	GET  /api/v1/tasks/{id}/progress       progress of a single task
+//	GET  /api/v1/tasks/failed              list dead-lettered tasks
+//	POST /api/v1/tasks/failed/retry        retry all failed tasks matching ?error= and ?path_prefix=
+//	POST /api/v1/tasks/{id}/retry          retry a single failed task
+func (h *TaskHandler) HandleTasks(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/tasks"), "/")
+	parts := strings.Split(path, "/")
+
+	switch {
+	case len(parts) == 1 && parts[0] == "active":
+		h.handleListActive(w, r)
+	case len(parts) == 2 && parts[1] == "progress":
+		taskID, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid task ID", http.StatusBadRequest)
+			return
+		}
+		h.handleProgress(w, r, taskID)
+	case len(parts) == 1 && parts[0] == "failed":
+		h.handleListFailed(w, r)
+	case len(parts) == 2 && parts[0] == "failed" && parts[1] == "retry":
+		h.handleRetryAll(w, r)
+	case len(parts) == 2 && parts[1] == "retry":
+		taskID, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid task ID", http.StatusBadRequest)
+			return
+		}
+		h.handleRetry(w, r, taskID)
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+	}
+}
+
+// handleListActive lists in-progress tasks with their download progress
+func (h *TaskHandler) handleListActive(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit, offset := parsePagination(r)
+
+	items, err := h.activeProgress(limit, offset)
+	if err != nil {
+		reqLogger(r, h.logger).Error("failed to list active tasks", zap.Error(err))
+		http.Error(w, "Failed to list tasks", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"tasks":  items,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// handleProgress returns the download progress of a single task
+// Completed tasks are removed from the queue, so they are reported as not found
+func (h *TaskHandler) handleProgress(w http.ResponseWriter, r *http.Request, taskID int64) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	task, err := h.store.GetTask(taskID)
+	if err != nil {
+		reqLogger(r, h.logger).Error("failed to get task", zap.Int64("task_id", taskID), zap.Error(err))
+		http.Error(w, "Failed to get task", http.StatusInternalServerError)
+		return
+	}
+	if task == nil {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newProgressResponse(task, h.progress.observe(task)))
+}
+
+// activeProgress returns the progress of in-progress tasks, most recently updated first
+func (h *TaskHandler) activeProgress(limit, offset int) ([]progressResponse, error) {
+	tasks, err := h.store.ListTasksByStatus(domain.TaskStatusInProgress, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]progressResponse, 0, len(tasks))
+	active := make(map[int64]bool, len(tasks))
+	for _, task := range tasks {
+		active[task.ID] = true
+		items = append(items, newProgressResponse(task, h.progress.observe(task)))
+	}
+
+	// A complete listing tells which tracked tasks have finished
+	if offset == 0 && len(tasks) < limit {
+		h.progress.forget(active)
+	}
+
+	return items, nil
+}
+
+// handleListFailed lists failed (dead-lettered) tasks
+func (h *TaskHandler) handleListFailed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit, offset := parsePagination(r)
+
+	tasks, err := h.store.ListTasksByStatus(domain.TaskStatusFailed, limit, offset)
+	if err != nil {
+		reqLogger(r, h.logger).Error("failed to list failed tasks", zap.Error(err))
+		http.Error(w, "Failed to list tasks", http.StatusInternalServerError)
+		return
+	}
+
+	items := make([]taskResponse, 0, len(tasks))
+	for _, task := range tasks {
+		items = append(items, newTaskResponse(task))
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"tasks":  items,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// handleRetry resets a single failed task to pending
+func (h *TaskHandler) handleRetry(w http.ResponseWriter, r *http.Request, taskID int64) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireRole(w, r, domain.RoleOperator) {
+		return
+	}
+
+	err := h.store.RetryFailedTask(taskID)
+	switch {
+	case errors.Is(err, domain.ErrNotFound):
+		http.Error(w, "Failed task not found", http.StatusNotFound)
+		return
+	case errors.Is(err, domain.ErrAlreadyExists):
+		http.Error(w, "File already has an active task", http.StatusConflict)
+		return
+	case err != nil:
+		reqLogger(r, h.logger).Error("failed to retry task", zap.Int64("task_id", taskID), zap.Error(err))
+		http.Error(w, "Failed to retry task", http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(h.store, h.logger, r, domain.AuditActionTaskRetry, "task:"+strconv.FormatInt(taskID, 10), nil)
+	reqLogger(r, h.logger).Info("failed task requeued", zap.Int64("task_id", taskID))
+	writeJSON(w, http.StatusOK, map[string]interface{}{"retried": 1})
+}
+
+// handleRetryAll resets all failed tasks matching the query filter to pending
+func (h *TaskHandler) handleRetryAll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireRole(w, r, domain.RoleOperator) {
+		return
+	}
+
+	filter := domain.FailedTaskFilter{
+		ErrorContains: r.URL.Query().Get("error"),
+		PathPrefix:    r.URL.Query().Get("path_prefix"),
+	}
+
+	count, err := h.store.RetryFailedTasks(filter)
+	if err != nil {
+		reqLogger(r, h.logger).Error("failed to retry failed tasks", zap.Error(err))
+		http.Error(w, "Failed to retry tasks", http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(h.store, h.logger, r, domain.AuditActionTaskRetryBulk, "", map[string]string{
+		"error":       filter.ErrorContains,
+		"path_prefix": filter.PathPrefix,
+		"count":       strconv.Itoa(count),
+	})
+	reqLogger(r, h.logger).Info("failed tasks requeued",
+		zap.Int("count", count),
+		zap.String("error_filter", filter.ErrorContains),
+		zap.String("path_prefix", filter.PathPrefix))
+	writeJSON(w, http.StatusOK, map[string]interface{}{"retried": count})
+}
+
+// parsePagination reads limit/offset query parameters with sane bounds
+func parsePagination(r *http.Request) (int, int) {
+	limit := 100
+	offset := 0
+
+	if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && v > 0 {
+		limit = v
+	}
+	if limit > 1000 {
+		limit = 1000
+	}
+	if v, err := strconv.Atoi(r.URL.Query().Get("offset")); err == nil && v > 0 {
+		offset = v
+	}
+
+	return limit, offset
+}
+
+// writeJSON writes a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
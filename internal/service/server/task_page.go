@@ -0,0 +1,117 @@
+package server
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"go.uber.org/zap"
+)
+
+// downloadsPageRefresh is how often the active downloads page reloads itself
+const downloadsPageRefresh = 5
+
+var downloadsPage = template.Must(template.New("downloads").Funcs(template.FuncMap{
+	"size":     formatSize,
+	"speed":    formatSpeed,
+	"eta":      formatETA,
+	"progress": func(p float64) string { return fmt.Sprintf("%.1f%%", p) },
+	"time":     func(t time.Time) string { return t.Local().Format("2006-01-02 15:04:05") },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <meta http-equiv="refresh" content="{{.Refresh}}">
+    <title>Active Downloads</title>
+    <style>
+        body { font-family: sans-serif; margin: 20px; }
+        h1 { font-size: 24px; font-weight: normal; border-bottom: 2px solid #333; padding-bottom: 10px; }
+        table { border-collapse: collapse; width: 100%; margin-top: 20px; }
+        th, td { text-align: left; padding: 8px 12px; border-bottom: 1px solid #ddd; }
+        th { background-color: #f0f0f0; font-weight: bold; }
+        tr:hover { background-color: #f9f9f9; }
+        .num { text-align: right; white-space: nowrap; }
+        .bar { width: 160px; height: 12px; background-color: #eee; border-radius: 6px; overflow: hidden; }
+        .bar div { height: 100%; background-color: #0066cc; }
+        .empty { color: #666; }
+    </style>
+</head>
+<body>
+    <h1>Active Downloads ({{len .Tasks}})</h1>
+    {{if .Tasks}}
+    <table>
+        <tr>
+            <th>Path</th>
+            <th>Worker</th>
+            <th>Progress</th>
+            <th class="num">Downloaded</th>
+            <th class="num">Speed</th>
+            <th class="num">ETA</th>
+            <th>Last Update</th>
+        </tr>
+        {{range .Tasks}}
+        <tr>
+            <td>{{.SynoPath}}</td>
+            <td>{{.WorkerID}}</td>
+            <td><div class="bar"><div style="width: {{.Percent}}%"></div></div> {{progress .Percent}}</td>
+            <td class="num">{{size .BytesDownloaded}} / {{size .Size}}</td>
+            <td class="num">{{speed .BytesPerSecond}}</td>
+            <td class="num">{{eta .ETASeconds}}</td>
+            <td>{{time .UpdatedAt}}</td>
+        </tr>
+        {{end}}
+    </table>
+    {{else}}
+    <p class="empty">No downloads in progress.</p>
+    {{end}}
+    <p class="empty">Refreshes every {{.Refresh}} seconds{{if .Live}} and when a download starts or ends{{end}}. Speed is measured between progress updates.</p>
+    {{.Live}}
+</body>
+</html>`))
+
+// HandleDownloadsPage renders an auto-refreshing page of in-progress downloads
+func (h *TaskHandler) HandleDownloadsPage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	items, err := h.activeProgress(1000, 0)
+	if err != nil {
+		reqLogger(r, h.logger).Error("failed to list active tasks", zap.Error(err))
+		http.Error(w, "Failed to list tasks", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	data := struct {
+		Refresh int
+		Tasks   []progressResponse
+		Live    template.HTML
+	}{Refresh: downloadsPageRefresh, Tasks: items}
+	if h.live {
+		data.Live = liveReload([]string{domain.EventTaskStarted, domain.EventTaskCompleted, domain.EventTaskFailed}, time.Second)
+	}
+	if err := downloadsPage.Execute(w, data); err != nil {
+		reqLogger(r, h.logger).Error("failed to render downloads page", zap.Error(err))
+	}
+}
+
+// formatSpeed formats a transfer rate, or "-" while it is unknown
+func formatSpeed(bytesPerSecond float64) string {
+	if bytesPerSecond <= 0 {
+		return "-"
+	}
+	return formatSize(int64(bytesPerSecond)) + "/s"
+}
+
+// formatETA formats a remaining time in seconds, or "-" while it is unknown
+func formatETA(seconds *int64) string {
+	if seconds == nil {
+		return "-"
+	}
+	return (time.Duration(*seconds) * time.Second).String()
+}
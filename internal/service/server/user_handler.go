@@ -0,0 +1,504 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"github.com/vertextoedge/synology-file-cache/internal/util/passhash"
+	"go.uber.org/zap"
+)
+
+// UserHandler handles admin user and API token management requests
+type UserHandler struct {
+	store  port.Store
+	logger *zap.Logger
+}
+
+// NewUserHandler creates a new UserHandler
+func NewUserHandler(store port.Store, logger *zap.Logger) *UserHandler {
+	return &UserHandler{
+		store:  store,
+		logger: logger,
+	}
+}
+
+// userResponse is the JSON representation of an admin user
+type userResponse struct {
+	ID        int64     `json:"id"`
+	Username  string    `json:"username"`
+	Role      string    `json:"role"`
+	Disabled  bool      `json:"disabled"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// newUserResponse converts a domain user to its JSON representation
+func newUserResponse(user *domain.AdminUser) userResponse {
+	return userResponse{
+		ID:        user.ID,
+		Username:  user.Username,
+		Role:      user.Role,
+		Disabled:  user.Disabled,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.UpdatedAt,
+	}
+}
+
+// tokenResponse is the JSON representation of an API token.
+// Token is only set in the response to token creation.
+type tokenResponse struct {
+	ID         int64      `json:"id"`
+	UserID     int64      `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Token      string     `json:"token,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	Revoked    bool       `json:"revoked"`
+}
+
+// newTokenResponse converts a domain token to its JSON representation
+func newTokenResponse(token *domain.APIToken) tokenResponse {
+	return tokenResponse{
+		ID:         token.ID,
+		UserID:     token.UserID,
+		Name:       token.Name,
+		Prefix:     token.Prefix,
+		CreatedAt:  token.CreatedAt,
+		LastUsedAt: token.LastUsedAt,
+		ExpiresAt:  token.ExpiresAt,
+		Revoked:    token.Revoked,
+	}
+}
+
+// HandleUsers routes /api/v1/users requests (admin role required)
+//
+//	GET    /api/v1/users          list users
+//	POST   /api/v1/users          create a user {"username","password","role"}
+//	GET    /api/v1/users/{id}     get a user
+//	PATCH  /api/v1/users/{id}     update {"password","role","disabled"}
+//	DELETE /api/v1/users/{id}     delete a user and their tokens
+func (h *UserHandler) HandleUsers(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/users"), "/")
+
+	if path == "" {
+		switch r.Method {
+		case http.MethodGet:
+			h.handleListUsers(w, r)
+		case http.MethodPost:
+			h.handleCreateUser(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	userID, err := strconv.ParseInt(path, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.handleGetUser(w, r, userID)
+	case http.MethodPatch:
+		h.handleUpdateUser(w, r, userID)
+	case http.MethodDelete:
+		h.handleDeleteUser(w, r, userID)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleListUsers lists all admin users
+func (h *UserHandler) handleListUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := h.store.ListUsers()
+	if err != nil {
+		reqLogger(r, h.logger).Error("failed to list users", zap.Error(err))
+		http.Error(w, "Failed to list users", http.StatusInternalServerError)
+		return
+	}
+
+	items := make([]userResponse, 0, len(users))
+	for _, user := range users {
+		items = append(items, newUserResponse(user))
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"users": items})
+}
+
+// handleCreateUser creates an admin user
+func (h *UserHandler) handleCreateUser(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+		Role     string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Username == "" || req.Password == "" {
+		http.Error(w, "username and password are required", http.StatusBadRequest)
+		return
+	}
+	if req.Role == "" {
+		req.Role = domain.RoleViewer
+	}
+	if !domain.IsValidRole(req.Role) {
+		http.Error(w, "role must be one of viewer, operator, admin", http.StatusBadRequest)
+		return
+	}
+
+	hashed, err := passhash.Hash(req.Password)
+	if err != nil {
+		reqLogger(r, h.logger).Error("failed to hash password", zap.Error(err))
+		http.Error(w, "Failed to create user", http.StatusInternalServerError)
+		return
+	}
+
+	user := &domain.AdminUser{
+		Username:     req.Username,
+		PasswordHash: hashed,
+		Role:         req.Role,
+	}
+	err = h.store.CreateUser(user)
+	switch {
+	case errors.Is(err, domain.ErrAlreadyExists):
+		http.Error(w, "Username already exists", http.StatusConflict)
+		return
+	case err != nil:
+		reqLogger(r, h.logger).Error("failed to create user", zap.String("username", req.Username), zap.Error(err))
+		http.Error(w, "Failed to create user", http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(h.store, h.logger, r, domain.AuditActionUserCreate, auditUserTarget(user.ID),
+		map[string]string{"username": user.Username, "role": user.Role})
+	reqLogger(r, h.logger).Info("admin user created",
+		zap.String("username", user.Username),
+		zap.String("role", user.Role),
+		zap.String("by", actorName(r)))
+	writeJSON(w, http.StatusCreated, newUserResponse(user))
+}
+
+// handleGetUser returns a single admin user
+func (h *UserHandler) handleGetUser(w http.ResponseWriter, r *http.Request, userID int64) {
+	user, err := h.store.GetUserByID(userID)
+	if err != nil {
+		reqLogger(r, h.logger).Error("failed to get user", zap.Int64("user_id", userID), zap.Error(err))
+		http.Error(w, "Failed to get user", http.StatusInternalServerError)
+		return
+	}
+	if user == nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newUserResponse(user))
+}
+
+// handleUpdateUser changes password, role or disabled flag of an admin user
+func (h *UserHandler) handleUpdateUser(w http.ResponseWriter, r *http.Request, userID int64) {
+	var req struct {
+		Password *string `json:"password"`
+		Role     *string `json:"role"`
+		Disabled *bool   `json:"disabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.store.GetUserByID(userID)
+	if err != nil {
+		reqLogger(r, h.logger).Error("failed to get user", zap.Int64("user_id", userID), zap.Error(err))
+		http.Error(w, "Failed to update user", http.StatusInternalServerError)
+		return
+	}
+	if user == nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	if req.Role != nil {
+		if !domain.IsValidRole(*req.Role) {
+			http.Error(w, "role must be one of viewer, operator, admin", http.StatusBadRequest)
+			return
+		}
+		user.Role = *req.Role
+	}
+	if req.Disabled != nil {
+		user.Disabled = *req.Disabled
+	}
+	if req.Password != nil {
+		if *req.Password == "" {
+			http.Error(w, "password must not be empty", http.StatusBadRequest)
+			return
+		}
+		hashed, err := passhash.Hash(*req.Password)
+		if err != nil {
+			reqLogger(r, h.logger).Error("failed to hash password", zap.Error(err))
+			http.Error(w, "Failed to update user", http.StatusInternalServerError)
+			return
+		}
+		user.PasswordHash = hashed
+	}
+
+	if err := h.store.UpdateUser(user); err != nil {
+		reqLogger(r, h.logger).Error("failed to update user", zap.Int64("user_id", userID), zap.Error(err))
+		http.Error(w, "Failed to update user", http.StatusInternalServerError)
+		return
+	}
+
+	details := map[string]string{"username": user.Username, "role": user.Role, "disabled": strconv.FormatBool(user.Disabled)}
+	if req.Password != nil {
+		details["password_changed"] = "true"
+	}
+	recordAudit(h.store, h.logger, r, domain.AuditActionUserUpdate, auditUserTarget(user.ID), details)
+	reqLogger(r, h.logger).Info("admin user updated",
+		zap.String("username", user.Username),
+		zap.String("role", user.Role),
+		zap.Bool("disabled", user.Disabled),
+		zap.String("by", actorName(r)))
+	writeJSON(w, http.StatusOK, newUserResponse(user))
+}
+
+// handleDeleteUser deletes an admin user
+func (h *UserHandler) handleDeleteUser(w http.ResponseWriter, r *http.Request, userID int64) {
+	if actor := UserFromContext(r.Context()); actor != nil && actor.ID == userID {
+		http.Error(w, "Cannot delete your own account", http.StatusBadRequest)
+		return
+	}
+
+	err := h.store.DeleteUser(userID)
+	switch {
+	case errors.Is(err, domain.ErrNotFound):
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	case err != nil:
+		reqLogger(r, h.logger).Error("failed to delete user", zap.Int64("user_id", userID), zap.Error(err))
+		http.Error(w, "Failed to delete user", http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(h.store, h.logger, r, domain.AuditActionUserDelete, auditUserTarget(userID), nil)
+	reqLogger(r, h.logger).Info("admin user deleted", zap.Int64("user_id", userID), zap.String("by", actorName(r)))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleTokens routes /api/v1/tokens requests. Users manage their own tokens;
+// admins may pass user_id to manage tokens of other users.
+//
+//	GET    /api/v1/tokens          list tokens (?user_id= for admins)
+//	POST   /api/v1/tokens          create {"name","expires_in","user_id"}; the token is only returned here
+//	DELETE /api/v1/tokens/{id}     revoke a token
+func (h *UserHandler) HandleTokens(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/tokens"), "/")
+
+	if path == "" {
+		switch r.Method {
+		case http.MethodGet:
+			h.handleListTokens(w, r)
+		case http.MethodPost:
+			h.handleCreateToken(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	tokenID, err := strconv.ParseInt(path, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid token ID", http.StatusBadRequest)
+		return
+	}
+
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	h.handleRevokeToken(w, r, tokenID)
+}
+
+// resolveTokenOwner returns the user whose tokens the request targets.
+// Writes an error response and returns 0 if the target is not allowed.
+func (h *UserHandler) resolveTokenOwner(w http.ResponseWriter, r *http.Request, requested int64) int64 {
+	actor := UserFromContext(r.Context())
+
+	if requested == 0 || requested == actor.ID {
+		if actor.ID == 0 {
+			// The built-in config account is not stored in the database
+			http.Error(w, "Built-in admin cannot own API tokens, pass user_id", http.StatusBadRequest)
+			return 0
+		}
+		return actor.ID
+	}
+
+	if !requireRole(w, r, domain.RoleAdmin) {
+		return 0
+	}
+	return requested
+}
+
+// handleListTokens lists API tokens of the caller or of user_id
+func (h *UserHandler) handleListTokens(w http.ResponseWriter, r *http.Request) {
+	var requested int64
+	if v := r.URL.Query().Get("user_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+		requested = id
+	}
+
+	userID := h.resolveTokenOwner(w, r, requested)
+	if userID == 0 {
+		return
+	}
+
+	tokens, err := h.store.ListAPITokens(userID)
+	if err != nil {
+		reqLogger(r, h.logger).Error("failed to list api tokens", zap.Int64("user_id", userID), zap.Error(err))
+		http.Error(w, "Failed to list tokens", http.StatusInternalServerError)
+		return
+	}
+
+	items := make([]tokenResponse, 0, len(tokens))
+	for _, token := range tokens {
+		items = append(items, newTokenResponse(token))
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"tokens": items})
+}
+
+// handleCreateToken creates an API token and returns its value once
+func (h *UserHandler) handleCreateToken(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name      string `json:"name"`
+		ExpiresIn string `json:"expires_in"` // Go duration, empty for no expiry
+		UserID    int64  `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	userID := h.resolveTokenOwner(w, r, req.UserID)
+	if userID == 0 {
+		return
+	}
+
+	owner, err := h.store.GetUserByID(userID)
+	if err != nil {
+		reqLogger(r, h.logger).Error("failed to get user", zap.Int64("user_id", userID), zap.Error(err))
+		http.Error(w, "Failed to create token", http.StatusInternalServerError)
+		return
+	}
+	if owner == nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresIn != "" {
+		d, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil || d <= 0 {
+			http.Error(w, "expires_in must be a positive duration", http.StatusBadRequest)
+			return
+		}
+		t := time.Now().Add(d)
+		expiresAt = &t
+	}
+
+	value, err := generateAPIToken()
+	if err != nil {
+		reqLogger(r, h.logger).Error("failed to generate api token", zap.Error(err))
+		http.Error(w, "Failed to create token", http.StatusInternalServerError)
+		return
+	}
+
+	token := &domain.APIToken{
+		UserID:    userID,
+		Name:      req.Name,
+		TokenHash: hashAPIToken(value),
+		Prefix:    value[:len(apiTokenPrefix)+8],
+		ExpiresAt: expiresAt,
+	}
+	if err := h.store.CreateAPIToken(token); err != nil {
+		reqLogger(r, h.logger).Error("failed to create api token", zap.Int64("user_id", userID), zap.Error(err))
+		http.Error(w, "Failed to create token", http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(h.store, h.logger, r, domain.AuditActionTokenCreate, auditTokenTarget(token.ID),
+		map[string]string{"owner": owner.Username, "name": token.Name, "prefix": token.Prefix})
+	reqLogger(r, h.logger).Info("api token created",
+		zap.Int64("token_id", token.ID),
+		zap.String("owner", owner.Username),
+		zap.String("by", actorName(r)))
+
+	resp := newTokenResponse(token)
+	resp.Token = value
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+// handleRevokeToken revokes an API token owned by the caller (or any token for admins)
+func (h *UserHandler) handleRevokeToken(w http.ResponseWriter, r *http.Request, tokenID int64) {
+	actor := UserFromContext(r.Context())
+
+	if !actor.HasRole(domain.RoleAdmin) {
+		tokens, err := h.store.ListAPITokens(actor.ID)
+		if err != nil {
+			reqLogger(r, h.logger).Error("failed to list api tokens", zap.Int64("user_id", actor.ID), zap.Error(err))
+			http.Error(w, "Failed to revoke token", http.StatusInternalServerError)
+			return
+		}
+		owned := false
+		for _, token := range tokens {
+			if token.ID == tokenID {
+				owned = true
+				break
+			}
+		}
+		if !owned {
+			http.Error(w, "Token not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	err := h.store.RevokeAPIToken(tokenID)
+	switch {
+	case errors.Is(err, domain.ErrNotFound):
+		http.Error(w, "Token not found", http.StatusNotFound)
+		return
+	case err != nil:
+		reqLogger(r, h.logger).Error("failed to revoke api token", zap.Int64("token_id", tokenID), zap.Error(err))
+		http.Error(w, "Failed to revoke token", http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(h.store, h.logger, r, domain.AuditActionTokenRevoke, auditTokenTarget(tokenID), nil)
+	reqLogger(r, h.logger).Info("api token revoked", zap.Int64("token_id", tokenID), zap.String("by", actorName(r)))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// auditUserTarget returns the audit target for an admin user
+func auditUserTarget(id int64) string {
+	return "user:" + strconv.FormatInt(id, 10)
+}
+
+// auditTokenTarget returns the audit target for an API token
+func auditTokenTarget(id int64) string {
+	return "token:" + strconv.FormatInt(id, 10)
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"go.uber.org/zap"
+)
+
+// maxWebhookBodySize limits how much of a webhook payload is read
+const maxWebhookBodySize = 1 << 20
+
+// WebhookHandler handles Synology Drive change notifications
+type WebhookHandler struct {
+	secret  string
+	changes func([]domain.DriveChange)
+	trigger func()
+	logger  *zap.Logger
+}
+
+// NewWebhookHandler creates a new WebhookHandler.
+// changes is called with the changes of every authenticated notification,
+// trigger for notifications without changes or with ones that cannot be
+// read. Neither may block.
+func NewWebhookHandler(secret string, changes func([]domain.DriveChange), trigger func(), logger *zap.Logger) *WebhookHandler {
+	return &WebhookHandler{
+		secret:  secret,
+		changes: changes,
+		trigger: trigger,
+		logger:  logger,
+	}
+}
+
+// webhookPayload is the body of a Drive change notification
+type webhookPayload struct {
+	Changes []struct {
+		Seq     int64  `json:"seq"`
+		Type    string `json:"type"`
+		FileID  string `json:"file_id"`
+		Path    string `json:"path"`
+		OldPath string `json:"old_path"`
+		IsDir   bool   `json:"is_dir"`
+	} `json:"changes"`
+}
+
+// HandleDriveWebhook handles POST /webhook/drive
+// The changes of the notification are applied without listing the NAS; an
+// empty body requests an incremental sync.
+func (h *WebhookHandler) HandleDriveWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	secret := r.Header.Get("X-Webhook-Secret")
+	if secret == "" {
+		secret = r.URL.Query().Get("secret")
+	}
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(h.secret)) != 1 {
+		reqLogger(r, h.logger).Warn("rejected drive webhook with invalid secret",
+			zap.String("client_ip", clientIP(r)))
+		http.Error(w, "Invalid webhook secret", http.StatusUnauthorized)
+		return
+	}
+
+	changes, err := parseDriveChanges(io.LimitReader(r.Body, maxWebhookBodySize))
+	if err != nil {
+		// Something changed, but not what; list the NAS instead
+		reqLogger(r, h.logger).Warn("unreadable drive webhook, running incremental sync",
+			zap.String("client_ip", clientIP(r)),
+			zap.Error(err))
+		h.trigger()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	reqLogger(r, h.logger).Debug("drive webhook received",
+		zap.String("client_ip", clientIP(r)),
+		zap.Int("changes", len(changes)))
+	if len(changes) == 0 {
+		h.trigger()
+	} else {
+		h.changes(changes)
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// parseDriveChanges reads the changes of a notification body; an empty body has none
+func parseDriveChanges(body io.Reader) ([]domain.DriveChange, error) {
+	var payload webhookPayload
+	if err := json.NewDecoder(body).Decode(&payload); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("invalid notification: %w", err)
+	}
+
+	changes := make([]domain.DriveChange, 0, len(payload.Changes))
+	for i, c := range payload.Changes {
+		if !domain.IsDriveChangeType(c.Type) {
+			return nil, fmt.Errorf("change %d: unknown type %q", i, c.Type)
+		}
+		if c.Path == "" && (c.Type != domain.DriveChangeDelete || c.FileID == "") {
+			return nil, fmt.Errorf("change %d: path is required", i)
+		}
+		changes = append(changes, domain.DriveChange{
+			Seq:     c.Seq,
+			Type:    c.Type,
+			FileID:  c.FileID,
+			Path:    c.Path,
+			OldPath: c.OldPath,
+			IsDir:   c.IsDir,
+		})
+	}
+	return changes, nil
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"go.uber.org/zap"
+)
+
+func TestWebhookHandler_DriveChanges(t *testing.T) {
+	var changes []domain.DriveChange
+	triggered := 0
+	h := NewWebhookHandler("s3cret", func(c []domain.DriveChange) { changes = append(changes, c...) },
+		func() { triggered++ }, zap.NewNop())
+
+	post := func(secret, body string) int {
+		r := httptest.NewRequest(http.MethodPost, "/webhook/drive", strings.NewReader(body))
+		r.Header.Set("X-Webhook-Secret", secret)
+		w := httptest.NewRecorder()
+		h.HandleDriveWebhook(w, r)
+		return w.Code
+	}
+
+	tests := []struct {
+		name      string
+		secret    string
+		body      string
+		want      int
+		changes   int
+		triggered int
+	}{
+		{"wrong secret", "nope", `{"changes":[]}`, http.StatusUnauthorized, 0, 0},
+		{"changes", "s3cret", `{"changes":[
+			{"seq":1,"type":"create","file_id":"882","path":"/mydrive/a.txt"},
+			{"seq":2,"type":"delete","file_id":"883"}]}`, http.StatusAccepted, 2, 0},
+		{"empty body", "s3cret", ``, http.StatusAccepted, 0, 1},
+		{"no changes", "s3cret", `{}`, http.StatusAccepted, 0, 1},
+		{"malformed", "s3cret", `{"changes":`, http.StatusBadRequest, 0, 1},
+		{"unknown type", "s3cret", `{"changes":[{"seq":3,"type":"copy","path":"/mydrive/a.txt"}]}`, http.StatusBadRequest, 0, 1},
+		{"no path", "s3cret", `{"changes":[{"seq":3,"type":"update"}]}`, http.StatusBadRequest, 0, 1},
+	}
+	for _, tt := range tests {
+		changes, triggered = nil, 0
+		if got := post(tt.secret, tt.body); got != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, got, tt.want)
+		}
+		if len(changes) != tt.changes || triggered != tt.triggered {
+			t.Errorf("%s: %d changes, %d syncs; want %d and %d", tt.name, len(changes), triggered, tt.changes, tt.triggered)
+		}
+	}
+
+	changes = nil
+	post("s3cret", `{"changes":[{"seq":9,"type":"move","file_id":"882","path":"/mydrive/b.txt","old_path":"/mydrive/a.txt"}]}`)
+	want := domain.DriveChange{Seq: 9, Type: domain.DriveChangeMove, FileID: "882", Path: "/mydrive/b.txt", OldPath: "/mydrive/a.txt"}
+	if len(changes) != 1 || changes[0] != want {
+		t.Errorf("changes = %+v, want %+v", changes, want)
+	}
+}
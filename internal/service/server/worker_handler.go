@@ -0,0 +1,78 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"go.uber.org/zap"
+)
+
+// WorkerHandler reports what the download workers are doing
+type WorkerHandler struct {
+	workers func() []domain.WorkerStatus
+	logger  *zap.Logger
+}
+
+// NewWorkerHandler creates a new WorkerHandler
+func NewWorkerHandler(workers func() []domain.WorkerStatus, logger *zap.Logger) *WorkerHandler {
+	return &WorkerHandler{
+		workers: workers,
+		logger:  logger,
+	}
+}
+
+// workerResponse is the JSON representation of a download worker
+type workerResponse struct {
+	ID             string        `json:"id"`
+	State          string        `json:"state"`
+	MaxPriority    *int          `json:"max_priority,omitempty"` // Reserved worker: least urgent priority it claims
+	Task           *taskResponse `json:"task,omitempty"`
+	TaskStartedAt  *time.Time    `json:"task_started_at,omitempty"`
+	BytesPerSecond float64       `json:"bytes_per_second"`
+	BytesReceived  int64         `json:"bytes_received"`
+	TasksCompleted int           `json:"tasks_completed"`
+	TasksFailed    int           `json:"tasks_failed"`
+	LastError      string        `json:"last_error,omitempty"`
+	LastHeartbeat  time.Time     `json:"last_heartbeat"`
+	LastDataAt     *time.Time    `json:"last_data_at,omitempty"`
+}
+
+// workersResponse lists the workers with their combined receive rate
+type workersResponse struct {
+	Workers        []workerResponse `json:"workers"`
+	BytesPerSecond float64          `json:"bytes_per_second"`
+}
+
+// HandleWorkers serves GET /api/v1/workers
+func (h *WorkerHandler) HandleWorkers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	statuses := h.workers()
+	resp := workersResponse{Workers: make([]workerResponse, 0, len(statuses))}
+	for _, s := range statuses {
+		item := workerResponse{
+			ID:             s.ID,
+			State:          s.State,
+			MaxPriority:    s.MaxPriority,
+			TaskStartedAt:  s.TaskStartedAt,
+			BytesPerSecond: s.BytesPerSecond,
+			BytesReceived:  s.BytesReceived,
+			TasksCompleted: s.TasksCompleted,
+			TasksFailed:    s.TasksFailed,
+			LastError:      s.LastError,
+			LastHeartbeat:  s.LastHeartbeat,
+			LastDataAt:     s.LastDataAt,
+		}
+		if s.Task != nil {
+			task := newTaskResponse(s.Task)
+			item.Task = &task
+		}
+		resp.Workers = append(resp.Workers, item)
+		resp.BytesPerSecond += s.BytesPerSecond
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,156 @@
+// Package stats samples cache and queue statistics into the stats history
+// shown by the admin dashboard and the /api/v1/stats API.
+//
+// Request and transfer counters are kept in memory and reset with every
+// snapshot, so each snapshot holds the activity of one interval. The
+// maintenance service takes the snapshots and prunes old ones.
+package stats
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"go.uber.org/zap"
+)
+
+// Config contains statistics sampling configuration
+type Config struct {
+	// Interval is how often the maintenance service takes a snapshot
+	Interval time.Duration
+
+	// Instance identifies this instance's snapshots in a shared database
+	Instance string
+}
+
+// DefaultConfig returns default statistics configuration
+func DefaultConfig() *Config {
+	return &Config{
+		Interval: 5 * time.Minute,
+	}
+}
+
+// Counters count share requests and transferred bytes between snapshots.
+// A nil *Counters ignores all updates.
+type Counters struct {
+	hits       atomic.Int64
+	misses     atomic.Int64
+	downloaded atomic.Int64
+	served     atomic.Int64
+}
+
+// RecordHit counts a share request served from the cache
+func (c *Counters) RecordHit() {
+	if c != nil {
+		c.hits.Add(1)
+	}
+}
+
+// RecordMiss counts a share request for a file that was not cached
+func (c *Counters) RecordMiss() {
+	if c != nil {
+		c.misses.Add(1)
+	}
+}
+
+// RecordDownload counts bytes downloaded from the NAS
+func (c *Counters) RecordDownload(bytes int64) {
+	if c != nil {
+		c.downloaded.Add(bytes)
+	}
+}
+
+// RecordServed counts bytes sent to share clients
+func (c *Counters) RecordServed(bytes int64) {
+	if c != nil {
+		c.served.Add(bytes)
+	}
+}
+
+// take moves the counts since the previous call into the snapshot and resets them
+func (c *Counters) take(snapshot *domain.StatSnapshot) {
+	snapshot.CacheHits = c.hits.Swap(0)
+	snapshot.CacheMisses = c.misses.Swap(0)
+	snapshot.DownloadedBytes = c.downloaded.Swap(0)
+	snapshot.ServedBytes = c.served.Swap(0)
+}
+
+// Repository is the subset of the store the snapshots are built from and written to
+type Repository interface {
+	port.StatsRepository
+	GetQueueStats() (*domain.QueueStats, error)
+}
+
+// Service builds statistics snapshots
+type Service struct {
+	config   *Config
+	store    Repository
+	counters *Counters
+	logger   *zap.Logger
+}
+
+// New creates a new statistics Service
+func New(cfg *Config, store Repository, logger *zap.Logger) *Service {
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+	defaults := DefaultConfig()
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaults.Interval
+	}
+
+	return &Service{
+		config:   cfg,
+		store:    store,
+		counters: &Counters{},
+		logger:   logger,
+	}
+}
+
+// Counters returns the counters recorded into the snapshots
+func (s *Service) Counters() *Counters {
+	return s.counters
+}
+
+// Instance returns the instance the snapshots are recorded for
+func (s *Service) Instance() string {
+	return s.config.Instance
+}
+
+// Interval returns how often snapshots are taken
+func (s *Service) Interval() time.Duration {
+	return s.config.Interval
+}
+
+// Snapshot records the current statistics and the counters since the previous snapshot
+func (s *Service) Snapshot() {
+	snapshot := &domain.StatSnapshot{
+		Instance: s.config.Instance,
+		TakenAt:  time.Now(),
+	}
+	s.counters.take(snapshot)
+
+	cacheStats, err := s.store.GetCacheStats()
+	if err != nil {
+		s.logger.Error("failed to get cache stats for snapshot", zap.Error(err))
+		return
+	}
+	snapshot.TotalFiles = cacheStats.TotalFiles
+	snapshot.CachedFiles = cacheStats.CachedFiles
+	snapshot.CachedBytes = cacheStats.CachedSizeBytes
+
+	queueStats, err := s.store.GetQueueStats()
+	if err != nil {
+		s.logger.Error("failed to get queue stats for snapshot", zap.Error(err))
+		return
+	}
+	snapshot.PendingTasks = queueStats.PendingCount
+	snapshot.InProgressTasks = queueStats.InProgressCount
+	snapshot.FailedTasks = queueStats.FailedCount
+	snapshot.QueuedBytes = queueStats.TotalBytesQueued
+
+	if err := s.store.AddStatSnapshot(snapshot); err != nil {
+		s.logger.Error("failed to record stats snapshot", zap.Error(err))
+	}
+}
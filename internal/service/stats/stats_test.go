@@ -0,0 +1,75 @@
+package stats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"go.uber.org/zap"
+)
+
+// mockRepository records snapshots in memory
+type mockRepository struct {
+	snapshots []*domain.StatSnapshot
+}
+
+func (m *mockRepository) GetCacheStats() (*domain.CacheStats, error) {
+	return &domain.CacheStats{TotalFiles: 10, CachedFiles: 4, CachedSizeBytes: 4096}, nil
+}
+
+func (m *mockRepository) GetQueueStats() (*domain.QueueStats, error) {
+	return &domain.QueueStats{PendingCount: 3, InProgressCount: 1, FailedCount: 2, TotalBytesQueued: 300}, nil
+}
+
+func (m *mockRepository) AddStatSnapshot(snapshot *domain.StatSnapshot) error {
+	m.snapshots = append(m.snapshots, snapshot)
+	return nil
+}
+
+func (m *mockRepository) ListStatSnapshots(instance string, since, until time.Time) ([]*domain.StatSnapshot, error) {
+	return m.snapshots, nil
+}
+
+func (m *mockRepository) DeleteStatSnapshotsBefore(maxAge time.Duration) (int, error) {
+	return 0, nil
+}
+
+func TestSnapshotResetsCounters(t *testing.T) {
+	repo := &mockRepository{}
+	s := New(&Config{Instance: "node-1"}, repo, zap.NewNop())
+
+	c := s.Counters()
+	c.RecordHit()
+	c.RecordHit()
+	c.RecordMiss()
+	c.RecordDownload(1000)
+	c.RecordDownload(24)
+	c.RecordServed(4096)
+	s.Snapshot()
+	s.Snapshot()
+
+	if len(repo.snapshots) != 2 {
+		t.Fatalf("snapshots = %d, want 2", len(repo.snapshots))
+	}
+
+	first := repo.snapshots[0]
+	if first.Instance != "node-1" || first.CacheHits != 2 || first.CacheMisses != 1 || first.DownloadedBytes != 1024 || first.ServedBytes != 4096 {
+		t.Errorf("first snapshot = %+v, want node-1 with 2 hits, 1 miss, 1024 bytes downloaded, 4096 served", first)
+	}
+	if first.CachedBytes != 4096 || first.PendingTasks != 3 || first.InProgressTasks != 1 || first.QueuedBytes != 300 {
+		t.Errorf("first snapshot = %+v, want store statistics", first)
+	}
+
+	second := repo.snapshots[1]
+	if second.CacheHits != 0 || second.CacheMisses != 0 || second.DownloadedBytes != 0 || second.ServedBytes != 0 {
+		t.Errorf("second snapshot counters = %+v, want zero", second)
+	}
+}
+
+func TestNilCountersIgnoreUpdates(t *testing.T) {
+	var c *Counters
+	c.RecordHit()
+	c.RecordMiss()
+	c.RecordDownload(10)
+	c.RecordServed(10)
+}
@@ -0,0 +1,465 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/util/cryptfile"
+	"go.uber.org/zap"
+)
+
+// Transcoding modes
+const (
+	ModeAuto      = "auto"      // Remux H.264 sources, transcode everything else
+	ModeCopy      = "copy"      // Always remux the video stream
+	ModeTranscode = "transcode" // Always transcode to H.264
+)
+
+const (
+	playlistName   = "index.m3u8"
+	completeMarker = ".complete"
+)
+
+var (
+	// ErrUnsupported is returned for files that cannot be streamed
+	ErrUnsupported = errors.New("streaming not supported for this file type")
+
+	// ErrNotReady is returned when no segment was produced within the ready timeout
+	ErrNotReady = errors.New("stream is not ready yet")
+
+	// ErrSegmentNotFound is returned for unknown or not yet written segments
+	ErrSegmentNotFound = errors.New("segment not found")
+)
+
+// segmentPattern matches segment names written by ffmpeg
+var segmentPattern = regexp.MustCompile(`^seg[0-9]{5}\.ts$`)
+
+// videoExtensions are the file types offered as HLS streams
+var videoExtensions = map[string]bool{
+	".mp4": true, ".m4v": true, ".mov": true, ".mkv": true, ".avi": true,
+	".webm": true, ".wmv": true, ".mpg": true, ".mpeg": true, ".ts": true, ".3gp": true,
+}
+
+// Config contains HLS streamer configuration
+type Config struct {
+	// Dir is where playlists and segments are stored
+	Dir string
+
+	// FFmpegPath / FFprobePath are the binaries; empty looks them up in PATH
+	FFmpegPath  string
+	FFprobePath string
+
+	// Mode selects remuxing or transcoding (auto, copy, transcode)
+	Mode string
+
+	// SegmentDuration is the target HLS segment length
+	SegmentDuration time.Duration
+
+	// Workers limits concurrently running ffmpeg jobs; further jobs queue
+	Workers int
+
+	// ReadyTimeout is how long a playlist request waits for the first segment
+	ReadyTimeout time.Duration
+
+	// JobTimeout bounds a single ffmpeg run
+	JobTimeout time.Duration
+
+	// Keys decrypts cached files encrypted at rest (nil = read as stored).
+	// An encrypted file is decrypted to a temporary copy in the job
+	// directory while it is segmented.
+	Keys *cryptfile.Keyring
+}
+
+// DefaultConfig returns default streamer configuration
+func DefaultConfig() *Config {
+	return &Config{
+		Mode:            ModeAuto,
+		SegmentDuration: 6 * time.Second,
+		Workers:         2,
+		ReadyTimeout:    15 * time.Second,
+		JobTimeout:      2 * time.Hour,
+	}
+}
+
+// job is a running or finished segmenting run for one file version
+type job struct {
+	dir  string
+	done chan struct{}
+	err  error
+}
+
+// Streamer segments cached video files into HLS streams with ffmpeg.
+// Segments are kept on disk and reused until cleaned up.
+type Streamer struct {
+	config  *Config
+	ffmpeg  string
+	ffprobe string // empty if unavailable; auto mode then always transcodes
+	logger  *zap.Logger
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	sem    chan struct{}
+	wg     sync.WaitGroup
+
+	mu   sync.Mutex
+	jobs map[string]*job // keyed by job directory
+}
+
+// New creates a new Streamer. Returns an error if ffmpeg is not available.
+func New(cfg *Config, logger *zap.Logger) (*Streamer, error) {
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+	defaults := DefaultConfig()
+	if cfg.Mode == "" {
+		cfg.Mode = defaults.Mode
+	}
+	if cfg.SegmentDuration <= 0 {
+		cfg.SegmentDuration = defaults.SegmentDuration
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = defaults.Workers
+	}
+	if cfg.ReadyTimeout <= 0 {
+		cfg.ReadyTimeout = defaults.ReadyTimeout
+	}
+	if cfg.JobTimeout <= 0 {
+		cfg.JobTimeout = defaults.JobTimeout
+	}
+
+	switch cfg.Mode {
+	case ModeAuto, ModeCopy, ModeTranscode:
+	default:
+		return nil, fmt.Errorf("invalid stream mode %q", cfg.Mode)
+	}
+	if cfg.Dir == "" {
+		return nil, fmt.Errorf("stream directory is required")
+	}
+
+	ffmpeg, err := lookPath(cfg.FFmpegPath, "ffmpeg")
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg not found: %w", err)
+	}
+	ffprobe, err := lookPath(cfg.FFprobePath, "ffprobe")
+	if err != nil && cfg.Mode == ModeAuto {
+		logger.Info("ffprobe not found, all streams will be transcoded")
+	}
+
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create stream dir: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Streamer{
+		config:  cfg,
+		ffmpeg:  ffmpeg,
+		ffprobe: ffprobe,
+		logger:  logger,
+		ctx:     ctx,
+		cancel:  cancel,
+		sem:     make(chan struct{}, cfg.Workers),
+		jobs:    make(map[string]*job),
+	}, nil
+}
+
+// lookPath resolves a configured binary, falling back to name in PATH
+func lookPath(configured, name string) (string, error) {
+	if configured == "" {
+		configured = name
+	}
+	return exec.LookPath(configured)
+}
+
+// Supports reports whether a file path can be streamed
+func (s *Streamer) Supports(path string) bool {
+	return videoExtensions[strings.ToLower(filepath.Ext(path))]
+}
+
+// IsSegmentName reports whether name looks like a segment of a stream
+func IsSegmentName(name string) bool {
+	return segmentPattern.MatchString(name)
+}
+
+// jobDir returns the directory for a file version; a newer cached copy gets a new directory
+func (s *Streamer) jobDir(file *domain.File) (string, error) {
+	info, err := os.Stat(file.CachePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to stat cached file: %w", err)
+	}
+	return filepath.Join(s.config.Dir, fmt.Sprintf("%d-%d", file.ID, info.ModTime().Unix())), nil
+}
+
+// Playlist returns the path of the HLS playlist for a cached video, starting
+// segmentation if needed. It waits up to ReadyTimeout for the first segment.
+func (s *Streamer) Playlist(ctx context.Context, file *domain.File) (string, error) {
+	if !s.Supports(file.Path) {
+		return "", ErrUnsupported
+	}
+	if !file.Cached || file.CachePath == "" {
+		return "", domain.ErrFileNotCached
+	}
+
+	dir, err := s.jobDir(file)
+	if err != nil {
+		return "", err
+	}
+	playlist := filepath.Join(dir, playlistName)
+
+	if _, err := os.Stat(filepath.Join(dir, completeMarker)); err == nil {
+		// Keep frequently watched streams from being cleaned up
+		now := time.Now()
+		os.Chtimes(dir, now, now)
+		return playlist, nil
+	}
+
+	j := s.startJob(file, dir)
+
+	ctx, cancel := context.WithTimeout(ctx, s.config.ReadyTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		if hasSegment(playlist) {
+			return playlist, nil
+		}
+
+		select {
+		case <-j.done:
+			if j.err != nil {
+				return "", j.err
+			}
+			return playlist, nil
+		case <-ctx.Done():
+			return "", ErrNotReady
+		case <-ticker.C:
+		}
+	}
+}
+
+// Segment returns the path of a written segment of a file's stream
+func (s *Streamer) Segment(file *domain.File, name string) (string, error) {
+	if !IsSegmentName(name) {
+		return "", ErrSegmentNotFound
+	}
+
+	dir, err := s.jobDir(file)
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, name)
+
+	// A segment is only complete once the playlist references it
+	data, err := os.ReadFile(filepath.Join(dir, playlistName))
+	if err != nil || !bytes.Contains(data, []byte(name)) {
+		return "", ErrSegmentNotFound
+	}
+	if _, err := os.Stat(path); err != nil {
+		return "", ErrSegmentNotFound
+	}
+	return path, nil
+}
+
+// hasSegment reports whether a playlist lists at least one segment
+func hasSegment(playlist string) bool {
+	data, err := os.ReadFile(playlist)
+	return err == nil && bytes.Contains(data, []byte("#EXTINF"))
+}
+
+// startJob returns the running job for dir, starting one if needed
+func (s *Streamer) startJob(file *domain.File, dir string) *job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if j, ok := s.jobs[dir]; ok {
+		select {
+		case <-j.done:
+			if j.err == nil {
+				return j
+			}
+			// Retry failed runs on the next request
+		default:
+			return j
+		}
+	}
+
+	j := &job{dir: dir, done: make(chan struct{})}
+	s.jobs[dir] = j
+
+	s.wg.Add(1)
+	go s.run(j, file.ID, file.CachePath)
+
+	return j
+}
+
+// run executes a segmenting job once a worker slot is free
+func (s *Streamer) run(j *job, fileID int64, src string) {
+	defer s.wg.Done()
+	defer close(j.done)
+
+	select {
+	case s.sem <- struct{}{}:
+		defer func() { <-s.sem }()
+	case <-s.ctx.Done():
+		j.err = s.ctx.Err()
+		return
+	}
+
+	// Leftovers of an interrupted run can't be resumed
+	os.RemoveAll(j.dir)
+	if err := os.MkdirAll(j.dir, 0755); err != nil {
+		j.err = fmt.Errorf("failed to create stream dir: %w", err)
+		return
+	}
+
+	src, cleanup, err := cryptfile.PlainPath(src, s.config.Keys, j.dir)
+	if err != nil {
+		os.RemoveAll(j.dir)
+		j.err = fmt.Errorf("failed to decrypt cached file: %w", err)
+		return
+	}
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(s.ctx, s.config.JobTimeout)
+	defer cancel()
+
+	start := time.Now()
+	remux := s.canRemux(ctx, src)
+
+	s.logger.Info("stream segmentation started",
+		zap.Int64("file_id", fileID),
+		zap.Bool("remux", remux))
+
+	if err := s.segment(ctx, src, j.dir, remux); err != nil {
+		os.RemoveAll(j.dir)
+		j.err = err
+		s.logger.Warn("stream segmentation failed",
+			zap.Int64("file_id", fileID),
+			zap.Error(err))
+		return
+	}
+
+	if err := os.WriteFile(filepath.Join(j.dir, completeMarker), nil, 0644); err != nil {
+		j.err = fmt.Errorf("failed to mark stream complete: %w", err)
+		return
+	}
+
+	s.logger.Info("stream segmentation finished",
+		zap.Int64("file_id", fileID),
+		zap.Duration("duration", time.Since(start)))
+
+	s.mu.Lock()
+	delete(s.jobs, j.dir)
+	s.mu.Unlock()
+}
+
+// canRemux decides whether the video stream can be copied instead of transcoded
+func (s *Streamer) canRemux(ctx context.Context, src string) bool {
+	switch s.config.Mode {
+	case ModeCopy:
+		return true
+	case ModeTranscode:
+		return false
+	}
+	if s.ffprobe == "" {
+		return false
+	}
+
+	out, err := exec.CommandContext(ctx, s.ffprobe,
+		"-v", "error",
+		"-select_streams", "v:0",
+		"-show_entries", "stream=codec_name",
+		"-of", "csv=p=0",
+		src,
+	).Output()
+	if err != nil {
+		return false
+	}
+	// Browsers play H.264 in MPEG-TS; other codecs need transcoding
+	return strings.TrimSpace(string(out)) == "h264"
+}
+
+// segment runs ffmpeg to write an HLS playlist and segments into dir
+func (s *Streamer) segment(ctx context.Context, src, dir string, remux bool) error {
+	args := []string{
+		"-hide_banner", "-loglevel", "error",
+		"-i", src,
+		"-map", "0:v:0", "-map", "0:a:0?",
+	}
+	if remux {
+		args = append(args, "-c:v", "copy")
+	} else {
+		args = append(args, "-c:v", "libx264", "-preset", "veryfast", "-crf", "23", "-pix_fmt", "yuv420p")
+	}
+	args = append(args,
+		"-c:a", "aac", "-b:a", "160k", "-ac", "2",
+		"-f", "hls",
+		"-hls_time", strconv.Itoa(int(s.config.SegmentDuration.Seconds())),
+		// event playlists grow while segments are written so playback can start early
+		"-hls_playlist_type", "event",
+		"-hls_segment_filename", filepath.Join(dir, "seg%05d.ts"),
+		filepath.Join(dir, playlistName),
+	)
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, s.ffmpeg, args...)
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ffmpeg failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// Stop aborts running jobs and waits for them to exit
+func (s *Streamer) Stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+// CleanOld removes streams not generated or played within maxAge.
+// Directories of running jobs are kept. Returns the number of streams removed.
+func (s *Streamer) CleanOld(maxAge time.Duration) (int, error) {
+	threshold := time.Now().Add(-maxAge)
+
+	entries, err := os.ReadDir(s.config.Dir)
+	if err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := 0
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		dir := filepath.Join(s.config.Dir, entry.Name())
+		if _, running := s.jobs[dir]; running {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || !info.ModTime().Before(threshold) {
+			continue
+		}
+		if err := os.RemoveAll(dir); err == nil {
+			count++
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,142 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"go.uber.org/zap"
+)
+
+// fakeFFmpeg writes a one-segment playlist next to the output path it is given
+const fakeFFmpeg = `#!/bin/sh
+for last; do :; done
+dir=$(dirname "$last")
+printf 'segment' > "$dir/seg00000.ts"
+printf '#EXTM3U\n#EXTINF:6.0,\nseg00000.ts\n#EXT-X-ENDLIST\n' > "$last"
+`
+
+func newTestStreamer(t *testing.T) (*Streamer, *domain.File) {
+	t.Helper()
+
+	dir := t.TempDir()
+	ffmpeg := filepath.Join(dir, "ffmpeg")
+	if err := os.WriteFile(ffmpeg, []byte(fakeFFmpeg), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	src := filepath.Join(dir, "movie.mkv")
+	if err := os.WriteFile(src, []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := New(&Config{
+		Dir:        filepath.Join(dir, "streams"),
+		FFmpegPath: ffmpeg,
+		Mode:       ModeTranscode,
+	}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(s.Stop)
+
+	return s, &domain.File{ID: 7, Path: "/videos/movie.mkv", CachePath: src, Cached: true}
+}
+
+func TestIsSegmentName(t *testing.T) {
+	tests := map[string]bool{
+		"seg00000.ts":     true,
+		"seg12345.ts":     true,
+		"seg1.ts":         false,
+		"index.m3u8":      false,
+		"../seg00000.ts":  false,
+		"seg00000.ts.bak": false,
+	}
+	for name, want := range tests {
+		if got := IsSegmentName(name); got != want {
+			t.Errorf("IsSegmentName(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestNew_RequiresFFmpeg(t *testing.T) {
+	_, err := New(&Config{Dir: t.TempDir(), FFmpegPath: "/nonexistent/ffmpeg"}, zap.NewNop())
+	if err == nil {
+		t.Fatal("expected error when ffmpeg is missing")
+	}
+}
+
+func TestStreamer_PlaylistAndSegment(t *testing.T) {
+	s, file := newTestStreamer(t)
+
+	playlist, err := s.Playlist(context.Background(), file)
+	if err != nil {
+		t.Fatalf("Playlist() error = %v", err)
+	}
+	if !hasSegment(playlist) {
+		t.Fatal("playlist has no segments")
+	}
+
+	segPath, err := s.Segment(file, "seg00000.ts")
+	if err != nil {
+		t.Fatalf("Segment() error = %v", err)
+	}
+	if data, _ := os.ReadFile(segPath); string(data) != "segment" {
+		t.Errorf("segment content = %q", data)
+	}
+
+	if _, err := s.Segment(file, "seg00001.ts"); !errors.Is(err, ErrSegmentNotFound) {
+		t.Errorf("Segment(unlisted) error = %v, want ErrSegmentNotFound", err)
+	}
+
+	// Wait for the job to be marked complete, then expect reuse without a new job
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(filepath.Join(filepath.Dir(playlist), completeMarker)); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("stream was not marked complete")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if _, err := s.Playlist(context.Background(), file); err != nil {
+		t.Fatalf("Playlist() on complete stream error = %v", err)
+	}
+}
+
+func TestStreamer_Unsupported(t *testing.T) {
+	s, file := newTestStreamer(t)
+	file.Path = "/docs/report.pdf"
+
+	if _, err := s.Playlist(context.Background(), file); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Playlist() error = %v, want ErrUnsupported", err)
+	}
+}
+
+func TestStreamer_CleanOld(t *testing.T) {
+	s, file := newTestStreamer(t)
+
+	playlist, err := s.Playlist(context.Background(), file)
+	if err != nil {
+		t.Fatalf("Playlist() error = %v", err)
+	}
+	s.Stop()
+
+	old := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(filepath.Dir(playlist), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := s.CleanOld(24 * time.Hour)
+	if err != nil {
+		t.Fatalf("CleanOld() error = %v", err)
+	}
+	if removed != 1 {
+		t.Errorf("CleanOld() removed = %d, want 1", removed)
+	}
+}
@@ -0,0 +1,221 @@
+package syncer
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"go.uber.org/zap"
+)
+
+// maxScopeDecisions is how many decisions SyncScope reports
+const maxScopeDecisions = 20
+
+// AutoTuneConfig bounds how the sync scope follows the cache hit ratio
+type AutoTuneConfig struct {
+	Enabled             bool
+	MinRequests         int64   // Share requests needed since the last decision before deciding again
+	WidenMissRatio      float64 // Widen when at least this share of requests missed the cache
+	ShrinkUnservedRatio float64 // Shrink when at least this share of cached bytes was never served
+	MinRecentDays       int
+	MaxRecentDays       int
+	MaxScanDepth        int // Folder scan depth is raised up to this (0 = depth is not tuned)
+}
+
+// DefaultAutoTuneConfig returns the default tuning bounds, disabled
+func DefaultAutoTuneConfig() AutoTuneConfig {
+	return AutoTuneConfig{
+		MinRequests:         100,
+		WidenMissRatio:      0.2,
+		ShrinkUnservedRatio: 0.8,
+		MinRecentDays:       7,
+		MaxRecentDays:       90,
+	}
+}
+
+// scopeTuner widens the sync scope when share requests keep missing the
+// cache and shrinks it when the cache is dominated by files nobody requests.
+// It decides once per full sync from the counters accumulated since its last
+// decision; the scope starts from the configuration again after a restart.
+type scopeTuner struct {
+	config AutoTuneConfig
+	stats  port.StatsRepository
+	logger *zap.Logger
+
+	mu         sync.Mutex
+	recentDays int
+	scanDepth  int   // 0 = unlimited, never tuned
+	hits       int64 // Counter totals at the last decision
+	misses     int64
+	baseline   bool // hits and misses are set
+	decisions  []domain.ScopeDecision
+}
+
+func newScopeTuner(cfg AutoTuneConfig, stats port.StatsRepository, recentDays, scanDepth int, logger *zap.Logger) *scopeTuner {
+	return &scopeTuner{
+		config:     cfg,
+		stats:      stats,
+		logger:     logger,
+		recentDays: recentDays,
+		scanDepth:  scanDepth,
+	}
+}
+
+// recentModifiedDays returns the current recent-files window
+func (t *scopeTuner) recentModifiedDays() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.recentDays
+}
+
+// evaluate decides on the scope from the counters since the last decision
+// and returns the folder scan depth to use
+func (t *scopeTuner) evaluate(now time.Time) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stats, err := t.stats.GetCacheStats()
+	if err != nil {
+		t.logger.Warn("failed to load cache stats for scope tuning", zap.Error(err))
+		return t.scanDepth
+	}
+	if !t.baseline {
+		// Counters from before this process ran say nothing about its scope
+		t.hits, t.misses, t.baseline = stats.AccessCount, stats.MissCount, true
+		return t.scanDepth
+	}
+
+	hits, misses := stats.AccessCount-t.hits, stats.MissCount-t.misses
+	if hits+misses < t.config.MinRequests {
+		t.logger.Debug("too few share requests to tune the sync scope",
+			zap.Int64("requests", hits+misses),
+			zap.Int64("min_requests", t.config.MinRequests))
+		return t.scanDepth
+	}
+	t.hits, t.misses = stats.AccessCount, stats.MissCount
+
+	d := domain.ScopeDecision{
+		At:        now,
+		Action:    domain.ScopeKeep,
+		Hits:      hits,
+		Misses:    misses,
+		MissRatio: float64(misses) / float64(hits+misses),
+	}
+	if stats.CachedSizeBytes > 0 {
+		d.UnservedRatio = float64(stats.UnservedCachedBytes) / float64(stats.CachedSizeBytes)
+	}
+
+	switch {
+	case d.MissRatio >= t.config.WidenMissRatio:
+		d.Reason = fmt.Sprintf("miss ratio %.2f at or above %.2f", d.MissRatio, t.config.WidenMissRatio)
+		if t.widen() {
+			d.Action = domain.ScopeWiden
+		} else {
+			d.Reason += ", scope at its maximum"
+		}
+	case d.UnservedRatio >= t.config.ShrinkUnservedRatio && d.MissRatio < t.config.WidenMissRatio/2:
+		d.Reason = fmt.Sprintf("%.2f of cached bytes never served, at or above %.2f", d.UnservedRatio, t.config.ShrinkUnservedRatio)
+		if t.shrink() {
+			d.Action = domain.ScopeShrink
+		} else {
+			d.Reason += ", scope at its minimum"
+		}
+	default:
+		d.Reason = "hit ratio within bounds"
+	}
+	d.RecentModifiedDays, d.ScanMaxDepth = t.recentDays, t.scanDepth
+
+	t.decisions = append(t.decisions, d)
+	if len(t.decisions) > maxScopeDecisions {
+		t.decisions = t.decisions[len(t.decisions)-maxScopeDecisions:]
+	}
+
+	log := t.logger.Debug
+	if d.Action != domain.ScopeKeep {
+		log = t.logger.Info
+	}
+	log("sync scope tuned",
+		zap.String("action", d.Action),
+		zap.String("reason", d.Reason),
+		zap.Int64("hits", hits),
+		zap.Int64("misses", misses),
+		zap.Int("recent_modified_days", t.recentDays),
+		zap.Int("scan_max_depth", t.scanDepth))
+	return t.scanDepth
+}
+
+// widen looks further back for recent files and one folder level deeper;
+// it reports whether anything changed
+func (t *scopeTuner) widen() bool {
+	changed := false
+	if t.recentDays < t.config.MaxRecentDays {
+		t.recentDays = min(t.recentDays+scopeStep(t.recentDays), t.config.MaxRecentDays)
+		changed = true
+	}
+	if t.scanDepth > 0 && t.scanDepth < t.config.MaxScanDepth {
+		t.scanDepth++
+		changed = true
+	}
+	return changed
+}
+
+// shrink is the reverse of widen, keeping at least one folder level
+func (t *scopeTuner) shrink() bool {
+	changed := false
+	if t.recentDays > t.config.MinRecentDays {
+		t.recentDays = max(t.recentDays-scopeStep(t.recentDays), t.config.MinRecentDays)
+		changed = true
+	}
+	if t.scanDepth > 1 && t.config.MaxScanDepth > 0 {
+		t.scanDepth--
+		changed = true
+	}
+	return changed
+}
+
+// scopeStep is a quarter of the recent-files window, at least a day
+func scopeStep(days int) int {
+	return max(days/4, 1)
+}
+
+// scope returns the current scope and the decisions that led to it
+func (t *scopeTuner) scope() *domain.SyncScope {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return &domain.SyncScope{
+		RecentModifiedDays: t.recentDays,
+		ScanMaxDepth:       t.scanDepth,
+		Decisions:          append([]domain.ScopeDecision(nil), t.decisions...),
+	}
+}
+
+// EnableAutoTune adjusts RecentModifiedDays and the folder scan depth after
+// every full sync from the cache hit ratio, within config.AutoTune
+func (s *Syncer) EnableAutoTune(stats port.StatsRepository) {
+	s.tuner = newScopeTuner(s.config.AutoTune, stats, s.config.RecentModifiedDays, s.config.ScanMaxDepth, s.logger)
+}
+
+// SyncScope returns the tuned sync scope, nil unless auto-tuning is enabled
+func (s *Syncer) SyncScope() *domain.SyncScope {
+	if s.tuner == nil {
+		return nil
+	}
+	return s.tuner.scope()
+}
+
+// recentModifiedDays returns how far back recently modified files are cached
+func (s *Syncer) recentModifiedDays() int {
+	if s.tuner == nil {
+		return s.config.RecentModifiedDays
+	}
+	return s.tuner.recentModifiedDays()
+}
+
+// tuneScope lets the tuner decide on the scope of the next syncs
+func (s *Syncer) tuneScope() {
+	if s.tuner != nil {
+		s.scanner.setMaxDepth(s.tuner.evaluate(time.Now()))
+	}
+}
@@ -0,0 +1,92 @@
+package syncer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"go.uber.org/zap"
+)
+
+// counterStats reports access counter totals set by the test
+type counterStats struct {
+	port.StatsRepository
+	stats domain.CacheStats
+}
+
+func (m *counterStats) GetCacheStats() (*domain.CacheStats, error) {
+	stats := m.stats
+	return &stats, nil
+}
+
+func TestScopeTuner(t *testing.T) {
+	stats := &counterStats{stats: domain.CacheStats{AccessCount: 1000, MissCount: 1000, CachedSizeBytes: 100}}
+	cfg := DefaultAutoTuneConfig()
+	cfg.Enabled = true
+	cfg.MaxRecentDays = 40
+	cfg.MaxScanDepth = 4
+	tuner := newScopeTuner(cfg, stats, 30, 3, zap.NewNop())
+	now := time.Now()
+
+	// The first evaluation only records the counters of earlier runs
+	if depth := tuner.evaluate(now); depth != 3 || len(tuner.scope().Decisions) != 0 {
+		t.Fatalf("first evaluation: depth %d, scope %+v", depth, tuner.scope())
+	}
+
+	// Too few requests since then
+	stats.stats.AccessCount, stats.stats.MissCount = 1010, 1040
+	tuner.evaluate(now)
+	if len(tuner.scope().Decisions) != 0 {
+		t.Fatalf("decided on 50 requests: %+v", tuner.scope())
+	}
+
+	// 150 requests, 60 of them misses: widen
+	stats.stats.AccessCount, stats.stats.MissCount = 1090, 1060
+	if depth := tuner.evaluate(now); depth != 4 {
+		t.Errorf("depth after widening = %d, want 4", depth)
+	}
+	scope := tuner.scope()
+	d := scope.Decisions[0]
+	if d.Action != domain.ScopeWiden || d.Hits != 90 || d.Misses != 60 || d.MissRatio != 0.4 {
+		t.Errorf("decision = %+v, want widen on 90 hits and 60 misses", d)
+	}
+	if scope.RecentModifiedDays != 37 || tuner.recentModifiedDays() != 37 {
+		t.Errorf("recent days = %d, want 37", scope.RecentModifiedDays)
+	}
+
+	// Still missing, but the bounds are reached
+	stats.stats.MissCount += 100
+	tuner.evaluate(now)
+	stats.stats.MissCount += 100
+	tuner.evaluate(now)
+	scope = tuner.scope()
+	if last := scope.Decisions[len(scope.Decisions)-1]; last.Action != domain.ScopeKeep || scope.RecentModifiedDays != 40 || scope.ScanMaxDepth != 4 {
+		t.Errorf("at the bounds: %+v, last decision %+v", scope, last)
+	}
+
+	// Every request hits, but most cached bytes were never served: shrink
+	stats.stats.AccessCount += 200
+	stats.stats.UnservedCachedBytes = 90
+	if depth := tuner.evaluate(now); depth != 3 {
+		t.Errorf("depth after shrinking = %d, want 3", depth)
+	}
+	scope = tuner.scope()
+	if last := scope.Decisions[len(scope.Decisions)-1]; last.Action != domain.ScopeShrink || last.UnservedRatio != 0.9 || scope.RecentModifiedDays != 30 {
+		t.Errorf("shrink: %+v, last decision %+v", scope, last)
+	}
+}
+
+func TestSyncer_RecentModifiedDays(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.RecentModifiedDays = 14
+	s := New(cfg, nil, nil, nil, nil, zap.NewNop())
+	if got := s.recentModifiedDays(); got != 14 || s.SyncScope() != nil {
+		t.Errorf("without tuning: %d days, scope %+v", got, s.SyncScope())
+	}
+
+	s.EnableAutoTune(&counterStats{})
+	if scope := s.SyncScope(); scope == nil || scope.RecentModifiedDays != 14 {
+		t.Errorf("tuned scope = %+v, want the configured 14 days", scope)
+	}
+}
@@ -0,0 +1,70 @@
+package syncer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+)
+
+// RequestCache records the file at path on the NAS with at least the given
+// priority and enqueues its download, so clients can pre-warm files before
+// they are needed. Returns the stored file and its active download task; the
+// task is nil when the file is already cached. A file the sync would not
+// enqueue (too large, missing on the NAS, rejected, over quota) is an ErrInvalidInput.
+func (s *Syncer) RequestCache(ctx context.Context, path string, priority int) (*domain.File, *domain.DownloadTask, error) {
+	return s.requestCache(ctx, path, priority, nil)
+}
+
+// requestCache records and enqueues the file at path like RequestCache,
+// applying the flag updates of opts
+func (s *Syncer) requestCache(ctx context.Context, path string, priority int, opts *SyncOptions) (*domain.File, *domain.DownloadTask, error) {
+	if priority < domain.PriorityShared || priority > domain.PriorityDefault {
+		return nil, nil, fmt.Errorf("%w: priority must be between %d and %d",
+			domain.ErrInvalidInput, domain.PriorityShared, domain.PriorityDefault)
+	}
+
+	info, err := s.drive.GetFileInfo(ctx, path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if info.IsDir() {
+		return nil, nil, fmt.Errorf("%w: %s is a folder", domain.ErrInvalidInput, path)
+	}
+
+	now := time.Now()
+	if err := s.processFile(ctx, info, priority, &now, opts); err != nil {
+		return nil, nil, err
+	}
+
+	file, err := s.files.GetBySynoID(info.GetIDString())
+	if err != nil {
+		return nil, nil, err
+	}
+	if file == nil {
+		return nil, nil, fmt.Errorf("%w: %s", domain.ErrNotFound, path)
+	}
+	if file.Cached {
+		return file, nil, nil
+	}
+
+	task, err := s.tasks.GetTaskByFileID(file.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if task != nil {
+		return file, task, nil
+	}
+
+	switch {
+	case s.config.MaxCacheSize > 0 && file.Size > s.config.MaxCacheSize:
+		return nil, nil, fmt.Errorf("%w: %s is larger than the cache", domain.ErrInvalidInput, path)
+	case file.IsMissingUpstream(s.config.MissingUpstreamTTL):
+		return nil, nil, fmt.Errorf("%w: %s recently failed as missing on the NAS", domain.ErrInvalidInput, path)
+	case file.IsRejected():
+		return nil, nil, fmt.Errorf("%w: %s was rejected (%s)", domain.ErrInvalidInput, path, file.RejectedReason)
+	default:
+		return nil, nil, fmt.Errorf("%w: %s was not enqueued, its owner or a label is over quota", domain.ErrInvalidInput, path)
+	}
+}
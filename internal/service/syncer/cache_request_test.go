@@ -0,0 +1,38 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"go.uber.org/zap"
+)
+
+func TestSyncer_RequestCacheRejects(t *testing.T) {
+	drive := &mockDriveClient{fileInfo: map[string]*port.DriveFile{
+		"/mydrive/docs": {Path: "/mydrive/docs", ContentType: "dir"},
+	}}
+	s := New(DefaultConfig(), drive, &mockFileRepository{}, nil, nil, zap.NewNop())
+
+	tests := []struct {
+		name     string
+		path     string
+		priority int
+		want     error
+	}{
+		{"priority too high", "/mydrive/a.pdf", 0, domain.ErrInvalidInput},
+		{"priority too low", "/mydrive/a.pdf", domain.PriorityDefault + 1, domain.ErrInvalidInput},
+		{"folder", "/mydrive/docs", domain.PriorityStarred, domain.ErrInvalidInput},
+		{"missing", "/mydrive/gone.pdf", domain.PriorityStarred, domain.ErrMissingUpstream},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := s.RequestCache(context.Background(), tt.path, tt.priority)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("RequestCache() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"go.uber.org/zap"
+)
+
+// ErrChangeGap means applied changes do not tell the whole story: a
+// notification was lost, had no sequence number or could not be applied.
+// The caller falls back to an incremental sync.
+var ErrChangeGap = errors.New("drive change sequence broken")
+
+// NotifyChanges queues the changes of a Drive webhook notification for the
+// incremental sync loop. It never blocks; notifications arriving while a
+// sync is pending are applied together.
+func (s *Syncer) NotifyChanges(changes []domain.DriveChange) {
+	s.pendingMu.Lock()
+	s.pending = append(s.pending, changes...)
+	s.pendingMu.Unlock()
+	s.wake()
+}
+
+// takePending returns and clears the queued changes and whether an
+// incremental sync was requested
+func (s *Syncer) takePending() ([]domain.DriveChange, bool) {
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+	changes, resync := s.pending, s.resync
+	s.pending, s.resync = nil, false
+	return changes, resync
+}
+
+// requeue puts changes that could not be applied yet back in front of the
+// queue without waking the loop; they are retried on the next notification or
+// poll. resync keeps a requested incremental sync.
+func (s *Syncer) requeue(changes []domain.DriveChange, resync bool) {
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+	s.pending = append(append([]domain.DriveChange(nil), changes...), s.pending...)
+	s.resync = s.resync || resync
+}
+
+// syncPending applies the queued changes and runs an incremental sync when
+// one was requested, a change could not be applied or poll is set. While the
+// NAS is down everything not done yet stays queued.
+func (s *Syncer) syncPending(ctx context.Context, poll bool) {
+	changes, resync := s.takePending()
+	if len(changes) > 0 {
+		_, err := s.ApplyChanges(ctx, changes)
+		if s.upstreamDown(err) {
+			s.requeue(nil, resync)
+			return
+		}
+		if err != nil {
+			// Fall back to listing the NAS
+			resync = true
+		}
+	}
+	if resync || poll {
+		if !poll {
+			s.logger.Debug("running incremental sync on request")
+		}
+		if err := s.IncrementalSync(ctx); err != nil {
+			s.logger.Error("incremental sync failed", zap.Error(err))
+		}
+	}
+}
+
+// ApplyChanges updates the files named by Drive change notifications
+// without listing the NAS: created, modified and moved files are looked up
+// and upserted like recent files, deleted files are marked missing upstream.
+// Changes older than the last applied one are skipped. Returns the number of
+// changes applied, and ErrChangeGap when the sequence has a hole or a change
+// could not be applied. When the NAS is unavailable the change that failed and
+// the ones after it are queued again and the error is returned.
+func (s *Syncer) ApplyChanges(ctx context.Context, changes []domain.DriveChange) (int, error) {
+	s.changesMu.Lock()
+	defer s.changesMu.Unlock()
+
+	// Concurrent notifications may be queued out of order
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].Seq < changes[j].Seq })
+
+	gap := false
+	applied := 0
+	now := time.Now()
+	for i, change := range changes {
+		lost := false
+		switch {
+		case change.Seq == 0:
+			gap = true
+		case s.lastSeq > 0 && change.Seq <= s.lastSeq:
+			continue // Delivered twice
+		case s.lastSeq > 0 && change.Seq != s.lastSeq+1:
+			lost = true
+		}
+
+		err := s.applyChange(ctx, change, &now)
+		if errors.Is(err, domain.ErrUpstreamUnavailable) {
+			// A hole before this change is reported again when it is retried
+			s.requeue(changes[i:], gap)
+			return applied, err
+		}
+		if lost {
+			s.logger.Warn("drive change notifications lost",
+				zap.Int64("last_seq", s.lastSeq),
+				zap.Int64("seq", change.Seq))
+			gap = true
+		}
+		// Failed changes count as done too; the fallback sync covers them
+		if change.Seq > 0 {
+			s.lastSeq = change.Seq
+		}
+		if err != nil {
+			s.logger.Warn("failed to apply drive change",
+				zap.String("type", change.Type),
+				zap.String("path", change.Path),
+				zap.Error(err))
+			gap = true
+			continue
+		}
+		applied++
+	}
+
+	s.logger.Debug("applied drive changes", zap.Int("count", applied), zap.Int64("last_seq", s.lastSeq))
+	s.publishCompleted("changes", map[string]int{"changes": applied})
+	if gap {
+		return applied, ErrChangeGap
+	}
+	return applied, nil
+}
+
+// applyChange updates the file named by one change
+func (s *Syncer) applyChange(ctx context.Context, change domain.DriveChange, now *time.Time) error {
+	if change.IsDir {
+		if change.Type == domain.DriveChangeCreate {
+			return nil // New folders are empty; their files report their own changes
+		}
+		// The files below a moved or deleted folder are not listed
+		return fmt.Errorf("folder %s changed", change.Path)
+	}
+
+	if change.Type == domain.DriveChangeDelete {
+		return s.markDeleted(change)
+	}
+
+	info, err := s.drive.GetFileInfo(ctx, change.Path)
+	if errors.Is(err, domain.ErrMissingUpstream) {
+		// Moved or deleted again since; a later change reports it
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	priority := domain.PriorityRecentModified
+	opts := &SyncOptions{}
+	switch {
+	case info.Shared:
+		priority = domain.PriorityShared
+		opts.UpdateShared = true
+		opts.CreateShareRecords = true
+	case info.Starred:
+		priority = domain.PriorityStarred
+		opts.UpdateStarred = true
+	}
+	return s.processFile(ctx, info, priority, now, opts)
+}
+
+// markDeleted marks the file of a delete change missing upstream, keeping the
+// cached copy for as long as it is still shared
+func (s *Syncer) markDeleted(change domain.DriveChange) error {
+	var file *domain.File
+	var err error
+	if change.FileID != "" {
+		file, err = s.files.GetBySynoID(change.FileID)
+	} else {
+		file, err = s.files.GetByPath(change.Path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to look up file: %w", err)
+	}
+	if file == nil {
+		return nil // Never synced
+	}
+	return s.files.MarkMissingUpstream(file.ID)
+}
@@ -0,0 +1,131 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"go.uber.org/zap"
+)
+
+func TestSyncer_ApplyChanges_Sequence(t *testing.T) {
+	s := New(nil, &mockDriveClient{}, &mockFileRepository{}, nil, nil, zap.NewNop())
+	deleted := func(seqs ...int64) []domain.DriveChange {
+		changes := make([]domain.DriveChange, 0, len(seqs))
+		for _, seq := range seqs {
+			changes = append(changes, domain.DriveChange{Seq: seq, Type: domain.DriveChangeDelete, Path: "/mydrive/a.txt"})
+		}
+		return changes
+	}
+
+	tests := []struct {
+		name    string
+		changes []domain.DriveChange
+		applied int
+		gap     bool
+		lastSeq int64
+	}{
+		{"first notification", deleted(7, 8), 2, false, 8},
+		{"out of order", deleted(10, 9), 2, false, 10},
+		{"delivered twice", deleted(9, 10, 11), 1, false, 11},
+		{"lost notification", deleted(14), 1, true, 14},
+		{"no sequence number", deleted(0), 1, true, 14},
+	}
+	for _, tt := range tests {
+		applied, err := s.ApplyChanges(context.Background(), tt.changes)
+		if applied != tt.applied {
+			t.Errorf("%s: applied = %d, want %d", tt.name, applied, tt.applied)
+		}
+		if gap := errors.Is(err, ErrChangeGap); gap != tt.gap {
+			t.Errorf("%s: error = %v, want gap %v", tt.name, err, tt.gap)
+		}
+		if s.lastSeq != tt.lastSeq {
+			t.Errorf("%s: lastSeq = %d, want %d", tt.name, s.lastSeq, tt.lastSeq)
+		}
+	}
+}
+
+func TestSyncer_ApplyChanges_FolderMoveFallsBack(t *testing.T) {
+	s := New(nil, &mockDriveClient{}, &mockFileRepository{}, nil, nil, zap.NewNop())
+
+	applied, err := s.ApplyChanges(context.Background(), []domain.DriveChange{
+		{Seq: 1, Type: domain.DriveChangeCreate, Path: "/mydrive/new", IsDir: true},
+		{Seq: 2, Type: domain.DriveChangeMove, Path: "/mydrive/docs2", OldPath: "/mydrive/docs", IsDir: true},
+	})
+	if applied != 1 || !errors.Is(err, ErrChangeGap) {
+		t.Errorf("ApplyChanges() = %d, %v; want the new folder applied and a gap for the moved one", applied, err)
+	}
+}
+
+// downDriveClient answers file lookups with ErrUpstreamUnavailable while down
+type downDriveClient struct {
+	mockDriveClient
+	down   bool
+	looked []string
+}
+
+func (m *downDriveClient) GetFileInfo(ctx context.Context, path string) (*port.DriveFile, error) {
+	m.looked = append(m.looked, path)
+	if m.down {
+		return nil, domain.ErrUpstreamUnavailable
+	}
+	return nil, domain.ErrMissingUpstream
+}
+
+func TestSyncer_ApplyChanges_UpstreamDownRequeues(t *testing.T) {
+	drive := &downDriveClient{down: true}
+	s := New(nil, drive, &mockFileRepository{}, nil, nil, zap.NewNop())
+
+	applied, err := s.ApplyChanges(context.Background(), []domain.DriveChange{
+		{Seq: 1, Type: domain.DriveChangeDelete, Path: "/mydrive/a.txt"},
+		{Seq: 2, Type: domain.DriveChangeUpdate, Path: "/mydrive/b.txt"},
+		{Seq: 3, Type: domain.DriveChangeDelete, Path: "/mydrive/c.txt"},
+	})
+	if applied != 1 || !errors.Is(err, domain.ErrUpstreamUnavailable) {
+		t.Fatalf("ApplyChanges() = %d, %v; want 1 applied and ErrUpstreamUnavailable", applied, err)
+	}
+	if s.lastSeq != 1 {
+		t.Errorf("lastSeq = %d, want 1", s.lastSeq)
+	}
+	if got := len(s.pending); got != 2 {
+		t.Fatalf("queued changes = %d, want the failed one and the one after it", got)
+	}
+
+	// Still down: kept queued
+	s.syncPending(context.Background(), false)
+	if got := len(s.pending); got != 2 {
+		t.Fatalf("queued changes = %d while down, want 2", got)
+	}
+
+	drive.down = false
+	drive.looked = nil
+	s.syncPending(context.Background(), false)
+	if len(drive.looked) != 1 || drive.looked[0] != "/mydrive/b.txt" {
+		t.Errorf("looked up %v, want the failed change retried", drive.looked)
+	}
+	if s.lastSeq != 3 || len(s.pending) != 0 {
+		t.Errorf("lastSeq = %d, queued = %d; want 3 and nothing queued", s.lastSeq, len(s.pending))
+	}
+}
+
+func TestSyncer_NotifyChanges_Queues(t *testing.T) {
+	s := New(nil, &mockDriveClient{}, nil, nil, nil, zap.NewNop())
+
+	s.NotifyChanges([]domain.DriveChange{{Seq: 1, Type: domain.DriveChangeDelete, Path: "/a"}})
+	s.NotifyChanges([]domain.DriveChange{{Seq: 2, Type: domain.DriveChangeDelete, Path: "/b"}})
+	if got := len(s.trigger); got != 1 {
+		t.Errorf("pending wakeups = %d, want 1", got)
+	}
+
+	changes, resync := s.takePending()
+	if len(changes) != 2 || resync {
+		t.Errorf("takePending() = %d changes, resync %v; want 2 changes without a resync", len(changes), resync)
+	}
+
+	s.TriggerSync()
+	if changes, resync := s.takePending(); len(changes) != 0 || !resync {
+		t.Errorf("after TriggerSync: %d changes, resync %v; want a resync only", len(changes), resync)
+	}
+}
@@ -0,0 +1,161 @@
+package syncer
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"go.uber.org/zap"
+)
+
+// dryRun collects the changes of a sync that is not applied
+type dryRun struct {
+	report *domain.SyncReport
+	seen   map[string]bool    // Files already planned by an earlier listing
+	usage  *domain.QuotaUsage // Quota usage including files planned so far, loaded on first use
+}
+
+// DryRun lists what a full sync would add, update, invalidate and enqueue
+// without writing to the database. Folders, including team folders and
+// include paths, are reported but not scanned; pre-seeded paths and File Station links are not checked.
+func (s *Syncer) DryRun(ctx context.Context) (*domain.SyncReport, error) {
+	d := &dryRun{
+		report: &domain.SyncReport{StartedAt: time.Now()},
+		seen:   make(map[string]bool),
+	}
+
+	if _, err := s.syncSharedFiles(ctx, d); err != nil {
+		return nil, fmt.Errorf("shared files: %w", err)
+	}
+	if _, err := s.syncStarredFiles(ctx, d); err != nil {
+		return nil, fmt.Errorf("starred files: %w", err)
+	}
+	if _, err := s.syncLabeledFiles(ctx, d); err != nil {
+		return nil, fmt.Errorf("labeled files: %w", err)
+	}
+	if _, err := s.syncTeamFolders(ctx, d); err != nil {
+		return nil, fmt.Errorf("team folders: %w", err)
+	}
+	if _, err := s.syncIncludePaths(ctx, d); err != nil {
+		return nil, fmt.Errorf("include paths: %w", err)
+	}
+	if _, err := s.syncRecentFiles(ctx, d); err != nil {
+		return nil, fmt.Errorf("recent files: %w", err)
+	}
+
+	d.report.Duration = time.Since(d.report.StartedAt)
+	s.logger.Info("dry-run sync completed",
+		zap.Duration("duration", d.report.Duration),
+		zap.Int("added", len(d.report.Added)),
+		zap.Int("updated", len(d.report.Updated)),
+		zap.Int("invalidated", len(d.report.Invalidated)),
+		zap.Int("enqueued", len(d.report.Enqueued)),
+		zap.Int("skipped", len(d.report.Skipped)),
+		zap.Int("revoked_shares", len(d.report.RevokedShares)))
+
+	return d.report, nil
+}
+
+// planFile records what processFile would do with candidate, mirroring
+// UpsertBySynoID and enqueueDownloadTask without writing
+func (s *Syncer) planFile(candidate *domain.File, d *dryRun) error {
+	// A file listed by several sources is upserted once per source; the first decides
+	if d.seen[candidate.SynoFileID] {
+		return nil
+	}
+	d.seen[candidate.SynoFileID] = true
+
+	existing, err := s.files.GetBySynoID(candidate.SynoFileID)
+	if err != nil {
+		return fmt.Errorf("failed to look up file: %w", err)
+	}
+
+	change := domain.SyncChange{Path: candidate.Path, Size: candidate.Size, Priority: candidate.Priority}
+	needsCaching := true
+
+	switch {
+	case existing == nil:
+		d.report.Added = append(d.report.Added, change)
+	case existing.Cached && existing.ModifiedAt != nil && candidate.ModifiedAt != nil &&
+		candidate.ModifiedAt.After(*existing.ModifiedAt):
+		change.Priority = min(existing.Priority, candidate.Priority)
+		d.report.Invalidated = append(d.report.Invalidated, change)
+	default:
+		change.Priority = min(existing.Priority, candidate.Priority)
+		if metadataChanged(existing, candidate) {
+			d.report.Updated = append(d.report.Updated, change)
+		}
+		needsCaching = !existing.Cached
+	}
+
+	if !needsCaching {
+		return nil
+	}
+
+	if s.config.MaxCacheSize > 0 && candidate.Size > s.config.MaxCacheSize {
+		change.Reason = "exceeds max cache size"
+		d.report.Skipped = append(d.report.Skipped, change)
+		return nil
+	}
+
+	if existing != nil && existing.IsMissingUpstream(s.config.MissingUpstreamTTL) &&
+		(existing.ModifiedAt == nil || candidate.ModifiedAt == nil || !candidate.ModifiedAt.After(*existing.ModifiedAt)) {
+		change.Reason = "missing upstream"
+		d.report.Skipped = append(d.report.Skipped, change)
+		return nil
+	}
+
+	if existing != nil {
+		hasTask, err := s.tasks.HasActiveTask(existing.ID)
+		if err != nil {
+			return fmt.Errorf("failed to check existing task: %w", err)
+		}
+		if hasTask {
+			return nil
+		}
+	}
+
+	if s.quota != nil {
+		if d.usage == nil {
+			usage, err := s.files.GetQuotaUsage(true)
+			if err != nil {
+				return fmt.Errorf("failed to load quota usage: %w", err)
+			}
+			d.usage = usage
+		}
+		planned := *candidate
+		planned.Priority = change.Priority
+		if !s.quota.quota.Allows(d.usage, &planned) {
+			change.Reason = "quota reached"
+			d.report.Skipped = append(d.report.Skipped, change)
+			return nil
+		}
+		if planned.Priority != domain.PriorityPinned {
+			d.usage.Add(planned.Owner, planned.Labels, planned.Size)
+		}
+	}
+
+	d.report.Enqueued = append(d.report.Enqueued, change)
+	return nil
+}
+
+// metadataChanged reports whether upserting candidate would change more than the sync time
+func metadataChanged(existing, candidate *domain.File) bool {
+	switch {
+	case existing.Path != candidate.Path, existing.Size != candidate.Size:
+		return true
+	case candidate.Priority < existing.Priority:
+		return true
+	case candidate.Starred && !existing.Starred, candidate.Shared && !existing.Shared:
+		return true
+	case candidate.ModifiedAt != nil && (existing.ModifiedAt == nil || !candidate.ModifiedAt.Equal(*existing.ModifiedAt)):
+		return true
+	case candidate.Owner != "" && candidate.Owner != existing.Owner:
+		return true
+	case !slices.Equal(candidate.Labels, existing.Labels):
+		return true
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package syncer
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"go.uber.org/zap"
+)
+
+// dryRunFiles looks files up by Synology ID
+type dryRunFiles struct {
+	mockFileRepository
+	bySynoID map[string]*domain.File
+}
+
+func (m *dryRunFiles) GetBySynoID(synoID string) (*domain.File, error) {
+	return m.bySynoID[synoID], nil
+}
+
+// activeTasks reports which files already have a download task
+type activeTasks struct {
+	port.DownloadTaskRepository
+	active map[int64]bool
+}
+
+func (m *activeTasks) HasActiveTask(fileID int64) (bool, error) {
+	return m.active[fileID], nil
+}
+
+func TestSyncer_PlanFile(t *testing.T) {
+	old := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := old.Add(time.Hour)
+
+	files := &dryRunFiles{bySynoID: map[string]*domain.File{
+		"cached":   {ID: 1, SynoFileID: "cached", Path: "/a.txt", Size: 10, ModifiedAt: &old, Cached: true, Priority: domain.PriorityStarred},
+		"modified": {ID: 2, SynoFileID: "modified", Path: "/b.txt", Size: 10, ModifiedAt: &old, Cached: true, Priority: domain.PriorityStarred},
+		"queued":   {ID: 3, SynoFileID: "queued", Path: "/c.txt", Size: 10, ModifiedAt: &old, Priority: domain.PriorityStarred},
+	}}
+	cfg := DefaultConfig()
+	cfg.MaxCacheSize = 100
+	s := New(cfg, &mockDriveClient{}, files, nil, &activeTasks{active: map[int64]bool{3: true}}, zap.NewNop())
+
+	d := &dryRun{report: &domain.SyncReport{}, seen: make(map[string]bool)}
+	candidates := []*domain.File{
+		{SynoFileID: "new", Path: "/new.txt", Size: 5, ModifiedAt: &newer, Priority: domain.PriorityShared},
+		{SynoFileID: "new", Path: "/new.txt", Size: 5, ModifiedAt: &newer, Priority: domain.PriorityStarred},
+		{SynoFileID: "huge", Path: "/huge.iso", Size: 500, ModifiedAt: &newer, Priority: domain.PriorityStarred},
+		{SynoFileID: "cached", Path: "/a.txt", Size: 10, ModifiedAt: &old, Priority: domain.PriorityStarred},
+		{SynoFileID: "modified", Path: "/b.txt", Size: 12, ModifiedAt: &newer, Priority: domain.PriorityStarred},
+		{SynoFileID: "queued", Path: "/c.txt", Size: 10, ModifiedAt: &old, Priority: domain.PriorityShared},
+	}
+	for _, c := range candidates {
+		if err := s.planFile(c, d); err != nil {
+			t.Fatalf("planFile(%s) error = %v", c.Path, err)
+		}
+	}
+
+	paths := func(changes []domain.SyncChange) []string {
+		var p []string
+		for _, c := range changes {
+			p = append(p, c.Path)
+		}
+		return p
+	}
+	check := func(name string, got []domain.SyncChange, want ...string) {
+		t.Helper()
+		if g := paths(got); !reflect.DeepEqual(g, want) {
+			t.Errorf("%s = %v, want %v", name, g, want)
+		}
+	}
+
+	r := d.report
+	check("Added", r.Added, "/new.txt", "/huge.iso")
+	check("Updated", r.Updated, "/c.txt")
+	check("Invalidated", r.Invalidated, "/b.txt")
+	check("Enqueued", r.Enqueued, "/new.txt", "/b.txt")
+	check("Skipped", r.Skipped, "/huge.iso")
+	if r.Added[0].Priority != domain.PriorityShared {
+		t.Errorf("first listing should decide priority, got %d", r.Added[0].Priority)
+	}
+	if r.Skipped[0].Reason == "" {
+		t.Error("skipped file has no reason")
+	}
+}
@@ -0,0 +1,88 @@
+package syncer
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// ExcludePattern is a glob that keeps matching files and folders out of
+// recursive scans. A pattern ending in "/" only matches folders, a pattern
+// without "/" matches the name at any depth, and "**" matches any number
+// of folders, e.g. "**/*.iso", "node_modules/" or "/team/archive/**".
+type ExcludePattern struct {
+	segments []string
+	dirOnly  bool
+	nameOnly bool
+}
+
+// ParseExcludePatterns parses exclusion globs
+func ParseExcludePatterns(specs []string) ([]ExcludePattern, error) {
+	patterns := make([]ExcludePattern, 0, len(specs))
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+
+		p := ExcludePattern{dirOnly: strings.HasSuffix(spec, "/")}
+		glob := strings.Trim(spec, "/")
+		if glob == "" {
+			return nil, fmt.Errorf("invalid exclude pattern %q", spec)
+		}
+		p.nameOnly = !strings.Contains(glob, "/")
+		p.segments = strings.Split(glob, "/")
+		for _, seg := range p.segments {
+			if _, err := path.Match(seg, ""); err != nil {
+				return nil, fmt.Errorf("invalid exclude pattern %q: %w", spec, err)
+			}
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns, nil
+}
+
+// matches reports whether the Drive path p of a file or folder matches
+func (e ExcludePattern) matches(p string, isDir bool) bool {
+	if e.dirOnly && !isDir {
+		return false
+	}
+	if e.nameOnly {
+		ok, _ := path.Match(e.segments[0], path.Base(p))
+		return ok
+	}
+	return matchSegments(e.segments, strings.Split(strings.Trim(p, "/"), "/"))
+}
+
+// matchSegments matches path segments against glob segments, where "**"
+// matches zero or more segments
+func matchSegments(globs, segs []string) bool {
+	for len(globs) > 0 {
+		if globs[0] == "**" {
+			for i := 0; i <= len(segs); i++ {
+				if matchSegments(globs[1:], segs[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segs) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(globs[0], segs[0]); !ok {
+			return false
+		}
+		globs, segs = globs[1:], segs[1:]
+	}
+	return len(segs) == 0
+}
+
+// isExcluded reports whether any pattern matches the path
+func isExcluded(patterns []ExcludePattern, p string, isDir bool) bool {
+	for _, e := range patterns {
+		if e.matches(p, isDir) {
+			return true
+		}
+	}
+	return false
+}
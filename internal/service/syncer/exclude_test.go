@@ -0,0 +1,42 @@
+package syncer
+
+import "testing"
+
+func TestParseExcludePatterns(t *testing.T) {
+	if _, err := ParseExcludePatterns([]string{"**/*.iso", " node_modules/ ", ""}); err != nil {
+		t.Fatalf("ParseExcludePatterns() error = %v", err)
+	}
+	for _, spec := range []string{"/", "[a-"} {
+		if _, err := ParseExcludePatterns([]string{spec}); err == nil {
+			t.Errorf("ParseExcludePatterns(%q) succeeded, want error", spec)
+		}
+	}
+}
+
+func TestIsExcluded(t *testing.T) {
+	patterns, err := ParseExcludePatterns([]string{"**/*.iso", "node_modules/", "/team/archive/**", "*.tmp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"/images/ubuntu.iso", false, true},
+		{"/ubuntu.iso", false, true},
+		{"/src/app/node_modules", true, true},
+		{"/src/app/node_modules", false, false},
+		{"/team/archive/2020/report.pdf", false, true},
+		{"/team/archive", true, true},
+		{"/team/docs/report.pdf", false, false},
+		{"/docs/draft.tmp", false, true},
+		{"/docs/draft.txt", false, false},
+	}
+	for _, tt := range tests {
+		if got := isExcluded(patterns, tt.path, tt.isDir); got != tt.want {
+			t.Errorf("isExcluded(%q, %v) = %v, want %v", tt.path, tt.isDir, got, tt.want)
+		}
+	}
+}
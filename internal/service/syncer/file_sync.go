@@ -2,6 +2,7 @@ package syncer
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -11,7 +12,7 @@ import (
 )
 
 // FileFetcher is a function that fetches files with pagination
-type FileFetcher func(offset, limit int) (*port.DriveListResponse, error)
+type FileFetcher func(ctx context.Context, offset, limit int) (*port.DriveListResponse, error)
 
 // SyncOptions contains options for syncing files
 type SyncOptions struct {
@@ -20,77 +21,74 @@ type SyncOptions struct {
 	UpdateStarred      bool
 	CreateShareRecords bool
 	ScanDirs           bool
+	ListedShares       map[string]bool // Collects the share tokens of listed files, nil to skip
+	DryRun             *dryRun         // Records changes instead of writing them, nil for a normal sync
 }
 
 // syncFilesWithFetcher syncs files using a generic fetcher function
 // This eliminates code duplication between syncSharedFiles, syncStarredFiles, etc.
+// Once the first page reveals the total, the remaining pages are fetched
+// concurrently while files are still processed in page order.
 func (s *Syncer) syncFilesWithFetcher(ctx context.Context, fetcher FileFetcher, opts *SyncOptions) (int, error) {
 	now := time.Now()
-	count := 0
-	offset := 0
 	limit := s.config.PageSize
 	if limit <= 0 {
 		limit = 200
 	}
 
-	for {
+	first, err := fetcher(ctx, 0, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch files at offset %d: %w", 0, err)
+	}
+	s.logger.Debug("fetched files batch",
+		zap.Int("offset", 0),
+		zap.Int("fetched", len(first.Items)),
+		zap.Int("total", first.Total))
+
+	count, err := s.processPage(ctx, first, &now, opts)
+	if err != nil {
+		return count, err
+	}
+
+	// Stop if we've fetched all items
+	if len(first.Items) == 0 || len(first.Items) >= first.Total || len(first.Items) < limit {
+		return count, nil
+	}
+
+	var offsets []int
+	for offset := len(first.Items); offset < first.Total; offset += limit {
+		offsets = append(offsets, offset)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	pages, release := s.prefetchPages(ctx, fetcher, offsets, limit)
+
+	for _, page := range pages {
+		var result pageResult
 		select {
+		case result = <-page:
 		case <-ctx.Done():
 			return count, ctx.Err()
-		default:
 		}
-
-		// Fetch files with pagination
-		resp, err := fetcher(offset, limit)
-		if err != nil {
-			return count, fmt.Errorf("failed to fetch files at offset %d: %w", offset, err)
+		if result.err != nil {
+			return count, fmt.Errorf("failed to fetch files at offset %d: %w", result.offset, result.err)
 		}
 
 		s.logger.Debug("fetched files batch",
-			zap.Int("offset", offset),
-			zap.Int("fetched", len(resp.Items)),
-			zap.Int("total", resp.Total))
-
-		if len(resp.Items) == 0 {
-			break
-		}
+			zap.Int("offset", result.offset),
+			zap.Int("fetched", len(result.resp.Items)),
+			zap.Int("total", result.resp.Total))
 
-		for _, file := range resp.Items {
-			select {
-			case <-ctx.Done():
-				return count, ctx.Err()
-			default:
-			}
-
-			// Handle directories with scanning
-			if file.IsDir() {
-				if opts.ScanDirs {
-					result, err := s.scanner.ScanPath(ctx, file.Path, opts.Priority)
-					if err != nil {
-						s.logger.Warn("failed to scan folder",
-							zap.String("path", file.Path),
-							zap.Error(err))
-					} else {
-						count += result.AddedFiles + result.UpdatedFiles
-					}
-				}
-				continue
-			}
-
-			if err := s.processFile(ctx, &file, opts.Priority, &now, opts); err != nil {
-				s.logger.Warn("failed to process file",
-					zap.String("path", file.Path),
-					zap.Error(err))
-				continue
-			}
-			count++
+		n, err := s.processPage(ctx, result.resp, &now, opts)
+		count += n
+		if err != nil {
+			return count, err
 		}
+		release()
 
-		// Move to next page
-		offset += len(resp.Items)
-
-		// Stop if we've fetched all items
-		if offset >= resp.Total || len(resp.Items) < limit {
+		// A short page means the listing shrank since the first page
+		if len(result.resp.Items) < limit {
 			break
 		}
 	}
@@ -98,133 +96,159 @@ func (s *Syncer) syncFilesWithFetcher(ctx context.Context, fetcher FileFetcher,
 	return count, nil
 }
 
-// processFile creates or updates a file in the database and enqueues download task if needed
-func (s *Syncer) processFile(ctx context.Context, file *port.DriveFile, priority int, now *time.Time, opts *SyncOptions) error {
-	fileID := file.GetIDString()
-	fileIDInt := file.GetID()
+// pageResult is a fetched page of a listing
+type pageResult struct {
+	offset int
+	resp   *port.DriveListResponse
+	err    error
+}
 
-	// Check if file exists in database
-	existing, err := s.files.GetBySynoID(fileID)
-	if err != nil {
-		return fmt.Errorf("failed to check existing file: %w", err)
+// prefetchPages fetches the pages at offsets with up to FetchConcurrency
+// requests in flight. Each page is delivered on its own channel; release must
+// be called after a page was handled, so fetching never runs more than
+// FetchConcurrency pages ahead. Cancel ctx to stop fetching early.
+func (s *Syncer) prefetchPages(ctx context.Context, fetcher FileFetcher, offsets []int, limit int) ([]chan pageResult, func()) {
+	workers := s.config.FetchConcurrency
+	if workers < 1 {
+		workers = 1
 	}
 
-	var dbFile *domain.File
-	var wasInvalidated bool
-	var isNew bool
-
-	if existing != nil {
-		dbFile = existing
-
-		// Update existing file metadata
-		existing.Path = file.Path
-		existing.Size = file.Size
-		existing.LastSyncAt = now
+	pages := make([]chan pageResult, len(offsets))
+	for i := range pages {
+		pages[i] = make(chan pageResult, 1)
+	}
+	sem := make(chan struct{}, workers)
 
-		// Update flags based on options
-		if opts != nil {
-			if opts.UpdateShared {
-				existing.Shared = true
-			}
-			if opts.UpdateStarred {
-				existing.Starred = true
+	go func() {
+		for i, offset := range offsets {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
 			}
+			go func(page chan<- pageResult, offset int) {
+				resp, err := fetcher(ctx, offset, limit)
+				page <- pageResult{offset: offset, resp: resp, err: err}
+			}(pages[i], offset)
 		}
+	}()
 
-		// Update priority if higher
-		existing.UpdatePriority(priority)
-
-		// Check if file was modified and invalidate cache
-		mtime := file.GetMTime()
-		if mtime != nil && existing.ShouldInvalidateCache(*mtime) {
-			s.logger.Info("file modified, invalidating cache",
-				zap.String("path", file.Path),
-				zap.Time("old_mtime", *existing.ModifiedAt),
-				zap.Time("new_mtime", *mtime))
-			// Use dedicated InvalidateCache to avoid race condition
-			if err := s.files.InvalidateCache(existing.ID); err != nil {
-				s.logger.Warn("failed to invalidate cache",
-					zap.String("path", file.Path),
-					zap.Error(err))
-			}
-			existing.Cached = false
-			existing.CachePath = ""
-			wasInvalidated = true
-		}
+	return pages, func() { <-sem }
+}
 
-		if mtime != nil {
-			existing.ModifiedAt = mtime
-		}
-		if atime := file.GetATime(); atime != nil {
-			existing.AccessedAt = atime
+// processPage syncs the files of one listing page and returns how many were synced
+func (s *Syncer) processPage(ctx context.Context, resp *port.DriveListResponse, now *time.Time, opts *SyncOptions) (int, error) {
+	count := 0
+	for _, file := range resp.Items {
+		select {
+		case <-ctx.Done():
+			return count, ctx.Err()
+		default:
 		}
 
-		// Use UpdateMetadata to avoid overwriting cache status set by cacher
-		if err := s.files.UpdateMetadata(existing); err != nil {
-			return fmt.Errorf("failed to update file: %w", err)
+		if opts.ListedShares != nil && file.PermanentLink != "" {
+			opts.ListedShares[file.PermanentLink] = true
 		}
 
-		// Create share record if needed
-		if opts != nil && opts.CreateShareRecords && file.PermanentLink != "" {
-			if err := s.shareSyncer.CreateOrUpdateShare(existing.ID, fileIDInt, file.PermanentLink); err != nil {
-				s.logger.Warn("failed to create/update share record",
-					zap.String("path", file.Path),
-					zap.Error(err))
+		// Handle directories with scanning
+		if file.IsDir() {
+			if opts.ScanDirs && opts.DryRun != nil {
+				opts.DryRun.report.Folders = append(opts.DryRun.report.Folders, file.Path)
+			} else if opts.ScanDirs {
+				result, err := s.scanner.ScanPath(ctx, file.Path, opts.Priority)
+				if errors.Is(err, domain.ErrUpstreamUnavailable) {
+					return count, err
+				}
+				if err != nil {
+					s.logger.Warn("failed to scan folder",
+						zap.String("path", file.Path),
+						zap.Error(err))
+				} else {
+					count += result.AddedFiles + result.UpdatedFiles
+				}
 			}
-		}
-	} else {
-		isNew = true
-
-		// Create new file
-		newFile := &domain.File{
-			SynoFileID: fileID,
-			Path:       file.Path,
-			Size:       file.Size,
-			Starred:    file.Starred,
-			Shared:     file.Shared,
-			Priority:   priority,
-			LastSyncAt: now,
+			continue
 		}
 
-		// Update flags based on options
-		if opts != nil {
-			if opts.UpdateShared {
-				newFile.Shared = true
-			}
-			if opts.UpdateStarred {
-				newFile.Starred = true
-			}
+		if err := s.processFile(ctx, &file, opts.Priority, now, opts); err != nil {
+			s.logger.Warn("failed to process file",
+				zap.String("path", file.Path),
+				zap.Error(err))
+			continue
 		}
+		count++
+	}
+	return count, nil
+}
 
-		if mtime := file.GetMTime(); mtime != nil {
-			newFile.ModifiedAt = mtime
-		}
-		if atime := file.GetATime(); atime != nil {
-			newFile.AccessedAt = atime
-		}
+// processFile upserts a file in the database and enqueues download task if needed
+func (s *Syncer) processFile(ctx context.Context, file *port.DriveFile, priority int, now *time.Time, opts *SyncOptions) error {
+	fileIDInt := file.GetID()
 
-		if err := s.files.Create(newFile); err != nil {
-			return fmt.Errorf("failed to create file: %w", err)
+	candidate := &domain.File{
+		SynoFileID:  file.GetIDString(),
+		Path:        file.Path,
+		Size:        file.Size,
+		Starred:     file.Starred,
+		Shared:      file.Shared,
+		Priority:    priority,
+		LastSyncAt:  now,
+		ModifiedAt:  file.GetMTime(),
+		AccessedAt:  file.GetATime(),
+		Owner:       file.Owner.Name,
+		Labels:      file.LabelNames(),
+		ContentType: file.MIMEType(),
+	}
+
+	// Update flags based on options
+	if opts != nil {
+		if opts.UpdateShared {
+			candidate.Shared = true
+		}
+		if opts.UpdateStarred {
+			candidate.Starred = true
 		}
+	}
 
-		dbFile = newFile
+	if opts != nil && opts.DryRun != nil {
+		return s.planFile(candidate, opts.DryRun)
+	}
 
-		// Create share record if needed
-		if opts != nil && opts.CreateShareRecords && file.PermanentLink != "" {
-			if err := s.shareSyncer.CreateOrUpdateShare(newFile.ID, fileIDInt, file.PermanentLink); err != nil {
-				s.logger.Warn("failed to create share record",
-					zap.String("path", file.Path),
-					zap.Error(err))
-			}
-		}
+	// Atomic upsert preserves cache status set by cacher
+	result, err := s.files.UpsertBySynoID(candidate)
+	if err != nil {
+		return fmt.Errorf("failed to upsert file: %w", err)
+	}
+	dbFile := result.File
 
+	if result.Stale {
+		s.logger.Info("file modified, serving stale copy while revalidating",
+			zap.String("path", file.Path),
+			zap.Timep("old_mtime", result.PreviousModifiedAt),
+			zap.Timep("new_mtime", candidate.ModifiedAt))
+	} else if result.Invalidated {
+		s.logger.Info("file modified, cache invalidated",
+			zap.String("path", file.Path),
+			zap.Timep("old_mtime", result.PreviousModifiedAt),
+			zap.Timep("new_mtime", candidate.ModifiedAt))
+	}
+	if result.Created {
 		s.logger.Debug("file added",
 			zap.String("path", file.Path),
 			zap.Int("priority", priority))
 	}
 
+	// Create share record if needed
+	if opts != nil && opts.CreateShareRecords && file.PermanentLink != "" {
+		if err := s.shareSyncer.CreateOrUpdateShare(ctx, dbFile.ID, fileIDInt, file.PermanentLink); err != nil {
+			s.logger.Warn("failed to create/update share record",
+				zap.String("path", file.Path),
+				zap.Error(err))
+		}
+	}
+
 	// Enqueue download task if file needs caching
-	if isNew || wasInvalidated || !dbFile.Cached {
+	if result.Created || result.Invalidated || !dbFile.Cached || dbFile.Stale {
 		s.enqueueDownloadTask(dbFile)
 	}
 
@@ -247,8 +271,8 @@ func (s *Syncer) enqueueDownloadTask(file *domain.File) {
 		return
 	}
 
-	// Skip if file is already cached
-	if latestFile.Cached {
+	// Skip if file is already cached; a stale copy is still replaced
+	if latestFile.Cached && !latestFile.Stale {
 		s.logger.Debug("file already cached, skipping task enqueue",
 			zap.String("path", file.Path))
 		return
@@ -263,6 +287,24 @@ func (s *Syncer) enqueueDownloadTask(file *domain.File) {
 		return
 	}
 
+	// Skip if a recent download found the file deleted on the NAS.
+	// The upsert clears the mark when a newer version was synced.
+	if latestFile.IsMissingUpstream(s.config.MissingUpstreamTTL) {
+		s.logger.Debug("file missing upstream, skipping task enqueue",
+			zap.String("path", file.Path),
+			zap.Timep("missing_upstream_at", latestFile.MissingUpstreamAt))
+		return
+	}
+
+	// Skip if a pre-serve hook refused the last download, e.g. it was
+	// infected. The upsert clears the mark when a newer version was synced.
+	if latestFile.IsRejected() {
+		s.logger.Debug("file rejected by a pre-serve hook, skipping task enqueue",
+			zap.String("path", file.Path),
+			zap.String("reason", latestFile.RejectedReason))
+		return
+	}
+
 	// Check if task already exists
 	hasTask, err := s.tasks.HasActiveTask(file.ID)
 	if err != nil {
@@ -278,6 +320,15 @@ func (s *Syncer) enqueueDownloadTask(file *domain.File) {
 		return
 	}
 
+	// Skip if the owner or a label has used up its quota
+	if s.quota != nil && !s.quota.allow(latestFile) {
+		s.logger.Debug("quota reached, skipping task enqueue",
+			zap.String("path", file.Path),
+			zap.String("owner", latestFile.Owner),
+			zap.Strings("labels", latestFile.Labels))
+		return
+	}
+
 	maxRetries := s.config.MaxDownloadRetries
 	if maxRetries <= 0 {
 		maxRetries = 3
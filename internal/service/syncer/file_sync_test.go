@@ -0,0 +1,78 @@
+package syncer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"go.uber.org/zap"
+)
+
+// pagedFetcher serves a listing of n files in pages, answering out of order
+func pagedFetcher(n int, failAt int, calls *atomic.Int32) FileFetcher {
+	return func(ctx context.Context, offset, limit int) (*port.DriveListResponse, error) {
+		calls.Add(1)
+		time.Sleep(time.Duration(rand.Intn(3)) * time.Millisecond)
+		if offset == failAt {
+			return nil, errors.New("listing failed")
+		}
+		resp := &port.DriveListResponse{Total: n}
+		for i := offset; i < n && i < offset+limit; i++ {
+			resp.Items = append(resp.Items, port.DriveFile{
+				ID:          json.Number(fmt.Sprint(i + 1)),
+				Path:        fmt.Sprintf("/f%03d", i),
+				ContentType: "file",
+			})
+		}
+		return resp, nil
+	}
+}
+
+func TestSyncer_SyncFilesWithFetcher_ParallelPagesInOrder(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.PageSize = 10
+	cfg.FetchConcurrency = 4
+	s := New(cfg, &mockDriveClient{}, &dryRunFiles{}, nil, &activeTasks{}, zap.NewNop())
+
+	var calls atomic.Int32
+	d := &dryRun{report: &domain.SyncReport{}, seen: make(map[string]bool)}
+	count, err := s.syncFilesWithFetcher(context.Background(), pagedFetcher(95, -1, &calls), &SyncOptions{DryRun: d})
+	if err != nil {
+		t.Fatalf("syncFilesWithFetcher() error = %v", err)
+	}
+
+	if count != 95 || len(d.report.Added) != 95 {
+		t.Fatalf("count = %d, added = %d, want 95", count, len(d.report.Added))
+	}
+	for i, c := range d.report.Added {
+		if want := fmt.Sprintf("/f%03d", i); c.Path != want {
+			t.Fatalf("Added[%d] = %s, want %s", i, c.Path, want)
+		}
+	}
+	if got := calls.Load(); got != 10 {
+		t.Errorf("fetches = %d, want 10", got)
+	}
+}
+
+func TestSyncer_SyncFilesWithFetcher_PageError(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.PageSize = 10
+	s := New(cfg, &mockDriveClient{}, &dryRunFiles{}, nil, &activeTasks{}, zap.NewNop())
+
+	var calls atomic.Int32
+	d := &dryRun{report: &domain.SyncReport{}, seen: make(map[string]bool)}
+	count, err := s.syncFilesWithFetcher(context.Background(), pagedFetcher(100, 30, &calls), &SyncOptions{DryRun: d})
+	if err == nil {
+		t.Fatal("syncFilesWithFetcher() succeeded, want error")
+	}
+	if count != 30 {
+		t.Errorf("count = %d, want the 30 files before the failed page", count)
+	}
+}
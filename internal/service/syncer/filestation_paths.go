@@ -0,0 +1,64 @@
+package syncer
+
+import (
+	"context"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/vertextoedge/synology-file-cache/internal/port"
+)
+
+// volumePrefix matches the volume File Station paths may start with
+var volumePrefix = regexp.MustCompile(`^/volume\d+(/|$)`)
+
+// driveHomeFolder is the folder of a user's home holding their My Drive
+const driveHomeFolder = "Drive"
+
+// fileStationPaths maps File Station paths (/home/Drive/..., /homes/{user}/Drive/...,
+// /{shared folder}/..., optionally below /volumeN) to the Drive display paths
+// the files table is keyed by
+type fileStationPaths struct {
+	teamFolders map[string]string // Lower-cased shared folder name -> Drive path of its team folder
+}
+
+// loadFileStationPaths lists the team folders; without a Drive client only
+// home paths are mapped
+func loadFileStationPaths(ctx context.Context, drive port.DriveClient) (*fileStationPaths, error) {
+	p := &fileStationPaths{teamFolders: make(map[string]string)}
+	if drive == nil {
+		return p, nil
+	}
+	folders, err := drive.GetTeamFolders(ctx)
+	if err != nil {
+		return p, err
+	}
+	for _, folder := range folders {
+		if folder.Name != "" && folder.Path != "" {
+			p.teamFolders[strings.ToLower(folder.Name)] = folder.Path
+		}
+	}
+	return p, nil
+}
+
+// drivePath returns the Drive path of a File Station path and, for paths in
+// another user's home, the owner the file must have. ok is false for paths
+// outside My Drive and the team folders.
+func (p *fileStationPaths) drivePath(fsPath string) (drivePath, owner string, ok bool) {
+	clean := path.Clean("/" + fsPath)
+	if loc := volumePrefix.FindStringIndex(clean); loc != nil {
+		clean = path.Clean("/" + clean[loc[1]:])
+	}
+	parts := strings.Split(strings.TrimPrefix(clean, "/"), "/")
+
+	switch {
+	case len(parts) >= 2 && parts[0] == "home" && parts[1] == driveHomeFolder:
+		return path.Join("/mydrive", path.Join(parts[2:]...)), "", true
+	case len(parts) >= 3 && parts[0] == "homes" && parts[2] == driveHomeFolder:
+		return path.Join("/mydrive", path.Join(parts[3:]...)), parts[1], true
+	}
+	if root, found := p.teamFolders[strings.ToLower(parts[0])]; found {
+		return path.Join(root, path.Join(parts[1:]...)), "", true
+	}
+	return "", "", false
+}
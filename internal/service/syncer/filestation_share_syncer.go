@@ -0,0 +1,216 @@
+package syncer
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"go.uber.org/zap"
+)
+
+// fileStationShareIDPrefix distinguishes File Station links from Drive shares in syno_share_id
+const fileStationShareIDPrefix = "filestation:"
+
+// FileStationShareSyncer imports File Station sharing links into the shares table.
+// Only links that point to a file already tracked by the Drive sync are imported,
+// since cached content is downloaded through the Drive API. Link paths are
+// mapped to Drive paths: homes to /mydrive, shared folders to their team folder.
+type FileStationShareSyncer struct {
+	fs       port.FileStationClient
+	drive    port.DriveClient // Lists team folders; nil maps home paths only
+	files    port.FileRepository
+	shares   port.ShareRepository
+	audit    port.AuditRepository // nil disables audit events
+	revoker  *shareRevoker        // nil leaves links removed on the NAS untouched
+	pageSize int
+	logger   *zap.Logger
+}
+
+// NewFileStationShareSyncer creates a new FileStationShareSyncer
+func NewFileStationShareSyncer(fs port.FileStationClient, files port.FileRepository, shares port.ShareRepository, pageSize int, logger *zap.Logger) *FileStationShareSyncer {
+	if pageSize <= 0 {
+		pageSize = 200
+	}
+	return &FileStationShareSyncer{
+		fs:       fs,
+		files:    files,
+		shares:   shares,
+		pageSize: pageSize,
+		logger:   logger,
+	}
+}
+
+// SyncAll imports all File Station sharing links and returns the number imported.
+// Links that are no longer listed are revoked.
+func (fss *FileStationShareSyncer) SyncAll(ctx context.Context) (int, error) {
+	count := 0
+	offset := 0
+	listed := make(map[string]bool)
+
+	paths, err := loadFileStationPaths(ctx, fss.drive)
+	if err != nil {
+		fss.logger.Warn("failed to list team folders, links in them are skipped", zap.Error(err))
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return count, ctx.Err()
+		default:
+		}
+
+		resp, err := fss.fs.ListShareLinks(ctx, offset, fss.pageSize)
+		if err != nil {
+			return count, fmt.Errorf("failed to list sharing links at offset %d: %w", offset, err)
+		}
+
+		if len(resp.Links) == 0 {
+			break
+		}
+
+		for i := range resp.Links {
+			listed[resp.Links[i].ID] = true
+			imported, err := fss.syncLink(&resp.Links[i], paths)
+			if err != nil {
+				fss.logger.Warn("failed to sync file station link",
+					zap.String("link_id", resp.Links[i].ID),
+					zap.Error(err))
+				continue
+			}
+			if imported {
+				count++
+			}
+		}
+
+		offset += len(resp.Links)
+		if offset >= resp.Total {
+			break
+		}
+	}
+
+	if fss.revoker != nil {
+		if _, err := fss.revoker.revokeUnlisted(shareSourceFileStation, listed); err != nil {
+			fss.logger.Warn("failed to revoke removed file station links", zap.Error(err))
+		}
+	}
+
+	return count, nil
+}
+
+// trackedFile returns the file a link points to by its Drive path. Paths that
+// do not map are looked up as they are, as links created by CreateShare carry
+// the Drive path.
+func (fss *FileStationShareSyncer) trackedFile(linkPath string, paths *fileStationPaths) (*domain.File, error) {
+	drivePath, owner, ok := paths.drivePath(linkPath)
+	if !ok {
+		return fss.files.GetByPath(linkPath)
+	}
+	file, err := fss.files.GetByPath(drivePath)
+	if err != nil || file == nil {
+		return nil, err
+	}
+	// /mydrive is the Drive account's own; another user's home is not it
+	if owner != "" && file.Owner != "" && file.Owner != owner {
+		return nil, nil
+	}
+	return file, nil
+}
+
+// syncLink creates or updates the share record for a single link.
+// Returns true if the link is served by the cache.
+func (fss *FileStationShareSyncer) syncLink(link *port.FileStationShareLink, paths *fileStationPaths) (bool, error) {
+	if link.ID == "" || link.IsFolder {
+		return false, nil
+	}
+
+	existing, err := fss.shares.GetShareByToken(link.ID)
+	if err != nil {
+		return false, fmt.Errorf("failed to check existing share: %w", err)
+	}
+
+	// File Station does not expose link passwords, so protected links cannot be
+	// verified locally and must not be served from the cache
+	revoked := !link.IsValid() || link.HasPassword
+
+	if existing != nil {
+		if !strings.HasPrefix(existing.SynoShareID, fileStationShareIDPrefix) {
+			return false, fmt.Errorf("token already used by drive share %s", existing.SynoShareID)
+		}
+		wasRevoked := existing.Revoked
+		existing.URL = link.URL
+		existing.ExpiresAt = link.GetExpiresAt()
+		existing.NASMaxDownloads = link.RequestLimit
+		existing.Revoked = revoked
+		if err := fss.shares.UpdateShare(existing); err != nil {
+			return false, fmt.Errorf("failed to update share: %w", err)
+		}
+
+		switch {
+		case revoked && !wasRevoked:
+			recordShareEvent(fss.audit, fss.logger, domain.AuditActionShareRevoke, existing, map[string]string{
+				"source":       "filestation",
+				"status":       link.Status,
+				"has_password": strconv.FormatBool(link.HasPassword),
+			})
+		case !revoked && wasRevoked:
+			recordShareEvent(fss.audit, fss.logger, domain.AuditActionShareRestore, existing, map[string]string{
+				"source": "filestation",
+			})
+		}
+		return !revoked, nil
+	}
+
+	if revoked {
+		fss.logger.Debug("skipping unusable file station link",
+			zap.String("link_id", link.ID),
+			zap.String("status", link.Status),
+			zap.Bool("has_password", link.HasPassword))
+		return false, nil
+	}
+
+	file, err := fss.trackedFile(link.Path, paths)
+	if err != nil {
+		return false, fmt.Errorf("failed to look up file: %w", err)
+	}
+	if file == nil {
+		fss.logger.Debug("skipping file station link for untracked file",
+			zap.String("link_id", link.ID),
+			zap.String("path", link.Path))
+		return false, nil
+	}
+
+	if !file.Shared || file.Priority > domain.PriorityShared {
+		file.Shared = true
+		file.UpdatePriority(domain.PriorityShared)
+		if err := fss.files.UpdateMetadata(file); err != nil {
+			return false, fmt.Errorf("failed to mark file shared: %w", err)
+		}
+	}
+
+	share := &domain.Share{
+		SynoShareID: fileStationShareIDPrefix + link.ID,
+		Token:       link.ID,
+		URL:         link.URL,
+		FileID:      file.ID,
+		ExpiresAt:   link.GetExpiresAt(),
+
+		NASMaxDownloads: link.RequestLimit,
+	}
+	if err := fss.shares.CreateShare(share); err != nil {
+		return false, fmt.Errorf("failed to create share: %w", err)
+	}
+
+	recordShareEvent(fss.audit, fss.logger, domain.AuditActionShareCreate, share, map[string]string{
+		"source": "filestation",
+		"path":   link.Path,
+	})
+
+	fss.logger.Debug("file station share record created",
+		zap.String("link_id", link.ID),
+		zap.String("path", link.Path))
+
+	return true, nil
+}
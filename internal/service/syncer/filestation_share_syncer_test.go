@@ -0,0 +1,303 @@
+package syncer
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"go.uber.org/zap"
+)
+
+// mockFileStationClient implements port.FileStationClient for testing
+type mockFileStationClient struct {
+	links   []port.FileStationShareLink
+	created []string // Paths passed to CreateShareLink
+}
+
+func (m *mockFileStationClient) ListShareLinks(ctx context.Context, offset, limit int) (*port.FileStationShareListResponse, error) {
+	end := offset + limit
+	if end > len(m.links) {
+		end = len(m.links)
+	}
+	if offset > end {
+		offset = end
+	}
+	return &port.FileStationShareListResponse{
+		Offset: offset,
+		Total:  len(m.links),
+		Links:  m.links[offset:end],
+	}, nil
+}
+
+// mockFileRepository implements port.FileRepository for testing (path lookups only)
+type mockFileRepository struct {
+	byPath  map[string]*domain.File
+	updated []*domain.File
+}
+
+func (m *mockFileRepository) GetByID(id int64) (*domain.File, error)          { return nil, nil }
+func (m *mockFileRepository) GetBySynoID(synoID string) (*domain.File, error) { return nil, nil }
+func (m *mockFileRepository) GetByPath(path string) (*domain.File, error) {
+	return m.byPath[path], nil
+}
+func (m *mockFileRepository) Create(file *domain.File) error { return nil }
+func (m *mockFileRepository) Update(file *domain.File) error { return nil }
+func (m *mockFileRepository) UpdateMetadata(file *domain.File) error {
+	m.updated = append(m.updated, file)
+	return nil
+}
+func (m *mockFileRepository) UpsertBySynoID(file *domain.File) (*domain.UpsertResult, error) {
+	return nil, nil
+}
+func (m *mockFileRepository) InvalidateCache(fileID int64) error { return nil }
+func (m *mockFileRepository) Delete(id int64) error              { return nil }
+func (m *mockFileRepository) GetEvictionCandidates(policy domain.EvictionPolicy, limit int) ([]*domain.File, error) {
+	return nil, nil
+}
+func (m *mockFileRepository) GetEvictionCandidatesByOwner(policy domain.EvictionPolicy, owner string, limit int) ([]*domain.File, error) {
+	return nil, nil
+}
+func (m *mockFileRepository) GetEvictionCandidatesByLabel(policy domain.EvictionPolicy, label string, limit int) ([]*domain.File, error) {
+	return nil, nil
+}
+func (m *mockFileRepository) ForEachEvictionCandidate(policy domain.EvictionPolicy, fn func(*domain.File) bool) error {
+	return nil
+}
+func (m *mockFileRepository) ForEachFileToCache(fn func(*domain.File) bool) error { return nil }
+func (m *mockFileRepository) CountCacheReferences(cachePath string) (int, error)  { return 0, nil }
+func (m *mockFileRepository) GetFilesByCacheState(state string) ([]*domain.File, error) {
+	return nil, nil
+}
+func (m *mockFileRepository) GetQuotaUsage(includeQueued bool) (*domain.QuotaUsage, error) {
+	return domain.NewQuotaUsage(), nil
+}
+func (m *mockFileRepository) UnpinFiles(keepPrefixes []string) (int, error) { return 0, nil }
+func (m *mockFileRepository) SearchFiles(search domain.FileSearch, limit, offset int) ([]*domain.File, int, error) {
+	return nil, 0, nil
+}
+func (m *mockFileRepository) MarkMissingUpstream(fileID int64) error { return nil }
+func (m *mockFileRepository) ListMissingUpstream(limit, offset int) ([]*domain.File, int, error) {
+	return nil, 0, nil
+}
+func (m *mockFileRepository) RecordHit(fileID, bytesServed int64) error { return nil }
+func (m *mockFileRepository) RecordMiss(fileID int64) error             { return nil }
+func (m *mockFileRepository) BoostFilePriority(fileID int64, priority int) (bool, error) {
+	return false, nil
+}
+
+func (m *mockFileStationClient) CreateShareLink(ctx context.Context, path string, expiresAt *time.Time) (*port.FileStationShareLink, error) {
+	m.created = append(m.created, path)
+	id := fmt.Sprintf("link%d", len(m.created))
+	return &port.FileStationShareLink{ID: id, URL: "https://nas/sharing/" + id, Path: path}, nil
+}
+
+func TestFileStationShareSyncer_SyncAll(t *testing.T) {
+	fs := &mockFileStationClient{
+		links: []port.FileStationShareLink{
+			{ID: "tracked", URL: "https://nas/sharing/tracked", Path: "/docs/a.pdf", Status: "valid", DateExpired: "2030-01-02"},
+			{ID: "untracked", Path: "/docs/missing.pdf", Status: "valid"},
+			{ID: "folder", Path: "/docs", IsFolder: true, Status: "valid"},
+			{ID: "protected", Path: "/docs/a.pdf", HasPassword: true, Status: "valid"},
+			{ID: "expired", Path: "/docs/a.pdf", Status: "expired"},
+		},
+	}
+	files := &mockFileRepository{
+		byPath: map[string]*domain.File{
+			"/docs/a.pdf": {ID: 42, Path: "/docs/a.pdf", Priority: domain.PriorityDefault},
+		},
+	}
+	shares := newMockShareRepository()
+
+	fss := NewFileStationShareSyncer(fs, files, shares, 2, zap.NewNop())
+
+	count, err := fss.SyncAll(context.Background())
+	if err != nil {
+		t.Fatalf("SyncAll() error = %v", err)
+	}
+	if count != 1 {
+		t.Errorf("SyncAll() count = %d, want 1", count)
+	}
+
+	share := shares.shares["tracked"]
+	if share == nil {
+		t.Fatal("expected share for tracked link")
+	}
+	if share.FileID != 42 {
+		t.Errorf("FileID = %d, want 42", share.FileID)
+	}
+	if share.SynoShareID != "filestation:tracked" {
+		t.Errorf("SynoShareID = %q, want filestation:tracked", share.SynoShareID)
+	}
+	if share.ExpiresAt == nil {
+		t.Error("expected ExpiresAt to be set")
+	}
+
+	for _, id := range []string{"untracked", "folder", "protected", "expired"} {
+		if shares.shares[id] != nil {
+			t.Errorf("expected no share for %s link", id)
+		}
+	}
+
+	if len(files.updated) != 1 || !files.updated[0].Shared || files.updated[0].Priority != domain.PriorityShared {
+		t.Errorf("expected file to be marked shared with shared priority, got %+v", files.updated)
+	}
+}
+
+func TestFileStationShareSyncer_RevokesInvalidatedLink(t *testing.T) {
+	shares := newMockShareRepository()
+	shares.shares["abc"] = &domain.Share{ID: 1, SynoShareID: "filestation:abc", Token: "abc", FileID: 42}
+
+	fs := &mockFileStationClient{
+		links: []port.FileStationShareLink{{ID: "abc", Path: "/docs/a.pdf", Status: "broken"}},
+	}
+
+	fss := NewFileStationShareSyncer(fs, &mockFileRepository{}, shares, 0, zap.NewNop())
+
+	if _, err := fss.SyncAll(context.Background()); err != nil {
+		t.Fatalf("SyncAll() error = %v", err)
+	}
+	if !shares.shares["abc"].Revoked {
+		t.Error("expected share to be revoked")
+	}
+}
+
+func TestFileStationShareSyncer_DoesNotOverwriteDriveShare(t *testing.T) {
+	shares := newMockShareRepository()
+	shares.shares["abc"] = &domain.Share{ID: 1, SynoShareID: "123", Token: "abc", FileID: 7}
+
+	fs := &mockFileStationClient{
+		links: []port.FileStationShareLink{{ID: "abc", Path: "/docs/a.pdf", Status: "expired"}},
+	}
+
+	fss := NewFileStationShareSyncer(fs, &mockFileRepository{}, shares, 0, zap.NewNop())
+
+	if _, err := fss.SyncAll(context.Background()); err != nil {
+		t.Fatalf("SyncAll() error = %v", err)
+	}
+	if shares.shares["abc"].Revoked {
+		t.Error("drive share must not be modified by file station sync")
+	}
+}
+
+// mockAuditRepository records audit events for testing
+type mockAuditRepository struct {
+	events []*domain.AuditEvent
+}
+
+func (m *mockAuditRepository) RecordAuditEvent(event *domain.AuditEvent) error {
+	m.events = append(m.events, event)
+	return nil
+}
+func (m *mockAuditRepository) ListAuditEvents(filter domain.AuditFilter, limit, offset int) ([]*domain.AuditEvent, error) {
+	return m.events, nil
+}
+func (m *mockAuditRepository) DeleteAuditEventsBefore(maxAge time.Duration) (int, error) {
+	return 0, nil
+}
+
+func TestFileStationShareSyncer_RecordsAuditEvents(t *testing.T) {
+	shares := newMockShareRepository()
+	shares.shares["old"] = &domain.Share{ID: 1, SynoShareID: "filestation:old", Token: "old", FileID: 42}
+
+	fs := &mockFileStationClient{
+		links: []port.FileStationShareLink{
+			{ID: "old", Path: "/docs/a.pdf", Status: "expired"},
+			{ID: "new", Path: "/docs/a.pdf", Status: "valid"},
+		},
+	}
+	files := &mockFileRepository{
+		byPath: map[string]*domain.File{"/docs/a.pdf": {ID: 42, Path: "/docs/a.pdf"}},
+	}
+	audit := &mockAuditRepository{}
+
+	fss := NewFileStationShareSyncer(fs, files, shares, 0, zap.NewNop())
+	fss.audit = audit
+
+	if _, err := fss.SyncAll(context.Background()); err != nil {
+		t.Fatalf("SyncAll() error = %v", err)
+	}
+
+	if len(audit.events) != 2 {
+		t.Fatalf("recorded %d audit events, want 2", len(audit.events))
+	}
+	if audit.events[0].Action != domain.AuditActionShareRevoke || audit.events[0].Target != "share:old" {
+		t.Errorf("first event = %s %s, want share revoke of old", audit.events[0].Action, audit.events[0].Target)
+	}
+	if audit.events[1].Action != domain.AuditActionShareCreate || audit.events[1].Target != "share:new" {
+		t.Errorf("second event = %s %s, want share create of new", audit.events[1].Action, audit.events[1].Target)
+	}
+	for _, event := range audit.events {
+		if event.Actor != domain.AuditActorSync {
+			t.Errorf("actor = %q, want %q", event.Actor, domain.AuditActorSync)
+		}
+	}
+}
+
+func TestFileStationShareSyncer_MapsFileStationPaths(t *testing.T) {
+	fs := &mockFileStationClient{
+		links: []port.FileStationShareLink{
+			{ID: "home", Path: "/home/Drive/reports/q3.pdf", Status: "valid"},
+			{ID: "homes", Path: "/homes/admin/Drive/notes.txt", Status: "valid"},
+			{ID: "other-user", Path: "/homes/bob/Drive/notes.txt", Status: "valid"},
+			{ID: "team", Path: "/volume1/Marketing/brochure.pdf", Status: "valid"},
+			{ID: "plain-share", Path: "/photo/beach.jpg", Status: "valid"},
+		},
+	}
+	files := &mockFileRepository{
+		byPath: map[string]*domain.File{
+			"/mydrive/reports/q3.pdf":              {ID: 1, Path: "/mydrive/reports/q3.pdf", Owner: "admin"},
+			"/mydrive/notes.txt":                   {ID: 2, Path: "/mydrive/notes.txt", Owner: "admin"},
+			"/team-folders/Marketing/brochure.pdf": {ID: 3, Path: "/team-folders/Marketing/brochure.pdf"},
+		},
+	}
+	drive := &mockDriveClient{teamFolders: []port.DriveTeamFolder{
+		{ID: "900", Name: "Marketing", Path: "/team-folders/Marketing"},
+	}}
+	shares := newMockShareRepository()
+
+	fss := NewFileStationShareSyncer(fs, files, shares, 0, zap.NewNop())
+	fss.drive = drive
+
+	count, err := fss.SyncAll(context.Background())
+	if err != nil {
+		t.Fatalf("SyncAll() error = %v", err)
+	}
+	if count != 3 {
+		t.Errorf("SyncAll() count = %d, want 3", count)
+	}
+	for id, fileID := range map[string]int64{"home": 1, "homes": 2, "team": 3} {
+		if share := shares.shares[id]; share == nil || share.FileID != fileID {
+			t.Errorf("share %s = %+v, want file %d", id, share, fileID)
+		}
+	}
+	// Another user's home is not the Drive account's /mydrive; shared folders
+	// that are not team folders are not in Drive at all
+	for _, id := range []string{"other-user", "plain-share"} {
+		if shares.shares[id] != nil {
+			t.Errorf("expected no share for %s link", id)
+		}
+	}
+}
+
+func TestFileStationPaths_DrivePath(t *testing.T) {
+	paths := &fileStationPaths{teamFolders: map[string]string{"marketing": "/team-folders/Marketing"}}
+	tests := []struct {
+		in, want, owner string
+		ok              bool
+	}{
+		{"/home/Drive/a/b.txt", "/mydrive/a/b.txt", "", true},
+		{"/volume1/homes/alice/Drive/b.txt", "/mydrive/b.txt", "alice", true},
+		{"/marketing/x/y.pdf", "/team-folders/Marketing/x/y.pdf", "", true},
+		{"/home/Photos/b.jpg", "", "", false},
+		{"/mydrive/b.txt", "", "", false},
+	}
+	for _, tt := range tests {
+		got, owner, ok := paths.drivePath(tt.in)
+		if got != tt.want || owner != tt.owner || ok != tt.ok {
+			t.Errorf("drivePath(%q) = %q, %q, %v, want %q, %q, %v", tt.in, got, owner, ok, tt.want, tt.owner, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"go.uber.org/zap"
+)
+
+// IncludePath is a personal Drive folder scanned on every full sync
+type IncludePath struct {
+	Path     string
+	Priority int
+}
+
+// ParseIncludePaths parses include paths given as "/path" or "N:/path",
+// where N is the priority (1-5) of the files below the path. Paths without
+// a priority use defaultPriority.
+func ParseIncludePaths(specs []string, defaultPriority int) ([]IncludePath, error) {
+	paths := make([]IncludePath, 0, len(specs))
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+
+		p := IncludePath{Path: spec, Priority: defaultPriority}
+		if prefix, rest, ok := strings.Cut(spec, ":"); ok && !strings.HasPrefix(spec, "/") {
+			priority, err := strconv.Atoi(prefix)
+			if err != nil || priority <= domain.PriorityPinned || priority > domain.PriorityDefault {
+				return nil, fmt.Errorf("invalid include path %q: priority must be between 1 and 5", spec)
+			}
+			p.Path, p.Priority = rest, priority
+		}
+		if !strings.HasPrefix(p.Path, "/") {
+			return nil, fmt.Errorf("invalid include path %q: must be an absolute Drive path", spec)
+		}
+		p.Path = path.Clean(p.Path)
+		paths = append(paths, p)
+	}
+	return paths, nil
+}
+
+// syncIncludePaths scans the configured personal Drive folders. With dry set
+// the folders are only reported.
+func (s *Syncer) syncIncludePaths(ctx context.Context, dry *dryRun) (int, error) {
+	if len(s.config.IncludePaths) == 0 {
+		return 0, nil
+	}
+
+	count, err := s.scanFolders(ctx, s.config.IncludePaths, dry)
+	if dry == nil && err == nil {
+		s.logger.Info("synced include paths",
+			zap.Int("paths", len(s.config.IncludePaths)),
+			zap.Int("count", count))
+	}
+	return count, err
+}
+
+// scanFolders scans folders at their priority and returns the number of files
+// found. A folder that fails is logged and skipped unless the NAS is down.
+func (s *Syncer) scanFolders(ctx context.Context, folders []IncludePath, dry *dryRun) (int, error) {
+	count := 0
+	for _, folder := range folders {
+		if dry != nil {
+			dry.report.Folders = append(dry.report.Folders, folder.Path)
+			continue
+		}
+
+		result, err := s.scanner.ScanPath(ctx, folder.Path, folder.Priority)
+		if errors.Is(err, domain.ErrUpstreamUnavailable) {
+			return count, err
+		}
+		if err != nil {
+			s.logger.Warn("failed to scan folder",
+				zap.String("path", folder.Path),
+				zap.Error(err))
+			continue
+		}
+		count += result.TotalFiles
+	}
+	return count, nil
+}
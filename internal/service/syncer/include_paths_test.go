@@ -0,0 +1,28 @@
+package syncer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseIncludePaths(t *testing.T) {
+	paths, err := ParseIncludePaths([]string{"/mydrive/Projects", " 1:/mydrive/Contracts/ ", "", "4:/mydrive/a:b"}, 2)
+	if err != nil {
+		t.Fatalf("ParseIncludePaths() error = %v", err)
+	}
+
+	want := []IncludePath{
+		{Path: "/mydrive/Projects", Priority: 2},
+		{Path: "/mydrive/Contracts", Priority: 1},
+		{Path: "/mydrive/a:b", Priority: 4},
+	}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("ParseIncludePaths() = %v, want %v", paths, want)
+	}
+
+	for _, spec := range []string{"mydrive/Projects", "0:/mydrive/Projects", "6:/mydrive", "x:/mydrive", "3:mydrive"} {
+		if _, err := ParseIncludePaths([]string{spec}, 2); err == nil {
+			t.Errorf("ParseIncludePaths(%q) succeeded, want error", spec)
+		}
+	}
+}
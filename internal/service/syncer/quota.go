@@ -0,0 +1,51 @@
+package syncer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"go.uber.org/zap"
+)
+
+// quotaRefreshInterval is how long the usage snapshot is trusted. In between
+// enqueued files are added locally, so a sync does not query it per file.
+const quotaRefreshInterval = time.Minute
+
+// quotaGuard keeps files from being enqueued once their owner or one of their
+// labels has used up its quota. Usage counts cached and queued files.
+type quotaGuard struct {
+	quota  domain.Quota
+	files  port.FileRepository
+	logger *zap.Logger
+
+	mu       sync.Mutex
+	usage    *domain.QuotaUsage
+	loadedAt time.Time
+}
+
+// allow reports whether f may be enqueued and, if so, counts its size
+func (g *quotaGuard) allow(f *domain.File) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.usage == nil || time.Since(g.loadedAt) > quotaRefreshInterval {
+		usage, err := g.files.GetQuotaUsage(true)
+		if err != nil {
+			// Don't hold up caching because the usage query failed
+			g.logger.Warn("failed to load quota usage", zap.Error(err))
+			return true
+		}
+		g.usage = usage
+		g.loadedAt = time.Now()
+	}
+
+	if !g.quota.Allows(g.usage, f) {
+		return false
+	}
+	if f.Priority != domain.PriorityPinned {
+		g.usage.Add(f.Owner, f.Labels, f.Size)
+	}
+	return true
+}
@@ -0,0 +1,169 @@
+package syncer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"go.uber.org/zap"
+)
+
+// Share sources, recorded in audit events
+const (
+	shareSourceDrive       = "drive"
+	shareSourceFileStation = "filestation"
+)
+
+// CacheDeleter removes cached copies of files (implemented by port.FileSystem,
+// and by cacher.Cacher, which keeps deduplicated copies other files still use)
+type CacheDeleter interface {
+	DeleteFile(cachePath string) error
+}
+
+// shareRevoker revokes shares that no longer exist on the NAS and releases
+// files that are not referenced by any active share anymore
+type shareRevoker struct {
+	shares port.ShareRepository
+	files  port.FileRepository
+	audit  port.AuditRepository // nil disables audit events
+	purge  CacheDeleter         // nil keeps cached copies of released files
+	logger *zap.Logger
+}
+
+// shareSource returns where a share record was imported from
+func shareSource(share *domain.Share) string {
+	if strings.HasPrefix(share.SynoShareID, fileStationShareIDPrefix) {
+		return shareSourceFileStation
+	}
+	return shareSourceDrive
+}
+
+// revokeUnlisted marks active shares of the given source as revoked if their
+// token is missing from listed, which must hold every token of a complete
+// upstream listing. Returns the number of revoked shares.
+func (r *shareRevoker) revokeUnlisted(source string, listed map[string]bool) (int, error) {
+	active, err := r.shares.ListActiveShares()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list active shares: %w", err)
+	}
+
+	remaining := make(map[int64]int) // Active shares per file after this pass
+	released := make(map[int64]bool)
+	revoked := 0
+
+	for _, share := range active {
+		if shareSource(share) != source || listed[share.Token] {
+			remaining[share.FileID]++
+			continue
+		}
+
+		share.Revoked = true
+		if err := r.shares.UpdateShare(share); err != nil {
+			r.logger.Warn("failed to revoke share",
+				zap.String("token", share.Token),
+				zap.Error(err))
+			remaining[share.FileID]++
+			continue
+		}
+
+		recordShareEvent(r.audit, r.logger, domain.AuditActionShareRevoke, share, map[string]string{
+			"source": source,
+			"reason": "removed_upstream",
+		})
+		r.logger.Info("share removed on NAS, revoked",
+			zap.String("token", share.Token),
+			zap.String("source", source),
+			zap.Int64("file_id", share.FileID))
+
+		released[share.FileID] = true
+		revoked++
+	}
+
+	for fileID := range released {
+		if remaining[fileID] == 0 {
+			r.releaseFile(fileID)
+		}
+	}
+
+	return revoked, nil
+}
+
+// unlistedShares returns the active shares of the given source whose token is
+// missing from listed, i.e. the shares revokeUnlisted would revoke
+func (r *shareRevoker) unlistedShares(source string, listed map[string]bool) ([]*domain.Share, error) {
+	active, err := r.shares.ListActiveShares()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list active shares: %w", err)
+	}
+
+	var unlisted []*domain.Share
+	for _, share := range active {
+		if shareSource(share) == source && !listed[share.Token] {
+			unlisted = append(unlisted, share)
+		}
+	}
+	return unlisted, nil
+}
+
+// releaseFile clears the shared flag of a file without active shares. With
+// purging enabled its cached copy is deleted too, unless the file is starred
+// or pre-seeded and therefore cached for another reason.
+func (r *shareRevoker) releaseFile(fileID int64) {
+	file, err := r.files.GetByID(fileID)
+	if err != nil || file == nil {
+		r.logger.Warn("failed to load file of revoked share",
+			zap.Int64("file_id", fileID),
+			zap.Error(err))
+		return
+	}
+
+	file.Shared = false
+	if file.Priority == domain.PriorityShared {
+		file.Priority = domain.PriorityDefault
+		if file.Starred {
+			file.Priority = domain.PriorityStarred
+		}
+	}
+	if err := r.files.UpdateMetadata(file); err != nil {
+		r.logger.Warn("failed to unmark shared file",
+			zap.String("path", file.Path),
+			zap.Error(err))
+		return
+	}
+
+	if r.purge == nil || !file.Cached || file.Starred || file.Priority == domain.PriorityPinned {
+		return
+	}
+
+	// Stop serving the copy before deleting it; a crash in between is
+	// reconciled by the cacher on its next start
+	file.BeginEviction()
+	if err := r.files.Update(file); err != nil {
+		r.logger.Error("failed to mark file of revoked share as evicting",
+			zap.String("path", file.Path),
+			zap.Error(err))
+		return
+	}
+
+	if file.CachePath != "" {
+		if err := r.purge.DeleteFile(file.CachePath); err != nil {
+			r.logger.Error("failed to delete cached file of revoked share",
+				zap.String("path", file.CachePath),
+				zap.Error(err))
+			return
+		}
+	}
+
+	file.InvalidateCache()
+	if err := r.files.Update(file); err != nil {
+		r.logger.Error("failed to update file after purge",
+			zap.String("path", file.Path),
+			zap.Error(err))
+		return
+	}
+
+	r.logger.Info("purged cached copy of revoked share",
+		zap.String("path", file.Path),
+		zap.Int64("size", file.Size))
+}
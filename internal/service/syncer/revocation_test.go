@@ -0,0 +1,112 @@
+package syncer
+
+import (
+	"testing"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"go.uber.org/zap"
+)
+
+// mockCacheDeleter records deleted cache paths
+type mockCacheDeleter struct {
+	deleted []string
+}
+
+func (m *mockCacheDeleter) DeleteFile(cachePath string) error {
+	m.deleted = append(m.deleted, cachePath)
+	return nil
+}
+
+// revocationFiles is a file repository keyed by ID for revocation tests
+type revocationFiles struct {
+	mockFileRepository
+	byID map[int64]*domain.File
+}
+
+func (m *revocationFiles) GetByID(id int64) (*domain.File, error) { return m.byID[id], nil }
+
+func TestShareRevoker_RevokesUnlistedShares(t *testing.T) {
+	shares := newMockShareRepository()
+	shares.shares["kept"] = &domain.Share{ID: 1, SynoShareID: "1", Token: "kept", FileID: 1}
+	shares.shares["gone"] = &domain.Share{ID: 2, SynoShareID: "2", Token: "gone", FileID: 2}
+	shares.shares["fs"] = &domain.Share{ID: 3, SynoShareID: "filestation:fs", Token: "fs", FileID: 3}
+
+	files := &revocationFiles{byID: map[int64]*domain.File{
+		2: {ID: 2, Path: "/docs/gone.pdf", Shared: true, Priority: domain.PriorityShared, Cached: true, CachePath: "/cache/docs/gone.pdf"},
+	}}
+	purge := &mockCacheDeleter{}
+	audit := &mockAuditRepository{}
+	r := &shareRevoker{shares: shares, files: files, audit: audit, purge: purge, logger: zap.NewNop()}
+
+	revoked, err := r.revokeUnlisted(shareSourceDrive, map[string]bool{"kept": true})
+	if err != nil {
+		t.Fatalf("revokeUnlisted() error = %v", err)
+	}
+	if revoked != 1 {
+		t.Errorf("revoked = %d, want 1", revoked)
+	}
+
+	if !shares.shares["gone"].Revoked {
+		t.Error("expected unlisted drive share to be revoked")
+	}
+	if shares.shares["kept"].Revoked || shares.shares["fs"].Revoked {
+		t.Error("listed drive share and file station share must stay active")
+	}
+
+	file := files.byID[2]
+	if file.Shared || file.Priority != domain.PriorityDefault {
+		t.Errorf("file not released: shared=%v priority=%d", file.Shared, file.Priority)
+	}
+	if file.Cached || len(purge.deleted) != 1 || purge.deleted[0] != "/cache/docs/gone.pdf" {
+		t.Errorf("expected cached copy to be purged, deleted=%v cached=%v", purge.deleted, file.Cached)
+	}
+	if len(audit.events) != 1 || audit.events[0].Action != domain.AuditActionShareRevoke {
+		t.Errorf("expected one revoke audit event, got %+v", audit.events)
+	}
+}
+
+func TestShareRevoker_KeepsFileReferencedElsewhere(t *testing.T) {
+	shares := newMockShareRepository()
+	shares.shares["drive"] = &domain.Share{ID: 1, SynoShareID: "1", Token: "drive", FileID: 1}
+	shares.shares["fs"] = &domain.Share{ID: 2, SynoShareID: "filestation:fs", Token: "fs", FileID: 1}
+
+	files := &revocationFiles{byID: map[int64]*domain.File{
+		1: {ID: 1, Path: "/docs/a.pdf", Shared: true, Priority: domain.PriorityShared, Cached: true, CachePath: "/cache/docs/a.pdf"},
+	}}
+	purge := &mockCacheDeleter{}
+	r := &shareRevoker{shares: shares, files: files, purge: purge, logger: zap.NewNop()}
+
+	if _, err := r.revokeUnlisted(shareSourceDrive, map[string]bool{}); err != nil {
+		t.Fatalf("revokeUnlisted() error = %v", err)
+	}
+
+	if !shares.shares["drive"].Revoked {
+		t.Error("expected drive share to be revoked")
+	}
+	if !files.byID[1].Shared || len(purge.deleted) != 0 {
+		t.Error("file still shared through File Station must not be released")
+	}
+}
+
+func TestShareRevoker_KeepsStarredFileCached(t *testing.T) {
+	shares := newMockShareRepository()
+	shares.shares["gone"] = &domain.Share{ID: 1, SynoShareID: "1", Token: "gone", FileID: 1}
+
+	files := &revocationFiles{byID: map[int64]*domain.File{
+		1: {ID: 1, Path: "/docs/a.pdf", Shared: true, Starred: true, Priority: domain.PriorityShared, Cached: true, CachePath: "/cache/docs/a.pdf"},
+	}}
+	purge := &mockCacheDeleter{}
+	r := &shareRevoker{shares: shares, files: files, purge: purge, logger: zap.NewNop()}
+
+	if _, err := r.revokeUnlisted(shareSourceDrive, nil); err != nil {
+		t.Fatalf("revokeUnlisted() error = %v", err)
+	}
+
+	file := files.byID[1]
+	if file.Priority != domain.PriorityStarred {
+		t.Errorf("priority = %d, want starred", file.Priority)
+	}
+	if !file.Cached || len(purge.deleted) != 0 {
+		t.Error("starred file must stay cached")
+	}
+}
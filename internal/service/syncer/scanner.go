@@ -2,6 +2,7 @@ package syncer
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"sync/atomic"
@@ -16,6 +17,10 @@ import (
 type ScannerConfig struct {
 	MaxConcurrency int
 	BatchSize      int
+	MaxDepth       int              // Folder levels below the scanned path to descend into (0 = unlimited)
+	MaxFiles       int              // Files to process per scan before stopping (0 = unlimited)
+	MaxFileSize    int64            // Larger files are recorded but not enqueued (0 = unlimited)
+	Exclude        []ExcludePattern // Files and folders skipped entirely
 }
 
 // DefaultScannerConfig returns default scanner configuration
@@ -33,6 +38,11 @@ type ScanResult struct {
 	UpdatedFiles int
 	Errors       int
 	Duration     time.Duration
+
+	ExcludedFiles   int  // Files and folders matching an exclusion pattern
+	SkippedDirs     int  // Folders below the maximum depth
+	OversizedFiles  int  // Files recorded but not enqueued because of their size
+	TruncatedByFile bool // The scan stopped at the maximum number of files
 }
 
 // Scanner recursively scans paths and adds files to the database
@@ -44,12 +54,23 @@ type Scanner struct {
 	logger *zap.Logger
 	sem    chan struct{}
 
+	// maxDepth starts at config.MaxDepth and is changed by sync scope tuning
+	maxDepth atomic.Int64
+
+	// enqueue creates the download task of a file that needs caching.
+	// The syncer replaces it with its own, which applies size limits and quotas.
+	enqueue func(file *domain.File)
+
 	// Stats
 	stats struct {
 		totalFiles   atomic.Int64
 		addedFiles   atomic.Int64
 		updatedFiles atomic.Int64
 		errors       atomic.Int64
+		excluded     atomic.Int64
+		skippedDirs  atomic.Int64
+		oversized    atomic.Int64
+		truncated    atomic.Bool
 	}
 }
 
@@ -65,7 +86,7 @@ func NewScanner(cfg *ScannerConfig, drive port.DriveClient, files port.FileRepos
 		cfg.BatchSize = 200
 	}
 
-	return &Scanner{
+	s := &Scanner{
 		config: cfg,
 		drive:  drive,
 		files:  files,
@@ -73,6 +94,14 @@ func NewScanner(cfg *ScannerConfig, drive port.DriveClient, files port.FileRepos
 		logger: logger,
 		sem:    make(chan struct{}, cfg.MaxConcurrency),
 	}
+	s.enqueue = s.enqueueDownloadTask
+	s.maxDepth.Store(int64(cfg.MaxDepth))
+	return s
+}
+
+// setMaxDepth changes the folder levels scans descend into (0 = unlimited)
+func (s *Scanner) setMaxDepth(depth int) {
+	s.maxDepth.Store(int64(depth))
 }
 
 // ScanPath scans a path recursively and adds all files to the database
@@ -84,6 +113,10 @@ func (s *Scanner) ScanPath(ctx context.Context, path string, priority int) (*Sca
 	s.stats.addedFiles.Store(0)
 	s.stats.updatedFiles.Store(0)
 	s.stats.errors.Store(0)
+	s.stats.excluded.Store(0)
+	s.stats.skippedDirs.Store(0)
+	s.stats.oversized.Store(0)
+	s.stats.truncated.Store(false)
 
 	s.logger.Info("starting path scan",
 		zap.String("path", path),
@@ -92,7 +125,7 @@ func (s *Scanner) ScanPath(ctx context.Context, path string, priority int) (*Sca
 
 	var wg sync.WaitGroup
 
-	if err := s.scanDir(ctx, path, priority, &wg); err != nil {
+	if err := s.scanDir(ctx, path, 0, priority, &wg); err != nil {
 		return nil, fmt.Errorf("failed to scan path %s: %w", path, err)
 	}
 
@@ -104,6 +137,11 @@ func (s *Scanner) ScanPath(ctx context.Context, path string, priority int) (*Sca
 		UpdatedFiles: int(s.stats.updatedFiles.Load()),
 		Errors:       int(s.stats.errors.Load()),
 		Duration:     time.Since(start),
+
+		ExcludedFiles:   int(s.stats.excluded.Load()),
+		SkippedDirs:     int(s.stats.skippedDirs.Load()),
+		OversizedFiles:  int(s.stats.oversized.Load()),
+		TruncatedByFile: s.stats.truncated.Load(),
 	}
 
 	s.logger.Info("path scan completed",
@@ -112,13 +150,22 @@ func (s *Scanner) ScanPath(ctx context.Context, path string, priority int) (*Sca
 		zap.Int("total", result.TotalFiles),
 		zap.Int("added", result.AddedFiles),
 		zap.Int("updated", result.UpdatedFiles),
-		zap.Int("errors", result.Errors))
+		zap.Int("errors", result.Errors),
+		zap.Int("excluded", result.ExcludedFiles),
+		zap.Int("skipped_dirs", result.SkippedDirs),
+		zap.Int("oversized", result.OversizedFiles))
+
+	if result.TruncatedByFile {
+		s.logger.Warn("path scan stopped at max files",
+			zap.String("path", path),
+			zap.Int("max_files", s.config.MaxFiles))
+	}
 
 	return result, nil
 }
 
-// scanDir scans a directory and its subdirectories
-func (s *Scanner) scanDir(ctx context.Context, path string, priority int, wg *sync.WaitGroup) error {
+// scanDir scans a directory and its subdirectories; depth is 0 for the scanned path
+func (s *Scanner) scanDir(ctx context.Context, path string, depth, priority int, wg *sync.WaitGroup) error {
 	offset := 0
 
 	for {
@@ -128,6 +175,10 @@ func (s *Scanner) scanDir(ctx context.Context, path string, priority int, wg *sy
 		default:
 		}
 
+		if s.stats.truncated.Load() {
+			return nil
+		}
+
 		// Acquire semaphore for API call
 		select {
 		case s.sem <- struct{}{}:
@@ -135,7 +186,7 @@ func (s *Scanner) scanDir(ctx context.Context, path string, priority int, wg *sy
 			return ctx.Err()
 		}
 
-		files, err := s.drive.ListFiles(&port.DriveListOptions{
+		files, err := s.drive.ListFiles(ctx, &port.DriveListOptions{
 			Path:   path,
 			Offset: offset,
 			Limit:  s.config.BatchSize,
@@ -162,15 +213,28 @@ func (s *Scanner) scanDir(ctx context.Context, path string, priority int, wg *sy
 			default:
 			}
 
+			if isExcluded(s.config.Exclude, file.Path, file.IsDir()) {
+				s.stats.excluded.Add(1)
+				continue
+			}
+
 			if file.IsDir() {
+				if maxDepth := int(s.maxDepth.Load()); maxDepth > 0 && depth >= maxDepth {
+					s.stats.skippedDirs.Add(1)
+					continue
+				}
+
 				// Scan subdirectory in a new goroutine
 				wg.Add(1)
 				go func(dirPath string) {
 					defer wg.Done()
-					if err := s.scanDir(ctx, dirPath, priority, wg); err != nil {
-						s.logger.Warn("failed to scan subdirectory",
-							zap.String("path", dirPath),
-							zap.Error(err))
+					if err := s.scanDir(ctx, dirPath, depth+1, priority, wg); err != nil {
+						// While the NAS is down every pending folder fails; the sync reports it once
+						if !errors.Is(err, domain.ErrUpstreamUnavailable) {
+							s.logger.Warn("failed to scan subdirectory",
+								zap.String("path", dirPath),
+								zap.Error(err))
+						}
 						s.stats.errors.Add(1)
 					}
 				}(file.Path)
@@ -178,7 +242,11 @@ func (s *Scanner) scanDir(ctx context.Context, path string, priority int, wg *sy
 			}
 
 			// Process file
-			s.stats.totalFiles.Add(1)
+			if n := s.stats.totalFiles.Add(1); s.config.MaxFiles > 0 && n > int64(s.config.MaxFiles) {
+				s.stats.totalFiles.Add(-1)
+				s.stats.truncated.Store(true)
+				return nil
+			}
 			if err := s.processFile(ctx, &file, priority, &now); err != nil {
 				s.logger.Warn("failed to process file",
 					zap.String("path", file.Path),
@@ -196,76 +264,47 @@ func (s *Scanner) scanDir(ctx context.Context, path string, priority int, wg *sy
 	return nil
 }
 
-// processFile adds or updates a file in the database and enqueues download task
+// processFile upserts a file in the database and enqueues download task
 func (s *Scanner) processFile(ctx context.Context, file *port.DriveFile, priority int, now *time.Time) error {
-	fileID := file.GetIDString()
-
-	existing, err := s.files.GetBySynoID(fileID)
+	result, err := s.files.UpsertBySynoID(&domain.File{
+		SynoFileID:  file.GetIDString(),
+		Path:        file.Path,
+		Size:        file.Size,
+		Starred:     file.Starred,
+		Shared:      file.Shared,
+		Priority:    priority,
+		LastSyncAt:  now,
+		ModifiedAt:  file.GetMTime(),
+		AccessedAt:  file.GetATime(),
+		Owner:       file.Owner.Name,
+		Labels:      file.LabelNames(),
+		ContentType: file.MIMEType(),
+	})
 	if err != nil {
-		return fmt.Errorf("failed to check existing file: %w", err)
+		return fmt.Errorf("failed to upsert file: %w", err)
 	}
 
-	var dbFile *domain.File
-	var isNew bool
-
-	if existing != nil {
-		dbFile = existing
-
-		// Update existing file metadata
-		existing.Path = file.Path
-		existing.Size = file.Size
-		existing.LastSyncAt = now
-
-		// Only lower priority, don't raise it
-		existing.UpdatePriority(priority)
-
-		if mtime := file.GetMTime(); mtime != nil {
-			existing.ModifiedAt = mtime
-		}
-
-		// Use UpdateMetadata to avoid overwriting cache status set by cacher
-		if err := s.files.UpdateMetadata(existing); err != nil {
-			return fmt.Errorf("failed to update file: %w", err)
-		}
-
-		s.stats.updatedFiles.Add(1)
-	} else {
-		isNew = true
-
-		// Create new file
-		newFile := &domain.File{
-			SynoFileID: fileID,
-			Path:       file.Path,
-			Size:       file.Size,
-			Starred:    file.Starred,
-			Shared:     file.Shared,
-			Priority:   priority,
-			LastSyncAt: now,
-		}
-
-		if mtime := file.GetMTime(); mtime != nil {
-			newFile.ModifiedAt = mtime
-		}
-		if atime := file.GetATime(); atime != nil {
-			newFile.AccessedAt = atime
-		}
-
-		if err := s.files.Create(newFile); err != nil {
-			return fmt.Errorf("failed to create file: %w", err)
-		}
-
-		dbFile = newFile
+	if result.Created {
 		s.stats.addedFiles.Add(1)
-
 		s.logger.Debug("file added from scan",
 			zap.String("path", file.Path),
 			zap.Int("priority", priority))
+	} else {
+		s.stats.updatedFiles.Add(1)
 	}
 
 	// Enqueue download task if file needs caching
-	if isNew || !dbFile.Cached {
-		s.enqueueDownloadTask(dbFile)
+	if !(result.Created || result.Invalidated || !result.File.Cached || result.File.Stale) {
+		return nil
+	}
+	if s.config.MaxFileSize > 0 && file.Size > s.config.MaxFileSize {
+		s.stats.oversized.Add(1)
+		s.logger.Debug("file exceeds scan max file size, not enqueuing",
+			zap.String("path", file.Path),
+			zap.Int64("size", file.Size))
+		return nil
 	}
+	s.enqueue(result.File)
 
 	return nil
 }
@@ -280,7 +319,7 @@ func (s *Scanner) enqueueDownloadTask(file *domain.File) {
 			zap.Error(err))
 		return
 	}
-	if latestFile == nil || latestFile.Cached {
+	if latestFile == nil || (latestFile.Cached && !latestFile.Stale) {
 		// File not found or already cached
 		return
 	}
@@ -0,0 +1,59 @@
+package syncer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"go.uber.org/zap"
+)
+
+// EnableShareCreation allows CreateShare to create sharing links on the NAS
+// through File Station
+func (s *Syncer) EnableShareCreation(fs port.FileStationClient) {
+	s.shareLinks = fs
+}
+
+// CreateShare shares the file at path in one call: it records the file as
+// shared, enqueues its download, creates a File Station sharing link expiring
+// at expiresAt (nil = never) and records the link as a share served by the
+// cache. Returns the share and the file's active download task, nil when the
+// file is already cached. Files that cannot be cached are rejected before the
+// link is created.
+func (s *Syncer) CreateShare(ctx context.Context, path string, expiresAt *time.Time) (*domain.Share, *domain.DownloadTask, error) {
+	if s.shareLinks == nil {
+		return nil, nil, fmt.Errorf("share creation is not enabled")
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, nil, fmt.Errorf("%w: expiry must be in the future", domain.ErrInvalidInput)
+	}
+
+	file, task, err := s.requestCache(ctx, path, domain.PriorityShared, &SyncOptions{UpdateShared: true})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	link, err := s.shareLinks.CreateShareLink(ctx, file.Path, expiresAt)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create sharing link: %w", err)
+	}
+
+	share := &domain.Share{
+		SynoShareID: fileStationShareIDPrefix + link.ID,
+		Token:       link.ID,
+		URL:         link.URL,
+		FileID:      file.ID,
+		ExpiresAt:   expiresAt,
+	}
+	if err := s.shares.CreateShare(share); err != nil {
+		return nil, nil, fmt.Errorf("failed to record share %s: %w", link.ID, err)
+	}
+
+	s.logger.Info("sharing link created",
+		zap.String("token", share.Token),
+		zap.String("path", file.Path))
+
+	return share, task, nil
+}
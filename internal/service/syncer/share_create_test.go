@@ -0,0 +1,110 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"go.uber.org/zap"
+)
+
+// upsertFiles stores upserted files in memory
+type upsertFiles struct {
+	mockFileRepository
+	byID map[int64]*domain.File
+}
+
+func (m *upsertFiles) UpsertBySynoID(file *domain.File) (*domain.UpsertResult, error) {
+	for _, f := range m.byID {
+		if f.SynoFileID == file.SynoFileID {
+			f.Shared = f.Shared || file.Shared
+			f.UpdatePriority(file.Priority)
+			return &domain.UpsertResult{File: f}, nil
+		}
+	}
+	file.ID = int64(len(m.byID) + 1)
+	m.byID[file.ID] = file
+	return &domain.UpsertResult{File: file, Created: true}, nil
+}
+
+func (m *upsertFiles) GetByID(id int64) (*domain.File, error) { return m.byID[id], nil }
+
+func (m *upsertFiles) GetBySynoID(synoID string) (*domain.File, error) {
+	for _, f := range m.byID {
+		if f.SynoFileID == synoID {
+			return f, nil
+		}
+	}
+	return nil, nil
+}
+
+// createdTasks keeps created download tasks in memory
+type createdTasks struct {
+	port.DownloadTaskRepository
+	byFileID map[int64]*domain.DownloadTask
+}
+
+func (m *createdTasks) HasActiveTask(fileID int64) (bool, error) {
+	return m.byFileID[fileID] != nil, nil
+}
+
+func (m *createdTasks) CreateTask(task *domain.DownloadTask) error {
+	task.ID = int64(len(m.byFileID) + 1)
+	m.byFileID[task.FileID] = task
+	return nil
+}
+
+func (m *createdTasks) GetTaskByFileID(fileID int64) (*domain.DownloadTask, error) {
+	return m.byFileID[fileID], nil
+}
+
+func TestSyncer_CreateShare(t *testing.T) {
+	drive := &mockDriveClient{fileInfo: map[string]*port.DriveFile{
+		"/mydrive/a.pdf": {ID: "7", Path: "/mydrive/a.pdf", ContentType: "file", Size: 10},
+	}}
+	files := &upsertFiles{byID: make(map[int64]*domain.File)}
+	shares := newMockShareRepository()
+	tasks := &createdTasks{byFileID: make(map[int64]*domain.DownloadTask)}
+	fs := &mockFileStationClient{}
+
+	s := New(DefaultConfig(), drive, files, shares, tasks, zap.NewNop())
+	ctx := context.Background()
+
+	if _, _, err := s.CreateShare(ctx, "/mydrive/a.pdf", nil); err == nil {
+		t.Fatal("CreateShare() succeeded before share creation was enabled")
+	}
+	s.EnableShareCreation(fs)
+
+	expires := time.Now().Add(24 * time.Hour)
+	share, task, err := s.CreateShare(ctx, "/mydrive/a.pdf", &expires)
+	if err != nil {
+		t.Fatalf("CreateShare() error = %v", err)
+	}
+	if share.Token != "link1" || share.SynoShareID != "filestation:link1" || share.ExpiresAt != &expires {
+		t.Errorf("share = %+v", share)
+	}
+	if shares.shares["link1"] != share {
+		t.Error("share not recorded")
+	}
+	if task == nil || task.Priority != domain.PriorityShared {
+		t.Errorf("task = %+v, want a task with priority %d", task, domain.PriorityShared)
+	}
+	if f := files.byID[share.FileID]; f == nil || !f.Shared {
+		t.Errorf("file = %+v, want it marked shared", f)
+	}
+
+	// Files that cannot be cached get no sharing link
+	past := time.Now().Add(-time.Hour)
+	if _, _, err := s.CreateShare(ctx, "/mydrive/a.pdf", &past); !errors.Is(err, domain.ErrInvalidInput) {
+		t.Errorf("CreateShare(past expiry) error = %v, want ErrInvalidInput", err)
+	}
+	if _, _, err := s.CreateShare(ctx, "/mydrive/gone.pdf", nil); !errors.Is(err, domain.ErrMissingUpstream) {
+		t.Errorf("CreateShare(missing) error = %v, want ErrMissingUpstream", err)
+	}
+	if len(fs.created) != 1 {
+		t.Errorf("links created = %v, want 1", fs.created)
+	}
+}
@@ -1,11 +1,14 @@
 package syncer
 
 import (
+	"context"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/vertextoedge/synology-file-cache/internal/domain"
 	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"github.com/vertextoedge/synology-file-cache/internal/util/passhash"
 	"go.uber.org/zap"
 )
 
@@ -13,6 +16,7 @@ import (
 type ShareSyncer struct {
 	drive  port.DriveClient
 	shares port.ShareRepository
+	audit  port.AuditRepository // nil disables audit events
 	logger *zap.Logger
 }
 
@@ -26,7 +30,7 @@ func NewShareSyncer(drive port.DriveClient, shares port.ShareRepository, logger
 }
 
 // CreateOrUpdateShare creates or updates a share record for a file
-func (ss *ShareSyncer) CreateOrUpdateShare(fileID int64, synoFileID int64, token string) error {
+func (ss *ShareSyncer) CreateOrUpdateShare(ctx context.Context, fileID int64, synoFileID int64, token string) error {
 	// Check if share already exists
 	existingShare, err := ss.shares.GetShareByToken(token)
 	if err != nil {
@@ -38,14 +42,14 @@ func (ss *ShareSyncer) CreateOrUpdateShare(fileID int64, synoFileID int64, token
 
 	if existingShare != nil {
 		// Update with advance sharing info
-		return ss.UpdateWithAdvanceSharing(existingShare, synoFileID)
+		return ss.UpdateWithAdvanceSharing(ctx, existingShare, synoFileID)
 	}
 
 	// Get advanced sharing info
 	var sharingLink, fullURL, password string
 	var expiresAt *time.Time
 
-	advInfo, err := ss.drive.GetAdvanceSharing(synoFileID, "")
+	advInfo, err := ss.drive.GetAdvanceSharing(ctx, synoFileID, "")
 	if err != nil {
 		ss.logger.Warn("failed to get advance sharing info",
 			zap.String("token", token),
@@ -76,6 +80,11 @@ func (ss *ShareSyncer) CreateOrUpdateShare(fileID int64, synoFileID int64, token
 		return fmt.Errorf("failed to create share: %w", err)
 	}
 
+	recordShareEvent(ss.audit, ss.logger, domain.AuditActionShareCreate, newShare, map[string]string{
+		"source":       "drive",
+		"has_password": strconv.FormatBool(password != ""),
+	})
+
 	ss.logger.Debug("share record created",
 		zap.String("token", token),
 		zap.String("sharing_link", sharingLink))
@@ -84,8 +93,8 @@ func (ss *ShareSyncer) CreateOrUpdateShare(fileID int64, synoFileID int64, token
 }
 
 // UpdateWithAdvanceSharing updates a share with AdvanceSharing info from the API
-func (ss *ShareSyncer) UpdateWithAdvanceSharing(share *domain.Share, synoFileID int64) error {
-	advInfo, err := ss.drive.GetAdvanceSharing(synoFileID, "")
+func (ss *ShareSyncer) UpdateWithAdvanceSharing(ctx context.Context, share *domain.Share, synoFileID int64) error {
+	advInfo, err := ss.drive.GetAdvanceSharing(ctx, synoFileID, "")
 	if err != nil {
 		ss.logger.Warn("failed to get advance sharing info for update",
 			zap.String("token", share.Token),
@@ -95,9 +104,19 @@ func (ss *ShareSyncer) UpdateWithAdvanceSharing(share *domain.Share, synoFileID
 
 	share.SharingLink = advInfo.SharingLink
 	share.URL = advInfo.URL
-	share.Password = advInfo.ProtectPassword
 	share.ExpiresAt = advInfo.GetExpiresAt()
 
+	// The file is listed as shared again after its share was removed on the NAS
+	restored := share.Revoked
+	share.Revoked = false
+
+	// Stored passwords are hashed; keep the existing hash if the password is
+	// unchanged, unless it is of an older scheme
+	passwordChanged := !passwordMatches(share.Password, advInfo.ProtectPassword)
+	if passwordChanged || passhash.NeedsRehash(share.Password) {
+		share.Password = advInfo.ProtectPassword
+	}
+
 	if err := ss.shares.UpdateShare(share); err != nil {
 		ss.logger.Warn("failed to update share",
 			zap.String("token", share.Token),
@@ -105,9 +124,54 @@ func (ss *ShareSyncer) UpdateWithAdvanceSharing(share *domain.Share, synoFileID
 		return fmt.Errorf("failed to update share: %w", err)
 	}
 
+	if restored {
+		recordShareEvent(ss.audit, ss.logger, domain.AuditActionShareRestore, share, map[string]string{
+			"source": shareSourceDrive,
+		})
+	}
+	if passwordChanged {
+		recordShareEvent(ss.audit, ss.logger, domain.AuditActionSharePassword, share, map[string]string{
+			"has_password": strconv.FormatBool(advInfo.ProtectPassword != ""),
+		})
+	}
+
 	ss.logger.Debug("share record updated",
 		zap.String("token", share.Token),
 		zap.Bool("has_password", advInfo.ProtectPassword != ""))
 
 	return nil
 }
+
+// passwordMatches reports whether a stored (possibly hashed) password equals a plaintext one
+func passwordMatches(stored, plaintext string) bool {
+	if passhash.IsHashed(stored) {
+		return plaintext != "" && passhash.Verify(stored, plaintext)
+	}
+	return stored == plaintext
+}
+
+// recordShareEvent appends a share lifecycle event to the audit log.
+// Failures are logged and never fail the sync.
+func recordShareEvent(audit port.AuditRepository, logger *zap.Logger, action string, share *domain.Share, details map[string]string) {
+	if audit == nil {
+		return
+	}
+
+	if details == nil {
+		details = make(map[string]string)
+	}
+	details["file_id"] = strconv.FormatInt(share.FileID, 10)
+
+	event := &domain.AuditEvent{
+		Actor:   domain.AuditActorSync,
+		Action:  action,
+		Target:  "share:" + share.Token,
+		Details: details,
+	}
+	if err := audit.RecordAuditEvent(event); err != nil {
+		logger.Warn("failed to record share audit event",
+			zap.String("action", action),
+			zap.String("token", share.Token),
+			zap.Error(err))
+	}
+}
@@ -1,6 +1,7 @@
 package syncer
 
 import (
+	"context"
 	"errors"
 	"io"
 	"testing"
@@ -15,31 +16,45 @@ import (
 type mockDriveClient struct {
 	advanceSharingResp *port.AdvanceSharingInfo
 	advanceSharingErr  error
+	teamFolders        []port.DriveTeamFolder
+	fileInfo           map[string]*port.DriveFile
 }
 
-func (m *mockDriveClient) GetSharedFiles(offset, limit int) (*port.DriveListResponse, error) {
+func (m *mockDriveClient) GetSharedFiles(ctx context.Context, offset, limit int) (*port.DriveListResponse, error) {
 	return nil, nil
 }
-func (m *mockDriveClient) GetStarredFiles(offset, limit int) (*port.DriveListResponse, error) {
+func (m *mockDriveClient) GetStarredFiles(ctx context.Context, offset, limit int) (*port.DriveListResponse, error) {
 	return nil, nil
 }
-func (m *mockDriveClient) GetRecentFiles(offset, limit int) (*port.DriveListResponse, error) {
+func (m *mockDriveClient) GetRecentFiles(ctx context.Context, offset, limit int) (*port.DriveListResponse, error) {
 	return nil, nil
 }
-func (m *mockDriveClient) GetLabels() ([]port.DriveLabel, error) { return nil, nil }
-func (m *mockDriveClient) GetLabeledFiles(labelID string, offset, limit int) (*port.DriveListResponse, error) {
+func (m *mockDriveClient) GetLabels(ctx context.Context) ([]port.DriveLabel, error) { return nil, nil }
+func (m *mockDriveClient) GetTeamFolders(ctx context.Context) ([]port.DriveTeamFolder, error) {
+	return m.teamFolders, nil
+}
+func (m *mockDriveClient) GetLabeledFiles(ctx context.Context, labelID string, offset, limit int) (*port.DriveListResponse, error) {
 	return nil, nil
 }
-func (m *mockDriveClient) ListFiles(opts *port.DriveListOptions) (*port.DriveListResponse, error) {
+func (m *mockDriveClient) ListFiles(ctx context.Context, opts *port.DriveListOptions) (*port.DriveListResponse, error) {
 	return nil, nil
 }
-func (m *mockDriveClient) DownloadFile(fileID int64, path string) (io.ReadCloser, string, int64, error) {
+func (m *mockDriveClient) GetFileInfo(ctx context.Context, path string) (*port.DriveFile, error) {
+	if file, ok := m.fileInfo[path]; ok {
+		return file, nil
+	}
+	return nil, domain.ErrMissingUpstream
+}
+func (m *mockDriveClient) DownloadFile(ctx context.Context, fileID int64, path string) (io.ReadCloser, string, int64, error) {
+	return nil, "", 0, nil
+}
+func (m *mockDriveClient) DownloadFileWithRange(ctx context.Context, fileID int64, path string, rangeStart int64) (io.ReadCloser, string, int64, error) {
 	return nil, "", 0, nil
 }
-func (m *mockDriveClient) DownloadFileWithRange(fileID int64, path string, rangeStart int64) (io.ReadCloser, string, int64, error) {
+func (m *mockDriveClient) ExportOfficeFile(ctx context.Context, fileID int64, path string, format string) (io.ReadCloser, string, int64, error) {
 	return nil, "", 0, nil
 }
-func (m *mockDriveClient) GetAdvanceSharing(fileID int64, path string) (*port.AdvanceSharingInfo, error) {
+func (m *mockDriveClient) GetAdvanceSharing(ctx context.Context, fileID int64, path string) (*port.AdvanceSharingInfo, error) {
 	return m.advanceSharingResp, m.advanceSharingErr
 }
 
@@ -89,6 +104,61 @@ func (m *mockShareRepository) UpdateShare(share *domain.Share) error {
 	return nil
 }
 
+func (m *mockShareRepository) ListActiveShares() ([]*domain.Share, error) {
+	var active []*domain.Share
+	for _, share := range m.shares {
+		if !share.Revoked {
+			active = append(active, share)
+		}
+	}
+	return active, nil
+}
+
+func (m *mockShareRepository) ClaimShareDownload(share *domain.Share) (bool, error) {
+	if share.DownloadsExhausted() {
+		return false, nil
+	}
+	share.DownloadCount++
+	return true, nil
+}
+
+func (m *mockShareRepository) SetShareMaxDownloads(token string, maxDownloads int) error {
+	share := m.shares[token]
+	if share == nil {
+		return domain.ErrNotFound
+	}
+	share.MaxDownloads = maxDownloads
+	return nil
+}
+
+func (m *mockShareRepository) SetShareIPRules(token string, allowed, denied []string) error {
+	share := m.shares[token]
+	if share == nil {
+		return domain.ErrNotFound
+	}
+	share.AllowedIPs = allowed
+	share.DeniedIPs = denied
+	return nil
+}
+
+func (m *mockShareRepository) SetShareRequireSignature(token string, required bool) error {
+	share := m.shares[token]
+	if share == nil {
+		return domain.ErrNotFound
+	}
+	share.RequireSignature = required
+	return nil
+}
+
+func (m *mockShareRepository) SetShareCacheControl(token, cacheControl string) error {
+	share := m.shares[token]
+	if share == nil {
+		return domain.ErrNotFound
+	}
+	share.CacheControl = cacheControl
+	return nil
+}
+
 func TestShareSyncer_CreateOrUpdateShare_NewShare(t *testing.T) {
 	logger := zap.NewNop()
 	shareRepo := newMockShareRepository()
@@ -105,7 +175,7 @@ func TestShareSyncer_CreateOrUpdateShare_NewShare(t *testing.T) {
 
 	ss := NewShareSyncer(driveClient, shareRepo, logger)
 
-	err := ss.CreateOrUpdateShare(100, 12345, "test-token")
+	err := ss.CreateOrUpdateShare(context.Background(), 100, 12345, "test-token")
 	if err != nil {
 		t.Fatalf("CreateOrUpdateShare() error = %v", err)
 	}
@@ -161,7 +231,7 @@ func TestShareSyncer_CreateOrUpdateShare_ExistingShare(t *testing.T) {
 
 	ss := NewShareSyncer(driveClient, shareRepo, logger)
 
-	err := ss.CreateOrUpdateShare(100, 12345, "existing-token")
+	err := ss.CreateOrUpdateShare(context.Background(), 100, 12345, "existing-token")
 	if err != nil {
 		t.Fatalf("CreateOrUpdateShare() error = %v", err)
 	}
@@ -187,7 +257,7 @@ func TestShareSyncer_CreateOrUpdateShare_DriveAPIError(t *testing.T) {
 	ss := NewShareSyncer(driveClient, shareRepo, logger)
 
 	// Should still create share even if AdvanceSharing fails
-	err := ss.CreateOrUpdateShare(100, 12345, "test-token")
+	err := ss.CreateOrUpdateShare(context.Background(), 100, 12345, "test-token")
 	if err != nil {
 		t.Fatalf("CreateOrUpdateShare() error = %v", err)
 	}
@@ -211,7 +281,7 @@ func TestShareSyncer_CreateOrUpdateShare_GetShareError(t *testing.T) {
 
 	ss := NewShareSyncer(driveClient, shareRepo, logger)
 
-	err := ss.CreateOrUpdateShare(100, 12345, "test-token")
+	err := ss.CreateOrUpdateShare(context.Background(), 100, 12345, "test-token")
 	if err == nil {
 		t.Fatal("expected error, got nil")
 	}
@@ -230,7 +300,7 @@ func TestShareSyncer_CreateOrUpdateShare_CreateError(t *testing.T) {
 
 	ss := NewShareSyncer(driveClient, shareRepo, logger)
 
-	err := ss.CreateOrUpdateShare(100, 12345, "test-token")
+	err := ss.CreateOrUpdateShare(context.Background(), 100, 12345, "test-token")
 	if err == nil {
 		t.Fatal("expected error, got nil")
 	}
@@ -259,7 +329,7 @@ func TestShareSyncer_UpdateWithAdvanceSharing(t *testing.T) {
 
 	ss := NewShareSyncer(driveClient, shareRepo, logger)
 
-	err := ss.UpdateWithAdvanceSharing(share, 12345)
+	err := ss.UpdateWithAdvanceSharing(context.Background(), share, 12345)
 	if err != nil {
 		t.Fatalf("UpdateWithAdvanceSharing() error = %v", err)
 	}
@@ -291,7 +361,7 @@ func TestShareSyncer_UpdateWithAdvanceSharing_APIError(t *testing.T) {
 
 	ss := NewShareSyncer(driveClient, shareRepo, logger)
 
-	err := ss.UpdateWithAdvanceSharing(share, 12345)
+	err := ss.UpdateWithAdvanceSharing(context.Background(), share, 12345)
 	if err == nil {
 		t.Fatal("expected error, got nil")
 	}
@@ -320,7 +390,7 @@ func TestShareSyncer_UpdateWithAdvanceSharing_UpdateError(t *testing.T) {
 
 	ss := NewShareSyncer(driveClient, shareRepo, logger)
 
-	err := ss.UpdateWithAdvanceSharing(share, 12345)
+	err := ss.UpdateWithAdvanceSharing(context.Background(), share, 12345)
 	if err == nil {
 		t.Fatal("expected error, got nil")
 	}
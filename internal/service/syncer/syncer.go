@@ -2,7 +2,9 @@ package syncer
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/vertextoedge/synology-file-cache/internal/domain"
@@ -20,8 +22,23 @@ type Config struct {
 	ScanBatchSize       int
 	ScanConcurrency     int
 	PageSize            int
+	FetchConcurrency    int // Listing pages fetched in parallel after the first
 	MaxDownloadRetries  int
-	MaxCacheSize        int64 // Maximum file size that can be cached
+	MaxCacheSize        int64         // Maximum file size that can be cached
+	PreseedPaths        []string      // Folders that are always cached, from configuration
+	TeamFolders         []string      // Team folder names or IDs scanned on every full sync
+	TeamFolderPriority  int           // Priority of files in team folders
+	IncludePaths        []IncludePath // Personal Drive folders scanned on every full sync
+	MissingUpstreamTTL  time.Duration // How long files found deleted on the NAS are not enqueued again
+
+	// Limits for recursive folder scans (0 = unlimited)
+	ScanMaxDepth    int
+	ScanMaxFiles    int
+	ScanMaxFileSize int64
+	ScanExclude     []ExcludePattern
+
+	// Hit ratio feedback on RecentModifiedDays and ScanMaxDepth, see EnableAutoTune
+	AutoTune AutoTuneConfig
 }
 
 // DefaultConfig returns default syncer configuration
@@ -34,10 +51,21 @@ func DefaultConfig() *Config {
 		ScanBatchSize:       200,
 		ScanConcurrency:     3,
 		PageSize:            200,
+		FetchConcurrency:    4,
 		MaxDownloadRetries:  3,
+		TeamFolderPriority:  domain.PriorityStarred,
+		MissingUpstreamTTL:  24 * time.Hour,
+		AutoTune:            DefaultAutoTuneConfig(),
 	}
 }
 
+// Leadership tells the syncer whether this instance should scan when
+// several instances share one database
+type Leadership interface {
+	IsLeader() bool
+	Elected() <-chan struct{}
+}
+
 // Syncer synchronizes file metadata from Synology Drive
 type Syncer struct {
 	config      *Config
@@ -45,11 +73,31 @@ type Syncer struct {
 	files       port.FileRepository
 	shares      port.ShareRepository
 	tasks       port.DownloadTaskRepository
+	audit       port.AuditRepository // nil unless audit logging is enabled
 	logger      *zap.Logger
 	scanner     *Scanner
 	shareSyncer *ShareSyncer
+	revoker     *shareRevoker
+	fsSyncer    *FileStationShareSyncer // nil unless File Station shares are enabled
+	shareLinks  port.FileStationClient  // nil unless shares can be created through the API
+	preseeds    port.PreseedRepository  // nil unless pre-seeded paths can be managed at runtime
+	labels      port.LabelRepository    // nil unless labels are stored for browsing
+	leadership  Leadership              // nil when this is the only instance
+	events      port.EventPublisher     // nil unless events are streamed
+	quota       *quotaGuard             // nil unless owner/label quotas are set
+	tuner       *scopeTuner             // nil unless the sync scope follows the hit ratio
+	trigger     chan struct{}           // Wakes the incremental loop for pending changes or a requested sync
+	preseedNow  chan struct{}           // Requests a scan of pre-seeded paths
 	running     bool
 	cancel      context.CancelFunc
+
+	// Drive change notifications waiting for the incremental loop
+	pendingMu sync.Mutex
+	pending   []domain.DriveChange
+	resync    bool // An incremental sync was requested
+
+	changesMu sync.Mutex // Serializes ApplyChanges
+	lastSeq   int64      // Sequence number of the last applied change (0 = none yet)
 }
 
 // New creates a new Syncer
@@ -61,11 +109,15 @@ func New(cfg *Config, drive port.DriveClient, files port.FileRepository, shares
 	scanner := NewScanner(&ScannerConfig{
 		MaxConcurrency: cfg.ScanConcurrency,
 		BatchSize:      cfg.ScanBatchSize,
+		MaxDepth:       cfg.ScanMaxDepth,
+		MaxFiles:       cfg.ScanMaxFiles,
+		MaxFileSize:    cfg.ScanMaxFileSize,
+		Exclude:        cfg.ScanExclude,
 	}, drive, files, tasks, logger)
 
 	shareSyncer := NewShareSyncer(drive, shares, logger)
 
-	return &Syncer{
+	s := &Syncer{
 		config:      cfg,
 		drive:       drive,
 		files:       files,
@@ -74,9 +126,106 @@ func New(cfg *Config, drive port.DriveClient, files port.FileRepository, shares
 		logger:      logger,
 		scanner:     scanner,
 		shareSyncer: shareSyncer,
+		revoker:     &shareRevoker{shares: shares, files: files, logger: logger},
+		trigger:     make(chan struct{}, 1),
+		preseedNow:  make(chan struct{}, 1),
+	}
+	// Files found by folder scans are subject to the same size and quota checks
+	scanner.enqueue = s.enqueueDownloadTask
+	return s
+}
+
+// TriggerSync requests an immediate incremental sync, e.g. from a change
+// notification without changes. It never blocks; requests arriving while a
+// sync is pending are coalesced.
+func (s *Syncer) TriggerSync() {
+	s.pendingMu.Lock()
+	s.resync = true
+	s.pendingMu.Unlock()
+	s.wake()
+}
+
+// wake signals the incremental loop without blocking
+func (s *Syncer) wake() {
+	select {
+	case s.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// TriggerPreseedSync requests a scan of pre-seeded paths, e.g. after one was added.
+// It never blocks; requests arriving while a scan is pending are coalesced.
+func (s *Syncer) TriggerPreseedSync() {
+	select {
+	case s.preseedNow <- struct{}{}:
+	default:
+	}
+}
+
+// EnablePreseedPaths adds paths managed through the admin API to the configured ones
+func (s *Syncer) EnablePreseedPaths(preseeds port.PreseedRepository) {
+	s.preseeds = preseeds
+}
+
+// EnableLabels stores the Drive labels and the files carrying them on every full sync
+func (s *Syncer) EnableLabels(labels port.LabelRepository) {
+	s.labels = labels
+}
+
+// EnableFileStationShares imports File Station sharing links on every full sync
+func (s *Syncer) EnableFileStationShares(fs port.FileStationClient) {
+	s.fsSyncer = NewFileStationShareSyncer(fs, s.files, s.shares, s.config.PageSize, s.logger)
+	s.fsSyncer.drive = s.drive
+	s.fsSyncer.audit = s.audit
+	s.fsSyncer.revoker = s.revoker
+}
+
+// EnableRevocationPurge deletes the cached copy of a file once its last share
+// was revoked on the NAS, unless the file is starred or pre-seeded
+func (s *Syncer) EnableRevocationPurge(cache CacheDeleter) {
+	s.revoker.purge = cache
+}
+
+// EnableAudit records share lifecycle changes made by the sync in the audit log
+func (s *Syncer) EnableAudit(audit port.AuditRepository) {
+	s.audit = audit
+	s.shareSyncer.audit = audit
+	s.revoker.audit = audit
+	if s.fsSyncer != nil {
+		s.fsSyncer.audit = audit
 	}
 }
 
+// EnableQuotas stops enqueuing files of an owner or label whose cached and
+// queued files already reach the quota
+func (s *Syncer) EnableQuotas(quota domain.Quota) {
+	s.quota = &quotaGuard{quota: quota, files: s.files, logger: s.logger}
+}
+
+// EnableEvents publishes a sync.completed event after every sync that ran to the end
+func (s *Syncer) EnableEvents(events port.EventPublisher) {
+	s.events = events
+}
+
+// EnableLeaderElection restricts scanning to the instance holding leadership.
+// A full sync runs each time this instance becomes leader.
+func (s *Syncer) EnableLeaderElection(leadership Leadership) {
+	s.leadership = leadership
+}
+
+// isLeader reports whether this instance should scan
+func (s *Syncer) isLeader() bool {
+	return s.leadership == nil || s.leadership.IsLeader()
+}
+
+// elected returns the leadership signal, or nil if leader election is disabled
+func (s *Syncer) elected() <-chan struct{} {
+	if s.leadership == nil {
+		return nil
+	}
+	return s.leadership.Elected()
+}
+
 // Start starts the sync loops
 func (s *Syncer) Start(ctx context.Context) error {
 	if s.running {
@@ -89,9 +238,11 @@ func (s *Syncer) Start(ctx context.Context) error {
 		zap.Duration("full_scan_interval", s.config.FullScanInterval),
 		zap.Duration("incremental_interval", s.config.IncrementalInterval))
 
-	// Run full scan immediately
-	if err := s.FullSync(ctx); err != nil {
-		s.logger.Error("initial full sync failed", zap.Error(err))
+	// Run full scan immediately; with leader election it runs once elected
+	if s.leadership == nil {
+		if err := s.FullSync(ctx); err != nil {
+			s.logger.Error("initial full sync failed", zap.Error(err))
+		}
 	}
 
 	// Start background loops
@@ -121,14 +272,30 @@ func (s *Syncer) fullScanLoop(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
+			if !s.isLeader() {
+				continue
+			}
 			if err := s.FullSync(ctx); err != nil {
 				s.logger.Error("full sync failed", zap.Error(err))
 			}
+		case <-s.elected():
+			// A new leader cannot know when the previous one last scanned
+			if err := s.FullSync(ctx); err != nil {
+				s.logger.Error("full sync failed", zap.Error(err))
+			}
+			ticker.Reset(s.config.FullScanInterval)
+		case <-s.preseedNow:
+			if !s.isLeader() {
+				continue
+			}
+			if _, err := s.syncPreseedPaths(ctx); err != nil {
+				s.logger.Error("preseed sync failed", zap.Error(err))
+			}
 		}
 	}
 }
 
-// incrementalLoop runs incremental syncs periodically
+// incrementalLoop runs incremental syncs periodically and on change notifications
 func (s *Syncer) incrementalLoop(ctx context.Context) {
 	ticker := time.NewTicker(s.config.IncrementalInterval)
 	defer ticker.Stop()
@@ -138,9 +305,21 @@ func (s *Syncer) incrementalLoop(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			if err := s.IncrementalSync(ctx); err != nil {
-				s.logger.Error("incremental sync failed", zap.Error(err))
+			if !s.isLeader() {
+				continue
+			}
+			// Changes left over while the NAS was down go first
+			s.syncPending(ctx, true)
+		case <-s.trigger:
+			if !s.isLeader() {
+				// The leader's polling picks up the change
+				s.takePending()
+				s.logger.Debug("change notification ignored, not the sync leader")
+				continue
 			}
+			s.syncPending(ctx, false)
+			// Polling only acts as a fallback while notifications keep arriving
+			ticker.Reset(s.config.IncrementalInterval)
 		}
 	}
 }
@@ -152,73 +331,250 @@ func (s *Syncer) FullSync(ctx context.Context) error {
 
 	results := &SyncResults{}
 
+	// Sync pre-seeded paths first so they are queued ahead of everything else
+	count, err := s.syncPreseedPaths(ctx)
+	results.PreseedCount = count
+	if s.upstreamDown(err) {
+		return nil
+	}
+	if err != nil {
+		s.logger.Error("failed to sync preseed paths", zap.Error(err))
+	}
+
 	// Sync shared files (highest priority)
-	count, err := s.syncSharedFiles(ctx)
+	count, err = s.syncSharedFiles(ctx, nil)
 	results.SharedCount = count
+	if s.upstreamDown(err) {
+		return nil
+	}
 	if err != nil {
 		s.logger.Error("failed to sync shared files", zap.Error(err))
 	}
 
 	// Sync starred files
-	count, err = s.syncStarredFiles(ctx)
+	count, err = s.syncStarredFiles(ctx, nil)
 	results.StarredCount = count
+	if s.upstreamDown(err) {
+		return nil
+	}
 	if err != nil {
 		s.logger.Error("failed to sync starred files", zap.Error(err))
 	}
 
 	// Sync labeled files
-	count, err = s.syncLabeledFiles(ctx)
+	count, err = s.syncLabeledFiles(ctx, nil)
 	results.LabeledCount = count
+	if s.upstreamDown(err) {
+		return nil
+	}
 	if err != nil {
 		s.logger.Error("failed to sync labeled files", zap.Error(err))
 	}
 
+	// Scan selected team folders
+	count, err = s.syncTeamFolders(ctx, nil)
+	results.TeamFolderCount = count
+	if s.upstreamDown(err) {
+		return nil
+	}
+	if err != nil {
+		s.logger.Error("failed to sync team folders", zap.Error(err))
+	}
+
+	// Scan selected personal folders
+	count, err = s.syncIncludePaths(ctx, nil)
+	results.IncludePathCount = count
+	if s.upstreamDown(err) {
+		return nil
+	}
+	if err != nil {
+		s.logger.Error("failed to sync include paths", zap.Error(err))
+	}
+
 	// Sync recent files
-	count, err = s.syncRecentFiles(ctx)
+	count, err = s.syncRecentFiles(ctx, nil)
 	results.RecentCount = count
+	if s.upstreamDown(err) {
+		return nil
+	}
 	if err != nil {
 		s.logger.Error("failed to sync recent files", zap.Error(err))
 	}
 
+	// Import File Station links last so the files they point to are already tracked
+	if s.fsSyncer != nil {
+		count, err = s.fsSyncer.SyncAll(ctx)
+		results.FileStationShareCount = count
+		if s.upstreamDown(err) {
+			return nil
+		}
+		if err != nil {
+			s.logger.Error("failed to sync file station shares", zap.Error(err))
+		}
+	}
+
 	s.logger.Info("full sync completed",
 		zap.Duration("duration", time.Since(start)),
+		zap.Int("preseed", results.PreseedCount),
 		zap.Int("shared", results.SharedCount),
 		zap.Int("starred", results.StarredCount),
 		zap.Int("labeled", results.LabeledCount),
-		zap.Int("recent", results.RecentCount))
+		zap.Int("team_folders", results.TeamFolderCount),
+		zap.Int("include_paths", results.IncludePathCount),
+		zap.Int("recent", results.RecentCount),
+		zap.Int("filestation_shares", results.FileStationShareCount))
+	s.publishCompleted("full", map[string]int{
+		"preseed":            results.PreseedCount,
+		"shared":             results.SharedCount,
+		"starred":            results.StarredCount,
+		"labeled":            results.LabeledCount,
+		"team_folders":       results.TeamFolderCount,
+		"include_paths":      results.IncludePathCount,
+		"recent":             results.RecentCount,
+		"filestation_shares": results.FileStationShareCount,
+	})
+	s.tuneScope()
 
 	return nil
 }
 
 // IncrementalSync performs an incremental sync
 func (s *Syncer) IncrementalSync(ctx context.Context) error {
-	if _, err := s.syncSharedFiles(ctx); err != nil {
+	counts := make(map[string]int, 4)
+	var err error
+	if counts["shared"], err = s.syncSharedFiles(ctx, nil); s.upstreamDown(err) {
+		return nil
+	} else if err != nil {
 		s.logger.Warn("failed to sync shared files", zap.Error(err))
 	}
-	if _, err := s.syncStarredFiles(ctx); err != nil {
+	if counts["starred"], err = s.syncStarredFiles(ctx, nil); s.upstreamDown(err) {
+		return nil
+	} else if err != nil {
 		s.logger.Warn("failed to sync starred files", zap.Error(err))
 	}
-	if _, err := s.syncLabeledFiles(ctx); err != nil {
+	if counts["labeled"], err = s.syncLabeledFiles(ctx, nil); s.upstreamDown(err) {
+		return nil
+	} else if err != nil {
 		s.logger.Warn("failed to sync labeled files", zap.Error(err))
 	}
-	_, err := s.syncRecentFiles(ctx)
-	return err
+	if counts["recent"], err = s.syncRecentFiles(ctx, nil); s.upstreamDown(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	s.publishCompleted("incremental", counts)
+	return nil
+}
+
+// publishCompleted publishes sync.completed with the files seen per source
+func (s *Syncer) publishCompleted(kind string, counts map[string]int) {
+	if s.events == nil {
+		return
+	}
+	s.events.Publish(domain.Event{
+		Type:   domain.EventSyncCompleted,
+		Kind:   kind,
+		Counts: counts,
+	})
+}
+
+// upstreamDown reports whether err means NAS calls are paused after repeated
+// failures. The rest of the sync run is skipped and the outage logged once.
+func (s *Syncer) upstreamDown(err error) bool {
+	if !errors.Is(err, domain.ErrUpstreamUnavailable) {
+		return false
+	}
+	pause, _ := domain.GetRetryAfter(err)
+	s.logger.Warn("NAS unavailable, skipping the rest of this sync", zap.Duration("retry_in", pause))
+	return true
 }
 
 // SyncResults contains results from a sync operation
 type SyncResults struct {
-	SharedCount  int
-	StarredCount int
-	LabeledCount int
-	RecentCount  int
+	PreseedCount          int
+	SharedCount           int
+	StarredCount          int
+	LabeledCount          int
+	TeamFolderCount       int
+	IncludePathCount      int
+	RecentCount           int
+	FileStationShareCount int
+}
+
+// preseedPaths returns the configured and runtime-managed pre-seeded paths without duplicates
+func (s *Syncer) preseedPaths() ([]string, error) {
+	paths := make([]string, 0, len(s.config.PreseedPaths))
+	seen := make(map[string]bool)
+	add := func(p string) {
+		if p != "" && !seen[p] {
+			seen[p] = true
+			paths = append(paths, p)
+		}
+	}
+
+	for _, p := range s.config.PreseedPaths {
+		add(p)
+	}
+	if s.preseeds != nil {
+		stored, err := s.preseeds.ListPreseedPaths()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list preseed paths: %w", err)
+		}
+		for _, p := range stored {
+			add(p.Path)
+		}
+	}
+
+	return paths, nil
 }
 
-// syncSharedFiles syncs files shared with others
-func (s *Syncer) syncSharedFiles(ctx context.Context) (int, error) {
+// syncPreseedPaths scans pre-seeded folders with pinned priority and unpins
+// files of folders that are no longer pre-seeded
+func (s *Syncer) syncPreseedPaths(ctx context.Context) (int, error) {
+	paths, err := s.preseedPaths()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, path := range paths {
+		result, err := s.scanner.ScanPath(ctx, path, domain.PriorityPinned)
+		if errors.Is(err, domain.ErrUpstreamUnavailable) {
+			// Don't unpin anything based on an incomplete scan
+			return count, err
+		}
+		if err != nil {
+			s.logger.Warn("failed to scan preseed path",
+				zap.String("path", path),
+				zap.Error(err))
+			continue
+		}
+		count += result.TotalFiles
+	}
+
+	unpinned, err := s.files.UnpinFiles(paths)
+	if err != nil {
+		return count, fmt.Errorf("failed to unpin files: %w", err)
+	}
+
+	if len(paths) > 0 || unpinned > 0 {
+		s.logger.Info("synced preseed paths",
+			zap.Int("paths", len(paths)),
+			zap.Int("count", count),
+			zap.Int("unpinned", unpinned))
+	}
+	return count, nil
+}
+
+// syncSharedFiles syncs files shared with others and revokes Drive shares
+// that are no longer listed. With dry set nothing is written.
+func (s *Syncer) syncSharedFiles(ctx context.Context, dry *dryRun) (int, error) {
 	opts := &SyncOptions{
 		Priority:           domain.PriorityShared,
 		UpdateShared:       true,
 		CreateShareRecords: true,
+		ListedShares:       make(map[string]bool),
+		DryRun:             dry,
 	}
 
 	count, err := s.syncFilesWithFetcher(ctx, s.drive.GetSharedFiles, opts)
@@ -226,16 +582,34 @@ func (s *Syncer) syncSharedFiles(ctx context.Context) (int, error) {
 		return count, err
 	}
 
-	s.logger.Info("synced shared files", zap.Int("count", count))
+	if dry != nil {
+		unlisted, err := s.revoker.unlistedShares(shareSourceDrive, opts.ListedShares)
+		if err != nil {
+			return count, err
+		}
+		for _, share := range unlisted {
+			dry.report.RevokedShares = append(dry.report.RevokedShares, share.Token)
+		}
+		return count, nil
+	}
+
+	// The listing is complete, so shares missing from it were removed on the NAS
+	revoked, err := s.revoker.revokeUnlisted(shareSourceDrive, opts.ListedShares)
+	if err != nil {
+		s.logger.Warn("failed to revoke removed shares", zap.Error(err))
+	}
+
+	s.logger.Info("synced shared files", zap.Int("count", count), zap.Int("revoked", revoked))
 	return count, nil
 }
 
 // syncStarredFiles syncs starred files
-func (s *Syncer) syncStarredFiles(ctx context.Context) (int, error) {
+func (s *Syncer) syncStarredFiles(ctx context.Context, dry *dryRun) (int, error) {
 	opts := &SyncOptions{
 		Priority:      domain.PriorityStarred,
 		UpdateStarred: true,
 		ScanDirs:      true,
+		DryRun:        dry,
 	}
 
 	count, err := s.syncFilesWithFetcher(ctx, s.drive.GetStarredFiles, opts)
@@ -248,14 +622,18 @@ func (s *Syncer) syncStarredFiles(ctx context.Context) (int, error) {
 }
 
 // syncLabeledFiles syncs files with labels
-func (s *Syncer) syncLabeledFiles(ctx context.Context) (int, error) {
-	labels, err := s.drive.GetLabels()
+func (s *Syncer) syncLabeledFiles(ctx context.Context, dry *dryRun) (int, error) {
+	labels, err := s.drive.GetLabels(ctx)
 	if err != nil {
 		return 0, fmt.Errorf("failed to get labels: %w", err)
 	}
 
 	s.logger.Info("found labels", zap.Int("count", len(labels)))
 
+	if s.labels != nil && dry == nil {
+		s.storeLabels(labels)
+	}
+
 	if len(labels) == 0 {
 		return 0, nil
 	}
@@ -265,19 +643,26 @@ func (s *Syncer) syncLabeledFiles(ctx context.Context) (int, error) {
 	for _, label := range labels {
 		if s.isLabelExcluded(label.Name) {
 			s.logger.Debug("skipping excluded label", zap.String("label", label.Name))
+			if dry != nil {
+				dry.report.ExcludedLabels = append(dry.report.ExcludedLabels, label.Name)
+			}
 			continue
 		}
 
-		fetcher := func(offset, limit int) (*port.DriveListResponse, error) {
-			return s.drive.GetLabeledFiles(label.ID, offset, limit)
+		fetcher := func(ctx context.Context, offset, limit int) (*port.DriveListResponse, error) {
+			return s.drive.GetLabeledFiles(ctx, label.ID, offset, limit)
 		}
 
 		opts := &SyncOptions{
 			Priority: domain.PriorityStarred, // Same priority as starred
 			ScanDirs: true,
+			DryRun:   dry,
 		}
 
 		count, err := s.syncFilesWithFetcher(ctx, fetcher, opts)
+		if errors.Is(err, domain.ErrUpstreamUnavailable) {
+			return totalCount, err
+		}
 		if err != nil {
 			s.logger.Warn("failed to sync files for label",
 				zap.String("label", label.Name),
@@ -292,8 +677,8 @@ func (s *Syncer) syncLabeledFiles(ctx context.Context) (int, error) {
 }
 
 // syncRecentFiles syncs recently modified files
-func (s *Syncer) syncRecentFiles(ctx context.Context) (int, error) {
-	recent, err := s.drive.GetRecentFiles(0, 200)
+func (s *Syncer) syncRecentFiles(ctx context.Context, dry *dryRun) (int, error) {
+	recent, err := s.drive.GetRecentFiles(ctx, 0, 200)
 	if err != nil {
 		return 0, fmt.Errorf("failed to get recent files: %w", err)
 	}
@@ -303,7 +688,7 @@ func (s *Syncer) syncRecentFiles(ctx context.Context) (int, error) {
 		zap.Int("total", recent.Total))
 
 	now := time.Now()
-	recentThreshold := now.AddDate(0, 0, -s.config.RecentModifiedDays)
+	recentThreshold := now.AddDate(0, 0, -s.recentModifiedDays())
 	count := 0
 
 	for _, file := range recent.Items {
@@ -329,7 +714,7 @@ func (s *Syncer) syncRecentFiles(ctx context.Context) (int, error) {
 			continue
 		}
 
-		if err := s.processFile(ctx, &file, domain.PriorityRecentModified, &now, nil); err != nil {
+		if err := s.processFile(ctx, &file, domain.PriorityRecentModified, &now, &SyncOptions{DryRun: dry}); err != nil {
 			s.logger.Warn("failed to process recent file",
 				zap.String("path", file.Path),
 				zap.Error(err))
@@ -342,6 +727,23 @@ func (s *Syncer) syncRecentFiles(ctx context.Context) (int, error) {
 	return count, nil
 }
 
+// storeLabels replaces the stored labels with the ones on the NAS.
+// Files synced afterwards update their own label mappings.
+func (s *Syncer) storeLabels(labels []port.DriveLabel) {
+	stored := make([]*domain.Label, 0, len(labels))
+	for _, label := range labels {
+		stored = append(stored, &domain.Label{
+			SynoLabelID: label.ID,
+			Name:        label.Name,
+			Excluded:    s.isLabelExcluded(label.Name),
+		})
+	}
+
+	if err := s.labels.SyncLabels(stored); err != nil {
+		s.logger.Warn("failed to store labels", zap.Error(err))
+	}
+}
+
 // isLabelExcluded checks if a label should be excluded
 func (s *Syncer) isLabelExcluded(labelName string) bool {
 	for _, excluded := range s.config.ExcludeLabels {
@@ -0,0 +1,91 @@
+package syncer
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"go.uber.org/zap"
+)
+
+// mockPreseedRepository returns a fixed list of stored preseed paths
+type mockPreseedRepository struct {
+	paths []*domain.PreseedPath
+}
+
+func (m *mockPreseedRepository) ListPreseedPaths() ([]*domain.PreseedPath, error) {
+	return m.paths, nil
+}
+func (m *mockPreseedRepository) AddPreseedPath(p *domain.PreseedPath) error { return nil }
+func (m *mockPreseedRepository) DeletePreseedPath(id int64) error           { return nil }
+
+// mockLabelRepository records the labels stored by the syncer
+type mockLabelRepository struct {
+	synced []*domain.Label
+}
+
+func (m *mockLabelRepository) SyncLabels(labels []*domain.Label) error {
+	m.synced = labels
+	return nil
+}
+func (m *mockLabelRepository) ListLabels() ([]*domain.LabelUsage, error)     { return nil, nil }
+func (m *mockLabelRepository) GetLabel(id int64) (*domain.LabelUsage, error) { return nil, nil }
+func (m *mockLabelRepository) ListLabelFiles(labelID int64, cached *bool, limit, offset int) ([]*domain.File, int, error) {
+	return nil, 0, nil
+}
+
+func TestSyncer_TriggerSync_Coalesces(t *testing.T) {
+	s := New(nil, &mockDriveClient{}, nil, nil, nil, zap.NewNop())
+
+	// Must never block, even with nobody consuming notifications
+	for i := 0; i < 5; i++ {
+		s.TriggerSync()
+	}
+
+	if got := len(s.trigger); got != 1 {
+		t.Errorf("pending triggers = %d, want 1", got)
+	}
+}
+
+func TestSyncer_PreseedPaths_MergesConfigAndStored(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.PreseedPaths = []string{"/team/docs", "/projects"}
+	s := New(cfg, &mockDriveClient{}, nil, nil, nil, zap.NewNop())
+	s.EnablePreseedPaths(&mockPreseedRepository{paths: []*domain.PreseedPath{
+		{ID: 1, Path: "/projects"},
+		{ID: 2, Path: "/media/posters"},
+	}})
+
+	paths, err := s.preseedPaths()
+	if err != nil {
+		t.Fatalf("preseedPaths() error = %v", err)
+	}
+
+	want := []string{"/team/docs", "/projects", "/media/posters"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("preseedPaths() = %v, want %v", paths, want)
+	}
+}
+
+func TestSyncer_StoreLabels_MarksExcluded(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.ExcludeLabels = []string{"archive"}
+	repo := &mockLabelRepository{}
+	s := New(cfg, &mockDriveClient{}, nil, nil, nil, zap.NewNop())
+	s.EnableLabels(repo)
+
+	s.storeLabels([]port.DriveLabel{
+		{ID: "1", Name: "finance"},
+		{ID: "2", Name: "archive"},
+	})
+
+	if len(repo.synced) != 2 {
+		t.Fatalf("synced %d labels, want 2", len(repo.synced))
+	}
+	for _, label := range repo.synced {
+		if want := label.Name == "archive"; label.Excluded != want {
+			t.Errorf("label %q excluded = %v, want %v", label.Name, label.Excluded, want)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package syncer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"go.uber.org/zap"
+)
+
+// selectTeamFolders returns the team folders matched by the configured
+// selectors, each given as a team folder name or ID, and the selectors that
+// matched none
+func selectTeamFolders(folders []port.DriveTeamFolder, selectors []string) ([]port.DriveTeamFolder, []string) {
+	var selected []port.DriveTeamFolder
+	var unmatched []string
+	picked := make(map[string]bool)
+
+	for _, sel := range selectors {
+		found := false
+		for _, folder := range folders {
+			id := folder.GetIDString()
+			if folder.Name != sel && id != sel {
+				continue
+			}
+			found = true
+			if !picked[id] {
+				picked[id] = true
+				selected = append(selected, folder)
+			}
+		}
+		if !found {
+			unmatched = append(unmatched, sel)
+		}
+	}
+
+	return selected, unmatched
+}
+
+// teamFolderPriority returns the priority of files synced from team folders
+func (s *Syncer) teamFolderPriority() int {
+	if s.config.TeamFolderPriority <= domain.PriorityPinned {
+		return domain.PriorityStarred
+	}
+	return s.config.TeamFolderPriority
+}
+
+// syncTeamFolders scans the configured team folders. With dry set the folders
+// are only reported.
+func (s *Syncer) syncTeamFolders(ctx context.Context, dry *dryRun) (int, error) {
+	if len(s.config.TeamFolders) == 0 {
+		return 0, nil
+	}
+
+	folders, err := s.drive.GetTeamFolders(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get team folders: %w", err)
+	}
+
+	selected, unmatched := selectTeamFolders(folders, s.config.TeamFolders)
+	if len(unmatched) > 0 {
+		s.logger.Warn("configured team folders not found", zap.Strings("team_folders", unmatched))
+	}
+
+	priority := s.teamFolderPriority()
+	scan := make([]IncludePath, 0, len(selected))
+	for _, folder := range selected {
+		scan = append(scan, IncludePath{Path: folder.Path, Priority: priority})
+	}
+
+	count, err := s.scanFolders(ctx, scan, dry)
+	if err != nil {
+		return count, err
+	}
+	if dry == nil {
+		s.logger.Info("synced team folders",
+			zap.Int("team_folders", len(selected)),
+			zap.Int("count", count))
+	}
+	return count, nil
+}
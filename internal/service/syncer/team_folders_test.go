@@ -0,0 +1,50 @@
+package syncer
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"go.uber.org/zap"
+)
+
+func TestSelectTeamFolders(t *testing.T) {
+	folders := []port.DriveTeamFolder{
+		{ID: "10", Name: "Marketing", Path: "/team-folders/Marketing"},
+		{ID: "11", Name: "Design", Path: "/team-folders/Design"},
+		{ID: "12", Name: "Finance", Path: "/team-folders/Finance"},
+	}
+
+	selected, unmatched := selectTeamFolders(folders, []string{"Design", "10", "Marketing", "Legal"})
+
+	var paths []string
+	for _, f := range selected {
+		paths = append(paths, f.Path)
+	}
+	if want := []string{"/team-folders/Design", "/team-folders/Marketing"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("selected = %v, want %v", paths, want)
+	}
+	if want := []string{"Legal"}; !reflect.DeepEqual(unmatched, want) {
+		t.Errorf("unmatched = %v, want %v", unmatched, want)
+	}
+}
+
+func TestSyncer_TeamFolderPriority(t *testing.T) {
+	cfg := DefaultConfig()
+	s := New(cfg, &mockDriveClient{}, nil, nil, nil, zap.NewNop())
+	if got := s.teamFolderPriority(); got != domain.PriorityStarred {
+		t.Errorf("default priority = %d, want %d", got, domain.PriorityStarred)
+	}
+
+	cfg.TeamFolderPriority = 4
+	if got := s.teamFolderPriority(); got != 4 {
+		t.Errorf("priority = %d, want 4", got)
+	}
+
+	// Pinning is reserved for pre-seeded paths
+	cfg.TeamFolderPriority = 0
+	if got := s.teamFolderPriority(); got != domain.PriorityStarred {
+		t.Errorf("priority 0 = %d, want %d", got, domain.PriorityStarred)
+	}
+}
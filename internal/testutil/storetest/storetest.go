@@ -0,0 +1,318 @@
+// Package storetest is a contract test suite for port.Store adapters. Every
+// adapter runs the same cases, so the SQLite and PostgreSQL stores cannot
+// drift apart in behaviour the services rely on.
+//
+//	func TestStoreContract(t *testing.T) {
+//		storetest.Run(t, func(t *testing.T) (storetest.Store, func() storetest.Store) {
+//			path := filepath.Join(t.TempDir(), "cache.db")
+//			open := func() storetest.Store { return openTestStore(t, path) }
+//			return open(), open
+//		})
+//	}
+package storetest
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/vertextoedge/synology-file-cache/internal/domain"
+	"github.com/vertextoedge/synology-file-cache/internal/port"
+	"github.com/vertextoedge/synology-file-cache/internal/util/passhash"
+)
+
+// Store is the adapter surface the suite exercises
+type Store interface {
+	port.Store
+
+	// SchemaVersion returns the latest applied migration version
+	SchemaVersion() (int, error)
+
+	// MigrateDown reverts the applied migrations newer than version
+	MigrateDown(version int) error
+}
+
+// OpenFunc opens a store on an empty database and returns it with a function
+// that reopens the same database. Stores are closed by the adapter's test
+// cleanup; the suite may close one earlier before reopening.
+type OpenFunc func(t *testing.T) (Store, func() Store)
+
+// Run runs every contract case against the stores opened by open
+func Run(t *testing.T, open OpenFunc) {
+	t.Run("ClaimCompleteRelease", func(t *testing.T) {
+		s, _ := open(t)
+		testClaimCompleteRelease(t, s)
+	})
+	t.Run("UpsertFlags", func(t *testing.T) {
+		s, _ := open(t)
+		testUpsertFlags(t, s)
+	})
+	t.Run("ShareLookups", func(t *testing.T) {
+		s, _ := open(t)
+		testShareLookups(t, s)
+	})
+	t.Run("MissingUpstream", func(t *testing.T) {
+		s, _ := open(t)
+		testMissingUpstream(t, s)
+	})
+	t.Run("Migrations", func(t *testing.T) {
+		s, reopen := open(t)
+		testMigrations(t, s, reopen)
+	})
+}
+
+// addFile stores a file record
+func addFile(t *testing.T, s Store, synoID string, priority int, size int64) *domain.File {
+	t.Helper()
+	result, err := s.UpsertBySynoID(&domain.File{SynoFileID: synoID, Path: "/mydrive/" + synoID, Size: size, Priority: priority})
+	if err != nil {
+		t.Fatalf("UpsertBySynoID(%s) error = %v", synoID, err)
+	}
+	return result.File
+}
+
+// addTask queues a download of file
+func addTask(t *testing.T, s Store, file *domain.File) *domain.DownloadTask {
+	t.Helper()
+	task := &domain.DownloadTask{FileID: file.ID, SynoPath: file.Path, Priority: file.Priority, Size: file.Size, MaxRetries: 3}
+	if err := s.CreateTask(task); err != nil {
+		t.Fatalf("CreateTask(%s) error = %v", file.Path, err)
+	}
+	return task
+}
+
+// claim claims the next task for worker and checks it is the task of file
+func claim(t *testing.T, s Store, worker string, want *domain.File) *domain.DownloadTask {
+	t.Helper()
+	task, err := s.ClaimNextTask(worker)
+	if err != nil {
+		t.Fatalf("ClaimNextTask() error = %v", err)
+	}
+	if task == nil {
+		t.Fatalf("ClaimNextTask() = nil, want the task of %s", want.Path)
+	}
+	if task.FileID != want.ID {
+		t.Fatalf("ClaimNextTask() claimed %s, want %s", task.SynoPath, want.Path)
+	}
+	if task.Status != domain.TaskStatusInProgress || task.WorkerID != worker {
+		t.Errorf("claimed task = %s by %q, want in progress by %s", task.Status, task.WorkerID, worker)
+	}
+	return task
+}
+
+func testClaimCompleteRelease(t *testing.T, s Store) {
+	small := addFile(t, s, "small", domain.PriorityDefault, 100)
+	large := addFile(t, s, "large", domain.PriorityDefault, 200)
+	shared := addFile(t, s, "shared", domain.PriorityShared, 500)
+	for _, file := range []*domain.File{large, small, shared} {
+		addTask(t, s, file)
+	}
+
+	// Urgent tasks first, then the smallest
+	sharedTask := claim(t, s, "w1", shared)
+	smallTask := claim(t, s, "w2", small)
+	largeTask := claim(t, s, "w1", large)
+	if task, err := s.ClaimNextTask("w3"); err != nil || task != nil {
+		t.Fatalf("ClaimNextTask() on a drained queue = %+v, %v, want nil", task, err)
+	}
+
+	// Completed tasks leave the queue
+	if err := s.CompleteTask(sharedTask.ID); err != nil {
+		t.Fatalf("CompleteTask() error = %v", err)
+	}
+	if task, err := s.GetTask(sharedTask.ID); err != nil || task != nil {
+		t.Errorf("GetTask() of a completed task = %+v, %v, want nil", task, err)
+	}
+	if active, err := s.HasActiveTask(shared.ID); err != nil || active {
+		t.Errorf("HasActiveTask() after completion = %v, %v, want false", active, err)
+	}
+
+	// Released tasks are pending and claimable again
+	if err := s.ReleaseTask(smallTask.ID); err != nil {
+		t.Fatalf("ReleaseTask() error = %v", err)
+	}
+	task, err := s.GetTask(smallTask.ID)
+	if err != nil || task == nil {
+		t.Fatalf("GetTask() of a released task = %+v, %v", task, err)
+	}
+	if task.Status != domain.TaskStatusPending || task.WorkerID != "" {
+		t.Errorf("released task = %s by %q, want pending without a worker", task.Status, task.WorkerID)
+	}
+	if active, err := s.HasActiveTask(small.ID); err != nil || !active {
+		t.Errorf("HasActiveTask() of a released task = %v, %v, want true", active, err)
+	}
+	claim(t, s, "w3", small)
+
+	// A final failure keeps the task out of the queue
+	if err := s.FailTask(largeTask.ID, "upstream gone", false); err != nil {
+		t.Fatalf("FailTask() error = %v", err)
+	}
+	task, err = s.GetTask(largeTask.ID)
+	if err != nil || task == nil {
+		t.Fatalf("GetTask() of a failed task = %+v, %v", task, err)
+	}
+	if task.Status != domain.TaskStatusFailed || task.LastError != "upstream gone" {
+		t.Errorf("failed task = %s (%q), want failed (upstream gone)", task.Status, task.LastError)
+	}
+	if task, err := s.ClaimNextTask("w4"); err != nil || task != nil {
+		t.Errorf("ClaimNextTask() with only a failed task = %+v, %v, want nil", task, err)
+	}
+}
+
+func testUpsertFlags(t *testing.T, s Store) {
+	upsert := func(starred, shared bool) *domain.File {
+		t.Helper()
+		result, err := s.UpsertBySynoID(&domain.File{SynoFileID: "a", Path: "/mydrive/a", Size: 10,
+			Starred: starred, Shared: shared, Priority: domain.PriorityDefault})
+		if err != nil {
+			t.Fatalf("UpsertBySynoID() error = %v", err)
+		}
+		return result.File
+	}
+
+	first := upsert(true, true)
+	// The NAS is the source of truth for both flags
+	if got := upsert(false, false); got.ID != first.ID || got.Starred || got.Shared {
+		t.Errorf("after clearing both flags: ID %d, starred %v, shared %v; want ID %d with neither",
+			got.ID, got.Starred, got.Shared, first.ID)
+	}
+	if got := upsert(false, true); got.Starred || !got.Shared {
+		t.Errorf("starred %v, shared %v, want shared only", got.Starred, got.Shared)
+	}
+}
+
+func testMissingUpstream(t *testing.T, s Store) {
+	file := addFile(t, s, "gone", domain.PriorityDefault, 10)
+	addFile(t, s, "kept", domain.PriorityDefault, 10)
+
+	if err := s.MarkMissingUpstream(file.ID); err != nil {
+		t.Fatalf("MarkMissingUpstream() error = %v", err)
+	}
+	got, err := s.GetByID(file.ID)
+	if err != nil {
+		t.Fatalf("GetByID() error = %v", err)
+	}
+	if got.MissingUpstreamAt == nil {
+		t.Error("file not marked missing upstream")
+	}
+
+	missing, total, err := s.ListMissingUpstream(10, 0)
+	if err != nil {
+		t.Fatalf("ListMissingUpstream() error = %v", err)
+	}
+	if total != 1 || len(missing) != 1 || missing[0].ID != file.ID {
+		t.Errorf("ListMissingUpstream() = %d files of %d, want only %s", len(missing), total, file.Path)
+	}
+}
+
+func testShareLookups(t *testing.T, s Store) {
+	file := addFile(t, s, "report", domain.PriorityShared, 1234)
+	share := &domain.Share{SynoShareID: "s1", Token: "tok1", FileID: file.ID, Password: "open sesame", MaxDownloads: 1}
+	if err := s.CreateShare(share); err != nil {
+		t.Fatalf("CreateShare() error = %v", err)
+	}
+	if share.ID == 0 {
+		t.Error("CreateShare() did not set the share ID")
+	}
+
+	got, err := s.GetShareByToken("tok1")
+	if err != nil || got == nil {
+		t.Fatalf("GetShareByToken() = %+v, %v", got, err)
+	}
+	if got.FileID != file.ID || got.SynoShareID != "s1" || got.Revoked {
+		t.Errorf("GetShareByToken() = %+v, want an active share of file %d", got, file.ID)
+	}
+	// Passwords are stored hashed
+	if !passhash.IsHashed(got.Password) || !passhash.Verify(got.Password, "open sesame") {
+		t.Errorf("stored password = %q, want a hash of the share password", got.Password)
+	}
+
+	gotFile, gotShare, err := s.GetFileByShareToken("tok1")
+	if err != nil || gotFile == nil || gotShare == nil {
+		t.Fatalf("GetFileByShareToken() = %+v, %+v, %v", gotFile, gotShare, err)
+	}
+	if gotFile.ID != file.ID || gotFile.Path != file.Path || gotShare.ID != share.ID {
+		t.Errorf("GetFileByShareToken() = file %d %s, share %d, want file %d %s, share %d",
+			gotFile.ID, gotFile.Path, gotShare.ID, file.ID, file.Path, share.ID)
+	}
+
+	if got, err := s.GetShareByToken("missing"); err != nil || got != nil {
+		t.Errorf("GetShareByToken() of an unknown token = %+v, %v, want nil", got, err)
+	}
+	if f, sh, err := s.GetFileByShareToken("missing"); err != nil || f != nil || sh != nil {
+		t.Errorf("GetFileByShareToken() of an unknown token = %+v, %+v, %v, want nil", f, sh, err)
+	}
+	if err := s.SetShareMaxDownloads("missing", 3); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("SetShareMaxDownloads() of an unknown token error = %v, want ErrNotFound", err)
+	}
+
+	// The download limit is enforced by the store
+	if ok, err := s.ClaimShareDownload(gotShare); err != nil || !ok {
+		t.Fatalf("first ClaimShareDownload() = %v, %v, want true", ok, err)
+	}
+	if ok, err := s.ClaimShareDownload(gotShare); err != nil || ok {
+		t.Errorf("ClaimShareDownload() over the limit = %v, %v, want false", ok, err)
+	}
+
+	// Revoked shares are still found by token but are no longer active
+	other := &domain.Share{SynoShareID: "s2", Token: "tok2", FileID: file.ID}
+	if err := s.CreateShare(other); err != nil {
+		t.Fatalf("CreateShare() error = %v", err)
+	}
+	got.Revoked = true
+	if err := s.UpdateShare(got); err != nil {
+		t.Fatalf("UpdateShare() error = %v", err)
+	}
+	if _, revoked, err := s.GetFileByShareToken("tok1"); err != nil || revoked == nil || !revoked.Revoked {
+		t.Errorf("GetFileByShareToken() of a revoked share = %+v, %v, want it revoked", revoked, err)
+	}
+	active, err := s.ListActiveShares()
+	if err != nil {
+		t.Fatalf("ListActiveShares() error = %v", err)
+	}
+	if len(active) != 1 || active[0].Token != "tok2" {
+		t.Errorf("ListActiveShares() = %v, want only tok2", active)
+	}
+}
+
+func testMigrations(t *testing.T, s Store, reopen func() Store) {
+	latest, err := s.SchemaVersion()
+	if err != nil {
+		t.Fatalf("SchemaVersion() error = %v", err)
+	}
+	if latest < 1 {
+		t.Fatalf("SchemaVersion() = %d on a new database, want the latest migration", latest)
+	}
+
+	file := addFile(t, s, "kept", domain.PriorityDefault, 10)
+	if err := s.CreateShare(&domain.Share{SynoShareID: "s1", Token: "kept", FileID: file.ID}); err != nil {
+		t.Fatalf("CreateShare() error = %v", err)
+	}
+
+	// The baseline cannot be reverted, every later migration can
+	if err := s.MigrateDown(0); err == nil {
+		t.Error("MigrateDown(0) succeeded, want an error for the baseline")
+	}
+	if err := s.MigrateDown(1); err != nil {
+		t.Fatalf("MigrateDown(1) error = %v", err)
+	}
+	if version, err := s.SchemaVersion(); err != nil || version != 1 {
+		t.Fatalf("SchemaVersion() after MigrateDown(1) = %d, %v, want 1", version, err)
+	}
+	s.Close()
+
+	// Opening migrates back up and keeps the data
+	s = reopen()
+	if version, err := s.SchemaVersion(); err != nil || version != latest {
+		t.Fatalf("SchemaVersion() after reopening = %d, %v, want %d", version, err, latest)
+	}
+	gotFile, gotShare, err := s.GetFileByShareToken("kept")
+	if err != nil || gotFile == nil || gotShare == nil {
+		t.Fatalf("GetFileByShareToken() after the round trip = %+v, %+v, %v", gotFile, gotShare, err)
+	}
+	if gotFile.ID != file.ID || gotFile.Size != 10 {
+		t.Errorf("file after the round trip = %d (%d bytes), want %d (10 bytes)", gotFile.ID, gotFile.Size, file.ID)
+	}
+	if err := s.SetShareCacheControl("kept", "no-store"); err != nil {
+		t.Errorf("SetShareCacheControl() after the round trip error = %v", err)
+	}
+}
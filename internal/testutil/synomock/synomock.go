@@ -0,0 +1,650 @@
+// Package synomock is a fake Synology DSM web API for tests. It serves the
+// parts the cache uses (login, API discovery, Synology Drive listings,
+// labels, sharing info and downloads with Range support) from an in-memory
+// file tree, and can inject errors to exercise retries and resumes without
+// real hardware.
+//
+//	nas := synomock.New()
+//	defer nas.Close()
+//	nas.AddFile(synomock.File{Path: "/mydrive/a.txt", Content: []byte("hello"), Starred: true})
+//	client := synology.NewClient(nas.URL, synomock.Username, synomock.Password, false)
+package synomock
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vertextoedge/synology-file-cache/pkg/synoclient"
+)
+
+// Credentials accepted by the fake NAS
+const (
+	Username = "admin"
+	Password = "secret"
+)
+
+// DefaultDSMVersion is reported by SYNO.DSM.Info unless DSMVersion is set
+const DefaultDSMVersion = "DSM 7.2.1-69057 Update 5"
+
+// errLoginFailed is the DSM error code for a wrong account or password
+const errLoginFailed = 400
+
+// apiInfoName is the API used to discover the other APIs
+const apiInfoName = "SYNO.API.Info"
+
+// apis lists the APIs the fake NAS implements with their highest version
+var apis = map[string]int{
+	"SYNO.API.Auth":                   3,
+	synoclient.APIDSMInfo:             2,
+	synoclient.APIDriveFiles:          2,
+	synoclient.APIDriveLabels:         1,
+	synoclient.APIDriveAdvanceSharing: 1,
+}
+
+// File is a file in the fake Drive
+type File struct {
+	ID      int64  // Assigned by AddFile when 0
+	Path    string // Display path, e.g. "/mydrive/docs/a.pdf"
+	Content []byte
+	ModTime time.Time // Defaults to the time the file was added
+	Owner   string
+
+	Starred bool
+	Labels  []string // IDs of labels added with AddLabel
+
+	// ShareToken is the permanent link of the file; files with one are listed as shared
+	ShareToken    string
+	SharePassword string
+}
+
+// Label is a Drive label
+type Label struct {
+	ID   string
+	Name string
+}
+
+// fault is an error injected into the next request for an API method
+type fault struct {
+	api, method string
+	code        int   // DSM error code, 0 when status is set
+	status      int   // HTTP status
+	truncate    int64 // Downloads only: bytes sent before the connection is dropped (-1 = none)
+}
+
+// Server is a fake Synology NAS listening on a local port
+type Server struct {
+	URL string
+
+	// DSMVersion is the version_string of SYNO.DSM.Info. Set it before the first request.
+	DSMVersion string
+
+	srv *httptest.Server
+
+	mu       sync.Mutex
+	nextID   int64
+	files    map[string]*File // By path
+	dirIDs   map[string]int64 // IDs of the folders implied by file paths
+	labels   []Label
+	sessions map[string]bool
+	faults   []fault
+	requests map[string]int     // By "api.method"
+	ranges   map[string][]int64 // Download start offsets by path, -1 without a Range header
+}
+
+// New starts a fake NAS with no files. Close it when done.
+func New() *Server {
+	s := &Server{
+		DSMVersion: DefaultDSMVersion,
+		nextID:     1000,
+		files:      make(map[string]*File),
+		dirIDs:     make(map[string]int64),
+		sessions:   make(map[string]bool),
+		requests:   make(map[string]int),
+		ranges:     make(map[string][]int64),
+	}
+	s.srv = httptest.NewServer(s)
+	s.URL = s.srv.URL
+	return s
+}
+
+// Close shuts the fake NAS down
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// AddFile adds or replaces a file and returns its ID
+func (s *Server) AddFile(f File) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if f.ID == 0 {
+		s.nextID++
+		f.ID = s.nextID
+	}
+	if f.ModTime.IsZero() {
+		f.ModTime = time.Now()
+	}
+	if f.Owner == "" {
+		f.Owner = Username
+	}
+	f.Content = append([]byte(nil), f.Content...)
+	s.files[f.Path] = &f
+	return f.ID
+}
+
+// SetContent replaces the content of a file and moves its modification time
+// forward, as an edit on the NAS would. Returns false if the file does not exist.
+func (s *Server) SetContent(filePath string, content []byte) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, ok := s.files[filePath]
+	if !ok {
+		return false
+	}
+	f.Content = append([]byte(nil), content...)
+	// Drive reports whole seconds, so the new time must differ by at least one
+	f.ModTime = maxTime(time.Now(), f.ModTime.Add(time.Second))
+	return true
+}
+
+// RemoveFile deletes a file; it disappears from listings and downloads fail
+// with "no such file or directory"
+func (s *Server) RemoveFile(filePath string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.files, filePath)
+}
+
+// AddLabel adds a label files can refer to by ID
+func (s *Server) AddLabel(id, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.labels = append(s.labels, Label{ID: id, Name: name})
+}
+
+// FailNext makes the next request for api and method answer with the DSM
+// error code, e.g. synoclient.ErrSystemBusy. Faults queue up in order.
+func (s *Server) FailNext(api, method string, code int) {
+	s.addFault(fault{api: api, method: method, code: code, truncate: -1})
+}
+
+// FailNextStatus makes the next request for api and method answer with the HTTP status
+func (s *Server) FailNextStatus(api, method string, status int) {
+	s.addFault(fault{api: api, method: method, status: status, truncate: -1})
+}
+
+// TruncateNextDownload makes the next download drop the connection after n
+// bytes of the body, like a NAS that went away mid-transfer
+func (s *Server) TruncateNextDownload(n int64) {
+	s.addFault(fault{api: synoclient.APIDriveFiles, method: "download", truncate: n})
+}
+
+// ExpireSessions invalidates every session, so the next call fails with
+// "sid not found" until the client logs in again
+func (s *Server) ExpireSessions() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clear(s.sessions)
+}
+
+// Requests returns how many requests for api and method were received
+func (s *Server) Requests(api, method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[api+"."+method]
+}
+
+// DownloadRanges returns the start offsets of the downloads of a file in the
+// order they were received; -1 is a download without a Range header
+func (s *Server) DownloadRanges(filePath string) []int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]int64(nil), s.ranges[filePath]...)
+}
+
+func (s *Server) addFault(f fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, f)
+}
+
+// takeFault removes and returns the first fault queued for api and method; s.mu must be held
+func (s *Server) takeFault(api, method string) (fault, bool) {
+	for i, f := range s.faults {
+		if f.api == api && f.method == method {
+			s.faults = append(s.faults[:i], s.faults[i+1:]...)
+			return f, true
+		}
+	}
+	return fault{truncate: -1}, false
+}
+
+// ServeHTTP dispatches a web API request on its api parameter; the CGI path is not checked
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	api, method := q.Get("api"), q.Get("method")
+
+	s.mu.Lock()
+	s.requests[api+"."+method]++
+	f, faulted := s.takeFault(api, method)
+	valid := s.sessions[q.Get("_sid")]
+	s.mu.Unlock()
+
+	if faulted && f.truncate < 0 {
+		if f.status != 0 {
+			w.WriteHeader(f.status)
+			return
+		}
+		writeError(w, f.code)
+		return
+	}
+
+	switch api {
+	case apiInfoName:
+		s.serveAPIInfo(w, q)
+		return
+	case "SYNO.API.Auth":
+		s.serveAuth(w, q)
+		return
+	}
+	if _, ok := apis[api]; !ok {
+		writeError(w, synoclient.ErrAPINotExists)
+		return
+	}
+	if !valid {
+		writeError(w, synoclient.ErrSIDNotFound)
+		return
+	}
+
+	switch api {
+	case synoclient.APIDSMInfo:
+		if method != "getinfo" {
+			writeError(w, synoclient.ErrMethodNotExists)
+			return
+		}
+		writeData(w, map[string]string{"model": "DS920+", "version_string": s.DSMVersion})
+	case synoclient.APIDriveFiles:
+		s.serveDriveFiles(w, r, q, f.truncate)
+	case synoclient.APIDriveLabels:
+		s.serveLabels(w, method)
+	case synoclient.APIDriveAdvanceSharing:
+		s.serveAdvanceSharing(w, q)
+	}
+}
+
+// serveAPIInfo answers SYNO.API.Info queries for all or the listed APIs
+func (s *Server) serveAPIInfo(w http.ResponseWriter, q url.Values) {
+	wanted := make(map[string]bool)
+	if query := q.Get("query"); query != "all" {
+		for _, name := range strings.Split(query, ",") {
+			wanted[name] = true
+		}
+	}
+
+	data := make(map[string]synoclient.APIEndpoint)
+	for name, version := range apis {
+		if len(wanted) > 0 && !wanted[name] {
+			continue
+		}
+		cgi := "entry.cgi"
+		if name == "SYNO.API.Auth" {
+			cgi = "auth.cgi"
+		}
+		data[name] = synoclient.APIEndpoint{Path: cgi, MinVersion: 1, MaxVersion: version}
+	}
+	writeData(w, data)
+}
+
+// serveAuth handles login and logout
+func (s *Server) serveAuth(w http.ResponseWriter, q url.Values) {
+	switch q.Get("method") {
+	case "login":
+		if q.Get("account") != Username || q.Get("passwd") != Password {
+			writeError(w, errLoginFailed)
+			return
+		}
+		s.mu.Lock()
+		s.nextID++
+		sid := fmt.Sprintf("sid-%d", s.nextID)
+		s.sessions[sid] = true
+		s.mu.Unlock()
+		writeData(w, map[string]string{"sid": sid})
+	case "logout":
+		s.mu.Lock()
+		delete(s.sessions, q.Get("_sid"))
+		s.mu.Unlock()
+		fmt.Fprint(w, `{"success":true}`)
+	default:
+		writeError(w, synoclient.ErrMethodNotExists)
+	}
+}
+
+// serveDriveFiles handles the SYNO.SynologyDrive.Files methods
+func (s *Server) serveDriveFiles(w http.ResponseWriter, r *http.Request, q url.Values, truncate int64) {
+	switch method := q.Get("method"); method {
+	case "list_starred":
+		s.serveList(w, q, func(f *File) bool { return f.Starred })
+	case "shared_with_others":
+		s.serveList(w, q, func(f *File) bool { return f.ShareToken != "" })
+	case "list_labelled":
+		labelID := unquote(q.Get("label_id"))
+		s.serveList(w, q, func(f *File) bool { return slices.Contains(f.Labels, labelID) })
+	case "recent":
+		s.serveRecent(w, q)
+	case "list":
+		s.serveFolder(w, q)
+	case "get":
+		s.serveGet(w, q)
+	case "download":
+		s.serveDownload(w, r, q, truncate)
+	default:
+		writeError(w, synoclient.ErrMethodNotExists)
+	}
+}
+
+// serveList answers a listing of the files matching keep, ordered by path
+func (s *Server) serveList(w http.ResponseWriter, q url.Values, keep func(*File) bool) {
+	s.mu.Lock()
+	var items []synoclient.DriveFile
+	for _, f := range s.sortedFiles() {
+		if keep(f) {
+			items = append(items, s.driveFile(f))
+		}
+	}
+	s.mu.Unlock()
+	writeList(w, q, items)
+}
+
+// serveRecent lists all files, most recently modified first
+func (s *Server) serveRecent(w http.ResponseWriter, q url.Values) {
+	s.mu.Lock()
+	files := s.sortedFiles()
+	sort.SliceStable(files, func(i, j int) bool { return files[i].ModTime.After(files[j].ModTime) })
+	items := make([]synoclient.DriveFile, 0, len(files))
+	for _, f := range files {
+		items = append(items, s.driveFile(f))
+	}
+	s.mu.Unlock()
+	writeList(w, q, items)
+}
+
+// serveFolder lists the direct children of a folder, including the folders
+// implied by the paths of files further down
+func (s *Server) serveFolder(w http.ResponseWriter, q url.Values) {
+	dir := strings.TrimSuffix(unquote(q.Get("path")), "/")
+	if dir == "" {
+		writeError(w, synoclient.ErrInvalidParam)
+		return
+	}
+
+	s.mu.Lock()
+	var items []synoclient.DriveFile
+	seenDirs := make(map[string]bool)
+	for _, f := range s.sortedFiles() {
+		rest, ok := strings.CutPrefix(f.Path, dir+"/")
+		if !ok {
+			continue
+		}
+		if name, _, nested := strings.Cut(rest, "/"); nested {
+			if !seenDirs[name] {
+				seenDirs[name] = true
+				items = append(items, s.driveDir(dir+"/"+name))
+			}
+			continue
+		}
+		items = append(items, s.driveFile(f))
+	}
+	s.mu.Unlock()
+	writeList(w, q, items)
+}
+
+// serveGet answers the metadata of a file or folder by path
+func (s *Server) serveGet(w http.ResponseWriter, q url.Values) {
+	filePath := unquote(q.Get("path"))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f, ok := s.files[filePath]; ok {
+		writeData(w, s.driveFile(f))
+		return
+	}
+	for p := range s.files {
+		if strings.HasPrefix(p, filePath+"/") {
+			writeData(w, s.driveDir(filePath))
+			return
+		}
+	}
+	writeError(w, synoclient.ErrFileNotFound)
+}
+
+// serveDownload sends the content of one file by path or ID. Only open-ended
+// ranges ("bytes=N-") are supported, which is all the client sends.
+func (s *Server) serveDownload(w http.ResponseWriter, r *http.Request, q url.Values, truncate int64) {
+	var targets []string
+	if err := json.Unmarshal([]byte(q.Get("files")), &targets); err != nil || len(targets) != 1 {
+		writeError(w, synoclient.ErrInvalidParam)
+		return
+	}
+
+	s.mu.Lock()
+	f := s.lookup(targets[0])
+	var content []byte
+	var name string
+	if f != nil {
+		content, name = f.Content, path.Base(f.Path)
+	}
+	s.mu.Unlock()
+	if f == nil {
+		writeError(w, synoclient.ErrFileNotFound)
+		return
+	}
+
+	start := int64(-1)
+	if rng := r.Header.Get("Range"); rng != "" {
+		var err error
+		start, err = strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(rng, "bytes="), "-"), 10, 64)
+		if err != nil || start < 0 {
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+	}
+
+	s.mu.Lock()
+	s.ranges[f.Path] = append(s.ranges[f.Path], start)
+	s.mu.Unlock()
+
+	size := int64(len(content))
+	if start > size {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+		w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+
+	// A JSON Content-Type would be taken for an error response
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, name))
+	body := content
+	status := http.StatusOK
+	if start >= 0 {
+		body = content[start:]
+		status = http.StatusPartialContent
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, size-1, size))
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(status)
+
+	if truncate >= 0 && truncate < int64(len(body)) {
+		w.Write(body[:truncate])
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+		panic(http.ErrAbortHandler) // Drops the connection without logging
+	}
+	w.Write(body)
+}
+
+// serveLabels lists the labels
+func (s *Server) serveLabels(w http.ResponseWriter, method string) {
+	if method != "list" {
+		writeError(w, synoclient.ErrMethodNotExists)
+		return
+	}
+
+	s.mu.Lock()
+	items := make([]synoclient.DriveLabel, 0, len(s.labels))
+	for _, l := range s.labels {
+		items = append(items, synoclient.DriveLabel{ID: l.ID, Name: l.Name})
+	}
+	s.mu.Unlock()
+	writeData(w, map[string]any{"items": items, "total": len(items)})
+}
+
+// serveAdvanceSharing answers the sharing link of a shared file
+func (s *Server) serveAdvanceSharing(w http.ResponseWriter, q url.Values) {
+	if q.Get("method") != "get" {
+		writeError(w, synoclient.ErrMethodNotExists)
+		return
+	}
+
+	s.mu.Lock()
+	f := s.lookup(unquote(q.Get("path")))
+	var info synoclient.AdvanceSharingInfo
+	if f != nil && f.ShareToken != "" {
+		info = synoclient.AdvanceSharingInfo{
+			SharingLink:     f.ShareToken,
+			URL:             s.URL + "/d/s/" + f.ShareToken,
+			ProtectPassword: f.SharePassword,
+		}
+	}
+	s.mu.Unlock()
+	if info.SharingLink == "" {
+		writeError(w, synoclient.ErrFileNotFound)
+		return
+	}
+	writeData(w, info)
+}
+
+// lookup finds a file by path, "id:<id>" or a bare ID; s.mu must be held
+func (s *Server) lookup(ref string) *File {
+	if strings.HasPrefix(ref, "/") {
+		return s.files[ref]
+	}
+	id, err := strconv.ParseInt(strings.TrimPrefix(ref, "id:"), 10, 64)
+	if err != nil {
+		return nil
+	}
+	for _, f := range s.files {
+		if f.ID == id {
+			return f
+		}
+	}
+	return nil
+}
+
+// sortedFiles returns the files ordered by path; s.mu must be held
+func (s *Server) sortedFiles() []*File {
+	files := make([]*File, 0, len(s.files))
+	for _, f := range s.files {
+		files = append(files, f)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files
+}
+
+// driveFile converts f to its API representation; s.mu must be held
+func (s *Server) driveFile(f *File) synoclient.DriveFile {
+	df := synoclient.DriveFile{
+		ID:            json.Number(strconv.FormatInt(f.ID, 10)),
+		Name:          path.Base(f.Path),
+		Path:          f.Path,
+		ContentType:   "file",
+		Size:          int64(len(f.Content)),
+		MTime:         f.ModTime.Unix(),
+		ATime:         f.ModTime.Unix(),
+		Starred:       f.Starred,
+		Shared:        f.ShareToken != "",
+		PermanentLink: f.ShareToken,
+		Owner:         synoclient.DriveOwner{UID: 1026, Name: f.Owner, DisplayName: f.Owner},
+	}
+	for _, id := range f.Labels {
+		for _, l := range s.labels {
+			if l.ID == id {
+				df.Labels = append(df.Labels, synoclient.DriveLabel{ID: l.ID, Name: l.Name})
+			}
+		}
+	}
+	return df
+}
+
+// driveDir returns the API representation of a folder; s.mu must be held
+func (s *Server) driveDir(dirPath string) synoclient.DriveFile {
+	id, ok := s.dirIDs[dirPath]
+	if !ok {
+		s.nextID++
+		id = s.nextID
+		s.dirIDs[dirPath] = id
+	}
+	return synoclient.DriveFile{
+		ID:          json.Number(strconv.FormatInt(id, 10)),
+		Name:        path.Base(dirPath),
+		Path:        dirPath,
+		ContentType: "dir",
+		Owner:       synoclient.DriveOwner{UID: 1026, Name: Username, DisplayName: Username},
+	}
+}
+
+// writeList writes the page of items selected by the offset and limit parameters
+func writeList(w http.ResponseWriter, q url.Values, items []synoclient.DriveFile) {
+	offset, _ := strconv.Atoi(q.Get("offset"))
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	total := len(items)
+
+	offset = min(max(offset, 0), total)
+	end := total
+	if limit > 0 {
+		end = min(offset+limit, total)
+	}
+	page := items[offset:end]
+	if page == nil {
+		page = []synoclient.DriveFile{}
+	}
+	writeData(w, synoclient.DriveListResponse{Offset: offset, Total: total, Items: page})
+}
+
+// writeData writes a successful response carrying data
+func writeData(w http.ResponseWriter, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"success": true, "data": data})
+}
+
+// writeError writes a failed response with a DSM error code
+func writeError(w http.ResponseWriter, code int) {
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"success":false,"error":{"code":%d}}`, code)
+}
+
+// unquote strips the JSON quotes the client puts around some parameters
+func unquote(v string) string {
+	if s, err := strconv.Unquote(v); err == nil && strings.HasPrefix(v, `"`) {
+		return s
+	}
+	return v
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
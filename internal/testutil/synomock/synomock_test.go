@@ -0,0 +1,144 @@
+package synomock
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/vertextoedge/synology-file-cache/pkg/synoclient"
+)
+
+func newClient(t *testing.T) (*synoclient.Client, *Server) {
+	t.Helper()
+	nas := New()
+	t.Cleanup(nas.Close)
+	c := synoclient.New(nas.URL, Username, Password, nil)
+	if err := c.Login(context.Background()); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	return c, nas
+}
+
+func TestServer_Login(t *testing.T) {
+	nas := New()
+	defer nas.Close()
+
+	c := synoclient.New(nas.URL, Username, "wrong", nil)
+	var apiErr *synoclient.APIError
+	if err := c.Login(context.Background()); !errors.As(err, &apiErr) || apiErr.Code != errLoginFailed {
+		t.Fatalf("Login with a wrong password error = %v", err)
+	}
+
+	c = synoclient.New(nas.URL, Username, Password, nil)
+	if err := c.Login(context.Background()); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if caps := c.Capabilities(); caps.DSMMajor != 7 || caps.DriveVersion != 2 {
+		t.Errorf("Capabilities = %+v", caps)
+	}
+}
+
+func TestServer_Listings(t *testing.T) {
+	c, nas := newClient(t)
+	ctx := context.Background()
+	nas.AddLabel("1", "Important")
+	nas.AddFile(File{Path: "/mydrive/a.txt", Content: []byte("a"), Starred: true})
+	nas.AddFile(File{Path: "/mydrive/docs/b.txt", Content: []byte("bb"), Labels: []string{"1"}})
+	nas.AddFile(File{Path: "/mydrive/docs/c.txt", Content: []byte("ccc"), ShareToken: "tok"})
+
+	starred, err := c.GetStarredFiles(ctx, 0, 100)
+	if err != nil || starred.Total != 1 || starred.Items[0].Path != "/mydrive/a.txt" {
+		t.Fatalf("GetStarredFiles = %+v, %v", starred, err)
+	}
+	labeled, err := c.GetLabeledFiles(ctx, "1", 0, 100)
+	if err != nil || labeled.Total != 1 || labeled.Items[0].LabelNames()[0] != "Important" {
+		t.Fatalf("GetLabeledFiles = %+v, %v", labeled, err)
+	}
+	shared, err := c.GetSharedFiles(ctx, 0, 100)
+	if err != nil || shared.Total != 1 || shared.Items[0].PermanentLink != "tok" {
+		t.Fatalf("GetSharedFiles = %+v, %v", shared, err)
+	}
+
+	// Folders implied by file paths are listed, and pages follow offset and limit
+	root, err := c.ListFiles(ctx, &synoclient.DriveListOptions{Path: "/mydrive", Limit: 1})
+	if err != nil || root.Total != 2 || len(root.Items) != 1 || root.Items[0].Name != "a.txt" {
+		t.Fatalf("ListFiles page 1 = %+v, %v", root, err)
+	}
+	root, err = c.ListFiles(ctx, &synoclient.DriveListOptions{Path: "/mydrive", Offset: 1, Limit: 1})
+	if err != nil || len(root.Items) != 1 || !root.Items[0].IsDir() || root.Items[0].Path != "/mydrive/docs" {
+		t.Fatalf("ListFiles page 2 = %+v, %v", root, err)
+	}
+
+	info, err := c.GetAdvanceSharing(ctx, shared.Items[0].GetID(), "")
+	if err != nil || info.URL != nas.URL+"/d/s/tok" {
+		t.Errorf("GetAdvanceSharing = %+v, %v", info, err)
+	}
+}
+
+func TestServer_Download(t *testing.T) {
+	c, nas := newClient(t)
+	ctx := context.Background()
+	nas.AddFile(File{Path: "/mydrive/a.bin", Content: []byte("0123456789")})
+
+	body, name, size, err := c.DownloadFileWithRange(ctx, 0, "/mydrive/a.bin", 4)
+	if err != nil {
+		t.Fatalf("DownloadFileWithRange: %v", err)
+	}
+	data, _ := io.ReadAll(body)
+	body.Close()
+	if string(data) != "456789" || name != "a.bin" || size != 6 {
+		t.Errorf("range download = %q, %q, %d", data, name, size)
+	}
+
+	// A dropped connection ends the body early
+	nas.TruncateNextDownload(3)
+	body, _, _, err = c.DownloadFile(ctx, 0, "/mydrive/a.bin")
+	if err != nil {
+		t.Fatalf("DownloadFile: %v", err)
+	}
+	data, err = io.ReadAll(body)
+	body.Close()
+	if err == nil || string(data) != "012" {
+		t.Errorf("truncated download = %q, %v", data, err)
+	}
+
+	if got := nas.DownloadRanges("/mydrive/a.bin"); len(got) != 2 || got[0] != 4 || got[1] != -1 {
+		t.Errorf("DownloadRanges = %v", got)
+	}
+
+	var apiErr *synoclient.APIError
+	if _, _, _, err := c.DownloadFile(ctx, 0, "/mydrive/missing"); !errors.As(err, &apiErr) || !apiErr.IsNotFound() {
+		t.Errorf("download of a missing file error = %v", err)
+	}
+}
+
+func TestServer_Faults(t *testing.T) {
+	c, nas := newClient(t)
+	ctx := context.Background()
+
+	nas.FailNext(synoclient.APIDriveFiles, "list_starred", synoclient.ErrSystemBusy)
+	var apiErr *synoclient.APIError
+	if _, err := c.GetStarredFiles(ctx, 0, 100); !errors.As(err, &apiErr) || !apiErr.IsTemporary() {
+		t.Fatalf("injected error = %v", err)
+	}
+	if _, err := c.GetStarredFiles(ctx, 0, 100); err != nil {
+		t.Fatalf("call after the injected error: %v", err)
+	}
+
+	nas.FailNextStatus(synoclient.APIDriveFiles, "list_starred", 502)
+	var httpErr *synoclient.HTTPError
+	if _, err := c.GetStarredFiles(ctx, 0, 100); !errors.As(err, &httpErr) || httpErr.StatusCode != 502 {
+		t.Fatalf("injected status = %v", err)
+	}
+
+	// The client logs in again when its session expired
+	logins := nas.Requests("SYNO.API.Auth", "login")
+	nas.ExpireSessions()
+	if _, err := c.GetStarredFiles(ctx, 0, 100); err != nil {
+		t.Fatalf("call after session expiry: %v", err)
+	}
+	if got := nas.Requests("SYNO.API.Auth", "login"); got != logins+1 {
+		t.Errorf("logins = %d, want %d", got, logins+1)
+	}
+}
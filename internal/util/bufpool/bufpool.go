@@ -0,0 +1,58 @@
+// Package bufpool recycles large copy buffers, so moving multi-gigabyte
+// files does not allocate a fresh buffer for every transfer.
+package bufpool
+
+import (
+	"io"
+	"sync"
+)
+
+// DefaultSize is the buffer size used when a pool is created with size <= 0
+const DefaultSize = 256 * 1024
+
+// Pool hands out byte buffers of one size
+type Pool struct {
+	size int
+	pool sync.Pool
+}
+
+// New creates a pool of size-byte buffers
+func New(size int) *Pool {
+	if size <= 0 {
+		size = DefaultSize
+	}
+	p := &Pool{size: size}
+	p.pool.New = func() interface{} {
+		buf := make([]byte, size)
+		return &buf
+	}
+	return p
+}
+
+// Size returns the size of the pooled buffers
+func (p *Pool) Size() int {
+	return p.size
+}
+
+// Get returns a buffer from the pool
+func (p *Pool) Get() *[]byte {
+	return p.pool.Get().(*[]byte)
+}
+
+// Put returns a buffer obtained from Get to the pool
+func (p *Pool) Put(buf *[]byte) {
+	p.pool.Put(buf)
+}
+
+// Copy copies src to dst through a pooled buffer. As with io.CopyBuffer the
+// buffer is not used when src implements io.WriterTo or dst implements
+// io.ReaderFrom, which keeps zero-copy paths such as sendfile. A nil pool
+// copies with io.Copy.
+func (p *Pool) Copy(dst io.Writer, src io.Reader) (int64, error) {
+	if p == nil {
+		return io.Copy(dst, src)
+	}
+	buf := p.Get()
+	defer p.Put(buf)
+	return io.CopyBuffer(dst, src, *buf)
+}
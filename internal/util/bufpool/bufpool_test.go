@@ -0,0 +1,37 @@
+package bufpool
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestNew_DefaultSize(t *testing.T) {
+	if got := New(0).Size(); got != DefaultSize {
+		t.Errorf("Size() = %d, want %d", got, DefaultSize)
+	}
+
+	p := New(1024)
+	buf := p.Get()
+	if len(*buf) != 1024 {
+		t.Errorf("len(Get()) = %d, want 1024", len(*buf))
+	}
+	p.Put(buf)
+}
+
+func TestPool_Copy(t *testing.T) {
+	src := strings.Repeat("synology", 1000)
+
+	for _, p := range []*Pool{New(16), nil} {
+		var dst bytes.Buffer
+		// Hide WriterTo/ReaderFrom so the pooled buffer is used
+		n, err := p.Copy(struct{ io.Writer }{&dst}, struct{ io.Reader }{strings.NewReader(src)})
+		if err != nil {
+			t.Fatalf("Copy() error = %v", err)
+		}
+		if n != int64(len(src)) || dst.String() != src {
+			t.Errorf("Copy() copied %d bytes, want %d", n, len(src))
+		}
+	}
+}
@@ -0,0 +1,106 @@
+// Package cachecontrol validates configured Cache-Control policies and sets
+// them on responses, keeping max-age within the lifetime of a share:
+//
+//	public, max-age=3600
+//	private, no-store
+package cachecontrol
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Validate checks that value is a comma-separated list of directives, each a
+// token optionally followed by =token or ="quoted string"
+func Validate(value string) error {
+	if strings.TrimSpace(value) == "" {
+		return fmt.Errorf("empty Cache-Control value")
+	}
+	for _, directive := range strings.Split(value, ",") {
+		name, arg, hasArg := strings.Cut(strings.TrimSpace(directive), "=")
+		if !isToken(name) {
+			return fmt.Errorf("invalid Cache-Control directive %q", strings.TrimSpace(directive))
+		}
+		if !hasArg {
+			continue
+		}
+		if len(arg) >= 2 && arg[0] == '"' && arg[len(arg)-1] == '"' {
+			arg = arg[1 : len(arg)-1]
+			if strings.ContainsAny(arg, "\"\\\r\n") {
+				return fmt.Errorf("invalid Cache-Control directive %q", strings.TrimSpace(directive))
+			}
+			continue
+		}
+		if !isToken(arg) {
+			return fmt.Errorf("invalid Cache-Control directive %q", strings.TrimSpace(directive))
+		}
+		if isAge(name) {
+			if _, err := strconv.ParseUint(arg, 10, 31); err != nil {
+				return fmt.Errorf("invalid Cache-Control directive %q: age must be a number of seconds", strings.TrimSpace(directive))
+			}
+		}
+	}
+	return nil
+}
+
+// Set sets Cache-Control on h to value, which must be valid. max-age and
+// s-maxage are lowered so caches drop the response by until when it is not
+// nil. Expires mirrors max-age for HTTP/1.0 caches. An empty value sets nothing.
+func Set(h http.Header, value string, now time.Time, until *time.Time) {
+	if value == "" {
+		return
+	}
+
+	directives := strings.Split(value, ",")
+	maxAge := -1
+	for i, directive := range directives {
+		directive = strings.TrimSpace(directive)
+		name, arg, _ := strings.Cut(directive, "=")
+		if !isAge(name) {
+			directives[i] = directive
+			continue
+		}
+		age, err := strconv.Atoi(arg)
+		if err != nil {
+			directives[i] = directive
+			continue
+		}
+		if until != nil {
+			age = min(age, max(int(until.Sub(now)/time.Second), 0))
+		}
+		directives[i] = strings.ToLower(name) + "=" + strconv.Itoa(age)
+		if strings.EqualFold(name, "max-age") {
+			maxAge = age
+		}
+	}
+
+	h.Set("Cache-Control", strings.Join(directives, ", "))
+	if maxAge >= 0 {
+		h.Set("Expires", now.Add(time.Duration(maxAge)*time.Second).UTC().Format(http.TimeFormat))
+	}
+}
+
+// isAge reports whether directive name takes a number of seconds that Set may lower
+func isAge(name string) bool {
+	return strings.EqualFold(name, "max-age") || strings.EqualFold(name, "s-maxage")
+}
+
+// isToken reports whether s is an RFC 9110 token
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= '0' && c <= '9', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
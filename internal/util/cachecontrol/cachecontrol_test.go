@@ -0,0 +1,76 @@
+package cachecontrol
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	valid := []string{
+		"public, max-age=3600",
+		"private, no-store",
+		"no-cache",
+		"public,max-age=60,s-maxage=600,immutable",
+		`no-cache="Set-Cookie"`,
+	}
+	for _, value := range valid {
+		if err := Validate(value); err != nil {
+			t.Errorf("Validate(%q) error = %v", value, err)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"public,,max-age=60",
+		"max-age=soon",
+		"max-age=-1",
+		"public; max-age=60",
+		"no-store\r\nSet-Cookie: x=1",
+	}
+	for _, value := range invalid {
+		if err := Validate(value); err == nil {
+			t.Errorf("Validate(%q) accepted an invalid value", value)
+		}
+	}
+}
+
+func TestSet(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	h := http.Header{}
+	Set(h, "public,max-age=3600", now, nil)
+	if got := h.Get("Cache-Control"); got != "public, max-age=3600" {
+		t.Errorf("Cache-Control = %q", got)
+	}
+	if got := h.Get("Expires"); got != "Wed, 01 May 2024 13:00:00 GMT" {
+		t.Errorf("Expires = %q", got)
+	}
+
+	// Ages are capped at the share expiry
+	until := now.Add(10 * time.Minute)
+	h = http.Header{}
+	Set(h, "public, Max-Age=3600, s-maxage=60", now, &until)
+	if got := h.Get("Cache-Control"); got != "public, max-age=600, s-maxage=60" {
+		t.Errorf("Cache-Control = %q", got)
+	}
+
+	past := now.Add(-time.Minute)
+	h = http.Header{}
+	Set(h, "max-age=3600", now, &past)
+	if got := h.Get("Cache-Control"); got != "max-age=0" {
+		t.Errorf("Cache-Control = %q for an expired share", got)
+	}
+
+	h = http.Header{}
+	Set(h, "private, no-store", now, &until)
+	if got := h.Get("Cache-Control"); got != "private, no-store" || h.Get("Expires") != "" {
+		t.Errorf("Cache-Control = %q, Expires = %q", got, h.Get("Expires"))
+	}
+
+	h = http.Header{}
+	Set(h, "", now, nil)
+	if len(h) != 0 {
+		t.Errorf("empty policy set headers %v", h)
+	}
+}
@@ -0,0 +1,73 @@
+// Package compress decides which content is worth compressing and which
+// encodings a client accepts.
+package compress
+
+import (
+	"mime"
+	"strconv"
+	"strings"
+)
+
+// Gzip is the gzip content coding
+const Gzip = "gzip"
+
+// compressibleTypes are non-text media types that compress well
+var compressibleTypes = map[string]bool{
+	"application/json":              true,
+	"application/javascript":        true,
+	"application/xml":               true,
+	"application/xhtml+xml":         true,
+	"application/rss+xml":           true,
+	"application/atom+xml":          true,
+	"application/x-javascript":      true,
+	"application/x-yaml":            true,
+	"application/yaml":              true,
+	"application/x-sh":              true,
+	"application/sql":               true,
+	"application/rtf":               true,
+	"application/wasm":              true,
+	"application/vnd.apple.mpegurl": true,
+	"image/svg+xml":                 true,
+}
+
+// IsCompressible reports whether content of the given Content-Type benefits
+// from compression. Already compressed media (images, video, archives,
+// office documents) is excluded.
+func IsCompressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	if strings.HasPrefix(mediaType, "text/") {
+		return true
+	}
+	if strings.HasSuffix(mediaType, "+json") || strings.HasSuffix(mediaType, "+xml") {
+		return true
+	}
+	return compressibleTypes[mediaType]
+}
+
+// Accepts reports whether an Accept-Encoding header value allows coding.
+// An explicit entry for coding takes precedence over "*"; q=0 refuses.
+func Accepts(acceptEncoding, coding string) bool {
+	wildcard := false
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.TrimSpace(name)
+
+		allowed := true
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				allowed = false
+			}
+		}
+
+		switch {
+		case strings.EqualFold(name, coding):
+			return allowed
+		case name == "*":
+			wildcard = allowed
+		}
+	}
+	return wildcard
+}
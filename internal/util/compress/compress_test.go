@@ -0,0 +1,48 @@
+package compress
+
+import "testing"
+
+func TestIsCompressible(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        bool
+	}{
+		{"text/html; charset=utf-8", true},
+		{"text/plain", true},
+		{"application/json", true},
+		{"application/ld+json", true},
+		{"image/svg+xml", true},
+		{"image/jpeg", false},
+		{"video/mp4", false},
+		{"application/zip", false},
+		{"application/octet-stream", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsCompressible(tt.contentType); got != tt.want {
+			t.Errorf("IsCompressible(%q) = %v, want %v", tt.contentType, got, tt.want)
+		}
+	}
+}
+
+func TestAccepts(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"gzip, deflate, br", true},
+		{"deflate, GZIP;q=0.5", true},
+		{"br", false},
+		{"", false},
+		{"gzip;q=0", false},
+		{"*", true},
+		{"*, gzip;q=0", false},
+	}
+
+	for _, tt := range tests {
+		if got := Accepts(tt.header, Gzip); got != tt.want {
+			t.Errorf("Accepts(%q, gzip) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+// Package cryptfile stores files encrypted with AES-256-GCM in independently
+// authenticated chunks, so they can be written as a stream and read at any
+// offset without decrypting what comes before.
+//
+// A file is a header followed by chunks:
+//
+//	header: magic "SFCENC01" (8) | key ID (8) | nonce prefix (7) | reserved (1)
+//	chunk:  ciphertext of up to ChunkSize plain bytes | GCM tag (16)
+//
+// The nonce of chunk i is the file's random nonce prefix, i as a 4 byte
+// big-endian counter and a byte set to 1 for the last chunk only, so chunks
+// can't be reordered and a file cut at a chunk boundary fails to decrypt. The
+// header is authenticated with every chunk. An empty file has one empty chunk.
+package cryptfile
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ChunkSize is the number of plain bytes encrypted per chunk
+const ChunkSize = 64 * 1024
+
+// KeySize is the size of an AES-256 key in bytes
+const KeySize = 32
+
+const (
+	magic       = "SFCENC01"
+	keyIDSize   = 8
+	prefixSize  = 7
+	headerSize  = len(magic) + keyIDSize + prefixSize + 1
+	tagSize     = 16
+	sealedChunk = ChunkSize + tagSize
+)
+
+var (
+	// ErrUnknownKey is returned for files encrypted with a key not in the keyring
+	ErrUnknownKey = errors.New("file is encrypted with an unknown key")
+
+	// ErrCorrupt is returned for files that fail authentication or are truncated
+	ErrCorrupt = errors.New("encrypted file is corrupt or was tampered with")
+)
+
+// Key is an AES-256 key with the ID stored in the header of files it encrypts
+type Key struct {
+	id   [keyIDSize]byte
+	aead cipher.AEAD
+}
+
+// NewKey creates a Key from 32 raw bytes
+func NewKey(raw []byte) (*Key, error) {
+	if len(raw) != KeySize {
+		return nil, fmt.Errorf("encryption key must be %d bytes, got %d", KeySize, len(raw))
+	}
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	k := &Key{aead: aead}
+	sum := sha256.Sum256(append([]byte("synology-file-cache key id\x00"), raw...))
+	copy(k.id[:], sum[:])
+	return k, nil
+}
+
+// ParseKey creates a Key from its hex (64 digits) or base64 encoding
+func ParseKey(s string) (*Key, error) {
+	s = strings.TrimSpace(s)
+	if raw, err := hex.DecodeString(s); err == nil && len(raw) == KeySize {
+		return NewKey(raw)
+	}
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if raw, err := enc.DecodeString(s); err == nil && len(raw) == KeySize {
+			return NewKey(raw)
+		}
+	}
+	return nil, fmt.Errorf("encryption key must be %d bytes as 64 hex digits or base64", KeySize)
+}
+
+// LoadKeyFile reads a key from a file holding either the 32 raw bytes or
+// their hex or base64 encoding
+func LoadKeyFile(path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	if len(data) == KeySize {
+		return NewKey(data)
+	}
+	k, err := ParseKey(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid key file %s: %w", path, err)
+	}
+	return k, nil
+}
+
+// ID returns the hex key ID written to the header of files the key encrypts
+func (k *Key) ID() string {
+	return hex.EncodeToString(k.id[:])
+}
+
+// Keyring holds the key new files are encrypted with and older keys files
+// may still be encrypted with
+type Keyring struct {
+	current *Key
+	keys    map[[keyIDSize]byte]*Key
+}
+
+// NewKeyring creates a Keyring encrypting with current and decrypting with
+// current and old
+func NewKeyring(current *Key, old ...*Key) *Keyring {
+	kr := &Keyring{
+		current: current,
+		keys:    map[[keyIDSize]byte]*Key{current.id: current},
+	}
+	for _, k := range old {
+		if _, ok := kr.keys[k.id]; !ok {
+			kr.keys[k.id] = k
+		}
+	}
+	return kr
+}
+
+// Current returns the key new files are encrypted with
+func (kr *Keyring) Current() *Key {
+	return kr.current
+}
+
+// lookup returns the key with a header's key ID
+func (kr *Keyring) lookup(id []byte) (*Key, bool) {
+	var kid [keyIDSize]byte
+	copy(kid[:], id)
+	k, ok := kr.keys[kid]
+	return k, ok
+}
+
+// nonce returns the nonce of chunk index of a file
+func nonce(prefix []byte, index uint32, last bool) []byte {
+	n := make([]byte, prefixSize+5)
+	copy(n, prefix)
+	n[prefixSize] = byte(index >> 24)
+	n[prefixSize+1] = byte(index >> 16)
+	n[prefixSize+2] = byte(index >> 8)
+	n[prefixSize+3] = byte(index)
+	if last {
+		n[prefixSize+4] = 1
+	}
+	return n
+}
+
+// PlainSize returns the plain size of an encrypted file of size bytes
+func PlainSize(size int64) (int64, error) {
+	body := size - int64(headerSize)
+	if body < tagSize {
+		return 0, ErrCorrupt
+	}
+	chunks := (body + sealedChunk - 1) / sealedChunk
+	if body-(chunks-1)*sealedChunk < tagSize {
+		return 0, ErrCorrupt
+	}
+	return body - chunks*tagSize, nil
+}
@@ -0,0 +1,225 @@
+package cryptfile
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testKey(t *testing.T) *Key {
+	t.Helper()
+	raw := make([]byte, KeySize)
+	if _, err := rand.Read(raw); err != nil {
+		t.Fatalf("rand.Read() error = %v", err)
+	}
+	k, err := NewKey(raw)
+	if err != nil {
+		t.Fatalf("NewKey() error = %v", err)
+	}
+	return k
+}
+
+// writeEncrypted encrypts content with key into a new file
+func writeEncrypted(t *testing.T, key *Key, content []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "file")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	defer f.Close()
+
+	w, err := NewWriter(f, key)
+	if err != nil {
+		t.Fatalf("NewWriter() error = %v", err)
+	}
+	// Odd write sizes so chunks are filled across writes
+	for len(content) > 0 {
+		n := min(len(content), 10007)
+		if _, err := w.Write(content[:n]); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+		content = content[n:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	return path
+}
+
+func randomContent(t *testing.T, n int) []byte {
+	t.Helper()
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatalf("rand.Read() error = %v", err)
+	}
+	return b
+}
+
+func TestRoundTrip(t *testing.T) {
+	key := testKey(t)
+	keys := NewKeyring(key)
+
+	for _, size := range []int{0, 1, ChunkSize - 1, ChunkSize, ChunkSize + 1, 3*ChunkSize + 123} {
+		content := randomContent(t, size)
+		path := writeEncrypted(t, key, content)
+
+		f, err := Open(path, keys)
+		if err != nil {
+			t.Fatalf("Open(%d) error = %v", size, err)
+		}
+		if !f.Encrypted() || f.KeyID() != key.ID() {
+			t.Errorf("size %d: Encrypted() = %v, KeyID() = %s", size, f.Encrypted(), f.KeyID())
+		}
+		if f.Size() != int64(size) {
+			t.Errorf("Size() = %d, want %d", f.Size(), size)
+		}
+		got, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("ReadAll(%d) error = %v", size, err)
+		}
+		if !bytes.Equal(got, content) {
+			t.Errorf("size %d: content mismatch", size)
+		}
+	}
+}
+
+func TestFile_RandomAccess(t *testing.T) {
+	key := testKey(t)
+	content := randomContent(t, 3*ChunkSize+500)
+	f, err := Open(writeEncrypted(t, key, content), NewKeyring(key))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer f.Close()
+
+	// Spanning a chunk boundary
+	buf := make([]byte, 1000)
+	off := int64(2*ChunkSize - 300)
+	if n, err := f.ReadAt(buf, off); err != nil || n != len(buf) {
+		t.Fatalf("ReadAt() = %d, %v", n, err)
+	}
+	if !bytes.Equal(buf, content[off:off+1000]) {
+		t.Error("ReadAt() content mismatch")
+	}
+
+	// Past the end
+	n, err := f.ReadAt(buf, int64(len(content))-10)
+	if n != 10 || !errors.Is(err, io.EOF) {
+		t.Errorf("ReadAt(end) = %d, %v, want 10, EOF", n, err)
+	}
+
+	if _, err := f.Seek(-100, io.SeekEnd); err != nil {
+		t.Fatalf("Seek() error = %v", err)
+	}
+	tail, err := io.ReadAll(f)
+	if err != nil || !bytes.Equal(tail, content[len(content)-100:]) {
+		t.Errorf("read after Seek() = %d bytes, %v", len(tail), err)
+	}
+}
+
+func TestOpen_Tampered(t *testing.T) {
+	key := testKey(t)
+	content := randomContent(t, 2*ChunkSize+10)
+
+	tests := []struct {
+		name   string
+		modify func(data []byte) []byte
+	}{
+		{"flipped bit", func(data []byte) []byte {
+			data[headerSize+ChunkSize+5] ^= 1
+			return data
+		}},
+		{"cut at chunk boundary", func(data []byte) []byte {
+			return data[:headerSize+2*sealedChunk]
+		}},
+		{"swapped chunks", func(data []byte) []byte {
+			first := append([]byte(nil), data[headerSize:headerSize+sealedChunk]...)
+			copy(data[headerSize:], data[headerSize+sealedChunk:headerSize+2*sealedChunk])
+			copy(data[headerSize+sealedChunk:], first)
+			return data
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeEncrypted(t, key, content)
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("ReadFile() error = %v", err)
+			}
+			if err := os.WriteFile(path, tt.modify(data), 0644); err != nil {
+				t.Fatalf("WriteFile() error = %v", err)
+			}
+
+			f, err := Open(path, NewKeyring(key))
+			if err != nil {
+				t.Fatalf("Open() error = %v", err)
+			}
+			defer f.Close()
+			if _, err := io.ReadAll(f); !errors.Is(err, ErrCorrupt) {
+				t.Errorf("ReadAll() error = %v, want ErrCorrupt", err)
+			}
+		})
+	}
+}
+
+func TestOpen_Keys(t *testing.T) {
+	oldKey, newKey := testKey(t), testKey(t)
+	content := []byte("hello")
+	path := writeEncrypted(t, oldKey, content)
+
+	if _, err := Open(path, NewKeyring(newKey)); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Open(other key) error = %v, want ErrUnknownKey", err)
+	}
+
+	// Old keys still decrypt
+	f, err := Open(path, NewKeyring(newKey, oldKey))
+	if err != nil {
+		t.Fatalf("Open(old key) error = %v", err)
+	}
+	got, _ := io.ReadAll(f)
+	f.Close()
+	if !bytes.Equal(got, content) || f.KeyID() != oldKey.ID() {
+		t.Errorf("read %q with key %s", got, f.KeyID())
+	}
+
+	// Files stored in plain are passed through
+	plain := filepath.Join(t.TempDir(), "plain")
+	os.WriteFile(plain, []byte("plain content here, longer than a header"), 0644)
+	f, err = Open(plain, NewKeyring(newKey))
+	if err != nil {
+		t.Fatalf("Open(plain) error = %v", err)
+	}
+	defer f.Close()
+	if f.Encrypted() || f.OSFile() == nil {
+		t.Error("plain file opened as encrypted")
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	raw := bytes.Repeat([]byte{0xab}, KeySize)
+	hexKey := strings.Repeat("ab", KeySize)
+
+	a, err := ParseKey(hexKey)
+	if err != nil {
+		t.Fatalf("ParseKey(hex) error = %v", err)
+	}
+	b, err := ParseKey("q6urq6urq6urq6urq6urq6urq6urq6urq6urq6urq6s=\n")
+	if err != nil {
+		t.Fatalf("ParseKey(base64) error = %v", err)
+	}
+	c, _ := NewKey(raw)
+	if a.ID() != c.ID() || b.ID() != c.ID() {
+		t.Errorf("key IDs differ: %s %s %s", a.ID(), b.ID(), c.ID())
+	}
+
+	if _, err := ParseKey("abcd"); err == nil {
+		t.Error("ParseKey(short) error = nil")
+	}
+}
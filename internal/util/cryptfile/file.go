@@ -0,0 +1,232 @@
+package cryptfile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// File is an open file read as its plain content, whether it is encrypted or
+// not. It is not safe for concurrent use.
+type File struct {
+	f       *os.File
+	size    int64 // plain size
+	modTime time.Time
+
+	// Encrypted files only
+	key      *Key
+	header   []byte
+	diskSize int64
+	chunks   int64
+
+	pos   int64
+	index int64 // chunk held in plain, -1 for none
+	plain []byte
+	buf   []byte
+}
+
+// Open opens the file at path. Files starting with the header of an
+// encrypted file are decrypted with the key from keys their header names;
+// other files, and all files when keys is nil, are read as stored.
+func Open(path string, keys *Keyring) (*File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	cf := &File{f: f, size: info.Size(), modTime: info.ModTime(), index: -1}
+	if keys == nil || info.Size() < int64(headerSize) {
+		return cf, nil
+	}
+
+	header := make([]byte, headerSize)
+	if _, err := f.ReadAt(header, 0); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	if !bytes.Equal(header[:len(magic)], []byte(magic)) {
+		return cf, nil
+	}
+
+	key, ok := keys.lookup(header[len(magic) : len(magic)+keyIDSize])
+	if !ok {
+		f.Close()
+		return nil, ErrUnknownKey
+	}
+	plainSize, err := PlainSize(info.Size())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	cf.key = key
+	cf.header = header
+	cf.diskSize = info.Size()
+	cf.size = plainSize
+	cf.chunks = (info.Size() - int64(headerSize) + sealedChunk - 1) / sealedChunk
+	return cf, nil
+}
+
+// Size returns the plain size of the file
+func (cf *File) Size() int64 {
+	return cf.size
+}
+
+// ModTime returns the modification time of the file on disk
+func (cf *File) ModTime() time.Time {
+	return cf.modTime
+}
+
+// Encrypted reports whether the file is encrypted on disk
+func (cf *File) Encrypted() bool {
+	return cf.key != nil
+}
+
+// KeyID returns the ID of the key an encrypted file was encrypted with, and
+// "" for files stored in plain
+func (cf *File) KeyID() string {
+	if cf.key == nil {
+		return ""
+	}
+	return cf.key.ID()
+}
+
+// OSFile returns the underlying file of a file stored in plain, so callers
+// can hand it to the kernel (sendfile), and nil for encrypted files
+func (cf *File) OSFile() *os.File {
+	if cf.key != nil {
+		return nil
+	}
+	return cf.f
+}
+
+// Close closes the file
+func (cf *File) Close() error {
+	return cf.f.Close()
+}
+
+// Read reads plain content from the current offset
+func (cf *File) Read(p []byte) (int, error) {
+	if cf.key == nil {
+		return cf.f.Read(p)
+	}
+	n, err := cf.ReadAt(p, cf.pos)
+	cf.pos += int64(n)
+	if n > 0 && errors.Is(err, io.EOF) {
+		err = nil
+	}
+	return n, err
+}
+
+// Seek sets the offset in the plain content for the next Read
+func (cf *File) Seek(offset int64, whence int) (int64, error) {
+	if cf.key == nil {
+		return cf.f.Seek(offset, whence)
+	}
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += cf.pos
+	case io.SeekEnd:
+		offset += cf.size
+	default:
+		return 0, errors.New("cryptfile: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("cryptfile: negative position")
+	}
+	cf.pos = offset
+	return offset, nil
+}
+
+// ReadAt reads plain content at off, decrypting only the chunks it covers
+func (cf *File) ReadAt(p []byte, off int64) (int, error) {
+	if cf.key == nil {
+		return cf.f.ReadAt(p, off)
+	}
+	if off < 0 {
+		return 0, errors.New("cryptfile: negative offset")
+	}
+
+	n := 0
+	for n < len(p) {
+		if off >= cf.size {
+			return n, io.EOF
+		}
+		plain, err := cf.chunk(off / ChunkSize)
+		if err != nil {
+			return n, err
+		}
+		copied := copy(p[n:], plain[off%ChunkSize:])
+		n += copied
+		off += int64(copied)
+	}
+	return n, nil
+}
+
+// chunk returns the plain content of chunk index
+func (cf *File) chunk(index int64) ([]byte, error) {
+	if index == cf.index {
+		return cf.plain, nil
+	}
+
+	start := int64(headerSize) + index*sealedChunk
+	length := min(int64(sealedChunk), cf.diskSize-start)
+	if cap(cf.buf) < sealedChunk {
+		cf.buf = make([]byte, sealedChunk)
+	}
+	sealed := cf.buf[:length]
+	if _, err := cf.f.ReadAt(sealed, start); err != nil {
+		return nil, fmt.Errorf("failed to read chunk: %w", err)
+	}
+
+	prefix := cf.header[len(magic)+keyIDSize : headerSize-1]
+	last := index == cf.chunks-1
+	plain, err := cf.key.aead.Open(cf.plain[:0], nonce(prefix, uint32(index), last), sealed, cf.header)
+	if err != nil {
+		cf.index = -1
+		return nil, ErrCorrupt
+	}
+	cf.plain = plain
+	cf.index = index
+	return plain, nil
+}
+
+// PlainPath returns a path holding the plain content of the file at path,
+// for tools that read files themselves such as ffmpeg: path itself for files
+// stored in plain, else a decrypted temporary copy in dir. The returned
+// cleanup removes the copy.
+func PlainPath(path string, keys *Keyring, dir string) (string, func(), error) {
+	src, err := Open(path, keys)
+	if err != nil {
+		return "", nil, err
+	}
+	defer src.Close()
+	if !src.Encrypted() {
+		return path, func() {}, nil
+	}
+
+	tmp, err := os.CreateTemp(dir, ".plain-*")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { os.Remove(tmp.Name()) }
+	_, err = io.Copy(tmp, src)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return tmp.Name(), cleanup, nil
+}
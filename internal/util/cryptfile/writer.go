@@ -0,0 +1,98 @@
+package cryptfile
+
+import (
+	"crypto/rand"
+	"errors"
+	"io"
+	"math"
+)
+
+// Writer encrypts a stream written to it. A full chunk is held back until
+// more data arrives, so Close can seal the last chunk with the last flag.
+type Writer struct {
+	w      io.Writer
+	key    *Key
+	header []byte
+	buf    []byte
+	sealed []byte
+	index  uint32
+	err    error
+	closed bool
+}
+
+// NewWriter writes the header of a file encrypted with key to w and returns
+// a Writer for its content. Close must be called to write the last chunk; it
+// does not close w.
+func NewWriter(w io.Writer, key *Key) (*Writer, error) {
+	header := make([]byte, headerSize)
+	copy(header, magic)
+	copy(header[len(magic):], key.id[:])
+	if _, err := rand.Read(header[len(magic)+keyIDSize : headerSize-1]); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	return &Writer{
+		w:      w,
+		key:    key,
+		header: header,
+		buf:    make([]byte, 0, ChunkSize),
+		sealed: make([]byte, 0, sealedChunk),
+	}, nil
+}
+
+// Write encrypts p
+func (cw *Writer) Write(p []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+	if cw.closed {
+		return 0, errors.New("cryptfile: write after close")
+	}
+
+	written := 0
+	for len(p) > 0 {
+		if len(cw.buf) == ChunkSize {
+			if err := cw.flush(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(cw.buf[len(cw.buf):ChunkSize], p)
+		cw.buf = cw.buf[:len(cw.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+// Close writes the last chunk
+func (cw *Writer) Close() error {
+	if cw.closed {
+		return cw.err
+	}
+	cw.closed = true
+	if cw.err != nil {
+		return cw.err
+	}
+	return cw.flush(true)
+}
+
+// flush seals the buffered chunk and writes it
+func (cw *Writer) flush(last bool) error {
+	if cw.index == math.MaxUint32 && !last {
+		cw.err = errors.New("cryptfile: file too large")
+		return cw.err
+	}
+
+	prefix := cw.header[len(magic)+keyIDSize : headerSize-1]
+	cw.sealed = cw.key.aead.Seal(cw.sealed[:0], nonce(prefix, cw.index, last), cw.buf, cw.header)
+	if _, err := cw.w.Write(cw.sealed); err != nil {
+		cw.err = err
+		return err
+	}
+	cw.buf = cw.buf[:0]
+	cw.index++
+	return nil
+}
@@ -0,0 +1,93 @@
+// Package disposition builds Content-Disposition headers that survive
+// non-ASCII filenames.
+//
+// Headers carry an ASCII filename parameter for old clients and an RFC 5987
+// filename* parameter with the exact UTF-8 name:
+//
+//	attachment; filename="report_2024.pdf"; filename*=UTF-8''%EB%B3%B4%EA%B3%A0%EC%84%9C_2024.pdf
+package disposition
+
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	// Inline asks the browser to display the file
+	Inline = "inline"
+
+	// Attachment asks the browser to save the file
+	Attachment = "attachment"
+)
+
+// Format returns a Content-Disposition header value for filename
+func Format(dispositionType, filename string) string {
+	if filename == "" {
+		return dispositionType
+	}
+
+	fallback := asciiFallback(filename)
+	if fallback == filename {
+		return dispositionType + `; filename="` + filename + `"`
+	}
+	return dispositionType + `; filename="` + fallback + `"; filename*=UTF-8''` + encodeExtValue(filename)
+}
+
+// Sanitize reduces a client supplied filename to a safe base name.
+// Returns "" if nothing usable remains.
+func Sanitize(name string) string {
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	if name == "." || name == ".." {
+		return ""
+	}
+	return name
+}
+
+// asciiFallback replaces characters that cannot appear in a quoted ASCII
+// filename parameter with underscores
+func asciiFallback(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' || r == '%' {
+			b.WriteByte('_')
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// encodeExtValue percent-encodes every byte that is not an RFC 5987 attr-char
+func encodeExtValue(s string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if isAttrChar(c) {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hex[c>>4])
+		b.WriteByte(hex[c&0x0f])
+	}
+	return b.String()
+}
+
+// isAttrChar reports whether c is an RFC 5987 attr-char
+func isAttrChar(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	}
+	return strings.IndexByte("!#$&+-.^_`|~", c) >= 0
+}
@@ -0,0 +1,58 @@
+package disposition
+
+import (
+	"mime"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		dispositionType string
+		filename        string
+		want            string
+	}{
+		{Inline, "report.pdf", `inline; filename="report.pdf"`},
+		{Attachment, "my report.pdf", `attachment; filename="my report.pdf"`},
+		{Attachment, "보고서 2024.pdf", `attachment; filename="___ 2024.pdf"; filename*=UTF-8''%EB%B3%B4%EA%B3%A0%EC%84%9C%202024.pdf`},
+		{Inline, `say "hi".txt`, `inline; filename="say _hi_.txt"; filename*=UTF-8''say%20%22hi%22.txt`},
+		{Inline, "", "inline"},
+	}
+
+	for _, tt := range tests {
+		if got := Format(tt.dispositionType, tt.filename); got != tt.want {
+			t.Errorf("Format(%q, %q) = %s, want %s", tt.dispositionType, tt.filename, got, tt.want)
+		}
+	}
+}
+
+func TestFormat_RoundTrip(t *testing.T) {
+	for _, name := range []string{"ファイル.txt", "naïve résumé.docx", "100% done.txt"} {
+		_, params, err := mime.ParseMediaType(Format(Attachment, name))
+		if err != nil {
+			t.Fatalf("ParseMediaType(%q) error = %v", name, err)
+		}
+		if params["filename"] != name {
+			t.Errorf("decoded filename = %q, want %q", params["filename"], name)
+		}
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"report.pdf", "report.pdf"},
+		{"../../etc/passwd", "passwd"},
+		{`C:\Users\a\file.txt`, "file.txt"},
+		{"line\r\nbreak.txt", "linebreak.txt"},
+		{"..", ""},
+		{"  ", ""},
+	}
+
+	for _, tt := range tests {
+		if got := Sanitize(tt.name); got != tt.want {
+			t.Errorf("Sanitize(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
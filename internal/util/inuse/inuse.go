@@ -0,0 +1,63 @@
+// Package inuse counts the readers open on cached copies, so the evictor can
+// leave a copy alone while a client is still downloading it.
+package inuse
+
+import (
+	"path/filepath"
+	"sync"
+)
+
+// Tracker counts open readers per cache path. A nil Tracker tracks nothing.
+type Tracker struct {
+	mu   sync.Mutex
+	open map[string]int
+}
+
+// New creates an empty Tracker
+func New() *Tracker {
+	return &Tracker{open: make(map[string]int)}
+}
+
+// Acquire records a reader of the copy at cachePath until release is
+// called. Calling release more than once has no further effect.
+func (t *Tracker) Acquire(cachePath string) (release func()) {
+	if t == nil {
+		return func() {}
+	}
+	key := filepath.Clean(cachePath)
+
+	t.mu.Lock()
+	t.open[key]++
+	t.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if t.open[key]--; t.open[key] <= 0 {
+				delete(t.open, key)
+			}
+		})
+	}
+}
+
+// InUse reports whether a reader of the copy at cachePath is open
+func (t *Tracker) InUse(cachePath string) bool {
+	if t == nil {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.open[filepath.Clean(cachePath)] > 0
+}
+
+// Count returns the number of copies with open readers
+func (t *Tracker) Count() int {
+	if t == nil {
+		return 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.open)
+}
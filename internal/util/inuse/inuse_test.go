@@ -0,0 +1,32 @@
+package inuse
+
+import "testing"
+
+func TestTracker_AcquireRelease(t *testing.T) {
+	tr := New()
+	release1 := tr.Acquire("/cache/a.txt")
+	release2 := tr.Acquire("/cache/./a.txt")
+
+	if !tr.InUse("/cache/a.txt") || tr.InUse("/cache/b.txt") {
+		t.Fatal("InUse does not follow the acquired paths")
+	}
+
+	release1()
+	release1() // Releasing twice must not drop the other reader
+	if !tr.InUse("/cache/a.txt") {
+		t.Fatal("copy released while a reader is still open")
+	}
+
+	release2()
+	if tr.InUse("/cache/a.txt") || tr.Count() != 0 {
+		t.Errorf("copy still in use after all readers were released, count %d", tr.Count())
+	}
+}
+
+func TestTracker_Nil(t *testing.T) {
+	var tr *Tracker
+	tr.Acquire("/cache/a.txt")()
+	if tr.InUse("/cache/a.txt") || tr.Count() != 0 {
+		t.Error("nil Tracker reported a reader")
+	}
+}
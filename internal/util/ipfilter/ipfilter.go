@@ -0,0 +1,132 @@
+// Package ipfilter matches client addresses against lists of networks.
+//
+// Entries are CIDR prefixes or single addresses:
+//
+//	10.0.0.0/8, 192.168.1.5, fd00::/8
+//
+// IPv4-mapped IPv6 addresses (::ffff:10.0.0.1) match IPv4 entries.
+package ipfilter
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// List is a set of networks. The zero value and nil are empty lists.
+type List struct {
+	prefixes []netip.Prefix
+}
+
+// Parse parses CIDR prefixes and single addresses. Blank entries are skipped.
+func Parse(entries []string) (*List, error) {
+	l := &List{}
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if strings.Contains(entry, "/") {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid network %q: %w", entry, err)
+			}
+			l.prefixes = append(l.prefixes, prefix.Masked())
+			continue
+		}
+
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address %q: %w", entry, err)
+		}
+		addr = addr.Unmap()
+		l.prefixes = append(l.prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return l, nil
+}
+
+// UnixPeers is the proxy list entry that stands for peers connected over a
+// Unix domain socket, which have no address to match
+const UnixPeers = "unix"
+
+// ParseProxies is Parse for a list of trusted proxies, which may also hold
+// the UnixPeers entry
+func ParseProxies(entries []string) (list *List, unix bool, err error) {
+	rest := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if strings.EqualFold(strings.TrimSpace(entry), UnixPeers) {
+			unix = true
+			continue
+		}
+		rest = append(rest, entry)
+	}
+	list, err = Parse(rest)
+	return list, unix, err
+}
+
+// Empty reports whether the list has no entries
+func (l *List) Empty() bool {
+	return l == nil || len(l.prefixes) == 0
+}
+
+// Contains reports whether addr is in one of the networks
+func (l *List) Contains(addr netip.Addr) bool {
+	if l == nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range l.prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ContainsString is Contains for an address in text form; invalid addresses are not contained
+func (l *List) ContainsString(s string) bool {
+	addr, err := netip.ParseAddr(s)
+	return err == nil && l.Contains(addr)
+}
+
+// Rules combine an allowlist and a denylist
+type Rules struct {
+	Allow *List // When not empty, only these networks are allowed
+	Deny  *List // Always refused, even if also allowed
+}
+
+// ParseRules parses an allowlist and a denylist
+func ParseRules(allow, deny []string) (Rules, error) {
+	allowList, err := Parse(allow)
+	if err != nil {
+		return Rules{}, err
+	}
+	denyList, err := Parse(deny)
+	if err != nil {
+		return Rules{}, err
+	}
+	return Rules{Allow: allowList, Deny: denyList}, nil
+}
+
+// Empty reports whether the rules allow every address
+func (r Rules) Empty() bool {
+	return r.Allow.Empty() && r.Deny.Empty()
+}
+
+// Allows reports whether the rules permit the address in text form.
+// Invalid addresses are refused unless the rules are empty.
+func (r Rules) Allows(s string) bool {
+	if r.Empty() {
+		return true
+	}
+
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return false
+	}
+	if r.Deny.Contains(addr) {
+		return false
+	}
+	return r.Allow.Empty() || r.Allow.Contains(addr)
+}
@@ -0,0 +1,95 @@
+package ipfilter
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	l, err := Parse([]string{"10.0.0.0/8", " 192.168.1.5 ", "", "fd00::/8", "172.16.5.9/12"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	tests := map[string]bool{
+		"10.1.2.3":        true,
+		"::ffff:10.1.2.3": true,
+		"192.168.1.5":     true,
+		"192.168.1.6":     false,
+		"fd12::1":         true,
+		"fe80::1":         false,
+		"172.31.255.255":  true,
+		"172.32.0.1":      false,
+		"not-an-address":  false,
+		"":                false,
+	}
+	for addr, want := range tests {
+		if got := l.ContainsString(addr); got != want {
+			t.Errorf("ContainsString(%q) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, entry := range []string{"10.0.0.0/33", "10.0.0", "example.com"} {
+		if _, err := Parse([]string{entry}); err == nil {
+			t.Errorf("Parse(%q) should fail", entry)
+		}
+	}
+}
+
+func TestRulesAllows(t *testing.T) {
+	allow, _ := Parse([]string{"10.0.0.0/8"})
+	deny, _ := Parse([]string{"10.0.0.66"})
+
+	tests := []struct {
+		name  string
+		rules Rules
+		addr  string
+		want  bool
+	}{
+		{"empty rules allow everything", Rules{}, "203.0.113.1", true},
+		{"empty rules allow invalid addresses", Rules{}, "unknown", true},
+		{"allowlisted", Rules{Allow: allow}, "10.2.3.4", true},
+		{"not allowlisted", Rules{Allow: allow}, "203.0.113.1", false},
+		{"denied wins over allowed", Rules{Allow: allow, Deny: deny}, "10.0.0.66", false},
+		{"denylist only", Rules{Deny: deny}, "203.0.113.1", true},
+		{"invalid address with rules", Rules{Deny: deny}, "unknown", false},
+	}
+	for _, tt := range tests {
+		if got := tt.rules.Allows(tt.addr); got != tt.want {
+			t.Errorf("%s: Allows(%q) = %v, want %v", tt.name, tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules([]string{"10.0.0.0/8"}, []string{"10.0.0.66"})
+	if err != nil {
+		t.Fatalf("ParseRules() error = %v", err)
+	}
+	if !rules.Allows("10.0.0.1") || rules.Allows("10.0.0.66") || rules.Allows("192.0.2.1") {
+		t.Errorf("ParseRules() rules = %+v do not match the lists", rules)
+	}
+
+	if _, err := ParseRules(nil, []string{"bogus"}); err == nil {
+		t.Error("ParseRules() should fail on an invalid denylist entry")
+	}
+}
+
+func TestParseProxies(t *testing.T) {
+	l, unix, err := ParseProxies([]string{"10.0.0.0/8", " Unix "})
+	if err != nil {
+		t.Fatalf("ParseProxies() error = %v", err)
+	}
+	if !unix {
+		t.Error("unix entry not recognised")
+	}
+	if !l.ContainsString("10.1.2.3") {
+		t.Error("network entry lost")
+	}
+
+	if _, unix, _ := ParseProxies([]string{"10.0.0.0/8"}); unix {
+		t.Error("unix reported without the entry")
+	}
+	if _, _, err := ParseProxies([]string{"unix", "example.com"}); err == nil {
+		t.Error("invalid entry accepted next to unix")
+	}
+}
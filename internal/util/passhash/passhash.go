@@ -0,0 +1,157 @@
+// Package passhash hashes and verifies passwords with salted argon2id.
+//
+// Encoded hashes have the form:
+//
+//	argon2id$v=19$m=<memory KiB>,t=<passes>,p=<threads>$<base64 salt>$<base64 key>
+//
+// Hashes of the earlier PBKDF2-HMAC-SHA256 scheme,
+//
+//	pbkdf2-sha256$<iterations>$<base64 salt>$<base64 key>
+//
+// still verify; NeedsRehash reports them (and argon2id hashes with weaker
+// parameters) so callers holding the plaintext can store a new hash.
+package passhash
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	// Prefix identifies an encoded hash of the current scheme
+	Prefix = "argon2id$"
+
+	// legacyPrefix identifies an encoded PBKDF2 hash
+	legacyPrefix = "pbkdf2-sha256$"
+
+	saltSize = 16
+	keySize  = 32
+)
+
+// Params are the argon2id cost parameters
+type Params struct {
+	Memory  uint32 // KiB
+	Time    uint32 // Passes over the memory
+	Threads uint8
+}
+
+// DefaultParams keep verification around tens of milliseconds, since share
+// and admin passwords are checked on the request path (OWASP's minimum
+// recommendation for argon2id)
+var DefaultParams = Params{Memory: 19 * 1024, Time: 2, Threads: 1}
+
+// Hash returns an encoded salted hash of password
+func Hash(password string) (string, error) {
+	return hashWithParams(password, DefaultParams)
+}
+
+// hashWithParams hashes password with explicit argon2id parameters
+func hashWithParams(password string, p Params) (string, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	key := argon2.IDKey([]byte(password), salt, p.Time, p.Memory, p.Threads, keySize)
+
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", Prefix, argon2.Version, p.Memory, p.Time, p.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify reports whether password matches the encoded hash.
+// Values that are not encoded hashes never match.
+func Verify(encoded, password string) bool {
+	switch {
+	case strings.HasPrefix(encoded, Prefix):
+		p, salt, want, ok := parseArgon2(encoded)
+		if !ok {
+			return false
+		}
+		got := argon2.IDKey([]byte(password), salt, p.Time, p.Memory, p.Threads, uint32(len(want)))
+		return subtle.ConstantTimeCompare(got, want) == 1
+	case strings.HasPrefix(encoded, legacyPrefix):
+		return verifyPBKDF2(encoded, password)
+	default:
+		return false
+	}
+}
+
+// NeedsRehash reports whether encoded is a hash of the legacy scheme or has
+// weaker parameters than DefaultParams. Values that are not hashes never do.
+func NeedsRehash(encoded string) bool {
+	switch {
+	case strings.HasPrefix(encoded, Prefix):
+		p, _, _, ok := parseArgon2(encoded)
+		return ok && (p.Memory < DefaultParams.Memory || p.Time < DefaultParams.Time)
+	case strings.HasPrefix(encoded, legacyPrefix):
+		return true
+	default:
+		return false
+	}
+}
+
+// IsHashed reports whether s looks like an encoded hash from this package
+func IsHashed(s string) bool {
+	return strings.HasPrefix(s, Prefix) || strings.HasPrefix(s, legacyPrefix)
+}
+
+// parseArgon2 splits an encoded argon2id hash
+func parseArgon2(encoded string) (p Params, salt, key []byte, ok bool) {
+	parts := strings.Split(strings.TrimPrefix(encoded, Prefix), "$")
+	if len(parts) != 4 || parts[0] != "v="+strconv.Itoa(argon2.Version) {
+		return p, nil, nil, false
+	}
+
+	var memory, passes uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[1], "m=%d,t=%d,p=%d", &memory, &passes, &threads); err != nil ||
+		memory == 0 || passes == 0 || threads == 0 {
+		return p, nil, nil, false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return p, nil, nil, false
+	}
+	key, err = base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil || len(key) == 0 {
+		return p, nil, nil, false
+	}
+	return Params{Memory: memory, Time: passes, Threads: threads}, salt, key, true
+}
+
+// verifyPBKDF2 checks password against an encoded legacy PBKDF2 hash
+func verifyPBKDF2(encoded, password string) bool {
+	parts := strings.Split(strings.TrimPrefix(encoded, legacyPrefix), "$")
+	if len(parts) != 3 {
+		return false
+	}
+
+	iterations, err := strconv.Atoi(parts[0])
+	if err != nil || iterations <= 0 {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return false
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil || len(want) == 0 {
+		return false
+	}
+
+	got, err := pbkdf2.Key(sha256.New, password, salt, iterations, len(want))
+	if err != nil {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare(got, want) == 1
+}
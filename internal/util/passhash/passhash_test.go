@@ -0,0 +1,109 @@
+package passhash
+
+import (
+	"crypto/pbkdf2"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// testParams keep the tests fast
+var testParams = Params{Memory: 64, Time: 1, Threads: 1}
+
+func TestHashVerify(t *testing.T) {
+	encoded, err := hashWithParams("secret123", testParams)
+	if err != nil {
+		t.Fatalf("hash failed: %v", err)
+	}
+
+	if !strings.HasPrefix(encoded, "argon2id$v=19$m=64,t=1,p=1$") {
+		t.Errorf("encoded = %q, want an argon2id hash", encoded)
+	}
+	if !IsHashed(encoded) {
+		t.Errorf("IsHashed(%q) = false, want true", encoded)
+	}
+	if !Verify(encoded, "secret123") {
+		t.Error("Verify() with correct password = false, want true")
+	}
+	if Verify(encoded, "wrong") {
+		t.Error("Verify() with wrong password = true, want false")
+	}
+}
+
+func TestHash_UniqueSalt(t *testing.T) {
+	a, _ := hashWithParams("same", testParams)
+	b, _ := hashWithParams("same", testParams)
+	if a == b {
+		t.Error("expected different encodings for the same password")
+	}
+}
+
+// legacyHash encodes a PBKDF2 hash as earlier versions stored them
+func legacyHash(password string, iterations int) string {
+	salt := []byte("0123456789abcdef")
+	key, _ := pbkdf2.Key(sha256.New, password, salt, iterations, keySize)
+	return fmt.Sprintf("pbkdf2-sha256$%d$%s$%s", iterations,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key))
+}
+
+func TestVerify_LegacyPBKDF2(t *testing.T) {
+	encoded := legacyHash("secret123", 1000)
+
+	if !IsHashed(encoded) {
+		t.Errorf("IsHashed(%q) = false, want true", encoded)
+	}
+	if !Verify(encoded, "secret123") {
+		t.Error("Verify() of a legacy hash with correct password = false, want true")
+	}
+	if Verify(encoded, "wrong") {
+		t.Error("Verify() of a legacy hash with wrong password = true, want false")
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	current, _ := Hash("secret123")
+	weak, _ := hashWithParams("secret123", testParams)
+
+	tests := []struct {
+		name    string
+		encoded string
+		want    bool
+	}{
+		{"current", current, false},
+		{"weaker parameters", weak, true},
+		{"legacy PBKDF2", legacyHash("secret123", 1000), true},
+		{"plaintext", "secret123", false},
+		{"empty", "", false},
+	}
+	for _, tt := range tests {
+		if got := NeedsRehash(tt.encoded); got != tt.want {
+			t.Errorf("%s: NeedsRehash() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestVerify_RejectsMalformed(t *testing.T) {
+	tests := []string{
+		"",
+		"secret123",
+		"pbkdf2-sha256$",
+		"pbkdf2-sha256$abc$c2FsdA$a2V5",
+		"pbkdf2-sha256$1000$!!!$a2V5",
+		"pbkdf2-sha256$1000$c2FsdA$",
+		"argon2id$",
+		"argon2id$v=18$m=64,t=1,p=1$c2FsdA$a2V5",
+		"argon2id$v=19$m=0,t=1,p=1$c2FsdA$a2V5",
+		"argon2id$v=19$m=64,t=1$c2FsdA$a2V5",
+		"argon2id$v=19$m=64,t=1,p=1$!!!$a2V5",
+		"argon2id$v=19$m=64,t=1,p=1$c2FsdA$",
+	}
+
+	for _, encoded := range tests {
+		if Verify(encoded, "secret123") {
+			t.Errorf("Verify(%q) = true, want false", encoded)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package ratelimiter
+
+import (
+	"sync"
+	"time"
+)
+
+// bucket holds the token bucket state for a single key
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// KeyedLimiter is a token bucket rate limiter keyed by an arbitrary string
+// (client IP, share token, ...). It is safe for concurrent use.
+type KeyedLimiter struct {
+	mu          sync.Mutex
+	rate        float64 // tokens added per second
+	burst       float64 // bucket capacity
+	buckets     map[string]*bucket
+	idleTTL     time.Duration // a bucket idle this long is full and can be dropped
+	lastCleanup time.Time
+}
+
+// NewKeyed creates a keyed token bucket limiter allowing rate events per second
+// with bursts of up to burst events per key.
+func NewKeyed(rate float64, burst int) *KeyedLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	idleTTL := time.Minute
+	if rate > 0 {
+		if fill := time.Duration(float64(burst) / rate * float64(time.Second)); fill > idleTTL {
+			idleTTL = fill
+		}
+	}
+	return &KeyedLimiter{
+		rate:        rate,
+		burst:       float64(burst),
+		buckets:     make(map[string]*bucket),
+		idleTTL:     idleTTL,
+		lastCleanup: time.Now(),
+	}
+}
+
+// Allow consumes one token for key.
+// Returns true if allowed, or false with the duration until a token is available.
+func (l *KeyedLimiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastCleanup) >= l.idleTTL {
+		l.cleanup(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	} else {
+		b.tokens += now.Sub(b.last).Seconds() * l.rate
+		if b.tokens > l.burst {
+			b.tokens = l.burst
+		}
+		b.last = now
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	if l.rate <= 0 {
+		return false, l.idleTTL
+	}
+	wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+// Len returns the number of tracked keys
+func (l *KeyedLimiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
+
+// cleanup drops buckets that have been idle long enough to be full. Caller holds mu.
+func (l *KeyedLimiter) cleanup(now time.Time) {
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= l.idleTTL {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastCleanup = now
+}
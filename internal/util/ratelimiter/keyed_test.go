@@ -0,0 +1,89 @@
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestKeyedLimiter_Burst(t *testing.T) {
+	l := NewKeyed(1, 3)
+
+	for i := 0; i < 3; i++ {
+		if allowed, _ := l.Allow("a"); !allowed {
+			t.Fatalf("call %d: expected burst to be allowed", i)
+		}
+	}
+
+	allowed, wait := l.Allow("a")
+	if allowed {
+		t.Error("expected call beyond burst to be blocked")
+	}
+	if wait <= 0 || wait > time.Second {
+		t.Errorf("wait = %v, want in (0, 1s]", wait)
+	}
+
+	// Other keys have their own bucket
+	if allowed, _ := l.Allow("b"); !allowed {
+		t.Error("expected independent key to be allowed")
+	}
+}
+
+func TestKeyedLimiter_Refill(t *testing.T) {
+	l := NewKeyed(50, 1)
+
+	if allowed, _ := l.Allow("a"); !allowed {
+		t.Fatal("expected first call to be allowed")
+	}
+	if allowed, _ := l.Allow("a"); allowed {
+		t.Fatal("expected second call to be blocked")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+
+	if allowed, _ := l.Allow("a"); !allowed {
+		t.Error("expected call after refill to be allowed")
+	}
+}
+
+func TestLockout_Exponential(t *testing.T) {
+	l := NewLockout(3, time.Second, 5*time.Second)
+
+	for i := 0; i < 2; i++ {
+		if d := l.Failure("k"); d != 0 {
+			t.Fatalf("failure %d: lockout = %v, want 0", i+1, d)
+		}
+	}
+	if locked, _ := l.Locked("k"); locked {
+		t.Fatal("expected key to be unlocked below threshold")
+	}
+
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second}
+	for i, w := range want {
+		if d := l.Failure("k"); d != w {
+			t.Errorf("failure %d: lockout = %v, want %v", i+3, d, w)
+		}
+	}
+
+	locked, remaining := l.Locked("k")
+	if !locked || remaining <= 0 {
+		t.Errorf("Locked() = %v, %v; want locked with remaining time", locked, remaining)
+	}
+
+	if locked, _ := l.Locked("other"); locked {
+		t.Error("expected unrelated key to be unlocked")
+	}
+}
+
+func TestLockout_SuccessResets(t *testing.T) {
+	l := NewLockout(1, time.Minute, time.Hour)
+
+	l.Failure("k")
+	if locked, _ := l.Locked("k"); !locked {
+		t.Fatal("expected key to be locked")
+	}
+
+	l.Success("k")
+	if locked, _ := l.Locked("k"); locked {
+		t.Error("expected success to clear lockout")
+	}
+}
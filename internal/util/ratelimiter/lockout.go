@@ -0,0 +1,108 @@
+package ratelimiter
+
+import (
+	"sync"
+	"time"
+)
+
+// lockoutEntry tracks consecutive failures for a single key
+type lockoutEntry struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// Lockout applies exponential lockout after repeated failures for a key,
+// e.g. wrong share passwords. It is safe for concurrent use.
+type Lockout struct {
+	mu        sync.Mutex
+	threshold int           // failures allowed before locking
+	base      time.Duration // first lockout duration
+	max       time.Duration // lockout cap; failures are forgotten after this long
+	entries   map[string]*lockoutEntry
+}
+
+// NewLockout creates a lockout that locks a key for base after threshold
+// consecutive failures, doubling on every further failure up to max.
+func NewLockout(threshold int, base, max time.Duration) *Lockout {
+	if threshold < 1 {
+		threshold = 1
+	}
+	if max < base {
+		max = base
+	}
+	return &Lockout{
+		threshold: threshold,
+		base:      base,
+		max:       max,
+		entries:   make(map[string]*lockoutEntry),
+	}
+}
+
+// Locked returns true with the remaining duration if key is currently locked
+func (l *Lockout) Locked(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e, ok := l.entries[key]
+	if !ok {
+		return false, 0
+	}
+
+	remaining := time.Until(e.lockedUntil)
+	if remaining > 0 {
+		return true, remaining
+	}
+	return false, 0
+}
+
+// Failure records a failed attempt and returns the lockout duration now in effect (0 if none)
+func (l *Lockout) Failure(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if len(l.entries) > 10000 {
+		l.cleanup(now)
+	}
+
+	e, ok := l.entries[key]
+	if !ok || now.Sub(e.lastFailure) >= l.max {
+		e = &lockoutEntry{}
+		l.entries[key] = e
+	}
+
+	e.failures++
+	e.lastFailure = now
+
+	if e.failures < l.threshold {
+		return 0
+	}
+
+	d := l.base
+	for i := l.threshold; i < e.failures && d < l.max; i++ {
+		d *= 2
+	}
+	if d > l.max {
+		d = l.max
+	}
+
+	e.lockedUntil = now.Add(d)
+	return d
+}
+
+// Success clears the failure history for key
+func (l *Lockout) Success(key string) {
+	l.mu.Lock()
+	delete(l.entries, key)
+	l.mu.Unlock()
+}
+
+// cleanup drops entries whose failures have been forgotten. Caller holds mu.
+func (l *Lockout) cleanup(now time.Time) {
+	for key, e := range l.entries {
+		if now.Sub(e.lastFailure) >= l.max && now.After(e.lockedUntil) {
+			delete(l.entries, key)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+// Package reqid generates request IDs and carries them, together with a
+// logger tagged with them, through a request's context.
+package reqid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"go.uber.org/zap"
+)
+
+// Header is the HTTP header carrying the request ID
+const Header = "X-Request-ID"
+
+// maxLength is the longest incoming ID that is honoured
+const maxLength = 128
+
+type contextKey struct{}
+
+// entry is what a request's context carries
+type entry struct {
+	id     string
+	logger *zap.Logger
+}
+
+// New returns a random 32 character hex ID
+func New() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Valid reports whether an incoming ID may be reused: 1 to 128 printable
+// ASCII characters without spaces, so it cannot break log lines or headers
+func Valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// WithID returns a context carrying id and logger tagged with it
+func WithID(ctx context.Context, id string, logger *zap.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, entry{
+		id:     id,
+		logger: logger.With(zap.String("request_id", id)),
+	})
+}
+
+// FromContext returns the request ID of ctx, or "" if there is none
+func FromContext(ctx context.Context) string {
+	e, _ := ctx.Value(contextKey{}).(entry)
+	return e.id
+}
+
+// Logger returns the logger tagged with the request ID of ctx, or fallback
+// outside of a request
+func Logger(ctx context.Context, fallback *zap.Logger) *zap.Logger {
+	if e, ok := ctx.Value(contextKey{}).(entry); ok {
+		return e.logger
+	}
+	return fallback
+}
@@ -0,0 +1,61 @@
+package reqid
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestNew(t *testing.T) {
+	a, b := New(), New()
+	if len(a) != 32 || a == b || !Valid(a) {
+		t.Errorf("New() = %q, %q", a, b)
+	}
+}
+
+func TestValid(t *testing.T) {
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{"abc-123", true},
+		{"0f8fad5b-d9cb-469f-a165-70867728950e", true},
+		{"", false},
+		{"with space", false},
+		{"line\nbreak", false},
+		{"café", false},
+		{strings.Repeat("a", 128), true},
+		{strings.Repeat("a", 129), false},
+	}
+	for _, tt := range tests {
+		if got := Valid(tt.id); got != tt.want {
+			t.Errorf("Valid(%q) = %v, want %v", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestLogger(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	base := zap.New(core)
+
+	if got := Logger(context.Background(), base); got != base {
+		t.Error("Logger() without ID did not return the fallback")
+	}
+	if id := FromContext(context.Background()); id != "" {
+		t.Errorf("FromContext() = %q, want empty", id)
+	}
+
+	ctx := WithID(context.Background(), "req-1", base)
+	if id := FromContext(ctx); id != "req-1" {
+		t.Errorf("FromContext() = %q, want req-1", id)
+	}
+	Logger(ctx, zap.NewNop()).Info("hello")
+
+	entries := logs.All()
+	if len(entries) != 1 || entries[0].ContextMap()["request_id"] != "req-1" {
+		t.Errorf("log entries = %+v, want one tagged with req-1", entries)
+	}
+}
@@ -0,0 +1,219 @@
+// Package rotate provides an io.Writer that writes to a file and rotates it
+// by size, keeping a limited number of timestamped backups.
+package rotate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat is the timestamp inserted into backup file names
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// Config contains rotation settings
+type Config struct {
+	Filename   string
+	MaxSizeMB  int           // Rotate once the file would exceed this size (0 = never)
+	MaxBackups int           // Rotated files to keep (0 = all)
+	MaxAge     time.Duration // Remove rotated files older than this (0 = never)
+}
+
+// Writer appends to Filename and rotates it. Backups are named
+// name-<timestamp>.ext next to the file. It is safe for concurrent use.
+type Writer struct {
+	cfg  Config
+	mu   sync.Mutex
+	file *os.File
+	size int64
+	now  func() time.Time
+}
+
+// New opens (or creates) the file for appending
+func New(cfg Config) (*Writer, error) {
+	if cfg.Filename == "" {
+		return nil, fmt.Errorf("rotate: filename is required")
+	}
+	w := &Writer{cfg: cfg, now: time.Now}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Write appends p, rotating first if the file would exceed MaxSizeMB
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	max := int64(w.cfg.MaxSizeMB) << 20
+	if max > 0 && w.size > 0 && w.size+int64(len(p)) > max {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Rotate closes the current file, renames it to a backup and starts a new one
+func (w *Writer) Rotate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.rotate()
+}
+
+// Reopen closes and reopens the file without renaming it, for use after an
+// external tool such as logrotate moved it
+func (w *Writer) Reopen() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file != nil {
+		w.file.Close()
+		w.file = nil
+	}
+	return w.open()
+}
+
+// Sync flushes the file to disk
+func (w *Writer) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+	return w.file.Sync()
+}
+
+// Close closes the file
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+// open opens the file for appending, creating its directory if needed
+func (w *Writer) open() error {
+	if err := os.MkdirAll(filepath.Dir(w.cfg.Filename), 0755); err != nil {
+		return fmt.Errorf("rotate: failed to create log directory: %w", err)
+	}
+
+	f, err := os.OpenFile(w.cfg.Filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("rotate: failed to open log file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("rotate: failed to stat log file: %w", err)
+	}
+
+	w.file = f
+	w.size = info.Size()
+	return nil
+}
+
+// rotate moves the current file to a backup, opens a new one and prunes
+// old backups. Must be called with mu held.
+func (w *Writer) rotate() error {
+	if w.file != nil {
+		w.file.Close()
+		w.file = nil
+	}
+
+	if err := os.Rename(w.cfg.Filename, w.backupName(w.now())); err != nil && !os.IsNotExist(err) {
+		// Keep writing to the current file rather than losing logs
+		if openErr := w.open(); openErr != nil {
+			return openErr
+		}
+		return fmt.Errorf("rotate: failed to rename log file: %w", err)
+	}
+
+	if err := w.open(); err != nil {
+		return err
+	}
+
+	w.prune()
+	return nil
+}
+
+// backupName returns the backup file name for a rotation at t
+func (w *Writer) backupName(t time.Time) string {
+	dir, prefix, ext := w.nameParts()
+	return filepath.Join(dir, prefix+t.Format(backupTimeFormat)+ext)
+}
+
+// nameParts splits Filename into directory, backup prefix and extension
+func (w *Writer) nameParts() (dir, prefix, ext string) {
+	dir = filepath.Dir(w.cfg.Filename)
+	base := filepath.Base(w.cfg.Filename)
+	ext = filepath.Ext(base)
+	return dir, strings.TrimSuffix(base, ext) + "-", ext
+}
+
+// backup is a rotated file and the time it was rotated
+type backup struct {
+	path string
+	at   time.Time
+}
+
+// backups returns the rotated files, newest first
+func (w *Writer) backups() []backup {
+	dir, prefix, ext := w.nameParts()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	var found []backup
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ext) {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, prefix), ext)
+		at, err := time.ParseInLocation(backupTimeFormat, stamp, time.Local)
+		if err != nil {
+			continue
+		}
+		found = append(found, backup{path: filepath.Join(dir, name), at: at})
+	}
+
+	sort.Slice(found, func(i, j int) bool { return found[i].at.After(found[j].at) })
+	return found
+}
+
+// prune removes backups beyond MaxBackups or older than MaxAge
+func (w *Writer) prune() {
+	if w.cfg.MaxBackups <= 0 && w.cfg.MaxAge <= 0 {
+		return
+	}
+
+	cutoff := w.now().Add(-w.cfg.MaxAge)
+	for i, b := range w.backups() {
+		tooMany := w.cfg.MaxBackups > 0 && i >= w.cfg.MaxBackups
+		tooOld := w.cfg.MaxAge > 0 && b.at.Before(cutoff)
+		if tooMany || tooOld {
+			os.Remove(b.path)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package rotate
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriter_RotatesBySize(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "access.log")
+
+	w, err := New(Config{Filename: name, MaxSizeMB: 1})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer w.Close()
+
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.Local)
+	w.now = func() time.Time { return now }
+
+	line := []byte(strings.Repeat("x", 600<<10) + "\n")
+	for i := 0; i < 2; i++ {
+		if _, err := w.Write(line); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+
+	backup := filepath.Join(dir, "access-2026-01-02T03-04-05.000.log")
+	if info, err := os.Stat(backup); err != nil || info.Size() != int64(len(line)) {
+		t.Fatalf("expected backup with the first line, stat = %v, %v", info, err)
+	}
+	if info, err := os.Stat(name); err != nil || info.Size() != int64(len(line)) {
+		t.Fatalf("expected current file with the second line, stat = %v, %v", info, err)
+	}
+}
+
+func TestWriter_AppendsToExistingFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "logs", "app.log")
+
+	for _, s := range []string{"one\n", "two\n"} {
+		w, err := New(Config{Filename: name})
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		w.Write([]byte(s))
+		w.Close()
+	}
+
+	data, err := os.ReadFile(name)
+	if err != nil || string(data) != "one\ntwo\n" {
+		t.Errorf("file = %q, %v; want both lines", data, err)
+	}
+}
+
+func TestWriter_PrunesBackups(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "app.log")
+
+	w, err := New(Config{Filename: name, MaxBackups: 2, MaxAge: 48 * time.Hour})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer w.Close()
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.Local)
+	for i := 0; i < 4; i++ {
+		at := start.Add(time.Duration(i) * time.Hour)
+		w.now = func() time.Time { return at }
+		w.Write([]byte("line\n"))
+		if err := w.Rotate(); err != nil {
+			t.Fatalf("Rotate() error = %v", err)
+		}
+	}
+
+	if got := len(w.backups()); got != 2 {
+		t.Errorf("backups = %d, want 2", got)
+	}
+
+	// Two days later everything is past MaxAge
+	w.now = func() time.Time { return start.Add(72 * time.Hour) }
+	w.Write([]byte("line\n"))
+	w.Rotate()
+	if got := len(w.backups()); got != 1 {
+		t.Errorf("backups = %d, want only the newest after MaxAge", got)
+	}
+}
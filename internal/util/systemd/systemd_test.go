@@ -0,0 +1,80 @@
+package systemd
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestListeners_NotActivated(t *testing.T) {
+	t.Setenv("LISTEN_PID", "1")
+	t.Setenv("LISTEN_FDS", "1")
+
+	listeners, err := Listeners()
+	if err != nil {
+		t.Fatalf("Listeners: %v", err)
+	}
+	if listeners != nil {
+		t.Errorf("got %d listeners for another process's LISTEN_PID, want none", len(listeners))
+	}
+	if _, ok := os.LookupEnv("LISTEN_FDS"); ok {
+		t.Error("LISTEN_FDS still set")
+	}
+}
+
+func TestNotify(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	if sent, err := Notify(Ready); sent || err != nil {
+		t.Fatalf("Notify without socket = %v, %v; want false, nil", sent, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Skipf("unixgram sockets unavailable: %v", err)
+	}
+	defer conn.Close()
+	t.Setenv("NOTIFY_SOCKET", path)
+
+	if sent, err := Notify(Ready); !sent || err != nil {
+		t.Fatalf("Notify = %v, %v; want true, nil", sent, err)
+	}
+
+	buf := make([]byte, 64)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("read notification: %v", err)
+	}
+	if got := string(buf[:n]); got != Ready {
+		t.Errorf("received %q, want %q", got, Ready)
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	t.Setenv("WATCHDOG_PID", "")
+	t.Setenv("WATCHDOG_USEC", "")
+	if d, err := WatchdogInterval(); d != 0 || err != nil {
+		t.Fatalf("WatchdogInterval without env = %v, %v; want 0, nil", d, err)
+	}
+
+	t.Setenv("WATCHDOG_USEC", "30000000")
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+	if d, err := WatchdogInterval(); d != 30*time.Second || err != nil {
+		t.Errorf("WatchdogInterval = %v, %v; want 30s, nil", d, err)
+	}
+
+	t.Setenv("WATCHDOG_PID", "1")
+	if d, _ := WatchdogInterval(); d != 0 {
+		t.Errorf("WatchdogInterval for another pid = %v, want 0", d)
+	}
+
+	t.Setenv("WATCHDOG_PID", "")
+	t.Setenv("WATCHDOG_USEC", "abc")
+	if _, err := WatchdogInterval(); err == nil {
+		t.Error("expected error for invalid WATCHDOG_USEC")
+	}
+}
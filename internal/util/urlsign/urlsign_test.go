@@ -0,0 +1,52 @@
+package urlsign
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestSignVerify(t *testing.T) {
+	s := New("secret")
+	now := time.Unix(1700000000, 0)
+	expires := now.Add(time.Hour)
+
+	query := s.Sign("token123", expires)
+	got, err := s.Verify("token123", query, now)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if !got.Equal(expires) {
+		t.Errorf("Verify() expiry = %v, want %v", got, expires)
+	}
+}
+
+func TestVerify_Rejects(t *testing.T) {
+	s := New("secret")
+	now := time.Unix(1700000000, 0)
+	query := s.Sign("token123", now.Add(time.Hour))
+
+	tampered := url.Values{"exp": {"1800000000"}, "sig": query["sig"]}
+
+	tests := []struct {
+		name   string
+		signer *Signer
+		token  string
+		query  url.Values
+		now    time.Time
+		want   error
+	}{
+		{"other token", s, "token456", query, now, ErrInvalid},
+		{"other secret", New("other"), "token123", query, now, ErrInvalid},
+		{"extended expiry", s, "token123", tampered, now, ErrInvalid},
+		{"missing signature", s, "token123", url.Values{"exp": query["exp"]}, now, ErrInvalid},
+		{"malformed signature", s, "token123", url.Values{"exp": query["exp"], "sig": {"%%%"}}, now, ErrInvalid},
+		{"expired", s, "token123", query, now.Add(time.Hour), ErrExpired},
+	}
+	for _, tt := range tests {
+		if _, err := tt.signer.Verify(tt.token, tt.query, tt.now); !errors.Is(err, tt.want) {
+			t.Errorf("%s: Verify() error = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+// Package wakeup tells goroutines sleeping until there is work that something
+// changed, so they need not poll for it.
+package wakeup
+
+import "sync"
+
+// Signal wakes every goroutine waiting on it. A nil Signal never fires.
+type Signal struct {
+	mu sync.Mutex
+	ch chan struct{}
+}
+
+// New creates a Signal
+func New() *Signal {
+	return &Signal{ch: make(chan struct{})}
+}
+
+// C returns a channel that is closed by the next Notify. Take it before
+// checking for work, so a Notify in between is not missed.
+func (s *Signal) C() <-chan struct{} {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ch
+}
+
+// Notify wakes all goroutines waiting on a channel returned by C
+func (s *Signal) Notify() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	close(s.ch)
+	s.ch = make(chan struct{})
+}
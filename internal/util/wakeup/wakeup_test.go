@@ -0,0 +1,35 @@
+package wakeup
+
+import "testing"
+
+func TestSignal_Notify(t *testing.T) {
+	s := New()
+	first, second := s.C(), s.C()
+
+	s.Notify()
+	for i, c := range []<-chan struct{}{first, second} {
+		select {
+		case <-c:
+		default:
+			t.Errorf("waiter %d not woken", i)
+		}
+	}
+
+	// A channel taken after Notify waits for the next one
+	next := s.C()
+	select {
+	case <-next:
+		t.Fatal("channel taken after Notify is already closed")
+	default:
+	}
+	s.Notify()
+	<-next
+}
+
+func TestSignal_Nil(t *testing.T) {
+	var s *Signal
+	s.Notify()
+	if s.C() != nil {
+		t.Error("C() of a nil Signal is not nil")
+	}
+}
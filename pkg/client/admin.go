@@ -0,0 +1,177 @@
+package client
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Stats returns the statistics history (viewer role)
+func (c *Client) Stats(ctx context.Context, q StatsQuery) (*Stats, error) {
+	query := url.Values{}
+	if q.Range > 0 {
+		query.Set("range", q.Range.String())
+	}
+	if !q.Since.IsZero() {
+		query.Set("since", q.Since.Format(time.RFC3339))
+	}
+	if !q.Until.IsZero() {
+		query.Set("until", q.Until.Format(time.RFC3339))
+	}
+	if q.Instance != "" {
+		query.Set("instance", q.Instance)
+	}
+
+	var stats Stats
+	if err := c.getJSON(ctx, "/api/v1/stats", query, &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// SearchFiles searches the tracked files (viewer role)
+func (c *Client) SearchFiles(ctx context.Context, s FileSearch) (*FileList, error) {
+	query := pageQuery(s.Limit, s.Offset)
+	setString(query, "q", s.Query)
+	setString(query, "owner", s.Owner)
+	setString(query, "label", s.Label)
+	setString(query, "sort", s.Sort)
+	if s.Cached != nil {
+		query.Set("cached", strconv.FormatBool(*s.Cached))
+	}
+	if s.Priority != nil {
+		query.Set("priority", strconv.Itoa(*s.Priority))
+	}
+	if s.MinSize > 0 {
+		query.Set("min_size", strconv.FormatInt(s.MinSize, 10))
+	}
+	if s.MaxSize > 0 {
+		query.Set("max_size", strconv.FormatInt(s.MaxSize, 10))
+	}
+	if s.Desc {
+		query.Set("order", "desc")
+	}
+
+	var list FileList
+	if err := c.getJSON(ctx, "/api/v1/files/search", query, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// MissingFiles lists files whose download found them deleted on the NAS,
+// most recently found first (viewer role)
+func (c *Client) MissingFiles(ctx context.Context, limit, offset int) (*FileList, error) {
+	var list FileList
+	if err := c.getJSON(ctx, "/api/v1/files/missing", pageQuery(limit, offset), &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// ActiveTasks lists in-progress downloads with their progress (viewer role)
+func (c *Client) ActiveTasks(ctx context.Context, limit, offset int) ([]TaskProgress, error) {
+	var resp struct {
+		Tasks []TaskProgress `json:"tasks"`
+	}
+	if err := c.getJSON(ctx, "/api/v1/tasks/active", pageQuery(limit, offset), &resp); err != nil {
+		return nil, err
+	}
+	return resp.Tasks, nil
+}
+
+// Workers lists the download workers with their current task and receive
+// rate (viewer role)
+func (c *Client) Workers(ctx context.Context) ([]Worker, error) {
+	var resp struct {
+		Workers []Worker `json:"workers"`
+	}
+	if err := c.getJSON(ctx, "/api/v1/workers", nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Workers, nil
+}
+
+// GetTaskProgress returns the progress of a task (viewer role). Finished
+// tasks are removed from the queue and return an error for which
+// IsNotFound is true.
+func (c *Client) GetTaskProgress(ctx context.Context, taskID int64) (*TaskProgress, error) {
+	var progress TaskProgress
+	if err := c.getJSON(ctx, "/api/v1/tasks/"+strconv.FormatInt(taskID, 10)+"/progress", nil, &progress); err != nil {
+		return nil, err
+	}
+	return &progress, nil
+}
+
+// FailedTasks lists the tasks that ran out of retries (viewer role)
+func (c *Client) FailedTasks(ctx context.Context, limit, offset int) ([]Task, error) {
+	var resp struct {
+		Tasks []Task `json:"tasks"`
+	}
+	if err := c.getJSON(ctx, "/api/v1/tasks/failed", pageQuery(limit, offset), &resp); err != nil {
+		return nil, err
+	}
+	return resp.Tasks, nil
+}
+
+// RetryTask resets a failed task to pending (operator role)
+func (c *Client) RetryTask(ctx context.Context, taskID int64) error {
+	return c.postJSON(ctx, "/api/v1/tasks/"+strconv.FormatInt(taskID, 10)+"/retry", nil, nil, nil)
+}
+
+// RetryFailedTasks resets the failed tasks matching filter to pending and
+// returns how many were reset (operator role)
+func (c *Client) RetryFailedTasks(ctx context.Context, filter FailedTaskFilter) (int, error) {
+	query := url.Values{}
+	setString(query, "error", filter.Error)
+	setString(query, "path_prefix", filter.PathPrefix)
+
+	var resp struct {
+		Retried int `json:"retried"`
+	}
+	if err := c.postJSON(ctx, "/api/v1/tasks/failed/retry", query, nil, &resp); err != nil {
+		return 0, err
+	}
+	return resp.Retried, nil
+}
+
+// RequestCache looks up the Drive file at path on the NAS, records it with
+// at least the given priority (1-5, 0 for the server default) and enqueues
+// its download (operator role)
+func (c *Client) RequestCache(ctx context.Context, path string, priority int) (*CacheRequest, error) {
+	body := struct {
+		Path     string `json:"path"`
+		Priority int    `json:"priority,omitempty"`
+	}{path, priority}
+
+	var result CacheRequest
+	if err := c.postJSON(ctx, "/api/v1/cache", nil, body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// TriggerSync requests an incremental sync (operator role)
+func (c *Client) TriggerSync(ctx context.Context) error {
+	return c.postJSON(ctx, "/api/v1/sync", nil, nil, nil)
+}
+
+// pageQuery returns the limit/offset parameters, leaving out zero values
+func pageQuery(limit, offset int) url.Values {
+	query := url.Values{}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	if offset > 0 {
+		query.Set("offset", strconv.Itoa(offset))
+	}
+	return query
+}
+
+// setString sets a query parameter unless v is empty
+func setString(query url.Values, key, v string) {
+	if v != "" {
+		query.Set(key, v)
+	}
+}
@@ -0,0 +1,110 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return New(srv.URL, &Options{
+		Token:          "sfc_test",
+		RetryBaseDelay: time.Millisecond,
+		RetryMaxDelay:  5 * time.Millisecond,
+	})
+}
+
+func TestClient_SearchFiles(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer sfc_test" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/api/v1/files/search" ||
+			r.URL.RawQuery != "cached=false&limit=10&order=desc&priority=1&q=report&sort=size" {
+			http.Error(w, "unexpected request "+r.URL.String(), http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `{"files":[{"id":7,"path":"/team/report.pdf","size":42,"cached":false,"priority":1}],"total":1,"limit":10,"offset":0}`)
+	})
+
+	list, err := c.SearchFiles(context.Background(), FileSearch{
+		Query:    "report",
+		Cached:   Bool(false),
+		Priority: Int(1),
+		Sort:     "size",
+		Desc:     true,
+		Limit:    10,
+	})
+	if err != nil {
+		t.Fatalf("SearchFiles() error = %v", err)
+	}
+	if list.Total != 1 || len(list.Files) != 1 || list.Files[0].Path != "/team/report.pdf" || list.Files[0].Size != 42 {
+		t.Errorf("SearchFiles() = %+v", list)
+	}
+}
+
+func TestClient_Retry(t *testing.T) {
+	var calls atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/stats":
+			if calls.Add(1) < 3 {
+				http.Error(w, "NAS unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			fmt.Fprint(w, `{"cache_max_bytes":100,"snapshots":[],"summary":{"hit_ratio":-1}}`)
+		case "/api/v1/tasks/9/retry":
+			calls.Add(1)
+			w.Header().Set("X-Request-ID", "req-1")
+			http.Error(w, "Failed task not found", http.StatusNotFound)
+		case "/api/v1/cache":
+			calls.Add(1)
+			http.Error(w, "NAS request failed: timeout", http.StatusBadGateway)
+		}
+	})
+	ctx := context.Background()
+
+	stats, err := c.Stats(ctx, StatsQuery{Range: time.Hour})
+	if err != nil || stats.CacheMaxBytes != 100 || calls.Load() != 3 {
+		t.Fatalf("Stats() = %+v, %v after %d calls", stats, err, calls.Load())
+	}
+
+	// Client errors are returned right away
+	calls.Store(0)
+	err = c.RetryTask(ctx, 9)
+	apiErr, ok := err.(*APIError)
+	if !ok || !IsNotFound(err) || apiErr.Message != "Failed task not found" || apiErr.RequestID != "req-1" || calls.Load() != 1 {
+		t.Errorf("RetryTask() error = %v after %d calls", err, calls.Load())
+	}
+
+	// A POST answered with 502 may have been applied and is not retried
+	calls.Store(0)
+	if _, err := c.RequestCache(ctx, "/a.pdf", 1); err == nil || calls.Load() != 1 {
+		t.Errorf("RequestCache() error = %v after %d calls", err, calls.Load())
+	}
+}
+
+func TestClient_RetryCanceled(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Retry-After", "30")
+		http.Error(w, "Too many requests", http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+	c := New(srv.URL, &Options{RetryMaxDelay: time.Minute})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.FailedTasks(ctx, 0, 0); err == nil || calls.Load() != 1 {
+		t.Errorf("FailedTasks() error = %v after %d calls, want 1 call", err, calls.Load())
+	}
+}
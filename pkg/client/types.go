@@ -0,0 +1,182 @@
+package client
+
+import "time"
+
+// Task statuses
+const (
+	TaskStatusPending    = "pending"
+	TaskStatusInProgress = "in_progress"
+	TaskStatusFailed     = "failed"
+)
+
+// CacheStatusCached is CacheRequest.Status for a file that was already cached
+const CacheStatusCached = "cached"
+
+// StatsQuery selects the statistics history returned by Stats. Zero values
+// use the server defaults: the last 24 hours of this instance.
+type StatsQuery struct {
+	Range    time.Duration // Counted back from Until, ignored when Since is set
+	Since    time.Time
+	Until    time.Time // Default: now
+	Instance string    // "all" returns the snapshots of every instance
+}
+
+// Stats is the statistics history of GET /api/v1/stats
+type Stats struct {
+	Since           time.Time      `json:"since"`
+	Until           time.Time      `json:"until"`
+	Instance        string         `json:"instance,omitempty"`         // Empty when sampling is disabled
+	IntervalSeconds int64          `json:"interval_seconds,omitempty"` // Sampling interval
+	CacheMaxBytes   int64          `json:"cache_max_bytes"`
+	Snapshots       []StatSnapshot `json:"snapshots"`
+	Summary         StatsSummary   `json:"summary"`
+	Totals          *AccessTotals  `json:"totals,omitempty"`
+}
+
+// StatSnapshot is one statistics sample
+type StatSnapshot struct {
+	Instance        string    `json:"instance"`
+	TakenAt         time.Time `json:"taken_at"`
+	TotalFiles      int64     `json:"total_files"`
+	CachedFiles     int64     `json:"cached_files"`
+	CachedBytes     int64     `json:"cached_bytes"`
+	CacheHits       int64     `json:"cache_hits"`
+	CacheMisses     int64     `json:"cache_misses"`
+	DownloadedBytes int64     `json:"downloaded_bytes"`
+	ServedBytes     int64     `json:"served_bytes"`
+	PendingTasks    int       `json:"pending_tasks"`
+	InProgressTasks int       `json:"in_progress_tasks"`
+	FailedTasks     int       `json:"failed_tasks"`
+	QueuedBytes     int64     `json:"queued_bytes"`
+}
+
+// StatsSummary totals the snapshots of a Stats query
+type StatsSummary struct {
+	Snapshots         int     `json:"snapshots"`
+	CacheHits         int64   `json:"cache_hits"`
+	CacheMisses       int64   `json:"cache_misses"`
+	HitRatio          float64 `json:"hit_ratio"` // -1 without requests
+	DownloadedBytes   int64   `json:"downloaded_bytes"`
+	ServedBytes       int64   `json:"served_bytes"`
+	CachedBytesGrowth int64   `json:"cached_bytes_growth"`
+	PeakCachedBytes   int64   `json:"peak_cached_bytes"`
+	PeakPendingTasks  int     `json:"peak_pending_tasks"`
+}
+
+// AccessTotals holds the per-file access counters summed over all files
+type AccessTotals struct {
+	CacheHits   int64   `json:"cache_hits"`
+	CacheMisses int64   `json:"cache_misses"`
+	HitRatio    float64 `json:"hit_ratio"` // -1 without requests
+	ServedBytes int64   `json:"served_bytes"`
+}
+
+// FileSearch filters SearchFiles. Zero values don't filter.
+type FileSearch struct {
+	Query    string // Path substring, or glob when it contains *, ? or [...]
+	Cached   *bool
+	Priority *int
+	MinSize  int64
+	MaxSize  int64
+	Owner    string
+	Label    string
+	Sort     string // path (default), size, modified, priority, last_access, accesses, served or misses
+	Desc     bool
+	Limit    int // Default 100, max 1000
+	Offset   int
+}
+
+// FileList is a page of files
+type FileList struct {
+	Files  []File `json:"files"`
+	Total  int    `json:"total"`
+	Limit  int    `json:"limit"`
+	Offset int    `json:"offset"`
+}
+
+// File is a tracked file
+type File struct {
+	ID                int64      `json:"id"`
+	Path              string     `json:"path"`
+	Size              int64      `json:"size"`
+	ModifiedAt        *time.Time `json:"modified_at,omitempty"`
+	Cached            bool       `json:"cached"`
+	Stale             bool       `json:"stale,omitempty"`
+	Priority          int        `json:"priority"`
+	Owner             string     `json:"owner,omitempty"`
+	Labels            []string   `json:"labels,omitempty"`
+	ContentType       string     `json:"content_type,omitempty"`
+	Starred           bool       `json:"starred"`
+	Shared            bool       `json:"shared"`
+	LastAccessAt      *time.Time `json:"last_access_at,omitempty"`
+	AccessCount       int64      `json:"access_count"`
+	BytesServed       int64      `json:"bytes_served"`
+	MissCount         int64      `json:"miss_count"`
+	MissingUpstreamAt *time.Time `json:"missing_upstream_at,omitempty"`
+}
+
+// Task is a download task
+type Task struct {
+	ID              int64      `json:"id"`
+	FileID          int64      `json:"file_id"`
+	SynoPath        string     `json:"syno_path"`
+	Priority        int        `json:"priority"`
+	Size            int64      `json:"size"`
+	Status          string     `json:"status"`
+	WorkerID        string     `json:"worker_id,omitempty"`
+	BytesDownloaded int64      `json:"bytes_downloaded"`
+	RetryCount      int        `json:"retry_count"`
+	MaxRetries      int        `json:"max_retries"`
+	NextRetryAt     *time.Time `json:"next_retry_at,omitempty"`
+	LastError       string     `json:"last_error,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	ClaimedAt       *time.Time `json:"claimed_at,omitempty"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// TaskProgress is the download progress of a task
+type TaskProgress struct {
+	TaskID          int64      `json:"task_id"`
+	SynoPath        string     `json:"syno_path"`
+	Status          string     `json:"status"`
+	WorkerID        string     `json:"worker_id,omitempty"`
+	BytesDownloaded int64      `json:"bytes_downloaded"`
+	Size            int64      `json:"size"`
+	Percent         float64    `json:"percent"`
+	BytesPerSecond  float64    `json:"bytes_per_second"`
+	ETASeconds      *int64     `json:"eta_seconds"` // nil while the speed is unknown
+	ClaimedAt       *time.Time `json:"claimed_at,omitempty"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// Worker is a download worker of the server process
+type Worker struct {
+	ID             string     `json:"id"`
+	State          string     `json:"state"`                  // idle, downloading or paused
+	MaxPriority    *int       `json:"max_priority,omitempty"` // nil unless reserved for urgent tasks
+	Task           *Task      `json:"task,omitempty"`
+	TaskStartedAt  *time.Time `json:"task_started_at,omitempty"`
+	BytesPerSecond float64    `json:"bytes_per_second"`
+	BytesReceived  int64      `json:"bytes_received"`
+	TasksCompleted int        `json:"tasks_completed"`
+	TasksFailed    int        `json:"tasks_failed"`
+	LastError      string     `json:"last_error,omitempty"`
+	LastHeartbeat  time.Time  `json:"last_heartbeat"`
+	LastDataAt     *time.Time `json:"last_data_at,omitempty"`
+}
+
+// FailedTaskFilter selects the failed tasks retried by RetryFailedTasks.
+// Empty fields match every task.
+type FailedTaskFilter struct {
+	Error      string // Substring of the last error
+	PathPrefix string
+}
+
+// CacheRequest is the result of RequestCache
+type CacheRequest struct {
+	FileID   int64  `json:"file_id"`
+	Path     string `json:"path"`
+	Priority int    `json:"priority"`
+	Status   string `json:"status"`            // CacheStatusCached, TaskStatusPending or TaskStatusInProgress
+	TaskID   int64  `json:"task_id,omitempty"` // 0 when already cached
+}
@@ -0,0 +1,313 @@
+package synoclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeNAS serves the subset of the DSM Web API used by the tests
+type fakeNAS struct {
+	logins  atomic.Int32
+	expired atomic.Bool // Next Drive call fails with a session timeout
+	dsm     string      // version_string of SYNO.DSM.Info ("" = not reported)
+	legacy  bool        // Drive takes the DSM 6 request variants
+}
+
+func (n *fakeNAS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	switch q.Get("api") {
+	case "SYNO.API.Info":
+		fmt.Fprint(w, `{"success":true,"data":{"SYNO.DSM.Info":{"path":"entry.cgi","minVersion":1,"maxVersion":2},"SYNO.SynologyDrive.Files":{"path":"entry.cgi","minVersion":1,"maxVersion":2},"SYNO.Office.Export":{"path":"entry.cgi","minVersion":1,"maxVersion":1},"SYNO.FileStation.Sharing":{"path":"entry.cgi","minVersion":1,"maxVersion":3}}}`)
+	case "SYNO.API.Auth":
+		if q.Get("method") == "login" {
+			if q.Get("passwd") != "secret" {
+				fmt.Fprint(w, `{"success":false,"error":{"code":400}}`)
+				return
+			}
+			n.logins.Add(1)
+			fmt.Fprintf(w, `{"success":true,"data":{"sid":"sid-%d"}}`, n.logins.Load())
+			return
+		}
+		fmt.Fprint(w, `{"success":true}`)
+	case APIDSMInfo:
+		fmt.Fprintf(w, `{"success":true,"data":{"model":"DS920+","version_string":%q}}`, n.dsm)
+	case APIDriveFiles:
+		if q.Get("_sid") == "" || n.expired.CompareAndSwap(true, false) {
+			fmt.Fprint(w, `{"success":false,"error":{"code":119}}`)
+			return
+		}
+		switch q.Get("method") {
+		case "list_starred":
+			fmt.Fprint(w, `{"success":true,"data":{"offset":0,"total":1,"items":[{"file_id":"42","name":"a.txt","display_path":"/a.txt","content_type":"file","size":5,"starred":true}]}}`)
+		case "recent", "list_recent":
+			if (q.Get("method") == "list_recent") != n.legacy {
+				fmt.Fprint(w, `{"success":false,"error":{"code":103}}`)
+				return
+			}
+			fmt.Fprint(w, `{"success":true,"data":{"offset":0,"total":0,"items":[]}}`)
+		case "list_labelled":
+			if strings.HasPrefix(q.Get("label_id"), `"`) == n.legacy {
+				fmt.Fprint(w, `{"success":false,"error":{"code":101}}`)
+				return
+			}
+			fmt.Fprint(w, `{"success":true,"data":{"offset":0,"total":0,"items":[]}}`)
+		case "download":
+			content := "hello world"
+			if rng := r.Header.Get("Range"); rng == "bytes=6-" {
+				w.Header().Set("Content-Disposition", `attachment; filename="a.txt"`)
+				w.WriteHeader(http.StatusPartialContent)
+				io.WriteString(w, content[6:])
+				return
+			}
+			w.Header().Set("Content-Disposition", `attachment; filename="a.txt"`)
+			io.WriteString(w, content)
+		}
+	case APIOfficeExport:
+		if q.Get("path") != `"id:7"` || q.Get("format") != "docx" {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"success":false,"error":{"code":101}}`)
+			return
+		}
+		w.Header().Set("Content-Disposition", `attachment; filename="report.docx"`)
+		io.WriteString(w, "docx bytes")
+	case APIFileStationSharing:
+		if q.Get("method") != "create" || q.Get("date_expired") != "2030-01-02" {
+			fmt.Fprint(w, `{"success":false,"error":{"code":101}}`)
+			return
+		}
+		if q.Get("path") == "/docs/locked.pdf" {
+			fmt.Fprint(w, `{"success":true,"data":{"links":[{"error":407,"path":"/docs/locked.pdf"}]}}`)
+			return
+		}
+		fmt.Fprint(w, `{"success":true,"data":{"links":[{"error":0,"id":"abc123","path":"/docs/a.pdf","url":"https://nas/sharing/abc123"}]}}`)
+	default:
+		fmt.Fprint(w, `{"success":false,"error":{"code":102}}`)
+	}
+}
+
+func newTestClient(t *testing.T, password string) (*Client, *fakeNAS) {
+	t.Helper()
+	nas := &fakeNAS{}
+	srv := httptest.NewServer(nas)
+	t.Cleanup(srv.Close)
+	return New(srv.URL+"/", "user", password, &Options{HTTPClient: srv.Client(), DownloadHTTPClient: srv.Client()}), nas
+}
+
+func TestClient_LoginAndList(t *testing.T) {
+	c, _ := newTestClient(t, "secret")
+	ctx := context.Background()
+
+	if err := c.Login(ctx); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if c.SID() != "sid-1" {
+		t.Errorf("SID = %q, want sid-1", c.SID())
+	}
+
+	resp, err := c.GetStarredFiles(ctx, 0, 100)
+	if err != nil {
+		t.Fatalf("GetStarredFiles: %v", err)
+	}
+	if len(resp.Items) != 1 || resp.Items[0].GetID() != 42 || resp.Items[0].Path != "/a.txt" {
+		t.Errorf("unexpected items: %+v", resp.Items)
+	}
+
+	if err := c.Logout(ctx); err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+	if c.IsLoggedIn() {
+		t.Error("still logged in after Logout")
+	}
+}
+
+func TestClient_LoginFailure(t *testing.T) {
+	c, _ := newTestClient(t, "wrong")
+
+	err := c.Login(context.Background())
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != 400 {
+		t.Fatalf("Login error = %v, want APIError 400", err)
+	}
+	if apiErr.Message != "error code 400" {
+		t.Errorf("Message = %q", apiErr.Message)
+	}
+}
+
+func TestClient_ReloginOnSessionError(t *testing.T) {
+	c, nas := newTestClient(t, "secret")
+	ctx := context.Background()
+
+	if err := c.Login(ctx); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	nas.expired.Store(true)
+
+	if _, err := c.GetStarredFiles(ctx, 0, 100); err != nil {
+		t.Fatalf("GetStarredFiles after expiry: %v", err)
+	}
+	if got := nas.logins.Load(); got != 2 {
+		t.Errorf("logins = %d, want 2", got)
+	}
+}
+
+func TestClient_DownloadWithRange(t *testing.T) {
+	c, _ := newTestClient(t, "secret")
+	ctx := context.Background()
+	if err := c.Login(ctx); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	body, filename, _, err := c.DownloadFileWithRange(ctx, 42, "", 6)
+	if err != nil {
+		t.Fatalf("DownloadFileWithRange: %v", err)
+	}
+	defer body.Close()
+
+	data, _ := io.ReadAll(body)
+	if string(data) != "world" || filename != "a.txt" {
+		t.Errorf("got %q (%q), want %q (%q)", data, filename, "world", "a.txt")
+	}
+}
+
+func TestClient_ExportOfficeFile(t *testing.T) {
+	c, _ := newTestClient(t, "secret")
+	ctx := context.Background()
+	if err := c.Login(ctx); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	body, filename, _, err := c.ExportOfficeFile(ctx, 7, "", "docx")
+	if err != nil {
+		t.Fatalf("ExportOfficeFile: %v", err)
+	}
+	defer body.Close()
+
+	data, _ := io.ReadAll(body)
+	if string(data) != "docx bytes" || filename != "report.docx" {
+		t.Errorf("got %q (%q), want %q (%q)", data, filename, "docx bytes", "report.docx")
+	}
+
+	if _, _, _, err := c.ExportOfficeFile(ctx, 7, "", "odt"); err == nil {
+		t.Error("ExportOfficeFile with unsupported format succeeded")
+	}
+}
+
+func TestClient_CanceledContext(t *testing.T) {
+	c, _ := newTestClient(t, "secret")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := c.Login(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Login with canceled context = %v, want context canceled", err)
+	}
+}
+
+func TestClient_CreateShareLink(t *testing.T) {
+	c, _ := newTestClient(t, "secret")
+	ctx := context.Background()
+	if err := c.Login(ctx); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	expires := time.Date(2030, 1, 2, 12, 0, 0, 0, time.Local)
+
+	link, err := c.CreateShareLink(ctx, "/docs/a.pdf", &expires)
+	if err != nil {
+		t.Fatalf("CreateShareLink: %v", err)
+	}
+	if link.ID != "abc123" || link.URL != "https://nas/sharing/abc123" || link.Path != "/docs/a.pdf" {
+		t.Errorf("unexpected link: %+v", link)
+	}
+
+	var apiErr *APIError
+	if _, err := c.CreateShareLink(ctx, "/docs/locked.pdf", &expires); !errors.As(err, &apiErr) || apiErr.Code != 407 {
+		t.Errorf("CreateShareLink error = %v, want APIError 407", err)
+	}
+}
+
+func TestClient_Identification(t *testing.T) {
+	nas := &fakeNAS{}
+	var unidentified atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.UserAgent() != "cache/1.0" || q.Get("client") != "cache" || q.Get("api") == "" {
+			unidentified.Add(1)
+		}
+		nas.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	c := New(srv.URL, "user", "secret", &Options{
+		UserAgent: "cache/1.0",
+		Params:    url.Values{"client": {"cache"}, "api": {"ignored"}},
+	})
+	ctx := context.Background()
+
+	if err := c.Login(ctx); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if _, err := c.GetStarredFiles(ctx, 0, 100); err != nil {
+		t.Fatalf("GetStarredFiles: %v", err)
+	}
+	body, _, _, err := c.DownloadFile(ctx, 42, "")
+	if err != nil {
+		t.Fatalf("DownloadFile: %v", err)
+	}
+	body.Close()
+	if n := unidentified.Load(); n != 0 {
+		t.Errorf("%d requests without the user agent and parameters", n)
+	}
+}
+
+func TestClient_ProbeDSM6(t *testing.T) {
+	c, nas := newTestClient(t, "secret")
+	nas.dsm, nas.legacy = "DSM 6.2.4-25556 Update 7", true
+	ctx := context.Background()
+
+	if err := c.Login(ctx); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	caps := c.Capabilities()
+	if caps.DSMMajor != 6 || caps.DriveVersion != 2 || caps.RecentMethod != "list_recent" || caps.QuoteLabelIDs {
+		t.Errorf("Capabilities = %+v", caps)
+	}
+
+	if _, err := c.GetRecentFiles(ctx, 0, 100); err != nil {
+		t.Errorf("GetRecentFiles: %v", err)
+	}
+	if _, err := c.GetLabeledFiles(ctx, "3", 0, 100); err != nil {
+		t.Errorf("GetLabeledFiles: %v", err)
+	}
+}
+
+func TestClient_VariantFallback(t *testing.T) {
+	// The DSM version is not reported, so the DSM 7 variants are tried first
+	c, nas := newTestClient(t, "secret")
+	nas.legacy = true
+	ctx := context.Background()
+
+	if err := c.Login(ctx); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if caps := c.Capabilities(); caps.DSMMajor != 0 || caps.RecentMethod != "recent" || !caps.QuoteLabelIDs {
+		t.Fatalf("Capabilities without a DSM version = %+v", caps)
+	}
+
+	if _, err := c.GetRecentFiles(ctx, 0, 100); err != nil {
+		t.Errorf("GetRecentFiles: %v", err)
+	}
+	if _, err := c.GetLabeledFiles(ctx, "3", 0, 100); err != nil {
+		t.Errorf("GetLabeledFiles: %v", err)
+	}
+	if caps := c.Capabilities(); caps.RecentMethod != "list_recent" || caps.QuoteLabelIDs {
+		t.Errorf("Capabilities after fallback = %+v", caps)
+	}
+}
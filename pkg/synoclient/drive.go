@@ -0,0 +1,588 @@
+package synoclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DriveFile represents a file from Synology Drive API
+type DriveFile struct {
+	ID            json.Number  `json:"file_id"`
+	Name          string       `json:"name"`
+	Path          string       `json:"display_path"`
+	ContentType   string       `json:"content_type"` // "dir" or "file"
+	Size          int64        `json:"size"`
+	MTime         int64        `json:"content_mtime"` // Content modification time (Unix timestamp)
+	ATime         int64        `json:"access_time"`   // Access time
+	Starred       bool         `json:"starred"`
+	Shared        bool         `json:"adv_shared"`
+	PermanentLink string       `json:"permanent_link"` // Share token for adv_shared files
+	Labels        []DriveLabel `json:"labels,omitempty"`
+	Owner         DriveOwner   `json:"owner"`
+}
+
+// DriveOwner is the user owning a Drive file
+type DriveOwner struct {
+	UID         int    `json:"uid"`
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+}
+
+// GetID returns the file ID as int64
+func (f *DriveFile) GetID() int64 {
+	id, _ := f.ID.Int64()
+	return id
+}
+
+// GetIDString returns the file ID as string
+func (f *DriveFile) GetIDString() string {
+	return f.ID.String()
+}
+
+// IsDir returns true if the file is a directory
+func (f *DriveFile) IsDir() bool {
+	return f.ContentType == "dir"
+}
+
+// GetMTime returns the modification time as time.Time
+func (f *DriveFile) GetMTime() *time.Time {
+	if f.MTime <= 0 {
+		return nil
+	}
+	t := time.Unix(f.MTime, 0)
+	return &t
+}
+
+// GetATime returns the access time as time.Time
+func (f *DriveFile) GetATime() *time.Time {
+	if f.ATime <= 0 {
+		return nil
+	}
+	t := time.Unix(f.ATime, 0)
+	return &t
+}
+
+// MIMEType returns ContentType when Drive reports a MIME type for the file.
+// For most items Drive only reports the kind ("file" or "dir").
+func (f *DriveFile) MIMEType() string {
+	if strings.Contains(f.ContentType, "/") {
+		return f.ContentType
+	}
+	return ""
+}
+
+// LabelNames returns the names of the file's labels
+func (f *DriveFile) LabelNames() []string {
+	if len(f.Labels) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(f.Labels))
+	for _, l := range f.Labels {
+		names = append(names, l.Name)
+	}
+	return names
+}
+
+// DriveLabel represents a label in Drive
+type DriveLabel struct {
+	ID   string `json:"label_id"`
+	Name string `json:"name"`
+}
+
+// DriveTeamFolder represents a team folder in Drive
+type DriveTeamFolder struct {
+	ID   json.Number `json:"file_id"`
+	Name string      `json:"name"`
+	Path string      `json:"display_path"` // Root of the team folder, e.g. "/team-folders/Marketing"
+}
+
+// GetIDString returns the team folder ID as string
+func (f *DriveTeamFolder) GetIDString() string {
+	return f.ID.String()
+}
+
+// DriveListResponse is the response from listing Drive files
+type DriveListResponse struct {
+	Offset int         `json:"offset"`
+	Total  int         `json:"total"`
+	Items  []DriveFile `json:"items"`
+}
+
+// DriveListOptions contains options for listing files in Drive
+type DriveListOptions struct {
+	Path          string // Folder path
+	FileID        int64  // Alternative: use file ID instead of path
+	Offset        int
+	Limit         int
+	SortBy        string // name, time, size, type
+	SortDirection string // asc, desc
+	FileType      string // dir, file, all
+}
+
+// AdvanceSharingInfo represents advanced sharing information for a file
+type AdvanceSharingInfo struct {
+	SharingLink     string `json:"sharing_link"`
+	URL             string `json:"url"`
+	ProtectPassword string `json:"protect_password"`
+	DueDate         int64  `json:"due_date"`
+}
+
+// GetExpiresAt returns the expiration time as *time.Time
+func (a *AdvanceSharingInfo) GetExpiresAt() *time.Time {
+	if a.DueDate <= 0 {
+		return nil
+	}
+	t := time.Unix(a.DueDate, 0)
+	return &t
+}
+
+// GetSharedFiles returns files shared with others
+func (c *Client) GetSharedFiles(ctx context.Context, offset, limit int) (*DriveListResponse, error) {
+	apiPath, version, err := c.getAPIPath(ctx, APIDriveFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	params := url.Values{
+		"api":            {APIDriveFiles},
+		"version":        {strconv.Itoa(version)},
+		"method":         {"shared_with_others"},
+		"sort_by":        {`"owner"`},
+		"sort_direction": {`"asc"`},
+		"filter":         {`{"include_transient":true}`},
+	}
+
+	if offset > 0 {
+		params.Set("offset", strconv.Itoa(offset))
+	}
+	if limit > 0 {
+		params.Set("limit", strconv.Itoa(limit))
+	}
+
+	resp, err := c.doAPIRequestWithRetry(ctx, apiPath, params)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseListResponse(resp)
+}
+
+// GetStarredFiles returns starred files
+func (c *Client) GetStarredFiles(ctx context.Context, offset, limit int) (*DriveListResponse, error) {
+	apiPath, version, err := c.getAPIPath(ctx, APIDriveFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	params := url.Values{
+		"api":            {APIDriveFiles},
+		"version":        {strconv.Itoa(version)},
+		"method":         {"list_starred"},
+		"sort_by":        {`"owner"`},
+		"sort_direction": {`"asc"`},
+		"filter":         {`{"include_transient":true}`},
+	}
+
+	if offset > 0 {
+		params.Set("offset", strconv.Itoa(offset))
+	}
+	if limit > 0 {
+		params.Set("limit", strconv.Itoa(limit))
+	}
+
+	resp, err := c.doAPIRequestWithRetry(ctx, apiPath, params)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseListResponse(resp)
+}
+
+// GetLabeledFiles returns files with a specific label
+func (c *Client) GetLabeledFiles(ctx context.Context, labelID string, offset, limit int) (*DriveListResponse, error) {
+	apiPath, version, err := c.getAPIPath(ctx, APIDriveFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	quote := c.Capabilities().QuoteLabelIDs
+	params := url.Values{
+		"api":            {APIDriveFiles},
+		"version":        {strconv.Itoa(version)},
+		"method":         {"list_labelled"},
+		"label_id":       {labelIDParam(labelID, quote)},
+		"sort_by":        {`"owner"`},
+		"sort_direction": {`"asc"`},
+		"filter":         {`{"include_transient":true}`},
+	}
+
+	if offset > 0 {
+		params.Set("offset", strconv.Itoa(offset))
+	}
+	if limit > 0 {
+		params.Set("limit", strconv.Itoa(limit))
+	}
+
+	resp, err := c.doAPIRequestWithRetry(ctx, apiPath, params)
+	if isAPIError(err, ErrInvalidParam) {
+		// The probe guessed the quoting wrong, e.g. a DSM version it does not know
+		params.Set("label_id", labelIDParam(labelID, !quote))
+		if resp, err = c.doAPIRequestWithRetry(ctx, apiPath, params); err == nil {
+			c.updateCapabilities(func(caps *Capabilities) { caps.QuoteLabelIDs = !quote })
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return parseListResponse(resp)
+}
+
+// labelIDParam formats a label ID for list_labelled, as a JSON string when quoted
+func labelIDParam(labelID string, quoted bool) string {
+	if quoted {
+		return fmt.Sprintf(`"%s"`, labelID)
+	}
+	return labelID
+}
+
+// GetRecentFiles returns recently accessed/modified files
+func (c *Client) GetRecentFiles(ctx context.Context, offset, limit int) (*DriveListResponse, error) {
+	apiPath, version, err := c.getAPIPath(ctx, APIDriveFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	method := c.Capabilities().RecentMethod
+	params := url.Values{
+		"api":     {APIDriveFiles},
+		"version": {strconv.Itoa(version)},
+		"method":  {method},
+	}
+
+	if offset > 0 {
+		params.Set("offset", strconv.Itoa(offset))
+	}
+	if limit > 0 {
+		params.Set("limit", strconv.Itoa(limit))
+	}
+
+	resp, err := c.doAPIRequestWithRetry(ctx, apiPath, params)
+	if isAPIError(err, ErrMethodNotExists) {
+		// The probe guessed the method wrong; the other release's name may work
+		other := recentMethodDSM6
+		if method == recentMethodDSM6 {
+			other = recentMethodDSM7
+		}
+		params.Set("method", other)
+		if resp, err = c.doAPIRequestWithRetry(ctx, apiPath, params); err == nil {
+			c.updateCapabilities(func(caps *Capabilities) { caps.RecentMethod = other })
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return parseListResponse(resp)
+}
+
+// GetLabels returns all labels
+func (c *Client) GetLabels(ctx context.Context) ([]DriveLabel, error) {
+	apiPath, version, err := c.getAPIPath(ctx, APIDriveLabels)
+	if err != nil {
+		return nil, err
+	}
+
+	params := url.Values{
+		"api":     {APIDriveLabels},
+		"version": {strconv.Itoa(version)},
+		"method":  {"list"},
+	}
+
+	resp, err := c.doAPIRequestWithRetry(ctx, apiPath, params)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Items []DriveLabel `json:"items"`
+		Total int          `json:"total"`
+	}
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse labels response: %w", err)
+	}
+
+	return result.Items, nil
+}
+
+// GetTeamFolders returns the team folders the user can access
+func (c *Client) GetTeamFolders(ctx context.Context) ([]DriveTeamFolder, error) {
+	apiPath, version, err := c.getAPIPath(ctx, APIDriveTeamFolder)
+	if err != nil {
+		return nil, err
+	}
+
+	params := url.Values{
+		"api":     {APIDriveTeamFolder},
+		"version": {strconv.Itoa(version)},
+		"method":  {"list"},
+	}
+
+	resp, err := c.doAPIRequestWithRetry(ctx, apiPath, params)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Items []DriveTeamFolder `json:"items"`
+		Total int               `json:"total"`
+	}
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse team folders response: %w", err)
+	}
+
+	return result.Items, nil
+}
+
+// ListFiles lists files in a folder
+func (c *Client) ListFiles(ctx context.Context, opts *DriveListOptions) (*DriveListResponse, error) {
+	apiPath, version, err := c.getAPIPath(ctx, APIDriveFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	params := url.Values{
+		"api":     {APIDriveFiles},
+		"version": {strconv.Itoa(version)},
+		"method":  {"list"},
+	}
+
+	if opts != nil {
+		if opts.Path != "" {
+			params.Set("path", opts.Path)
+		}
+		if opts.FileID > 0 {
+			params.Set("file_id", strconv.FormatInt(opts.FileID, 10))
+		}
+		if opts.Offset > 0 {
+			params.Set("offset", strconv.Itoa(opts.Offset))
+		}
+		if opts.Limit > 0 {
+			params.Set("limit", strconv.Itoa(opts.Limit))
+		}
+		if opts.SortBy != "" {
+			params.Set("sort_by", opts.SortBy)
+		}
+		if opts.SortDirection != "" {
+			params.Set("sort_direction", opts.SortDirection)
+		}
+		if opts.FileType != "" {
+			params.Set("type", opts.FileType)
+		}
+	}
+
+	resp, err := c.doAPIRequestWithRetry(ctx, apiPath, params)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseListResponse(resp)
+}
+
+// GetFileInfo returns the metadata of a single file or folder by path,
+// e.g. "/mydrive/report.pdf"
+func (c *Client) GetFileInfo(ctx context.Context, path string) (*DriveFile, error) {
+	if path == "" {
+		return nil, fmt.Errorf("path is required")
+	}
+
+	apiPath, version, err := c.getAPIPath(ctx, APIDriveFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	params := url.Values{
+		"api":     {APIDriveFiles},
+		"version": {strconv.Itoa(version)},
+		"method":  {"get"},
+		"path":    {fmt.Sprintf(`"%s"`, path)},
+	}
+
+	resp, err := c.doAPIRequestWithRetry(ctx, apiPath, params)
+	if err != nil {
+		return nil, err
+	}
+
+	var file DriveFile
+	if err := json.Unmarshal(resp.Data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse file info response: %w", err)
+	}
+	return &file, nil
+}
+
+// DownloadFile downloads a file by ID or path.
+// Returns: body reader, filename, content length (-1 if unknown), error
+func (c *Client) DownloadFile(ctx context.Context, fileID int64, path string) (io.ReadCloser, string, int64, error) {
+	return c.DownloadFileWithRange(ctx, fileID, path, -1)
+}
+
+// DownloadFileWithRange downloads a file starting at byte rangeStart, for
+// resuming; a negative rangeStart downloads the whole file. The response is
+// 206 Partial Content when the NAS honoured the range.
+func (c *Client) DownloadFileWithRange(ctx context.Context, fileID int64, path string, rangeStart int64) (io.ReadCloser, string, int64, error) {
+	apiPath, version, err := c.getAPIPath(ctx, APIDriveFiles)
+	if err != nil {
+		return nil, "", 0, err
+	}
+
+	var filesJSON string
+	if path != "" {
+		filesJSON = fmt.Sprintf(`["%s"]`, path)
+	} else if fileID > 0 {
+		filesJSON = fmt.Sprintf(`["%d"]`, fileID)
+	} else {
+		return nil, "", 0, fmt.Errorf("either file_id or path is required")
+	}
+
+	params := url.Values{
+		"api":     {APIDriveFiles},
+		"version": {strconv.Itoa(version)},
+		"method":  {"download"},
+		"files":   {filesJSON},
+	}
+
+	urlStr := c.buildURL(apiPath, params)
+
+	resp, err := c.doDownloadRequest(ctx, http.MethodGet, urlStr, rangeStart)
+	if err != nil {
+		return nil, "", 0, err
+	}
+
+	return readDownloadResponse(resp)
+}
+
+// ExportOfficeFile downloads a Synology Office document (odoc, osheet,
+// oslides) converted to format, e.g. "docx", "xlsx", "pptx" or "pdf".
+// Exports are generated on the fly, so ranges are not supported.
+func (c *Client) ExportOfficeFile(ctx context.Context, fileID int64, path string, format string) (io.ReadCloser, string, int64, error) {
+	apiPath, version, err := c.getAPIPath(ctx, APIOfficeExport)
+	if err != nil {
+		return nil, "", 0, err
+	}
+
+	params := url.Values{
+		"api":     {APIOfficeExport},
+		"version": {strconv.Itoa(version)},
+		"method":  {"download"},
+		"format":  {format},
+	}
+
+	if fileID > 0 {
+		params.Set("path", fmt.Sprintf(`"id:%d"`, fileID))
+	} else if path != "" {
+		params.Set("path", fmt.Sprintf(`"%s"`, path))
+	} else {
+		return nil, "", 0, fmt.Errorf("either file_id or path is required")
+	}
+
+	urlStr := c.buildURL(apiPath, params)
+
+	resp, err := c.doDownloadRequest(ctx, http.MethodGet, urlStr, -1)
+	if err != nil {
+		return nil, "", 0, err
+	}
+
+	return readDownloadResponse(resp)
+}
+
+// readDownloadResponse returns the body of a file download response, or the
+// API error when the NAS answered with JSON instead
+func readDownloadResponse(resp *http.Response) (io.ReadCloser, string, int64, error) {
+	// Check if response is an error (JSON)
+	contentType := resp.Header.Get("Content-Type")
+	if strings.Contains(contentType, "application/json") {
+		defer resp.Body.Close()
+
+		var apiResp Response
+		if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
+			return nil, "", 0, fmt.Errorf("failed to decode error response: %w", err)
+		}
+		return nil, "", 0, apiResp.err()
+	}
+
+	// Accept both 200 OK and 206 Partial Content
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		drain(resp.Body)
+		return nil, "", 0, &HTTPError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	// Get filename from Content-Disposition header
+	filename := ""
+	if cd := resp.Header.Get("Content-Disposition"); cd != "" {
+		if idx := strings.Index(cd, "filename="); idx != -1 {
+			filename = strings.Trim(cd[idx+9:], "\"")
+		}
+	}
+
+	return resp.Body, filename, resp.ContentLength, nil
+}
+
+// GetAdvanceSharing gets advanced sharing info for a file
+func (c *Client) GetAdvanceSharing(ctx context.Context, fileID int64, path string) (*AdvanceSharingInfo, error) {
+	apiPath, version, err := c.getAPIPath(ctx, APIDriveAdvanceSharing)
+	if err != nil {
+		return nil, err
+	}
+
+	params := url.Values{
+		"api":     {APIDriveAdvanceSharing},
+		"version": {strconv.Itoa(version)},
+		"method":  {"get"},
+	}
+
+	if fileID > 0 {
+		params.Set("path", fmt.Sprintf(`"id:%d"`, fileID))
+	} else if path != "" {
+		params.Set("path", fmt.Sprintf(`"%s"`, path))
+	} else {
+		return nil, fmt.Errorf("either file_id or path is required")
+	}
+
+	resp, err := c.doAPIRequestWithRetry(ctx, apiPath, params)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		SharingLink     string `json:"sharing_link"`
+		URL             string `json:"url"`
+		ProtectPassword string `json:"protect_password"`
+		DueDate         int64  `json:"due_date"`
+	}
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse advance sharing response: %w", err)
+	}
+
+	return &AdvanceSharingInfo{
+		SharingLink:     result.SharingLink,
+		URL:             result.URL,
+		ProtectPassword: result.ProtectPassword,
+		DueDate:         result.DueDate,
+	}, nil
+}
+
+// parseListResponse parses a drive list response
+func parseListResponse(resp *Response) (*DriveListResponse, error) {
+	var result DriveListResponse
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse list response: %w", err)
+	}
+	return &result, nil
+}
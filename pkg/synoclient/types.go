@@ -0,0 +1,151 @@
+package synoclient
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// APIEndpoint contains API path and version information
+type APIEndpoint struct {
+	Path       string `json:"path"`
+	MinVersion int    `json:"minVersion"`
+	MaxVersion int    `json:"maxVersion"`
+}
+
+// Response is the base response structure from Synology API
+type Response struct {
+	Success bool            `json:"success"`
+	Data    json.RawMessage `json:"data,omitempty"`
+	Error   *ErrorInfo      `json:"error,omitempty"`
+}
+
+// err converts an unsuccessful response into an *APIError
+func (r *Response) err() error {
+	code := 0
+	if r.Error != nil {
+		code = r.Error.Code
+	}
+	return &APIError{Code: code, Message: ErrorMessage(code)}
+}
+
+// ErrorInfo contains error details
+type ErrorInfo struct {
+	Code   int             `json:"code"`
+	Errors json.RawMessage `json:"errors,omitempty"`
+}
+
+// Common error codes
+const (
+	ErrUnknown           = 100
+	ErrInvalidParam      = 101
+	ErrAPINotExists      = 102
+	ErrMethodNotExists   = 103
+	ErrVersionNotSupport = 104
+	ErrNoPermission      = 105
+	ErrSessionTimeout    = 106
+	ErrDuplicateLogin    = 107
+	ErrSIDNotFound       = 119
+	ErrFileNotFound      = 408  // No such file or directory
+	ErrSystemBusy        = 1052 // Returned while DSM or a package is updating
+	ErrSystemUnavailable = 1053
+)
+
+// APIError represents an error from the Synology API
+type APIError struct {
+	Code    int
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// IsSessionError returns true if the error indicates session issues
+func (e *APIError) IsSessionError() bool {
+	return e.Code == ErrNoPermission || e.Code == ErrSessionTimeout || e.Code == ErrSIDNotFound
+}
+
+// IsTemporary returns true if the NAS is expected to recover without any
+// change on the client side, e.g. during DSM updates
+func (e *APIError) IsTemporary() bool {
+	return e.Code == ErrSystemBusy || e.Code == ErrSystemUnavailable
+}
+
+// IsNotFound returns true if the requested file no longer exists on the NAS
+func (e *APIError) IsNotFound() bool {
+	return e.Code == ErrFileNotFound
+}
+
+// HTTPError is returned when the NAS answers with an unexpected HTTP status
+type HTTPError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *HTTPError) Error() string {
+	return "unexpected status: " + e.Status
+}
+
+// IsTemporary returns true for server errors and rate limiting
+func (e *HTTPError) IsTemporary() bool {
+	return e.StatusCode >= 500 || e.StatusCode == 429
+}
+
+// IsNotFound returns true if the NAS answered 404 Not Found
+func (e *HTTPError) IsNotFound() bool {
+	return e.StatusCode == http.StatusNotFound
+}
+
+// errorMessages maps error codes to human-readable messages
+var errorMessages = map[int]string{
+	ErrUnknown:           "unknown error",
+	ErrInvalidParam:      "invalid parameter",
+	ErrAPINotExists:      "api does not exist",
+	ErrMethodNotExists:   "method does not exist",
+	ErrVersionNotSupport: "version not supported",
+	ErrNoPermission:      "no permission",
+	ErrSessionTimeout:    "session timeout",
+	ErrDuplicateLogin:    "duplicate login",
+	ErrSIDNotFound:       "sid not found",
+	ErrFileNotFound:      "no such file or directory",
+	ErrSystemBusy:        "system busy",
+	ErrSystemUnavailable: "system temporarily unavailable",
+}
+
+// ErrorMessage returns a human-readable message for an error code
+func ErrorMessage(code int) string {
+	if msg, ok := errorMessages[code]; ok {
+		return msg
+	}
+	return "error code " + strconv.Itoa(code)
+}
+
+// Drive API names
+const (
+	APIDriveFiles          = "SYNO.SynologyDrive.Files"
+	APIDriveNode           = "SYNO.SynologyDrive.Node"
+	APIDriveDownload       = "SYNO.SynologyDrive.Node.Download"
+	APIDriveSharing        = "SYNO.SynologyDrive.Sharing"
+	APIDriveShare          = "SYNO.SynologyDrive.Share"
+	APIDriveAdvanceSharing = "SYNO.SynologyDrive.AdvanceSharing"
+	APIDriveLabels         = "SYNO.SynologyDrive.Labels"
+	APIDriveTeamFolder     = "SYNO.SynologyDrive.TeamFolders"
+)
+
+// Office API names
+const (
+	APIOfficeExport = "SYNO.Office.Export"
+)
+
+// File Station API names
+const (
+	APIFileStationSharing = "SYNO.FileStation.Sharing"
+)
+
+const (
+	apiInfoPath        = "query.cgi"
+	authPath           = "auth.cgi"
+	defaultSessionName = "FileStation"
+	defaultUserAgent   = "synoclient"
+)